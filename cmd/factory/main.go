@@ -1,14 +1,44 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"dark-factory/internal/factory"
 )
 
+const usage = `usage:
+  factory run <pipeline.dot|-> (--workdir <path> | --git-url <url> [--git-ref <ref>]) --runsdir <path> [--run-id <id>] [--resume [--mark-node <node=outcome>]... [--note <text>] [--force] [--accept-workspace-drift]] [--replay-node <node=path>] [--disable-node <id>]... [--entry <node-id>] [--param <name=value>]... [--otel] [--notify-url <url>] [--notify-on <triggers>] [--metrics-listen <addr>] [--progress] [--no-cache] [--min-free-bytes <n>] [--add-workdir <path=mountpoint>]... [--report-formats <junit,sarif>] [--strict] [--fail-fast-guardrail] [--escalation-mode fail|interactive] [--diff-backend watch|snapshot|auto] [--log-file <path>] [--quiet] [--check-files] [--profile <name> [--profile-file <path>]]
+  factory rerun [--from-failed-workspace] <run-dir>
+  factory serve --runsdir <path> --queue-dir <path> [--max-concurrent-runs <n>]
+  factory serve status --queue-dir <path>
+  factory explain route --runsdir <path> <run-id> <from-node>
+  factory context --runsdir <path> --at-node <id> [--attempt <n>] [--before] [--flat] [--diff <node>] <run-id>
+  factory list --runsdir <path> [--status <status>] [--since <duration|time>] [--json]
+  factory runs list --runsdir <path> [--status <status>] [--since <duration|time>] [--json]
+  factory runs compare-env --runsdir <path> <run-a> <run-b>
+  factory runs deliver --runsdir <path> -o <dir> <run-id>
+  factory logs --runsdir <path> <run-id> [--node <id>] [--since <duration|time>] [--follow|--no-follow]
+  factory trace --runsdir <path> [--node <id>] [--type <type>]... [--since <duration|time>] [--until <duration|time>] [--fields <a,b>] [--follow] [--json] <run-id>
+  factory migrate-run <run-dir>
+  factory doctor [--repair] [--json] <run-dir>
+  factory escalation approve|deny --runsdir <path> --node <id> [--note <text>] <run-id>
+  factory fmt [--write|--check] <pipeline.dot>
+  factory validate [--strict] [--route-coverage [--json]] <pipeline.dot|->
+  factory validate --list-rules`
+
 func main() {
 	defer func() {
 		if r := recover(); r != nil {
@@ -16,37 +46,767 @@ func main() {
 			os.Exit(2)
 		}
 	}()
-	if len(os.Args) < 2 || os.Args[1] != "run" {
-		fmt.Fprintln(os.Stderr, "usage: factory run <pipeline.dot> --workdir <path> --runsdir <path> [--run-id <id>] [--resume]")
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+	switch os.Args[1] {
+	case "run":
+		runCmd(os.Args[2:])
+	case "rerun":
+		rerunCmd(os.Args[2:])
+	case "serve":
+		serveCmd(os.Args[2:])
+	case "explain":
+		explainCmd(os.Args[2:])
+	case "context":
+		contextCmd(os.Args[2:])
+	case "list":
+		listRunsCmd("list", os.Args[2:])
+	case "runs":
+		runsCmd(os.Args[2:])
+	case "logs":
+		logsCmd(os.Args[2:])
+	case "trace":
+		traceCmd(os.Args[2:])
+	case "migrate-run":
+		migrateRunCmd(os.Args[2:])
+	case "doctor":
+		doctorCmd(os.Args[2:])
+	case "escalation":
+		escalationCmd(os.Args[2:])
+	case "fmt":
+		fmtCmd(os.Args[2:])
+	case "validate":
+		validateCmd(os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
 		os.Exit(1)
 	}
+}
+
+func runCmd(argv []string) {
 	fs := flag.NewFlagSet("run", flag.ContinueOnError)
 	workdir := fs.String("workdir", "", "source workdir")
 	runsdir := fs.String("runsdir", "", "runs dir")
 	runID := fs.String("run-id", "", "run id")
 	resume := fs.Bool("resume", false, "resume run")
-	if err := fs.Parse(os.Args[2:]); err != nil {
+	replays := map[string]string{}
+	fs.Func("replay-node", "replay a recorded agent response for a node (node=path, repeatable)", func(v string) error {
+		id, path, err := attractor.ParseReplayNodeFlag(v)
+		if err != nil {
+			return err
+		}
+		replays[id] = path
+		return nil
+	})
+	entry := fs.String("entry", "", "start node to run from in a multi_entry graph")
+	disabled := []string{}
+	fs.Func("disable-node", "skip a node as if it set disabled=true, for this invocation only (repeatable)", func(v string) error {
+		if strings.TrimSpace(v) == "" {
+			return errors.New("node id is empty")
+		}
+		disabled = append(disabled, v)
+		return nil
+	})
+	params := map[string]string{}
+	fs.Func("param", "set a pipeline param referenced as ${param.<name>} (name=value, repeatable)", func(v string) error {
+		name, value, err := attractor.ParseParamFlag(v)
+		if err != nil {
+			return err
+		}
+		params[name] = value
+		return nil
+	})
+	marks := []attractor.NodeOutcomeOverride{}
+	fs.Func("mark-node", "override a node outcome before resuming (node=outcome, repeatable)", func(v string) error {
+		o, err := attractor.ParseMarkNodeFlag(v)
+		if err != nil {
+			return err
+		}
+		marks = append(marks, o)
+		return nil
+	})
+	extras := []attractor.AdditionalWorkdir{}
+	fs.Func("add-workdir", "copy another source directory into the workspace under a mountpoint (path=mountpoint, repeatable)", func(v string) error {
+		a, err := attractor.ParseAddWorkdirFlag(v)
+		if err != nil {
+			return err
+		}
+		extras = append(extras, a)
+		return nil
+	})
+	note := fs.String("note", "", "operator note recorded with --mark-node overrides")
+	force := fs.Bool("force", false, "create a synthetic status for --mark-node nodes that never ran")
+	acceptDrift := fs.Bool("accept-workspace-drift", false, "resume even if the workspace changed since the last checkpoint")
+	otel := fs.Bool("otel", false, "export the run as OpenTelemetry spans (OTLP/HTTP JSON, configured via OTEL_EXPORTER_OTLP_*)")
+	notifyURL := fs.String("notify-url", "", "POST run outcome notifications to this webhook (overrides graph notify_url)")
+	notifyOn := fs.String("notify-on", "", "comma-separated notification triggers: failure, guardrail, complete (default failure,complete)")
+	metricsListen := fs.String("metrics-listen", "", "serve Prometheus metrics on this address (for example :9090) at /metrics while the run executes")
+	noCache := fs.Bool("no-cache", false, "run cache=true tool nodes without reading or populating the tool result cache")
+	minFree := fs.Uint64("min-free-bytes", 0, "free bytes the runs dir filesystem must keep; checked at preflight (with 2x the workdir size) and between stages (default 64 MiB)")
+	reportFormats := fs.String("report-formats", "", "comma-separated CI reports to write to the run dir when the run ends: junit, sarif")
+	progress := fs.Bool("progress", false, "print one progress line per stage to stdout (colors and a spinner on a terminal); logs stay on stderr")
+	strict := fs.Bool("strict", false, "treat pipeline validation warnings as errors; with --resume, exit 4 if the run had already completed")
+	failFastGuardrail := fs.Bool("fail-fast-guardrail", false, "end the run (exit code 3) at the first guardrail violation instead of routing to a fix node")
+	escalationMode := fs.String("escalation-mode", "", "what a verification command outside its allowlist does: fail (default) or interactive, which waits for factory escalation approve|deny")
+	diffBackend := fs.String("diff-backend", "", "how stages find changed files: snapshot (default) walks the workspace, watch uses inotify on Linux, auto watches only large workspaces")
+	logFile := fs.String("log-file", "", "also write JSON log records to this file (default <runsdir>/<run-id>/run.log)")
+	quiet := fs.Bool("quiet", false, "do not log to stderr; records still go to the log file")
+	checkFiles := fs.Bool("check-files", false, "fail validation when scripts or directories the pipeline names are missing from the workdir")
+	profile := fs.String("profile", "", "apply a named profile from the profile file; explicit flags win over it")
+	profileFile := fs.String("profile-file", "", "profile file for --profile (default factory.json next to the pipeline)")
+	gitURL := fs.String("git-url", "", "check out this git repository into the workspace instead of copying --workdir")
+	gitRef := fs.String("git-ref", "", "branch, tag, or commit SHA for --git-url (default: the remote's HEAD)")
+	if err := fs.Parse(argv); err != nil {
 		os.Exit(1)
 	}
 	args := fs.Args()
-	if len(args) < 1 {
+	if len(args) < 1 && !*resume {
 		fmt.Fprintln(os.Stderr, "missing pipeline.dot")
 		os.Exit(1)
 	}
-	if *workdir == "" || *runsdir == "" {
-		fmt.Fprintln(os.Stderr, "--workdir and --runsdir are required")
+	pipelinePath := ""
+	if len(args) > 0 {
+		pipelinePath = args[0]
+	}
+	source, err := readPipelineArg(pipelinePath, os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if *profileFile != "" && *profile == "" {
+		fmt.Fprintln(os.Stderr, "--profile-file requires --profile")
+		os.Exit(1)
+	}
+	if *gitRef != "" && *gitURL == "" {
+		fmt.Fprintln(os.Stderr, "--git-ref requires --git-url")
 		os.Exit(1)
 	}
 	if *resume && *runID == "" {
 		fmt.Fprintln(os.Stderr, "--run-id required with --resume")
 		os.Exit(1)
 	}
-	cfg := attractor.RunConfig{PipelinePath: args[0], Workdir: *workdir, Runsdir: *runsdir, RunID: *runID, Resume: *resume}
+	if len(marks) > 0 && !*resume {
+		fmt.Fprintln(os.Stderr, "--mark-node requires --resume")
+		os.Exit(1)
+	}
+	cfg := attractor.RunConfig{PipelinePath: pipelinePath, PipelineSource: source, Workdir: *workdir, Runsdir: *runsdir, RunID: *runID, Resume: *resume, ReplayResponses: replays, MarkNodes: marks, MarkNote: *note, MarkForce: *force, AcceptWorkspaceDrift: *acceptDrift, EnableOTel: *otel, Params: params, NoCache: *noCache, MinFreeBytes: *minFree, AdditionalWorkdirs: extras, StrictValidation: *strict, FailFastOnGuardrail: *failFastGuardrail, LogFile: *logFile, Quiet: *quiet, CheckFiles: *checkFiles, DisableNodes: disabled, EntryNode: *entry}
+	if cfg.ReportFormats, err = attractor.ParseReportFormats(*reportFormats); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if cfg.EscalationMode, err = attractor.ParseEscalationMode(*escalationMode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if cfg.DiffBackend, err = attractor.ParseDiffBackend(*diffBackend); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *gitURL != "" {
+		cfg.GitSource = &attractor.GitSource{URL: *gitURL, Ref: *gitRef}
+	}
+	cfg.Notify.URL = *notifyURL
+	if *notifyOn != "" {
+		cfg.Notify.On = []string{*notifyOn}
+	}
+	if *profile != "" {
+		path := *profileFile
+		if path == "" {
+			path = attractor.DiscoverProfileFile(pipelinePath)
+		}
+		profiles, err := attractor.LoadProfiles(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		explicit := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		// A git source stands in for the workdir, so a profile's is ignored.
+		explicit["workdir"] = explicit["workdir"] || *gitURL != ""
+		if err := attractor.ApplyProfile(&cfg, profiles, *profile, explicit); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if (cfg.Workdir == "" && cfg.GitSource == nil) || cfg.Runsdir == "" {
+		fmt.Fprintln(os.Stderr, "--workdir (or --git-url) and --runsdir are required")
+		os.Exit(1)
+	}
+	if *progress {
+		cfg.Progress = os.Stdout
+	}
+	if *metricsListen != "" {
+		stop, err := serveMetrics(*metricsListen, &cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		defer stop()
+	}
 	if err := attractor.RunPipeline(cfg); err != nil {
 		if errors.Is(err, os.ErrInvalid) {
 			os.Exit(2)
 		}
+		fmt.Fprintln(os.Stderr, err.Error())
+		if errors.Is(err, attractor.ErrGuardrailViolation) {
+			os.Exit(3)
+		}
+		// Resuming a finished run is a no-op; --strict lets scripts tell
+		// it apart from a resume that ran stages.
+		if errors.Is(err, attractor.ErrRunCompleted) && cfg.Resume && len(marks) == 0 {
+			if *strict {
+				os.Exit(exitRunAlreadyCompleted)
+			}
+			return
+		}
+		os.Exit(1)
+	}
+}
+
+// exitRunAlreadyCompleted is the --resume --strict exit status for a run
+// that had already completed.
+const exitRunAlreadyCompleted = 4
+
+// readPipelineArg reads the pipeline from stdin when the path argument is
+// "-". Other paths are left for RunPipeline to read.
+func readPipelineArg(path string, stdin io.Reader) (string, error) {
+	if path != "-" {
+		return "", nil
+	}
+	b, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", fmt.Errorf("read pipeline from stdin: %w", err)
+	}
+	if strings.TrimSpace(string(b)) == "" {
+		return "", errors.New("empty pipeline on stdin")
+	}
+	return string(b), nil
+}
+
+func rerunCmd(argv []string) {
+	fs := flag.NewFlagSet("rerun", flag.ContinueOnError)
+	fromFailed := fs.Bool("from-failed-workspace", false, "seed the new workspace from the failed run's workspace instead of the original workdir")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	args := fs.Args()
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: factory rerun [--from-failed-workspace] <run-dir>")
+		os.Exit(1)
+	}
+	cfg, err := attractor.RerunConfig(filepath.Clean(args[0]), *fromFailed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "rerunning %s as %s\n", cfg.RetryOf, cfg.RunID)
+	if err := attractor.RunPipeline(cfg); err != nil {
+		if errors.Is(err, os.ErrInvalid) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, err.Error())
+		if errors.Is(err, attractor.ErrGuardrailViolation) {
+			os.Exit(3)
+		}
+		os.Exit(1)
+	}
+}
+
+func serveCmd(argv []string) {
+	if len(argv) > 0 && argv[0] == "status" {
+		serveStatusCmd(argv[1:])
+		return
+	}
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	runsdir := fs.String("runsdir", "", "runs dir")
+	queueDir := fs.String("queue-dir", "", "directory watched for job files")
+	maxRuns := fs.Int("max-concurrent-runs", 1, "number of queued runs executed at once")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	if *runsdir == "" || *queueDir == "" {
+		fmt.Fprintln(os.Stderr, "usage: factory serve --runsdir <path> --queue-dir <path> [--max-concurrent-runs <n>]")
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	q := &attractor.RunQueue{QueueDir: *queueDir, Runsdir: *runsdir, MaxConcurrent: *maxRuns}
+	if err := q.Serve(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func serveStatusCmd(argv []string) {
+	fs := flag.NewFlagSet("serve status", flag.ContinueOnError)
+	queueDir := fs.String("queue-dir", "", "queue directory of a running factory serve")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	if *queueDir == "" {
+		fmt.Fprintln(os.Stderr, "usage: factory serve status --queue-dir <path>")
+		os.Exit(1)
+	}
+	st, err := attractor.ReadQueueStatus(*queueDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	b, _ := json.MarshalIndent(st, "", "  ")
+	fmt.Println(string(b))
+}
+
+func explainCmd(argv []string) {
+	if len(argv) < 1 || argv[0] != "route" {
+		fmt.Fprintln(os.Stderr, "usage: factory explain route --runsdir <path> <run-id> <from-node>")
+		os.Exit(1)
+	}
+	fs := flag.NewFlagSet("explain route", flag.ContinueOnError)
+	runsdir := fs.String("runsdir", "", "runs dir")
+	if err := fs.Parse(argv[1:]); err != nil {
+		os.Exit(1)
+	}
+	args := fs.Args()
+	if *runsdir == "" || len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: factory explain route --runsdir <path> <run-id> <from-node>")
+		os.Exit(1)
+	}
+	out, err := attractor.ExplainRoute(filepath.Join(*runsdir, args[0]), args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Print(out)
+}
+
+func contextCmd(argv []string) {
+	fs := flag.NewFlagSet("context", flag.ContinueOnError)
+	runsdir := fs.String("runsdir", "", "runs dir")
+	atNode := fs.String("at-node", "", "node whose context to show")
+	attempt := fs.Int("attempt", 0, "attempt of the node, counting from 1 (default: the last)")
+	before := fs.Bool("before", false, "show the context before the node ran instead of after")
+	flat := fs.Bool("flat", false, "print key=value lines instead of JSON")
+	diff := fs.String("diff", "", "show what changed from --at-node to this node's last attempt")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	args := fs.Args()
+	if *runsdir == "" || *atNode == "" || len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: factory context --runsdir <path> --at-node <id> [--attempt <n>] [--before] [--flat] [--diff <node>] <run-id>")
+		os.Exit(1)
+	}
+	runDir := filepath.Join(*runsdir, args[0])
+	pick := func(node string, attempt int) map[string]any {
+		snap, err := attractor.ContextAt(runDir, node, attempt)
+		if err == nil && !*before && snap.After == nil {
+			err = fmt.Errorf("attempt %d of node %s did not finish; use --before", snap.Attempt, node)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		if *before {
+			return snap.Before
+		}
+		return snap.After
+	}
+	ctx := pick(*atNode, *attempt)
+	var err error
+	switch {
+	case *diff != "":
+		err = attractor.WriteContextDiff(os.Stdout, ctx, pick(*diff, 0))
+	case *flat:
+		err = attractor.WriteContextFlat(os.Stdout, ctx)
+	default:
+		err = attractor.WriteContextJSON(os.Stdout, ctx)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func runsCmd(argv []string) {
+	if len(argv) < 1 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+	switch argv[0] {
+	case "list":
+		listRunsCmd("runs list", argv[1:])
+	case "compare-env":
+		compareEnvCmd(argv[1:])
+	case "deliver":
+		deliverCmd(argv[1:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(1)
+	}
+}
+
+func listRunsCmd(name string, argv []string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	runsdir := fs.String("runsdir", "", "runs dir")
+	status := fs.String("status", "", "only list runs with this status (for example failed or running)")
+	since := fs.String("since", "", "only list runs started after a duration ago (24h) or RFC3339 time")
+	asJSON := fs.Bool("json", false, "print the listing as JSON")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	if *runsdir == "" || fs.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "usage: factory %s --runsdir <path> [--status <status>] [--since <duration|time>] [--json]\n", name)
+		os.Exit(1)
+	}
+	sinceAt, err := attractor.ParseTimeFlag("--since", *since, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	runs, err := attractor.ListRuns(*runsdir, attractor.ListRunsOptions{Status: *status, Since: sinceAt})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if *asJSON {
+		b, _ := json.MarshalIndent(runs, "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+	for _, r := range runs {
+		id := strings.Repeat("  ", r.Depth) + r.RunID
+		if r.RetryOf != "" {
+			id += " (retry of " + r.RetryOf + ")"
+		}
+		duration := "-"
+		if r.DurationSeconds > 0 {
+			duration = (time.Duration(r.DurationSeconds * float64(time.Second))).Round(time.Second).String()
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\n", id, r.StartedAt, r.Status, duration, r.FinalNode, r.Goal)
+	}
+}
+
+func compareEnvCmd(argv []string) {
+	fs := flag.NewFlagSet("runs compare-env", flag.ContinueOnError)
+	runsdir := fs.String("runsdir", "", "runs dir")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	args := fs.Args()
+	if *runsdir == "" || len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: factory runs compare-env --runsdir <path> <run-a> <run-b>")
+		os.Exit(1)
+	}
+	out, err := attractor.CompareRunEnvironments(filepath.Join(*runsdir, args[0]), filepath.Join(*runsdir, args[1]))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Print(out)
+}
+
+func deliverCmd(argv []string) {
+	fs := flag.NewFlagSet("runs deliver", flag.ContinueOnError)
+	runsdir := fs.String("runsdir", "", "runs dir")
+	outDir := fs.String("o", "", "output directory")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	args := fs.Args()
+	if *runsdir == "" || *outDir == "" || len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: factory runs deliver --runsdir <path> -o <dir> <run-id>")
+		os.Exit(1)
+	}
+	files, err := attractor.ExtractDeliverables(filepath.Join(*runsdir, args[0]), *outDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	for _, f := range files {
+		fmt.Println(f)
+	}
+}
+
+func logsCmd(argv []string) {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	runsdir := fs.String("runsdir", "", "runs dir")
+	node := fs.String("node", "", "only show this node")
+	since := fs.String("since", "", "only show output after a duration ago (10m) or RFC3339 time")
+	follow := fs.Bool("follow", true, "keep following until the pipeline finishes")
+	noFollow := fs.Bool("no-follow", false, "print what has been written so far and exit")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	args := fs.Args()
+	if *runsdir == "" || len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: factory logs --runsdir <path> <run-id> [--node <id>] [--since <duration|time>] [--follow|--no-follow]")
+		os.Exit(1)
+	}
+	sinceAt, err := attractor.ParseLogsSince(*since, time.Now())
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := attractor.LogsOptions{Node: *node, Since: sinceAt, Follow: *follow && !*noFollow}
+	if err := attractor.RunLogs(ctx, filepath.Join(*runsdir, args[0]), opts, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func traceCmd(argv []string) {
+	fs := flag.NewFlagSet("trace", flag.ContinueOnError)
+	runsdir := fs.String("runsdir", "", "runs dir")
+	node := fs.String("node", "", "only show records for this node")
+	types := []string{}
+	fs.Func("type", "only show records of this type (repeatable or comma-separated)", func(v string) error {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+		return nil
+	})
+	since := fs.String("since", "", "only show records after a duration ago (10m) or RFC3339 time")
+	until := fs.String("until", "", "only show records before a duration ago (10m) or RFC3339 time")
+	fields := fs.String("fields", "", "comma-separated record keys to show besides type, node_id, and at")
+	follow := fs.Bool("follow", false, "keep following until the pipeline finishes")
+	asJSON := fs.Bool("json", false, "write matching records as NDJSON")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	args := fs.Args()
+	if *runsdir == "" || len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: factory trace --runsdir <path> [--node <id>] [--type <type>]... [--since <duration|time>] [--until <duration|time>] [--fields <a,b>] [--follow] [--json] <run-id>")
+		os.Exit(1)
+	}
+	now := time.Now()
+	query := attractor.TraceQueryOptions{Node: *node, Types: types}
+	var err error
+	if query.Since, err = attractor.ParseTimeFlag("--since", *since, now); err == nil {
+		query.Until, err = attractor.ParseTimeFlag("--until", *until, now)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	for _, f := range strings.Split(*fields, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			query.Fields = append(query.Fields, f)
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := attractor.TraceOptions{Query: query, JSON: *asJSON, Follow: *follow}
+	if err := attractor.RunTrace(ctx, filepath.Join(*runsdir, args[0]), opts, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func migrateRunCmd(argv []string) {
+	if len(argv) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: factory migrate-run <run-dir>")
+		os.Exit(1)
+	}
+	from, to, err := attractor.MigrateRunDir(argv[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("%s: layout version %d -> %d\n", argv[0], from, to)
+}
+
+func doctorCmd(argv []string) {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "truncate corrupt trailing JSONL lines, strip other corrupt lines, and clear a stale run lock")
+	asJSON := fs.Bool("json", false, "write the report as JSON")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	args := fs.Args()
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: factory doctor [--repair] [--json] <run-dir>")
+		os.Exit(1)
+	}
+	rep, err := attractor.DiagnoseRun(args[0])
+	if err == nil && *repair {
+		err = attractor.RepairRun(&rep)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if *asJSON {
+		b, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+	attractor.WriteDoctorReport(os.Stdout, rep)
+}
+
+func escalationCmd(argv []string) {
+	const escalationUsage = "usage: factory escalation approve|deny --runsdir <path> --node <id> [--note <text>] <run-id>"
+	if len(argv) < 1 || (argv[0] != "approve" && argv[0] != "deny") {
+		fmt.Fprintln(os.Stderr, escalationUsage)
+		os.Exit(1)
+	}
+	fs := flag.NewFlagSet("escalation "+argv[0], flag.ContinueOnError)
+	runsdir := fs.String("runsdir", "", "runs dir")
+	node := fs.String("node", "", "node whose pending escalation to answer")
+	note := fs.String("note", "", "note recorded in the approvals ledger")
+	if err := fs.Parse(argv[1:]); err != nil {
+		os.Exit(1)
+	}
+	args := fs.Args()
+	if *runsdir == "" || *node == "" || len(args) != 1 {
+		fmt.Fprintln(os.Stderr, escalationUsage)
+		os.Exit(1)
+	}
+	resp := attractor.EscalationResponse{Decision: argv[0], Note: *note}
+	if err := attractor.RespondEscalation(filepath.Join(*runsdir, args[0]), *node, resp); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func fmtCmd(argv []string) {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := fs.Bool("write", false, "rewrite the pipeline file in place")
+	check := fs.Bool("check", false, "exit 1 if the pipeline file is not formatted")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	args := fs.Args()
+	if len(args) != 1 || (*write && *check) {
+		fmt.Fprintln(os.Stderr, "usage: factory fmt [--write|--check] <pipeline.dot>")
+		os.Exit(1)
+	}
+	b, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	out, err := attractor.FormatDOT(string(b))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	switch {
+	case *check:
+		if out != string(b) {
+			fmt.Fprintf(os.Stderr, "%s is not formatted\n", args[0])
+			os.Exit(1)
+		}
+	case *write:
+		if out == string(b) {
+			return
+		}
+		if err := os.WriteFile(args[0], []byte(out), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	default:
+		fmt.Print(out)
+	}
+}
+
+func validateCmd(argv []string) {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	strict := fs.Bool("strict", false, "treat warnings as errors")
+	listRules := fs.Bool("list-rules", false, "list the available validation rules and exit")
+	routeCoverage := fs.Bool("route-coverage", false, "report which outcomes of each node have a route, and warn about fail outcomes with none")
+	asJSON := fs.Bool("json", false, "with --route-coverage, print the report as JSON")
+	if err := fs.Parse(argv); err != nil {
+		os.Exit(1)
+	}
+	if *listRules {
+		for _, r := range attractor.ValidationRules() {
+			mode := "opt-in"
+			if r.Default {
+				mode = "default"
+			}
+			fmt.Printf("%-22s %-8s %s\n", r.ID, mode, r.Description)
+		}
+		return
+	}
+	args := fs.Args()
+	if len(args) != 1 || (*asJSON && !*routeCoverage) {
+		fmt.Fprintln(os.Stderr, "usage: factory validate [--strict] [--route-coverage [--json]] <pipeline.dot|->\n       factory validate --list-rules")
+		os.Exit(1)
+	}
+	source, err := readPipelineArg(args[0], os.Stdin)
+	if err == nil && source == "" {
+		var b []byte
+		b, err = os.ReadFile(args[0])
+		source = string(b)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	g, err := attractor.ParseDOT(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	diags := attractor.ValidateGraph(g)
+	if *routeCoverage && !hasRule(diags, "route_coverage") {
+		diags = append(diags, attractor.RouteCoverageDiagnostics(g)...)
+	}
+	if *strict {
+		diags = attractor.StrictDiagnostics(diags)
+	}
+	// The JSON report owns stdout, so diagnostics go to stderr.
+	out := os.Stdout
+	if *asJSON {
+		out = os.Stderr
+	}
+	for _, d := range diags {
+		fmt.Fprintf(out, "%s [%s] %s\n", d.Level, d.Rule, d.Message)
+	}
+	if *routeCoverage {
+		report := attractor.RouteCoverage(g)
+		if *asJSON {
+			b, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(b))
+		} else {
+			_ = attractor.WriteRouteCoverageTable(os.Stdout, report)
+		}
+	}
+	if attractor.HasErrors(diags) {
+		os.Exit(1)
+	}
+}
+
+func hasRule(diags []attractor.Diagnostic, rule string) bool {
+	for _, d := range diags {
+		if d.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// serveMetrics starts a /metrics endpoint backed by a fresh registry that is
+// attached to cfg. The returned func shuts the server down.
+func serveMetrics(addr string, cfg *attractor.RunConfig) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("--metrics-listen: %w", err)
+	}
+	reg := attractor.NewPrometheusMetrics()
+	cfg.Metrics = reg
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", reg)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}, nil
 }
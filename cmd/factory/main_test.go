@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadPipelineArgFromStdin(t *testing.T) {
+	dot := "digraph G { start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }\n"
+	got, err := readPipelineArg("-", strings.NewReader(dot))
+	if err != nil || got != dot {
+		t.Fatalf("readPipelineArg(-) = %q, %v", got, err)
+	}
+	if got, err := readPipelineArg("pipeline.dot", strings.NewReader(dot)); err != nil || got != "" {
+		t.Fatalf("readPipelineArg(path) = %q, %v", got, err)
+	}
+	if _, err := readPipelineArg("-", strings.NewReader("  \n")); err == nil || !strings.Contains(err.Error(), "empty pipeline") {
+		t.Fatalf("empty stdin err = %v", err)
+	}
+}
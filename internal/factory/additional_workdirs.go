@@ -0,0 +1,122 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// AdditionalWorkdir is a source directory copied into the workspace under
+// Mount, a workspace-relative subdirectory (--add-workdir path=mountpoint).
+type AdditionalWorkdir struct {
+	Path  string `json:"path"`
+	Mount string `json:"mount"`
+}
+
+// additionalWorkdirRecord is one manifest.json additional_workdirs entry.
+type additionalWorkdirRecord struct {
+	Path            string   `json:"path"`
+	Mount           string   `json:"mount"`
+	Files           int      `json:"files"`
+	SkippedSymlinks []string `json:"skipped_symlinks,omitempty"`
+}
+
+// ParseAddWorkdirFlag parses an --add-workdir value of the form
+// path=mountpoint.
+func ParseAddWorkdirFlag(raw string) (AdditionalWorkdir, error) {
+	p, mount, ok := strings.Cut(raw, "=")
+	p = strings.TrimSpace(p)
+	mount = strings.TrimSpace(mount)
+	if !ok || p == "" || mount == "" {
+		return AdditionalWorkdir{}, fmt.Errorf("invalid --add-workdir %q: expected path=mountpoint", raw)
+	}
+	return AdditionalWorkdir{Path: p, Mount: mount}, nil
+}
+
+// checkAdditionalWorkdirs normalizes mountpoints and rejects ones that
+// escape the workspace, collide with each other, or shadow a top-level
+// workdir entry.
+func checkAdditionalWorkdirs(workdir string, extras []AdditionalWorkdir) ([]AdditionalWorkdir, error) {
+	out := make([]AdditionalWorkdir, 0, len(extras))
+	for _, a := range extras {
+		raw := filepath.ToSlash(strings.TrimSpace(a.Mount))
+		if raw == "" || path.IsAbs(raw) || filepath.IsAbs(a.Mount) || strings.HasPrefix(raw, "~") {
+			return nil, fmt.Errorf("additional workdir %s: mountpoint %q must be a relative path", a.Path, a.Mount)
+		}
+		for _, seg := range strings.Split(raw, "/") {
+			if seg == ".." {
+				return nil, fmt.Errorf("additional workdir %s: mountpoint %q must not contain ..", a.Path, a.Mount)
+			}
+		}
+		mount := path.Clean(raw)
+		if mount == "." || mount == ".git" || mount == ".attractor" || strings.HasPrefix(mount, ".git/") || strings.HasPrefix(mount, ".attractor/") {
+			return nil, fmt.Errorf("additional workdir %s: mountpoint %q is reserved", a.Path, a.Mount)
+		}
+		for _, prev := range out {
+			if mount == prev.Mount || strings.HasPrefix(mount, prev.Mount+"/") || strings.HasPrefix(prev.Mount, mount+"/") {
+				return nil, fmt.Errorf("additional workdir mountpoints %q and %q collide", prev.Mount, mount)
+			}
+		}
+		if _, err := os.Lstat(filepath.Join(workdir, filepath.FromSlash(mount))); err == nil {
+			return nil, fmt.Errorf("additional workdir %s: mountpoint %q already exists in workdir", a.Path, mount)
+		}
+		info, err := os.Stat(a.Path)
+		if err != nil {
+			return nil, fmt.Errorf("additional workdir %s: %w", a.Path, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("additional workdir %s is not a directory", a.Path)
+		}
+		out = append(out, AdditionalWorkdir{Path: a.Path, Mount: mount})
+	}
+	return out, nil
+}
+
+// additionalWorkdirExcludes is what copying src must skip: .git, the runs
+// dir, and the main workdir or other additional workdirs nested inside it,
+// which are copied on their own.
+func additionalWorkdirExcludes(src, workdir, runsdir string, extras []AdditionalWorkdir) []string {
+	excludes := []string{".git"}
+	if rel, ok := relativeDescendant(src, runsdir); ok {
+		excludes = append(excludes, rel)
+	}
+	if rel, ok := relativeDescendant(src, workdir); ok {
+		excludes = append(excludes, rel)
+	}
+	for _, other := range extras {
+		if rel, ok := relativeDescendant(src, other.Path); ok {
+			excludes = append(excludes, rel)
+		}
+	}
+	return excludes
+}
+
+// copyAdditionalWorkdirs copies each additional workdir under its mountpoint
+// in the workspace, adding its files to copied and skipped with
+// workspace-relative paths.
+func copyAdditionalWorkdirs(cfg RunConfig, workspace string, copied map[string]copiedFile, skipped *[]string) ([]additionalWorkdirRecord, error) {
+	records := []additionalWorkdirRecord{}
+	for _, a := range cfg.AdditionalWorkdirs {
+		dst := filepath.Join(workspace, filepath.FromSlash(a.Mount))
+		if err := os.MkdirAll(dst, 0o755); err != nil {
+			return nil, err
+		}
+		excludes := additionalWorkdirExcludes(a.Path, cfg.Workdir, cfg.Runsdir, cfg.AdditionalWorkdirs)
+		sk, files, err := copyDirRecording(a.Path, dst, excludes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy additional workdir %s: %w", a.Path, err)
+		}
+		for rel, f := range files {
+			copied[a.Mount+"/"+rel] = f
+		}
+		rec := additionalWorkdirRecord{Path: a.Path, Mount: a.Mount, Files: len(files)}
+		for _, rel := range sk {
+			rec.SkippedSymlinks = append(rec.SkippedSymlinks, a.Mount+"/"+rel)
+		}
+		*skipped = append(*skipped, rec.SkippedSymlinks...)
+		records = append(records, rec)
+	}
+	return records, nil
+}
@@ -0,0 +1,107 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdditionalWorkdirsCopiedUnderMountpoints(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; b [shape=box]; exit [shape=Msquare]; start -> a; a -> b; b -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	root := filepath.Dir(workdir)
+	lib := filepath.Join(root, "lib")
+	writeFile(t, filepath.Join(workdir, "main.txt"), "main")
+	writeFile(t, filepath.Join(lib, "util.txt"), "util")
+	writeFile(t, filepath.Join(lib, ".git", "HEAD"), "ref")
+	cfg := RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "aw1",
+		AdditionalWorkdirs: []AdditionalWorkdir{{Path: lib, Mount: "vendor/lib/"}}}
+	if err := RunPipeline(cfg); err == nil || !strings.Contains(err.Error(), "test_stop") {
+		t.Fatalf("expected test stop error got %v", err)
+	}
+	workspace := filepath.Join(runsdir, "aw1", "workspace")
+	if b, err := os.ReadFile(filepath.Join(workspace, "vendor", "lib", "util.txt")); err != nil || string(b) != "util" {
+		t.Fatalf("mounted file = %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "vendor", "lib", ".git")); !os.IsNotExist(err) {
+		t.Fatalf("additional workdir .git was copied: %v", err)
+	}
+	var m struct {
+		AdditionalWorkdirs []additionalWorkdirRecord `json:"additional_workdirs"`
+	}
+	b, err := os.ReadFile(filepath.Join(runsdir, "aw1", "manifest.json"))
+	if err != nil || json.Unmarshal(b, &m) != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	if len(m.AdditionalWorkdirs) != 1 || m.AdditionalWorkdirs[0].Mount != "vendor/lib" || m.AdditionalWorkdirs[0].Files != 1 {
+		t.Fatalf("manifest additional_workdirs = %+v", m.AdditionalWorkdirs)
+	}
+
+	// Resume must reuse the workspace even when the source has changed.
+	writeFile(t, filepath.Join(lib, "util.txt"), "changed")
+	writeFile(t, filepath.Join(lib, "new.txt"), "new")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	cfg.Resume = true
+	if err := RunPipeline(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(workspace, "vendor", "lib", "util.txt")); string(b) != "util" {
+		t.Fatalf("resume re-copied the additional workdir: %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "vendor", "lib", "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("resume copied a new source file: %v", err)
+	}
+}
+
+func TestAdditionalWorkdirNestedInWorkdirIsCopiedOnce(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }`
+	workdir, _, pipeline := setupRun(t, dot)
+	runsdir := filepath.Join(workdir, "shared", ".runs")
+	writeFile(t, filepath.Join(workdir, "shared", "spec.md"), "spec")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "aw2",
+		AdditionalWorkdirs: []AdditionalWorkdir{{Path: filepath.Join(workdir, "shared"), Mount: "spec"}}}); err != nil {
+		t.Fatal(err)
+	}
+	workspace := filepath.Join(runsdir, "aw2", "workspace")
+	if _, err := os.Stat(filepath.Join(workspace, "spec", "spec.md")); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"shared", filepath.Join("spec", ".runs")} {
+		if _, err := os.Stat(filepath.Join(workspace, p)); !os.IsNotExist(err) {
+			t.Fatalf("%s should have been excluded from the copy: %v", p, err)
+		}
+	}
+}
+
+func TestAdditionalWorkdirMountpointValidation(t *testing.T) {
+	root := t.TempDir()
+	workdir := filepath.Join(root, "work")
+	lib := filepath.Join(root, "lib")
+	writeFile(t, filepath.Join(workdir, "docs", "a.md"), "a")
+	writeFile(t, filepath.Join(lib, "x"), "x")
+	for mount, want := range map[string]string{
+		"/abs":        "must be a relative path",
+		"a/../b":      "must not contain ..",
+		"..":          "must not contain ..",
+		".git":        "is reserved",
+		"docs":        "already exists in workdir",
+		"vendor/lib2": "collide",
+	} {
+		extras := []AdditionalWorkdir{{Path: lib, Mount: "vendor"}, {Path: lib, Mount: mount}}
+		if _, err := checkAdditionalWorkdirs(workdir, extras); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("mount %q: got %v, want %q", mount, err, want)
+		}
+	}
+	if _, err := ParseAddWorkdirFlag("lib"); err == nil {
+		t.Fatal("expected path=mountpoint error")
+	}
+	a, err := ParseAddWorkdirFlag(" ../lib = vendor/lib ")
+	if err != nil || a.Path != "../lib" || a.Mount != "vendor/lib" {
+		t.Fatalf("parsed %+v, %v", a, err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type AgentRequest struct {
@@ -15,6 +16,8 @@ type AgentRequest struct {
 	NodeDir   string
 	Workspace string
 	Logger    *slog.Logger
+	Round     int
+	Context   Context
 }
 
 type AgentResponse struct {
@@ -25,6 +28,7 @@ type AgentResponse struct {
 	VerificationPlan   *VerificationPlan `json:"verification_plan,omitempty"`
 	Notes              string            `json:"notes"`
 	FailureReason      string            `json:"failure_reason"`
+	Delegate           *DelegateRequest  `json:"delegate,omitempty"`
 }
 
 type Agent interface {
@@ -37,30 +41,54 @@ type CodexOptions struct {
 	ApprovalPolicy       string
 	Workdir              string
 	AddDirs              []string
+	// ScopeInferred is set when Workdir or AddDirs came from
+	// allowed_write_paths (codex.infer_scope).
+	ScopeInferred        bool
 	BlockReadPaths       []string
 	StrictReadScope      bool
 	Model                string
 	Profile              string
 	TimeoutSeconds       int
 	HeartbeatSeconds     int
+	// StallTimeout kills codex when it has produced no output and used no
+	// CPU time for this long. Zero disables stall detection.
+	StallTimeout         time.Duration
 	ConfigOverrides      []string
 	AutoApproveCommands  []string
 	AutoApproveConfigKey string
 	SkipGitRepoCheck     bool
 	DangerousBypass      bool
 	DisableMCP           bool
+	AllowDelegate        bool
+	// ContextUpdateKeys constrains context_updates in the output schema.
+	ContextUpdateKeys []contextUpdateKey
+	// CaptureEvents runs codex exec with --json and normalizes the event
+	// stream into codex.events.jsonl.
+	CaptureEvents bool
 }
 
 func ResolveAgent(node *Node, workspace string) (Agent, error) {
+	return ResolveAgentForAttempt(node, workspace, 0)
+}
+
+// ResolveAgentForAttempt resolves the node's backend for a zero-based retry
+// attempt, which selects the model from codex.model_sequence.
+func ResolveAgentForAttempt(node *Node, workspace string, attempt int) (Agent, error) {
 	name := strings.TrimSpace(node.StringAttr("agent.backend", ""))
+	legacy := strings.TrimSpace(os.Getenv("ATTRACTION_BACKEND"))
+	if legacy == "" {
+		legacy = strings.TrimSpace(os.Getenv("ATTRACTOR_BACKEND"))
+	}
+	// ATTRACTION_BACKEND=fake fakes every node, so a pipeline that names
+	// codex never reaches it in fake mode. ATTRACTOR_HONOR_NODE_BACKEND=1
+	// lets agent.backend pick per node instead.
+	if legacy == "fake" && (name == "" || !parseBoolEnv("ATTRACTOR_HONOR_NODE_BACKEND")) {
+		name = legacy
+	}
 	if name == "" {
 		name = strings.TrimSpace(os.Getenv("ATTRACTOR_AGENT_BACKEND"))
 	}
 	if name == "" {
-		legacy := strings.TrimSpace(os.Getenv("ATTRACTION_BACKEND"))
-		if legacy == "" {
-			legacy = strings.TrimSpace(os.Getenv("ATTRACTOR_BACKEND"))
-		}
 		if legacy == "codex" || legacy == "stub" {
 			name = legacy
 		}
@@ -71,8 +99,10 @@ func ResolveAgent(node *Node, workspace string) (Agent, error) {
 	switch name {
 	case "stub":
 		return stubAgent{}, nil
+	case "fake":
+		return fakeAgent{node: node}, nil
 	case "codex":
-		opts, err := codexOptionsFromNodeAndEnv(node, workspace)
+		opts, err := codexOptionsFromNodeAndEnv(node, workspace, attempt)
 		if err != nil {
 			return nil, err
 		}
@@ -93,7 +123,7 @@ func (stubAgent) Run(_ AgentRequest) (AgentResponse, error) {
 	}, nil
 }
 
-func codexOptionsFromNodeAndEnv(node *Node, workspace string) (CodexOptions, error) {
+func codexOptionsFromNodeAndEnv(node *Node, workspace string, attempt int) (CodexOptions, error) {
 	opts := CodexOptions{
 		Executable:    pickString(node.StringAttr("codex.path", ""), os.Getenv("ATTRACTOR_CODEX_PATH"), "codex"),
 		SandboxMode:    pickString(node.StringAttr("codex.sandbox", ""), os.Getenv("ATTRACTOR_CODEX_SANDBOX"), "workspace-write"),
@@ -108,11 +138,31 @@ func codexOptionsFromNodeAndEnv(node *Node, workspace string) (CodexOptions, err
 			15,
 		),
 	}
-	opts.DangerousBypass = node.BoolAttr("codex.dangerous_bypass", false) || parseBoolEnv("ATTRACTOR_CODEX_DANGEROUS_BYPASS")
-	opts.SkipGitRepoCheck = node.BoolAttr("codex.skip_git_repo_check", false) || parseBoolEnv("ATTRACTOR_CODEX_SKIP_GIT_REPO_CHECK")
-	opts.StrictReadScope = node.BoolAttr("codex.strict_read_scope", false) || parseBoolEnv("ATTRACTOR_CODEX_STRICT_READ_SCOPE")
-	opts.DisableMCP = node.BoolAttr("codex.disable_mcp", false) || parseBoolEnv("ATTRACTOR_CODEX_DISABLE_MCP")
+	stall, err := codexStallTimeout(node)
+	if err != nil {
+		return CodexOptions{}, err
+	}
+	opts.StallTimeout = stall
+	sequence, err := parseModelSequence(pickString(node.StringAttr("codex.model_sequence", ""), os.Getenv("ATTRACTOR_CODEX_MODEL_SEQUENCE"), ""))
+	if err != nil {
+		return CodexOptions{}, err
+	}
+	if len(sequence) > 0 {
+		opts.Model = modelForAttempt(sequence, attempt)
+	}
+	opts.DangerousBypass = boolAttrOrEnv(node, "codex.dangerous_bypass", "ATTRACTOR_CODEX_DANGEROUS_BYPASS")
+	opts.SkipGitRepoCheck = boolAttrOrEnv(node, "codex.skip_git_repo_check", "ATTRACTOR_CODEX_SKIP_GIT_REPO_CHECK")
+	opts.StrictReadScope = boolAttrOrEnv(node, "codex.strict_read_scope", "ATTRACTOR_CODEX_STRICT_READ_SCOPE")
+	opts.DisableMCP = boolAttrOrEnv(node, "codex.disable_mcp", "ATTRACTOR_CODEX_DISABLE_MCP")
+	opts.CaptureEvents = boolAttrOrEnv(node, "codex.capture_events", "ATTRACTOR_CODEX_CAPTURE_EVENTS")
+	opts.AllowDelegate = delegateMaxRounds(node) > 0
+	keys, err := nodeContextUpdateKeys(node)
+	if err != nil {
+		return CodexOptions{}, err
+	}
+	opts.ContextUpdateKeys = keys
 	opts.AddDirs = pickList(node.StringAttr("codex.add_dirs", ""), os.Getenv("ATTRACTOR_CODEX_ADD_DIRS"))
+	applyInferredCodexScope(node, &opts)
 	opts.ConfigOverrides = pickConfigOverrides(node.StringAttr("codex.config_overrides", ""), os.Getenv("ATTRACTOR_CODEX_CONFIG_OVERRIDES"))
 	opts.AutoApproveCommands = pickList(node.StringAttr("codex.auto_approve_commands", ""), os.Getenv("ATTRACTOR_CODEX_AUTO_APPROVE_COMMANDS"))
 	opts.AutoApproveConfigKey = pickString(node.StringAttr("codex.auto_approve_config_key", ""), os.Getenv("ATTRACTOR_CODEX_AUTO_APPROVE_CONFIG_KEY"), "")
@@ -151,6 +201,15 @@ func codexOptionsFromNodeAndEnv(node *Node, workspace string) (CodexOptions, err
 	return opts, nil
 }
 
+// boolAttrOrEnv lets an explicit node attribute (including an inherited graph
+// default) override the env var in either direction.
+func boolAttrOrEnv(node *Node, key, env string) bool {
+	if _, ok := node.Attrs[key]; ok {
+		return node.BoolAttr(key, false)
+	}
+	return parseBoolEnv(env)
+}
+
 func resolveExecutable(workspace, executable string) (string, error) {
 	executable = strings.TrimSpace(executable)
 	if executable == "" {
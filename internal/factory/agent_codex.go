@@ -14,9 +14,14 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// codexWaitDelay bounds how long Wait waits for the output pipes to close
+// after codex exits; tests shorten it.
+var codexWaitDelay = 5 * time.Second
+
 type codexAgent struct {
 	opts CodexOptions
 }
@@ -32,9 +37,18 @@ func (a codexAgent) Run(req AgentRequest) (AgentResponse, error) {
 	stderrPath := filepath.Join(req.NodeDir, "codex.stderr.log")
 	argsPath := filepath.Join(req.NodeDir, "codex.args.txt")
 
-	if err := os.WriteFile(schemaPath, []byte(codexOutcomeSchema+"\n"), 0o644); err != nil {
+	if err := os.WriteFile(schemaPath, []byte(codexOutputSchema(a.opts.AllowDelegate, a.opts.ContextUpdateKeys)+"\n"), 0o644); err != nil {
 		return AgentResponse{}, err
 	}
+	if a.opts.ScopeInferred {
+		// Inferred directories may not exist yet; codex refuses a missing -C.
+		for _, d := range append([]string{a.opts.Workdir}, a.opts.AddDirs...) {
+			if err := os.MkdirAll(d, 0o755); err != nil {
+				return AgentResponse{}, err
+			}
+		}
+	}
+	logger.Info("codex scope", "node", req.NodeID, "workdir", a.opts.Workdir, "add_dirs", a.opts.AddDirs, "inferred", a.opts.ScopeInferred, "sandbox", a.opts.SandboxMode)
 	args, err := buildCodexExecArgs(a.opts, schemaPath, outputPath)
 	if err != nil {
 		return AgentResponse{}, err
@@ -74,6 +88,8 @@ func (a codexAgent) Run(req AgentRequest) (AgentResponse, error) {
 		ctx, cancel = context.WithTimeout(ctx, time.Duration(a.opts.TimeoutSeconds)*time.Second)
 	}
 	defer cancel()
+	ctx, stallCancel := context.WithCancel(ctx)
+	defer stallCancel()
 
 	if err := validateConfiguredExecutable(a.opts.Executable); err != nil {
 		return AgentResponse{}, err
@@ -81,14 +97,18 @@ func (a codexAgent) Run(req AgentRequest) (AgentResponse, error) {
 
 	cmd := exec.CommandContext(ctx, a.opts.Executable, args...)
 	cmd.Stdin = strings.NewReader(req.Prompt + "\n\nReturn only JSON matching the provided schema.")
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return AgentResponse{}, err
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return AgentResponse{}, err
-	}
+	// io.Pipe rather than StdoutPipe: Wait must not close the read side while
+	// the stream readers are still draining it. WaitDelay bounds Wait when
+	// codex exits and leaves children holding the output open.
+	stdout, stdoutW := io.Pipe()
+	stderr, stderrW := io.Pipe()
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+	cmd.WaitDelay = codexWaitDelay
+	// A timeout signals the whole process group; descendants that survive
+	// it are reaped once Wait returns.
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return terminateProcessGroup(cmd) }
 	if err := cmd.Start(); err != nil {
 		return AgentResponse{}, err
 	}
@@ -102,6 +122,15 @@ func (a codexAgent) Run(req AgentRequest) (AgentResponse, error) {
 		return AgentResponse{}, err
 	}
 	defer stderrFile.Close()
+	var stdoutSink io.Writer = stdoutFile
+	var events *codexEventWriter
+	if a.opts.CaptureEvents {
+		if events, err = newCodexEventWriter(req.NodeDir, req.Round); err != nil {
+			logger.Warn("codex event capture disabled", "node", req.NodeID, "error", err)
+		} else {
+			stdoutSink = io.MultiWriter(stdoutFile, events)
+		}
+	}
 	logger.Info("codex exec started",
 		"node", req.NodeID,
 		"executable", a.opts.Executable,
@@ -110,6 +139,7 @@ func (a codexAgent) Run(req AgentRequest) (AgentResponse, error) {
 		"sandbox", a.opts.SandboxMode,
 		"approval", a.opts.ApprovalPolicy,
 		"timeout_seconds", a.opts.TimeoutSeconds,
+		"stall_timeout", a.opts.StallTimeout.String(),
 		"args_path", argsPath,
 		"stdout_log", stdoutPath,
 		"stderr_log", stderrPath,
@@ -120,6 +150,7 @@ func (a codexAgent) Run(req AgentRequest) (AgentResponse, error) {
 	if heartbeatSeconds <= 0 {
 		heartbeatSeconds = 15
 	}
+	activity := newOutputActivity()
 	go func() {
 		t := time.NewTicker(time.Duration(heartbeatSeconds) * time.Second)
 		defer t.Stop()
@@ -128,10 +159,35 @@ func (a codexAgent) Run(req AgentRequest) (AgentResponse, error) {
 			case <-heartbeatDone:
 				return
 			case <-t.C:
-				logger.Info("codex exec still running", "node", req.NodeID, "heartbeat_seconds", heartbeatSeconds)
+				idle := activity.idle(time.Now()).Round(time.Second)
+				logger.Info("codex exec still running", "node", req.NodeID, "heartbeat_seconds", heartbeatSeconds, "idle_seconds", int(idle.Seconds()))
 			}
 		}
 	}()
+	var stalled atomic.Bool
+	var stalledFor time.Duration
+	if a.opts.StallTimeout > 0 {
+		pgid := cmd.Process.Pid
+		watch := newStallWatch(a.opts.StallTimeout, activity, func() (time.Duration, bool) { return processGroupCPUTime(pgid) })
+		go func() {
+			t := time.NewTicker(stallCheckInterval(a.opts.StallTimeout))
+			defer t.Stop()
+			for {
+				select {
+				case <-heartbeatDone:
+					return
+				case now := <-t.C:
+					if ok, quiet := watch.stalled(now); ok {
+						stalledFor = quiet
+						stalled.Store(true)
+						logger.Error("codex exec stalled", "node", req.NodeID, "stall_timeout", a.opts.StallTimeout.String(), "quiet_for", quiet.Round(time.Millisecond).String())
+						stallCancel()
+						return
+					}
+				}
+			}
+		}()
+	}
 
 	logStream := parseBool("FACTORY_LOG_CODEX_STREAM", false)
 	var outErr error
@@ -140,15 +196,32 @@ func (a codexAgent) Run(req AgentRequest) (AgentResponse, error) {
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		outErr = readAndMaybeLogStream(stdout, stdoutFile, "stdout", req.NodeID, logger, logStream)
+		outErr = readAndMaybeLogStream(stdout, stdoutSink, "stdout", req.NodeID, logger, logStream, activity)
 	}()
 	go func() {
 		defer wg.Done()
-		errErr = readAndMaybeLogStream(stderr, stderrFile, "stderr", req.NodeID, logger, logStream)
+		errErr = readAndMaybeLogStream(stderr, stderrFile, "stderr", req.NodeID, logger, logStream, activity)
 	}()
 	runErr := cmd.Wait()
+	// ErrWaitDelay means codex exited cleanly but a descendant still held
+	// the output; that descendant is reaped below.
+	if errors.Is(runErr, exec.ErrWaitDelay) {
+		runErr = nil
+	}
+	reaped := reapProcessGroup(cmd.Process.Pid, processGroupGrace)
+	if reaped > 0 {
+		logger.Warn("reaped orphaned codex processes", "node", req.NodeID, "count", reaped)
+	}
+	_ = recordReapedProcesses(req.NodeDir, reaped)
+	stdoutW.Close()
+	stderrW.Close()
 	wg.Wait()
 	close(heartbeatDone)
+	if events != nil {
+		if err := events.Close(); err != nil {
+			logger.Warn("codex event capture incomplete", "node", req.NodeID, "error", err)
+		}
+	}
 	if outErr != nil {
 		return AgentResponse{}, fmt.Errorf("failed reading codex stdout: %w", outErr)
 	}
@@ -156,6 +229,9 @@ func (a codexAgent) Run(req AgentRequest) (AgentResponse, error) {
 		return AgentResponse{}, fmt.Errorf("failed reading codex stderr: %w", errErr)
 	}
 	if runErr != nil {
+		if stalled.Load() {
+			return AgentResponse{}, fmt.Errorf("%w: no codex output or CPU progress for %s", ErrAgentStalled, stalledFor.Round(time.Millisecond))
+		}
 		if ctx.Err() != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			logger.Error("codex exec timed out", "node", req.NodeID, "timeout_seconds", a.opts.TimeoutSeconds)
 			return AgentResponse{}, fmt.Errorf("codex exec timeout after %ds", a.opts.TimeoutSeconds)
@@ -169,12 +245,25 @@ func (a codexAgent) Run(req AgentRequest) (AgentResponse, error) {
 	if err != nil {
 		return AgentResponse{}, fmt.Errorf("codex output missing: %w", err)
 	}
+	return parseAgentResponse(raw, "codex")
+}
+
+// parseAgentResponse is how every backend turns response JSON into an
+// AgentResponse. The document must satisfy codexOutcomeSchema.
+func parseAgentResponse(raw []byte, source string) (AgentResponse, error) {
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return AgentResponse{}, fmt.Errorf("%s output is not valid JSON: %w", source, err)
+	}
+	if err := validateAgentOutput(raw); err != nil {
+		return AgentResponse{}, fmt.Errorf("%s output violates schema: %w", source, err)
+	}
 	parsed := AgentResponse{}
 	if err := json.Unmarshal(raw, &parsed); err != nil {
-		return AgentResponse{}, fmt.Errorf("codex output is not valid JSON: %w", err)
+		return AgentResponse{}, fmt.Errorf("%s output is not valid JSON: %w", source, err)
 	}
-	if parsed.Outcome == "" {
-		return AgentResponse{}, fmt.Errorf("codex output missing outcome")
+	if parsed.Outcome == "" && parsed.Delegate == nil {
+		return AgentResponse{}, fmt.Errorf("%s output missing outcome", source)
 	}
 	if parsed.ContextUpdates == nil {
 		parsed.ContextUpdates = map[string]any{}
@@ -244,7 +333,7 @@ func hideWorkspacePaths(workspace, nodeDir string, blocked []string) ([]hiddenPa
 			}
 			return nil, err
 		}
-		dst := filepath.Join(base, filepath.FromSlash(rel))
+		dst := relocationTarget(base, rel)
 		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
 			return nil, err
 		}
@@ -362,12 +451,15 @@ func strictReadScopeBlockedPaths(workspace, workdir string, addDirs []string, ex
 	return blocked, nil
 }
 
-func readAndMaybeLogStream(r io.Reader, sink io.Writer, stream string, nodeID string, logger *slog.Logger, logStream bool) error {
+// readAndMaybeLogStream copies r to sink, logging lines with logStream, and
+// touches activity whenever bytes arrive.
+func readAndMaybeLogStream(r io.Reader, sink io.Writer, stream string, nodeID string, logger *slog.Logger, logStream bool, activity *outputActivity) error {
 	buf := make([]byte, 4096)
 	var pending string
 	for {
 		n, err := r.Read(buf)
 		if n > 0 {
+			activity.touch()
 			chunk := string(buf[:n])
 			if _, werr := sink.Write(buf[:n]); werr != nil {
 				return werr
@@ -466,6 +558,9 @@ func buildCodexExecArgs(opts CodexOptions, schemaPath, outputPath string) ([]str
 	if opts.DangerousBypass {
 		args = append(args, "--dangerously-bypass-approvals-and-sandbox")
 	}
+	if opts.CaptureEvents {
+		args = append(args, "--json")
+	}
 	args = append(args, "--color", "never", "--output-schema", schemaPath, "-o", outputPath, "-")
 	return args, nil
 }
@@ -516,8 +611,8 @@ const codexOutcomeSchema = `{
     },
     "context_updates": {
       "type": "object",
-      "properties": {},
-      "additionalProperties": false
+      "description": "Values to merge into the pipeline context. Keep them small and shallow.",
+      "additionalProperties": true
     },
     "verification_plan": {
       "anyOf": [
@@ -525,7 +620,7 @@ const codexOutcomeSchema = `{
         {
           "type": "object",
           "additionalProperties": false,
-          "required": ["files", "commands"],
+          "required": ["files", "commands", "coverage"],
           "properties": {
             "files": {
               "type": "array",
@@ -533,7 +628,37 @@ const codexOutcomeSchema = `{
             },
             "commands": {
               "type": "array",
-              "items": { "type": "string" }
+              "items": {
+                "anyOf": [
+                  { "type": "string" },
+                  {
+                    "type": "object",
+                    "additionalProperties": false,
+                    "required": ["run", "expect_stdout_contains", "expect_stdout_not_contains", "min_duration_ms"],
+                    "properties": {
+                      "run": { "type": "string" },
+                      "expect_stdout_contains": { "type": ["string", "null"] },
+                      "expect_stdout_not_contains": { "type": ["string", "null"] },
+                      "min_duration_ms": { "type": ["integer", "null"] }
+                    }
+                  }
+                ]
+              }
+            },
+            "coverage": {
+              "anyOf": [
+                { "type": "null" },
+                {
+                  "type": "object",
+                  "additionalProperties": false,
+                  "required": ["command", "profile", "min_percent"],
+                  "properties": {
+                    "command": { "type": "string" },
+                    "profile": { "type": "string" },
+                    "min_percent": { "type": "number" }
+                  }
+                }
+              ]
             }
           }
         }
@@ -0,0 +1,84 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fakeAgent scripts codergen responses from test.* node attributes. It is
+// selected with agent.backend="fake" or process-wide with ATTRACTION_BACKEND=fake.
+type fakeAgent struct {
+	node *Node
+}
+
+func (a fakeAgent) Run(req AgentRequest) (AgentResponse, error) {
+	node := a.node
+	if msg := node.StringAttr("test.panic", ""); msg != "" {
+		panic(msg)
+	}
+	if raw := strings.TrimSpace(node.StringAttr("test.delegate_requests_json", "")); raw != "" {
+		var reqs []DelegateRequest
+		if err := json.Unmarshal([]byte(raw), &reqs); err != nil {
+			return AgentResponse{}, fmt.Errorf("invalid test.delegate_requests_json: %w", err)
+		}
+		if req.Round < len(reqs) {
+			d := reqs[req.Round]
+			if err := os.WriteFile(filepath.Join(req.NodeDir, "response.md"), []byte(fmt.Sprintf("delegate=%s\n", d.Task)), 0o644); err != nil {
+				return AgentResponse{}, err
+			}
+			return AgentResponse{ContextUpdates: map[string]any{}, Delegate: &d}, nil
+		}
+	}
+	outcome := outcomeFromTestAttrs(node, req.Context)
+	resp := fmt.Sprintf("outcome=%s\n", outcome)
+	if err := os.WriteFile(filepath.Join(req.NodeDir, "response.md"), []byte(resp), 0o644); err != nil {
+		return AgentResponse{}, err
+	}
+	updates := map[string]any{}
+	if raw := strings.TrimSpace(node.StringAttr("test.context_updates_json", "")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &updates); err != nil {
+			return AgentResponse{}, fmt.Errorf("invalid test.context_updates_json: %w", err)
+		}
+	}
+	out := AgentResponse{
+		Outcome:            outcome,
+		PreferredNextLabel: node.StringAttr("test.preferred_next_label", ""),
+		SuggestedNextIDs:   splitCSV(node.StringAttr("test.suggested_next_ids", "")),
+		Notes:              node.StringAttr("test.notes", "fake backend"),
+		ContextUpdates:     updates,
+	}
+	if raw := strings.TrimSpace(node.StringAttr("test.verification_plan_json", "")); raw != "" {
+		var parsed any
+		if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+			return AgentResponse{}, fmt.Errorf("invalid test.verification_plan_json: %w", err)
+		}
+		plan, err := ParseVerificationPlan(parsed)
+		if err != nil {
+			return AgentResponse{}, err
+		}
+		out.VerificationPlan = &plan
+	}
+	return out, nil
+}
+
+// fakeDelegateAgent answers delegate requests from test.delegate_answer and can
+// simulate a misbehaving delegate with test.delegate_write_path.
+type fakeDelegateAgent struct {
+	node *Node
+}
+
+func (a fakeDelegateAgent) Run(req AgentRequest) (AgentResponse, error) {
+	answer := a.node.StringAttr("test.delegate_answer", "fake delegate answer")
+	if err := os.WriteFile(filepath.Join(req.NodeDir, "response.md"), []byte(answer+"\n"), 0o644); err != nil {
+		return AgentResponse{}, err
+	}
+	if p := strings.TrimSpace(a.node.StringAttr("test.delegate_write_path", "")); p != "" {
+		if err := os.WriteFile(filepath.Join(req.Workspace, filepath.FromSlash(p)), []byte("delegate write\n"), 0o644); err != nil {
+			return AgentResponse{}, err
+		}
+	}
+	return AgentResponse{Outcome: "success", Notes: answer, ContextUpdates: map[string]any{}}, nil
+}
@@ -0,0 +1,207 @@
+package attractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// agentOutputFields are the fields codexOutcomeSchema requires. delegate is
+// also accepted; checkContextUpdates checks typed context_updates later.
+var agentOutputFields = []string{"outcome", "preferred_next_label", "suggested_next_ids", "context_updates", "verification_plan", "notes", "failure_reason"}
+
+var agentOutcomes = []string{"success", "fail", "retry", "partial_success"}
+
+// validateAgentOutput checks a response document against codexOutcomeSchema
+// by hand, so every backend meets the contract the codex CLI is given. It
+// returns the first violation found.
+func validateAgentOutput(raw []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return fmt.Errorf("document must be an object")
+	}
+	for _, k := range agentOutputFields {
+		if _, ok := obj[k]; !ok {
+			return fmt.Errorf("%s is required", k)
+		}
+	}
+	for _, k := range sortedKeys(obj) {
+		if k != "delegate" && !containsString(agentOutputFields, k) {
+			return fmt.Errorf("unexpected field %s", k)
+		}
+	}
+	outcome, ok := obj["outcome"].(string)
+	if !ok || !containsString(agentOutcomes, outcome) {
+		return fmt.Errorf("outcome must be one of %s, got %s", strings.Join(agentOutcomes, ", "), schemaValue(obj["outcome"]))
+	}
+	for _, k := range []string{"preferred_next_label", "notes", "failure_reason"} {
+		if _, ok := obj[k].(string); !ok {
+			return fmt.Errorf("%s must be a string", k)
+		}
+	}
+	if err := requireStringArray(obj["suggested_next_ids"], "suggested_next_ids"); err != nil {
+		return err
+	}
+	if _, ok := obj["context_updates"].(map[string]any); !ok {
+		return fmt.Errorf("context_updates must be an object")
+	}
+	if err := validatePlanSchema(obj["verification_plan"]); err != nil {
+		return err
+	}
+	return validateDelegateSchema(obj["delegate"])
+}
+
+func validatePlanSchema(v any) error {
+	if v == nil {
+		return nil
+	}
+	plan, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("verification_plan must be null or an object")
+	}
+	// coverage is nullable in the codex schema and may be omitted here, so
+	// plans written before it existed still validate.
+	fields := []string{"files", "commands"}
+	if _, ok := plan["coverage"]; ok {
+		fields = append(fields, "coverage")
+	}
+	if err := requireExactFields(plan, "verification_plan", fields...); err != nil {
+		return err
+	}
+	if err := requireStringArray(plan["files"], "verification_plan.files"); err != nil {
+		return err
+	}
+	cmds, ok := plan["commands"].([]any)
+	if !ok {
+		return fmt.Errorf("verification_plan.commands must be an array")
+	}
+	for i, c := range cmds {
+		path := fmt.Sprintf("verification_plan.commands[%d]", i)
+		if _, ok := c.(string); ok {
+			continue
+		}
+		cmd, ok := c.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s must be a string or an object", path)
+		}
+		if err := requireExactFields(cmd, path, "run", "expect_stdout_contains", "expect_stdout_not_contains", "min_duration_ms"); err != nil {
+			return err
+		}
+		if _, ok := cmd["run"].(string); !ok {
+			return fmt.Errorf("%s.run must be a string", path)
+		}
+		for _, k := range []string{"expect_stdout_contains", "expect_stdout_not_contains"} {
+			if _, ok := cmd[k].(string); !ok && cmd[k] != nil {
+				return fmt.Errorf("%s.%s must be a string or null", path, k)
+			}
+		}
+		if v := cmd["min_duration_ms"]; v != nil && !isSchemaInteger(v) {
+			return fmt.Errorf("%s.min_duration_ms must be an integer or null", path)
+		}
+	}
+	return validateCoverageSchema(plan["coverage"])
+}
+
+func validateCoverageSchema(v any) error {
+	if v == nil {
+		return nil
+	}
+	c, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("verification_plan.coverage must be null or an object")
+	}
+	if err := requireExactFields(c, "verification_plan.coverage", "command", "profile", "min_percent"); err != nil {
+		return err
+	}
+	for _, k := range []string{"command", "profile"} {
+		if _, ok := c[k].(string); !ok {
+			return fmt.Errorf("verification_plan.coverage.%s must be a string", k)
+		}
+	}
+	if _, ok := c["min_percent"].(json.Number); !ok {
+		return fmt.Errorf("verification_plan.coverage.min_percent must be a number")
+	}
+	return nil
+}
+
+func validateDelegateSchema(v any) error {
+	if v == nil {
+		return nil
+	}
+	d, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("delegate must be null or an object")
+	}
+	if err := requireExactFields(d, "delegate", "task", "max_tokens", "read_paths"); err != nil {
+		return err
+	}
+	if _, ok := d["task"].(string); !ok {
+		return fmt.Errorf("delegate.task must be a string")
+	}
+	if !isSchemaInteger(d["max_tokens"]) {
+		return fmt.Errorf("delegate.max_tokens must be an integer")
+	}
+	return requireStringArray(d["read_paths"], "delegate.read_paths")
+}
+
+// requireExactFields checks obj has every field in fields and nothing else,
+// matching additionalProperties=false with all properties required.
+func requireExactFields(obj map[string]any, path string, fields ...string) error {
+	for _, k := range fields {
+		if _, ok := obj[k]; !ok {
+			return fmt.Errorf("%s.%s is required", path, k)
+		}
+	}
+	for _, k := range sortedKeys(obj) {
+		if !containsString(fields, k) {
+			return fmt.Errorf("unexpected field %s.%s", path, k)
+		}
+	}
+	return nil
+}
+
+func requireStringArray(v any, path string) error {
+	items, ok := v.([]any)
+	if !ok {
+		return fmt.Errorf("%s must be an array of strings", path)
+	}
+	for i, item := range items {
+		if _, ok := item.(string); !ok {
+			return fmt.Errorf("%s[%d] must be a string", path, i)
+		}
+	}
+	return nil
+}
+
+func isSchemaInteger(v any) bool {
+	n, ok := v.(json.Number)
+	if !ok {
+		return false
+	}
+	_, err := n.Int64()
+	return err == nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
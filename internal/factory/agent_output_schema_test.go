@@ -0,0 +1,59 @@
+package attractor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validAgentOutput = `{"outcome":"success","preferred_next_label":"","suggested_next_ids":[],"context_updates":{},"verification_plan":null,"notes":"","failure_reason":""}`
+
+func TestValidateAgentOutput(t *testing.T) {
+	with := func(old, new string) string { return strings.Replace(validAgentOutput, old, new, 1) }
+	cases := map[string]string{
+		with(`"suggested_next_ids":[],`, ``):                                                                             "suggested_next_ids is required",
+		with(`"success"`, `"done"`):                                                                                      `outcome must be one of success, fail, retry, partial_success, got "done"`,
+		with(`"suggested_next_ids":[]`, `"suggested_next_ids":[1]`):                                                      "suggested_next_ids[0] must be a string",
+		with(`"notes":""`, `"notes":null`):                                                                               "notes must be a string",
+		with(`"context_updates":{}`, `"context_updates":[]`):                                                             "context_updates must be an object",
+		with(`"failure_reason":""`, `"failure_reason":"","extra":1`):                                                     "unexpected field extra",
+		with(`null`, `{"files":[],"commands":[{"run":"go test"}]}`):                                                      "verification_plan.commands[0].expect_stdout_contains is required",
+		with(`null`, `{"files":[],"commands":[],"shell":"sh"}`):                                                          "unexpected field verification_plan.shell",
+		with(`null`, `{"files":[],"commands":[],"coverage":{"command":"go test","profile":"c.out","min_percent":"70"}}`): "verification_plan.coverage.min_percent must be a number",
+		with(`"failure_reason":""`, `"failure_reason":"","delegate":{"task":"t","max_tokens":1.5,"read_paths":[]}`):      "delegate.max_tokens must be an integer",
+		`[]`: "document must be an object",
+	}
+	for doc, want := range cases {
+		err := validateAgentOutput([]byte(doc))
+		if err == nil || err.Error() != want {
+			t.Fatalf("validate(%s) = %v, want %q", doc, err, want)
+		}
+	}
+	valid := []string{
+		validAgentOutput,
+		with(`null`, `{"files":["a.go"],"commands":["go test",{"run":"go vet","expect_stdout_contains":null,"expect_stdout_not_contains":"FAIL","min_duration_ms":100}]}`),
+		with(`"failure_reason":""`, `"failure_reason":"","delegate":null`),
+		with(`null`, `{"files":[],"commands":["go test"],"coverage":null}`),
+		with(`null`, `{"files":[],"commands":["go vet"],"coverage":{"command":"go test -coverprofile=c.out ./...","profile":"c.out","min_percent":70.5}}`),
+	}
+	for _, doc := range valid {
+		if err := validateAgentOutput([]byte(doc)); err != nil {
+			t.Fatalf("validate(%s) = %v", doc, err)
+		}
+	}
+}
+
+func TestAgentOutputSchemaViolationFailsStage(t *testing.T) {
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a; a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	fixture := filepath.Join(t.TempDir(), "resp.json")
+	writeFile(t, fixture, `{"outcome":"fail","failure_reason":"replayed failure"}`)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "as1", ReplayResponses: map[string]string{"a": fixture}})
+	if err == nil || !strings.Contains(err.Error(), "replay output violates schema: preferred_next_label is required") {
+		t.Fatalf("expected schema violation, got %v", err)
+	}
+	evs := eventsOfType(t, filepath.Join(runsdir, "as1"), "StageFailed")
+	if len(evs) != 1 || evs[0]["failure_code"] != string(FailureAgentInvalidOutput) {
+		t.Fatalf("StageFailed events = %v", evs)
+	}
+}
@@ -0,0 +1,83 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// replayAgent feeds a previously recorded agent response through the normal
+// response pipeline instead of invoking a live backend.
+type replayAgent struct {
+	path string
+}
+
+func (a replayAgent) Run(req AgentRequest) (AgentResponse, error) {
+	raw, err := os.ReadFile(a.path)
+	if err != nil {
+		return AgentResponse{}, fmt.Errorf("replay response unreadable: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(req.NodeDir, "response.md"), raw, 0o644); err != nil {
+		return AgentResponse{}, err
+	}
+	return parseAgentResponse(raw, "replay")
+}
+
+func replayResponsePath(node *Node) string {
+	return strings.TrimSpace(node.StringAttr("agent.replay_response", ""))
+}
+
+// applyReplayResponses resolves replay paths to absolute form. Node attribute
+// paths are relative to the pipeline file; --replay-node overrides win.
+func applyReplayResponses(g *Graph, pipelinePath string, overrides map[string]string) (map[string]string, error) {
+	baseDir := filepath.Dir(pipelinePath)
+	for id, n := range g.Nodes {
+		p := replayResponsePath(n)
+		if p == "" {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(baseDir, p)
+		}
+		g.Nodes[id].Attrs["agent.replay_response"] = filepath.Clean(p)
+	}
+	ids := make([]string, 0, len(overrides))
+	for id := range overrides {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := g.Nodes[id]
+		if n == nil {
+			return nil, fmt.Errorf("replay target node not found: %s", id)
+		}
+		p, err := filepath.Abs(strings.TrimSpace(overrides[id]))
+		if err != nil {
+			return nil, err
+		}
+		n.Attrs["agent.replay_response"] = p
+	}
+	replayed := map[string]string{}
+	for id, n := range g.Nodes {
+		if p := replayResponsePath(n); p != "" {
+			if !isCodergenNode(n) {
+				return nil, fmt.Errorf("agent.replay_response is only supported on codergen nodes: %s", id)
+			}
+			replayed[id] = p
+		}
+	}
+	return replayed, nil
+}
+
+// ParseReplayNodeFlag parses a --replay-node value of the form node=path.
+func ParseReplayNodeFlag(raw string) (string, string, error) {
+	id, path, ok := strings.Cut(strings.TrimSpace(raw), "=")
+	id = strings.TrimSpace(id)
+	path = strings.TrimSpace(path)
+	if !ok || id == "" || path == "" {
+		return "", "", fmt.Errorf("invalid --replay-node %q: expected node=path", raw)
+	}
+	return id, path, nil
+}
@@ -0,0 +1,90 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Captured response whose verification plan arrived as a JSON-encoded string
+// inside context_updates; the plan parser used to reject this shape.
+const replayFixtureStringPlan = `{
+  "outcome": "success",
+  "preferred_next_label": "",
+  "suggested_next_ids": [],
+  "context_updates": {"verification.plan": "{\"files\":[\"main.go\"],\"commands\":[\"test -f main.go\"]}"},
+  "verification_plan": null,
+  "notes": "captured",
+  "failure_reason": ""
+}`
+
+func TestReplayResponseFeedsVerificationPipeline(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	generate [shape=box, "agent.replay_response"="fixture.json"];
+	verify [type=verification, "verification.allowed_commands"="test"];
+	exit [shape=Msquare];
+	start -> generate;
+	generate -> verify;
+	verify -> exit [condition="outcome=success"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "main.go"), "package main\n")
+	writeFile(t, filepath.Join(filepath.Dir(pipeline), "fixture.json"), replayFixtureStringPlan)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rp1"}); err != nil {
+		t.Fatal(err)
+	}
+	st := readStatusJSON(t, filepath.Join(runsdir, "rp1", "verify", "status.json"))
+	if st["outcome"] != "success" {
+		t.Fatalf("expected verification success, got %v", st)
+	}
+	resp, _ := os.ReadFile(filepath.Join(runsdir, "rp1", "generate", "response.md"))
+	if !strings.Contains(string(resp), "captured") {
+		t.Fatalf("expected replayed response artifact, got %q", string(resp))
+	}
+	types := readJSONLTypes(t, filepath.Join(runsdir, "rp1", "events.jsonl"))
+	if !strings.Contains(strings.Join(types, ","), "AgentResponseReplayed") {
+		t.Fatalf("expected replay event in %v", types)
+	}
+	b, _ := os.ReadFile(filepath.Join(runsdir, "rp1", "manifest.json"))
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	replayed, _ := m["replayed_nodes"].(map[string]any)
+	if _, ok := replayed["generate"]; !ok {
+		t.Fatalf("manifest missing replayed node: %v", m)
+	}
+}
+
+func TestReplayNodeOverrideAppliesToGraph(t *testing.T) {
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a; a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	fixture := filepath.Join(t.TempDir(), "resp.json")
+	writeFile(t, fixture, `{"outcome":"fail","preferred_next_label":"","suggested_next_ids":[],"context_updates":{},"verification_plan":null,"notes":"","failure_reason":"replayed failure"}`)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rp2", ReplayResponses: map[string]string{"a": fixture}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := readStatusJSON(t, filepath.Join(runsdir, "rp2", "a", "status.json"))
+	if st["failure_reason"] != "replayed failure" {
+		t.Fatalf("expected replayed outcome, got %v", st)
+	}
+	err = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rp3", ReplayResponses: map[string]string{"missing": fixture}})
+	if err == nil || !strings.Contains(err.Error(), "replay target node not found") {
+		t.Fatalf("expected unknown node error, got %v", err)
+	}
+}
+
+func TestParseReplayNodeFlag(t *testing.T) {
+	id, path, err := ParseReplayNodeFlag("implement=runs/r1/implement/response.md")
+	if err != nil || id != "implement" || path != "runs/r1/implement/response.md" {
+		t.Fatalf("unexpected parse: %q %q %v", id, path, err)
+	}
+	if _, _, err := ParseReplayNodeFlag("implement"); err == nil {
+		t.Fatal("expected error for missing path")
+	}
+}
@@ -0,0 +1,104 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrAgentStalled is returned by the codex backend when codex.stall_timeout
+// elapsed without output or CPU progress. The codergen handler turns it into
+// a failed attempt so max_retries applies.
+var ErrAgentStalled = errors.New("agent_stalled")
+
+// codexStallTimeout reads codex.stall_timeout="15m" (or
+// ATTRACTOR_CODEX_STALL_TIMEOUT). Unset means no stall detection.
+func codexStallTimeout(node *Node) (time.Duration, error) {
+	raw := strings.TrimSpace(os.Getenv("ATTRACTOR_CODEX_STALL_TIMEOUT"))
+	if _, ok := node.Attrs["codex.stall_timeout"]; ok {
+		if d, ok := node.DurationAttr("codex.stall_timeout"); ok && d > 0 {
+			return d, nil
+		}
+		raw = node.StringAttr("codex.stall_timeout", "")
+	} else if raw == "" {
+		return 0, nil
+	} else if d, err := ParseDurationV0(raw); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid codex.stall_timeout %q: expected a positive duration such as 15m", raw)
+}
+
+// outputActivity records when a codex stream last delivered bytes.
+type outputActivity struct {
+	last atomic.Int64
+}
+
+func newOutputActivity() *outputActivity {
+	a := &outputActivity{}
+	a.touch()
+	return a
+}
+
+func (a *outputActivity) touch() {
+	if a != nil {
+		a.last.Store(time.Now().UnixNano())
+	}
+}
+
+func (a *outputActivity) lastAt() time.Time {
+	return time.Unix(0, a.last.Load())
+}
+
+func (a *outputActivity) idle(now time.Time) time.Duration {
+	return now.Sub(a.lastAt())
+}
+
+// stallWatch decides when a silent agent is stalled. A process group whose
+// CPU time keeps growing counts as busy, so agents that buffer their output
+// until the end are not killed while they work.
+type stallWatch struct {
+	timeout  time.Duration
+	output   *outputActivity
+	cpuTime  func() (time.Duration, bool)
+	lastCPU  time.Duration
+	cpuAt    time.Time
+	cpuKnown bool
+}
+
+func newStallWatch(timeout time.Duration, output *outputActivity, cpuTime func() (time.Duration, bool)) *stallWatch {
+	return &stallWatch{timeout: timeout, output: output, cpuTime: cpuTime}
+}
+
+// stalled samples CPU time and reports whether neither output nor CPU time
+// has moved for the timeout, along with how long that has been.
+func (w *stallWatch) stalled(now time.Time) (bool, time.Duration) {
+	if cpu, ok := w.cpuTime(); ok {
+		if w.cpuKnown && cpu > w.lastCPU {
+			w.cpuAt = now
+		}
+		w.lastCPU, w.cpuKnown = cpu, true
+	}
+	active := w.output.lastAt()
+	if w.cpuAt.After(active) {
+		active = w.cpuAt
+	}
+	quiet := now.Sub(active)
+	return quiet >= w.timeout, quiet
+}
+
+// stallCheckInterval polls often enough to act within a tenth of the
+// timeout, without spinning for short test timeouts or scanning /proc
+// constantly for long ones.
+func stallCheckInterval(timeout time.Duration) time.Duration {
+	d := timeout / 10
+	if d < 10*time.Millisecond {
+		d = 10 * time.Millisecond
+	}
+	if d > 5*time.Second {
+		d = 5 * time.Second
+	}
+	return d
+}
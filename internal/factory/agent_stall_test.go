@@ -0,0 +1,142 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStallWatchCountsCPUProgressAsActivity(t *testing.T) {
+	output := newOutputActivity()
+	start := output.lastAt()
+	cpu := time.Duration(0)
+	w := newStallWatch(time.Minute, output, func() (time.Duration, bool) { return cpu, true })
+	if ok, _ := w.stalled(start.Add(30 * time.Second)); ok {
+		t.Fatal("stalled before the timeout")
+	}
+	cpu = time.Second
+	if ok, _ := w.stalled(start.Add(50 * time.Second)); ok {
+		t.Fatal("stalled while CPU time grew")
+	}
+	if ok, _ := w.stalled(start.Add(100 * time.Second)); ok {
+		t.Fatal("stalled within a timeout of the last CPU progress")
+	}
+	if ok, quiet := w.stalled(start.Add(111 * time.Second)); !ok || quiet != 61*time.Second {
+		t.Fatalf("stalled = %v after %s quiet", ok, quiet)
+	}
+
+	blind := newStallWatch(time.Minute, output, func() (time.Duration, bool) { return 0, false })
+	if ok, _ := blind.stalled(output.lastAt().Add(time.Minute)); !ok {
+		t.Fatal("output-only watch did not stall")
+	}
+}
+
+func TestCodexStallTimeoutFailsAttemptAndRetries(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "")
+	t.Setenv("ATTRACTOR_BACKEND", "")
+	t.Setenv("ATTRACTOR_AGENT_BACKEND", "")
+	dir := t.TempDir()
+	codex := filepath.Join(dir, "codex")
+	marker := filepath.Join(dir, "attempted")
+	script := `#!/bin/sh
+[ "$1" = "--version" ] && exit 0
+out=""
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-o" ]; then out="$2"; shift; fi
+  shift
+done
+cat >/dev/null
+echo started
+if [ ! -f "` + marker + `" ]; then
+  touch "` + marker + `"
+  sleep 30
+fi
+printf '%s' '{"outcome":"success","preferred_next_label":"","suggested_next_ids":[],"context_updates":{},"verification_plan":null,"notes":"","failure_reason":""}' > "$out"
+`
+	if err := os.WriteFile(codex, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=box, max_retries=1, "agent.backend"="codex", "codex.path"="` + codex + `", "codex.skip_git_repo_check"=true, "codex.stall_timeout"="300ms"];
+	exit [shape=Msquare];
+	start -> build -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	started := time.Now()
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "st1"}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed > 20*time.Second {
+		t.Fatalf("stalled attempt was not killed (run took %s)", elapsed)
+	}
+	failed := []string{}
+	for _, ev := range readJSONLRecords(t, filepath.Join(runsdir, "st1", "events.jsonl")) {
+		if ev["type"] == "StageFailed" || ev["type"] == "StageRetrying" {
+			failed = append(failed, fmt.Sprint(ev["type"], ":", ev["failure_code"]))
+		}
+	}
+	if len(failed) == 0 || !strings.HasPrefix(failed[0], "StageFailed:agent_stalled") {
+		t.Fatalf("events = %v", failed)
+	}
+}
+
+func TestCodexStallTimeoutRejectsInvalidValue(t *testing.T) {
+	node := &Node{ID: "a", Attrs: map[string]Value{"codex.stall_timeout": "soon"}}
+	if _, err := codexStallTimeout(node); err == nil || !strings.Contains(err.Error(), "codex.stall_timeout") {
+		t.Fatalf("err = %v", err)
+	}
+	if d, err := codexStallTimeout(&Node{ID: "a", Attrs: map[string]Value{"codex.stall_timeout": 15 * time.Minute}}); err != nil || d != 15*time.Minute {
+		t.Fatalf("duration attr = %s, %v", d, err)
+	}
+}
+
+func TestCodexBackgroundChildDoesNotHoldRunOpen(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "")
+	t.Setenv("ATTRACTOR_BACKEND", "")
+	t.Setenv("ATTRACTOR_AGENT_BACKEND", "")
+	defer func(d time.Duration) { codexWaitDelay = d }(codexWaitDelay)
+	codexWaitDelay = 200 * time.Millisecond
+	dir := t.TempDir()
+	codex := filepath.Join(dir, "codex")
+	// The backgrounded sleep inherits stdout and stderr, so without
+	// WaitDelay, Wait blocks until it exits.
+	script := `#!/bin/sh
+[ "$1" = "--version" ] && exit 0
+out=""
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-o" ]; then out="$2"; shift; fi
+  shift
+done
+cat >/dev/null
+sleep 30 &
+echo done
+printf '%s' '{"outcome":"success","preferred_next_label":"","suggested_next_ids":[],"context_updates":{},"verification_plan":null,"notes":"","failure_reason":""}' > "$out"
+`
+	if err := os.WriteFile(codex, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=box, "agent.backend"="codex", "codex.path"="` + codex + `", "codex.skip_git_repo_check"=true];
+	exit [shape=Msquare];
+	start -> build -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	started := time.Now()
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "bg1"}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed > 20*time.Second {
+		t.Fatalf("background child held the run open for %s", elapsed)
+	}
+	if b, err := os.ReadFile(filepath.Join(runsdir, "bg1", "build", "codex.stdout.log")); err != nil || !strings.Contains(string(b), "done") {
+		t.Fatalf("stdout log = %q, %v", b, err)
+	}
+	if st := readStatusJSON(t, filepath.Join(runsdir, "bg1", "build", "status.json")); st["outcome"] != "success" {
+		t.Fatalf("status = %v", st)
+	}
+}
@@ -1,6 +1,7 @@
 package attractor
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -27,7 +28,7 @@ func TestCodexOptionsResolveRelativeDirs(t *testing.T) {
 			"codex.sandbox":  "workspace-write",
 		},
 	}
-	opts, err := codexOptionsFromNodeAndEnv(n, workspace)
+	opts, err := codexOptionsFromNodeAndEnv(n, workspace, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -47,7 +48,7 @@ func TestCodexOptionsRejectParentSegment(t *testing.T) {
 			"codex.workdir": "../escape",
 		},
 	}
-	if _, err := codexOptionsFromNodeAndEnv(n, workspace); err == nil {
+	if _, err := codexOptionsFromNodeAndEnv(n, workspace, 0); err == nil {
 		t.Fatal("expected parent segment error")
 	}
 }
@@ -141,7 +142,7 @@ func TestCodexOptionsDefaultBlockedReadPaths(t *testing.T) {
 	t.Setenv("ATTRACTOR_CODEX_BLOCK_READ_PATHS", "")
 	workspace := t.TempDir()
 	n := &Node{ID: "a", Attrs: map[string]Value{}}
-	opts, err := codexOptionsFromNodeAndEnv(n, workspace)
+	opts, err := codexOptionsFromNodeAndEnv(n, workspace, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -158,7 +159,7 @@ func TestCodexOptionsAllowReadScenariosDisablesDefaultBlock(t *testing.T) {
 			"codex.allow_read_scenarios": true,
 		},
 	}
-	opts, err := codexOptionsFromNodeAndEnv(n, workspace)
+	opts, err := codexOptionsFromNodeAndEnv(n, workspace, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -175,7 +176,7 @@ func TestCodexOptionsRejectInvalidBlockedReadPath(t *testing.T) {
 			"codex.block_read_paths": "../secret",
 		},
 	}
-	if _, err := codexOptionsFromNodeAndEnv(n, workspace); err == nil {
+	if _, err := codexOptionsFromNodeAndEnv(n, workspace, 0); err == nil {
 		t.Fatal("expected invalid blocked read path error")
 	}
 }
@@ -189,7 +190,7 @@ func TestCodexOptionsPathAndDisableMCP(t *testing.T) {
 			"codex.disable_mcp": true,
 		},
 	}
-	opts, err := codexOptionsFromNodeAndEnv(n, workspace)
+	opts, err := codexOptionsFromNodeAndEnv(n, workspace, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -209,7 +210,7 @@ func TestCodexOptionsRelativeExecutablePathResolvesUnderWorkspace(t *testing.T)
 			"codex.path": ".factory/bin/codex",
 		},
 	}
-	opts, err := codexOptionsFromNodeAndEnv(n, workspace)
+	opts, err := codexOptionsFromNodeAndEnv(n, workspace, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -227,7 +228,93 @@ func TestCodexOptionsRejectRelativeExecutableParentPath(t *testing.T) {
 			"codex.path": "../bin/codex",
 		},
 	}
-	if _, err := codexOptionsFromNodeAndEnv(n, workspace); err == nil {
+	if _, err := codexOptionsFromNodeAndEnv(n, workspace, 0); err == nil {
 		t.Fatal("expected parent-segment error for codex.path")
 	}
 }
+
+func TestResolveAgentNodeFakeBackend(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "")
+	t.Setenv("ATTRACTOR_AGENT_BACKEND", "codex")
+	n := &Node{ID: "a", Attrs: map[string]Value{"agent.backend": "fake"}}
+	a, err := ResolveAgent(n, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.(fakeAgent); !ok {
+		t.Fatalf("expected fake agent, got %T", a)
+	}
+}
+
+func TestResolveAgentEnvFakeOverridesNodeBackend(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	a, err := ResolveAgent(&Node{ID: "a", Attrs: map[string]Value{}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.(fakeAgent); !ok {
+		t.Fatalf("expected fake agent, got %T", a)
+	}
+	a, err = ResolveAgent(&Node{ID: "a", Attrs: map[string]Value{"agent.backend": "codex"}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.(fakeAgent); !ok {
+		t.Fatalf("env fake should override agent.backend=codex, got %T", a)
+	}
+	t.Setenv("ATTRACTOR_HONOR_NODE_BACKEND", "1")
+	a, err = ResolveAgent(&Node{ID: "a", Attrs: map[string]Value{"agent.backend": "stub"}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := a.(stubAgent); !ok {
+		t.Fatalf("opted-in node attr should override env fake, got %T", a)
+	}
+}
+
+func TestHybridPipelineMixesFakeAndCodexNodes(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "")
+	t.Setenv("ATTRACTOR_BACKEND", "")
+	t.Setenv("ATTRACTOR_AGENT_BACKEND", "")
+	codex := filepath.Join(t.TempDir(), "codex")
+	script := `#!/bin/sh
+out=""
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-o" ]; then out="$2"; shift; fi
+  shift
+done
+cat >/dev/null
+printf '%s' '{"outcome":"success","preferred_next_label":"","suggested_next_ids":[],"context_updates":{"real":"yes"},"verification_plan":null,"notes":"codex","failure_reason":""}' > "$out"
+`
+	if err := os.WriteFile(codex, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	plan [shape=box, "agent.backend"="fake", "test.context_updates_json"="{\"planned\":true}"];
+	build [shape=box, "agent.backend"="codex", "codex.path"="` + codex + `", "codex.skip_git_repo_check"=true];
+	review [shape=box, "agent.backend"="fake", "test.outcome"="success"];
+	exit [shape=Msquare];
+	start -> plan;
+	plan -> build;
+	build -> review;
+	review -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(runsdir, "r1", "build", "codex.args.txt")); err != nil {
+		t.Fatalf("expected codex invocation for build: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(runsdir, "r1", "plan", "codex.args.txt")); err == nil {
+		t.Fatal("fake node must not invoke codex")
+	}
+	resp, err := os.ReadFile(filepath.Join(runsdir, "r1", "review", "response.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "outcome=success\n" {
+		t.Fatalf("unexpected fake response: %q", resp)
+	}
+}
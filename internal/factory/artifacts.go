@@ -0,0 +1,194 @@
+package attractor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	artifactsIndexFile = "artifacts.index.json"
+	// artifactsContextKey holds produced artifacts as
+	// {"<node>": {"<name>": "<workspace-relative path>"}}.
+	artifactsContextKey = "artifacts"
+)
+
+var artifactNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_\-]*$`)
+
+// ArtifactRecord is one produced artifact in artifacts.index.json.
+type ArtifactRecord struct {
+	Path       string `json:"path"`
+	Exists     bool   `json:"exists"`
+	Size       int64  `json:"size,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	RecordedAt string `json:"recorded_at"`
+}
+
+// parseProduces reads produces="report:agent/coverage.json,plan:plan.md"
+// into artifact name -> workspace-relative path.
+func parseProduces(n *Node) (map[string]string, error) {
+	raw := strings.TrimSpace(n.StringAttr("produces", ""))
+	if raw == "" {
+		return nil, nil
+	}
+	out := map[string]string{}
+	for _, entry := range splitCSV(raw) {
+		name, path, ok := strings.Cut(entry, ":")
+		name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+		switch {
+		case !ok || path == "":
+			return nil, fmt.Errorf("produces entry %q must be name:path", entry)
+		case !artifactNameRe.MatchString(name):
+			return nil, fmt.Errorf("produces entry %q has invalid artifact name", entry)
+		case strings.HasPrefix(path, "/"):
+			return nil, fmt.Errorf("produces contains absolute path: %s", path)
+		case strings.Contains(path, ".."):
+			return nil, fmt.Errorf("produces contains parent segment: %s", path)
+		}
+		if _, dup := out[name]; dup {
+			return nil, fmt.Errorf("produces declares artifact %s twice", name)
+		}
+		out[name] = filepath.ToSlash(filepath.Clean(path))
+	}
+	return out, nil
+}
+
+func validateProduces(n *Node) []Diagnostic {
+	if _, err := parseProduces(n); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s: %v", n.ID, err)}}
+	}
+	return nil
+}
+
+// splitArtifactRef splits the <node>.<name> of ${artifact.<node>.<name>}.
+// Node ids may contain dots, artifact names may not.
+func splitArtifactRef(ref string) (node, name string, ok bool) {
+	i := strings.LastIndexByte(ref, '.')
+	if i <= 0 || i == len(ref)-1 {
+		return "", "", false
+	}
+	return ref[:i], ref[i+1:], true
+}
+
+// artifactRefProblem explains why a node with the given ancestors cannot
+// reference ref, or returns "" when the producer exists, declares the
+// artifact, and runs first.
+func artifactRefProblem(g *Graph, ref string, ancestors map[string]bool) string {
+	nodeID, name, ok := splitArtifactRef(ref)
+	if !ok {
+		return fmt.Sprintf("malformed artifact reference %s (expected <node>.<name>)", ref)
+	}
+	producer := g.Nodes[nodeID]
+	if producer == nil {
+		return fmt.Sprintf("references artifact of unknown node: %s", nodeID)
+	}
+	produced, _ := parseProduces(producer)
+	if _, ok := produced[name]; !ok {
+		return fmt.Sprintf("references artifact %s that node %s does not declare in produces", name, nodeID)
+	}
+	if !ancestors[nodeID] {
+		return fmt.Sprintf("references artifact %s of node %s, which is not an ancestor", name, nodeID)
+	}
+	return ""
+}
+
+// artifactMissingError is returned by resolveNode when ${artifact...}
+// references cannot be resolved yet. runStage turns it into a fail outcome
+// for the consuming node.
+type artifactMissingError struct {
+	Reasons []string
+}
+
+func (e *artifactMissingError) Error() string {
+	return "artifact_missing: " + strings.Join(e.Reasons, "; ")
+}
+
+// lookupArtifact resolves ${artifact.<node>.<name>} to the path the producer
+// recorded, checking that it exists in the workspace now.
+func (e *Engine) lookupArtifact(ref string) (string, string) {
+	nodeID, name, ok := splitArtifactRef(ref)
+	if !ok {
+		return "", fmt.Sprintf("malformed artifact reference %s", ref)
+	}
+	byNode, _ := e.Context[artifactsContextKey].(map[string]any)
+	produced, _ := byNode[nodeID].(map[string]any)
+	path, _ := produced[name].(string)
+	if path == "" {
+		return "", fmt.Sprintf("%s: node %s has not produced it", ref, nodeID)
+	}
+	if _, err := os.Stat(filepath.Join(e.Workspace, filepath.FromSlash(path))); err != nil {
+		return "", fmt.Sprintf("%s (%s) does not exist in the workspace", ref, path)
+	}
+	return path, ""
+}
+
+// artifactMissingOutcome fails the consuming node for unresolved references.
+func (e *Engine) artifactMissingOutcome(node *Node, missing *artifactMissingError) Outcome {
+	e.recordEvent(map[string]any{"schema_version": 1, "type": "ArtifactMissing", "node_id": node.ID, "reasons": missing.Reasons, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+	e.Logger.Warn("artifact reference unresolved", "node", node.ID, "reasons", strings.Join(missing.Reasons, "; "))
+	return Outcome{SchemaVersion: 1, Outcome: "fail", FailureReason: missing.Error(), FailureCode: FailureArtifactMissing, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}
+}
+
+// recordProducedArtifacts adds a non-failed node's produces entries to the
+// artifacts context key. Declared paths are recorded even when missing;
+// consumers check existence when they reference them.
+func (e *Engine) recordProducedArtifacts(node *Node, out Outcome) error {
+	if out.Outcome == "fail" {
+		return nil
+	}
+	produced, err := parseProduces(node)
+	if err != nil || len(produced) == 0 {
+		return err
+	}
+	byNode, _ := e.Context[artifactsContextKey].(map[string]any)
+	if byNode == nil {
+		byNode = map[string]any{}
+	}
+	entry := map[string]any{}
+	for name, path := range produced {
+		entry[name] = path
+	}
+	byNode[node.ID] = entry
+	e.Context[artifactsContextKey] = byNode
+	return nil
+}
+
+// writeArtifactsIndex updates node's entry in artifacts.index.json. It runs
+// after the checkpoint so file hashes come from the checkpoint snapshot.
+func (e *Engine) writeArtifactsIndex(node *Node, out Outcome) error {
+	produced, err := parseProduces(node)
+	if err != nil || len(produced) == 0 || out.Outcome == "fail" {
+		return err
+	}
+	path := filepath.Join(e.RunDir, artifactsIndexFile)
+	index := map[string]map[string]ArtifactRecord{}
+	if b, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(b, &index); err != nil {
+			return fmt.Errorf("invalid %s: %w", artifactsIndexFile, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	records := map[string]ArtifactRecord{}
+	for name, rel := range produced {
+		rec := ArtifactRecord{Path: rel, RecordedAt: now}
+		if info, err := os.Stat(filepath.Join(e.Workspace, filepath.FromSlash(rel))); err == nil {
+			rec.Exists = true
+			if !info.IsDir() {
+				rec.Size = info.Size()
+			}
+			if st, ok := e.checkpointSnapshot[rel]; ok {
+				rec.SHA256 = st.Hash
+			}
+		}
+		records[name] = rec
+	}
+	index[node.ID] = records
+	return writeJSON(path, index)
+}
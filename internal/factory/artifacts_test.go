@@ -0,0 +1,93 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const artifactsDOT = `digraph G {
+	start [shape=Mdiamond];
+	implement [shape=parallelogram, produces="report:agent/coverage.json", tool_command="mkdir -p agent && echo 87 > agent/coverage.json"];
+	check [shape=parallelogram, tool_command="cat ${artifact.implement.report}"];
+	exit [shape=Msquare];
+	start -> implement -> check;
+	check -> exit [condition="outcome=success"];
+	check -> exit [condition="outcome=fail"];
+	}`
+
+func TestArtifactReferenceResolvesProducedPath(t *testing.T) {
+	workdir, runsdir, pipeline := setupRun(t, artifactsDOT)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ar1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ar1")
+	if b, _ := os.ReadFile(filepath.Join(runDir, "check", "tool.stdout.txt")); string(b) != "87\n" {
+		t.Fatalf("check stdout = %q", b)
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, artifactsIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := map[string]map[string]ArtifactRecord{}
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	if rec := index["implement"]["report"]; rec.Path != "agent/coverage.json" || !rec.Exists || rec.Size != 3 || rec.SHA256 == "" {
+		t.Fatalf("index = %s", b)
+	}
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byNode, _ := cp.Context[artifactsContextKey].(map[string]any)
+	if got, _ := byNode["implement"].(map[string]any); got["report"] != "agent/coverage.json" {
+		t.Fatalf("context artifacts = %v", cp.Context["artifacts"])
+	}
+}
+
+func TestArtifactReferenceFailsConsumerWhenMissing(t *testing.T) {
+	dot := strings.Replace(artifactsDOT, `tool_command="mkdir -p agent && echo 87 > agent/coverage.json"`, `tool_command="true"`, 1)
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ar2"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ar2")
+	st := readStatusJSON(t, filepath.Join(runDir, "check", "status.json"))
+	if st["failure_code"] != string(FailureArtifactMissing) || st["failure_reason"] != "artifact_missing: implement.report (agent/coverage.json) does not exist in the workspace" {
+		t.Fatalf("status = %v", st)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "check", "tool.stdout.txt")); !os.IsNotExist(err) {
+		t.Fatal("consumer ran despite the missing artifact")
+	}
+	if evs := eventsOfType(t, runDir, "ArtifactMissing"); len(evs) != 1 {
+		t.Fatalf("ArtifactMissing events = %v", evs)
+	}
+}
+
+func TestValidateArtifactReferences(t *testing.T) {
+	cases := map[string]string{
+		`${artifact.ghost.report}`: "references artifact of unknown node: ghost",
+		`${artifact.a.coverage}`:   "references artifact coverage that node a does not declare in produces",
+		`${artifact.b.log}`:        "references artifact log of node b, which is not an ancestor",
+		`${artifact.report}`:       "malformed artifact reference report",
+	}
+	for ref, want := range cases {
+		g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=parallelogram, tool_command="true", produces="report:r.json"]; b [shape=parallelogram, tool_command="cat ` + ref + `", produces="log:b.log"]; exit [shape=Msquare]; start -> a -> b -> exit; }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, want) {
+			t.Fatalf("%s: diagnostics %q missing %q", ref, msgs, want)
+		}
+	}
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=parallelogram, tool_command="true", produces="report"]; exit [shape=Msquare]; start -> a -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, `produces entry "report" must be name:path`) {
+		t.Fatalf("diagnostics %q", msgs)
+	}
+}
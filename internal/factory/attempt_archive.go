@@ -0,0 +1,169 @@
+package attractor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// attemptArchivePrefix names the node subdirectories that hold an earlier
+// attempt's artifacts: attempt-<n>, n being the attempt number in its id.
+const attemptArchivePrefix = "attempt-"
+
+// attemptArtifactFiles are the node dir files one handler attempt writes.
+// They are moved aside when the next attempt starts, so the top level only
+// shows the current attempt. status.json is copied instead: resume,
+// required_tool_node checks, and explain read the latest status until the
+// new attempt writes its own. Files that span attempts, such as
+// agent.attempts.jsonl and the escalation request and response, stay.
+var attemptArtifactFiles = []string{
+	"prompt.md",
+	"response.md",
+	"codex.args.txt",
+	"codex.stdout.log",
+	"codex.stderr.log",
+	codexEventsFile,
+	"tool.stdout.txt",
+	"tool.stderr.txt",
+	"tool.exitcode.txt",
+	toolMetaFile,
+	toolEnvFile,
+	"verification.plan.json",
+	"verification.results.json",
+	verificationDecisionsFile,
+	"workspace.diff.json",
+	"guardrail.violation.json",
+	resourceLimitReportFile,
+	"cache.hit.json",
+	"unfixable.analysis.json",
+	failureSummaryFile,
+	panicFile,
+	reapedProcessesFile,
+}
+
+// archiveAttempt moves the previous attempt's artifacts into
+// attempt-<n>/ before node's next attempt starts. status is that attempt's
+// outcome when it never reached status.json (an in-node retry); otherwise
+// the top-level status.json is copied if it belongs to the attempt. n is
+// the node's attempt count, or the next free number when a resumed run has
+// numbered attempts again. last_failure.artifacts paths into the moved
+// files are rewritten to their new place.
+func (e *Engine) archiveAttempt(node *Node, nodeDir string, status *Outcome) error {
+	n := e.totals.NodeAttempts[node.ID]
+	if n == 0 {
+		return nil
+	}
+	present := []string{}
+	for _, name := range attemptArtifactFiles {
+		if _, err := os.Lstat(filepath.Join(nodeDir, name)); err == nil {
+			present = append(present, name)
+		}
+	}
+	if len(present) == 0 {
+		return nil
+	}
+	if max := latestAttemptArchive(nodeDir); max >= n {
+		n = max + 1
+	}
+	dir := filepath.Join(nodeDir, attemptArchivePrefix+strconv.Itoa(n))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, name := range present {
+		if err := os.Rename(filepath.Join(nodeDir, name), filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	if status != nil {
+		if err := writeJSON(filepath.Join(dir, "status.json"), status); err != nil {
+			return err
+		}
+	} else if prev, err := readStatus(filepath.Join(nodeDir, "status.json")); err == nil && parseAttemptNumber(prev.AttemptID) == e.totals.NodeAttempts[node.ID] {
+		if err := writeJSON(filepath.Join(dir, "status.json"), prev); err != nil {
+			return err
+		}
+	}
+	if e.Context["last_failure.node_id"] == node.ID {
+		moved := func(p string) string {
+			if filepath.Dir(p) == nodeDir && filepath.Base(p) != "status.json" {
+				return filepath.Join(dir, filepath.Base(p))
+			}
+			return p
+		}
+		// A resumed run reads the map back from the checkpoint as
+		// map[string]any.
+		switch artifacts := e.Context["last_failure.artifacts"].(type) {
+		case map[string]string:
+			out := make(map[string]string, len(artifacts))
+			for key, p := range artifacts {
+				out[key] = moved(p)
+			}
+			e.Context["last_failure.artifacts"] = out
+		case map[string]any:
+			out := make(map[string]any, len(artifacts))
+			for key, v := range artifacts {
+				if p, ok := v.(string); ok {
+					v = moved(p)
+				}
+				out[key] = v
+			}
+			e.Context["last_failure.artifacts"] = out
+		}
+	}
+	e.Logger.Debug("archived previous attempt artifacts", "node", node.ID, "dir", dir, "files", len(present))
+	return nil
+}
+
+// latestAttemptArchive returns the highest attempt-<n> number in nodeDir,
+// or 0.
+func latestAttemptArchive(nodeDir string) int {
+	entries, err := os.ReadDir(nodeDir)
+	if err != nil {
+		return 0
+	}
+	max := 0
+	for _, ent := range entries {
+		num, ok := strings.CutPrefix(ent.Name(), attemptArchivePrefix)
+		if !ok || !ent.IsDir() {
+			continue
+		}
+		if n, err := strconv.Atoi(num); err == nil && n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// previousAttemptFile returns the path of name as the last attempt that
+// wrote it left it: in nodeDir, or else in the newest archive holding it.
+func previousAttemptFile(nodeDir, name string) (string, error) {
+	p := filepath.Join(nodeDir, name)
+	if _, err := os.Stat(p); err == nil {
+		return p, nil
+	}
+	for n := latestAttemptArchive(nodeDir); n > 0; n-- {
+		a := filepath.Join(nodeDir, attemptArchivePrefix+strconv.Itoa(n), name)
+		if _, err := os.Stat(a); err == nil {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", p, fs.ErrNotExist)
+}
+
+// attemptArchiveFor returns the archive holding the artifacts of the
+// attempt with id attemptID, or "" when they are still at the top level.
+func attemptArchiveFor(nodeDir, attemptID string) string {
+	if attemptID == "" {
+		return ""
+	}
+	for n := latestAttemptArchive(nodeDir); n > 0; n-- {
+		dir := filepath.Join(nodeDir, attemptArchivePrefix+strconv.Itoa(n))
+		if st, err := readStatus(filepath.Join(dir, "status.json")); err == nil && st.AttemptID == attemptID {
+			return dir
+		}
+	}
+	return ""
+}
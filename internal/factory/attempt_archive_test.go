@@ -0,0 +1,85 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// staleVerificationDOT fails verify twice: first on a command naming
+// ATTEMPT_ONE_MARKER, recorded in verification.results.json, then, once fix
+// has removed needed.txt, on the file check, which writes no results.
+const staleVerificationDOT = `digraph G {
+	start [shape=Mdiamond];
+	setup [shape=parallelogram, tool_command="touch needed.txt"];
+	generate [shape=box, "test.verification_plan_json"="{\"files\":[\"needed.txt\"],\"commands\":[\"test -f ATTEMPT_ONE_MARKER\"]}"];
+	verify [shape=parallelogram, type=verification, "verification.allowed_commands"="test -f"];
+	fix [shape=parallelogram, tool_command="rm needed.txt"];
+	exit [shape=Msquare];
+	start -> setup -> generate -> verify;
+	verify -> exit [condition="outcome=success"];
+	verify -> fix [condition="outcome=fail && visits(verify) < 2"];
+	verify -> exit [condition="outcome=fail && visits(verify) >= 2"];
+	fix -> verify;
+	}`
+
+func TestRetryFailureSummaryIgnoresPreviousAttempt(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, staleVerificationDOT)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "stale"})
+	verifyDir := filepath.Join(runsdir, "stale", "verify")
+
+	st := readStatusJSON(t, filepath.Join(verifyDir, "status.json"))
+	if st["failure_code"] != string(FailureVerificationFileMissing) {
+		t.Fatalf("status = %v", st)
+	}
+	summary, err := os.ReadFile(filepath.Join(verifyDir, failureSummaryFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(summary), "ATTEMPT_ONE_MARKER") || !strings.Contains(string(summary), "required file missing") {
+		t.Fatalf("attempt 2 summary:\n%s", summary)
+	}
+	if _, err := os.Stat(filepath.Join(verifyDir, "verification.results.json")); !os.IsNotExist(err) {
+		t.Fatalf("attempt 1 results left at the top level: %v", err)
+	}
+
+	archive := filepath.Join(verifyDir, "attempt-1")
+	if b, err := os.ReadFile(filepath.Join(archive, "verification.results.json")); err != nil || !strings.Contains(string(b), "ATTEMPT_ONE_MARKER") {
+		t.Fatalf("archived results = %q, %v", b, err)
+	}
+	if b, err := os.ReadFile(filepath.Join(archive, failureSummaryFile)); err != nil || !strings.Contains(string(b), "ATTEMPT_ONE_MARKER") {
+		t.Fatalf("archived summary = %q, %v", b, err)
+	}
+	if prev := readStatusJSON(t, filepath.Join(archive, "status.json")); prev["failure_code"] != string(FailureVerificationCommandFailed) || parseAttemptNumber(prev["attempt_id"].(string)) != 1 {
+		t.Fatalf("archived status = %v", prev)
+	}
+}
+
+func TestInNodeRetryArchivesAttempt(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box, max_retries=2, "test.outcome_sequence"="retry,success"]; exit [shape=Msquare]; start -> a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r"}); err != nil {
+		t.Fatal(err)
+	}
+	aDir := filepath.Join(runsdir, "r", "a")
+	prev := readStatusJSON(t, filepath.Join(aDir, "attempt-1", "status.json"))
+	if prev["outcome"] != "retry" || parseAttemptNumber(prev["attempt_id"].(string)) != 1 {
+		t.Fatalf("archived status = %v", prev)
+	}
+	for _, name := range []string{"prompt.md", "response.md", "workspace.diff.json"} {
+		for _, dir := range []string{aDir, filepath.Join(aDir, "attempt-1")} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+	}
+	if st := readStatusJSON(t, filepath.Join(aDir, "status.json")); st["outcome"] != "success" || parseAttemptNumber(st["attempt_id"].(string)) != 2 {
+		t.Fatalf("status = %v", st)
+	}
+	if _, err := os.Stat(filepath.Join(aDir, "attempt-2")); !os.IsNotExist(err) {
+		t.Fatalf("the current attempt was archived: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package attractor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// currentAttemptIDKey is the context key holding the id of the handler
+// attempt in progress, so agents and tools can stamp their own outputs.
+const currentAttemptIDKey = "internal.current_attempt_id"
+
+// attemptState is the handler attempt in progress.
+type attemptState struct {
+	NodeID string
+	ID     string
+}
+
+// newAttemptID is <node>-<n>-<random>: the node, its 1-based attempt
+// number across the run, and a suffix that keeps ids unique when a resumed
+// process numbers attempts again.
+func newAttemptID(nodeID string, n int) string {
+	return fmt.Sprintf("%s-%d-%s", nodeID, n, randomHexID(4))
+}
+
+// parseAttemptNumber returns the attempt number inside an attempt id.
+func parseAttemptNumber(id string) int {
+	rest, _, ok := cutLast(id, "-")
+	if !ok {
+		return 0
+	}
+	_, num, ok := cutLast(rest, "-")
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.Atoi(num)
+	return n
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// beginAttempt starts a new handler attempt of node and returns the one it
+// replaces, for endAttempt.
+func (e *Engine) beginAttempt(node *Node) attemptState {
+	prev := e.attempt
+	if e.totals.NodeAttempts == nil {
+		e.totals.NodeAttempts = map[string]int{}
+	}
+	e.totals.NodeAttempts[node.ID]++
+	e.attempt = attemptState{NodeID: node.ID, ID: newAttemptID(node.ID, e.totals.NodeAttempts[node.ID])}
+	e.Context[currentAttemptIDKey] = e.attempt.ID
+	return prev
+}
+
+// endAttempt restores the attempt a nested stage (a manager loop body)
+// interrupted.
+func (e *Engine) endAttempt(prev attemptState) {
+	e.attempt = prev
+	if prev.ID == "" {
+		delete(e.Context, currentAttemptIDKey)
+		return
+	}
+	e.Context[currentAttemptIDKey] = prev.ID
+}
+
+// stampAttempt adds attempt_id to a record about the node whose attempt is
+// in progress.
+func (e *Engine) stampAttempt(rec map[string]any) map[string]any {
+	if e.attempt.ID == "" || rec["node_id"] != e.attempt.NodeID {
+		return rec
+	}
+	if _, ok := rec["attempt_id"]; !ok {
+		rec["attempt_id"] = e.attempt.ID
+	}
+	return rec
+}
+
+// appendTrace is appendTrace for the engine's run, stamped with the
+// current attempt.
+func (e *Engine) appendTrace(recordType string, fields map[string]any) error {
+	return appendTrace(e.RunDir, recordType, e.stampAttempt(fields))
+}
+
+// AttemptInfo is one handler attempt of a node, assembled by Attempts from
+// the events and trace records stamped with its attempt_id.
+type AttemptInfo struct {
+	ID     string `json:"attempt_id"`
+	NodeID string `json:"node_id"`
+	Number int    `json:"number"`
+	// StartedAt and FinishedAt are the first and last record times.
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+	// Outcome is retry for an attempt that was retried, else the stage
+	// outcome; it is empty when the attempt never finished.
+	Outcome     string `json:"outcome,omitempty"`
+	FailureCode string `json:"failure_code,omitempty"`
+	// Records lists the event and trace record types, in order.
+	Records []string `json:"records"`
+}
+
+// Attempts lists nodeID's attempts in runDir by attempt number. Records
+// written before attempt ids existed are ignored.
+func Attempts(runDir, nodeID string) ([]AttemptInfo, error) {
+	if err := checkRunLayout(runDir); err != nil {
+		return nil, err
+	}
+	byID := map[string]*AttemptInfo{}
+	order := []string{}
+	add := func(rec map[string]any) {
+		id, _ := rec["attempt_id"].(string)
+		if id == "" || rec["node_id"] != nodeID {
+			return
+		}
+		a := byID[id]
+		if a == nil {
+			a = &AttemptInfo{ID: id, NodeID: nodeID, Number: parseAttemptNumber(id), Records: []string{}}
+			byID[id] = a
+			order = append(order, id)
+		}
+		if at, _ := rec["at"].(string); at != "" {
+			if a.StartedAt == "" {
+				a.StartedAt = at
+			}
+			a.FinishedAt = at
+		}
+		typ, _ := rec["type"].(string)
+		a.Records = append(a.Records, typ)
+		switch typ {
+		case "StageRetrying":
+			a.Outcome = "retry"
+		case "StageCompleted", "NodeOutputCaptured":
+			if o, _ := rec["outcome"].(string); o != "" && a.Outcome != "retry" {
+				a.Outcome = o
+			}
+		case "StageFailed":
+			if a.Outcome != "retry" {
+				a.Outcome = "fail"
+			}
+		}
+		if code, _ := rec["failure_code"].(string); code != "" {
+			a.FailureCode = code
+		}
+	}
+	records, _, err := readEvents(runDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := scanTraceRecords(runDir, func(rec map[string]any) { records = append(records, rec) }); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return recordTime(records[i]).Before(recordTime(records[j])) })
+	for _, rec := range records {
+		add(rec)
+	}
+	out := make([]AttemptInfo, 0, len(order))
+	for _, id := range order {
+		out = append(out, *byID[id])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Number < out[j].Number })
+	return out, nil
+}
+
+func recordTime(rec map[string]any) time.Time {
+	s, _ := rec["at"].(string)
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
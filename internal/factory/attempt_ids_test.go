@@ -0,0 +1,59 @@
+package attractor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttemptIDsLinkRecordsAcrossRetries(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, max_retries=1, allow_partial=true, "test.tool_outcome"="retry"];
+	exit [shape=Msquare];
+	start -> t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "at1", FakeTools: true}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "at1")
+	attempts, err := Attempts(runDir, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("attempts = %+v", attempts)
+	}
+	first, second := attempts[0], attempts[1]
+	if first.Number != 1 || second.Number != 2 || !strings.HasPrefix(first.ID, "t-1-") || !strings.HasPrefix(second.ID, "t-2-") {
+		t.Fatalf("attempt ids = %s, %s", first.ID, second.ID)
+	}
+	if first.Outcome != "retry" || strings.Join(first.Records, ",") != "StageStarted,NodeInputCaptured,StageRetrying" {
+		t.Fatalf("first attempt = %+v", first)
+	}
+	if second.Outcome != "partial_success" || !strings.Contains(strings.Join(second.Records, ","), "StageCompleted,NodeOutputCaptured") {
+		t.Fatalf("second attempt = %+v", second)
+	}
+	if st := readStatusJSON(t, filepath.Join(runDir, "t", "status.json")); st["attempt_id"] != second.ID {
+		t.Fatalf("status attempt_id = %v, want %s", st["attempt_id"], second.ID)
+	}
+	for _, rec := range readJSONLRecords(t, filepath.Join(runDir, traceFile)) {
+		if rec["type"] != "NodeOutputCaptured" || rec["node_id"] != "t" {
+			continue
+		}
+		after, _ := rec["context_after"].(map[string]any)
+		if after[currentAttemptIDKey] != second.ID {
+			t.Fatalf("context_after %s = %v, want %s", currentAttemptIDKey, after[currentAttemptIDKey], second.ID)
+		}
+	}
+	// Records about other nodes, and routing, carry no attempt id.
+	for _, ev := range readJSONLRecords(t, filepath.Join(runDir, "events.jsonl")) {
+		if id, ok := ev["attempt_id"].(string); ok && !strings.HasPrefix(id, ev["node_id"].(string)+"-") {
+			t.Fatalf("event %v stamped with another node's attempt", ev)
+		}
+	}
+	if got, err := Attempts(runDir, "nope"); err != nil || len(got) != 0 {
+		t.Fatalf("Attempts(nope) = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,136 @@
+package attractor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeOption sets attributes on a node added through a GraphBuilder.
+type NodeOption func(*Node)
+
+// EdgeOption sets attributes on an edge added through a GraphBuilder.
+type EdgeOption func(*Edge)
+
+// GraphBuilder constructs a pipeline graph in Go instead of DOT text:
+//
+//	b := attractor.NewGraphBuilder()
+//	b.Start("start")
+//	b.Codergen("implement", attractor.Prompt("..."), attractor.AllowedWrites("agent/"))
+//	b.Tool("test", "go test ./...")
+//	b.Exit("exit")
+//	b.Edge("start", "implement")
+//	b.Edge("implement", "test", attractor.OnOutcome("success"))
+//	b.Edge("test", "exit", attractor.OnOutcome("success"))
+//	g, diags := b.Build()
+//
+// Nodes and edges get the same attributes a DOT file would give them, so the
+// result runs exactly like the equivalent ParseDOT graph.
+type GraphBuilder struct {
+	g    *Graph
+	errs []string
+}
+
+func NewGraphBuilder() *GraphBuilder {
+	return &GraphBuilder{g: NewGraph()}
+}
+
+// Attr sets a graph attribute such as goal or a param.<name> default.
+func (b *GraphBuilder) Attr(key string, v Value) *GraphBuilder {
+	b.g.Attrs[key] = v
+	return b
+}
+
+// Node adds a node with only the given options; the handler is chosen from
+// its shape and type like any DOT node.
+func (b *GraphBuilder) Node(id string, opts ...NodeOption) *GraphBuilder {
+	return b.addNode(id, map[string]Value{}, opts)
+}
+
+func (b *GraphBuilder) Start(id string, opts ...NodeOption) *GraphBuilder {
+	return b.addNode(id, map[string]Value{"shape": "Mdiamond"}, opts)
+}
+
+func (b *GraphBuilder) Exit(id string, opts ...NodeOption) *GraphBuilder {
+	return b.addNode(id, map[string]Value{"shape": "Msquare"}, opts)
+}
+
+func (b *GraphBuilder) Codergen(id string, opts ...NodeOption) *GraphBuilder {
+	return b.addNode(id, map[string]Value{"shape": "box"}, opts)
+}
+
+func (b *GraphBuilder) Tool(id, command string, opts ...NodeOption) *GraphBuilder {
+	return b.addNode(id, map[string]Value{"shape": "parallelogram", "type": "tool", "tool_command": command}, opts)
+}
+
+func (b *GraphBuilder) Verification(id string, opts ...NodeOption) *GraphBuilder {
+	return b.addNode(id, map[string]Value{"shape": "box", "type": "verification"}, opts)
+}
+
+func (b *GraphBuilder) addNode(id string, attrs map[string]Value, opts []NodeOption) *GraphBuilder {
+	if strings.TrimSpace(id) == "" {
+		b.errs = append(b.errs, "node id cannot be empty")
+		return b
+	}
+	if _, dup := b.g.Nodes[id]; dup {
+		b.errs = append(b.errs, fmt.Sprintf("duplicate node %s", id))
+		return b
+	}
+	n := &Node{ID: id, Attrs: attrs}
+	for _, opt := range opts {
+		opt(n)
+	}
+	b.g.Nodes[id] = n
+	return b
+}
+
+// Edge adds an edge; edges are routed in the order they are added.
+func (b *GraphBuilder) Edge(from, to string, opts ...EdgeOption) *GraphBuilder {
+	e := &Edge{From: from, To: to, Attrs: map[string]Value{}}
+	for _, opt := range opts {
+		opt(e)
+	}
+	b.g.Edges = append(b.g.Edges, e)
+	return b
+}
+
+// Build expands matrix nodes, assigns edge IDs, and validates the graph. The
+// graph is returned with its diagnostics even when they include errors.
+func (b *GraphBuilder) Build() (*Graph, []Diagnostic) {
+	d := []Diagnostic{}
+	for _, msg := range b.errs {
+		d = append(d, Diagnostic{Level: "ERROR", Message: msg})
+	}
+	if err := expandMatrix(b.g); err != nil {
+		d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
+	}
+	assignEdgeIDs(b.g)
+	return b.g, append(d, ValidateGraph(b.g)...)
+}
+
+// NodeAttr sets any node attribute.
+func NodeAttr(key string, v Value) NodeOption {
+	return func(n *Node) { n.Attrs[key] = v }
+}
+
+func Prompt(text string) NodeOption {
+	return NodeAttr("prompt", text)
+}
+
+// AllowedWrites sets allowed_write_paths.
+func AllowedWrites(paths ...string) NodeOption {
+	return NodeAttr("allowed_write_paths", strings.Join(paths, ","))
+}
+
+// EdgeAttr sets any edge attribute.
+func EdgeAttr(key string, v Value) EdgeOption {
+	return func(e *Edge) { e.Attrs[key] = v }
+}
+
+// OnOutcome makes the edge conditional on the source node's outcome.
+func OnOutcome(outcome string) EdgeOption {
+	return EdgeAttr("condition", "outcome="+outcome)
+}
+
+func Label(text string) EdgeOption {
+	return EdgeAttr("label", text)
+}
@@ -0,0 +1,90 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGraphBuilderRunsWithoutDOTFile(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	b := NewGraphBuilder().Attr("goal", "ship the cli")
+	b.Start("start")
+	b.Codergen("implement", Prompt("Implement the cli.\n"), AllowedWrites("agent/", "go.mod"))
+	b.Tool("test", "test -f input.txt")
+	b.Exit("exit")
+	b.Edge("start", "implement")
+	b.Edge("implement", "test", OnOutcome("success"))
+	b.Edge("test", "exit", OnOutcome("success"), Label("passed"))
+	b.Edge("test", "implement", OnOutcome("fail"))
+	g, diags := b.Build()
+	if HasErrors(diags) {
+		t.Fatalf("diagnostics: %s", diagnosticMessages(diags))
+	}
+	if g.Nodes["implement"].StringAttr("allowed_write_paths", "") != "agent/,go.mod" || g.Edges[2].ID != "test-exit-0" {
+		t.Fatalf("unexpected graph: %+v %+v", g.Nodes["implement"].Attrs, g.Edges[2])
+	}
+	workdir, runsdir, _ := setupRun(t, "digraph G {}")
+	writeFile(t, filepath.Join(workdir, "input.txt"), "x\n")
+	if err := RunPipeline(RunConfig{Graph: g, Workdir: workdir, Runsdir: runsdir, RunID: "gb1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "gb1")
+	source, err := readManifestPipelineSource(runDir)
+	if err != nil || source != g.ToDOT() {
+		t.Fatalf("manifest pipeline_source = %q (%v)", source, err)
+	}
+	if embedded, err := os.ReadFile(filepath.Join(runDir, "pipeline.dot")); err != nil || string(embedded) != source {
+		t.Fatalf("pipeline.dot = %q (%v)", embedded, err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "exit", "status.json")); err != nil {
+		t.Fatalf("run did not reach exit: %v", err)
+	}
+}
+
+func TestGraphBuilderReportsErrors(t *testing.T) {
+	b := NewGraphBuilder()
+	b.Start("start").Codergen("a").Codergen("a").Node("")
+	b.Edge("start", "a").Edge("a", "missing")
+	_, diags := b.Build()
+	msgs := diagnosticMessages(diags)
+	for _, want := range []string{"duplicate node a", "node id cannot be empty", "target missing: missing", "must have at least one exit node"} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+}
+
+func TestToDOTRoundTrips(t *testing.T) {
+	dot := `digraph G {
+	graph [goal="say \"hi\"\nthen stop", "param.env"="dev", copy.verify=false];
+	start [shape=Mdiamond];
+	"odd id" [shape=box, prompt="multi\nline", timeout=90s, max_retries=2, "codex.temperature"=0.5, weight=3.0, allow_partial=true];
+	exit [shape=Msquare, require_context="coverage>=80"];
+	start -> "odd id" [id=first, label="go"];
+	"odd id" -> exit [condition="outcome=success"];
+	"odd id" -> exit [condition="outcome=fail"];
+	}`
+	g, err := ParseDOT(dot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := g.ToDOT()
+	again, err := ParseDOT(out)
+	if err != nil {
+		t.Fatalf("ToDOT output does not parse: %v\n%s", err, out)
+	}
+	if !reflect.DeepEqual(g, again) {
+		t.Fatalf("round trip changed the graph:\n%s", out)
+	}
+	if again.ToDOT() != out {
+		t.Fatal("ToDOT is not stable across a round trip")
+	}
+	for _, want := range []string{`"odd id" [allow_partial=true, "codex.temperature"=0.5, max_retries=2,`, `timeout=90s, weight=3.0]`, `start -> "odd id" [id="first", label="go"];`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
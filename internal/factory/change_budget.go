@@ -0,0 +1,133 @@
+package attractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// changeBudgetOffenders is how many of the largest changed files the
+// ChangeBudgetExceeded event lists.
+const changeBudgetOffenders = 10
+
+// changeBudget is the per-stage limit set by max_changed_files and
+// max_changed_bytes. Zero means no limit.
+type changeBudget struct {
+	Files int
+	Bytes uint64
+}
+
+func (b changeBudget) empty() bool {
+	return b.Files == 0 && b.Bytes == 0
+}
+
+func parseChangeBudget(n *Node) (changeBudget, error) {
+	var b changeBudget
+	if _, ok := n.Attrs["max_changed_files"]; ok {
+		files := n.IntAttr("max_changed_files", 0)
+		if files <= 0 {
+			return b, fmt.Errorf("invalid max_changed_files %v (expected a positive integer)", n.Attrs["max_changed_files"])
+		}
+		b.Files = files
+	}
+	if raw := strings.TrimSpace(n.StringAttr("max_changed_bytes", "")); raw != "" {
+		size, err := parseByteSize(raw)
+		if err != nil || size == 0 {
+			return b, fmt.Errorf("invalid max_changed_bytes %q (expected a positive size such as 5MB)", raw)
+		}
+		b.Bytes = size
+	}
+	return b, nil
+}
+
+// validateChangeBudget rejects malformed budgets and budgets on nodes that
+// do not write to the workspace.
+func validateChangeBudget(n *Node) []Diagnostic {
+	_, files := n.Attrs["max_changed_files"]
+	_, bytes := n.Attrs["max_changed_bytes"]
+	if !files && !bytes {
+		return nil
+	}
+	if !isExecutableNode(n) {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets max_changed_files or max_changed_bytes but is not a codergen, tool, or report node", n.ID)}}
+	}
+	if _, err := parseChangeBudget(n); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s: %v", n.ID, err)}}
+	}
+	return nil
+}
+
+// changedFile is one entry in a ChangeBudgetExceeded event.
+type changedFile struct {
+	Path   string `json:"path"`
+	Change string `json:"change"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// changeBudgetUsage is what a stage changed, counted against its budget.
+// A created or modified file counts its new size and a deleted file its old
+// size, so rewriting a large file costs as much as creating it.
+type changeBudgetUsage struct {
+	Files   int
+	Bytes   uint64
+	Largest []changedFile
+}
+
+func measureChanges(d workspaceDiff, before, after map[string]fileState) changeBudgetUsage {
+	files := []changedFile{}
+	for _, p := range d.Created {
+		files = append(files, changedFile{Path: p, Change: "created", Bytes: after[p].Size})
+	}
+	for _, p := range d.Modified {
+		files = append(files, changedFile{Path: p, Change: "modified", Bytes: after[p].Size})
+	}
+	for _, p := range d.Deleted {
+		files = append(files, changedFile{Path: p, Change: "deleted", Bytes: before[p].Size})
+	}
+	u := changeBudgetUsage{Files: len(files)}
+	for _, f := range files {
+		u.Bytes += uint64(f.Bytes)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Bytes > files[j].Bytes })
+	if len(files) > changeBudgetOffenders {
+		files = files[:changeBudgetOffenders]
+	}
+	u.Largest = files
+	return u
+}
+
+// exceeded returns the failure reason when u is over b, or "".
+func (b changeBudget) exceeded(u changeBudgetUsage) string {
+	over := []string{}
+	if b.Files > 0 && u.Files > b.Files {
+		over = append(over, fmt.Sprintf("changed %d files (max %d)", u.Files, b.Files))
+	}
+	if b.Bytes > 0 && u.Bytes > b.Bytes {
+		over = append(over, fmt.Sprintf("changed %d bytes (max %d)", u.Bytes, b.Bytes))
+	}
+	if len(over) == 0 {
+		return ""
+	}
+	return "change_budget_exceeded: " + strings.Join(over, ", ")
+}
+
+// changeBudgetMiddleware tells the agent its change budget
+// (prompt.inject_change_budget).
+type changeBudgetMiddleware struct{}
+
+func (changeBudgetMiddleware) Name() string { return "change_budget" }
+
+func (changeBudgetMiddleware) Transform(node *Node, _ Context, prompt string) (string, error) {
+	b, err := parseChangeBudget(node)
+	if err != nil || b.empty() {
+		return prompt, err
+	}
+	limits := []string{}
+	if b.Files > 0 {
+		limits = append(limits, fmt.Sprintf("at most %d files", b.Files))
+	}
+	if b.Bytes > 0 {
+		limits = append(limits, fmt.Sprintf("at most %d bytes of changed files", b.Bytes))
+	}
+	return strings.TrimRight(prompt, "\n") + "\n\nChange budget (hard requirement): create, modify, or delete " + strings.Join(limits, " and ") + " in the workspace. Going over fails this stage, so keep changes focused.", nil
+}
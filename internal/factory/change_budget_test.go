@@ -0,0 +1,72 @@
+package attractor
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChangeBudgetFailsStageBeforeGuardrail(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	gen [shape=parallelogram, tool_command="mkdir -p out && printf %0300d 0 > out/big && echo a > out/a && echo b > out/b", allowed_write_paths="out/", max_changed_files=2];
+	exit [shape=Msquare];
+	start -> gen -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "cb1"})
+	var budget map[string]any
+	failure := ""
+	for _, ev := range readJSONLRecords(t, filepath.Join(runsdir, "cb1", "events.jsonl")) {
+		switch ev["type"] {
+		case "ChangeBudgetExceeded":
+			budget = ev
+		case "GuardrailViolation":
+			t.Fatalf("guardrail fired for allowed paths: %v", ev)
+		case "StageFailed":
+			if ev["node_id"] == "gen" {
+				failure, _ = ev["failure_code"].(string)
+			}
+		}
+	}
+	if budget == nil || budget["changed_files"] != float64(3) || budget["max_changed_files"] != float64(2) {
+		t.Fatalf("ChangeBudgetExceeded = %v", budget)
+	}
+	largest, _ := budget["largest"].([]any)
+	if first, _ := largest[0].(map[string]any); len(largest) != 3 || first["path"] != "out/big" || first["bytes"] != float64(300) {
+		t.Fatalf("largest = %v", budget["largest"])
+	}
+	if failure != string(FailureChangeBudgetExceeded) {
+		t.Fatalf("failure_code = %q", failure)
+	}
+}
+
+func TestChangeBudgetPromptAndValidation(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	code [shape=box, prompt="fix it", max_changed_files=5, max_changed_bytes="1MB"];
+	wait [shape=hexagon, max_changed_files=0];
+	exit [shape=Msquare];
+	start -> code -> wait -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := buildPrompt(g.Nodes["code"], Context{}, g, builtinPromptMiddlewares(g.Nodes["code"], g, t.TempDir(), "", nil, slog.Default()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(p.text, "at most 5 files and at most 1048576 bytes") {
+		t.Fatalf("prompt = %q", p.text)
+	}
+	found := false
+	for _, d := range ValidateGraph(g) {
+		if strings.Contains(d.Message, "node wait sets max_changed_files") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("no diagnostic for max_changed_files on a wait node: %v", ValidateGraph(g))
+	}
+}
@@ -0,0 +1,108 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// runChangelogFile collects every stage's notes in the run dir.
+	runChangelogFile = "CHANGELOG.run.md"
+	// changelogNoteMaxBytes caps one stage's notes in the changelog; the
+	// full text stays in the node's status.json.
+	changelogNoteMaxBytes = 4096
+)
+
+// changelogWorkspacePath is the graph's changelog_to_workspace attr: a
+// workspace-relative file that also receives the changelog entries.
+func changelogWorkspacePath(g *Graph) string {
+	v, ok := g.Attrs["changelog_to_workspace"]
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(fmt.Sprintf("%v", v))
+}
+
+func validateChangelog(g *Graph) []Diagnostic {
+	if _, ok := g.Attrs["changelog_to_workspace"]; !ok {
+		return nil
+	}
+	p := changelogWorkspacePath(g)
+	if p == "" {
+		return []Diagnostic{{Level: "ERROR", Message: "changelog_to_workspace must not be empty"}}
+	}
+	if err := checkRelativeAttrPath("changelog_to_workspace", p, false); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: err.Error()}}
+	}
+	if clean := path.Clean(p); clean == "." || clean == ".git" || clean == ".attractor" || strings.HasPrefix(clean, ".git/") || strings.HasPrefix(clean, ".attractor/") {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("changelog_to_workspace %q must name a file outside .git and .attractor", p)}}
+	}
+	return nil
+}
+
+// changelogEntry renders one stage's notes as a markdown section. Notes over
+// changelogNoteMaxBytes are cut and point at statusPath for the rest.
+func changelogEntry(nodeID string, out Outcome, statusPath string, at time.Time) string {
+	notes := strings.TrimSpace(out.Notes)
+	if len(notes) > changelogNoteMaxBytes {
+		notes = strings.TrimSpace(strings.ToValidUTF8(notes[:changelogNoteMaxBytes], "")) + fmt.Sprintf("\n\n_Truncated; the full notes are in %s._", filepath.ToSlash(statusPath))
+	}
+	return fmt.Sprintf("## %s: %s (%s)\n\n%s\n\n", nodeID, out.Outcome, at.UTC().Format(time.RFC3339), notes)
+}
+
+// appendChangelog adds the stage's notes to CHANGELOG.run.md and, with
+// changelog_to_workspace, to that workspace file. The workspace file is
+// written between stages, so it shows up in no node's diff. It is skipped for
+// nodes whose allowed_write_paths do not cover it and for read_only nodes.
+func (e *Engine) appendChangelog(node *Node, out Outcome, statusPath string) {
+	if strings.TrimSpace(out.Notes) == "" {
+		return
+	}
+	entry := changelogEntry(node.ID, out, statusPath, time.Now())
+	if err := appendChangelogFile(filepath.Join(e.RunDir, runChangelogFile), e.RunID, entry); err != nil {
+		e.Logger.Warn("failed to append run changelog", "node", node.ID, "error", err)
+	}
+	rel := changelogWorkspacePath(e.Graph)
+	if rel == "" {
+		return
+	}
+	allowed, _ := ParseAllowedWritePaths(node)
+	if readOnlyNode(node) || (len(allowed) > 0 && !pathAllowed(path.Clean(rel), allowed)) {
+		e.Logger.Warn("node may not write the workspace changelog; skipping it", "node", node.ID, "path", rel)
+		return
+	}
+	if err := appendChangelogFile(filepath.Join(e.Workspace, filepath.FromSlash(rel)), e.RunID, entry); err != nil {
+		e.Logger.Warn("failed to append workspace changelog", "node", node.ID, "path", rel, "error", err)
+	}
+}
+
+// appendChangelogFile appends entry to path, starting the file with a
+// heading when it does not exist yet.
+func appendChangelogFile(p, runID, entry string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		entry = fmt.Sprintf("# Run %s changelog\n\n", runID) + entry
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(entry)
+	return err
+}
+
+// readRunChangelog returns CHANGELOG.run.md, or "" when no stage left notes.
+func readRunChangelog(runDir string) string {
+	b, err := os.ReadFile(filepath.Join(runDir, runChangelogFile))
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,69 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunChangelogCollectsNotes(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	long := strings.Repeat("x", changelogNoteMaxBytes+100)
+	dot := `digraph G {
+	graph [changelog_to_workspace="docs/CHANGES.md"];
+	start [shape=Mdiamond];
+	a [shape=box, "test.notes"="added the parser"];
+	b [shape=box, "test.notes"="` + long + `"];
+	c [shape=box, "test.notes"="touched src only", allowed_write_paths="src/"];
+	exit [shape=Msquare];
+	start -> a -> b -> c -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "c1")
+	b, err := os.ReadFile(filepath.Join(runDir, runChangelogFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(b)
+	for _, want := range []string{"# Run c1 changelog\n", "## a: success (", "added the parser", "## b: success (", "_Truncated; the full notes are in b/status.json._", "## c: success (", "touched src only"} {
+		if !strings.Contains(log, want) {
+			t.Fatalf("changelog missing %q:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, long) {
+		t.Fatal("long notes were not truncated")
+	}
+	ws, err := os.ReadFile(filepath.Join(runDir, "workspace", "docs", "CHANGES.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(ws), "added the parser") || strings.Contains(string(ws), "touched src only") {
+		t.Fatalf("workspace changelog:\n%s", ws)
+	}
+	if diff, _ := os.ReadFile(filepath.Join(runDir, "b", "workspace.diff.json")); strings.Contains(string(diff), "CHANGES.md") {
+		t.Fatalf("changelog write attributed to b: %s", diff)
+	}
+	if res := readStatusJSON(t, filepath.Join(runDir, runResultFile)); res["changelog"] != log {
+		t.Fatalf("run.result.json changelog = %v", res["changelog"])
+	}
+}
+
+func TestValidateChangelogToWorkspace(t *testing.T) {
+	for raw, want := range map[string]string{
+		`"../CHANGES.md"`: "contains parent segment",
+		`".git/CHANGES"`:  "outside .git and .attractor",
+		`""`:              "must not be empty",
+	} {
+		g, err := ParseDOT(`digraph G { graph [changelog_to_workspace=` + raw + `]; start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, want) {
+			t.Fatalf("%s: diagnostics = %s", raw, msgs)
+		}
+	}
+}
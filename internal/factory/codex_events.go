@@ -0,0 +1,251 @@
+package attractor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// codexEventsFile holds the normalized `codex exec --json` event stream of a
+// codergen node (codex.capture_events=true). Delegation rounds append to it.
+const codexEventsFile = "codex.events.jsonl"
+
+// codexEventMessageMax caps message text copied from agent messages,
+// reasoning, and errors; the raw stream stays in codex.stdout.log.
+const codexEventMessageMax = 2000
+
+// codexEvent is one normalized codex event. Kind is command, file_change,
+// tool_call, token_usage, agent_message, reasoning, error, or malformed;
+// other events keep their codex type as the kind.
+type codexEvent struct {
+	Seq   int    `json:"seq"`
+	Round int    `json:"round"`
+	At    string `json:"at"`
+	// Event is the codex event type, such as item.completed.
+	Event    string            `json:"event,omitempty"`
+	Kind     string            `json:"kind"`
+	Status   string            `json:"status,omitempty"`
+	Command  string            `json:"command,omitempty"`
+	ExitCode *int              `json:"exit_code,omitempty"`
+	Files    []codexFileChange `json:"files,omitempty"`
+	Tool     string            `json:"tool,omitempty"`
+	Usage    *codexTokenUsage  `json:"usage,omitempty"`
+	Message  string            `json:"message,omitempty"`
+	// Raw keeps a line that is not a JSON object, verbatim.
+	Raw string `json:"raw,omitempty"`
+}
+
+type codexFileChange struct {
+	Path string `json:"path"`
+	Kind string `json:"kind,omitempty"`
+}
+
+type codexTokenUsage struct {
+	InputTokens       int `json:"input_tokens"`
+	CachedInputTokens int `json:"cached_input_tokens"`
+	OutputTokens      int `json:"output_tokens"`
+}
+
+// codexEventWriter normalizes the stdout stream as it arrives. It never
+// fails the write: a file error is kept in err and later lines are dropped.
+type codexEventWriter struct {
+	f       *os.File
+	round   int
+	seq     int
+	pending []byte
+	err     error
+}
+
+func newCodexEventWriter(nodeDir string, round int) (*codexEventWriter, error) {
+	f, err := os.OpenFile(filepath.Join(nodeDir, codexEventsFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &codexEventWriter{f: f, round: round}, nil
+}
+
+func (w *codexEventWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.pending[:i])
+		w.pending = w.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// Close records a final unterminated line and closes the file.
+func (w *codexEventWriter) Close() error {
+	w.emit(w.pending)
+	w.pending = nil
+	if err := w.f.Close(); w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+func (w *codexEventWriter) emit(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || w.err != nil {
+		return
+	}
+	w.seq++
+	ev := normalizeCodexEvent(line)
+	ev.Seq, ev.Round, ev.At = w.seq, w.round, time.Now().UTC().Format(time.RFC3339Nano)
+	b, err := json.Marshal(ev)
+	if err == nil {
+		_, err = w.f.Write(append(b, '\n'))
+	}
+	w.err = err
+}
+
+// normalizeCodexEvent maps one `codex exec --json` line onto codexEvent.
+func normalizeCodexEvent(line []byte) codexEvent {
+	var raw map[string]any
+	if err := json.Unmarshal(line, &raw); err != nil || raw == nil {
+		return codexEvent{Kind: "malformed", Raw: string(line)}
+	}
+	typ, _ := raw["type"].(string)
+	ev := codexEvent{Event: typ, Kind: typ}
+	switch typ {
+	case "item.started", "item.updated", "item.completed":
+		item, _ := raw["item"].(map[string]any)
+		normalizeCodexItem(&ev, item)
+	case "turn.completed":
+		ev.Kind = "token_usage"
+		if usage, ok := raw["usage"].(map[string]any); ok {
+			ev.Usage = &codexTokenUsage{InputTokens: jsonInt(usage["input_tokens"]), CachedInputTokens: jsonInt(usage["cached_input_tokens"]), OutputTokens: jsonInt(usage["output_tokens"])}
+		}
+	case "turn.failed":
+		ev.Kind = "error"
+		if e, ok := raw["error"].(map[string]any); ok {
+			ev.Message = capCodexMessage(e["message"])
+		}
+	case "error":
+		ev.Message = capCodexMessage(raw["message"])
+	case "":
+		ev.Kind = "unknown"
+	}
+	return ev
+}
+
+func normalizeCodexItem(ev *codexEvent, item map[string]any) {
+	itemType, _ := item["type"].(string)
+	ev.Kind = itemType
+	ev.Status, _ = item["status"].(string)
+	switch itemType {
+	case "command_execution":
+		ev.Kind = "command"
+		ev.Command, _ = item["command"].(string)
+		if code, ok := item["exit_code"].(float64); ok {
+			c := int(code)
+			ev.ExitCode = &c
+		}
+	case "file_change":
+		changes, _ := item["changes"].([]any)
+		for _, c := range changes {
+			m, _ := c.(map[string]any)
+			path, _ := m["path"].(string)
+			kind, _ := m["kind"].(string)
+			if path != "" {
+				ev.Files = append(ev.Files, codexFileChange{Path: path, Kind: kind})
+			}
+		}
+	case "mcp_tool_call":
+		ev.Kind = "tool_call"
+		server, _ := item["server"].(string)
+		tool, _ := item["tool"].(string)
+		ev.Tool = strings.TrimPrefix(server+"."+tool, ".")
+	case "web_search":
+		ev.Kind = "tool_call"
+		ev.Tool = "web_search"
+	case "agent_message", "reasoning":
+		ev.Message = capCodexMessage(item["text"])
+	case "error":
+		ev.Message = capCodexMessage(item["message"])
+	case "":
+		ev.Kind = "unknown"
+	}
+}
+
+func capCodexMessage(v any) string {
+	s, _ := v.(string)
+	if len(s) > codexEventMessageMax {
+		return s[:codexEventMessageMax] + "…"
+	}
+	return s
+}
+
+func jsonInt(v any) int {
+	f, _ := v.(float64)
+	return int(f)
+}
+
+// codexEventTraceTypes maps the kinds traced by traceCodexEvents to their
+// trace record types. Items are traced once, when they complete.
+var codexEventTraceTypes = map[string]string{
+	"command":     "CodexCommandExecuted",
+	"file_change": "CodexFilesChanged",
+	"tool_call":   "CodexToolCalled",
+	"token_usage": "CodexTokenUsage",
+	"error":       "CodexError",
+}
+
+// traceCodexEvents adds a trace record for each significant event in the
+// node's codex.events.jsonl. Unreadable lines are skipped.
+func (e *Engine) traceCodexEvents(node *Node, nodeDir string) {
+	f, err := os.Open(filepath.Join(nodeDir, codexEventsFile))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4<<20)
+	counts := map[string]int{}
+	for sc.Scan() {
+		var ev codexEvent
+		if json.Unmarshal(sc.Bytes(), &ev) != nil {
+			continue
+		}
+		typ, ok := codexEventTraceTypes[ev.Kind]
+		if !ok || (strings.HasPrefix(ev.Event, "item.") && ev.Event != "item.completed") {
+			continue
+		}
+		fields := map[string]any{"node_id": node.ID, "round": ev.Round, "seq": ev.Seq, "codex_at": ev.At}
+		switch ev.Kind {
+		case "command":
+			fields["command"], fields["status"] = ev.Command, ev.Status
+			if ev.ExitCode != nil {
+				fields["exit_code"] = *ev.ExitCode
+			}
+		case "file_change":
+			fields["files"], fields["status"] = ev.Files, ev.Status
+		case "tool_call":
+			fields["tool"], fields["status"] = ev.Tool, ev.Status
+		case "token_usage":
+			if ev.Usage != nil {
+				fields["input_tokens"], fields["cached_input_tokens"], fields["output_tokens"] = ev.Usage.InputTokens, ev.Usage.CachedInputTokens, ev.Usage.OutputTokens
+			}
+			// The events file is cleared per attempt, so its usage belongs
+			// to the attempt the history recorded last.
+			if model := lastAgentModel(nodeDir); model != "" {
+				fields["model"] = model
+			}
+		case "error":
+			fields["message"] = ev.Message
+		}
+		_ = e.appendTrace(typ, fields)
+		counts[ev.Kind]++
+	}
+	if len(counts) > 0 {
+		e.Logger.Info("traced codex events", "node", node.ID, "counts", fmt.Sprint(counts))
+	}
+}
@@ -0,0 +1,98 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeCodexEvent(t *testing.T) {
+	cases := map[string]codexEvent{
+		`{"type":"item.completed","item":{"id":"i1","type":"command_execution","command":"go test ./...","exit_code":1,"status":"failed"}}`: {Event: "item.completed", Kind: "command", Status: "failed", Command: "go test ./..."},
+		`{"type":"item.completed","item":{"type":"file_change","changes":[{"path":"main.go","kind":"update"}],"status":"completed"}}`:       {Event: "item.completed", Kind: "file_change", Status: "completed", Files: []codexFileChange{{Path: "main.go", Kind: "update"}}},
+		`{"type":"item.completed","item":{"type":"mcp_tool_call","server":"docs","tool":"search","status":"completed"}}`:                    {Event: "item.completed", Kind: "tool_call", Status: "completed", Tool: "docs.search"},
+		`{"type":"turn.completed","usage":{"input_tokens":120,"cached_input_tokens":20,"output_tokens":30}}`:                                {Event: "turn.completed", Kind: "token_usage", Usage: &codexTokenUsage{InputTokens: 120, CachedInputTokens: 20, OutputTokens: 30}},
+		`{"type":"turn.failed","error":{"message":"stream closed"}}`:                                                                        {Event: "turn.failed", Kind: "error", Message: "stream closed"},
+		`{"type":"thread.started","thread_id":"t1"}`:                                                                                        {Event: "thread.started", Kind: "thread.started"},
+		`{"type":"item.comp`: {Kind: "malformed", Raw: `{"type":"item.comp`},
+	}
+	for line, want := range cases {
+		got := normalizeCodexEvent([]byte(line))
+		if got.Kind != want.Kind || got.Event != want.Event || got.Status != want.Status || got.Command != want.Command || got.Tool != want.Tool || got.Message != want.Message || got.Raw != want.Raw {
+			t.Fatalf("normalize(%s) = %+v, want %+v", line, got, want)
+		}
+		if len(got.Files) != len(want.Files) || (want.Usage != nil && (got.Usage == nil || *got.Usage != *want.Usage)) {
+			t.Fatalf("normalize(%s) = %+v, want %+v", line, got, want)
+		}
+	}
+	if ev := normalizeCodexEvent([]byte(`{"type":"item.completed","item":{"type":"command_execution","exit_code":2}}`)); ev.ExitCode == nil || *ev.ExitCode != 2 {
+		t.Fatalf("exit code = %v", ev.ExitCode)
+	}
+}
+
+func TestCodexCaptureEventsTracesAgentActivity(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "")
+	t.Setenv("ATTRACTOR_BACKEND", "")
+	t.Setenv("ATTRACTOR_AGENT_BACKEND", "")
+	codex := filepath.Join(t.TempDir(), "codex")
+	script := `#!/bin/sh
+out=""
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-o" ]; then out="$2"; shift; fi
+  shift
+done
+cat >/dev/null
+cat <<'EOF'
+{"type":"thread.started","thread_id":"t1"}
+{"type":"item.started","item":{"id":"i1","type":"command_execution","command":"go build ./...","status":"in_progress"}}
+{"type":"item.completed","item":{"id":"i1","type":"command_execution","command":"go build ./...","exit_code":0,"status":"completed"}}
+not json at all
+{"type":"item.completed","item":{"id":"i2","type":"file_change","changes":[{"path":"main.go","kind":"update"}],"status":"completed"}}
+{"type":"turn.completed","usage":{"input_tokens":100,"cached_input_tokens":10,"output_tokens":20}}
+EOF
+printf '%s' '{"type":"item.sta'
+printf '%s' '{"outcome":"success","preferred_next_label":"","suggested_next_ids":[],"context_updates":{},"verification_plan":null,"notes":"","failure_reason":""}' > "$out"
+`
+	if err := os.WriteFile(codex, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=box, "agent.backend"="codex", "codex.path"="` + codex + `", "codex.skip_git_repo_check"=true, "codex.capture_events"=true];
+	exit [shape=Msquare];
+	start -> build -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ce1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ce1")
+	args, err := os.ReadFile(filepath.Join(runDir, "build", "codex.args.txt"))
+	if err != nil || !strings.Contains(string(args), " --json ") {
+		t.Fatalf("codex args = %q (%v)", args, err)
+	}
+	recs := readJSONLRecords(t, filepath.Join(runDir, "build", codexEventsFile))
+	kinds := []string{}
+	for _, r := range recs {
+		kinds = append(kinds, r["kind"].(string))
+	}
+	if got := strings.Join(kinds, ","); got != "thread.started,command,command,malformed,file_change,token_usage,malformed" {
+		t.Fatalf("event kinds = %s", got)
+	}
+	if recs[3]["raw"] != "not json at all" || recs[6]["raw"] != `{"type":"item.sta` {
+		t.Fatalf("malformed lines not kept raw: %v / %v", recs[3], recs[6])
+	}
+	for typ, want := range map[string]int{"CodexCommandExecuted": 1, "CodexFilesChanged": 1, "CodexTokenUsage": 1} {
+		got, err := TraceQuery(runDir, TraceQueryOptions{Types: []string{typ}, Node: "build"})
+		if err != nil || len(got) != want {
+			t.Fatalf("%s records = %v (%v)", typ, got, err)
+		}
+		if typ == "CodexCommandExecuted" && (got[0]["command"] != "go build ./..." || got[0]["exit_code"] != float64(0)) {
+			t.Fatalf("command record = %v", got[0])
+		}
+		if typ == "CodexTokenUsage" && got[0]["output_tokens"] != float64(20) {
+			t.Fatalf("usage record = %v", got[0])
+		}
+	}
+}
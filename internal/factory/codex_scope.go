@@ -0,0 +1,147 @@
+package attractor
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// codexInferScope reports codex.infer_scope: derive codex's working
+// directory and --add-dir list from allowed_write_paths.
+func codexInferScope(node *Node) bool {
+	return boolAttrOrEnv(node, "codex.infer_scope", "ATTRACTOR_CODEX_INFER_SCOPE")
+}
+
+// writeScopeRoots is the directory of each allowed_write_paths entry, in
+// order and without repeats: the entry itself for a directory ("agent/"),
+// else its parent. The workspace root is "".
+func writeScopeRoots(allowed []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, entry := range allowed {
+		entry = filepath.ToSlash(strings.TrimSpace(entry))
+		dir := strings.TrimSuffix(entry, "/")
+		if !strings.HasSuffix(entry, "/") {
+			dir = path.Dir(entry)
+		}
+		if dir == "." {
+			dir = ""
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			out = append(out, dir)
+		}
+	}
+	return out
+}
+
+// scopeCovers reports whether writes to the workspace-relative dir are
+// inside root ("" is the whole workspace).
+func scopeCovers(root, dir string) bool {
+	return root == "" || dir == root || strings.HasPrefix(dir, root+"/")
+}
+
+// inferCodexScope derives codex's workdir and add-dirs from the write
+// allowlist. The workdir is workdir when given, else the first entry's
+// directory; add-dirs are the other roots the workdir does not contain.
+func inferCodexScope(allowed []string, workdir string) (string, []string) {
+	roots := writeScopeRoots(allowed)
+	if len(roots) == 0 {
+		return workdir, nil
+	}
+	if workdir == "" {
+		workdir = roots[0]
+	}
+	dirs := []string{}
+	for _, r := range roots {
+		covered := scopeCovers(workdir, r)
+		for _, d := range dirs {
+			covered = covered || scopeCovers(d, r)
+		}
+		if !covered {
+			dirs = append(dirs, r)
+		}
+	}
+	return workdir, dirs
+}
+
+// applyInferredCodexScope fills the workdir and add-dirs that neither the
+// node nor the environment set, when codex.infer_scope is on.
+func applyInferredCodexScope(node *Node, opts *CodexOptions) {
+	if !codexInferScope(node) {
+		return
+	}
+	allowed, err := ParseAllowedWritePaths(node)
+	if err != nil || len(allowed) == 0 {
+		return
+	}
+	wd, dirs := inferCodexScope(allowed, opts.Workdir)
+	if opts.Workdir == "" && wd != "" {
+		opts.Workdir = wd
+		opts.ScopeInferred = true
+	}
+	if len(opts.AddDirs) == 0 && len(dirs) > 0 {
+		opts.AddDirs = dirs
+		opts.ScopeInferred = true
+	}
+}
+
+// validateCodexScope warns when a codergen node's codex scoping, explicit
+// or inferred, leaves part of its allowed_write_paths outside what the
+// workspace-write sandbox lets codex write.
+func validateCodexScope(g *Graph, n *Node) []Diagnostic {
+	if !isCodergenNode(n) {
+		return nil
+	}
+	allowed, err := ParseAllowedWritePaths(n)
+	if err != nil || len(allowed) == 0 {
+		return nil
+	}
+	attr := func(key string) string {
+		v, _ := resolveAttr(n, g, key)
+		if v == nil {
+			return ""
+		}
+		return strings.TrimSpace(fmt.Sprintf("%v", v))
+	}
+	if sandbox := attr("codex.sandbox"); sandbox != "" && sandbox != "workspace-write" {
+		return nil
+	}
+	if strings.HasPrefix(attr("codex.workdir"), "/") {
+		return nil
+	}
+	workdir := strings.TrimSuffix(filepath.ToSlash(attr("codex.workdir")), "/")
+	addDirs := []string{}
+	for _, d := range splitCSV(attr("codex.add_dirs")) {
+		if d = strings.TrimSpace(d); d != "" && !strings.HasPrefix(d, "/") {
+			addDirs = append(addDirs, strings.TrimSuffix(filepath.ToSlash(d), "/"))
+		}
+	}
+	if workdir == "" && len(addDirs) == 0 {
+		return nil
+	}
+	if infer, _ := strconv.ParseBool(attr("codex.infer_scope")); infer {
+		wd, dirs := inferCodexScope(allowed, workdir)
+		if len(addDirs) == 0 {
+			addDirs = dirs
+		}
+		workdir = wd
+	}
+	if workdir == "" {
+		return nil
+	}
+	d := []Diagnostic{}
+	for _, entry := range allowed {
+		dir := writeScopeRoots([]string{entry})[0]
+		covered := scopeCovers(workdir, dir)
+		for _, a := range addDirs {
+			covered = covered || scopeCovers(a, dir)
+		}
+		if !covered {
+			d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s allowed_write_paths entry %s is outside codex.workdir %s and codex.add_dirs; the sandbox will not let the agent write it", n.ID, entry, workdir)})
+		}
+	}
+	return d
+}
@@ -0,0 +1,73 @@
+package attractor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInferCodexScopeFromAllowedWritePaths(t *testing.T) {
+	ws := t.TempDir()
+	node := &Node{ID: "impl", Attrs: map[string]Value{
+		"shape":               "box",
+		"allowed_write_paths": "agent/,docs/notes.md,agent/sub/,README.md",
+		"codex.infer_scope":   "true",
+	}}
+	opts, err := codexOptionsFromNodeAndEnv(node, ws, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.ScopeInferred || opts.Workdir != filepath.Join(ws, "agent") || strings.Join(opts.AddDirs, ",") != filepath.Join(ws, "docs")+","+ws {
+		t.Fatalf("inferred scope = %q %q (%t)", opts.Workdir, opts.AddDirs, opts.ScopeInferred)
+	}
+	// An explicit codex.workdir wins; only the add-dirs it misses are inferred.
+	node.Attrs["codex.workdir"] = "docs"
+	node.Attrs["allowed_write_paths"] = "agent/,docs/notes.md"
+	if opts, err = codexOptionsFromNodeAndEnv(node, ws, 0); err != nil {
+		t.Fatal(err)
+	}
+	if opts.Workdir != filepath.Join(ws, "docs") || strings.Join(opts.AddDirs, ",") != filepath.Join(ws, "agent") {
+		t.Fatalf("scope with explicit workdir = %q %q", opts.Workdir, opts.AddDirs)
+	}
+	args, err := buildCodexExecArgs(opts, "schema.json", "out.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joined := strings.Join(args, " "); !strings.Contains(joined, "-C "+filepath.Join(ws, "docs")) || !strings.Contains(joined, "--add-dir "+filepath.Join(ws, "agent")) {
+		t.Fatalf("args = %s", joined)
+	}
+	// Off by default.
+	delete(node.Attrs, "codex.infer_scope")
+	delete(node.Attrs, "codex.workdir")
+	if opts, err = codexOptionsFromNodeAndEnv(node, ws, 0); err != nil {
+		t.Fatal(err)
+	}
+	if opts.ScopeInferred || opts.Workdir != ws || len(opts.AddDirs) != 0 {
+		t.Fatalf("default scope = %q %q", opts.Workdir, opts.AddDirs)
+	}
+}
+
+func TestValidateCodexScopeWarnsOnUncoveredWritePaths(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, prompt="x", allowed_write_paths="agent/,docs/x.md", "codex.workdir"="agent"];
+	b [shape=box, prompt="x", allowed_write_paths="agent/,docs/x.md", "codex.workdir"="agent", "codex.add_dirs"="docs"];
+	c [shape=box, prompt="x", allowed_write_paths="agent/,docs/x.md", "codex.add_dirs"="docs", "codex.infer_scope"=true];
+	d [shape=box, prompt="x", allowed_write_paths="agent/", "codex.workdir"="src", "codex.sandbox"="danger-full-access"];
+	exit [shape=Msquare];
+	start -> a -> b -> c -> d -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	want := "node a allowed_write_paths entry docs/x.md is outside codex.workdir agent and codex.add_dirs; the sandbox will not let the agent write it"
+	if !strings.Contains(msgs, want) {
+		t.Fatalf("diagnostics lack %q:\n%s", want, msgs)
+	}
+	for _, id := range []string{"node b ", "node c ", "node d "} {
+		if strings.Contains(msgs, id+"allowed_write_paths") {
+			t.Fatalf("unexpected scope warning for %s:\n%s", id, msgs)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package attractor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	conditionOutcomes  = map[string]bool{"success": true, "fail": true, "retry": true, "partial_success": true}
+	conditionCallRe    = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\(\s*("(?:[^"\\]|\\.)*"|[^()"]*?)\s*\)\s*(<=|>=|!=|=|<|>)\s*(-?\d+)$`)
+	conditionFunctions = map[string]bool{"visits": true}
+)
+
+// edgeCondition is a parsed edge condition: clauses joined by "&&", each
+// either outcome=<outcome> or visits(<node>) <op> <n>. The node is written
+// as in an edge statement, so a quoted ID may hold any characters.
+type edgeCondition struct {
+	// Outcome is the required outcome; empty matches any outcome.
+	Outcome string
+	Visits  []visitClause
+}
+
+// visitClause compares the run's visit count for Node with N.
+type visitClause struct {
+	Node string
+	Op   string
+	N    int
+}
+
+// parseCondition parses an edge condition. It checks syntax only; node ids
+// are checked against the graph by ValidateGraph.
+func parseCondition(raw string) (edgeCondition, error) {
+	var c edgeCondition
+	for _, clause := range splitConditionClauses(raw) {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			return c, fmt.Errorf("empty clause")
+		}
+		if v, ok := strings.CutPrefix(clause, "outcome="); ok {
+			if !conditionOutcomes[v] {
+				return c, fmt.Errorf("unknown outcome %q", v)
+			}
+			if c.Outcome != "" {
+				return c, fmt.Errorf("outcome given twice")
+			}
+			c.Outcome = v
+			continue
+		}
+		m := conditionCallRe.FindStringSubmatch(clause)
+		if m == nil {
+			return c, fmt.Errorf("unsupported clause %q", clause)
+		}
+		if !conditionFunctions[m[1]] {
+			return c, fmt.Errorf("unknown function %s", m[1])
+		}
+		id, ok := parseNodeID(m[2])
+		if !ok {
+			return c, fmt.Errorf("invalid node id %s in %s()", m[2], m[1])
+		}
+		n, err := strconv.Atoi(m[4])
+		if err != nil {
+			return c, fmt.Errorf("invalid count %q", m[4])
+		}
+		c.Visits = append(c.Visits, visitClause{Node: id, Op: m[3], N: n})
+	}
+	return c, nil
+}
+
+// splitConditionClauses splits raw on "&&" outside quoted node IDs.
+func splitConditionClauses(raw string) []string {
+	var clauses []string
+	for {
+		i := indexOutsideQuotes(raw, "&&")
+		if i < 0 {
+			return append(clauses, raw)
+		}
+		clauses = append(clauses, raw[:i])
+		raw = raw[i+2:]
+	}
+}
+
+// validateEdgeCondition reports a condition that does not parse or calls
+// visits() on a node the graph does not have.
+func validateEdgeCondition(g *Graph, e *Edge) []Diagnostic {
+	raw := strings.TrimSpace(e.StringAttr("condition", ""))
+	if raw == "" {
+		return nil
+	}
+	c, err := parseCondition(raw)
+	if err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("edge %s has unsupported condition: %s (%v)", e.ref(), raw, err)}}
+	}
+	var d []Diagnostic
+	for _, v := range c.Visits {
+		if g.Nodes[v.Node] == nil {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("edge %s condition references unknown node: %s", e.ref(), v.Node)})
+		}
+	}
+	return d
+}
+
+// matches evaluates the condition against an outcome and the run's visit
+// counts. It also returns the counts it read, for route traces.
+func (c edgeCondition) matches(outcome string, visits map[string]int) (bool, map[string]int) {
+	ok := c.Outcome == "" || c.Outcome == outcome
+	read := map[string]int{}
+	for _, v := range c.Visits {
+		n := visits[v.Node]
+		read[v.Node] = n
+		ok = ok && compareInts(n, v.Op, v.N)
+	}
+	return ok, read
+}
+
+func compareInts(a int, op string, b int) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// conditionMatches evaluates a raw edge condition; an unparsable condition
+// never matches (ValidateGraph rejects those before a run).
+func conditionMatches(raw, outcome string, visits map[string]int) (bool, map[string]int) {
+	c, err := parseCondition(raw)
+	if err != nil {
+		return false, map[string]int{}
+	}
+	return c.matches(outcome, visits)
+}
+
+// formatVisits renders visit counts as visits(a)=1, visits(b)=2.
+func formatVisits(visits map[string]int) string {
+	parts := make([]string, 0, len(visits))
+	for _, id := range sortedKeys(visits) {
+		parts = append(parts, fmt.Sprintf("visits(%s)=%d", id, visits[id]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,235 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// reservedContextPrefixes are engine-owned keys that handler updates may not
+// write.
+var reservedContextPrefixes = []string{"internal.", "current_node", artifactsContextKey, artifactsContextKey + "."}
+
+// Get returns the value for key. An exact key match wins; otherwise the key is
+// treated as a dotted path that descends into nested map values, so
+// "verification.plan.commands" finds ctx["verification.plan"]["commands"] or
+// ctx["verification"]["plan"]["commands"].
+func (c Context) Get(key string) (any, bool) {
+	if v, ok := c[key]; ok {
+		return v, true
+	}
+	return lookupDotted(map[string]any(c), key)
+}
+
+func lookupDotted(m map[string]any, key string) (any, bool) {
+	for i := len(key) - 1; i > 0; i-- {
+		if key[i] != '.' {
+			continue
+		}
+		head, ok := m[key[:i]]
+		if !ok {
+			continue
+		}
+		child, ok := asStringMap(head)
+		if !ok {
+			continue
+		}
+		rest := key[i+1:]
+		if v, ok := child[rest]; ok {
+			return v, true
+		}
+		if v, ok := lookupDotted(child, rest); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func asStringMap(v any) (map[string]any, bool) {
+	switch t := v.(type) {
+	case map[string]any:
+		return t, true
+	case Context:
+		return map[string]any(t), true
+	default:
+		return nil, false
+	}
+}
+
+// GetString returns the string at key, or def when it is missing or not a
+// string.
+func (c Context) GetString(key, def string) string {
+	v, ok := c.Get(key)
+	if !ok {
+		return def
+	}
+	s, ok := v.(string)
+	if !ok {
+		return def
+	}
+	return s
+}
+
+// GetInt returns the integer at key. Float values from resumed (JSON-decoded)
+// checkpoints and numeric strings are accepted; anything else yields def.
+func (c Context) GetInt(key string, def int) int {
+	v, ok := c.Get(key)
+	if !ok {
+		return def
+	}
+	switch t := v.(type) {
+	case int:
+		return t
+	case int64:
+		return int(t)
+	case float64:
+		return int(t)
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return int(i)
+		}
+	case string:
+		if i, err := strconv.Atoi(strings.TrimSpace(t)); err == nil {
+			return i
+		}
+	}
+	return def
+}
+
+// GetBool returns the boolean at key. "true"/"false" strings are accepted.
+func (c Context) GetBool(key string, def bool) bool {
+	v, ok := c.Get(key)
+	if !ok {
+		return def
+	}
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(t)); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+// GetStringSlice returns the string list at key. JSON-decoded []any values are
+// accepted when every element is a string; anything else yields def.
+func (c Context) GetStringSlice(key string, def []string) []string {
+	v, ok := c.Get(key)
+	if !ok {
+		return def
+	}
+	switch t := v.(type) {
+	case []string:
+		return append([]string(nil), t...)
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			s, ok := item.(string)
+			if !ok {
+				return def
+			}
+			out = append(out, s)
+		}
+		return out
+	}
+	return def
+}
+
+// Set stores value under key. Engine-owned keys (internal.*, current_node) are
+// rejected so handler context updates cannot overwrite them.
+func (c Context) Set(key string, value any) error {
+	for _, prefix := range reservedContextPrefixes {
+		if key == prefix || (strings.HasSuffix(prefix, ".") && strings.HasPrefix(key, prefix)) {
+			return fmt.Errorf("context key %s is reserved", key)
+		}
+	}
+	c[key] = value
+	return nil
+}
+
+// deepCloneValue copies nested maps and slices so snapshots do not share
+// mutable state with the live context. The JSON-shaped types are copied
+// directly; other map and slice types fall back to a reflective copy.
+func deepCloneValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, item := range t {
+			out[k] = deepCloneValue(item)
+		}
+		return out
+	case Context:
+		out := make(Context, len(t))
+		for k, item := range t {
+			out[k] = deepCloneValue(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, item := range t {
+			out[i] = deepCloneValue(item)
+		}
+		return out
+	case []string:
+		return append([]string(nil), t...)
+	case map[string]string:
+		out := make(map[string]string, len(t))
+		for k, item := range t {
+			out[k] = item
+		}
+		return out
+	case nil:
+		return nil
+	default:
+		return reflectClone(reflect.ValueOf(v)).Interface()
+	}
+}
+
+// reflectClone deep-copies maps, slices, and pointers reachable from v,
+// routing interface values back through deepCloneValue. Struct fields are
+// copied by value.
+func reflectClone(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		if c := deepCloneValue(v.Elem().Interface()); c != nil {
+			out.Set(reflect.ValueOf(c))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), reflectClone(iter.Value()))
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(reflectClone(v.Index(i)))
+		}
+		return out
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(reflectClone(v.Elem()))
+		return out
+	default:
+		return v
+	}
+}
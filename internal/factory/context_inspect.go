@@ -0,0 +1,166 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ContextSnapshot is the run context around one attempt of a node, as
+// rebuilt by ContextAt.
+type ContextSnapshot struct {
+	NodeID  string
+	Attempt int
+	// Attempts is how many times the node started in the trace.
+	Attempts int
+	Before   map[string]any
+	// After is nil when the attempt never finished, as when the process
+	// died while the node was running.
+	After map[string]any
+}
+
+// ContextAt rebuilds the context before and after attempt of nodeID (1 is
+// the first attempt, 0 the last) by replaying the trace in order. Each
+// NodeInputCaptured context_before resets the context, since the engine
+// changes it between nodes (visit counters) outside any delta. Each
+// NodeOutputCaptured applies its context_delta, or when it has none,
+// replaces the context with its context_after. For records without either
+// snapshot, ResumeLoaded resets the context to what it was after the
+// checkpoint's last completed node, dropping changes from an attempt that
+// the crash cut short.
+func ContextAt(runDir, nodeID string, attempt int) (ContextSnapshot, error) {
+	if err := checkRunLayout(runDir); err != nil {
+		return ContextSnapshot{}, err
+	}
+	snap := ContextSnapshot{NodeID: nodeID, Attempt: attempt}
+	ctx := map[string]any{}
+	afterNode := map[string]map[string]any{}
+	attempts := map[string]int{}
+	var current *ContextSnapshot
+	var found *ContextSnapshot
+	err := scanTraceRecords(runDir, func(rec map[string]any) {
+		id, _ := rec["node_id"].(string)
+		switch rec["type"] {
+		case "ResumeLoaded":
+			last, _ := rec["last_completed_node"].(string)
+			ctx = map[string]any{}
+			if c, ok := afterNode[last]; ok {
+				ctx = cloneMap(c)
+			}
+			current = nil
+		case "NodeInputCaptured":
+			attempts[id]++
+			current = nil
+			if before, ok := rec["context_before"].(map[string]any); ok {
+				ctx = cloneMap(before)
+			}
+			if id == nodeID {
+				current = &ContextSnapshot{NodeID: id, Attempt: attempts[id], Before: cloneMap(ctx)}
+				if attempt == 0 || attempt == attempts[id] {
+					found = current
+				}
+			}
+		case "NodeOutputCaptured":
+			if delta, ok := rec["context_delta"].(map[string]any); ok {
+				applyContextDelta(ctx, delta)
+			} else if after, ok := rec["context_after"].(map[string]any); ok {
+				ctx = cloneMap(after)
+			}
+			afterNode[id] = cloneMap(ctx)
+			if current != nil && current.NodeID == id {
+				current.After = cloneMap(ctx)
+				current = nil
+			}
+		}
+	})
+	if err != nil {
+		return snap, err
+	}
+	snap.Attempts = attempts[nodeID]
+	switch {
+	case snap.Attempts == 0:
+		return snap, fmt.Errorf("node %s never ran in %s", nodeID, runDir)
+	case found == nil:
+		return snap, fmt.Errorf("node %s has %d attempt(s); attempt %d not found", nodeID, snap.Attempts, attempt)
+	}
+	found.Attempts = snap.Attempts
+	return *found, nil
+}
+
+// applyContextDelta applies a computeContextDelta result to ctx.
+func applyContextDelta(ctx map[string]any, delta map[string]any) {
+	added, _ := delta["added"].(map[string]any)
+	for k, v := range added {
+		ctx[k] = v
+	}
+	updated, _ := delta["updated"].(map[string]any)
+	for k, v := range updated {
+		if change, ok := v.(map[string]any); ok {
+			ctx[k] = change["after"]
+		}
+	}
+	removed, _ := delta["removed"].([]any)
+	for _, k := range removed {
+		if s, ok := k.(string); ok {
+			delete(ctx, s)
+		}
+	}
+}
+
+// WriteContextJSON prints ctx as indented JSON.
+func WriteContextJSON(w io.Writer, ctx map[string]any) error {
+	b, err := json.MarshalIndent(ctx, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// WriteContextFlat prints one key=value line per context key, sorted, with
+// values in JSON.
+func WriteContextFlat(w io.Writer, ctx map[string]any) error {
+	for _, k := range sortedKeys(ctx) {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", k, contextJSONValue(ctx[k])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteContextDiff prints what changed from one context to another: "+" for
+// added keys, "-" for removed ones, and "~" for changed values.
+func WriteContextDiff(w io.Writer, from, to map[string]any) error {
+	keys := map[string]bool{}
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+	for _, k := range sortedKeys(keys) {
+		a, inFrom := from[k]
+		b, inTo := to[k]
+		var err error
+		switch {
+		case !inFrom:
+			_, err = fmt.Fprintf(w, "+ %s=%s\n", k, contextJSONValue(b))
+		case !inTo:
+			_, err = fmt.Fprintf(w, "- %s=%s\n", k, contextJSONValue(a))
+		case contextJSONValue(a) != contextJSONValue(b):
+			_, err = fmt.Fprintf(w, "~ %s: %s -> %s\n", k, contextJSONValue(a), contextJSONValue(b))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contextJSONValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
@@ -0,0 +1,117 @@
+package attractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const contextInspectDOT = `digraph G {
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="sh a.sh"];
+	b [shape=parallelogram, tool_command="sh b.sh"];
+	exit [shape=Msquare];
+	start -> a -> b -> exit;
+	}`
+
+func setupContextInspectRun(t *testing.T) (string, string, string) {
+	t.Helper()
+	workdir, runsdir, pipeline := setupRun(t, contextInspectDOT)
+	writeFile(t, filepath.Join(workdir, "a.sh"), `mkdir -p .attractor && printf '{"stage":"a","n":1}' > .attractor/context_updates.json`+"\n")
+	writeFile(t, filepath.Join(workdir, "b.sh"), `mkdir -p .attractor && printf '{"stage":"b"}' > .attractor/context_updates.json`+"\n")
+	return workdir, runsdir, pipeline
+}
+
+func TestContextAtReplaysDeltasAcrossResume(t *testing.T) {
+	workdir, runsdir, pipeline := setupContextInspectRun(t)
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ctx1"})
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ctx1", Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ctx1")
+	snap, err := ContextAt(runDir, "b", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Attempts != 1 || snap.Before["stage"] != "a" || snap.Before["n"] != float64(1) || snap.After["stage"] != "b" || snap.After["current_node"] != "b" {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+	if _, err := ContextAt(runDir, "b", 2); err == nil || !strings.Contains(err.Error(), "node b has 1 attempt(s); attempt 2 not found") {
+		t.Fatalf("missing attempt err = %v", err)
+	}
+	if _, err := ContextAt(runDir, "nope", 0); err == nil || !strings.Contains(err.Error(), "never ran") {
+		t.Fatalf("unknown node err = %v", err)
+	}
+	a, err := ContextAt(runDir, "a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := WriteContextDiff(&out, a.After, snap.After); err != nil {
+		t.Fatal(err)
+	}
+	want := "~ current_node: \"a\" -> \"b\"\n~ internal.current_attempt_id: \"" + a.After[currentAttemptIDKey].(string) + "\" -> \"" + snap.After[currentAttemptIDKey].(string) + "\"\n+ internal.visits.b=1\n~ stage: \"a\" -> \"b\"\n"
+	if got := out.String(); got != want {
+		t.Fatalf("diff =\n%s", got)
+	}
+	out.Reset()
+	if err := WriteContextFlat(&out, a.After); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "\nn=1\noutcome=\"success\"\nstage=\"a\"\n") {
+		t.Fatalf("flat =\n%s", out.String())
+	}
+}
+
+func TestContextAtFallsBackToContextAfter(t *testing.T) {
+	workdir, runsdir, pipeline := setupContextInspectRun(t)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ctx2"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ctx2")
+	want, err := ContextAt(runDir, "b", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracePath := filepath.Join(runDir, traceFile)
+	b, err := os.ReadFile(tracePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rewritten bytes.Buffer
+	for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+		rec := map[string]any{}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatal(err)
+		}
+		delete(rec, "context_delta")
+		if rec["node_id"] == "a" {
+			delete(rec, "context_before")
+		}
+		nb, _ := json.Marshal(rec)
+		rewritten.Write(append(nb, '\n'))
+	}
+	if err := os.WriteFile(tracePath, rewritten.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ContextAt(runDir, "b", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contextJSONValue(got.Before) != contextJSONValue(want.Before) || contextJSONValue(got.After) != contextJSONValue(want.After) {
+		t.Fatalf("without deltas = %+v, want %+v", got, want)
+	}
+	// a also lost context_before, so its Before is replayed from start.
+	a, err := ContextAt(runDir, "a", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Before["current_node"] != "start" || a.After["stage"] != "a" {
+		t.Fatalf("a without snapshots = %+v", a)
+	}
+}
@@ -0,0 +1,144 @@
+package attractor
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestContextTypedAccessors(t *testing.T) {
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(`{"count": 3, "flag": "true", "files": ["a.go", "b.go"], "mixed": ["a", 1]}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	ctx := Context(decoded)
+	ctx["name"] = "impl"
+	if got := ctx.GetString("name", "x"); got != "impl" {
+		t.Fatalf("GetString = %q", got)
+	}
+	if got := ctx.GetString("count", "def"); got != "def" {
+		t.Fatalf("GetString on wrong type = %q", got)
+	}
+	if got := ctx.GetInt("count", 0); got != 3 {
+		t.Fatalf("GetInt on JSON float = %d", got)
+	}
+	if got := ctx.GetInt("missing", 7); got != 7 {
+		t.Fatalf("GetInt default = %d", got)
+	}
+	if !ctx.GetBool("flag", false) {
+		t.Fatal("GetBool should accept \"true\"")
+	}
+	if got := ctx.GetStringSlice("files", nil); !reflect.DeepEqual(got, []string{"a.go", "b.go"}) {
+		t.Fatalf("GetStringSlice = %v", got)
+	}
+	if got := ctx.GetStringSlice("mixed", []string{"def"}); !reflect.DeepEqual(got, []string{"def"}) {
+		t.Fatalf("GetStringSlice on mixed list = %v", got)
+	}
+}
+
+func TestContextDottedGet(t *testing.T) {
+	ctx := Context{
+		"verification.plan":    map[string]any{"commands": []any{"go test ./..."}},
+		"loop":                 map[string]any{"impl": map[string]any{"iteration": 2}},
+		"last_failure.node_id": "verify",
+	}
+	if got := ctx.GetStringSlice("verification.plan.commands", nil); !reflect.DeepEqual(got, []string{"go test ./..."}) {
+		t.Fatalf("nested commands = %v", got)
+	}
+	if got := ctx.GetInt("loop.impl.iteration", 0); got != 2 {
+		t.Fatalf("nested iteration = %d", got)
+	}
+	if got := ctx.GetString("last_failure.node_id", ""); got != "verify" {
+		t.Fatalf("exact dotted key = %q", got)
+	}
+	if _, ok := ctx.Get("verification.plan.missing"); ok {
+		t.Fatal("expected missing nested key")
+	}
+}
+
+func TestContextSetRejectsReservedKeys(t *testing.T) {
+	ctx := Context{}
+	for _, key := range []string{"internal.retry_count.a", "current_node"} {
+		if err := ctx.Set(key, 1); err == nil {
+			t.Fatalf("expected %s to be rejected", key)
+		}
+	}
+	if err := ctx.Set("current_node_hint", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Set("internal_notes", "x"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloneContextDetectsInPlaceNestedMutation(t *testing.T) {
+	plan := map[string]any{"commands": []any{"go test ./..."}}
+	ctx := Context{"verification.plan": plan}
+	before := cloneContext(ctx)
+	plan["commands"] = append(plan["commands"].([]any), "go vet ./...")
+	plan["files"] = []any{"a.go"}
+	delta := computeContextDelta(before, cloneContext(ctx))
+	updated := delta["updated"].(map[string]any)
+	if _, ok := updated["verification.plan"]; !ok {
+		t.Fatalf("expected in-place mutation in delta, got %v", delta)
+	}
+}
+
+func TestHandlerContextUpdatesCannotWriteReservedKeys(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, "test.context_updates_json"="{\"internal.retry_count.a\": 9, \"current_node\": \"evil\", \"note\": \"ok\"}"];
+	exit [shape=Msquare];
+	start -> a;
+	a -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ctx1"}); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := readCheckpoint(filepath.Join(runsdir, "ctx1", "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Context["note"] != "ok" {
+		t.Fatalf("expected regular update to apply, got %v", cp.Context["note"])
+	}
+	if _, ok := cp.Context["internal.retry_count.a"]; ok {
+		t.Fatal("reserved internal key was written by handler")
+	}
+	if cp.Context["current_node"] == "evil" {
+		t.Fatal("current_node was overwritten by handler")
+	}
+}
+
+func TestApplyContextUpdatesDetachesHandlerValues(t *testing.T) {
+	e := &Engine{Context: Context{}, Logger: newFactoryLogger()}
+	cfg := map[string]any{"level": 1, "tags": []any{"a"}}
+	groups := map[string][]map[string]any{"x": {{"n": 1}}}
+	e.applyContextUpdates(&Node{ID: "a"}, map[string]any{"cfg": cfg, "groups": groups})
+	before := cloneContext(e.Context)
+	want, err := json.Marshal(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg["level"] = 2
+	cfg["tags"] = append(cfg["tags"].([]any), "b")
+	groups["x"][0]["n"] = 2
+	if got, _ := json.Marshal(e.Context); string(got) != string(want) {
+		t.Fatalf("handler mutation leaked into context: %s, want %s", got, want)
+	}
+	e.Context["cfg"].(map[string]any)["level"] = 3
+	e.Context["groups"].(map[string][]map[string]any)["x"][0]["n"] = 3
+	if got, _ := json.Marshal(before); string(got) != string(want) {
+		t.Fatalf("context mutation leaked into snapshot: %s, want %s", got, want)
+	}
+	updated := computeContextDelta(before, cloneContext(e.Context))["updated"].(map[string]any)
+	if _, ok := updated["cfg"]; !ok {
+		t.Fatalf("expected cfg in delta, got %v", updated)
+	}
+	if _, ok := updated["groups"]; !ok {
+		t.Fatalf("expected groups in delta, got %v", updated)
+	}
+}
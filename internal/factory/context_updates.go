@@ -0,0 +1,149 @@
+package attractor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// contextUpdateKey is one entry of codex.context_update_keys.
+type contextUpdateKey struct {
+	Name string
+	Type string
+}
+
+var contextUpdateTypes = map[string]bool{"string": true, "number": true, "integer": true, "boolean": true, "array": true, "object": true}
+
+// parseContextUpdateKeys parses "coverage:number,summary:string".
+func parseContextUpdateKeys(raw string) ([]contextUpdateKey, error) {
+	keys := []contextUpdateKey{}
+	seen := map[string]bool{}
+	for _, entry := range splitCSV(raw) {
+		name, typ, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		typ = strings.ToLower(strings.TrimSpace(typ))
+		if !ok || name == "" || !contextUpdateTypes[typ] {
+			return nil, fmt.Errorf("invalid codex.context_update_keys entry %q: expected <key>:<string|number|integer|boolean|array|object>", entry)
+		}
+		if name == "current_node" || strings.HasPrefix(name, "internal.") {
+			return nil, fmt.Errorf("invalid codex.context_update_keys entry %q: %s is reserved", entry, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate codex.context_update_keys key %q", name)
+		}
+		seen[name] = true
+		keys = append(keys, contextUpdateKey{Name: name, Type: typ})
+	}
+	return keys, nil
+}
+
+func nodeContextUpdateKeys(node *Node) ([]contextUpdateKey, error) {
+	return parseContextUpdateKeys(node.StringAttr("codex.context_update_keys", ""))
+}
+
+// contextUpdatesSchema returns the output schema for context_updates. Without
+// declared keys any JSON values are accepted and only the description asks for
+// small values. Declared keys become required properties and nothing else is
+// allowed.
+func contextUpdatesSchema(keys []contextUpdateKey) map[string]any {
+	if len(keys) == 0 {
+		return map[string]any{
+			"type":                 "object",
+			"description":          "Values to merge into the pipeline context. Keep them small and shallow.",
+			"additionalProperties": true,
+		}
+	}
+	props := map[string]any{}
+	required := []any{}
+	for _, k := range keys {
+		props[k.Name] = contextUpdateValueSchema(k.Type)
+		required = append(required, k.Name)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+func contextUpdateValueSchema(typ string) map[string]any {
+	switch typ {
+	case "array":
+		return map[string]any{"type": "array", "items": map[string]any{}}
+	case "object":
+		return map[string]any{"type": "object", "additionalProperties": true}
+	default:
+		return map[string]any{"type": typ}
+	}
+}
+
+// checkContextUpdates verifies an agent's context_updates against declared
+// keys: every key present with its declared type and no undeclared keys.
+func checkContextUpdates(updates map[string]any, keys []contextUpdateKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	problems := []string{}
+	declared := map[string]bool{}
+	for _, k := range keys {
+		declared[k.Name] = true
+		v, ok := updates[k.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s missing", k.Name))
+			continue
+		}
+		if !contextUpdateTypeMatches(k.Type, v) {
+			problems = append(problems, fmt.Sprintf("%s: expected %s, got %s", k.Name, k.Type, jsonValueType(v)))
+		}
+	}
+	extra := []string{}
+	for name := range updates {
+		if !declared[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		problems = append(problems, fmt.Sprintf("%s not declared", name))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("context_updates mismatch: %s", strings.Join(problems, "; "))
+}
+
+func contextUpdateTypeMatches(typ string, v any) bool {
+	got := jsonValueType(v)
+	if typ == "number" {
+		return got == "number" || got == "integer"
+	}
+	return got == typ
+}
+
+func jsonValueType(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if x == math.Trunc(x) {
+			return "integer"
+		}
+		return "number"
+	case float32:
+		return "number"
+	case int, int64, int32:
+		return "integer"
+	case []any, []string:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
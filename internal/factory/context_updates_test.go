@@ -0,0 +1,102 @@
+package attractor
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseContextUpdateKeys(t *testing.T) {
+	keys, err := parseContextUpdateKeys("coverage:number, summary:string,files:array")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || keys[0] != (contextUpdateKey{Name: "coverage", Type: "number"}) || keys[2].Type != "array" {
+		t.Fatalf("keys = %+v", keys)
+	}
+	for _, raw := range []string{"coverage", "coverage:float", ":string", "internal.x:string", "a:string,a:number"} {
+		if _, err := parseContextUpdateKeys(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
+
+func TestCodexOutputSchemaContextUpdates(t *testing.T) {
+	var open map[string]any
+	if err := json.Unmarshal([]byte(codexOutputSchema(false, nil)), &open); err != nil {
+		t.Fatal(err)
+	}
+	cu := open["properties"].(map[string]any)["context_updates"].(map[string]any)
+	if cu["additionalProperties"] != true {
+		t.Fatalf("context_updates must accept arbitrary values without declared keys: %v", cu)
+	}
+
+	var typed map[string]any
+	keys := []contextUpdateKey{{Name: "coverage", Type: "number"}, {Name: "summary", Type: "string"}}
+	if err := json.Unmarshal([]byte(codexOutputSchema(true, keys)), &typed); err != nil {
+		t.Fatal(err)
+	}
+	props := typed["properties"].(map[string]any)
+	cu = props["context_updates"].(map[string]any)
+	if cu["additionalProperties"] != false || len(cu["required"].([]any)) != 2 {
+		t.Fatalf("declared keys schema = %v", cu)
+	}
+	if cu["properties"].(map[string]any)["coverage"].(map[string]any)["type"] != "number" {
+		t.Fatalf("coverage schema = %v", cu["properties"])
+	}
+	if _, ok := props["delegate"]; !ok {
+		t.Fatal("delegate property dropped")
+	}
+}
+
+func TestCheckContextUpdates(t *testing.T) {
+	keys := []contextUpdateKey{{Name: "coverage", Type: "number"}, {Name: "count", Type: "integer"}, {Name: "summary", Type: "string"}}
+	if err := checkContextUpdates(map[string]any{"coverage": float64(80), "count": float64(3), "summary": "ok"}, keys); err != nil {
+		t.Fatal(err)
+	}
+	err := checkContextUpdates(map[string]any{"coverage": "high", "count": 1.5, "extra": true}, keys)
+	if err == nil {
+		t.Fatal("expected mismatch")
+	}
+	want := "context_updates mismatch: coverage: expected number, got string; count: expected integer, got number; summary missing; extra not declared"
+	if err.Error() != want {
+		t.Fatalf("err = %q\nwant  %q", err, want)
+	}
+}
+
+func TestDeclaredContextUpdateKeysFailStageOnMismatch(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, "agent.backend"="fake", "codex.context_update_keys"="coverage:number", "test.context_updates_json"="{\"coverage\":\"lots\"}"];
+	exit [shape=Msquare];
+	start -> a;
+	a -> exit [condition="outcome=success"];
+	a -> exit [condition="outcome=fail"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "cu1"}); err != nil {
+		t.Fatal(err)
+	}
+	st := readStatusJSON(t, filepath.Join(runsdir, "cu1", "a", "status.json"))
+	if st["outcome"] != "fail" || st["failure_reason"] != "context_updates mismatch: coverage: expected number, got string" {
+		t.Fatalf("status = %v", st)
+	}
+}
+
+func TestValidateContextUpdateKeys(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	graph ["codex.context_update_keys"="coverage:percent"];
+	start [shape=Mdiamond];
+	a [shape=box];
+	exit [shape=Msquare];
+	start -> a;
+	a -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, `invalid codex.context_update_keys entry "coverage:percent"`) {
+		t.Fatalf("diagnostics = %s", msgs)
+	}
+}
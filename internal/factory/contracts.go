@@ -0,0 +1,227 @@
+package attractor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextContract is a node's declared context dataflow: the keys it reads
+// (reads_context) and writes (writes_context plus codex.context_update_keys).
+type contextContract struct {
+	Reads  []string
+	Writes []string
+	Strict bool
+}
+
+// nodeContextContract returns the node's contract and whether it declares
+// one. Nodes without reads_context, writes_context, or contract_mode are not
+// checked.
+func nodeContextContract(node *Node) (contextContract, bool) {
+	declared := false
+	for _, attr := range []string{"reads_context", "writes_context", "contract_mode"} {
+		if _, ok := node.Attrs[attr]; ok {
+			declared = true
+		}
+	}
+	if !declared {
+		return contextContract{}, false
+	}
+	c := contextContract{
+		Reads:  uniqueNonEmpty(splitCSV(node.StringAttr("reads_context", ""))),
+		Writes: uniqueNonEmpty(splitCSV(node.StringAttr("writes_context", ""))),
+		Strict: strings.ToLower(strings.TrimSpace(node.StringAttr("contract_mode", "soft"))) == "strict",
+	}
+	if keys, err := nodeContextUpdateKeys(node); err == nil {
+		for _, k := range keys {
+			c.Writes = append(c.Writes, k.Name)
+		}
+	}
+	return c, true
+}
+
+func (c contextContract) mode() string {
+	if c.Strict {
+		return "strict"
+	}
+	return "soft"
+}
+
+func validateContractMode(n *Node) error {
+	raw, ok := n.Attrs["contract_mode"]
+	if !ok {
+		return nil
+	}
+	switch strings.ToLower(strings.TrimSpace(fmt.Sprintf("%v", raw))) {
+	case "soft", "strict":
+		return nil
+	}
+	return fmt.Errorf("unsupported contract_mode on node %s: %v (expected soft or strict)", n.ID, raw)
+}
+
+// contextKeyCovers reports whether a declared key covers key: the same key
+// or a dotted child of it.
+func contextKeyCovers(declared, key string) bool {
+	return key == declared || strings.HasPrefix(key, declared+".")
+}
+
+func keysCovered(declared []string, key string) bool {
+	for _, d := range declared {
+		if contextKeyCovers(d, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// engineContextKey reports whether the engine itself writes key, so no node
+// has to declare it.
+func engineContextKey(key string) bool {
+	for _, prefix := range []string{"graph.", "last_failure.", "loop.", "internal."} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return key == "outcome" || key == "current_node" || key == artifactsContextKey || strings.HasPrefix(key, artifactsContextKey+".")
+}
+
+// detectedContextReads lists the context keys a handler is known to read for
+// node: the verification plan key, a manager loop's done_when key, and the
+// failure feedback a codergen prompt is given when one is present.
+func detectedContextReads(node *Node, ctx Context) []string {
+	reads := []string{}
+	switch handlerType(node) {
+	case "verification":
+		reads = append(reads, strings.TrimSpace(node.StringAttr("verification.plan_context_key", "verification.plan")))
+	case "codergen":
+		if strings.TrimSpace(ctx.GetString("last_failure.summary", "")) != "" {
+			reads = append(reads, "last_failure.summary")
+		}
+	}
+	if isManagerLoopNode(node) {
+		if key, _, err := parseLoopDoneWhen(node.StringAttr("loop.done_when", "")); err == nil {
+			reads = append(reads, key)
+		}
+	}
+	return reads
+}
+
+// checkContractReads runs before a node executes. Detected reads the node
+// does not declare are reported. Declared reads missing from the context are
+// reported in soft mode and fail the node in strict mode; the returned bool
+// is true when the node must not run.
+func (e *Engine) checkContractReads(node *Node) (Outcome, bool) {
+	c, ok := nodeContextContract(node)
+	if !ok {
+		return Outcome{}, false
+	}
+	undeclared := []string{}
+	for _, key := range detectedContextReads(node, e.Context) {
+		if !keysCovered(c.Reads, key) {
+			undeclared = append(undeclared, key)
+		}
+	}
+	if len(undeclared) > 0 {
+		e.recordContractViolation(node, c, "undeclared_read", undeclared, "warned")
+	}
+	missing := []string{}
+	for _, key := range c.Reads {
+		if _, ok := e.Context.Get(key); !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return Outcome{}, false
+	}
+	if !c.Strict {
+		e.recordContractViolation(node, c, "missing_read", missing, "warned")
+		return Outcome{}, false
+	}
+	e.recordContractViolation(node, c, "missing_read", missing, "failed")
+	return Outcome{
+		SchemaVersion:    1,
+		Outcome:          "fail",
+		SuggestedNextIDs: []string{},
+		ContextUpdates:   map[string]any{},
+		FailureReason:    "context contract: missing declared reads: " + strings.Join(missing, ","),
+		FailureCode:      FailureContextContractMissingReads,
+	}, true
+}
+
+// checkContractWrites runs after a node executes. Context updates outside
+// writes_context are reported, and in strict mode removed from out.
+func (e *Engine) checkContractWrites(node *Node, out Outcome) Outcome {
+	c, ok := nodeContextContract(node)
+	if !ok {
+		return out
+	}
+	undeclared := []string{}
+	for _, key := range sortedKeys(out.ContextUpdates) {
+		if !keysCovered(c.Writes, key) {
+			undeclared = append(undeclared, key)
+		}
+	}
+	if len(undeclared) == 0 {
+		return out
+	}
+	if !c.Strict {
+		e.recordContractViolation(node, c, "undeclared_write", undeclared, "warned")
+		return out
+	}
+	kept := make(map[string]any, len(out.ContextUpdates))
+	for k, v := range out.ContextUpdates {
+		if keysCovered(c.Writes, k) {
+			kept[k] = v
+		}
+	}
+	out.ContextUpdates = kept
+	e.recordContractViolation(node, c, "undeclared_write", undeclared, "stripped")
+	return out
+}
+
+func (e *Engine) recordContractViolation(node *Node, c contextContract, kind string, keys []string, action string) {
+	_ = e.appendTrace("ContextContractViolation", map[string]any{
+		"node_id":       node.ID,
+		"level":         "WARNING",
+		"kind":          kind,
+		"keys":          keys,
+		"contract_mode": c.mode(),
+		"action":        action,
+	})
+	e.Logger.Warn("context contract violation", "node", node.ID, "kind", kind, "keys", strings.Join(keys, ","), "action", action)
+}
+
+// validateContextDataflow flags declared reads that no upstream node declares
+// writing and the engine does not provide.
+func validateContextDataflow(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	for _, id := range sortedKeys(g.Nodes) {
+		c, ok := nodeContextContract(g.Nodes[id])
+		if !ok || len(c.Reads) == 0 {
+			continue
+		}
+		upstream := []string{}
+		for anc := range graphAncestors(g, id) {
+			if ac, ok := nodeContextContract(g.Nodes[anc]); ok {
+				upstream = append(upstream, ac.Writes...)
+			}
+		}
+		for _, key := range c.Reads {
+			if engineContextKey(key) || keysCovered(upstream, key) || readCoversWrite(key, upstream) {
+				continue
+			}
+			d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s reads context key %s but no upstream node declares writing it", id, key)})
+		}
+	}
+	return d
+}
+
+// readCoversWrite reports whether an upstream write lands under a read key,
+// e.g. reading "verification" after a node writes "verification.plan".
+func readCoversWrite(key string, writes []string) bool {
+	for _, w := range writes {
+		if contextKeyCovers(key, w) {
+			return true
+		}
+	}
+	return false
+}
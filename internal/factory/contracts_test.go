@@ -0,0 +1,83 @@
+package attractor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateContextDataflow(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	plan [shape=box, writes_context="verification.plan_v2"];
+	verify [shape=box, type="verification", reads_context="verification.plan,last_failure.summary"];
+	report [shape=box, reads_context="verification.plan_v2", contract_mode="loose"];
+	exit [shape=Msquare];
+	start -> plan -> verify -> report -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{
+		"node verify reads context key verification.plan but no upstream node declares writing it",
+		"unsupported contract_mode on node report: loose",
+	} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+	if strings.Contains(msgs, "last_failure.summary") || strings.Contains(msgs, "key verification.plan_v2") {
+		t.Fatalf("provided keys flagged:\n%s", msgs)
+	}
+}
+
+func TestContextContractSoftModeWarns(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, reads_context="coverage", writes_context="summary", "test.context_updates_json"="{\"summary\":\"ok\",\"extra\":1}"];
+	exit [shape=Msquare];
+	start -> a -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "cc1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "cc1")
+	kinds := []string{}
+	for _, rec := range readJSONLRecords(t, filepath.Join(runDir, "trace.jsonl")) {
+		if rec["type"] == "ContextContractViolation" {
+			kinds = append(kinds, rec["kind"].(string)+":"+rec["action"].(string))
+		}
+	}
+	if strings.Join(kinds, ",") != "missing_read:warned,undeclared_write:warned" {
+		t.Fatalf("violations = %v", kinds)
+	}
+	st := readStatusJSON(t, filepath.Join(runDir, "a", "status.json"))
+	if st["context_updates"].(map[string]any)["extra"] == nil {
+		t.Fatalf("soft mode stripped a write: %v", st)
+	}
+}
+
+func TestContextContractStrictMode(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, contract_mode="strict", writes_context="summary", "test.context_updates_json"="{\"summary\":\"ok\",\"extra\":1}"];
+	b [shape=box, contract_mode="strict", reads_context="coverage"];
+	exit [shape=Msquare];
+	start -> a -> b -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "cc2"})
+	runDir := filepath.Join(runsdir, "cc2")
+	a := readStatusJSON(t, filepath.Join(runDir, "a", "status.json"))
+	if updates := a["context_updates"].(map[string]any); updates["extra"] != nil || updates["summary"] != "ok" {
+		t.Fatalf("strict writes = %v", updates)
+	}
+	b := readStatusJSON(t, filepath.Join(runDir, "b", "status.json"))
+	if b["outcome"] != "fail" || b["failure_reason"] != "context contract: missing declared reads: coverage" || b["failure_code"] != string(FailureContextContractMissingReads) {
+		t.Fatalf("b status = %v", b)
+	}
+}
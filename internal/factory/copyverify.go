@@ -0,0 +1,130 @@
+package attractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultCopyVerifyThresholdBytes = 64 << 20
+	defaultCopyVerifySampleFiles    = 64
+)
+
+// copiedFile is what the workspace copy observed for one source file.
+type copiedFile struct {
+	SourceSize int64
+	Hash       string
+}
+
+// copyWriteFile is swapped in tests to simulate a corrupting writer.
+var copyWriteFile = os.WriteFile
+
+type copyVerification struct {
+	Mode          string   `json:"mode"`
+	TotalFiles    int      `json:"total_files"`
+	VerifiedFiles int      `json:"verified_files"`
+	Mismatches    []string `json:"mismatches,omitempty"`
+}
+
+// copyVerifyMode resolves graph attr copy.verify to "off", "sample", or
+// "full". When unset, sampling is enabled for copies of at least
+// copy.verify_threshold_bytes.
+func copyVerifyMode(g *Graph, totalBytes int64) (string, error) {
+	raw, ok := g.Attrs["copy.verify"]
+	if !ok {
+		if totalBytes >= int64(graphIntAttr(g, "copy.verify_threshold_bytes", defaultCopyVerifyThresholdBytes)) {
+			return "sample", nil
+		}
+		return "off", nil
+	}
+	switch strings.ToLower(strings.TrimSpace(fmt.Sprintf("%v", raw))) {
+	case "true", "sample":
+		return "sample", nil
+	case "full":
+		return "full", nil
+	case "false", "off":
+		return "off", nil
+	default:
+		return "", fmt.Errorf("invalid copy.verify: %v (expected true, false, sample, or full)", raw)
+	}
+}
+
+func graphIntAttr(g *Graph, key string, def int) int {
+	raw, ok := g.Attrs[key]
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(fmt.Sprintf("%v", raw)))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// selectVerifySample picks up to n paths spread evenly over the sorted list so
+// the sample is deterministic across runs.
+func selectVerifySample(paths []string, n int) []string {
+	if n <= 0 || len(paths) <= n {
+		return paths
+	}
+	out := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, paths[i*len(paths)/n])
+	}
+	return out
+}
+
+// verifyWorkspaceCopy re-reads copied files from workspace and compares them
+// with what the copy read from the source. Files that verify cleanly are
+// returned as snapshot seed entries so the first pre-node snapshot does not
+// hash them again.
+func verifyWorkspaceCopy(workspace string, copied map[string]copiedFile, mode string, sampleFiles int) (copyVerification, map[string]fileState, error) {
+	paths := make([]string, 0, len(copied))
+	for p := range copied {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	res := copyVerification{Mode: mode, TotalFiles: len(paths)}
+	seed := map[string]fileState{}
+	if mode == "off" {
+		return res, seed, nil
+	}
+	if mode == "sample" {
+		paths = selectVerifySample(paths, sampleFiles)
+	}
+	for _, rel := range paths {
+		want := copied[rel]
+		target := filepath.Join(workspace, filepath.FromSlash(rel))
+		b, err := os.ReadFile(target)
+		if err != nil {
+			res.Mismatches = append(res.Mismatches, rel)
+			continue
+		}
+		h := sha256.Sum256(b)
+		hash := hex.EncodeToString(h[:])
+		res.VerifiedFiles++
+		if hash != want.Hash || int64(len(b)) != want.SourceSize {
+			res.Mismatches = append(res.Mismatches, rel)
+			continue
+		}
+		info, err := os.Lstat(target)
+		if err != nil {
+			return res, nil, err
+		}
+		seed[rel] = fileState{Size: info.Size(), Hash: hash, ModTime: info.ModTime(), Mode: info.Mode().Perm()}
+	}
+	return res, seed, nil
+}
+
+func (v copyVerification) err() error {
+	if len(v.Mismatches) == 0 {
+		return nil
+	}
+	return fmt.Errorf("workspace copy verification failed: %d mismatched file(s): %s", len(v.Mismatches), strings.Join(v.Mismatches, ", "))
+}
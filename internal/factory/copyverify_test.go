@@ -0,0 +1,117 @@
+package attractor
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withCopyWriteFile(t *testing.T, fn func(string, []byte, fs.FileMode) error) {
+	t.Helper()
+	orig := copyWriteFile
+	copyWriteFile = fn
+	t.Cleanup(func() { copyWriteFile = orig })
+}
+
+const copyVerifyDOT = `digraph G {
+	graph [%s];
+	start [shape=Mdiamond];
+	a [shape=box];
+	exit [shape=Msquare];
+	start -> a;
+	a -> exit;
+	}`
+
+func TestCopyVerifyFullDetectsCorruptedCopy(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	withCopyWriteFile(t, func(name string, b []byte, mode fs.FileMode) error {
+		if filepath.Base(name) == "broken.go" {
+			b = b[:len(b)/2]
+		}
+		return os.WriteFile(name, b, mode)
+	})
+	workdir, runsdir, pipeline := setupRun(t, strings.Replace(copyVerifyDOT, "%s", `"copy.verify"="full"`, 1))
+	writeFile(t, filepath.Join(workdir, "ok.go"), "package ok\n")
+	writeFile(t, filepath.Join(workdir, "pkg", "broken.go"), "package pkg\n\nfunc Broken() {}\n")
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"})
+	if err == nil || !strings.Contains(err.Error(), "1 mismatched file(s): pkg/broken.go") {
+		t.Fatalf("expected copy verification failure, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(runsdir, "r1", "a", "status.json")); !os.IsNotExist(err) {
+		t.Fatalf("no node should run after failed copy verification: %v", err)
+	}
+}
+
+func TestCopyVerifyAutoSamplesAboveThreshold(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, strings.Replace(copyVerifyDOT, "%s", `"copy.verify_threshold_bytes"=1, "copy.verify_sample_files"=2`, 1))
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		writeFile(t, filepath.Join(workdir, name), name+"\n")
+	}
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(runsdir, "r1", "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		CopyVerification *copyVerification `json:"copy_verification"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.CopyVerification == nil || m.CopyVerification.Mode != "sample" || m.CopyVerification.VerifiedFiles != 2 || m.CopyVerification.TotalFiles != 4 {
+		t.Fatalf("unexpected copy verification: %+v", m.CopyVerification)
+	}
+}
+
+func TestCopyVerifyModeDefaultsOffBelowThreshold(t *testing.T) {
+	g := NewGraph()
+	if mode, err := copyVerifyMode(g, 10); err != nil || mode != "off" {
+		t.Fatalf("expected off, got %q %v", mode, err)
+	}
+	g.Attrs["copy.verify"] = "bogus"
+	if _, err := copyVerifyMode(g, 0); err == nil {
+		t.Fatal("expected invalid copy.verify error")
+	}
+}
+
+func TestSnapshotSeedReusesUnchangedHashes(t *testing.T) {
+	ws := t.TempDir()
+	writeFile(t, filepath.Join(ws, "same.txt"), "same\n")
+	writeFile(t, filepath.Join(ws, "changed.txt"), "old\n")
+	info, err := os.Lstat(filepath.Join(ws, "same.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changedInfo, err := os.Lstat(filepath.Join(ws, "changed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := map[string]fileState{
+		"same.txt":    {Size: info.Size(), Hash: "seeded", ModTime: info.ModTime(), Mode: info.Mode().Perm()},
+		"changed.txt": {Size: changedInfo.Size(), Hash: "seeded", ModTime: changedInfo.ModTime().Add(-time.Hour), Mode: changedInfo.Mode().Perm()},
+	}
+	snap, err := snapshotWorkspaceSeeded(ws, -1, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap["same.txt"].Hash != "seeded" {
+		t.Fatalf("expected seeded hash reuse, got %+v", snap["same.txt"])
+	}
+	if snap["changed.txt"].Hash == "seeded" {
+		t.Fatal("expected rehash for file with different mtime")
+	}
+	retained, err := snapshotWorkspaceSeeded(ws, 1<<20, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !retained["same.txt"].Retained || retained["same.txt"].Hash == "seeded" {
+		t.Fatal("seed must not be used when content must be retained")
+	}
+}
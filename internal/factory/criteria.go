@@ -0,0 +1,132 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// contextCriterion is one `<key><op><value>` comparison against run context,
+// e.g. `tests_passing=true` or `coverage>=80`. Ordered operators compare
+// numbers; = and != compare numbers numerically and anything else as text.
+type contextCriterion struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+// criterionOps is ordered so two-character operators match before their
+// one-character prefixes.
+var criterionOps = []string{">=", "<=", "!=", "=", ">", "<"}
+
+// parseContextCriteria parses a comma-separated list of criteria.
+func parseContextCriteria(raw string) ([]contextCriterion, error) {
+	out := []contextCriterion{}
+	for _, part := range splitCSV(raw) {
+		c, err := parseContextCriterion(part)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func parseContextCriterion(raw string) (contextCriterion, error) {
+	at, op := -1, ""
+	for i := 0; i < len(raw) && at < 0; i++ {
+		for _, candidate := range criterionOps {
+			if strings.HasPrefix(raw[i:], candidate) {
+				at, op = i, candidate
+				break
+			}
+		}
+	}
+	if at < 0 {
+		return contextCriterion{}, fmt.Errorf("invalid criterion %q: expected <key><op><value> with op one of = != > >= < <=", raw)
+	}
+	c := contextCriterion{Key: strings.TrimSpace(raw[:at]), Op: op, Value: strings.TrimSpace(raw[at+len(op):])}
+	if c.Key == "" {
+		return contextCriterion{}, fmt.Errorf("invalid criterion %q: missing context key", raw)
+	}
+	if op != "=" && op != "!=" {
+		if _, err := strconv.ParseFloat(c.Value, 64); err != nil {
+			return contextCriterion{}, fmt.Errorf("invalid criterion %q: %s needs a numeric value", raw, op)
+		}
+	}
+	return c, nil
+}
+
+func (c contextCriterion) String() string {
+	return c.Key + c.Op + c.Value
+}
+
+// eval reports whether ctx satisfies c, and the context value it compared
+// ("<missing>" when the key is unset).
+func (c contextCriterion) eval(ctx Context) (bool, string) {
+	raw, ok := ctx.Get(c.Key)
+	if !ok {
+		return false, "<missing>"
+	}
+	got := fmt.Sprintf("%v", raw)
+	gotNum, gotErr := strconv.ParseFloat(strings.TrimSpace(got), 64)
+	wantNum, wantErr := strconv.ParseFloat(c.Value, 64)
+	numeric := gotErr == nil && wantErr == nil
+	switch c.Op {
+	case "=":
+		return got == c.Value || (numeric && gotNum == wantNum), got
+	case "!=":
+		return !(got == c.Value || (numeric && gotNum == wantNum)), got
+	}
+	if !numeric {
+		return false, got
+	}
+	switch c.Op {
+	case ">":
+		return gotNum > wantNum, got
+	case ">=":
+		return gotNum >= wantNum, got
+	case "<":
+		return gotNum < wantNum, got
+	default:
+		return gotNum <= wantNum, got
+	}
+}
+
+// unmetCriteria describes each criterion ctx does not satisfy as
+// `<criterion> (got <value>)`.
+func unmetCriteria(criteria []contextCriterion, ctx Context) []string {
+	unmet := []string{}
+	for _, c := range criteria {
+		if ok, got := c.eval(ctx); !ok {
+			unmet = append(unmet, fmt.Sprintf("%s (got %s)", c, got))
+		}
+	}
+	return unmet
+}
+
+// ErrExitCriteriaNotMet is returned by RunPipeline when the run reaches an
+// exit node whose require_context criteria do not hold.
+var ErrExitCriteriaNotMet = errors.New("exit criteria not met")
+
+// exitCriteriaError wraps ErrExitCriteriaNotMet with the exit node and the
+// unmet criteria from its failure_reason.
+func exitCriteriaError(nodeID, reason string) error {
+	detail := strings.TrimPrefix(reason, ErrExitCriteriaNotMet.Error()+": ")
+	return fmt.Errorf("exit node %s: %w: %s", nodeID, ErrExitCriteriaNotMet, detail)
+}
+
+func validateExitCriteria(g *Graph, n *Node) []Diagnostic {
+	raw, ok := n.Attrs["require_context"]
+	if !ok {
+		return nil
+	}
+	if !isExit(g, n.ID) {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets require_context but is not an exit node", n.ID)}}
+	}
+	if _, err := parseContextCriteria(fmt.Sprintf("%v", raw)); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("exit node %s require_context: %v", n.ID, err)}}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package attractor
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContextCriteriaEval(t *testing.T) {
+	ctx := Context{"tests_passing": true, "coverage": 82.5, "mode": "release", "lint.errors": 0}
+	cases := map[string]bool{
+		"tests_passing=true":  true,
+		"coverage>=80":        true,
+		"coverage>82.5":       false,
+		"coverage<=82.5":      true,
+		"coverage<90":         true,
+		"coverage=82.50":      true,
+		"mode!=debug":         true,
+		"mode=debug":          false,
+		"lint.errors=0":       true,
+		"missing_key=true":    false,
+		"mode>=1":             false,
+		"tests_passing!=true": false,
+	}
+	for raw, want := range cases {
+		c, err := parseContextCriterion(raw)
+		if err != nil {
+			t.Fatalf("parse %q: %v", raw, err)
+		}
+		if got, _ := c.eval(ctx); got != want {
+			t.Fatalf("%q = %v, want %v", raw, got, want)
+		}
+	}
+	criteria, err := parseContextCriteria("tests_passing=true, coverage>=90, missing_key=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(unmetCriteria(criteria, ctx), "; ")
+	if got != "coverage>=90 (got 82.5); missing_key=1 (got <missing>)" {
+		t.Fatalf("unmet = %q", got)
+	}
+	for raw, want := range map[string]string{
+		"coverage":     "expected <key><op><value>",
+		"=true":        "missing context key",
+		"coverage>=hi": ">= needs a numeric value",
+	} {
+		if _, err := parseContextCriterion(raw); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("parse %q err = %v, want %q", raw, err, want)
+		}
+	}
+}
+
+func TestValidateExitCriteria(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="true", require_context="x=1"];
+	exit [shape=Msquare, require_context="tests_passing=true,coverage>=high"];
+	start -> a -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{"node a sets require_context but is not an exit node", "exit node exit require_context: invalid criterion \"coverage>=high\""} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+}
+
+func TestExitCriteriaFailRun(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=box, prompt="build", "test.context_updates_json"="{\"tests_passing\":true,\"coverage\":72}"];
+	exit [shape=Msquare, require_context="tests_passing=true,coverage>=80"];
+	start -> build -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ec1"})
+	if !errors.Is(err, ErrExitCriteriaNotMet) || !strings.Contains(err.Error(), "coverage>=80 (got 72)") {
+		t.Fatalf("err = %v", err)
+	}
+	runDir := filepath.Join(runsdir, "ec1")
+	st := readStatusJSON(t, filepath.Join(runDir, "exit", "status.json"))
+	if st["outcome"] != "fail" || st["failure_code"] != string(FailureExitCriteriaNotMet) {
+		t.Fatalf("exit status = %v", st)
+	}
+	res := readStatusJSON(t, filepath.Join(runDir, runResultFile))
+	unmet, _ := res["unmet_criteria"].([]any)
+	if res["status"] != "failed_at_exit" || res["exit_node"] != "exit" || len(unmet) != 1 || unmet[0] != "coverage>=80 (got 72)" {
+		t.Fatalf("run result = %v", res)
+	}
+	if len(eventsOfType(t, runDir, "PipelineFailed")) != 1 || len(eventsOfType(t, runDir, "PipelineCompleted")) != 0 {
+		t.Fatal("expected a single PipelineFailed event")
+	}
+
+	err = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ec1", Resume: true})
+	if !errors.Is(err, ErrExitCriteriaNotMet) {
+		t.Fatalf("resume err = %v", err)
+	}
+}
+
+func TestExitCriteriaMetCompletesRun(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=box, prompt="build", "test.context_updates_json"="{\"tests_passing\":true,\"coverage\":91}"];
+	exit [shape=Msquare, require_context="tests_passing=true,coverage>=80"];
+	start -> build -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ec2"}); err != nil {
+		t.Fatal(err)
+	}
+	res := readStatusJSON(t, filepath.Join(runsdir, "ec2", runResultFile))
+	if res["status"] != "completed" || res["exit_node"] != nil {
+		t.Fatalf("run result = %v", res)
+	}
+}
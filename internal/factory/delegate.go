@@ -0,0 +1,301 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultDelegateMaxTokens = 2000
+
+// DelegateRequest is a bounded helper task the primary agent asks the engine
+// to run on its behalf before it is re-invoked for the same node.
+type DelegateRequest struct {
+	Task      string   `json:"task"`
+	MaxTokens int      `json:"max_tokens"`
+	ReadPaths []string `json:"read_paths"`
+}
+
+type delegateRound struct {
+	SchemaVersion   int      `json:"schema_version"`
+	Round           int      `json:"round"`
+	Task            string   `json:"task"`
+	ReadPaths       []string `json:"read_paths"`
+	MaxTokens       int      `json:"max_tokens"`
+	Answer          string   `json:"-"`
+	AnswerChars     int      `json:"answer_chars"`
+	EstimatedTokens int      `json:"estimated_tokens"`
+	Truncated       bool     `json:"truncated"`
+	DurationMS      int64    `json:"duration_ms"`
+	FailureReason   string   `json:"failure_reason,omitempty"`
+}
+
+func delegateMaxRounds(node *Node) int {
+	return node.IntAttr("delegate.max_rounds", 0)
+}
+
+func validateDelegateAttrs(n *Node) error {
+	if _, ok := n.Attrs["delegate.max_rounds"]; !ok {
+		return nil
+	}
+	if !isCodergenNode(n) {
+		return fmt.Errorf("delegate.max_rounds is only supported on codergen nodes: %s", n.ID)
+	}
+	if delegateMaxRounds(n) < 0 || n.IntAttr("delegate.max_tokens", defaultDelegateMaxTokens) <= 0 {
+		return fmt.Errorf("delegate.max_rounds must be >= 0 and delegate.max_tokens positive on node %s", n.ID)
+	}
+	return nil
+}
+
+func delegateTokenLimit(node *Node, requested int) int {
+	limit := node.IntAttr("delegate.max_tokens", defaultDelegateMaxTokens)
+	if requested <= 0 || requested > limit {
+		return limit
+	}
+	return requested
+}
+
+// runAgentWithDelegation invokes the primary agent and services its delegate
+// requests, re-invoking it with the accumulated answers appended to the prompt
+// until it returns an outcome or delegate.max_rounds is exhausted. Each round is
+// recorded under nodeDir/delegate/round-<n>.
+func runAgentWithDelegation(node *Node, agent Agent, delegate func() (Agent, error), req AgentRequest) (AgentResponse, error) {
+	maxRounds := delegateMaxRounds(node)
+	basePrompt := req.Prompt
+	rounds := []delegateRound{}
+	for round := 0; ; round++ {
+		req.Round = round
+		resp, err := agent.Run(req)
+		if err != nil {
+			return AgentResponse{}, err
+		}
+		if resp.Delegate == nil {
+			if len(rounds) > 0 {
+				if resp.ContextUpdates == nil {
+					resp.ContextUpdates = map[string]any{}
+				}
+				resp.ContextUpdates["delegate."+node.ID+".rounds"] = len(rounds)
+			}
+			return resp, nil
+		}
+		if maxRounds <= 0 {
+			return delegateFailure("delegate_not_enabled: set delegate.max_rounds on node " + node.ID), nil
+		}
+		if round >= maxRounds {
+			return delegateFailure(fmt.Sprintf("delegate_max_rounds_exceeded: %d", maxRounds)), nil
+		}
+		roundDir := filepath.Join(req.NodeDir, "delegate", fmt.Sprintf("round-%d", round+1))
+		if err := os.MkdirAll(roundDir, 0o755); err != nil {
+			return AgentResponse{}, err
+		}
+		copyIfExists(filepath.Join(req.NodeDir, "prompt.md"), filepath.Join(roundDir, "primary.prompt.md"))
+		copyIfExists(filepath.Join(req.NodeDir, "response.md"), filepath.Join(roundDir, "primary.response.md"))
+		rec, err := runDelegateRound(node, round+1, *resp.Delegate, delegate, req, roundDir)
+		if err != nil {
+			return AgentResponse{}, err
+		}
+		if rec.FailureReason != "" {
+			return delegateFailure(rec.FailureReason), nil
+		}
+		rounds = append(rounds, rec)
+		req.Prompt = appendDelegateAnswers(basePrompt, rounds)
+		if err := os.WriteFile(filepath.Join(req.NodeDir, "prompt.md"), []byte(req.Prompt+"\n"), 0o644); err != nil {
+			return AgentResponse{}, err
+		}
+	}
+}
+
+func runDelegateRound(node *Node, round int, d DelegateRequest, resolve func() (Agent, error), primary AgentRequest, roundDir string) (delegateRound, error) {
+	rec := delegateRound{SchemaVersion: 1, Round: round, Task: strings.TrimSpace(d.Task), ReadPaths: []string{}, MaxTokens: delegateTokenLimit(node, d.MaxTokens)}
+	finish := func(started time.Time) (delegateRound, error) {
+		rec.DurationMS = time.Since(started).Milliseconds()
+		return rec, writeJSON(filepath.Join(roundDir, "delegate.round.json"), rec)
+	}
+	started := time.Now()
+	if rec.Task == "" {
+		rec.FailureReason = "delegate_invalid_request: empty task"
+		return finish(started)
+	}
+	paths, err := validateRelativePaths(d.ReadPaths)
+	if err != nil {
+		rec.FailureReason = "delegate_invalid_request: " + err.Error()
+		return finish(started)
+	}
+	rec.ReadPaths = paths
+	prompt := buildDelegatePrompt(rec)
+	if err := os.WriteFile(filepath.Join(roundDir, "prompt.md"), []byte(prompt+"\n"), 0o644); err != nil {
+		return rec, err
+	}
+	agent, err := resolve()
+	if err != nil {
+		return rec, err
+	}
+	before, err := snapshotWorkspace(primary.Workspace)
+	if err != nil {
+		return rec, err
+	}
+	resp, err := agent.Run(AgentRequest{Prompt: prompt, NodeID: primary.NodeID, NodeDir: roundDir, Workspace: primary.Workspace, Logger: primary.Logger})
+	if err != nil {
+		rec.FailureReason = "delegate_failed: " + err.Error()
+		return finish(started)
+	}
+	after, err := snapshotWorkspace(primary.Workspace)
+	if err != nil {
+		return rec, err
+	}
+	if diff := computeDiff(before, after); len(diff.Created)+len(diff.Modified)+len(diff.Deleted) > 0 {
+		changed := append(append(append([]string{}, diff.Created...), diff.Modified...), diff.Deleted...)
+		rec.FailureReason = "delegate_modified_workspace: " + strings.Join(changed, ",")
+		return finish(started)
+	}
+	rec.Answer, rec.Truncated = truncateToTokens(strings.TrimSpace(resp.Notes), rec.MaxTokens)
+	rec.AnswerChars = len(rec.Answer)
+	rec.EstimatedTokens = estimateTokens(rec.Answer)
+	if err := os.WriteFile(filepath.Join(roundDir, "answer.md"), []byte(rec.Answer+"\n"), 0o644); err != nil {
+		return rec, err
+	}
+	return finish(started)
+}
+
+func buildDelegatePrompt(rec delegateRound) string {
+	var b strings.Builder
+	b.WriteString("You are a helper answering one bounded sub-task for another agent. Do not modify any files.\n\n")
+	b.WriteString("Task:\n")
+	b.WriteString(rec.Task)
+	b.WriteString("\n")
+	if len(rec.ReadPaths) > 0 {
+		b.WriteString("\nYou may read only these workspace paths:\n")
+		for _, p := range rec.ReadPaths {
+			b.WriteString("- ")
+			b.WriteString(p)
+			b.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&b, "\nPut your answer in `notes`, at most %d tokens.", rec.MaxTokens)
+	return b.String()
+}
+
+func appendDelegateAnswers(prompt string, rounds []delegateRound) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(prompt, "\n"))
+	b.WriteString("\n\nDelegate results (answers to your earlier delegate requests):\n")
+	for _, r := range rounds {
+		fmt.Fprintf(&b, "\n### Round %d: %s\n%s\n", r.Round, r.Task, r.Answer)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func delegateFailure(reason string) AgentResponse {
+	return AgentResponse{Outcome: "fail", FailureReason: reason, ContextUpdates: map[string]any{}}
+}
+
+// estimateTokens approximates token usage at four characters per token.
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// truncateToTokens cuts s to the estimated byte budget for maxTokens,
+// backing up to a rune boundary so the answer stays valid UTF-8.
+func truncateToTokens(s string, maxTokens int) (string, bool) {
+	limit := maxTokens * 4
+	if maxTokens <= 0 || len(s) <= limit {
+		return s, false
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit], true
+}
+
+func copyIfExists(src, dst string) {
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(dst, b, 0o644)
+}
+
+// resolveDelegateAgent builds the helper agent from delegate.backend and
+// delegate.model. Delegates run read-only and cannot delegate further.
+func resolveDelegateAgent(node *Node, workspace string) (Agent, error) {
+	attrs := map[string]Value{}
+	for k, v := range node.Attrs {
+		if strings.HasPrefix(k, "delegate.") {
+			continue
+		}
+		attrs[k] = v
+	}
+	if backend := strings.TrimSpace(node.StringAttr("delegate.backend", "")); backend != "" {
+		attrs["agent.backend"] = backend
+	}
+	if model := strings.TrimSpace(node.StringAttr("delegate.model", "")); model != "" {
+		attrs["codex.model"] = model
+	}
+	attrs["codex.sandbox"] = "read-only"
+	agent, err := ResolveAgent(&Node{ID: node.ID, Attrs: attrs}, workspace)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := agent.(fakeAgent); ok {
+		return fakeDelegateAgent{node: node}, nil
+	}
+	return agent, nil
+}
+
+func codexOutputSchema(allowDelegate bool, contextKeys []contextUpdateKey) string {
+	if !allowDelegate && len(contextKeys) == 0 {
+		return codexOutcomeSchema
+	}
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(codexOutcomeSchema), &schema); err != nil {
+		return codexOutcomeSchema
+	}
+	props := schema["properties"].(map[string]any)
+	props["context_updates"] = contextUpdatesSchema(contextKeys)
+	if !allowDelegate {
+		b, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return codexOutcomeSchema
+		}
+		return string(b)
+	}
+	props["delegate"] = map[string]any{
+		"anyOf": []any{
+			map[string]any{"type": "null"},
+			map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"required":             []any{"task", "max_tokens", "read_paths"},
+				"properties": map[string]any{
+					"task":       map[string]any{"type": "string"},
+					"max_tokens": map[string]any{"type": "integer"},
+					"read_paths": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				},
+			},
+		},
+	}
+	schema["required"] = append(schema["required"].([]any), "delegate")
+	b, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return codexOutcomeSchema
+	}
+	return string(b)
+}
+
+func injectDelegatePrompt(prompt string, node *Node) string {
+	rounds := delegateMaxRounds(node)
+	if rounds <= 0 {
+		return prompt
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(prompt, "\n"))
+	b.WriteString("\n\nDelegation (optional):\n")
+	fmt.Fprintf(&b, "- Set `delegate` to {task, max_tokens, read_paths} to have a helper answer a bounded read-only sub-task (for example summarizing a large log); you will be re-invoked with its answer.\n")
+	fmt.Fprintf(&b, "- At most %d delegate rounds and %d tokens per answer; read_paths must be workspace-relative.\n", rounds, delegateTokenLimit(node, 0))
+	b.WriteString("- Leave `delegate` null when returning your final outcome.")
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDelegateRoundsReinvokePrimaryWithAnswers(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, prompt="do work", "delegate.max_rounds"=2, "test.delegate_answer"="endpoint table", "test.delegate_requests_json"="[{\"task\":\"summarize log\",\"max_tokens\":50,\"read_paths\":[\"logs/\"]},{\"task\":\"list endpoints\"}]"];
+	exit [shape=Msquare];
+	start -> a;
+	a -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	nodeDir := filepath.Join(runsdir, "r1", "a")
+	if st := readStatusJSON(t, filepath.Join(nodeDir, "status.json")); st["outcome"] != "success" {
+		t.Fatalf("expected success, got %+v", st)
+	}
+	for _, round := range []string{"round-1", "round-2"} {
+		for _, name := range []string{"primary.prompt.md", "primary.response.md", "prompt.md", "answer.md", "delegate.round.json"} {
+			if _, err := os.Stat(filepath.Join(nodeDir, "delegate", round, name)); err != nil {
+				t.Fatalf("missing %s/%s: %v", round, name, err)
+			}
+		}
+	}
+	prompt, err := os.ReadFile(filepath.Join(nodeDir, "prompt.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(prompt), "### Round 1: summarize log") || !strings.Contains(string(prompt), "### Round 2: list endpoints") {
+		t.Fatalf("final prompt missing delegate answers:\n%s", prompt)
+	}
+	delegatePrompt, err := os.ReadFile(filepath.Join(nodeDir, "delegate", "round-1", "prompt.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(delegatePrompt), "- logs/") || !strings.Contains(string(delegatePrompt), "at most 50 tokens") {
+		t.Fatalf("unexpected delegate prompt:\n%s", delegatePrompt)
+	}
+}
+
+func TestDelegateRoundsAreBounded(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, "delegate.max_rounds"=1, "test.delegate_requests_json"="[{\"task\":\"one\"},{\"task\":\"two\"}]"];
+	exit [shape=Msquare];
+	start -> a;
+	a -> exit [condition="outcome=success"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"})
+	st := readStatusJSON(t, filepath.Join(runsdir, "r1", "a", "status.json"))
+	if st["outcome"] != "fail" || !strings.Contains(st["failure_reason"].(string), "delegate_max_rounds_exceeded") {
+		t.Fatalf("expected bounded failure, got %+v", st)
+	}
+}
+
+func TestDelegateMustNotModifyWorkspace(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, "delegate.max_rounds"=1, "test.delegate_write_path"="sneaky.txt", "test.delegate_requests_json"="[{\"task\":\"summarize\"}]"];
+	exit [shape=Msquare];
+	start -> a;
+	a -> exit [condition="outcome=success"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"})
+	st := readStatusJSON(t, filepath.Join(runsdir, "r1", "a", "status.json"))
+	if st["outcome"] != "fail" || !strings.Contains(st["failure_reason"].(string), "delegate_modified_workspace: sneaky.txt") {
+		t.Fatalf("expected delegate guardrail failure, got %+v", st)
+	}
+}
+
+func TestDelegateRequestWithoutMaxRoundsFails(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, "test.delegate_requests_json"="[{\"task\":\"summarize\"}]"];
+	exit [shape=Msquare];
+	start -> a;
+	a -> exit [condition="outcome=success"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"})
+	st := readStatusJSON(t, filepath.Join(runsdir, "r1", "a", "status.json"))
+	if !strings.HasPrefix(st["failure_reason"].(string), "delegate_not_enabled") {
+		t.Fatalf("expected delegate_not_enabled, got %+v", st)
+	}
+}
+
+func TestCodexOutputSchemaAddsDelegateOnlyWhenAllowed(t *testing.T) {
+	if strings.Contains(codexOutputSchema(false, nil), "delegate") {
+		t.Fatal("delegate must not appear in default schema")
+	}
+	s := codexOutputSchema(true, nil)
+	if !strings.Contains(s, `"delegate"`) || !strings.Contains(s, `"read_paths"`) {
+		t.Fatalf("delegate schema missing:\n%s", s)
+	}
+}
+
+func TestTruncateToTokensKeepsRuneBoundary(t *testing.T) {
+	got, truncated := truncateToTokens("abc日本語", 1)
+	if !truncated || got != "abc" || !utf8.ValidString(got) {
+		t.Fatalf("truncateToTokens = %q, %v", got, truncated)
+	}
+	if got, truncated := truncateToTokens("abcdefgh", 1); !truncated || got != "abcd" {
+		t.Fatalf("truncateToTokens = %q, %v", got, truncated)
+	}
+}
@@ -0,0 +1,232 @@
+package attractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const deliverablesDirName = "deliverables"
+
+type deliverableFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// deliverablesRecord is stored in manifest.json under "deliverables".
+type deliverablesRecord struct {
+	Paths      []string          `json:"paths"`
+	Files      []deliverableFile `json:"files"`
+	TotalBytes int64             `json:"total_bytes"`
+	Missing    []string          `json:"missing,omitempty"`
+}
+
+func parseDeliverablePaths(n *Node) ([]string, error) {
+	raw := splitCSV(n.StringAttr("deliverable_paths", ""))
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	paths, err := validateRelativePaths(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deliverable_paths on node %s: %w", n.ID, err)
+	}
+	return paths, nil
+}
+
+// graphDeliverablePaths returns the sorted union of deliverable_paths across
+// all nodes.
+func graphDeliverablePaths(g *Graph) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, n := range g.Nodes {
+		paths, _ := parseDeliverablePaths(n)
+		for _, p := range paths {
+			if !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// validateDeliverables rejects malformed deliverable paths and warns when no
+// node declares writes (allowed_write_paths) overlapping a deliverable.
+func validateDeliverables(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	for _, n := range g.Nodes {
+		if _, err := parseDeliverablePaths(n); err != nil {
+			d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
+		}
+	}
+	declared := []string{}
+	for _, n := range g.Nodes {
+		if !isExecutableNode(n) {
+			continue
+		}
+		allowed, err := ParseAllowedWritePaths(n)
+		if err != nil {
+			continue
+		}
+		declared = append(declared, allowed...)
+	}
+	for _, p := range graphDeliverablePaths(g) {
+		written := false
+		for _, a := range declared {
+			if pathsOverlap(p, a) {
+				written = true
+				break
+			}
+		}
+		if !written {
+			d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("deliverable path %s is not covered by any node's allowed_write_paths", p)})
+		}
+	}
+	return d
+}
+
+func pathsOverlap(a, b string) bool {
+	a = strings.TrimSuffix(filepath.ToSlash(a), "/")
+	b = strings.TrimSuffix(filepath.ToSlash(b), "/")
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// collectDeliverables copies deliverable paths from the workspace into
+// <runDir>/deliverables and returns their record. Missing paths are reported,
+// not fatal.
+func collectDeliverables(g *Graph, runDir, workspace string) (deliverablesRecord, error) {
+	rec := deliverablesRecord{Paths: graphDeliverablePaths(g), Files: []deliverableFile{}}
+	if len(rec.Paths) == 0 {
+		return rec, nil
+	}
+	dst := filepath.Join(runDir, deliverablesDirName)
+	if err := os.RemoveAll(dst); err != nil {
+		return rec, err
+	}
+	seen := map[string]bool{}
+	for _, p := range rec.Paths {
+		root := filepath.Join(workspace, filepath.FromSlash(strings.TrimSuffix(p, "/")))
+		if _, err := os.Lstat(root); errors.Is(err, os.ErrNotExist) {
+			rec.Missing = append(rec.Missing, p)
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(workspace, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if seen[rel] {
+				return nil
+			}
+			seen[rel] = true
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			target := filepath.Join(dst, filepath.FromSlash(rel))
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(target, b, info.Mode().Perm()); err != nil {
+				return err
+			}
+			h := sha256.Sum256(b)
+			rec.Files = append(rec.Files, deliverableFile{Path: rel, Size: int64(len(b)), SHA256: hex.EncodeToString(h[:])})
+			rec.TotalBytes += int64(len(b))
+			return nil
+		})
+		if err != nil {
+			return rec, err
+		}
+	}
+	sort.Slice(rec.Files, func(i, j int) bool { return rec.Files[i].Path < rec.Files[j].Path })
+	return rec, nil
+}
+
+func updateManifest(runDir, key string, value any) error {
+	path := filepath.Join(runDir, "manifest.json")
+	m := map[string]any{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	m[key] = value
+	return writeJSON(path, m)
+}
+
+func readDeliverables(runDir string) (deliverablesRecord, error) {
+	var m struct {
+		Deliverables *deliverablesRecord `json:"deliverables"`
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		return deliverablesRecord{}, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return deliverablesRecord{}, fmt.Errorf("invalid manifest in %s: %w", runDir, err)
+	}
+	if m.Deliverables == nil {
+		return deliverablesRecord{}, fmt.Errorf("run %s has no deliverables (did it complete with deliverable_paths set?)", filepath.Base(runDir))
+	}
+	return *m.Deliverables, nil
+}
+
+// ExtractDeliverables copies a completed run's deliverables into outDir,
+// checking each file against the hash recorded in the manifest.
+func ExtractDeliverables(runDir, outDir string) ([]string, error) {
+	if err := checkRunLayout(runDir); err != nil {
+		return nil, err
+	}
+	rec, err := readDeliverables(runDir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(rec.Files))
+	for _, f := range rec.Files {
+		src := filepath.Join(runDir, deliverablesDirName, filepath.FromSlash(f.Path))
+		b, err := os.ReadFile(src)
+		if err != nil {
+			return out, err
+		}
+		h := sha256.Sum256(b)
+		if hex.EncodeToString(h[:]) != f.SHA256 {
+			return out, fmt.Errorf("deliverable %s does not match recorded hash", f.Path)
+		}
+		info, err := os.Stat(src)
+		if err != nil {
+			return out, err
+		}
+		target := filepath.Join(outDir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return out, err
+		}
+		if err := os.WriteFile(target, b, info.Mode().Perm()); err != nil {
+			return out, err
+		}
+		out = append(out, f.Path)
+	}
+	return out, nil
+}
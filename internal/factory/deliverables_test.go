@@ -0,0 +1,124 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeliverablesCollectedAndExtracted(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=parallelogram, tool_command="mkdir -p agent/cmd && printf 'package main\n' > agent/cmd/main.go && printf 'ok\n' > report.md && printf 'scratch\n' > notes.txt", allowed_write_paths="agent/,report.md,notes.txt"];
+	exit [shape=Msquare, deliverable_paths="agent/,report.md,missing.txt"];
+	start -> build;
+	build -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "r1")
+	rec, err := readDeliverables(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Files) != 2 || rec.Files[0].Path != "agent/cmd/main.go" || rec.Files[1].Path != "report.md" {
+		t.Fatalf("unexpected deliverable files: %+v", rec.Files)
+	}
+	if rec.TotalBytes != int64(len("package main\n")+len("ok\n")) {
+		t.Fatalf("unexpected total bytes: %d", rec.TotalBytes)
+	}
+	if strings.Join(rec.Missing, ",") != "missing.txt" {
+		t.Fatalf("expected missing.txt reported, got %v", rec.Missing)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "deliverables", "notes.txt")); !os.IsNotExist(err) {
+		t.Fatal("non-deliverable file must not be copied")
+	}
+	records := readJSONLRecords(t, filepath.Join(runDir, "events.jsonl"))
+	last := records[len(records)-1]
+	if last["type"] != "PipelineCompleted" || last["deliverable_files"] != float64(2) {
+		t.Fatalf("expected deliverable summary on PipelineCompleted, got %+v", last)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	files, err := ExtractDeliverables(runDir, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("unexpected extracted files: %v", files)
+	}
+	b, err := os.ReadFile(filepath.Join(out, "agent", "cmd", "main.go"))
+	if err != nil || string(b) != "package main\n" {
+		t.Fatalf("unexpected extracted content %q: %v", b, err)
+	}
+
+	writeFile(t, filepath.Join(runDir, "deliverables", "report.md"), "tampered\n")
+	if _, err := ExtractDeliverables(runDir, t.TempDir()); err == nil || !strings.Contains(err.Error(), "report.md") {
+		t.Fatalf("expected hash mismatch error, got %v", err)
+	}
+}
+
+func TestValidateWarnsOnUndeclaredDeliverable(t *testing.T) {
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=box, allowed_write_paths="src/"]; exit [shape=Msquare, deliverable_paths="src/app,dist/"]; start -> a -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags := ValidateGraph(g)
+	if HasErrors(diags) {
+		t.Fatalf("unexpected errors: %+v", diags)
+	}
+	if len(diags) != 1 || diags[0].Level != "WARN" || !strings.Contains(diags[0].Message, "dist/") {
+		t.Fatalf("expected a single warning for dist/, got %+v", diags)
+	}
+}
+
+func TestValidateRejectsEscapingDeliverable(t *testing.T) {
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; exit [shape=Msquare, deliverable_paths="../secret"]; start -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !HasErrors(ValidateGraph(g)) {
+		t.Fatal("expected error for parent-segment deliverable path")
+	}
+}
+
+func TestNodeNamedDeliverablesIsRejected(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	deliverables [shape=parallelogram, tool_command="echo out > out.txt"];
+	exit [shape=Msquare, deliverable_paths="out.txt"];
+	start -> deliverables -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"})
+	if err == nil || !strings.Contains(err.Error(), `node id "deliverables" collides with run artifact deliverables`) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestDeliverablesFailureFailsRun(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=parallelogram, tool_command="printf 'ok\n' > report.md && printf 'not json' > \"$(dirname $ATTRACTOR_NODE_DIR)/manifest.json\"", allowed_write_paths="report.md"];
+	exit [shape=Msquare, deliverable_paths="report.md"];
+	start -> build -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"})
+	if err == nil || !strings.Contains(err.Error(), "record deliverables") {
+		t.Fatalf("err = %v", err)
+	}
+	runDir := filepath.Join(runsdir, "r1")
+	records := readJSONLRecords(t, filepath.Join(runDir, "events.jsonl"))
+	if last := records[len(records)-1]; last["type"] != "PipelineFailed" {
+		t.Fatalf("last event = %+v", last)
+	}
+	if res := readStatusJSON(t, filepath.Join(runDir, runResultFile)); res["status"] != "failed" || !strings.Contains(res["error"].(string), "record deliverables") {
+		t.Fatalf("result = %v", res)
+	}
+}
@@ -0,0 +1,221 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Diff backends choose how a stage's after-snapshot is taken.
+const (
+	// DiffBackendSnapshot walks and hashes the whole workspace after the
+	// handler, as every stage always has.
+	DiffBackendSnapshot = "snapshot"
+	// DiffBackendWatch watches the workspace while the handler runs and
+	// rehashes only the paths that changed.
+	DiffBackendWatch = "watch"
+	// DiffBackendAuto watches only workspaces large enough for the walk to
+	// cost more than the watches.
+	DiffBackendAuto = "auto"
+)
+
+// autoWatchMinFiles is the before-snapshot size from which auto watches.
+var autoWatchMinFiles = 10000
+
+// ParseDiffBackend validates a --diff-backend value; empty is snapshot.
+func ParseDiffBackend(s string) (string, error) {
+	switch strings.TrimSpace(s) {
+	case "", DiffBackendSnapshot:
+		return DiffBackendSnapshot, nil
+	case DiffBackendWatch:
+		return DiffBackendWatch, nil
+	case DiffBackendAuto:
+		return DiffBackendAuto, nil
+	}
+	return "", fmt.Errorf("invalid diff backend %q (expected watch, snapshot, or auto)", s)
+}
+
+// stageDiffTracker takes one attempt's after-snapshot with the configured
+// backend. The watcher starts before the before-snapshot, so nothing the
+// handler does is missed, and anything that keeps it from being trusted
+// falls back to a full walk, with the reason recorded in
+// workspace.diff.json.
+type stageDiffTracker struct {
+	mode    string
+	watcher *workspaceWatcher
+	// backend is the one the stage's diff came from; fallback is why a
+	// watch was wanted but not used.
+	backend  string
+	fallback string
+}
+
+func newStageDiffTracker(mode, workspace string) *stageDiffTracker {
+	t := &stageDiffTracker{mode: mode, backend: DiffBackendSnapshot}
+	if mode != DiffBackendWatch && mode != DiffBackendAuto {
+		return t
+	}
+	w, err := newWorkspaceWatcher(workspace)
+	if err != nil {
+		t.fallback = err.Error()
+		return t
+	}
+	t.watcher, t.backend = w, DiffBackendWatch
+	return t
+}
+
+// admit drops the watcher in auto mode when before is small enough that
+// walking it again is cheap.
+func (t *stageDiffTracker) admit(before map[string]fileState) {
+	if t.watcher != nil && t.mode == DiffBackendAuto && len(before) < autoWatchMinFiles {
+		t.close()
+		t.backend = DiffBackendSnapshot
+	}
+}
+
+// after returns the workspace after the handler: before refreshed at the
+// watched paths, or a new snapshot when there is no watcher or it may have
+// missed events.
+func (t *stageDiffTracker) after(workspace string, before, excludedBefore map[string]fileState, excludes []string) (map[string]fileState, map[string]fileState, error) {
+	if t.watcher != nil {
+		dirty, err := t.watcher.stop()
+		t.watcher = nil
+		if err == nil {
+			return refreshSnapshot(workspace, before, excludedBefore, dirty, excludes)
+		}
+		t.backend, t.fallback = DiffBackendSnapshot, err.Error()
+	}
+	return snapshotWorkspaceExcluding(workspace, -1, nil, excludes)
+}
+
+// close stops the watcher if after has not; it is deferred so a handler
+// error, panic, or timeout never leaks one.
+func (t *stageDiffTracker) close() {
+	if t.watcher != nil {
+		t.watcher.close()
+		t.watcher = nil
+	}
+}
+
+// refreshSnapshot is what snapshotWorkspaceExcluding(workspace, -1, nil,
+// excludes) would return, given the before-snapshots and every path changed
+// since. Changed files are rehashed; changed directories are walked again,
+// reusing before's hashes for files that did not change themselves.
+func refreshSnapshot(workspace string, before, excludedBefore map[string]fileState, dirty map[string]bool, excludes []string) (map[string]fileState, map[string]fileState, error) {
+	after := make(map[string]fileState, len(before))
+	seed := make(map[string]fileState, len(before))
+	dirs := map[string]bool{}
+	for p, st := range before {
+		// An after-snapshot retains no content, only symlink targets.
+		st.Content, st.Retained = nil, st.Symlink != ""
+		after[p] = st
+		if !dirty[p] {
+			seed[p] = st
+		}
+		markParentDirs(dirs, p)
+	}
+	excluded := make(map[string]fileState, len(excludedBefore))
+	for p, st := range excludedBefore {
+		excluded[p] = st
+		markParentDirs(dirs, p)
+	}
+	drop := func(rel string, wasDir bool) {
+		delete(after, rel)
+		delete(excluded, rel)
+		if !wasDir {
+			return
+		}
+		prefix := rel + "/"
+		for _, m := range []map[string]fileState{after, excluded} {
+			for p := range m {
+				if strings.HasPrefix(p, prefix) {
+					delete(m, p)
+				}
+			}
+		}
+	}
+	isDir := map[string]bool{}
+	// underRealDirs reports whether every ancestor of rel is still a
+	// directory, so that a walk would reach rel.
+	underRealDirs := func(rel string) bool {
+		for i := strings.IndexByte(rel, '/'); i >= 0; i = nextSlash(rel, i) {
+			parent := rel[:i]
+			ok, seen := isDir[parent]
+			if !seen {
+				info, err := os.Lstat(filepath.Join(workspace, filepath.FromSlash(parent)))
+				ok = err == nil && info.IsDir()
+				isDir[parent] = ok
+			}
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+	paths := make([]string, 0, len(dirty))
+	for p := range dirty {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	walked := map[string]bool{}
+	for _, rel := range paths {
+		if rel == ".attractor" || strings.HasPrefix(rel, ".attractor/") || hasWalkedAncestor(walked, rel) {
+			continue
+		}
+		if !underRealDirs(rel) {
+			drop(rel, true)
+			continue
+		}
+		path := filepath.Join(workspace, filepath.FromSlash(rel))
+		info, err := os.Lstat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			drop(rel, true)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if info.IsDir() {
+			drop(rel, true)
+			if err := snapshotTreeInto(workspace, path, -1, seed, excludes, after, excluded); err != nil {
+				return nil, nil, err
+			}
+			walked[rel] = true
+			continue
+		}
+		drop(rel, dirs[rel])
+		if err := snapshotFileInto(path, rel, fs.FileInfoToDirEntry(info), -1, nil, excludes, after, excluded); err != nil {
+			return nil, nil, err
+		}
+	}
+	return after, excluded, nil
+}
+
+func nextSlash(s string, i int) int {
+	j := strings.IndexByte(s[i+1:], '/')
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+func markParentDirs(dirs map[string]bool, rel string) {
+	for i := strings.LastIndexByte(rel, '/'); i > 0; i = strings.LastIndexByte(rel[:i], '/') {
+		if dirs[rel[:i]] {
+			return
+		}
+		dirs[rel[:i]] = true
+	}
+}
+
+func hasWalkedAncestor(walked map[string]bool, rel string) bool {
+	for i := strings.IndexByte(rel, '/'); i >= 0; i = nextSlash(rel, i) {
+		if walked[rel[:i]] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// inotifyFDs counts this process's open inotify instances, so tests can
+// check that watchers are torn down.
+func inotifyFDs(t *testing.T) int {
+	t.Helper()
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("no /proc/self/fd")
+	}
+	n := 0
+	for _, e := range entries {
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", e.Name())); err == nil && strings.Contains(target, "inotify") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWatchDiffMatchesSnapshot(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the watch backend is Linux only")
+	}
+	excludes := []string{"logs/"}
+	old := time.Now().Add(-time.Hour)
+	for name, change := range map[string]func(t *testing.T, ws string){
+		"create": func(t *testing.T, ws string) { writeFile(t, filepath.Join(ws, "new.txt"), "new") },
+		"modify": func(t *testing.T, ws string) { writeFile(t, filepath.Join(ws, "dir/b.txt"), "changed") },
+		"delete": func(t *testing.T, ws string) { mustDo(t, os.Remove(filepath.Join(ws, "a.txt"))) },
+		"touch": func(t *testing.T, ws string) {
+			mustDo(t, os.Chtimes(filepath.Join(ws, "a.txt"), time.Now(), time.Now()))
+		},
+		"chmod":  func(t *testing.T, ws string) { mustDo(t, os.Chmod(filepath.Join(ws, "a.txt"), 0o600)) },
+		"nested": func(t *testing.T, ws string) { writeFile(t, filepath.Join(ws, "new/a/b/c.txt"), "deep") },
+		"rmdir":  func(t *testing.T, ws string) { mustDo(t, os.RemoveAll(filepath.Join(ws, "dir"))) },
+		"renamed": func(t *testing.T, ws string) {
+			mustDo(t, os.Rename(filepath.Join(ws, "dir"), filepath.Join(ws, "moved")))
+		},
+		"rename-then-write": func(t *testing.T, ws string) {
+			mustDo(t, os.Rename(filepath.Join(ws, "dir"), filepath.Join(ws, "moved")))
+			writeFile(t, filepath.Join(ws, "moved/sub/c.txt"), "after move")
+		},
+		"file-to-dir": func(t *testing.T, ws string) {
+			mustDo(t, os.Remove(filepath.Join(ws, "a.txt")))
+			writeFile(t, filepath.Join(ws, "a.txt/inner.txt"), "inner")
+		},
+		"dir-to-file": func(t *testing.T, ws string) {
+			mustDo(t, os.RemoveAll(filepath.Join(ws, "dir")))
+			writeFile(t, filepath.Join(ws, "dir"), "file now")
+		},
+		"dir-to-symlink": func(t *testing.T, ws string) {
+			mustDo(t, os.RemoveAll(filepath.Join(ws, "dir")))
+			mustDo(t, os.Symlink("keep", filepath.Join(ws, "dir")))
+		},
+		"retarget": func(t *testing.T, ws string) {
+			mustDo(t, os.Remove(filepath.Join(ws, "link")))
+			mustDo(t, os.Symlink("dir/b.txt", filepath.Join(ws, "link")))
+		},
+		"excluded": func(t *testing.T, ws string) { writeFile(t, filepath.Join(ws, "logs/run.log"), "more") },
+		"state":    func(t *testing.T, ws string) { writeFile(t, filepath.Join(ws, ".attractor/x"), "ignored") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			ws := t.TempDir()
+			for rel, body := range map[string]string{"a.txt": "a", "dir/b.txt": "b", "dir/sub/c.txt": "c", "keep/d.txt": "d", "logs/run.log": "log"} {
+				writeFile(t, filepath.Join(ws, rel), body)
+				// An old mtime makes a rehash-free rewalk visible if it
+				// reused a stale hash.
+				mustDo(t, os.Chtimes(filepath.Join(ws, rel), old, old))
+			}
+			mustDo(t, os.Symlink("a.txt", filepath.Join(ws, "link")))
+
+			tracker := newStageDiffTracker(DiffBackendWatch, ws)
+			defer tracker.close()
+			if tracker.backend != DiffBackendWatch {
+				t.Skipf("watcher unavailable: %s", tracker.fallback)
+			}
+			before, excludedBefore, err := snapshotWorkspaceExcluding(ws, 1<<20, nil, excludes)
+			mustDo(t, err)
+			change(t, ws)
+			after, excludedAfter, err := tracker.after(ws, before, excludedBefore, excludes)
+			mustDo(t, err)
+			if tracker.backend != DiffBackendWatch {
+				t.Fatalf("fell back: %s", tracker.fallback)
+			}
+			wantAfter, wantExcluded, err := snapshotWorkspaceExcluding(ws, -1, nil, excludes)
+			mustDo(t, err)
+			if !reflect.DeepEqual(after, wantAfter) {
+				t.Fatalf("after = %+v\nwant %+v", after, wantAfter)
+			}
+			if !reflect.DeepEqual(excludedAfter, wantExcluded) {
+				t.Fatalf("excluded = %+v\nwant %+v", excludedAfter, wantExcluded)
+			}
+			if got, want := computeDiff(before, after), computeDiff(before, wantAfter); !reflect.DeepEqual(got, want) {
+				t.Fatalf("diff = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffBackendRecordedPerStage(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	make [shape=parallelogram, tool_command="mkdir -p out && echo hi > out/x.txt"];
+	fail [shape=parallelogram, tool_command="echo partial > out/y.txt; exit 1"];
+	exit [shape=Msquare];
+	start -> make -> fail;
+	fail -> exit;
+	}`
+	for _, backend := range []string{DiffBackendSnapshot, DiffBackendWatch, DiffBackendAuto} {
+		t.Run(backend, func(t *testing.T) {
+			workdir, runsdir, pipeline := setupRun(t, dot)
+			open := inotifyFDs(t)
+			_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1", DiffBackend: backend})
+			if n := inotifyFDs(t); n != open {
+				t.Fatalf("inotify instances left open: %d, was %d", n, open)
+			}
+			for node, created := range map[string]string{"make": "out/x.txt", "fail": "out/y.txt"} {
+				diff := readStatusJSON(t, filepath.Join(runsdir, "r1", node, "workspace.diff.json"))
+				if c, _ := diff["created"].([]any); len(c) != 1 || c[0] != created {
+					t.Fatalf("%s diff = %v", node, diff)
+				}
+				want := DiffBackendSnapshot
+				if backend == DiffBackendWatch && runtime.GOOS == "linux" {
+					want = DiffBackendWatch
+				}
+				if diff["backend"] != want {
+					t.Fatalf("%s backend = %v, want %s", node, diff["backend"], want)
+				}
+				if fallback, _ := diff["backend_fallback"].(string); (fallback != "") != (backend == DiffBackendWatch && want == DiffBackendSnapshot) {
+					t.Fatalf("%s fallback = %q", node, fallback)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffTrackerCloseWithoutAfter(t *testing.T) {
+	open := inotifyFDs(t)
+	tracker := newStageDiffTracker(DiffBackendWatch, t.TempDir())
+	tracker.close()
+	tracker.close()
+	if n := inotifyFDs(t); n != open {
+		t.Fatalf("inotify instances left open: %d, was %d", n, open)
+	}
+}
+
+func TestParseDiffBackend(t *testing.T) {
+	for in, want := range map[string]string{"": "snapshot", "snapshot": "snapshot", "watch": "watch", "auto": "auto"} {
+		if got, err := ParseDiffBackend(in); err != nil || got != want {
+			t.Fatalf("ParseDiffBackend(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseDiffBackend("fanotify"); err == nil {
+		t.Fatal("accepted an unknown backend")
+	}
+}
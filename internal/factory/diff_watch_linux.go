@@ -0,0 +1,201 @@
+//go:build linux
+
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF |
+	syscall.IN_DONT_FOLLOW | syscall.IN_ONLYDIR
+
+// workspaceWatcher records the workspace paths changed while it runs, with
+// an inotify watch on every directory. Events for a directory created
+// during the stage may be missed before its watch exists, so such a
+// directory is reported as changed and rewalked as a whole.
+type workspaceWatcher struct {
+	root string
+	// fd is the inotify instance; f wraps it for the runtime poller, so
+	// reads can be ended with a deadline. f.Fd is never called, because it
+	// would make the descriptor blocking again.
+	fd   int
+	f    *os.File
+	done chan struct{}
+
+	mu    sync.Mutex
+	wds   map[int32]string
+	dirty map[string]bool
+	// lost is why events may have been missed (queue overflow, watch
+	// limit); the caller then falls back to a snapshot.
+	lost string
+
+	closeOnce sync.Once
+}
+
+func newWorkspaceWatcher(root string) (*workspaceWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %w", err)
+	}
+	w := &workspaceWatcher{root: root, fd: fd, f: os.NewFile(uintptr(fd), "inotify"), done: make(chan struct{}), wds: map[int32]string{}, dirty: map[string]bool{}}
+	if err := w.watchTree(""); err != nil {
+		_ = w.f.Close()
+		return nil, err
+	}
+	go w.read()
+	return w, nil
+}
+
+// watchTree adds a watch on rel and every directory below it, skipping
+// .attractor. Adding a watch to a directory already watched, as after a
+// rename, returns its existing descriptor, which is remapped to the new
+// path.
+func (w *workspaceWatcher) watchTree(rel string) error {
+	return filepath.WalkDir(filepath.Join(w.root, rel), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		r, err := filepath.Rel(w.root, path)
+		if err != nil {
+			return err
+		}
+		r = filepath.ToSlash(r)
+		if r == "." {
+			r = ""
+		}
+		if r == ".attractor" {
+			return filepath.SkipDir
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+		if err != nil {
+			if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR) {
+				return nil
+			}
+			return fmt.Errorf("inotify_add_watch %s: %w", path, err)
+		}
+		w.mu.Lock()
+		w.wds[int32(wd)] = r
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+func (w *workspaceWatcher) read() {
+	defer close(w.done)
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := w.f.Read(buf)
+		if n > 0 {
+			w.handle(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle records the paths named by a buffer of inotify events.
+func (w *workspaceWatcher) handle(buf []byte) {
+	for off := 0; off+syscall.SizeofInotifyEvent <= len(buf); {
+		ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		name := ""
+		if ev.Len > 0 {
+			raw := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+			for i, c := range raw {
+				if c == 0 {
+					raw = raw[:i]
+					break
+				}
+			}
+			name = string(raw)
+		}
+		off += syscall.SizeofInotifyEvent + int(ev.Len)
+		w.handleEvent(ev.Wd, ev.Mask, name)
+	}
+}
+
+func (w *workspaceWatcher) handleEvent(wd int32, mask uint32, name string) {
+	w.mu.Lock()
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.lost = "inotify event queue overflowed"
+		w.mu.Unlock()
+		return
+	}
+	dir, ok := w.wds[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.wds, wd)
+	}
+	if !ok || name == "" {
+		w.mu.Unlock()
+		return
+	}
+	rel := name
+	if dir != "" {
+		rel = dir + "/" + name
+	}
+	if rel == ".attractor" {
+		w.mu.Unlock()
+		return
+	}
+	w.dirty[rel] = true
+	w.mu.Unlock()
+	if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		if err := w.watchTree(rel); err != nil {
+			w.mu.Lock()
+			w.lost = err.Error()
+			w.mu.Unlock()
+		}
+	}
+}
+
+// stop reads the events still queued and stops watching. It returns the
+// changed paths, or an error when some may have been missed.
+func (w *workspaceWatcher) stop() (map[string]bool, error) {
+	// A past deadline ends the reader once it has drained what is queued.
+	_ = w.f.SetReadDeadline(time.Now())
+	<-w.done
+	_ = w.f.SetReadDeadline(time.Time{})
+	if raw, err := w.f.SyscallConn(); err == nil {
+		buf := make([]byte, 64<<10)
+		_ = raw.Read(func(fd uintptr) bool {
+			for {
+				n, err := syscall.Read(int(fd), buf)
+				if n <= 0 || err != nil {
+					return true
+				}
+				w.handle(buf[:n])
+			}
+		})
+	}
+	w.close()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lost != "" {
+		return nil, errors.New(w.lost)
+	}
+	return w.dirty, nil
+}
+
+// close releases the inotify instance; it is safe to call more than once
+// and after stop.
+func (w *workspaceWatcher) close() {
+	w.closeOnce.Do(func() {
+		_ = w.f.Close()
+		<-w.done
+	})
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package attractor
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// workspaceWatcher is only implemented on Linux; elsewhere the watch
+// backend always falls back to snapshots.
+type workspaceWatcher struct{}
+
+func newWorkspaceWatcher(string) (*workspaceWatcher, error) {
+	return nil, fmt.Errorf("change tracking is not supported on %s", runtime.GOOS)
+}
+
+func (*workspaceWatcher) stop() (map[string]bool, error) {
+	return nil, fmt.Errorf("change tracking is not supported on %s", runtime.GOOS)
+}
+
+func (*workspaceWatcher) close() {}
@@ -0,0 +1,139 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Disablement sources recorded in status.json and the manifest.
+const (
+	disabledByAttr = "attr"
+	disabledByCLI  = "cli"
+)
+
+// applyDisabledNodes marks the nodes named by --disable-node as disabled
+// and returns every disabled node with where its disablement came from. A
+// node disabled both ways is recorded as attr. CLI disables only last for
+// the invocation that passes them, so a resume without the flag runs the
+// node again.
+func applyDisabledNodes(g *Graph, cliIDs []string) (map[string]string, error) {
+	sources := map[string]string{}
+	for id, n := range g.Nodes {
+		if n.BoolAttr("disabled", false) {
+			sources[id] = disabledByAttr
+		}
+	}
+	for _, id := range cliIDs {
+		id = strings.TrimSpace(id)
+		n := g.Nodes[id]
+		if n == nil {
+			return nil, fmt.Errorf("--disable-node: node not found: %s", id)
+		}
+		if _, ok := sources[id]; !ok {
+			sources[id] = disabledByCLI
+		}
+		n.Attrs["disabled"] = true
+	}
+	return sources, nil
+}
+
+// skipDisabledStage stands in for runStage on a disabled node: it succeeds
+// without running the handler, so routing follows the node's success edges.
+func (e *Engine) skipDisabledStage(node *Node, nodeDir, source string) (Outcome, error) {
+	if err := os.MkdirAll(nodeDir, 0o755); err != nil {
+		return Outcome{}, err
+	}
+	out := Outcome{SchemaVersion: 1, Outcome: "success", SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}, Notes: "disabled", DisabledBy: source}
+	if err := writeJSON(filepath.Join(nodeDir, "status.json"), out); err != nil {
+		return Outcome{}, err
+	}
+	e.recordEvent(map[string]any{"schema_version": 1, "type": "StageSkipped", "node_id": node.ID, "reason": "disabled", "disabled_by": source, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+	e.Logger.Info("stage skipped: node disabled", "node", node.ID, "disabled_by", source)
+	e.Context["outcome"] = out.Outcome
+	e.Completed[node.ID] = true
+	if err := e.writeCheckpoint(node.ID); err != nil {
+		return Outcome{}, err
+	}
+	return out, nil
+}
+
+// disabledEdgeFires reports whether e can be taken from a disabled node,
+// which always succeeds.
+func disabledEdgeFires(e *Edge) bool {
+	raw := strings.TrimSpace(e.StringAttr("condition", ""))
+	if raw == "" {
+		return true
+	}
+	c, err := parseCondition(raw)
+	return err != nil || c.Outcome == "" || c.Outcome == "success"
+}
+
+// validateDisabledNodes rejects disabling the start or an exit node, and
+// warns about nodes that only a disabled node's non-success edges reach.
+func validateDisabledNodes(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	disabled := map[string]bool{}
+	for _, id := range sortedKeys(g.Nodes) {
+		n := g.Nodes[id]
+		if !n.BoolAttr("disabled", false) {
+			continue
+		}
+		if isStartNode(n) || isExit(g, id) {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: start and exit nodes cannot be disabled", id)})
+			continue
+		}
+		disabled[id] = true
+	}
+	starts := startNodeIDs(g)
+	if len(disabled) == 0 || len(starts) == 0 {
+		return d
+	}
+	full := reachableNodes(g, starts, nil)
+	reduced := reachableNodes(g, starts, disabled)
+	lost := []string{}
+	for id := range full {
+		if !reduced[id] {
+			lost = append(lost, id)
+		}
+	}
+	if len(lost) > 0 {
+		sort.Strings(lost)
+		names := make([]string, 0, len(disabled))
+		for id := range disabled {
+			names = append(names, id)
+		}
+		sort.Strings(names)
+		d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("disabled nodes %s always succeed, so these nodes become unreachable: %s", strings.Join(names, ","), strings.Join(lost, ","))})
+	}
+	return d
+}
+
+// reachableNodes walks edges from starts. Disabled nodes only follow edges
+// that can fire on success, and do not enter a manager loop body.
+func reachableNodes(g *Graph, starts []string, disabled map[string]bool) map[string]bool {
+	seen := map[string]bool{}
+	queue := append([]string{}, starts...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		for _, e := range g.Edges {
+			if e.From == id && (!disabled[id] || disabledEdgeFires(e)) {
+				queue = append(queue, e.To)
+			}
+		}
+		if n := g.Nodes[id]; n != nil && !disabled[id] && isManagerLoopNode(n) {
+			if entry := strings.TrimSpace(n.StringAttr("loop.body_entry", "")); entry != "" {
+				queue = append(queue, entry)
+			}
+		}
+	}
+	return seen
+}
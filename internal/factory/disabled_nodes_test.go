@@ -0,0 +1,78 @@
+package attractor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const disabledNodesDOT = `digraph G {
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="touch a.done"];
+	scenario [shape=parallelogram, tool_command="exit 1", disabled=true];
+	b [shape=parallelogram, tool_command="touch b.done"];
+	fix [shape=parallelogram, tool_command="true"];
+	exit [shape=Msquare];
+	start -> a -> scenario;
+	scenario -> b [condition="outcome=success"];
+	scenario -> fix [condition="outcome=fail"];
+	fix -> scenario;
+	b -> exit;
+	}`
+
+func TestDisabledNodesSkipAndResumeHonorsCLI(t *testing.T) {
+	workdir, runsdir, pipeline := setupRun(t, disabledNodesDOT)
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "dn1"})
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "dn1", Resume: true, DisableNodes: []string{"b"}}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "dn1")
+	for node, source := range map[string]string{"scenario": "attr", "b": "cli"} {
+		st := readStatusJSON(t, filepath.Join(runDir, node, "status.json"))
+		if st["outcome"] != "success" || st["notes"] != "disabled" || st["disabled_by"] != source {
+			t.Fatalf("%s status = %v", node, st)
+		}
+	}
+	skipped := []string{}
+	for _, ev := range readJSONLRecords(t, filepath.Join(runDir, "events.jsonl")) {
+		switch {
+		case ev["type"] == "StageSkipped":
+			skipped = append(skipped, ev["node_id"].(string)+":"+ev["disabled_by"].(string))
+		case ev["type"] == "StageStarted" && (ev["node_id"] == "scenario" || ev["node_id"] == "b" || ev["node_id"] == "fix"):
+			t.Fatalf("disabled or unreached node started: %v", ev)
+		}
+	}
+	if strings.Join(skipped, ",") != "scenario:attr,b:cli" {
+		t.Fatalf("skipped = %v", skipped)
+	}
+	manifest := readStatusJSON(t, filepath.Join(runDir, "manifest.json"))
+	if got, _ := manifest["disabled_nodes"].(map[string]any); got["b"] != "cli" || got["scenario"] != "attr" {
+		t.Fatalf("manifest disabled_nodes = %v", manifest["disabled_nodes"])
+	}
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "dn2", DisableNodes: []string{"nope"}}); err == nil || !strings.Contains(err.Error(), "node not found: nope") {
+		t.Fatalf("unknown --disable-node err = %v", err)
+	}
+}
+
+func TestValidateDisabledNodes(t *testing.T) {
+	g, err := ParseDOT(disabledNodesDOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Nodes["exit"].Attrs["disabled"] = true
+	got := []string{}
+	for _, d := range ValidateGraph(g) {
+		if strings.Contains(d.Message, "disabled") {
+			got = append(got, d.Level+": "+d.Message)
+		}
+	}
+	want := []string{
+		"WARN: disabled nodes scenario always succeed, so these nodes become unreachable: fix",
+		"ERROR: node exit: start and exit nodes cannot be disabled",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("diagnostics:\n%s", strings.Join(got, "\n"))
+	}
+}
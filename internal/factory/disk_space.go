@@ -0,0 +1,164 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// defaultMinFreeBytes is the free space a run keeps in reserve between
+	// stages when RunConfig.MinFreeBytes is unset.
+	defaultMinFreeBytes = 64 << 20
+	// diskHeadroomFactor scales the workdir estimate at preflight: the copy
+	// plus room for artifacts and the files stages write.
+	diskHeadroomFactor = 2
+)
+
+// ErrInsufficientDiskSpace is returned (wrapped) when a run is refused at
+// preflight or aborted between stages because the runs dir filesystem is
+// running out of space.
+var ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+
+// RunDiskUsage is recorded under disk in manifest.json at start and in
+// run.result.json at the end.
+type RunDiskUsage struct {
+	EstimateBytes     int64  `json:"workdir_estimate_bytes,omitempty"`
+	RequiredFreeBytes uint64 `json:"required_free_bytes,omitempty"`
+	MinFreeBytes      uint64 `json:"min_free_bytes"`
+	FreeBytes         uint64 `json:"free_bytes,omitempty"`
+	WorkspaceBytes    int64  `json:"workspace_bytes,omitempty"`
+	RunDirBytes       int64  `json:"run_dir_bytes,omitempty"`
+}
+
+func minFreeBytes(cfg RunConfig) uint64 {
+	if cfg.MinFreeBytes > 0 {
+		return cfg.MinFreeBytes
+	}
+	return defaultMinFreeBytes
+}
+
+// estimateWorkdirBytes sums the sizes of regular files the workspace copy
+// will include, skipping the same excludes as copyDirRecording.
+func estimateWorkdirBytes(workdir string, excludes []string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(workdir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(workdir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if shouldSkipCopyRel(filepath.ToSlash(rel), excludes) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// checkDiskHeadroom fails unless the filesystem holding path has at least
+// required free bytes, returning the free bytes observed. Filesystems that
+// do not report free space are skipped.
+func checkDiskHeadroom(path string, required uint64) (uint64, error) {
+	st, ok, err := statFilesystem(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat filesystem for %s: %w", path, err)
+	}
+	if !ok {
+		return 0, nil
+	}
+	if st.FreeBytes < required {
+		return st.FreeBytes, fmt.Errorf("%w on %s: %d bytes available, %d required", ErrInsufficientDiskSpace, path, st.FreeBytes, required)
+	}
+	return st.FreeBytes, nil
+}
+
+// preflightDiskSpace estimates the workspace copy and requires
+// diskHeadroomFactor times the estimate, and never less than minFree, to be
+// free on the runs dir filesystem. Resumes have no copy to make and only
+// need minFree.
+func preflightDiskSpace(cfg RunConfig, excludes []string) (RunDiskUsage, error) {
+	usage := RunDiskUsage{MinFreeBytes: minFreeBytes(cfg)}
+	usage.RequiredFreeBytes = usage.MinFreeBytes
+	if !cfg.Resume {
+		var estimate int64
+		if cfg.Workdir != "" {
+			n, err := estimateWorkdirBytes(cfg.Workdir, excludes)
+			if err != nil {
+				return usage, fmt.Errorf("failed to estimate workdir size: %w", err)
+			}
+			estimate = n
+		}
+		for _, a := range cfg.AdditionalWorkdirs {
+			n, err := estimateWorkdirBytes(a.Path, additionalWorkdirExcludes(a.Path, cfg.Workdir, cfg.Runsdir, cfg.AdditionalWorkdirs))
+			if err != nil {
+				return usage, fmt.Errorf("failed to estimate additional workdir size: %w", err)
+			}
+			estimate += n
+		}
+		usage.EstimateBytes = estimate
+		if need := uint64(estimate) * diskHeadroomFactor; need > usage.RequiredFreeBytes {
+			usage.RequiredFreeBytes = need
+		}
+	}
+	free, err := checkDiskHeadroom(cfg.Runsdir, usage.RequiredFreeBytes)
+	usage.FreeBytes = free
+	return usage, err
+}
+
+// checkStageDiskSpace runs between stages so a run stops at a checkpoint
+// before artifact writes start failing.
+func (e *Engine) checkStageDiskSpace() error {
+	if e.minFreeBytes == 0 {
+		return nil
+	}
+	_, err := checkDiskHeadroom(e.RunDir, e.minFreeBytes)
+	return err
+}
+
+// finalDiskUsage measures the run dir and workspace for run.result.json.
+func (e *Engine) finalDiskUsage() *RunDiskUsage {
+	usage := &RunDiskUsage{MinFreeBytes: e.minFreeBytes}
+	usage.WorkspaceBytes, _ = dirUsageBytes(e.Workspace)
+	usage.RunDirBytes, _ = dirUsageBytes(e.RunDir)
+	if st, ok, err := statFilesystem(e.RunDir); err == nil && ok {
+		usage.FreeBytes = st.FreeBytes
+	}
+	return usage
+}
+
+func dirUsageBytes(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,88 @@
+package attractor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunFailsPreflightWithoutDiskHeadroom(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	withFilesystemStats(t, filesystemStats{FreeBytes: 3000})
+	dot := `digraph G { start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "big.bin"), strings.Repeat("x", 2000))
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "dsk", MinFreeBytes: 100})
+	if !errors.Is(err, ErrInsufficientDiskSpace) {
+		t.Fatalf("expected disk preflight failure, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(runsdir, "dsk", "workspace")); err == nil {
+		t.Fatal("workspace should not be copied when preflight fails")
+	}
+
+	withFilesystemStats(t, filesystemStats{FreeBytes: 1 << 30})
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "dsk2", MinFreeBytes: 100}); err != nil {
+		t.Fatal(err)
+	}
+	manifest := readStatusJSON(t, filepath.Join(runsdir, "dsk2", "manifest.json"))
+	disk, _ := manifest["disk"].(map[string]any)
+	if estimate, _ := disk["workdir_estimate_bytes"].(float64); estimate < 2000 || disk["required_free_bytes"] != estimate*2 {
+		t.Fatalf("manifest disk = %v", disk)
+	}
+	result := readStatusJSON(t, filepath.Join(runsdir, "dsk2", "run.result.json"))
+	if usage, _ := result["disk"].(map[string]any); usage["workspace_bytes"] == nil || usage["run_dir_bytes"] == nil {
+		t.Fatalf("run.result.json disk = %v", result["disk"])
+	}
+}
+
+func TestRunAbortsBetweenStagesOnLowDiskSpace(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	marker := filepath.Join(t.TempDir(), "disk-full")
+	t.Setenv("DISK_FULL_MARKER", marker)
+	orig := statFilesystem
+	statFilesystem = func(string) (filesystemStats, bool, error) {
+		if _, err := os.Stat(marker); err == nil {
+			return filesystemStats{FreeBytes: 10}, true, nil
+		}
+		return filesystemStats{FreeBytes: 1 << 30}, true, nil
+	}
+	t.Cleanup(func() { statFilesystem = orig })
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	fill [shape=parallelogram, tool_command="touch $DISK_FULL_MARKER"];
+	after [shape=box];
+	exit [shape=Msquare];
+	start -> fill -> after -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "dsa", MinFreeBytes: 1000})
+	if !errors.Is(err, ErrInsufficientDiskSpace) {
+		t.Fatalf("expected disk space abort, got %v", err)
+	}
+	runDir := filepath.Join(runsdir, "dsa")
+	aborted := eventsOfType(t, runDir, "PipelineAborted")
+	if len(aborted) != 1 || aborted[0]["reason"] != "disk_space" {
+		t.Fatalf("PipelineAborted events = %v", aborted)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "after", "status.json")); err == nil {
+		t.Fatal("stage after the low-space check should not run")
+	}
+	if cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json")); err != nil || cp.LastCompletedNode != "fill" {
+		t.Fatalf("checkpoint = %+v (%v)", cp, err)
+	}
+	if result := readStatusJSON(t, filepath.Join(runDir, "run.result.json")); result["status"] != "aborted" {
+		t.Fatalf("run.result.json = %v", result)
+	}
+
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "dsa", Resume: true, MinFreeBytes: 1000}); err != nil {
+		t.Fatalf("resume after freeing space: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "after", "status.json")); err != nil {
+		t.Fatal("resume did not run the remaining stages")
+	}
+}
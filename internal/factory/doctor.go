@@ -0,0 +1,382 @@
+package attractor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DoctorLock describes run.lock as found by DiagnoseRun.
+type DoctorLock struct {
+	PID        int    `json:"pid"`
+	Host       string `json:"host"`
+	AcquiredAt string `json:"acquired_at"`
+	Live       bool   `json:"live"`
+}
+
+// DoctorCorruptTail is a JSONL file whose trailing lines are truncated or
+// not JSON, as a crash mid-write leaves them.
+type DoctorCorruptTail struct {
+	File   string `json:"file"`
+	Offset int64  `json:"offset"`
+	Bytes  int64  `json:"bytes"`
+	Lines  int    `json:"lines"`
+}
+
+// DoctorCorruptLines lists the 1-based numbers of lines before a JSONL
+// file's tail that are not JSON or fail their event crc, as interleaved
+// writes or a damaged disk leave them. Readers skip these lines.
+type DoctorCorruptLines struct {
+	File  string `json:"file"`
+	Lines []int  `json:"lines"`
+}
+
+// DoctorReport is what `factory doctor` finds in a run directory.
+type DoctorReport struct {
+	RunDir string `json:"run_dir"`
+	// State is run.state's state, or for runs written before run.state
+	// existed, one inferred from the last terminal event.
+	State       string      `json:"state"`
+	HeartbeatAt string      `json:"heartbeat_at,omitempty"`
+	Lock        *DoctorLock `json:"lock,omitempty"`
+	LastEvent   string      `json:"last_event,omitempty"`
+	LastEventAt string      `json:"last_event_at,omitempty"`
+	// InFlightNode was executing when the run stopped writing and never
+	// finished; its partial artifacts are in PartialArtifacts.
+	InFlightNode            string               `json:"in_flight_node,omitempty"`
+	PartialArtifacts        []string             `json:"partial_artifacts,omitempty"`
+	DiscardPartialArtifacts bool                 `json:"discard_partial_artifacts"`
+	CorruptTails            []DoctorCorruptTail  `json:"corrupt_tails,omitempty"`
+	CorruptLines            []DoctorCorruptLines `json:"corrupt_lines,omitempty"`
+	Resumable               bool                 `json:"resumable"`
+	// Problems explain why the run is not resumable.
+	Problems []string `json:"problems,omitempty"`
+	Repairs  []string `json:"repairs,omitempty"`
+}
+
+// DiagnoseRun inspects a run directory's state, heartbeat, lock, event log,
+// and node artifacts to tell whether it can be resumed.
+func DiagnoseRun(runDir string) (DoctorReport, error) {
+	rep := DoctorReport{RunDir: runDir}
+	if _, err := os.Stat(filepath.Join(runDir, "manifest.json")); err != nil {
+		return rep, fmt.Errorf("%s is not a run directory: %w", runDir, err)
+	}
+	now := time.Now().UTC()
+	st, stErr := readRunState(runDir)
+	if stErr == nil {
+		rep.State, rep.HeartbeatAt = st.State, st.HeartbeatAt
+	}
+	if l, err := readRunLock(runDir); err == nil {
+		rep.Lock = &DoctorLock{PID: l.PID, Host: l.Host, AcquiredAt: l.AcquiredAt, Live: lockIsLive(l, st, now)}
+	} else if !os.IsNotExist(err) {
+		rep.Problems = append(rep.Problems, err.Error())
+	}
+	for _, name := range doctorJSONLFiles(runDir) {
+		tail, ok, err := corruptJSONLTail(filepath.Join(runDir, name))
+		if err != nil {
+			return rep, err
+		}
+		end := int64(-1)
+		if ok {
+			tail.File = name
+			rep.CorruptTails = append(rep.CorruptTails, tail)
+			end = tail.Offset
+		}
+		lines, err := corruptJSONLLines(filepath.Join(runDir, name), end)
+		if err != nil {
+			return rep, err
+		}
+		if len(lines) > 0 {
+			rep.CorruptLines = append(rep.CorruptLines, DoctorCorruptLines{File: name, Lines: lines})
+		}
+	}
+	last, inFlight, err := scanRunEvents(runDir)
+	if err != nil {
+		return rep, err
+	}
+	rep.LastEvent, _ = last["type"].(string)
+	rep.LastEventAt, _ = last["at"].(string)
+	if stErr != nil {
+		rep.State = inferRunState(rep.LastEvent, inFlight)
+	}
+	if node, ok := strings.CutPrefix(rep.State, RunStateRunning+":"); ok {
+		inFlight = node
+	}
+	cp, cpErr := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if inFlight != "" && (cpErr != nil || cp.LastCompletedNode != inFlight) {
+		rep.InFlightNode = inFlight
+		rep.PartialArtifacts = nodeArtifactFiles(nodeArtifactDir(runDir, inFlight))
+		rep.DiscardPartialArtifacts = len(rep.PartialArtifacts) > 0
+	}
+	switch {
+	case rep.State == RunStateCompleted:
+		rep.Problems = append(rep.Problems, "run already completed")
+	case rep.Lock != nil && rep.Lock.Live:
+		rep.Problems = append(rep.Problems, fmt.Sprintf("run is locked by live pid %d on %s", rep.Lock.PID, rep.Lock.Host))
+	case cpErr != nil:
+		rep.Problems = append(rep.Problems, "no readable checkpoint.json; start a new run instead")
+	}
+	rep.Resumable = len(rep.Problems) == 0
+	return rep, nil
+}
+
+// RepairRun truncates corrupt JSONL tails, strips corrupt lines before them,
+// and removes a stale lock. It does nothing to a run whose lock is live.
+func RepairRun(rep *DoctorReport) error {
+	if rep.Lock != nil && rep.Lock.Live {
+		return fmt.Errorf("%w: pid %d on %s", ErrRunLocked, rep.Lock.PID, rep.Lock.Host)
+	}
+	// Any change to a trace segment or the index means the index offsets
+	// may be stale.
+	traceChanged := false
+	isTrace := func(name string) bool {
+		return name == traceFile || name == traceIndexFile || traceSegmentRe.MatchString(name)
+	}
+	for _, tail := range rep.CorruptTails {
+		traceChanged = traceChanged || isTrace(tail.File)
+		if err := os.Truncate(filepath.Join(rep.RunDir, tail.File), tail.Offset); err != nil {
+			return err
+		}
+		rep.Repairs = append(rep.Repairs, fmt.Sprintf("truncated %d corrupt trailing line(s) (%d bytes) from %s", tail.Lines, tail.Bytes, tail.File))
+	}
+	rep.CorruptTails = nil
+	for _, c := range rep.CorruptLines {
+		traceChanged = traceChanged || isTrace(c.File)
+		if err := stripJSONLLines(filepath.Join(rep.RunDir, c.File), c.Lines); err != nil {
+			return err
+		}
+		rep.Repairs = append(rep.Repairs, fmt.Sprintf("stripped %d corrupt line(s) from %s", len(c.Lines), c.File))
+	}
+	rep.CorruptLines = nil
+	if traceChanged {
+		if _, err := os.Stat(filepath.Join(rep.RunDir, traceIndexFile)); err == nil {
+			if err := rebuildTraceIndex(rep.RunDir); err != nil {
+				return err
+			}
+			rep.Repairs = append(rep.Repairs, "rebuilt "+traceIndexFile)
+		}
+	}
+	if rep.Lock != nil {
+		if err := os.Remove(filepath.Join(rep.RunDir, runLockFile)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		rep.Repairs = append(rep.Repairs, fmt.Sprintf("cleared stale lock held by pid %d on %s", rep.Lock.PID, rep.Lock.Host))
+		rep.Lock = nil
+	}
+	return nil
+}
+
+// prepareResume runs the doctor before a resume: it refuses completed or
+// live runs and repairs what a crash left behind.
+func prepareResume(runDir string, allowCompleted bool) (DoctorReport, error) {
+	rep, err := DiagnoseRun(runDir)
+	if err != nil {
+		return rep, err
+	}
+	if rep.State == RunStateCompleted && !allowCompleted {
+		return rep, fmt.Errorf("%w: %s", ErrRunCompleted, runDir)
+	}
+	if err := RepairRun(&rep); err != nil {
+		return rep, err
+	}
+	return rep, nil
+}
+
+// checkpointedAtExit reports whether the run's checkpoint ends at an exit
+// node of g that did not fail. Such a run is complete even if run.state was
+// never updated, so resuming it must change nothing.
+func checkpointedAtExit(g *Graph, runDir string) bool {
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil || cp.LastCompletedNode == "" || cp.Loop != nil || cp.Foreach != nil || !isExit(g, cp.LastCompletedNode) {
+		return false
+	}
+	status, err := readStatus(filepath.Join(nodeArtifactDir(runDir, cp.LastCompletedNode), "status.json"))
+	return err == nil && status.Outcome != "fail"
+}
+
+// doctorJSONLFiles lists the run's append-only JSONL logs.
+func doctorJSONLFiles(runDir string) []string {
+	files := []string{eventsFile}
+	if segs, err := traceSegments(runDir); err == nil {
+		for _, seg := range segs {
+			files = append(files, filepath.Base(seg))
+		}
+	}
+	files = append(files, "trace.index.jsonl")
+	out := []string{}
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(runDir, f)); err == nil {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// corruptJSONLTail finds the trailing run of lines that are unterminated or
+// not JSON. Corruption earlier in the file is left alone.
+func corruptJSONLTail(path string) (DoctorCorruptTail, bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return DoctorCorruptTail{}, false, err
+	}
+	cut, lines := len(b), 0
+	for cut > 0 {
+		lineEnd := cut
+		terminated := b[cut-1] == '\n'
+		if terminated {
+			lineEnd--
+		}
+		start := bytes.LastIndexByte(b[:lineEnd], '\n') + 1
+		line := bytes.TrimSpace(b[start:lineEnd])
+		if terminated && (len(line) == 0 || jsonlLineValid(line)) {
+			break
+		}
+		cut = start
+		lines++
+	}
+	if lines == 0 {
+		return DoctorCorruptTail{}, false, nil
+	}
+	return DoctorCorruptTail{Offset: int64(cut), Bytes: int64(len(b) - cut), Lines: lines}, true, nil
+}
+
+// corruptJSONLLines returns the numbers of the invalid lines in the first
+// end bytes of path, or in all of it when end is negative.
+func corruptJSONLLines(path string, end int64) ([]int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if end >= 0 && end < int64(len(b)) {
+		b = b[:end]
+	}
+	out := []int{}
+	for i, line := range bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 && !jsonlLineValid(line) {
+			out = append(out, i+1)
+		}
+	}
+	return out, nil
+}
+
+// stripJSONLLines rewrites path without the given 1-based line numbers,
+// replacing the file by rename so a crash leaves either version.
+func stripJSONLLines(path string, lines []int) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	drop := map[int]bool{}
+	for _, n := range lines {
+		drop[n] = true
+	}
+	var out bytes.Buffer
+	for i, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if !drop[i+1] {
+			out.Write(line)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// scanRunEvents returns the last parseable event and the node of a
+// StageStarted that no StageCompleted or StageFailed ended.
+func scanRunEvents(runDir string) (map[string]any, string, error) {
+	events, _, err := readEvents(runDir)
+	if err != nil {
+		return nil, "", err
+	}
+	var last map[string]any
+	inFlight := ""
+	for _, ev := range events {
+		last = ev
+		switch ev["type"] {
+		case "StageStarted":
+			inFlight, _ = ev["node_id"].(string)
+		case "StageCompleted", "StageFailed":
+			inFlight = ""
+		}
+	}
+	return last, inFlight, nil
+}
+
+// inferRunState derives a state for runs without run.state.
+func inferRunState(lastEvent, inFlight string) string {
+	switch lastEvent {
+	case "PipelineCompleted":
+		return RunStateCompleted
+	case "PipelineFailed", "PipelineAborted":
+		return RunStateFailed
+	case "PipelineStopped":
+		return RunStateCancelled
+	case "":
+		return RunStateInitializing
+	}
+	if inFlight != "" {
+		return RunStateRunning + ":" + inFlight
+	}
+	return RunStateRunning
+}
+
+func nodeArtifactFiles(dir string) []string {
+	files := []string{}
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(filepath.Dir(dir), path); err == nil {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+// WriteDoctorReport prints rep for operators.
+func WriteDoctorReport(w io.Writer, rep DoctorReport) {
+	fmt.Fprintf(w, "run:        %s\n", rep.RunDir)
+	fmt.Fprintf(w, "state:      %s\n", rep.State)
+	if rep.HeartbeatAt != "" {
+		fmt.Fprintf(w, "heartbeat:  %s\n", rep.HeartbeatAt)
+	}
+	if rep.Lock != nil {
+		status := "stale"
+		if rep.Lock.Live {
+			status = "live"
+		}
+		fmt.Fprintf(w, "lock:       pid %d on %s since %s (%s)\n", rep.Lock.PID, rep.Lock.Host, rep.Lock.AcquiredAt, status)
+	}
+	if rep.LastEvent != "" {
+		fmt.Fprintf(w, "last event: %s at %s\n", rep.LastEvent, rep.LastEventAt)
+	}
+	if rep.InFlightNode != "" {
+		fmt.Fprintf(w, "in flight:  %s\n", rep.InFlightNode)
+		if rep.DiscardPartialArtifacts {
+			fmt.Fprintf(w, "  partial artifacts (discard; the node reruns on resume): %s\n", strings.Join(rep.PartialArtifacts, ", "))
+		}
+	}
+	for _, tail := range rep.CorruptTails {
+		fmt.Fprintf(w, "corrupt:    %s: %d trailing line(s), %d bytes at offset %d\n", tail.File, tail.Lines, tail.Bytes, tail.Offset)
+	}
+	for _, c := range rep.CorruptLines {
+		fmt.Fprintf(w, "corrupt:    %s: %d line(s) skipped by readers (lines %v)\n", c.File, len(c.Lines), c.Lines)
+	}
+	for _, r := range rep.Repairs {
+		fmt.Fprintf(w, "repaired:   %s\n", r)
+	}
+	if rep.Resumable {
+		fmt.Fprintln(w, "resumable:  yes")
+		return
+	}
+	fmt.Fprintf(w, "resumable:  no (%s)\n", strings.Join(rep.Problems, "; "))
+}
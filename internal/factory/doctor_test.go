@@ -0,0 +1,263 @@
+package attractor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const doctorDOT = `digraph G { start [shape=Mdiamond]; a [shape=box]; b [shape=box]; exit [shape=Msquare]; start -> a; a -> b; b -> exit; }`
+
+// exitedPID returns the pid of a process that has already exited.
+func exitedPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("true is not available")
+	}
+	return cmd.Process.Pid
+}
+
+// simulateCrash makes runDir look like its process died while node was
+// running: a stale state and lock, an unfinished stage, partial artifacts,
+// and a half-written event line.
+func simulateCrash(t *testing.T, runDir, node string, heartbeat time.Time) {
+	t.Helper()
+	host, _ := os.Hostname()
+	pid := exitedPID(t)
+	at := heartbeat.UTC().Format(time.RFC3339Nano)
+	if err := writeJSONAtomic(filepath.Join(runDir, runStateFile), RunState{State: "running:" + node, Node: node, PID: pid, Host: host, UpdatedAt: at, HeartbeatAt: at}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSON(filepath.Join(runDir, runLockFile), runLock{PID: pid, Host: host, AcquiredAt: at}); err != nil {
+		t.Fatal(err)
+	}
+	appendLine(t, filepath.Join(runDir, "events.jsonl"), `{"type":"StageStarted","node_id":"`+node+`","at":"`+at+`"}`+"\n"+`{"type":"StageCompl`)
+	writeFile(t, filepath.Join(runDir, node, "prompt.md"), "partial")
+}
+
+func TestRunStateTracksTransitions(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, doctorDOT)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rs1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "rs1")
+	st, err := readRunState(runDir)
+	if err != nil || st.State != RunStateCompleted || st.PID != os.Getpid() || st.HeartbeatAt == "" {
+		t.Fatalf("run.state = %+v (%v)", st, err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, runLockFile)); !os.IsNotExist(err) {
+		t.Fatalf("run.lock not released: %v", err)
+	}
+	rep, err := DiagnoseRun(runDir)
+	if err != nil || rep.Resumable || rep.State != RunStateCompleted || rep.LastEvent != "PipelineCompleted" {
+		t.Fatalf("report = %+v (%v)", rep, err)
+	}
+	err = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rs1", Resume: true})
+	if !errors.Is(err, ErrRunCompleted) {
+		t.Fatalf("resume of completed run: %v", err)
+	}
+}
+
+func TestDoctorDiagnosesAndRepairsCrashedRun(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	workdir, runsdir, pipeline := setupRun(t, doctorDOT)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rs2"}); err == nil {
+		t.Fatal("expected test stop error")
+	}
+	runDir := filepath.Join(runsdir, "rs2")
+	simulateCrash(t, runDir, "b", time.Now().Add(-time.Hour))
+
+	rep, err := DiagnoseRun(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Resumable || rep.State != "running:b" || rep.InFlightNode != "b" || rep.Lock == nil || rep.Lock.Live {
+		t.Fatalf("report = %+v", rep)
+	}
+	if !rep.DiscardPartialArtifacts || strings.Join(rep.PartialArtifacts, ",") != "b/prompt.md" {
+		t.Fatalf("partial artifacts = %v", rep.PartialArtifacts)
+	}
+	if len(rep.CorruptTails) != 1 || rep.CorruptTails[0].File != "events.jsonl" || rep.CorruptTails[0].Lines != 1 {
+		t.Fatalf("corrupt tails = %+v", rep.CorruptTails)
+	}
+	var out strings.Builder
+	WriteDoctorReport(&out, rep)
+	for _, want := range []string{"state:      running:b", "(stale)", "in flight:  b", "resumable:  yes"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, out.String())
+		}
+	}
+
+	// Resume runs the doctor itself, then finishes the run.
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rs2", Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range readJSONLRecords(t, filepath.Join(runDir, "events.jsonl")) {
+		if rec == nil {
+			t.Fatal("corrupt event line survived the resume")
+		}
+	}
+	if st, _ := readRunState(runDir); st.State != RunStateCompleted {
+		t.Fatalf("run.state after resume = %+v", st)
+	}
+}
+
+func TestResumeRefusesLiveLock(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	workdir, runsdir, pipeline := setupRun(t, doctorDOT)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rs3"})
+	runDir := filepath.Join(runsdir, "rs3")
+	host, _ := os.Hostname()
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if err := writeJSONAtomic(filepath.Join(runDir, runStateFile), RunState{State: "running:b", PID: os.Getpid(), Host: host, UpdatedAt: now, HeartbeatAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSON(filepath.Join(runDir, runLockFile), runLock{PID: os.Getpid(), Host: host, AcquiredAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rs3", Resume: true})
+	if !errors.Is(err, ErrRunLocked) {
+		t.Fatalf("expected ErrRunLocked, got %v", err)
+	}
+	rep, err := DiagnoseRun(runDir)
+	if err != nil || rep.Resumable || rep.Lock == nil || !rep.Lock.Live {
+		t.Fatalf("report = %+v (%v)", rep, err)
+	}
+	if err := RepairRun(&rep); !errors.Is(err, ErrRunLocked) {
+		t.Fatalf("repair of a live run: %v", err)
+	}
+}
+
+func TestResumeOfCompletedRunLeavesArtifactsUntouched(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, doctorDOT)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rs5"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "rs5")
+	files := []string{"manifest.json", "events.jsonl", "trace.jsonl", "checkpoint.json", "run.log", filepath.Join("..", runIndexFile)}
+	snapshot := func() map[string]string {
+		out := map[string]string{}
+		for _, f := range files {
+			b, err := os.ReadFile(filepath.Join(runDir, f))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out[f] = string(b)
+		}
+		return out
+	}
+	before := snapshot()
+	for i := 0; i < 2; i++ {
+		// The second resume simulates a crash after the exit's checkpoint,
+		// before run.state recorded the completion.
+		if i == 1 {
+			if err := writeJSONAtomic(filepath.Join(runDir, runStateFile), RunState{State: "running:exit", PID: 1 << 30, Host: "gone", UpdatedAt: "2020-01-01T00:00:00Z", HeartbeatAt: "2020-01-01T00:00:00Z"}); err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, runStateFile)
+			before = snapshot()
+		}
+		err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rs5", Resume: true})
+		if !errors.Is(err, ErrRunCompleted) {
+			t.Fatalf("resume %d err = %v", i+1, err)
+		}
+	}
+	after := snapshot()
+	for _, f := range files {
+		if before[f] != after[f] {
+			t.Fatalf("%s changed on resume of a completed run", f)
+		}
+	}
+}
+
+func TestCorruptJSONLTailOnlyCoversTrailingLines(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "events.jsonl")
+	writeFile(t, p, "{\"a\":1}\nnot json\n{\"b\":2}\n{\"c\"\ngarbage")
+	tail, ok, err := corruptJSONLTail(p)
+	if err != nil || !ok || tail.Lines != 2 || tail.Offset != int64(len("{\"a\":1}\nnot json\n{\"b\":2}\n")) {
+		t.Fatalf("tail = %+v %v %v", tail, ok, err)
+	}
+	writeFile(t, p, "{\"a\":1}\n")
+	if _, ok, _ := corruptJSONLTail(p); ok {
+		t.Fatal("clean file reported corrupt")
+	}
+}
+
+func TestRunQueueTakesOverStaleRun(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	root := t.TempDir()
+	queueDir, runsdir := filepath.Join(root, "queue"), filepath.Join(root, "runs")
+	writeFile(t, filepath.Join(root, "work", "README.md"), "hi\n")
+	writeFile(t, filepath.Join(queueDir, "p.dot"), doctorDOT)
+	job := QueueJob{PipelinePath: "p.dot", Workdir: "../work"}
+	writeQueueJob(t, filepath.Join(queueDir, "running"), "crashed.json", job)
+	_ = RunPipeline(RunConfig{PipelinePath: filepath.Join(queueDir, "p.dot"), Workdir: filepath.Join(root, "work"), Runsdir: runsdir, RunID: "crashed"})
+	simulateCrash(t, filepath.Join(runsdir, "crashed"), "b", time.Now().Add(-time.Hour))
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+
+	q := &RunQueue{QueueDir: queueDir, Runsdir: runsdir}
+	if err := q.RunPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	res := readQueueResult(t, filepath.Join(queueDir, "done", "crashed.result.json"))
+	if res.Status != "completed" || res.RunID != "crashed" {
+		t.Fatalf("result = %+v", res)
+	}
+}
+
+func TestDoctorRepairRebuildsTraceIndex(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, `digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a -> exit; }`)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ti1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ti1")
+	tracePath := filepath.Join(runDir, traceFile)
+	b, err := os.ReadFile(tracePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := bytes.IndexByte(b, '\n')
+	writeFile(t, tracePath, "{corrupt\n"+string(b[first+1:]))
+
+	// The index is stale now; explain falls back to a scan.
+	if rec, found, err := lastRouteRecord(runDir, "a"); err != nil || !found || rec["next_node"] != "exit" {
+		t.Fatalf("stale index lookup = %v %v %v", rec, found, err)
+	}
+	rep, err := DiagnoseRun(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RepairRun(&rep); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(rep.Repairs, "\n"), "rebuilt trace.index.jsonl") {
+		t.Fatalf("repairs = %v", rep.Repairs)
+	}
+	index, err := readTraceIndex(runDir)
+	if err != nil || len(index) == 0 {
+		t.Fatalf("index = %v, %v", index, err)
+	}
+	for _, entry := range index {
+		if _, err := readTraceRecordAt(runDir, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rec, found, err := lastRouteRecord(runDir, "a"); err != nil || !found || rec["next_node"] != "exit" {
+		t.Fatalf("rebuilt index lookup = %v %v %v", rec, found, err)
+	}
+}
@@ -0,0 +1,137 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrPipelineHasComments is returned by FormatDOT for sources with comment
+// lines, which the formatter would drop.
+var ErrPipelineHasComments = errors.New("pipeline has comments, which fmt cannot keep; move them into comment attributes")
+
+// FormatDOT re-emits a pipeline in canonical form: graph attributes first,
+// then nodes with start nodes first, the rest in topological order from the
+// start and exits last, then edges grouped by source in that order. Edges
+// from one node keep their relative order, which routing depends on.
+// Attributes are sorted and quoted as ToDOT writes them, and edge
+// conditions are normalized. Node and edge default statements are folded
+// into the statements they applied to, and matrix nodes stay unexpanded.
+// group_edge statements come last, unexpanded, each with an expands_to
+// attribute listing the nodes ParseDOT adds its edge to.
+func FormatDOT(source string) (string, error) {
+	if stripComments(source) != source {
+		return "", ErrPipelineHasComments
+	}
+	g, err := parseDOTStatements(source)
+	if err != nil {
+		return "", err
+	}
+	if len(g.GroupEdges) > 0 {
+		expanded, err := ParseDOT(source)
+		if err != nil {
+			return "", err
+		}
+		for i, ge := range g.GroupEdges {
+			ge.Expanded = expanded.GroupEdges[i].Expanded
+		}
+	}
+	attrSets := []map[string]Value{}
+	for _, e := range g.Edges {
+		attrSets = append(attrSets, e.Attrs)
+	}
+	for _, ge := range g.GroupEdges {
+		attrSets = append(attrSets, ge.Attrs)
+	}
+	for _, attrs := range attrSets {
+		if raw, ok := attrs["condition"].(string); ok {
+			attrs["condition"] = normalizeCondition(raw)
+		}
+	}
+	order := canonicalNodeOrder(g)
+	rank := make(map[string]int, len(order))
+	for i, id := range order {
+		rank[id] = i
+	}
+	edges := append([]*Edge{}, g.Edges...)
+	sort.SliceStable(edges, func(i, j int) bool { return rank[edges[i].From] < rank[edges[j].From] })
+	return writeDOT(g, order, edges), nil
+}
+
+// canonicalNodeOrder lists start nodes, then the nodes reachable from them
+// in reverse postorder (a topological order when the graph has no cycles),
+// then unreachable nodes, then exits. Ties go by ID and outgoing edge order.
+func canonicalNodeOrder(g *Graph) []string {
+	ids := sortedKeys(g.Nodes)
+	out := []string{}
+	placed := map[string]bool{}
+	starts := []string{}
+	for _, id := range ids {
+		if isStartNode(g.Nodes[id]) {
+			starts = append(starts, id)
+			placed[id] = true
+		}
+	}
+	out = append(out, starts...)
+	succ := map[string][]string{}
+	for _, e := range g.Edges {
+		succ[e.From] = append(succ[e.From], e.To)
+	}
+	seen := map[string]bool{}
+	var post []string
+	var visit func(id string)
+	visit = func(id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		for _, to := range succ[id] {
+			visit(to)
+		}
+		post = append(post, id)
+	}
+	exits := []string{}
+	place := func() {
+		for i := len(post) - 1; i >= 0; i-- {
+			id := post[i]
+			switch {
+			case placed[id] || g.Nodes[id] == nil:
+			case isExit(g, id):
+				exits = append(exits, id)
+			default:
+				out = append(out, id)
+			}
+			placed[id] = true
+		}
+		post = nil
+	}
+	for _, id := range starts {
+		visit(id)
+	}
+	place()
+	for _, id := range ids {
+		visit(id)
+		place()
+	}
+	sort.Strings(exits)
+	return append(out, exits...)
+}
+
+// normalizeCondition rewrites a condition with the outcome clause first and
+// single spaces around && and comparison operators. Conditions that do not
+// parse are only trimmed, so validation still reports them as written.
+func normalizeCondition(raw string) string {
+	c, err := parseCondition(raw)
+	if err != nil {
+		return strings.TrimSpace(raw)
+	}
+	clauses := []string{}
+	if c.Outcome != "" {
+		clauses = append(clauses, "outcome="+c.Outcome)
+	}
+	for _, v := range c.Visits {
+		clauses = append(clauses, fmt.Sprintf("visits(%s) %s %d", formatDOTID(v.Node), v.Op, v.N))
+	}
+	return strings.Join(clauses, " && ")
+}
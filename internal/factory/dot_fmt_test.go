@@ -0,0 +1,102 @@
+package attractor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const unformattedDOT = `digraph G {
+	node [shape=box];
+	exit [shape=Msquare];
+	b [prompt="do b"];
+	start [shape=Mdiamond];
+	a [prompt="do a", max_retries=2];
+	graph [goal="x"];
+	orphan;
+	start -> a;
+	a -> b [condition=" visits(a)>=2&&outcome=fail "];
+	a -> exit [condition="outcome=success"];
+	b -> a;
+}`
+
+func TestFormatDOTRoundTripsExamples(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "examples", "*.dot"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("examples: %v (%d found)", err, len(paths))
+	}
+	sources := map[string]string{"inline": unformattedDOT}
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources[p] = string(b)
+	}
+	for name, src := range sources {
+		want, err := ParseDOT(src)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out, err := FormatDOT(src)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := ParseDOT(out)
+		if err != nil {
+			t.Fatalf("%s: formatted output does not parse: %v\n%s", name, err, out)
+		}
+		for _, e := range want.Edges {
+			if raw, ok := e.Attrs["condition"].(string); ok {
+				e.Attrs["condition"] = normalizeCondition(raw)
+			}
+		}
+		if !reflect.DeepEqual(got.Attrs, want.Attrs) || !reflect.DeepEqual(got.Nodes, want.Nodes) || !reflect.DeepEqual(edgesByID(got), edgesByID(want)) {
+			t.Fatalf("%s: fmt changed the graph:\n%s", name, out)
+		}
+		if again, err := FormatDOT(out); err != nil || again != out {
+			t.Fatalf("%s: fmt is not idempotent (%v):\n%s\n---\n%s", name, err, out, again)
+		}
+	}
+}
+
+func edgesByID(g *Graph) map[string]*Edge {
+	out := map[string]*Edge{}
+	for _, e := range g.Edges {
+		out[e.ID] = e
+	}
+	return out
+}
+
+func TestFormatDOTCanonicalLayout(t *testing.T) {
+	out, err := FormatDOT(unformattedDOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph G {
+  graph [goal="x"];
+  start [shape="Mdiamond"];
+  a [max_retries=2, prompt="do a", shape="box"];
+  b [prompt="do b", shape="box"];
+  orphan [shape="box"];
+  exit [shape="Msquare"];
+  start -> a;
+  a -> b [condition="outcome=fail && visits(a) >= 2"];
+  a -> exit [condition="outcome=success"];
+  b -> a;
+}
+`
+	if out != want {
+		t.Fatalf("FormatDOT =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestFormatDOTRefusesComments(t *testing.T) {
+	src := strings.Replace(unformattedDOT, "orphan;", "// keep me\n\torphan;", 1)
+	if _, err := FormatDOT(src); !errors.Is(err, ErrPipelineHasComments) {
+		t.Fatalf("err = %v", err)
+	}
+}
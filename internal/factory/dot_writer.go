@@ -0,0 +1,112 @@
+package attractor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bareAttrKeyRe matches attribute keys written without quotes; dotted keys
+// such as "codex.model" are quoted.
+var bareAttrKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ToDOT serializes g as canonical DOT: graph attributes, then nodes in ID
+// order, then edges in graph order, each with attributes in key order.
+// ParseDOT of the result yields an equivalent graph, so it is what a run
+// embeds when it is given a *Graph instead of a file.
+func (g *Graph) ToDOT() string {
+	return writeDOT(g, sortedKeys(g.Nodes), g.Edges)
+}
+
+// writeDOT writes g's attributes, then the nodes in order, then edges, then
+// group_edge statements with the members each expanded to.
+func writeDOT(g *Graph, order []string, edges []*Edge) string {
+	var b strings.Builder
+	b.WriteString("digraph G {\n")
+	if len(g.Attrs) > 0 {
+		b.WriteString("  graph [" + formatDOTAttrs(g.Attrs) + "];\n")
+	}
+	for _, id := range order {
+		b.WriteString("  " + formatDOTID(id))
+		if attrs := g.Nodes[id].Attrs; len(attrs) > 0 {
+			b.WriteString(" [" + formatDOTAttrs(attrs) + "]")
+		}
+		b.WriteString(";\n")
+	}
+	for _, e := range edges {
+		b.WriteString("  " + formatDOTID(e.From) + " -> " + formatDOTID(e.To))
+		if len(e.Attrs) > 0 {
+			b.WriteString(" [" + formatDOTAttrs(e.Attrs) + "]")
+		}
+		b.WriteString(";\n")
+	}
+	for _, ge := range g.GroupEdges {
+		attrs := make(map[string]Value, len(ge.Attrs)+1)
+		for k, v := range ge.Attrs {
+			attrs[k] = v
+		}
+		if len(ge.Expanded) > 0 {
+			attrs[groupEdgeExpandsToAttr] = strings.Join(ge.Expanded, ",")
+		}
+		b.WriteString("  " + groupEdgeKeyword + " " + formatDOTID(ge.Group) + " -> " + formatDOTID(ge.To))
+		if len(attrs) > 0 {
+			b.WriteString(" [" + formatDOTAttrs(attrs) + "]")
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func formatDOTID(id string) string {
+	if idRe.MatchString(id) {
+		return id
+	}
+	return strconv.Quote(id)
+}
+
+func formatDOTAttrs(attrs map[string]Value) string {
+	parts := make([]string, 0, len(attrs))
+	for _, k := range sortedKeys(attrs) {
+		key := k
+		if !bareAttrKeyRe.MatchString(k) {
+			key = strconv.Quote(k)
+		}
+		parts = append(parts, key+"="+formatDOTValue(attrs[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatDOTValue writes v so parseValue reads back the same type: strings
+// are always quoted, floats always carry a decimal point, and durations use
+// the largest v0 unit that divides them.
+func formatDOTValue(v Value) string {
+	switch t := v.(type) {
+	case string:
+		return strconv.Quote(t)
+	case bool:
+		return strconv.FormatBool(t)
+	case int:
+		return strconv.Itoa(t)
+	case float64:
+		s := strconv.FormatFloat(t, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEIN") {
+			s += ".0"
+		}
+		return s
+	case time.Duration:
+		for _, u := range []struct {
+			suffix string
+			d      time.Duration
+		}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}} {
+			if t != 0 && t%u.d == 0 {
+				return strconv.FormatInt(int64(t/u.d), 10) + u.suffix
+			}
+		}
+		return strconv.FormatInt(t.Milliseconds(), 10) + "ms"
+	default:
+		return strconv.Quote(fmt.Sprintf("%v", t))
+	}
+}
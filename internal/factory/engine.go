@@ -25,6 +25,11 @@ type Outcome struct {
 	ContextUpdates     map[string]any `json:"context_updates"`
 	Notes              string         `json:"notes"`
 	FailureReason      string         `json:"failure_reason"`
+	FailureCode        FailureCode    `json:"failure_code,omitempty"`
+	// DisabledBy is "attr" or "cli" when the node was disabled and skipped.
+	DisabledBy string `json:"disabled_by,omitempty"`
+	// AttemptID is the attempt that produced the outcome (see attempt_id).
+	AttemptID string `json:"attempt_id,omitempty"`
 }
 
 type Checkpoint struct {
@@ -34,25 +39,151 @@ type Checkpoint struct {
 	CompletedNodes    []string       `json:"completed_nodes"`
 	RetryCounts       map[string]int `json:"retry_counts"`
 	Context           map[string]any `json:"context"`
+	Loop              *LoopProgress  `json:"loop,omitempty"`
+	// Foreach is the in-flight foreach node, if any.
+	Foreach *ForeachProgress `json:"foreach,omitempty"`
+	// WorkspaceDigest hashes the workspace's sorted path/hash pairs when the
+	// checkpoint was written. WorkspaceFiles keeps the pairs so a resume can
+	// name the paths that changed.
+	WorkspaceDigest string            `json:"workspace_digest,omitempty"`
+	WorkspaceFiles  map[string]string `json:"workspace_files,omitempty"`
+	// Totals carries the run-wide attempt, retry, and visit counts.
+	Totals *RunTotals `json:"totals,omitempty"`
 }
 
 type fileState struct {
-	Size int64
-	Hash string
+	Size     int64
+	Hash     string
+	ModTime  time.Time
+	Mode     fs.FileMode
+	Content  []byte
+	Retained bool
+	// Symlink holds the link target when the path is a symlink; Hash and Size
+	// then describe the target string rather than the target content.
+	Symlink string
 }
 
 type workspaceDiff struct {
 	Created  []string `json:"created"`
 	Modified []string `json:"modified"`
 	Deleted  []string `json:"deleted"`
+	// ExcludedWrites counts changed paths that snapshot_excludes kept out of
+	// the lists above. It is informational; the guardrail ignores them.
+	ExcludedWrites int `json:"excluded_writes,omitempty"`
+	// Backend is how the after-snapshot was taken (--diff-backend);
+	// BackendFallback is why a requested watch was not used.
+	Backend         string `json:"backend,omitempty"`
+	BackendFallback string `json:"backend_fallback,omitempty"`
 }
 
 type RunConfig struct {
 	PipelinePath string
-	Workdir      string
-	Runsdir      string
-	RunID        string
-	Resume       bool
+	// PipelineSource is DOT text to run instead of reading PipelinePath
+	// (`factory run -` reads it from stdin).
+	PipelineSource string
+	// Graph is a pre-built pipeline (see GraphBuilder) to run instead of DOT
+	// text. Its ToDOT serialization is what the run parses and embeds.
+	Graph   *Graph
+	Workdir string
+	Runsdir string
+	RunID   string
+	Resume  bool
+	// ReplayResponses maps node IDs to recorded agent responses that replace
+	// live backend calls (see agent.replay_response).
+	ReplayResponses map[string]string
+	// MarkNodes overrides node outcomes before resuming (--mark-node); routing
+	// resumes from the last one. MarkNote and MarkForce qualify them.
+	MarkNodes []NodeOutcomeOverride
+	MarkNote  string
+	MarkForce bool
+	// EnableOTel exports the run as spans. SpanExporter overrides the default
+	// OTLP/HTTP exporter configured from OTEL_EXPORTER_OTLP_* variables.
+	EnableOTel   bool
+	SpanExporter SpanExporter
+	// Params resolve ${param.<name>} references in node attributes, over
+	// graph-level param.<name> defaults (--param name=value).
+	Params map[string]string
+	// FakeTools scripts tool nodes from test.tool_* attributes instead of
+	// running tool_command (also enabled by ATTRACTION_FAKE_TOOLS=1).
+	FakeTools bool
+	// Notify posts run outcomes to a webhook; see NotifyConfig.
+	Notify NotifyConfig
+	// Metrics receives run, stage, retry, and guardrail metrics when set.
+	Metrics MetricsRegistry
+	// AcceptWorkspaceDrift lets a resume continue when the workspace changed
+	// since the last checkpoint (--accept-workspace-drift).
+	AcceptWorkspaceDrift bool
+	// Stop ends the run after the stage in progress finishes and is
+	// checkpointed; RunPipeline then returns ErrRunStopped and the run can be
+	// resumed.
+	Stop <-chan struct{}
+	// NoCache bypasses the tool result cache: cache=true nodes neither read
+	// nor populate <runsdir>/.cache (--no-cache).
+	NoCache bool
+	// MinFreeBytes is the free space the runs dir filesystem must keep. It
+	// is the floor for the preflight headroom check (which also requires
+	// twice the workdir size) and is checked between stages
+	// (--min-free-bytes, default 64 MiB).
+	MinFreeBytes uint64
+	// AdditionalWorkdirs are copied into the workspace under their mountpoints
+	// alongside Workdir on a fresh run (--add-workdir path=mountpoint).
+	AdditionalWorkdirs []AdditionalWorkdir
+	// ReportFormats selects CI reports written to the run dir when the run
+	// ends: junit (report.junit.xml) and sarif (report.sarif.json)
+	// (--report-formats).
+	ReportFormats []string
+	// Progress receives one human-oriented line per stage (--progress).
+	// Colors and a spinner are used only when it is a terminal.
+	Progress io.Writer
+	// StrictValidation turns validation warnings into errors (--strict).
+	StrictValidation bool
+	// FailFastOnGuardrail ends the run with ErrGuardrailViolation after the
+	// first node that writes outside its allowed_write_paths, instead of
+	// routing on its fail outcome (--fail-fast-guardrail).
+	FailFastOnGuardrail bool
+	// PromptMiddlewares transform codergen prompts, in order, after the
+	// enabled built-ins (failure feedback, verification allowlist).
+	PromptMiddlewares []PromptMiddleware
+	// LogFile receives every log record from the point the run dir exists,
+	// as JSON, in addition to stderr (--log-file, default <runDir>/run.log).
+	LogFile string
+	// Quiet drops the stderr log handler; LogFile still gets every record
+	// (--quiet).
+	Quiet bool
+	// CheckFiles validates the pipeline with ValidateGraphWithWorkdir on a
+	// fresh run, so scripts and directories it names must exist in Workdir
+	// (--check-files, or graph attr check_files=true).
+	CheckFiles bool
+	// RetryOf is the id of the run, in the same runs dir, that this fresh
+	// run retries (see RerunConfig). It is recorded as retry_of in the new
+	// manifest and the new id is appended to the old run's retried_by.
+	RetryOf string
+	// DisableNodes skips these nodes for this invocation only, as if they
+	// set disabled=true (--disable-node, repeatable). The manifest records
+	// them as disabled_nodes for the session.
+	DisableNodes []string
+	// EntryNode picks the start node of a multi_entry graph (--entry). It
+	// is required when the graph has more than one start node and is
+	// recorded as entry_node in the manifest; resume uses the recorded one.
+	EntryNode string
+	// GraphAttrDefaults are graph attributes applied when the pipeline does
+	// not set them, before validation (a profile's graph_attrs).
+	GraphAttrDefaults map[string]string
+	// Profile is the profile ApplyProfile filled this config from; it is
+	// recorded as profile in the manifest.
+	Profile *AppliedProfile
+	// GitSource replaces Workdir: a fresh run checks the ref out into its
+	// workspace and records the commit as git_source in the manifest. A
+	// resume keeps the workspace it already has.
+	GitSource *GitSource
+	// EscalationMode is what happens when a verification command is outside
+	// its node's allowlist: fail (the default) fails the node, interactive
+	// waits for `factory escalation approve|deny` (--escalation-mode).
+	EscalationMode string
+	// DiffBackend is how stages find the files their handler changed:
+	// snapshot (the default) walks the workspace, watch uses an inotify
+	// watcher on Linux, and auto watches only large workspaces.
+	DiffBackend string
 }
 
 type Handler interface {
@@ -68,23 +199,97 @@ type Engine struct {
 	RetryCount map[string]int
 	Completed  map[string]bool
 	Logger     *slog.Logger
+	// attempt is the handler attempt in progress; its id stamps the
+	// node's events and trace records.
+	attempt attemptState
+	// loop tracks the active manager loop so checkpoints can resume mid-loop.
+	loop *LoopProgress
+	// foreach tracks the active foreach node so checkpoints can resume
+	// mid-list.
+	foreach *ForeachProgress
+	// lastCompleted is the last_completed_node of the latest checkpoint.
+	lastCompleted string
+	// snapshotSeed holds hashes from copy verification, consumed by the first
+	// pre-node workspace snapshot.
+	snapshotSeed map[string]fileState
+	// telemetry mirrors recorded events into spans; nil when disabled.
+	telemetry *runTelemetry
+	// fakeTools swaps toolHandler for fakeToolHandler.
+	fakeTools bool
+	// notifier posts webhook notifications; nil when no notify_url is set.
+	notifier *runNotifier
+	// metrics feeds RunConfig.Metrics; nil when disabled.
+	metrics *runMetrics
+	// params resolves ${param.<name>} references.
+	params map[string]string
+	// stop is RunConfig.Stop; nil never fires.
+	stop <-chan struct{}
+	// checkpointSnapshot is the workspace as of the last checkpoint; it seeds
+	// the next checkpoint's digest.
+	checkpointSnapshot map[string]fileState
+	// progress renders console progress lines; nil when disabled.
+	progress *progressRenderer
+	// cacheDir holds tool result cache entries; empty with RunConfig.NoCache.
+	cacheDir string
+	// minFreeBytes is the free space checked for between stages.
+	minFreeBytes uint64
+	// reportFormats are the CI reports written when the run ends.
+	reportFormats []string
+	// runState maintains run.state and holds run.lock.
+	runState *runStateTracker
+	// totals counts attempts, retries, and visits across the run.
+	totals RunTotals
+	// promptMiddlewares are RunConfig.PromptMiddlewares.
+	promptMiddlewares []PromptMiddleware
+	// prompt is the codergen prompt runStage built for the node executing.
+	prompt *preparedPrompt
+	// failFastGuardrail is RunConfig.FailFastOnGuardrail. guardrailPaths
+	// holds the paths that tripped a guardrail in the stage executing.
+	failFastGuardrail bool
+	guardrailPaths    []string
+	// disabled maps disabled node IDs to "attr" or "cli".
+	disabled map[string]string
+	// escalationMode is RunConfig.EscalationMode.
+	escalationMode string
+	// diffBackend is RunConfig.DiffBackend, parsed.
+	diffBackend string
 }
 
+// ErrRunStopped is returned by RunPipeline when RunConfig.Stop fires. The
+// last finished stage is checkpointed, so the run can be resumed.
+var ErrRunStopped = errors.New("run stopped before completion")
+
 func RunPipeline(cfg RunConfig) error {
-	logger := newFactoryLogger()
+	logger := newConsoleLogger(cfg.Quiet)
 	slog.SetDefault(logger)
 	logger.Info("pipeline starting", "pipeline_path", cfg.PipelinePath, "workdir", cfg.Workdir, "runsdir", cfg.Runsdir, "resume", cfg.Resume)
-	b, err := os.ReadFile(cfg.PipelinePath)
+	source, origin, err := loadPipelineSource(cfg)
 	if err != nil {
 		logger.Error("failed to read pipeline", "error", err)
 		return err
 	}
-	g, err := ParseDOT(string(b))
+	if origin != "path" {
+		logger.Info("pipeline loaded", "source", origin)
+	}
+	b := []byte(source)
+	g, err := ParseDOT(source)
 	if err != nil {
 		logger.Error("failed to parse pipeline", "error", err)
 		return err
 	}
+	applyProfileGraphAttrs(g, cfg.GraphAttrDefaults)
+	disabled, err := applyDisabledNodes(g, cfg.DisableNodes)
+	if err != nil {
+		logger.Error("invalid disabled node", "error", err)
+		return err
+	}
 	diags := ValidateGraph(g)
+	if checkFilesEnabled(g, cfg) && !cfg.Resume && cfg.GitSource == nil {
+		diags = ValidateGraphWithWorkdir(g, cfg.Workdir)
+	}
+	if cfg.StrictValidation {
+		diags = StrictDiagnostics(diags)
+	}
 	if HasErrors(diags) {
 		msgs := []string{}
 		for _, d := range diags {
@@ -95,33 +300,228 @@ func RunPipeline(cfg RunConfig) error {
 		logger.Error("pipeline validation failed", "errors", strings.Join(msgs, "; "))
 		return fmt.Errorf("validation failed: %s", strings.Join(msgs, "; "))
 	}
+	for _, d := range diags {
+		if d.Level == "WARN" {
+			logger.Warn("pipeline validation warning", "message", d.Message)
+		}
+	}
+	applyGraphAttrDefaults(g)
+	if _, err := applyReplayResponses(g, cfg.PipelinePath, cfg.ReplayResponses); err != nil {
+		logger.Error("invalid replay configuration", "error", err)
+		return err
+	}
 
 	if cfg.Resume {
 		if cfg.RunID == "" {
 			logger.Error("resume requested without run-id")
 			return fmt.Errorf("--run-id required with --resume")
 		}
+	} else if len(cfg.MarkNodes) > 0 {
+		logger.Error("mark-node requested without resume")
+		return fmt.Errorf("--mark-node requires --resume")
 	} else if cfg.RunID == "" {
 		cfg.RunID = time.Now().UTC().Format("20060102_150405")
 	}
 	runDir := filepath.Join(cfg.Runsdir, cfg.RunID)
 	workspace := filepath.Join(runDir, "workspace")
+	params := pipelineParams(g, cfg.Params)
+	if cfg.Resume {
+		recorded, err := readManifestEntry(runDir)
+		if err == nil && recorded != "" {
+			if cfg.EntryNode != "" && cfg.EntryNode != recorded {
+				logger.Error("entry differs from recorded entry", "entry", cfg.EntryNode, "recorded", recorded)
+				return fmt.Errorf("--entry %s differs from the run's recorded entry %s", cfg.EntryNode, recorded)
+			}
+			cfg.EntryNode = recorded
+		}
+	}
+	entry, err := resolveEntryNode(g, cfg.EntryNode)
+	if err != nil {
+		logger.Error("invalid entry node", "error", err)
+		return err
+	}
+	cfg.EntryNode = entry
+	for _, d := range validateEntry(g, entry) {
+		logger.Warn("pipeline validation warning", "message", d.Message)
+	}
+	if cfg.Resume {
+		if len(cfg.MarkNodes) == 0 && checkpointedAtExit(g, runDir) {
+			logger.Info("run already completed; nothing to resume", "run_id", cfg.RunID)
+			return fmt.Errorf("%w: %s", ErrRunCompleted, runDir)
+		}
+		if err := checkRunLayout(runDir); err != nil {
+			logger.Error("run layout incompatible", "error", err)
+			return err
+		}
+		rep, err := prepareResume(runDir, len(cfg.MarkNodes) > 0)
+		if errors.Is(err, ErrRunCompleted) {
+			logger.Info("run already completed; nothing to resume", "run_id", cfg.RunID)
+			return err
+		}
+		if err != nil {
+			logger.Error("run cannot be resumed", "error", err)
+			return err
+		}
+		for _, r := range rep.Repairs {
+			logger.Warn("repaired run before resume", "repair", r)
+		}
+		if rep.DiscardPartialArtifacts {
+			logger.Warn("in-flight stage left partial artifacts; it will run again", "node", rep.InFlightNode)
+		}
+		recorded, err := readManifestParams(runDir)
+		if err != nil {
+			return err
+		}
+		params = pipelineParams(g, recorded)
+		for k, v := range cfg.Params {
+			params[k] = v
+		}
+	}
+	if err := checkPipelineParams(g, params); err != nil {
+		logger.Error("pipeline params incomplete", "error", err)
+		return err
+	}
+	if err := validateGitSource(cfg); err != nil {
+		logger.Error("invalid git source", "error", err)
+		return err
+	}
+	if _, err := ParseEscalationMode(cfg.EscalationMode); err != nil {
+		logger.Error("invalid escalation mode", "error", err)
+		return err
+	}
+	diffBackend, err := ParseDiffBackend(cfg.DiffBackend)
+	if err != nil {
+		logger.Error("invalid diff backend", "error", err)
+		return err
+	}
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		return err
+	}
+	// The clone comes first so a failed one leaves nothing but the manifest.
+	var gitSource *gitSourceRecord
+	if cfg.Resume {
+		gitSource = gitSourceFromManifest(runDir)
+	} else if cfg.GitSource != nil {
+		rec, err := checkoutGitSource(g, cfg, runDir, workspace)
+		if err != nil {
+			logger.Error("failed to clone git source", "url", rec.URL, "ref", rec.Ref, "error", err)
+			return err
+		}
+		logger.Info("cloned git source", "url", rec.URL, "ref", rec.Ref, "commit", rec.Commit)
+		gitSource = &rec
+		if checkFilesEnabled(g, cfg) {
+			if err := checkGitSourceFiles(g, cfg, workspace, logger); err != nil {
+				return err
+			}
+		}
+	}
+	runLog, err := openRunLog(runDir, cfg.LogFile)
+	if err != nil {
+		logger.Error("failed to open run log", "error", err)
+		return err
+	}
+	defer runLog.close()
+	logger = runLog.runLogger(cfg.Quiet)
+	slog.SetDefault(logger)
+	runState, err := startRunState(runDir, runStateHeartbeat)
+	if err != nil {
+		logger.Error("failed to lock run", "error", err)
+		return err
+	}
+	defer runState.close()
+	if err := checkFreeInodes(cfg.Runsdir, minFreeInodes(g)); err != nil {
+		logger.Error("preflight filesystem check failed", "error", err)
+		return err
+	}
+	if !cfg.Resume {
+		base := cfg.Workdir
+		if gitSource != nil {
+			base = workspace
+		}
+		extras, err := checkAdditionalWorkdirs(base, cfg.AdditionalWorkdirs)
+		if err != nil {
+			logger.Error("invalid additional workdirs", "error", err)
+			return err
+		}
+		cfg.AdditionalWorkdirs = extras
+	}
+	excludes := additionalWorkdirExcludes(cfg.Workdir, cfg.Workdir, cfg.Runsdir, cfg.AdditionalWorkdirs)
+	diskUsage, err := preflightDiskSpace(cfg, excludes)
+	if err != nil {
+		logger.Error("preflight disk space check failed", "error", err)
+		return err
+	}
 
+	manifestExtra := map[string]any{"pipeline_source": source, "disk": diskUsage, "log_file": runLog.path}
+	if len(params) > 0 {
+		manifestExtra["params"] = params
+	}
+	if cfg.Resume {
+		if m, err := readRerunManifest(runDir); err == nil {
+			if cfg.RetryOf == "" {
+				cfg.RetryOf = m.RetryOf
+			}
+			if len(m.RetriedBy) > 0 {
+				manifestExtra["retried_by"] = m.RetriedBy
+			}
+		}
+	}
+	if cfg.RetryOf != "" {
+		manifestExtra["retry_of"] = cfg.RetryOf
+	}
+	var snapshotSeed map[string]fileState
 	if cfg.Resume {
 	} else {
 		if err := os.MkdirAll(workspace, 0o755); err != nil {
 			logger.Error("failed to create workspace", "workspace", workspace, "error", err)
 			return err
 		}
-		excludes := []string{".git"}
-		if relRuns, ok := relativeDescendant(cfg.Workdir, cfg.Runsdir); ok {
-			excludes = append(excludes, relRuns)
-			logger.Info("excluding runsdir from workspace copy", "relative_path", relRuns)
+		skipped, copied := []string{}, map[string]copiedFile{}
+		if gitSource == nil {
+			if relRuns, ok := relativeDescendant(cfg.Workdir, cfg.Runsdir); ok {
+				logger.Info("excluding runsdir from workspace copy", "relative_path", relRuns)
+			}
+			skipped, copied, err = copyDirRecording(cfg.Workdir, workspace, excludes)
+			if err != nil {
+				logger.Error("failed to copy workdir into workspace", "error", err)
+				return err
+			}
 		}
-		if err := copyDir(cfg.Workdir, workspace, excludes); err != nil {
-			logger.Error("failed to copy workdir into workspace", "error", err)
+		extraRecords, err := copyAdditionalWorkdirs(cfg, workspace, copied, &skipped)
+		if err != nil {
+			logger.Error("failed to copy additional workdirs into workspace", "error", err)
 			return err
 		}
+		var copiedBytes int64
+		for _, f := range copied {
+			copiedBytes += f.SourceSize
+		}
+		mode, err := copyVerifyMode(g, copiedBytes)
+		if err != nil {
+			return err
+		}
+		verification, seed, err := verifyWorkspaceCopy(workspace, copied, mode, graphIntAttr(g, "copy.verify_sample_files", defaultCopyVerifySampleFiles))
+		if err != nil {
+			return err
+		}
+		if err := verification.err(); err != nil {
+			logger.Error("workspace copy verification failed", "mismatches", verification.Mismatches)
+			return err
+		}
+		if mode != "off" {
+			logger.Info("workspace copy verified", "mode", mode, "verified_files", verification.VerifiedFiles, "total_files", verification.TotalFiles)
+			manifestExtra["copy_verification"] = verification
+		}
+		snapshotSeed = seed
+		if len(extraRecords) > 0 {
+			manifestExtra["additional_workdirs"] = extraRecords
+		}
+		for _, p := range skipped {
+			logger.Warn("skipping symlink that resolves outside workdir", "path", p)
+		}
+		if len(skipped) > 0 {
+			manifestExtra["skipped_symlinks"] = skipped
+		}
 	}
 	if err := os.MkdirAll(filepath.Join(workspace, ".attractor"), 0o755); err != nil {
 		return err
@@ -129,10 +529,54 @@ func RunPipeline(cfg RunConfig) error {
 	if err := os.MkdirAll(runDir, 0o755); err != nil {
 		return err
 	}
-	if err := writeManifest(g, cfg, runDir, workspace); err != nil {
+	if !cfg.Resume {
+		if err := os.WriteFile(filepath.Join(runDir, "pipeline.dot"), b, 0o644); err != nil {
+			logger.Error("failed to embed pipeline copy", "error", err)
+			return err
+		}
+	}
+	manifestExtra["environment"] = collectEnvFingerprint(runDir)
+	fakeTools := cfg.FakeTools || fakeToolsFromEnv()
+	if fakeTools {
+		manifestExtra["fake_tools"] = true
+	}
+	if !cfg.Resume {
+		runEnv := captureRunEnvironment(g, cfg.Workdir, workspace)
+		if gitSource != nil {
+			runEnv.GitCommit = gitSource.Commit
+		}
+		if err := writeJSON(filepath.Join(runDir, runEnvironmentFile), runEnv); err != nil {
+			logger.Warn("failed to write environment capture", "error", err)
+		}
+	}
+	if len(disabled) > 0 {
+		manifestExtra["disabled_nodes"] = disabled
+	}
+	manifestExtra["entry_node"] = entry
+	if gitSource != nil {
+		manifestExtra["git_source"] = gitSource
+	}
+	if cfg.Profile != nil {
+		manifestExtra["profile"] = cfg.Profile
+	}
+	if err := writeManifest(g, cfg, runDir, workspace, manifestExtra); err != nil {
 		logger.Error("failed to write manifest", "error", err)
 		return err
 	}
+	startRec := runIndexRecord{RunID: cfg.RunID, Event: "started", Status: RunStateRunning, StartedAt: time.Now().UTC().Format(time.RFC3339Nano), Goal: indexGoal(g.Attrs["goal"]), RetryOf: cfg.RetryOf}
+	if err := appendRunIndex(cfg.Runsdir, startRec); err != nil {
+		logger.Warn("failed to append run index", "error", err)
+	}
+	if cfg.RetryOf != "" && !cfg.Resume {
+		if err := linkRetry(filepath.Join(cfg.Runsdir, cfg.RetryOf), cfg.RunID); err != nil {
+			logger.Warn("failed to link retried run", "retry_of", cfg.RetryOf, "error", err)
+		}
+	}
+	journal, err := startTraceJournal(runDir, traceRotateBytes(g))
+	if err != nil {
+		return err
+	}
+	defer journal.close()
 	_ = appendTrace(runDir, "SessionInitialized", map[string]any{
 		"run_id":        cfg.RunID,
 		"pipeline_path": cfg.PipelinePath,
@@ -141,23 +585,78 @@ func RunPipeline(cfg RunConfig) error {
 		"resume":        cfg.Resume,
 	})
 
-	e := &Engine{Graph: g, RunID: cfg.RunID, RunDir: runDir, Workspace: workspace, Context: Context{}, RetryCount: map[string]int{}, Completed: map[string]bool{}, Logger: logger}
+	e := &Engine{Graph: g, RunID: cfg.RunID, RunDir: runDir, Workspace: workspace, Context: Context{}, RetryCount: map[string]int{}, Completed: map[string]bool{}, Logger: logger, snapshotSeed: snapshotSeed, totals: newRunTotals()}
+	e.telemetry = newRunTelemetry(cfg, g, logger)
+	e.fakeTools = fakeTools
+	e.metrics = newRunMetrics(cfg, g)
+	e.params = params
+	e.progress = newRunProgress(cfg)
+	e.stop = cfg.Stop
+	e.failFastGuardrail = cfg.FailFastOnGuardrail
+	e.escalationMode = cfg.EscalationMode
+	e.diffBackend = diffBackend
+	if !cfg.NoCache {
+		e.cacheDir = filepath.Join(cfg.Runsdir, ".cache")
+	}
+	e.minFreeBytes = diskUsage.MinFreeBytes
+	e.reportFormats = cfg.ReportFormats
+	e.promptMiddlewares = cfg.PromptMiddlewares
+	e.runState = runState
+	e.disabled = disabled
+	defer e.progress.close()
+	defer e.telemetry.flush()
+	notifier, err := newRunNotifier(cfg, g, runDir, logger)
+	if err != nil {
+		return err
+	}
+	e.notifier = notifier
+	defer e.notifier.wait()
 	if goal, ok := g.Attrs["goal"]; ok {
 		e.Context["graph.goal"] = goal
 	}
-	startID := findStartNode(g).ID
+	startID := findStartNode(g, entry).ID
 	if cfg.Resume {
 		cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
 		if err != nil {
 			return err
 		}
+		if err := e.checkWorkspaceDrift(cp, cfg.AcceptWorkspaceDrift); err != nil {
+			return err
+		}
+		if err := applyOutcomeOverrides(g, runDir, &cp, cfg.MarkNodes, cfg.MarkNote, cfg.MarkForce); err != nil {
+			logger.Error("manual outcome override failed", "error", err)
+			return err
+		}
 		e.Context = Context(cp.Context)
 		e.RetryCount = cp.RetryCounts
+		if cp.Totals != nil {
+			e.totals = *cp.Totals
+			if e.totals.Visits == nil {
+				e.totals.Visits = map[string]int{}
+			}
+		}
 		for _, id := range cp.CompletedNodes {
 			e.Completed[id] = true
 		}
-		if cp.LastCompletedNode != "" {
-			status, err := readStatus(filepath.Join(runDir, cp.LastCompletedNode, "status.json"))
+		e.lastCompleted = cp.LastCompletedNode
+		e.foreach = cp.Foreach
+		if cp.Foreach != nil && cp.Loop == nil {
+			startID = cp.Foreach.NodeID
+			_ = appendTrace(runDir, "ResumeLoaded", map[string]any{
+				"last_completed_node": cp.LastCompletedNode,
+				"completed_nodes":     cp.CompletedNodes,
+				"foreach":             cp.Foreach,
+			})
+		} else if cp.Loop != nil {
+			e.loop = cp.Loop
+			startID = cp.Loop.ManagerID
+			_ = appendTrace(runDir, "ResumeLoaded", map[string]any{
+				"last_completed_node": cp.LastCompletedNode,
+				"completed_nodes":     cp.CompletedNodes,
+				"loop":                cp.Loop,
+			})
+		} else if cp.LastCompletedNode != "" {
+			status, err := readStatus(filepath.Join(nodeArtifactDir(runDir, cp.LastCompletedNode), "status.json"))
 			if err != nil {
 				return err
 			}
@@ -166,9 +665,12 @@ func RunPipeline(cfg RunConfig) error {
 				"last_outcome":        status.Outcome,
 				"completed_nodes":     cp.CompletedNodes,
 			})
-			next := e.selectNext(cp.LastCompletedNode, status.Outcome)
+			next := e.routeFrom(cp.LastCompletedNode, status.Outcome)
 			if next == "" {
 				if isExit(g, cp.LastCompletedNode) {
+					if status.Outcome == "fail" {
+						return exitCriteriaError(cp.LastCompletedNode, status.FailureReason)
+					}
 					return nil
 				}
 				return fmt.Errorf("resume failed: no route from %s", cp.LastCompletedNode)
@@ -177,18 +679,65 @@ func RunPipeline(cfg RunConfig) error {
 		}
 	}
 
-	_ = appendEvent(runDir, map[string]any{"schema_version": 1, "type": "PipelineStarted", "run_id": cfg.RunID, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+	e.recordEvent(map[string]any{"schema_version": 1, "type": "PipelineStarted", "run_id": cfg.RunID, "at": time.Now().UTC().Format(time.RFC3339Nano)})
 	_ = appendTrace(runDir, "PipelineStarted", map[string]any{"run_id": cfg.RunID, "start_node": startID})
 	logger.Info("pipeline execution started", "run_id", cfg.RunID, "run_dir", runDir, "workspace", workspace, "start_node", startID)
-	if err := e.executeFrom(startID); err != nil {
-		_ = appendEvent(runDir, map[string]any{"schema_version": 1, "type": "PipelineFailed", "error": err.Error(), "at": time.Now().UTC().Format(time.RFC3339Nano)})
+	failRun := func(err error) error {
+		e.recordEvent(map[string]any{"schema_version": 1, "type": "PipelineFailed", "error": err.Error(), "at": time.Now().UTC().Format(time.RFC3339Nano)})
 		_ = appendTrace(runDir, "PipelineFailed", map[string]any{"error": err.Error()})
 		logger.Error("pipeline failed", "run_id", cfg.RunID, "error", err)
+		e.writeRunResult(err)
 		return err
 	}
-	_ = appendEvent(runDir, map[string]any{"schema_version": 1, "type": "PipelineCompleted", "at": time.Now().UTC().Format(time.RFC3339Nano)})
+	if err := e.executeFrom(startID); err != nil {
+		e.restampCheckpointWorkspace()
+		if errors.Is(err, ErrRunStopped) {
+			e.recordEvent(map[string]any{"schema_version": 1, "type": "PipelineStopped", "at": time.Now().UTC().Format(time.RFC3339Nano)})
+			_ = appendTrace(runDir, "PipelineStopped", map[string]any{})
+			logger.Warn("pipeline stopped; resume to continue", "run_id", cfg.RunID)
+			e.writeRunResult(err)
+			return err
+		}
+		if errors.Is(err, ErrInsufficientDiskSpace) {
+			e.recordEvent(map[string]any{"schema_version": 1, "type": "PipelineAborted", "reason": "disk_space", "error": err.Error(), "at": time.Now().UTC().Format(time.RFC3339Nano)})
+			_ = appendTrace(runDir, "PipelineAborted", map[string]any{"reason": "disk_space", "error": err.Error()})
+			logger.Error("pipeline aborted: low disk space; free space and resume to continue", "run_id", cfg.RunID, "error", err)
+			e.writeRunResult(err)
+			return err
+		}
+		if errors.Is(err, ErrGuardrailViolation) {
+			e.recordEvent(map[string]any{"schema_version": 1, "type": "PipelineAborted", "reason": "guardrail_violation", "error": err.Error(), "at": time.Now().UTC().Format(time.RFC3339Nano)})
+			_ = appendTrace(runDir, "PipelineAborted", map[string]any{"reason": "guardrail_violation", "error": err.Error()})
+			logger.Error("pipeline aborted: guardrail violation with --fail-fast-guardrail", "run_id", cfg.RunID, "error", err)
+			e.writeRunResult(err)
+			return err
+		}
+		if errors.Is(err, ErrRetryBudgetExhausted) {
+			e.recordEvent(map[string]any{"schema_version": 1, "type": "PipelineAborted", "reason": "retry_budget_exhausted", "error": err.Error(), "retries": e.totals.Retries, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+			_ = appendTrace(runDir, "PipelineAborted", map[string]any{"reason": "retry_budget_exhausted", "error": err.Error(), "totals": e.totals})
+			logger.Error("pipeline aborted: retry budget exhausted", "run_id", cfg.RunID, "error", err)
+			e.writeRunResult(err)
+			return err
+		}
+		return failRun(err)
+	}
+	completed := map[string]any{"schema_version": 1, "type": "PipelineCompleted", "at": time.Now().UTC().Format(time.RFC3339Nano)}
+	if deliverables, err := collectDeliverables(g, runDir, workspace); err != nil {
+		return failRun(fmt.Errorf("collect deliverables: %w", err))
+	} else if len(deliverables.Paths) > 0 {
+		if err := updateManifest(runDir, "deliverables", deliverables); err != nil {
+			return failRun(fmt.Errorf("record deliverables: %w", err))
+		}
+		for _, p := range deliverables.Missing {
+			logger.Warn("deliverable path missing from workspace", "path", p)
+		}
+		completed["deliverable_files"] = len(deliverables.Files)
+		completed["deliverable_bytes"] = deliverables.TotalBytes
+	}
+	e.recordEvent(completed)
 	_ = appendTrace(runDir, "PipelineCompleted", map[string]any{})
 	logger.Info("pipeline completed", "run_id", cfg.RunID)
+	e.writeRunResult(nil)
 	return nil
 }
 
@@ -199,84 +748,186 @@ func (e *Engine) executeFrom(startID string) error {
 		if node == nil {
 			return fmt.Errorf("missing node: %s", current)
 		}
-		nodeDir := filepath.Join(e.RunDir, node.ID)
-		if err := os.MkdirAll(nodeDir, 0o755); err != nil {
-			return err
-		}
-		_ = appendEvent(e.RunDir, map[string]any{"schema_version": 1, "type": "StageStarted", "node_id": node.ID, "at": time.Now().UTC().Format(time.RFC3339Nano)})
-		e.Logger.Info("stage started", "node", node.ID, "type", node.Type(), "shape", node.Shape())
-		contextBefore := cloneContext(e.Context)
-		_ = appendTrace(e.RunDir, "NodeInputCaptured", map[string]any{
-			"node_id":           node.ID,
-			"node_type":         node.Type(),
-			"node_shape":        node.Shape(),
-			"node_attrs":        cloneMap(node.Attrs),
-			"context_before":    contextBefore,
-			"workspace":         e.Workspace,
-			"node_artifact_dir": nodeDir,
-		})
-		e.Context["current_node"] = node.ID
-		out, err := e.executeNode(node, nodeDir)
+		out, err := e.runStage(node, nodeArtifactDir(e.RunDir, node.ID))
 		if err != nil {
-			_ = appendEvent(e.RunDir, map[string]any{"schema_version": 1, "type": "StageFailed", "node_id": node.ID, "error": err.Error(), "at": time.Now().UTC().Format(time.RFC3339Nano)})
-			_ = appendTrace(e.RunDir, "NodeExecutionErrored", map[string]any{"node_id": node.ID, "error": err.Error()})
-			e.Logger.Error("stage execution errored", "node", node.ID, "error", err)
-			e.logFailureContext(node, nodeDir)
-			return err
-		}
-		if err := writeJSON(filepath.Join(nodeDir, "status.json"), out); err != nil {
-			return err
-		}
-		if out.Outcome == "fail" {
-			_ = appendEvent(e.RunDir, map[string]any{"schema_version": 1, "type": "StageFailed", "node_id": node.ID, "failure_reason": out.FailureReason, "at": time.Now().UTC().Format(time.RFC3339Nano)})
-			e.Logger.Warn("stage failed", "node", node.ID, "reason", out.FailureReason)
-			e.logFailureContext(node, nodeDir)
-		} else {
-			_ = appendEvent(e.RunDir, map[string]any{"schema_version": 1, "type": "StageCompleted", "node_id": node.ID, "outcome": out.Outcome, "at": time.Now().UTC().Format(time.RFC3339Nano)})
-			e.Logger.Info("stage completed", "node", node.ID, "outcome", out.Outcome)
-		}
-		for k, v := range out.ContextUpdates {
-			e.Context[k] = v
-		}
-		if out.Outcome == "fail" {
-			e.captureFailureFeedback(node, nodeDir, out)
-		}
-		e.Context["outcome"] = out.Outcome
-		contextAfter := cloneContext(e.Context)
-		_ = appendTrace(e.RunDir, "NodeOutputCaptured", map[string]any{
-			"node_id":         node.ID,
-			"outcome":         out.Outcome,
-			"failure_reason":  out.FailureReason,
-			"context_updates": cloneMap(out.ContextUpdates),
-			"context_after":   contextAfter,
-			"context_delta":   computeContextDelta(contextBefore, contextAfter),
-			"status_path":     filepath.Join(node.ID, "status.json"),
-		})
-		e.Completed[node.ID] = true
-		if err := e.writeCheckpoint(node.ID); err != nil {
 			return err
 		}
-		if stop := os.Getenv("ATTRACTION_TEST_STOP_AFTER_NODE"); stop != "" && stop == node.ID {
-			return errors.New("test_stop")
-		}
 		if isExit(e.Graph, node.ID) {
+			if out.Outcome == "fail" {
+				return exitCriteriaError(node.ID, out.FailureReason)
+			}
 			return nil
 		}
-		next := e.selectNext(node.ID, out.Outcome)
-		_ = appendTrace(e.RunDir, "RouteEvaluated", map[string]any{
-			"from_node":  node.ID,
-			"outcome":    out.Outcome,
-			"next_node":  next,
-			"candidates": routeCandidates(e.Graph, node.ID, out.Outcome),
-		})
-		e.Logger.Info("route selected", "from_node", node.ID, "outcome", out.Outcome, "next_node", next)
+		// Stop before routing: resume routes from the checkpointed node.
+		select {
+		case <-e.stop:
+			return ErrRunStopped
+		default:
+		}
+		next := e.routeFrom(node.ID, out.Outcome)
 		if next == "" {
 			return fmt.Errorf("no route from node %s for outcome %s", node.ID, out.Outcome)
 		}
+		// Like a stop, a low-space abort leaves resume to route again from
+		// the checkpointed node.
+		if err := e.checkStageDiskSpace(); err != nil {
+			return err
+		}
 		current = next
 	}
 }
 
+// runStage executes a single node with full artifact, event, trace, context,
+// and checkpoint bookkeeping, writing its artifacts to nodeDir.
+func (e *Engine) runStage(node *Node, nodeDir string) (Outcome, error) {
+	if source := e.disabled[node.ID]; source != "" {
+		return e.skipDisabledStage(node, nodeDir, source)
+	}
+	node, err := e.resolveNode(node)
+	var missingArtifacts *artifactMissingError
+	if err != nil && !errors.As(err, &missingArtifacts) {
+		return Outcome{}, err
+	}
+	err = nil
+	if err := e.checkDependencies(node); err != nil {
+		return Outcome{}, err
+	}
+	if err := os.MkdirAll(nodeDir, 0o755); err != nil {
+		return Outcome{}, err
+	}
+	if err := e.archiveAttempt(node, nodeDir, nil); err != nil {
+		return Outcome{}, err
+	}
+	_ = os.Remove(filepath.Join(nodeDir, reapedProcessesFile))
+	e.guardrailPaths = nil
+	e.runState.running(node.ID)
+	e.countVisit(node)
+	defer e.endAttempt(e.beginAttempt(node))
+	e.recordEvent(withNodeEnv(withToolRunner(map[string]any{"schema_version": 1, "type": "StageStarted", "node_id": node.ID, "at": time.Now().UTC().Format(time.RFC3339Nano)}, node), node))
+	e.Logger.Info("stage started", "node", node.ID, "type", node.Type(), "shape", node.Shape())
+	contextBefore := cloneContext(e.Context)
+	prompt, promptErr := e.preparePrompt(node)
+	input := map[string]any{
+		"node_id":           node.ID,
+		"node_type":         node.Type(),
+		"node_shape":        node.Shape(),
+		"node_attrs":        cloneMap(node.Attrs),
+		"context_before":    contextBefore,
+		"workspace":         e.Workspace,
+		"node_artifact_dir": nodeDir,
+	}
+	if prompt != nil {
+		input["prompt_middlewares"] = prompt.middlewares
+		input["failure_feedback"] = prompt.failureFeedback
+	}
+	_ = e.appendTrace("NodeInputCaptured", input)
+	e.Context["current_node"] = node.ID
+	out, blocked := e.checkContractReads(node)
+	if !blocked && missingArtifacts != nil {
+		out, blocked = e.artifactMissingOutcome(node, missingArtifacts), true
+	}
+	if promptErr != nil {
+		err = promptErr
+	} else if !blocked {
+		e.prompt = prompt
+		out, err = e.executeNode(node, nodeDir)
+		e.prompt = nil
+	}
+	if err != nil {
+		e.recordEvent(withToolRunner(withReapedProcesses(map[string]any{"schema_version": 1, "type": "StageFailed", "node_id": node.ID, "error": err.Error(), "failure_code": string(ClassifyFailure(err.Error())), "at": time.Now().UTC().Format(time.RFC3339Nano)}, nodeDir), node))
+		_ = e.appendTrace("NodeExecutionErrored", map[string]any{"node_id": node.ID, "error": err.Error()})
+		e.Logger.Error("stage execution errored", "node", node.ID, "error", err)
+		e.logFailureContext(node, nodeDir)
+		if errors.Is(err, ErrHandlerPanic) {
+			e.recordHandlerPanic(node, nodeDir, err)
+		}
+		return Outcome{}, err
+	}
+	out = e.checkContractWrites(node, out)
+	if out.Outcome == "fail" && out.FailureCode == "" {
+		out.FailureCode = ClassifyFailure(out.FailureReason)
+		if out.FailureCode == "" {
+			out.FailureCode = FailureUnknown
+		}
+	}
+	out.AttemptID = e.attempt.ID
+	if err := writeJSON(filepath.Join(nodeDir, "status.json"), out); err != nil {
+		return Outcome{}, err
+	}
+	if out.Outcome == "fail" {
+		e.recordEvent(withToolRunner(withToolMeta(withToolExitCode(withReapedProcesses(map[string]any{"schema_version": 1, "type": "StageFailed", "node_id": node.ID, "failure_reason": out.FailureReason, "failure_code": string(out.FailureCode), "at": time.Now().UTC().Format(time.RFC3339Nano)}, nodeDir), nodeDir), nodeDir), node))
+		e.Logger.Warn("stage failed", "node", node.ID, "reason", out.FailureReason)
+		e.logFailureContext(node, nodeDir)
+	} else {
+		e.recordEvent(withToolRunner(withToolMeta(withToolExitCode(withReapedProcesses(map[string]any{"schema_version": 1, "type": "StageCompleted", "node_id": node.ID, "outcome": out.Outcome, "at": time.Now().UTC().Format(time.RFC3339Nano)}, nodeDir), nodeDir), nodeDir), node))
+		e.Logger.Info("stage completed", "node", node.ID, "outcome", out.Outcome)
+	}
+	e.applyContextUpdates(node, out.ContextUpdates)
+	if err := e.recordProducedArtifacts(node, out); err != nil {
+		return Outcome{}, err
+	}
+	if out.Outcome == "fail" {
+		e.captureFailureFeedback(node, nodeDir, out)
+	}
+	e.Context["outcome"] = out.Outcome
+	contextAfter := cloneContext(e.Context)
+	statusPath := filepath.Join(node.ID, "status.json")
+	if rel, err := filepath.Rel(e.RunDir, nodeDir); err == nil {
+		statusPath = filepath.Join(rel, "status.json")
+	}
+	_ = e.appendTrace("NodeOutputCaptured", map[string]any{
+		"node_id":         node.ID,
+		"outcome":         out.Outcome,
+		"failure_reason":  out.FailureReason,
+		"failure_code":    string(out.FailureCode),
+		"context_updates": cloneMap(out.ContextUpdates),
+		"context_after":   contextAfter,
+		"context_delta":   computeContextDelta(contextBefore, contextAfter),
+		"status_path":     statusPath,
+	})
+	e.appendChangelog(node, out, statusPath)
+	e.Completed[node.ID] = true
+	if e.loop != nil && e.loop.ManagerID != node.ID {
+		e.loop.LastBodyNode = node.ID
+		e.loop.LastBodyOutcome = out.Outcome
+	}
+	if err := e.writeCheckpoint(node.ID); err != nil {
+		return Outcome{}, err
+	}
+	if err := e.writeArtifactsIndex(node, out); err != nil {
+		return Outcome{}, err
+	}
+	// status.json and the checkpoint already record the violation; stop
+	// before routing can send the run to a fix node.
+	if e.failFastGuardrail && len(e.guardrailPaths) > 0 {
+		return out, fmt.Errorf("%w: node %s wrote disallowed files: %s", ErrGuardrailViolation, node.ID, strings.Join(e.guardrailPaths, ","))
+	}
+	if stop := os.Getenv("ATTRACTION_TEST_STOP_AFTER_NODE"); stop != "" && stop == node.ID {
+		return Outcome{}, errors.New("test_stop")
+	}
+	return out, nil
+}
+
+// routeFrom selects the next node after from and records the decision.
+func (e *Engine) routeFrom(from, outcome string) string {
+	decision := decideRoute(e.Graph, from, outcome, e.totals.Visits)
+	next := decision.Selected
+	removed, incremented := e.applyEdgeEffects(decision.SelectedEdge)
+	_ = e.appendTrace("RouteEvaluated", map[string]any{
+		"from_node":          from,
+		"outcome":            outcome,
+		"next_node":          next,
+		"edge_id":            selectedEdgeID(decision),
+		"tier":               decision.Tier,
+		"candidates":         routeCandidates(e.Graph, from, outcome, e.totals.Visits),
+		"visits":             decision.Visits,
+		"reset_context_keys": removed,
+		"incremented":        incremented,
+	})
+	e.Logger.Info("route selected", "from_node", from, "outcome", outcome, "next_node", next)
+	return next
+}
+
 func (e *Engine) logFailureContext(node *Node, nodeDir string) {
 	paths := map[string]string{
 		"status_path":            filepath.Join(nodeDir, "status.json"),
@@ -312,7 +963,9 @@ func (e *Engine) logFailureContext(node *Node, nodeDir string) {
 	}
 }
 
-func (e *Engine) captureFailureFeedback(node *Node, nodeDir string, out Outcome) {
+// failureArtifacts lists the failure artifacts present in nodeDir by the
+// key last_failure.artifacts uses for each.
+func failureArtifacts(nodeDir string) map[string]string {
 	artifacts := map[string]string{}
 	candidates := map[string]string{
 		"status":               filepath.Join(nodeDir, "status.json"),
@@ -330,42 +983,22 @@ func (e *Engine) captureFailureFeedback(node *Node, nodeDir string, out Outcome)
 			artifacts[key] = p
 		}
 	}
+	return artifacts
+}
+
+func (e *Engine) captureFailureFeedback(node *Node, nodeDir string, out Outcome) {
+	artifacts := failureArtifacts(nodeDir)
 	e.Context["last_failure.node_id"] = node.ID
 	e.Context["last_failure.node_type"] = node.Type()
 	e.Context["last_failure.reason"] = out.FailureReason
+	e.Context["last_failure.code"] = string(out.FailureCode)
 	e.Context["last_failure.at"] = time.Now().UTC().Format(time.RFC3339Nano)
-	e.Context["last_failure.artifacts"] = artifacts
-	e.Context["last_failure.summary"] = buildFailureSummary(node, nodeDir, out)
-}
-
-func buildFailureSummary(node *Node, nodeDir string, out Outcome) string {
-	parts := []string{
-		fmt.Sprintf("failed_node=%s", node.ID),
-		fmt.Sprintf("failed_node_type=%s", node.Type()),
-	}
-	if strings.TrimSpace(out.FailureReason) != "" {
-		parts = append(parts, fmt.Sprintf("failure_reason=%s", out.FailureReason))
-	}
-	if code, ok := readTailSnippet(filepath.Join(nodeDir, "tool.exitcode.txt"), 64); ok {
-		parts = append(parts, fmt.Sprintf("tool_exit_code=%s", strings.TrimSpace(code)))
+	summary := buildFailureSummary(node, nodeDir, out, failureSummaryMaxBytes(node, e.Graph))
+	if err := writeFailureSummary(nodeDir, summary); err == nil {
+		artifacts["failure_summary"] = filepath.Join(nodeDir, failureSummaryFile)
 	}
-	if s, ok := readTailSnippet(filepath.Join(nodeDir, "tool.stderr.txt"), 600); ok {
-		parts = append(parts, "tool_stderr:\n"+s)
-	}
-	if s, ok := readTailSnippet(filepath.Join(nodeDir, "tool.stdout.txt"), 300); ok {
-		parts = append(parts, "tool_stdout:\n"+s)
-	}
-	if s, ok := readTailSnippet(filepath.Join(nodeDir, "verification.results.json"), 600); ok {
-		parts = append(parts, "verification_results_tail:\n"+s)
-	}
-	if s, ok := readTailSnippet(filepath.Join(nodeDir, "codex.stderr.log"), 600); ok {
-		parts = append(parts, "codex_stderr_tail:\n"+s)
-	}
-	summary := strings.Join(parts, "\n")
-	if len(summary) > 2200 {
-		summary = summary[:2200]
-	}
-	return strings.TrimSpace(summary)
+	e.Context["last_failure.artifacts"] = deepCloneValue(artifacts)
+	e.Context["last_failure.summary"] = summary
 }
 
 func readTailSnippet(path string, max int) (string, bool) {
@@ -387,22 +1020,114 @@ func readTailSnippet(path string, max int) (string, bool) {
 }
 
 func (e *Engine) executeNode(node *Node, nodeDir string) (Outcome, error) {
-	if reason, blocked := e.unfixableFailureSourceReason(node); blocked {
+	if reason, blocked := e.unfixableFailureSourceReason(node, nodeDir); blocked {
 		return Outcome{}, fmt.Errorf("%s", reason)
 	}
+	if isManagerLoopNode(node) {
+		return e.executeManagerLoop(node, nodeDir)
+	}
+	if foreachContextKey(node) != "" {
+		return e.executeForeach(node, nodeDir)
+	}
 	h := resolveHandler(node)
+	if _, ok := h.(toolHandler); ok && e.fakeTools {
+		h = fakeToolHandler{}
+	}
+	switch h.(type) {
+	case codergenHandler:
+		h = codergenHandler{prompt: e.prompt}
+	case toolHandler:
+		h = toolHandler{runID: e.RunID}
+	case verificationHandler:
+		h = verificationHandler{runID: e.RunID, escalate: e.escalate}
+	}
+	if _, ok := h.(reportHandler); ok {
+		h = reportHandler{run: &runArtifacts{runID: e.RunID, runDir: e.RunDir, graph: e.Graph}}
+	}
+	if p := replayResponsePath(node); p != "" && isCodergenNode(node) {
+		_ = appendEvent(e.RunDir, e.stampAttempt(map[string]any{"schema_version": 1, "type": "AgentResponseReplayed", "node_id": node.ID, "source": p, "at": time.Now().UTC().Format(time.RFC3339Nano)}))
+		e.Logger.Info("replaying recorded agent response", "node", node.ID, "source", p)
+	}
 	maxRetries := node.IntAttr("max_retries", 0)
 	allowPartial := node.BoolAttr("allow_partial", false)
 	attempts := maxRetries + 1
+	// read_only nodes skip both snapshots; topLevelModTimes is the safety net.
+	readOnly := readOnlyNode(node)
+	rollback := rollbackEnabled(node) && !readOnly
+	excludes, err := snapshotExcludes(e.Graph, node)
+	if err != nil {
+		return Outcome{}, err
+	}
+	// preNode is the workspace before the first attempt; rollback restores it.
+	var preNode map[string]fileState
 	var out Outcome
 	for attempt := 0; attempt < attempts; attempt++ {
-		e.Logger.Debug("node attempt", "node", node.ID, "attempt", attempt+1, "max_attempts", attempts)
-		before, err := snapshotWorkspace(e.Workspace)
+		if attempt > 0 {
+			prev := out
+			prev.AttemptID = e.attempt.ID
+			if err := e.archiveAttempt(node, nodeDir, &prev); err != nil {
+				return Outcome{}, err
+			}
+			e.beginAttempt(node)
+		}
+		e.Logger.Debug("node attempt", "node", node.ID, "attempt", attempt+1, "max_attempts", attempts, "attempt_id", e.attempt.ID)
+		e.totals.Attempts++
+		var before, excludedBefore map[string]fileState
+		var modTimes map[string]int64
+		var tracker *stageDiffTracker
+		var err error
+		if readOnly {
+			modTimes, err = topLevelModTimes(e.Workspace)
+		} else {
+			tracker = newStageDiffTracker(e.diffBackend, e.Workspace)
+			defer tracker.close()
+			before, excludedBefore, err = snapshotWorkspaceExcluding(e.Workspace, snapshotRetainLimit(node), e.snapshotSeed, excludes)
+			e.snapshotSeed = nil
+			tracker.admit(before)
+		}
 		if err != nil {
 			return Outcome{}, err
 		}
-		out, err = h.Execute(node, e.Context, e.Graph, nodeDir, e.Workspace)
+		if rollback && preNode == nil {
+			if err := runBlobStore(e.RunDir).putSnapshot(before); err != nil {
+				return Outcome{}, err
+			}
+			preNode = before
+		}
+		cacheKey, cacheInputs, cached := "", map[string]string{}, false
+		if e.toolCacheEnabled(node) && !readOnly {
+			if cacheKey, cacheInputs, err = e.toolCacheKey(node, before); err != nil {
+				return Outcome{}, err
+			}
+		}
+		handlerStarted := time.Now().UTC()
+		if cacheKey != "" {
+			out, cached, err = e.replayToolCache(node, nodeDir, cacheKey)
+		}
+		if !cached && err == nil {
+			isTool := handlerType(node) == "tool"
+			if isTool {
+				clearToolContextUpdates(e.Workspace)
+			}
+			_ = os.Remove(filepath.Join(nodeDir, codexEventsFile))
+			_ = os.Remove(filepath.Join(nodeDir, verificationDecisionsFile))
+			out, err = e.executeHandler(h, node, nodeDir)
+			if err == nil && isTool {
+				e.mergeToolContextUpdates(node, &out)
+			}
+			e.traceCodexEvents(node, nodeDir)
+			e.traceVerificationDecisions(node, nodeDir)
+		}
+		handlerFinished := time.Now().UTC()
+		if err == nil && out.FailureCode == FailureResourceLimitExceeded {
+			e.recordResourceLimitEvent(node, nodeDir)
+		}
 		if err != nil {
+			if rollback {
+				if rbErr := e.rollbackNode(node, preNode, attempt, "error"); rbErr != nil {
+					e.Logger.Error("workspace rollback failed", "node", node.ID, "error", rbErr)
+				}
+			}
 			return Outcome{}, err
 		}
 		if out.SchemaVersion == 0 {
@@ -412,23 +1137,77 @@ func (e *Engine) executeNode(node *Node, nodeDir string) (Outcome, error) {
 			out.ContextUpdates = map[string]any{}
 		}
 		if node.BoolAttr("requires_tool_success", false) && out.Outcome == "success" {
-			req := node.StringAttr("required_tool_node", "")
-			if req != "" {
-				status, err := readStatus(filepath.Join(e.RunDir, req, "status.json"))
-				if err != nil || status.Outcome != "success" {
-					out.Outcome = "fail"
-					out.FailureReason = fmt.Sprintf("required tool node not successful: %s", req)
-				}
+			if reason, code := checkRequiredToolNodes(e.RunDir, node); reason != "" {
+				out.Outcome = "fail"
+				out.FailureReason = reason
+				out.FailureCode = code
 			}
 		}
-		after, err := snapshotWorkspace(e.Workspace)
+		var after, excludedAfter map[string]fileState
+		if readOnly {
+			err = e.checkReadOnly(node, modTimes, &out)
+		} else {
+			after, excludedAfter, err = tracker.after(e.Workspace, before, excludedBefore, excludes)
+		}
 		if err != nil {
 			return Outcome{}, err
 		}
 		diff := computeDiff(before, after)
+		diff.ExcludedWrites = countExcludedWrites(excludedBefore, excludedAfter)
+		if tracker != nil {
+			diff.Backend, diff.BackendFallback = tracker.backend, tracker.fallback
+			if tracker.fallback != "" && e.diffBackend == DiffBackendWatch {
+				e.Logger.Warn("workspace watcher unusable; diffed with a snapshot", "node", node.ID, "reason", tracker.fallback)
+			}
+		}
 		if err := writeJSON(filepath.Join(nodeDir, "workspace.diff.json"), diff); err != nil {
 			return Outcome{}, err
 		}
+		// checkReason collects failures from the post-stage checks, which a
+		// guardrail violation reports after its own.
+		checkReason := ""
+		if out.Outcome == "success" {
+			expected, err := parseExpectedOutputs(node)
+			if err != nil {
+				return Outcome{}, err
+			}
+			if missing := missingExpectedOutputs(expected, after); len(missing) > 0 {
+				checkReason = "expected_outputs_missing: " + strings.Join(missing, ",")
+				out.Outcome = "fail"
+				out.FailureReason = checkReason
+				out.FailureCode = FailureExpectedOutputsMissing
+				e.recordEvent(map[string]any{"schema_version": 1, "type": "ExpectedOutputsMissing", "node_id": node.ID, "paths": missing, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+				e.Logger.Warn("stage succeeded without its expected outputs", "node", node.ID, "missing", missing)
+			}
+		}
+		if isExecutableNode(node) && !readOnly {
+			budget, err := parseChangeBudget(node)
+			if err != nil {
+				return Outcome{}, err
+			}
+			usage := measureChanges(diff, before, after)
+			if reason := budget.exceeded(usage); reason != "" {
+				out.Outcome = "fail"
+				if checkReason != "" {
+					reason += "; " + checkReason
+				}
+				checkReason = reason
+				out.FailureReason = reason
+				out.FailureCode = FailureChangeBudgetExceeded
+				e.recordEvent(map[string]any{
+					"schema_version":    1,
+					"type":              "ChangeBudgetExceeded",
+					"node_id":           node.ID,
+					"changed_files":     usage.Files,
+					"changed_bytes":     usage.Bytes,
+					"max_changed_files": budget.Files,
+					"max_changed_bytes": budget.Bytes,
+					"largest":           usage.Largest,
+					"at":                time.Now().UTC().Format(time.RFC3339Nano),
+				})
+				e.Logger.Warn("stage exceeded its change budget", "node", node.ID, "changed_files", usage.Files, "changed_bytes", usage.Bytes)
+			}
+		}
 		if isExecutableNode(node) {
 			allowed, err := ParseAllowedWritePaths(node)
 			if err != nil {
@@ -439,7 +1218,29 @@ func (e *Engine) executeNode(node *Node, nodeDir string) (Outcome, error) {
 				if len(violations) > 0 {
 					out.Outcome = "fail"
 					out.FailureReason = fmt.Sprintf("guardrail_violation: wrote disallowed files: %s", strings.Join(violations, ","))
-					_ = appendEvent(e.RunDir, map[string]any{"schema_version": 1, "type": "GuardrailViolation", "node_id": node.ID, "paths": violations, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+					if checkReason != "" {
+						out.FailureReason += "; " + checkReason
+					}
+					out.FailureCode = FailureGuardrailWriteViolation
+					report := buildGuardrailViolationReport(node, e.Workspace, diff, violations, before, after, handlerStarted, handlerFinished)
+					if report.Mode == "revert" {
+						revertGuardrailViolations(e.Workspace, &report, before)
+					}
+					if err := writeJSON(filepath.Join(nodeDir, "guardrail.violation.json"), report); err != nil {
+						return Outcome{}, err
+					}
+					e.guardrailPaths = append(e.guardrailPaths, violations...)
+					e.recordEvent(map[string]any{
+						"schema_version":      1,
+						"type":                "GuardrailViolation",
+						"node_id":             node.ID,
+						"paths":               violations,
+						"mode":                report.Mode,
+						"handler_started_at":  report.HandlerStartedAt,
+						"handler_finished_at": report.HandlerFinishedAt,
+						"files":               report.eventFiles(),
+						"at":                  time.Now().UTC().Format(time.RFC3339Nano),
+					})
 				}
 			}
 		}
@@ -447,8 +1248,16 @@ func (e *Engine) executeNode(node *Node, nodeDir string) (Outcome, error) {
 		if out.Outcome == "retry" && attempt < attempts-1 {
 			e.RetryCount[node.ID] = e.RetryCount[node.ID] + 1
 			e.Context["internal.retry_count."+node.ID] = e.RetryCount[node.ID]
-			_ = appendEvent(e.RunDir, map[string]any{"schema_version": 1, "type": "StageRetrying", "node_id": node.ID, "retry_count": e.RetryCount[node.ID], "at": time.Now().UTC().Format(time.RFC3339Nano)})
+			e.recordEvent(map[string]any{"schema_version": 1, "type": "StageRetrying", "node_id": node.ID, "retry_count": e.RetryCount[node.ID], "at": time.Now().UTC().Format(time.RFC3339Nano)})
 			e.Logger.Warn("stage requested retry", "node", node.ID, "retry_count", e.RetryCount[node.ID])
+			if err := e.countRetry(); err != nil {
+				return Outcome{}, err
+			}
+			if rollback && node.BoolAttr("rollback_between_retries", true) {
+				if err := e.rollbackNode(node, preNode, attempt, "retry"); err != nil {
+					return Outcome{}, err
+				}
+			}
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
@@ -459,78 +1268,23 @@ func (e *Engine) executeNode(node *Node, nodeDir string) (Outcome, error) {
 				out.Outcome = "fail"
 				if out.FailureReason == "" {
 					out.FailureReason = "retry_exhausted"
+					out.FailureCode = FailureRetryExhausted
 				}
 			}
 		}
-		return out, nil
-	}
-	return out, nil
-}
-
-func (e *Engine) unfixableFailureSourceReason(node *Node) (string, bool) {
-	if !isCodergenNode(node) {
-		return "", false
-	}
-	failedNodeID, _ := e.Context["last_failure.node_id"].(string)
-	failedNodeID = strings.TrimSpace(failedNodeID)
-	if failedNodeID == "" {
-		return "", false
-	}
-	failedNode := e.Graph.Nodes[failedNodeID]
-	if failedNode == nil || failedNode.Type() != "tool" {
-		return "", false
-	}
-	cmd := strings.TrimSpace(failedNode.StringAttr("tool_command", ""))
-	if cmd == "" {
-		return "", false
-	}
-	sourcePaths := extractToolScriptPaths(cmd)
-	if len(sourcePaths) == 0 {
-		return "", false
-	}
-	allowed, err := ParseAllowedWritePaths(node)
-	if err != nil {
-		return fmt.Sprintf("invalid allowed_write_paths on node %s: %v", node.ID, err), true
-	}
-	if len(allowed) == 0 {
-		return "", false
-	}
-	normalized := make([]string, 0, len(allowed))
-	for _, p := range allowed {
-		p = filepath.ToSlash(strings.TrimSpace(p))
-		if p != "" {
-			normalized = append(normalized, p)
-		}
-	}
-	outside := []string{}
-	for _, src := range sourcePaths {
-		if !pathAllowed(src, normalized) {
-			outside = append(outside, src)
-		}
-	}
-	if len(outside) == 0 {
-		return "", false
-	}
-	sort.Strings(outside)
-	return fmt.Sprintf("unfixable_failure_source: failed node %s references %s outside allowed_write_paths for %s", failedNodeID, strings.Join(outside, ","), node.ID), true
-}
-
-func extractToolScriptPaths(cmd string) []string {
-	tokens := strings.Fields(cmd)
-	paths := []string{}
-	for _, tok := range tokens {
-		t := strings.Trim(tok, `"'`)
-		if t == "" || strings.HasPrefix(t, "-") {
-			continue
-		}
-		if strings.Contains(t, "=") {
-			continue
+		if rollback && out.Outcome == "fail" {
+			if err := e.rollbackNode(node, preNode, attempt, "fail"); err != nil {
+				return Outcome{}, err
+			}
 		}
-		if strings.HasSuffix(t, ".sh") {
-			paths = append(paths, filepath.ToSlash(filepath.Clean(t)))
+		if cacheKey != "" && !cached && out.Outcome == "success" {
+			if err := e.storeToolCache(node, nodeDir, cacheKey, cacheInputs, out, diff); err != nil {
+				e.Logger.Warn("failed to store tool result in cache", "node", node.ID, "error", err)
+			}
 		}
+		return out, nil
 	}
-	return paths
+	return out, nil
 }
 
 func (e *Engine) writeCheckpoint(last string) error {
@@ -539,62 +1293,41 @@ func (e *Engine) writeCheckpoint(last string) error {
 		completed = append(completed, id)
 	}
 	sort.Strings(completed)
-	cp := Checkpoint{SchemaVersion: 1, RunID: e.RunID, LastCompletedNode: last, CompletedNodes: completed, RetryCounts: e.RetryCount, Context: map[string]any(e.Context)}
+	cp := Checkpoint{SchemaVersion: 1, RunID: e.RunID, LastCompletedNode: last, CompletedNodes: completed, RetryCounts: e.RetryCount, Context: cloneContext(e.Context), Loop: e.loop, Foreach: e.foreach, Totals: &e.totals}
+	if err := e.stampWorkspace(&cp); err != nil {
+		return err
+	}
 	if err := writeJSON(filepath.Join(e.RunDir, "checkpoint.json"), cp); err != nil {
 		return err
 	}
+	e.lastCompleted = last
 	_ = appendEvent(e.RunDir, map[string]any{"schema_version": 1, "type": "CheckpointSaved", "last_completed_node": last, "at": time.Now().UTC().Format(time.RFC3339Nano)})
 	return nil
 }
 
 func (e *Engine) selectNext(from, outcome string) string {
-	var conditionals []*Edge
-	var unconditionals []*Edge
-	for _, edge := range e.Graph.Edges {
-		if edge.From != from {
-			continue
-		}
-		cond := strings.TrimSpace(edge.StringAttr("condition", ""))
-		if cond == "" {
-			unconditionals = append(unconditionals, edge)
-			continue
-		}
-		if cond == "outcome="+outcome {
-			conditionals = append(conditionals, edge)
-		}
-	}
-	pick := conditionals
-	if len(pick) == 0 {
-		pick = unconditionals
-	}
-	if len(pick) == 0 {
-		return ""
+	return decideRoute(e.Graph, from, outcome, e.totals.Visits).Selected
+}
+
+// handlerType is the node's explicit type, or the one implied by its shape.
+func handlerType(node *Node) string {
+	if typ := node.Type(); typ != "" {
+		return typ
+	}
+	switch node.Shape() {
+	case "Mdiamond":
+		return "start"
+	case "Msquare":
+		return "exit"
+	case "parallelogram":
+		return "tool"
+	default:
+		return "codergen"
 	}
-	sort.Slice(pick, func(i, j int) bool {
-		wi, wj := pick[i].IntAttr("weight", 0), pick[j].IntAttr("weight", 0)
-		if wi != wj {
-			return wi > wj
-		}
-		return pick[i].To < pick[j].To
-	})
-	return pick[0].To
 }
 
 func resolveHandler(node *Node) Handler {
-	typ := node.Type()
-	if typ == "" {
-		switch node.Shape() {
-		case "Mdiamond":
-			typ = "start"
-		case "Msquare":
-			typ = "exit"
-		case "parallelogram":
-			typ = "tool"
-		default:
-			typ = "codergen"
-		}
-	}
-	switch typ {
+	switch handlerType(node) {
 	case "start":
 		return startHandler{}
 	case "exit":
@@ -603,6 +1336,8 @@ func resolveHandler(node *Node) Handler {
 		return toolHandler{}
 	case "verification":
 		return verificationHandler{}
+	case "report":
+		return reportHandler{}
 	default:
 		return codergenHandler{}
 	}
@@ -611,36 +1346,79 @@ func resolveHandler(node *Node) Handler {
 type startHandler struct{}
 type exitHandler struct{}
 
-type toolHandler struct{}
+type toolHandler struct {
+	// runID is exported to the command as ATTRACTOR_RUN_ID.
+	runID string
+}
 
-type codergenHandler struct{}
+type codergenHandler struct {
+	// prompt is the prompt the engine built through its middlewares; nil
+	// builds one with the built-ins only.
+	prompt *preparedPrompt
+}
 
 func (startHandler) Execute(node *Node, _ Context, _ *Graph, _ string, _ string) (Outcome, error) {
 	return Outcome{SchemaVersion: 1, Outcome: "success", SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}, nil
 }
 
-func (exitHandler) Execute(node *Node, _ Context, _ *Graph, _ string, _ string) (Outcome, error) {
-	return Outcome{SchemaVersion: 1, Outcome: "success", SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}, nil
+// Execute checks the exit's require_context criteria; unmet criteria fail
+// the exit and, with it, the run.
+func (exitHandler) Execute(node *Node, ctx Context, _ *Graph, _ string, _ string) (Outcome, error) {
+	out := Outcome{SchemaVersion: 1, Outcome: "success", SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}
+	criteria, err := parseContextCriteria(node.StringAttr("require_context", ""))
+	if err != nil {
+		return Outcome{}, err
+	}
+	if unmet := unmetCriteria(criteria, ctx); len(unmet) > 0 {
+		out.Outcome = "fail"
+		out.FailureReason = ErrExitCriteriaNotMet.Error() + ": " + strings.Join(unmet, "; ")
+		out.FailureCode = FailureExitCriteriaNotMet
+	}
+	return out, nil
 }
 
-func (toolHandler) Execute(node *Node, _ Context, _ *Graph, nodeDir string, workspace string) (Outcome, error) {
+func (h toolHandler) Execute(node *Node, ctx Context, g *Graph, nodeDir string, workspace string) (Outcome, error) {
 	cmdText := strings.TrimSpace(node.StringAttr("tool_command", ""))
 	if cmdText == "" {
 		return Outcome{}, fmt.Errorf("tool_command required")
 	}
 	if err := validateToolCommand(cmdText); err != nil {
-		return Outcome{SchemaVersion: 1, Outcome: "fail", FailureReason: err.Error(), SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}, nil
+		return Outcome{SchemaVersion: 1, Outcome: "fail", FailureReason: err.Error(), FailureCode: FailureToolCommandRejected, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}, nil
+	}
+	limits, err := parseResourceLimits(node)
+	if err != nil {
+		return Outcome{}, err
 	}
-	cmd := exec.Command("sh", "-c", cmdText)
-	cmd.Dir = workspace
-	stdout, _ := cmd.StdoutPipe()
-	stderr, _ := cmd.StderrPipe()
-	if err := cmd.Start(); err != nil {
+	runner := toolRunnerFor(node)
+	nodeEnv, err := nodeCommandEnv(h.runID, node, ctx, runner, nodeDir, workspace)
+	if err != nil {
+		return Outcome{}, err
+	}
+	env, hermetic, err := commandEnv(g, node, runner, workspace, nodeEnv)
+	if err != nil {
+		return Outcome{}, err
+	}
+	runner.Hermetic = hermetic
+	if err := writeToolEnv(nodeDir, env, hermetic); err != nil {
+		return Outcome{}, err
+	}
+	if runner.Name != "docker" {
+		exes := []toolExecutable{}
+		for _, name := range toolCommandExecutables(cmdText) {
+			exes = append(exes, resolveToolExecutable(name, workspace, env))
+		}
+		if err := writeToolMeta(nodeDir, node, exes); err != nil {
+			return Outcome{}, err
+		}
+	}
+	cmd, err := runner.command(workspace, workspace, []string{"sh", "-c", cmdText}, env, limits)
+	if err != nil {
 		return Outcome{}, err
 	}
-	outB, _ := io.ReadAll(stdout)
-	errB, _ := io.ReadAll(stderr)
-	err := cmd.Wait()
+	outB, errB, reaped, err := runProcessGroup(cmd)
+	if recordErr := recordReapedProcesses(nodeDir, reaped); recordErr != nil {
+		return Outcome{}, recordErr
+	}
 	code := 0
 	if err != nil {
 		if ee, ok := err.(*exec.ExitError); ok {
@@ -658,11 +1436,15 @@ func (toolHandler) Execute(node *Node, _ Context, _ *Graph, nodeDir string, work
 	if writeErr := os.WriteFile(filepath.Join(nodeDir, "tool.exitcode.txt"), []byte(fmt.Sprintf("%d\n", code)), 0o644); writeErr != nil {
 		return Outcome{}, writeErr
 	}
-	outcome := "success"
-	if code != 0 {
-		outcome = "fail"
+	out := toolExitOutcome(node, code)
+	if out.Outcome == "fail" {
+		if limited, ok, limitErr := resourceLimitFailure(nodeDir, cmdText, limits, err, code, errB); limitErr != nil {
+			return Outcome{}, limitErr
+		} else if ok {
+			return limited, nil
+		}
 	}
-	return Outcome{SchemaVersion: 1, Outcome: outcome, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}, FailureReason: exitReason(code)}, nil
+	return out, nil
 }
 
 func exitReason(code int) string {
@@ -672,61 +1454,64 @@ func exitReason(code int) string {
 	return fmt.Sprintf("tool_exit_code_%d", code)
 }
 
-func (codergenHandler) Execute(node *Node, ctx Context, g *Graph, nodeDir string, workspace string) (Outcome, error) {
-	prompt := node.StringAttr("prompt", node.Label())
-	if goal, ok := g.Attrs["goal"]; ok {
-		prompt = strings.ReplaceAll(prompt, "$goal", fmt.Sprintf("%v", goal))
+func exitFailureCode(code int) FailureCode {
+	if code == 0 {
+		return ""
 	}
-	prompt = injectFailureFeedbackPrompt(prompt, ctx)
-	prompt = injectVerificationAllowlistPrompt(prompt, node, g)
+	return FailureToolExitNonzero
+}
+
+func (h codergenHandler) Execute(node *Node, ctx Context, g *Graph, nodeDir string, workspace string) (Outcome, error) {
+	if h.prompt == nil {
+		p, err := buildPrompt(node, ctx, g, builtinPromptMiddlewares(node, g, workspace, filepath.Dir(nodeDir), nil, slog.Default()))
+		if err != nil {
+			return Outcome{}, err
+		}
+		h.prompt = &p
+	}
+	prompt := h.prompt.text
 	if writeErr := os.WriteFile(filepath.Join(nodeDir, "prompt.md"), []byte(prompt+"\n"), 0o644); writeErr != nil {
 		return Outcome{}, writeErr
 	}
-	backend := os.Getenv("ATTRACTION_BACKEND")
-	if backend == "" {
-		backend = os.Getenv("ATTRACTOR_BACKEND")
-	}
-	if backend == "fake" {
-		outcome := outcomeFromTestAttrs(node, ctx)
-		nextLabel := node.StringAttr("test.preferred_next_label", "")
-		suggest := splitCSV(node.StringAttr("test.suggested_next_ids", ""))
-		notes := node.StringAttr("test.notes", "fake backend")
-		resp := fmt.Sprintf("outcome=%s\n", outcome)
-		if writeErr := os.WriteFile(filepath.Join(nodeDir, "response.md"), []byte(resp), 0o644); writeErr != nil {
-			return Outcome{}, writeErr
-		}
-		updates := map[string]any{}
-		if raw := strings.TrimSpace(node.StringAttr("test.verification_plan_json", "")); raw != "" {
-			var parsed any
-			if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
-				return Outcome{}, fmt.Errorf("invalid test.verification_plan_json: %w", err)
-			}
-			plan, err := ParseVerificationPlan(parsed)
-			if err != nil {
-				return Outcome{}, err
-			}
-			key := strings.TrimSpace(node.StringAttr("verification.plan_context_key", "verification.plan"))
-			updates[key] = VerificationPlanToMap(plan)
+	replay := replayResponsePath(node)
+	attempt := ctx.GetInt("internal.retry_count."+node.ID, 0)
+	var agent Agent = replayAgent{path: replay}
+	if replay == "" {
+		resolved, err := ResolveAgentForAttempt(node, workspace, attempt)
+		if err != nil {
+			return Outcome{}, err
 		}
-		return Outcome{SchemaVersion: 1, Outcome: outcome, PreferredNextLabel: nextLabel, SuggestedNextIDs: suggest, Notes: notes, ContextUpdates: updates}, nil
+		agent = resolved
 	}
-	agent, err := ResolveAgent(node, workspace)
-	if err != nil {
+	if err := recordAgentAttempt(nodeDir, attempt, agent); err != nil {
 		return Outcome{}, err
 	}
-	resp, err := agent.Run(AgentRequest{
+	resp, err := runAgentWithDelegation(node, agent, func() (Agent, error) {
+		return resolveDelegateAgent(node, workspace)
+	}, AgentRequest{
 		Prompt:    prompt,
 		NodeID:    node.ID,
 		NodeDir:   nodeDir,
 		Workspace: workspace,
 		Logger:    slog.Default(),
+		Context:   ctx,
 	})
+	if errors.Is(err, ErrAgentStalled) {
+		return Outcome{SchemaVersion: 1, Outcome: "fail", FailureReason: err.Error(), FailureCode: FailureAgentStalled, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}, nil
+	}
 	if err != nil {
 		return Outcome{}, err
 	}
 	if resp.ContextUpdates == nil {
 		resp.ContextUpdates = map[string]any{}
 	}
+	keys, err := nodeContextUpdateKeys(node)
+	if err != nil {
+		return Outcome{}, err
+	}
+	if err := checkContextUpdates(resp.ContextUpdates, keys); err != nil {
+		return Outcome{SchemaVersion: 1, Outcome: "fail", FailureReason: err.Error(), FailureCode: FailureAgentInvalidOutput, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}, Notes: resp.Notes}, nil
+	}
 	if resp.VerificationPlan != nil {
 		key := strings.TrimSpace(node.StringAttr("verification.plan_context_key", "verification.plan"))
 		resp.ContextUpdates[key] = VerificationPlanToMap(*resp.VerificationPlan)
@@ -739,21 +1524,24 @@ func (codergenHandler) Execute(node *Node, ctx Context, g *Graph, nodeDir string
 		ContextUpdates:     resp.ContextUpdates,
 		Notes:              resp.Notes,
 		FailureReason:      resp.FailureReason,
+		FailureCode:        agentFailureCode(resp.Outcome, resp.FailureReason),
 	}, nil
 }
 
 func injectFailureFeedbackPrompt(prompt string, ctx Context) string {
-	summary, _ := ctx["last_failure.summary"].(string)
-	summary = strings.TrimSpace(summary)
+	summary := strings.TrimSpace(ctx.GetString("last_failure.summary", ""))
 	if summary == "" {
 		return prompt
 	}
-	nodeID, _ := ctx["last_failure.node_id"].(string)
-	reason, _ := ctx["last_failure.reason"].(string)
+	return appendFailureFeedback(prompt, "previous failed stage", ctx.GetString("last_failure.node_id", ""), ctx.GetString("last_failure.reason", ""), summary)
+}
 
+// appendFailureFeedback adds a failure feedback section, labelled with where
+// it came from, to prompt.
+func appendFailureFeedback(prompt, source, nodeID, reason, summary string) string {
 	var b strings.Builder
 	b.WriteString(strings.TrimRight(prompt, "\n"))
-	b.WriteString("\n\nFailure feedback (from previous failed stage):\n")
+	b.WriteString("\n\nFailure feedback (from " + source + "):\n")
 	if strings.TrimSpace(nodeID) != "" {
 		b.WriteString("- failed_node: ")
 		b.WriteString(strings.TrimSpace(nodeID))
@@ -765,7 +1553,7 @@ func injectFailureFeedbackPrompt(prompt string, ctx Context) string {
 		b.WriteString("\n")
 	}
 	b.WriteString("- details:\n")
-	b.WriteString(summary)
+	b.WriteString(strings.TrimSpace(summary))
 	b.WriteString("\n")
 	return b.String()
 }
@@ -847,11 +1635,7 @@ func uniqueNonEmpty(items []string) []string {
 func outcomeFromTestAttrs(node *Node, ctx Context) string {
 	seq := splitCSV(node.StringAttr("test.outcome_sequence", ""))
 	if len(seq) > 0 {
-		raw := ctx["internal.retry_count."+node.ID]
-		idx := 0
-		if i, ok := raw.(int); ok {
-			idx = i
-		}
+		idx := ctx.GetInt("internal.retry_count."+node.ID, 0)
 		if idx < len(seq) {
 			return seq[idx]
 		}
@@ -926,7 +1710,7 @@ func isExecutableNode(node *Node) bool {
 		shape := node.Shape()
 		return shape == "box" || shape == "parallelogram"
 	}
-	return t == "codergen" || t == "tool"
+	return t == "codergen" || t == "tool" || t == "report"
 }
 
 func isCodergenNode(node *Node) bool {
@@ -938,8 +1722,38 @@ func isCodergenNode(node *Node) bool {
 }
 
 func snapshotWorkspace(workspace string) (map[string]fileState, error) {
+	return snapshotWorkspaceRetaining(workspace, -1)
+}
+
+// snapshotWorkspaceRetaining hashes every workspace file and keeps the original
+// bytes of files no larger than retainMax so they can be restored later.
+// A negative retainMax disables content retention.
+func snapshotWorkspaceRetaining(workspace string, retainMax int64) (map[string]fileState, error) {
+	return snapshotWorkspaceSeeded(workspace, retainMax, nil)
+}
+
+// snapshotWorkspaceSeeded is snapshotWorkspaceRetaining that reuses hashes from
+// seed for files whose size, mtime, and mode are unchanged and whose content
+// does not need to be retained.
+func snapshotWorkspaceSeeded(workspace string, retainMax int64, seed map[string]fileState) (map[string]fileState, error) {
+	out, _, err := snapshotWorkspaceExcluding(workspace, retainMax, seed, nil)
+	return out, err
+}
+
+// snapshotWorkspaceExcluding is snapshotWorkspaceSeeded that leaves paths
+// matching snapshot_excludes out of the snapshot. They are returned
+// separately, stat only, so writes to them can still be counted.
+func snapshotWorkspaceExcluding(workspace string, retainMax int64, seed map[string]fileState, excludes []string) (map[string]fileState, map[string]fileState, error) {
 	out := map[string]fileState{}
-	err := filepath.WalkDir(workspace, func(path string, d fs.DirEntry, err error) error {
+	excluded := map[string]fileState{}
+	err := snapshotTreeInto(workspace, workspace, retainMax, seed, excludes, out, excluded)
+	return out, excluded, err
+}
+
+// snapshotTreeInto adds the files under root, the workspace or a directory
+// in it, to out, or to excluded when snapshot_excludes matches them.
+func snapshotTreeInto(workspace, root string, retainMax int64, seed map[string]fileState, excludes []string, out, excluded map[string]fileState) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -951,21 +1765,59 @@ func snapshotWorkspace(workspace string) (map[string]fileState, error) {
 			return nil
 		}
 		if d.IsDir() {
+			if rel == ".attractor" {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		b, err := os.ReadFile(path)
+		return snapshotFileInto(path, filepath.ToSlash(rel), d, retainMax, seed, excludes, out, excluded)
+	})
+}
+
+// snapshotFileInto records one file or symlink at workspace-relative rel.
+func snapshotFileInto(path, rel string, d fs.DirEntry, retainMax int64, seed map[string]fileState, excludes []string, out, excluded map[string]fileState) error {
+	if len(excludes) > 0 && snapshotExcluded(rel, false, excludes) {
+		st, err := statExcluded(path, d)
+		if err != nil {
+			return err
+		}
+		excluded[rel] = st
+		return nil
+	}
+	if d.Type()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
 		if err != nil {
 			return err
 		}
-		h := sha256.Sum256(b)
 		info, err := d.Info()
 		if err != nil {
 			return err
 		}
-		out[filepath.ToSlash(rel)] = fileState{Size: info.Size(), Hash: hex.EncodeToString(h[:])}
+		h := sha256.Sum256([]byte("symlink:" + target))
+		out[rel] = fileState{Size: int64(len(target)), Hash: hex.EncodeToString(h[:]), ModTime: info.ModTime(), Symlink: target, Retained: true}
 		return nil
-	})
-	return out, err
+	}
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	if s, ok := seed[rel]; ok && (retainMax < 0 || info.Size() > retainMax) &&
+		s.Size == info.Size() && s.ModTime.Equal(info.ModTime()) && s.Mode == info.Mode().Perm() {
+		out[rel] = s
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	h := sha256.Sum256(b)
+	st := fileState{Size: info.Size(), Hash: hex.EncodeToString(h[:]), ModTime: info.ModTime(), Mode: info.Mode().Perm()}
+	if retainMax >= 0 && info.Size() <= retainMax {
+		st.Content = b
+		st.Retained = true
+	}
+	out[rel] = st
+	return nil
 }
 
 func computeDiff(before, after map[string]fileState) workspaceDiff {
@@ -1029,11 +1881,14 @@ func pathAllowed(path string, allowed []string) bool {
 	return false
 }
 
-func findStartNode(g *Graph) *Node {
-	for _, n := range g.Nodes {
-		if n.Shape() == "Mdiamond" || n.ID == "start" {
-			return n
-		}
+// findStartNode returns the entry node when set, else the first start node
+// by ID.
+func findStartNode(g *Graph, entry string) *Node {
+	if entry != "" {
+		return g.Nodes[entry]
+	}
+	if ids := startNodeIDs(g); len(ids) > 0 {
+		return g.Nodes[ids[0]]
 	}
 	return nil
 }
@@ -1046,28 +1901,53 @@ func isExit(g *Graph, id string) bool {
 	return n.Shape() == "Msquare" || n.ID == "exit" || n.ID == "end"
 }
 
-func writeManifest(g *Graph, cfg RunConfig, runDir, workspace string) error {
-	m := map[string]any{"schema_version": 1, "pipeline_path": cfg.PipelinePath, "original_workdir": cfg.Workdir, "workspace_path": workspace, "started_at": time.Now().UTC().Format(time.RFC3339Nano)}
+func writeManifest(g *Graph, cfg RunConfig, runDir, workspace string, extra map[string]any) error {
+	m := map[string]any{"schema_version": 1, "layout_version": currentLayoutVersion, "pipeline_path": cfg.PipelinePath, "original_workdir": cfg.Workdir, "workspace_path": workspace, "started_at": time.Now().UTC().Format(time.RFC3339Nano)}
+	for k, v := range extra {
+		m[k] = v
+	}
 	if goal, ok := g.Attrs["goal"]; ok {
 		m["goal"] = goal
 	}
+	replayed := map[string]string{}
+	for id, n := range g.Nodes {
+		if p := replayResponsePath(n); p != "" {
+			replayed[id] = p
+		}
+	}
+	if len(replayed) > 0 {
+		m["replayed_nodes"] = replayed
+	}
+	if expansions := matrixExpansions(g); len(expansions) > 0 {
+		m["matrix_expansions"] = expansions
+	}
+	if expansions := groupEdgeExpansions(g); len(expansions) > 0 {
+		m["group_edges"] = expansions
+	}
+	if shortened := shortenedNodeArtifactDirs(g, runDir); len(shortened) > 0 {
+		m["node_artifact_dirs"] = shortened
+	}
+	if cfg.Resume {
+		if steps := priorLayoutMigrations(runDir); len(steps) > 0 {
+			m["layout_migrations"] = steps
+		}
+	}
 	return writeJSON(filepath.Join(runDir, "manifest.json"), m)
 }
 
-func appendEvent(runDir string, event map[string]any) error {
-	f, err := os.OpenFile(filepath.Join(runDir, "events.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	b, err := json.Marshal(event)
-	if err != nil {
-		return err
-	}
-	_, err = f.Write(append(b, '\n'))
-	return err
+// recordEvent appends ev to events.jsonl, stamped with the current attempt,
+// and mirrors it into telemetry spans.
+func (e *Engine) recordEvent(ev map[string]any) {
+	e.stampAttempt(ev)
+	_ = appendEvent(e.RunDir, ev)
+	e.telemetry.observe(ev)
+	e.notifier.observe(ev)
+	e.metrics.observe(ev)
+	e.progress.observe(ev)
 }
 
+// appendTrace writes a trace record through the run's journal. Outside a run
+// (no journal started for runDir) it opens one for the single record.
 func appendTrace(runDir, recordType string, fields map[string]any) error {
 	rec := map[string]any{
 		"schema_version": 1,
@@ -1077,17 +1957,32 @@ func appendTrace(runDir, recordType string, fields map[string]any) error {
 	for k, v := range fields {
 		rec[k] = v
 	}
-	f, err := os.OpenFile(filepath.Join(runDir, "trace.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	traceJournalsMu.Lock()
+	j := traceJournals[runDir]
+	traceJournalsMu.Unlock()
+	if j != nil {
+		return j.append(rec)
+	}
+	j, err := openTraceJournal(runDir, defaultTraceRotateBytes)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	b, err := json.Marshal(rec)
-	if err != nil {
+	if err := j.append(rec); err != nil {
+		j.close()
 		return err
 	}
-	_, err = f.Write(append(b, '\n'))
-	return err
+	return j.close()
+}
+
+// applyContextUpdates stores deep copies of a handler's updates, so a handler
+// that keeps and later mutates its update values cannot change the context,
+// checkpoint, or trace records after the fact.
+func (e *Engine) applyContextUpdates(node *Node, updates map[string]any) {
+	for _, k := range sortedKeys(updates) {
+		if err := e.Context.Set(k, deepCloneValue(updates[k])); err != nil {
+			e.Logger.Warn("ignored context update", "node", node.ID, "error", err)
+		}
+	}
 }
 
 func cloneContext(ctx Context) map[string]any {
@@ -1096,7 +1991,7 @@ func cloneContext(ctx Context) map[string]any {
 	}
 	out := make(map[string]any, len(ctx))
 	for k, v := range ctx {
-		out[k] = v
+		out[k] = deepCloneValue(v)
 	}
 	return out
 }
@@ -1107,7 +2002,7 @@ func cloneMap(in map[string]any) map[string]any {
 	}
 	out := make(map[string]any, len(in))
 	for k, v := range in {
-		out[k] = v
+		out[k] = deepCloneValue(v)
 	}
 	return out
 }
@@ -1135,19 +2030,35 @@ func computeContextDelta(before, after map[string]any) map[string]any {
 	return map[string]any{"added": added, "updated": updated, "removed": removed}
 }
 
-func routeCandidates(g *Graph, from, outcome string) []map[string]any {
+func selectedEdgeID(d RouteDecision) string {
+	if d.SelectedEdge == nil {
+		return ""
+	}
+	return d.SelectedEdge.ID
+}
+
+func routeCandidates(g *Graph, from, outcome string, visits map[string]int) []map[string]any {
 	out := []map[string]any{}
 	for _, e := range g.Edges {
 		if e.From != from {
 			continue
 		}
 		cond := strings.TrimSpace(e.StringAttr("condition", ""))
-		out = append(out, map[string]any{
+		matched, read := cond == "", map[string]int(nil)
+		if !matched {
+			matched, read = conditionMatches(cond, outcome, visits)
+		}
+		candidate := map[string]any{
+			"edge_id":   e.ID,
 			"to":        e.To,
 			"weight":    e.IntAttr("weight", 0),
 			"condition": cond,
-			"matched":   cond == "" || cond == "outcome="+outcome,
-		})
+			"matched":   matched,
+		}
+		if len(read) > 0 {
+			candidate["visits"] = read
+		}
+		out = append(out, candidate)
 	}
 	sort.Slice(out, func(i, j int) bool {
 		if out[i]["to"].(string) != out[j]["to"].(string) {
@@ -1192,7 +2103,17 @@ func readStatus(path string) (Outcome, error) {
 	return out, err
 }
 
-func copyDir(src, dst string, excludes []string) error {
+// copyDir copies src into dst. In-tree symlinks are recreated as relative
+// symlinks; symlinks resolving outside src are skipped and returned.
+func copyDir(src, dst string, excludes []string) ([]string, error) {
+	skipped, _, err := copyDirRecording(src, dst, excludes)
+	return skipped, err
+}
+
+// copyDirRecording copies src into dst like copyDir and also returns, per
+// copied regular file, the source size and the hash of the bytes read so the
+// copy can be verified afterwards.
+func copyDirRecording(src, dst string, excludes []string) ([]string, map[string]copiedFile, error) {
 	normExcludes := make([]string, 0, len(excludes))
 	for _, ex := range excludes {
 		ex = strings.TrimSpace(ex)
@@ -1202,7 +2123,9 @@ func copyDir(src, dst string, excludes []string) error {
 		ex = filepath.ToSlash(filepath.Clean(ex))
 		normExcludes = append(normExcludes, ex)
 	}
-	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+	skipped := []string{}
+	copied := map[string]copiedFile{}
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -1224,11 +2147,22 @@ func copyDir(src, dst string, excludes []string) error {
 		if d.IsDir() {
 			return os.MkdirAll(target, 0o755)
 		}
-		b, err := os.ReadFile(path)
+		if d.Type()&fs.ModeSymlink != 0 {
+			linkTarget, ok, err := inTreeSymlinkTarget(src, path)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				skipped = append(skipped, rel)
+				return nil
+			}
+			return os.Symlink(linkTarget, target)
+		}
+		info, err := os.Stat(path)
 		if err != nil {
 			return err
 		}
-		info, err := os.Stat(path)
+		b, err := os.ReadFile(path)
 		if err != nil {
 			return err
 		}
@@ -1236,8 +2170,43 @@ func copyDir(src, dst string, excludes []string) error {
 		if mode == 0 {
 			mode = 0o644
 		}
-		return os.WriteFile(target, b, mode)
+		h := sha256.Sum256(b)
+		copied[rel] = copiedFile{SourceSize: info.Size(), Hash: hex.EncodeToString(h[:])}
+		return copyWriteFile(target, b, mode)
 	})
+	return skipped, copied, err
+}
+
+// inTreeSymlinkTarget returns a relative link target for the symlink at path
+// when it resolves inside root. Absolute in-tree targets are rewritten as
+// relative so the copy does not point back into the source tree.
+func inTreeSymlinkTarget(root, path string) (string, bool, error) {
+	raw, err := os.Readlink(path)
+	if err != nil {
+		return "", false, err
+	}
+	resolved := raw
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(filepath.Dir(path), resolved)
+	}
+	if _, ok := relativeDescendant(root, resolved); !ok {
+		return "", false, nil
+	}
+	if realRoot, err := filepath.EvalSymlinks(root); err == nil {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			if _, ok := relativeDescendant(realRoot, real); !ok {
+				return "", false, nil
+			}
+		}
+	}
+	if !filepath.IsAbs(raw) {
+		return raw, true, nil
+	}
+	rel, err := filepath.Rel(filepath.Dir(path), resolved)
+	if err != nil {
+		return "", false, err
+	}
+	return rel, true, nil
 }
 
 func shouldSkipCopyRel(rel string, excludes []string) bool {
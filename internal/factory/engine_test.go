@@ -665,7 +665,7 @@ func TestCopyDirPreservesExecutableBit(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := copyDir(srcRoot, dstRoot, nil); err != nil {
+	if _, err := copyDir(srcRoot, dstRoot, nil); err != nil {
 		t.Fatal(err)
 	}
 	dstFile := filepath.Join(dstRoot, ".factory", "bin", "codex")
@@ -677,3 +677,54 @@ func TestCopyDirPreservesExecutableBit(t *testing.T) {
 		t.Fatalf("expected executable bit on copied file, got mode %o", info.Mode().Perm())
 	}
 }
+
+func TestUnfixableFailureSourceRecognizesScriptInvocations(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	cases := []struct {
+		command string
+		outside string
+	}{
+		{"python scripts/build.py --target agent", "scripts/build.py"},
+		{"make -f tools/build.mk all", "tools/build.mk"},
+		{"node ./tools/check.mjs", "tools/check.mjs"},
+		{"cd agent && tools/check --strict", "tools/check"},
+	}
+	for i, tc := range cases {
+		dot := `digraph G {
+	start [shape=Mdiamond];
+	validate [shape=parallelogram, type=tool, tool_command="` + tc.command + `"];
+	fix [shape=box, allowed_write_paths="agent/", prompt="Try fix"];
+	exit [shape=Msquare];
+	start -> validate;
+	validate -> fix [condition="outcome=fail"];
+	fix -> exit [condition="outcome=success"];
+	}`
+		workdir, runsdir, pipeline := setupRun(t, dot)
+		writeFile(t, filepath.Join(workdir, "tools", "check"), "#!/bin/sh\n")
+		if err := os.MkdirAll(filepath.Join(workdir, "agent"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		runID := "uf" + string(rune('a'+i))
+		err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: runID})
+		if err == nil || !strings.Contains(err.Error(), "unfixable_failure_source") || !strings.Contains(err.Error(), "references "+tc.outside+" outside") {
+			t.Fatalf("%s: err = %v", tc.command, err)
+		}
+		analysis := readStatusJSON(t, filepath.Join(runsdir, runID, "fix", "unfixable.analysis.json"))
+		if analysis["blocked"] != true || len(analysis["candidates"].([]any)) != 1 {
+			t.Fatalf("%s: analysis = %v", tc.command, analysis)
+		}
+	}
+}
+
+func TestExtractToolSourcePathsSkipsNonPaths(t *testing.T) {
+	workspace := t.TempDir()
+	writeFile(t, filepath.Join(workspace, "bin", "lint"), "")
+	got := []string{}
+	for _, c := range extractToolSourcePaths(`GOFLAGS=-mod=mod go test ./... --config=ci/lint.yaml -v 1.5 https://example.com/x.sh bin/lint agent ../outside.py > out.log`, workspace) {
+		got = append(got, c.Path+":"+c.Source)
+	}
+	want := "ci/lint.yaml:extension,bin/lint:workspace_file"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("paths = %v, want %s", got, want)
+	}
+}
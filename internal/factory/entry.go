@@ -0,0 +1,74 @@
+package attractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func isStartNode(n *Node) bool {
+	return n.Shape() == "Mdiamond" || n.ID == "start"
+}
+
+// startNodeIDs lists the graph's start nodes in ID order.
+func startNodeIDs(g *Graph) []string {
+	ids := []string{}
+	for _, id := range sortedKeys(g.Nodes) {
+		if isStartNode(g.Nodes[id]) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// multiEntry reports graph [multi_entry=true], which allows several start
+// nodes, one of which each run picks with --entry.
+func multiEntry(g *Graph) bool {
+	b, _ := strconv.ParseBool(strings.TrimSpace(fmt.Sprintf("%v", g.Attrs["multi_entry"])))
+	return b
+}
+
+// resolveEntryNode returns the start node a run begins at: requested when
+// set, else the graph's only start node.
+func resolveEntryNode(g *Graph, requested string) (string, error) {
+	starts := startNodeIDs(g)
+	if requested = strings.TrimSpace(requested); requested != "" {
+		if n := g.Nodes[requested]; n == nil || !isStartNode(n) {
+			return "", fmt.Errorf("entry %s is not a start node (start nodes: %s)", requested, strings.Join(starts, ", "))
+		}
+		return requested, nil
+	}
+	switch len(starts) {
+	case 0:
+		return "", fmt.Errorf("graph has no start node")
+	case 1:
+		return starts[0], nil
+	}
+	return "", fmt.Errorf("graph has %d entry nodes (%s); choose one with --entry", len(starts), strings.Join(starts, ", "))
+}
+
+// validateEntry warns about nodes the chosen entry of a multi-entry graph
+// cannot reach. Other start nodes are not listed.
+func validateEntry(g *Graph, entry string) []Diagnostic {
+	if len(startNodeIDs(g)) < 2 {
+		return nil
+	}
+	seen := reachableNodes(g, []string{entry}, nil)
+	d := []Diagnostic{}
+	for _, id := range sortedKeys(g.Nodes) {
+		if !seen[id] && !isStartNode(g.Nodes[id]) {
+			d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s is unreachable from entry %s", id, entry)})
+		}
+	}
+	return d
+}
+
+// readManifestEntry returns the entry node recorded for a run, or "" for
+// runs that did not record one.
+func readManifestEntry(runDir string) (string, error) {
+	m, err := readRerunManifest(runDir)
+	if err != nil {
+		return "", err
+	}
+	return m.EntryNode, nil
+}
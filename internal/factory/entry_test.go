@@ -0,0 +1,108 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const multiEntryDOT = `digraph G {
+	graph [multi_entry=true];
+	full [shape=Mdiamond];
+	hotfix [shape=Mdiamond];
+	plan [shape=parallelogram, tool_command="touch plan.done"];
+	patch [shape=parallelogram, tool_command="touch patch.done"];
+	exit [shape=Msquare];
+	full -> plan -> patch -> exit;
+	hotfix -> patch;
+	}`
+
+func TestValidateMultiEntry(t *testing.T) {
+	g, err := ParseDOT(multiEntryDOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diags := ValidateGraph(g); HasErrors(diags) {
+		t.Fatalf("diagnostics = %v", diags)
+	}
+	if got := validateEntry(g, "hotfix"); len(got) != 1 || got[0].Level != "WARN" || got[0].Message != "node plan is unreachable from entry hotfix" {
+		t.Fatalf("validateEntry(hotfix) = %v", got)
+	}
+	if got := validateEntry(g, "full"); len(got) != 0 {
+		t.Fatalf("validateEntry(full) = %v", got)
+	}
+
+	delete(g.Attrs, "multi_entry")
+	found := false
+	for _, d := range ValidateGraph(g) {
+		found = found || (d.Level == "ERROR" && strings.HasPrefix(d.Message, "must have exactly one start node"))
+	}
+	if !found {
+		t.Fatal("two start nodes without multi_entry should be an error")
+	}
+
+	g, err = ParseDOT(strings.Replace(multiEntryDOT, "hotfix -> patch;", "hotfix -> orphan;\n\torphan [shape=box];", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := []string{}
+	for _, d := range ValidateGraph(g) {
+		if d.Level == "ERROR" {
+			errs = append(errs, d.Message)
+		}
+	}
+	if len(errs) != 0 {
+		t.Fatalf("errors = %v", errs)
+	}
+	warned := false
+	for _, d := range ValidateGraph(g) {
+		warned = warned || (d.Level == "WARN" && strings.Contains(d.Message, "orphan"))
+	}
+	if !warned {
+		t.Fatal("an entry that cannot reach an exit should warn")
+	}
+}
+
+func TestResolveEntryNode(t *testing.T) {
+	g, err := ParseDOT(multiEntryDOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveEntryNode(g, ""); err == nil || !strings.Contains(err.Error(), "graph has 2 entry nodes (full, hotfix); choose one with --entry") {
+		t.Fatalf("no entry err = %v", err)
+	}
+	if _, err := resolveEntryNode(g, "plan"); err == nil || !strings.Contains(err.Error(), "entry plan is not a start node") {
+		t.Fatalf("non-start entry err = %v", err)
+	}
+	if got, err := resolveEntryNode(g, "hotfix"); err != nil || got != "hotfix" {
+		t.Fatalf("entry = %q, %v", got, err)
+	}
+}
+
+func TestMultiEntryRunRecordsEntryAndResumeUsesIt(t *testing.T) {
+	workdir, runsdir, pipeline := setupRun(t, multiEntryDOT)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "me0"}); err == nil || !strings.Contains(err.Error(), "choose one with --entry") {
+		t.Fatalf("missing --entry err = %v", err)
+	}
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "hotfix")
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "me1", EntryNode: "hotfix"})
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "me1", Resume: true, EntryNode: "full"}); err == nil || !strings.Contains(err.Error(), "differs from the run's recorded entry hotfix") {
+		t.Fatalf("mismatched resume entry err = %v", err)
+	}
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "me1", Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "me1")
+	if manifest := readStatusJSON(t, filepath.Join(runDir, "manifest.json")); manifest["entry_node"] != "hotfix" {
+		t.Fatalf("manifest entry_node = %v", manifest["entry_node"])
+	}
+	workspace := filepath.Join(runDir, "workspace")
+	if _, err := os.Stat(filepath.Join(workspace, "patch.done")); err != nil {
+		t.Fatalf("patch did not run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "plan.done")); err == nil {
+		t.Fatal("plan ran from the hotfix entry")
+	}
+}
@@ -0,0 +1,331 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EnvFingerprint is a comparable, privacy-conscious description of the host a
+// run executed on. Environment variables are recorded by name only.
+type EnvFingerprint struct {
+	GOOS            string            `json:"goos"`
+	GOARCH          string            `json:"goarch"`
+	GoVersion       string            `json:"go_version"`
+	CPUCount        int               `json:"cpu_count"`
+	Locale          string            `json:"locale"`
+	FSCaseSensitive *bool             `json:"fs_case_sensitive,omitempty"`
+	EnvNames        []string          `json:"env_names"`
+	Tools           map[string]string `json:"tools"`
+	// ToolVersions is the first line of each resolved tool's version output,
+	// or "" when the tool is missing or the probe failed.
+	ToolVersions map[string]string `json:"tool_versions,omitempty"`
+}
+
+// EnvDifference is one differing fingerprint field with an optional note on
+// why it is known to affect behavior.
+type EnvDifference struct {
+	Field string `json:"field"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+	Note  string `json:"note,omitempty"`
+}
+
+var fingerprintEnvPrefixes = []string{"ATTRACTOR_", "ATTRACTION_", "FACTORY_", "CODEX_", "GO", "CGO_"}
+
+var fingerprintEnvNames = map[string]bool{"PATH": true, "HOME": true, "TMPDIR": true, "SHELL": true, "LANG": true, "LC_ALL": true, "CI": true}
+
+var fingerprintTools = []string{"sh", "git", "go", "codex"}
+
+// fingerprintVersionArgs are the arguments that print a fingerprint tool's
+// version; sh has none.
+var fingerprintVersionArgs = map[string][]string{
+	"git":   {"--version"},
+	"go":    {"version"},
+	"codex": {"--version"},
+}
+
+// envDifferenceNotes is the knowledge table of fingerprint fields known to
+// change pipeline behavior. Keys match EnvDifference.Field or its prefix.
+var envDifferenceNotes = map[string]string{
+	"goos":                "different OS: shell builtins, path separators, and tool flags may differ",
+	"goarch":              "different architecture: compiled tool outputs and test timing may differ",
+	"fs_case_sensitive":   "case-insensitive filesystems can make differently-cased paths collide, changing allowed_write_paths guardrail results and workspace diffs",
+	"locale":              "locale affects sort order and message text in tool output parsed by pipelines",
+	"cpu_count":           "CPU count changes parallel test scheduling and timeout-sensitive behavior",
+	"env.ATTRACTOR_":      "attractor configuration env var present on only one host changes backend or guardrail settings",
+	"env.ATTRACTION_":     "backend selection env var present on only one host (for example fake vs real backend)",
+	"env.GOFLAGS":         "GOFLAGS changes go build/test behavior in tool and verification commands",
+	"tools.codex":         "codex executable resolution differs; codergen stages may use a different binary or fail to start",
+	"tools.go":            "go toolchain resolution differs; verification commands may run a different version",
+	"tool_versions.go":    "different go toolchain versions can change build, vet, and test results in tool and verification commands",
+	"tool_versions.git":   "different git versions can change diff output and command flags used by tool commands",
+	"tool_versions.codex": "different codex CLI versions can change agent behavior and response handling",
+	"go_version":          "factory built with a different Go runtime",
+	"codex_version":       "different codex CLI versions can change agent behavior and response handling",
+	"git_commit":          "runs started from different source commits of the workdir",
+}
+
+// collectEnvFingerprint gathers the fingerprint at run start. The only
+// subprocesses are the tool version probes, which run in parallel under
+// toolVersionTimeout. probeDir is used for the filesystem case-sensitivity
+// probe and as the probes' working directory.
+func collectEnvFingerprint(probeDir string) EnvFingerprint {
+	fp := EnvFingerprint{
+		GOOS:         runtime.GOOS,
+		GOARCH:       runtime.GOARCH,
+		GoVersion:    runtime.Version(),
+		CPUCount:     runtime.NumCPU(),
+		Locale:       pickString(os.Getenv("LC_ALL"), os.Getenv("LANG"), ""),
+		EnvNames:     relevantEnvNames(os.Environ()),
+		Tools:        map[string]string{},
+		ToolVersions: map[string]string{},
+	}
+	if cs, ok := probeCaseSensitivity(probeDir); ok {
+		fp.FSCaseSensitive = &cs
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, tool := range fingerprintTools {
+		p, err := exec.LookPath(tool)
+		if err != nil {
+			p = ""
+		}
+		fp.Tools[tool] = p
+		args, ok := fingerprintVersionArgs[tool]
+		if !ok {
+			continue
+		}
+		fp.ToolVersions[tool] = ""
+		if p == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := probeToolVersion(p, args, probeDir, nil)
+			mu.Lock()
+			fp.ToolVersions[tool] = v
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return fp
+}
+
+func relevantEnvNames(environ []string) []string {
+	names := []string{}
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if name == "" {
+			continue
+		}
+		keep := fingerprintEnvNames[name]
+		for _, p := range fingerprintEnvPrefixes {
+			if strings.HasPrefix(name, p) {
+				keep = true
+				break
+			}
+		}
+		if keep {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return uniqueNonEmpty(names)
+}
+
+func probeCaseSensitivity(dir string) (bool, bool) {
+	f, err := os.CreateTemp(dir, ".case-probe-")
+	if err != nil {
+		return false, false
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+	upper := filepath.Join(filepath.Dir(name), strings.ToUpper(filepath.Base(name)))
+	if upper == name {
+		return false, false
+	}
+	_, err = os.Stat(upper)
+	return err != nil, true
+}
+
+// DiffEnvFingerprints lists differing fields between two fingerprints, each
+// annotated from the knowledge table when the field is known to matter.
+func DiffEnvFingerprints(a, b EnvFingerprint) []EnvDifference {
+	out := []EnvDifference{}
+	add := func(field, va, vb string) {
+		if va != vb {
+			out = append(out, EnvDifference{Field: field, A: va, B: vb, Note: envDifferenceNote(field)})
+		}
+	}
+	add("goos", a.GOOS, b.GOOS)
+	add("goarch", a.GOARCH, b.GOARCH)
+	add("go_version", a.GoVersion, b.GoVersion)
+	add("cpu_count", fmt.Sprint(a.CPUCount), fmt.Sprint(b.CPUCount))
+	add("locale", a.Locale, b.Locale)
+	add("fs_case_sensitive", boolPtrString(a.FSCaseSensitive), boolPtrString(b.FSCaseSensitive))
+	inA := map[string]bool{}
+	inB := map[string]bool{}
+	for _, n := range a.EnvNames {
+		inA[n] = true
+	}
+	for _, n := range b.EnvNames {
+		inB[n] = true
+	}
+	names := []string{}
+	for n := range inA {
+		names = append(names, n)
+	}
+	for n := range inB {
+		if !inA[n] {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		add("env."+n, presence(inA[n]), presence(inB[n]))
+	}
+	tools := []string{}
+	for t := range a.Tools {
+		tools = append(tools, t)
+	}
+	for t := range b.Tools {
+		if _, ok := a.Tools[t]; !ok {
+			tools = append(tools, t)
+		}
+	}
+	sort.Strings(tools)
+	for _, t := range tools {
+		add("tools."+t, a.Tools[t], b.Tools[t])
+	}
+	// Manifests written before versions were probed have none; compare only
+	// when both runs recorded them.
+	if a.ToolVersions != nil && b.ToolVersions != nil {
+		versions := map[string]bool{}
+		for t := range a.ToolVersions {
+			versions[t] = true
+		}
+		for t := range b.ToolVersions {
+			versions[t] = true
+		}
+		for _, t := range sortedKeys(versions) {
+			add("tool_versions."+t, a.ToolVersions[t], b.ToolVersions[t])
+		}
+	}
+	return out
+}
+
+func envDifferenceNote(field string) string {
+	if note, ok := envDifferenceNotes[field]; ok {
+		return note
+	}
+	best := ""
+	for key := range envDifferenceNotes {
+		if strings.HasSuffix(key, "_") && strings.HasPrefix(field, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	return envDifferenceNotes[best]
+}
+
+func presence(ok bool) string {
+	if ok {
+		return "set"
+	}
+	return "unset"
+}
+
+func boolPtrString(b *bool) string {
+	if b == nil {
+		return "unknown"
+	}
+	return fmt.Sprint(*b)
+}
+
+// CompareRunEnvironments loads the fingerprints recorded in two run manifests
+// and renders their differences.
+func CompareRunEnvironments(runDirA, runDirB string) (string, error) {
+	for _, dir := range []string{runDirA, runDirB} {
+		if err := checkRunLayout(dir); err != nil {
+			return "", err
+		}
+	}
+	a, err := readRunFingerprint(runDirA)
+	if err != nil {
+		return "", err
+	}
+	b, err := readRunFingerprint(runDirB)
+	if err != nil {
+		return "", err
+	}
+	diffs := DiffEnvFingerprints(a, b)
+	if envA, ok := readRunEnvironment(runDirA); ok {
+		if envB, ok := readRunEnvironment(runDirB); ok {
+			diffs = mergeEnvDifferences(diffs, diffRunEnvironments(envA, envB))
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "environment comparison: %s vs %s\n", filepath.Base(runDirA), filepath.Base(runDirB))
+	if len(diffs) == 0 {
+		sb.WriteString("no differences\n")
+		return sb.String(), nil
+	}
+	for _, d := range diffs {
+		marker := " "
+		if d.Note != "" {
+			marker = "!"
+		}
+		fmt.Fprintf(&sb, "%s %s: %s | %s\n", marker, d.Field, displayValue(d.A), displayValue(d.B))
+		if d.Note != "" {
+			fmt.Fprintf(&sb, "    %s\n", d.Note)
+		}
+	}
+	return sb.String(), nil
+}
+
+// mergeEnvDifferences appends extra differences whose field is not already
+// reported.
+func mergeEnvDifferences(diffs, extra []EnvDifference) []EnvDifference {
+	seen := map[string]bool{}
+	for _, d := range diffs {
+		seen[d.Field] = true
+	}
+	for _, d := range extra {
+		if !seen[d.Field] {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
+
+func displayValue(v string) string {
+	if v == "" {
+		return "(none)"
+	}
+	return v
+}
+
+func readRunFingerprint(runDir string) (EnvFingerprint, error) {
+	var m struct {
+		Environment *EnvFingerprint `json:"environment"`
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		return EnvFingerprint{}, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return EnvFingerprint{}, fmt.Errorf("invalid manifest in %s: %w", runDir, err)
+	}
+	if m.Environment == nil {
+		return EnvFingerprint{}, fmt.Errorf("run %s has no environment fingerprint", filepath.Base(runDir))
+	}
+	return *m.Environment, nil
+}
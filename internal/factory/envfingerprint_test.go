@@ -0,0 +1,125 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffEnvFingerprintsAnnotatesKnownDifferences(t *testing.T) {
+	yes, no := true, false
+	a := EnvFingerprint{GOOS: "linux", GOARCH: "amd64", GoVersion: "go1.22.1", CPUCount: 8, Locale: "C.UTF-8", FSCaseSensitive: &yes,
+		EnvNames: []string{"ATTRACTION_BACKEND", "PATH"}, Tools: map[string]string{"codex": "/usr/bin/codex", "git": "/usr/bin/git"}}
+	b := EnvFingerprint{GOOS: "darwin", GOARCH: "amd64", GoVersion: "go1.22.1", CPUCount: 8, Locale: "C.UTF-8", FSCaseSensitive: &no,
+		EnvNames: []string{"PATH", "SHELL"}, Tools: map[string]string{"codex": "", "git": "/usr/bin/git"}}
+
+	diffs := DiffEnvFingerprints(a, b)
+	got := map[string]EnvDifference{}
+	for _, d := range diffs {
+		got[d.Field] = d
+	}
+	if len(diffs) != 5 {
+		t.Fatalf("expected 5 differences, got %+v", diffs)
+	}
+	if d := got["fs_case_sensitive"]; d.A != "true" || d.B != "false" || !strings.Contains(d.Note, "allowed_write_paths") {
+		t.Fatalf("unexpected case sensitivity diff: %+v", d)
+	}
+	if d := got["env.ATTRACTION_BACKEND"]; d.A != "set" || d.B != "unset" || d.Note == "" {
+		t.Fatalf("expected annotated backend env diff: %+v", d)
+	}
+	if d := got["env.SHELL"]; d.A != "unset" || d.B != "set" || d.Note != "" {
+		t.Fatalf("expected unannotated shell env diff: %+v", d)
+	}
+	if d := got["tools.codex"]; d.B != "" || d.Note == "" {
+		t.Fatalf("expected annotated codex diff: %+v", d)
+	}
+	if _, ok := got["goos"]; !ok {
+		t.Fatal("expected goos diff")
+	}
+}
+
+func TestEnvFingerprintRecordsAndDiffsToolVersions(t *testing.T) {
+	bin := t.TempDir()
+	writeFile(t, filepath.Join(bin, "git"), "#!/bin/sh\necho 'git version 9.9.9'\n")
+	if err := os.Chmod(filepath.Join(bin, "git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	fp := collectEnvFingerprint(t.TempDir())
+	if fp.ToolVersions["git"] != "git version 9.9.9" {
+		t.Fatalf("tool versions = %v", fp.ToolVersions)
+	}
+	if _, ok := fp.ToolVersions["sh"]; ok {
+		t.Fatalf("sh has no version probe: %v", fp.ToolVersions)
+	}
+
+	other := fp
+	other.ToolVersions = map[string]string{}
+	for k, v := range fp.ToolVersions {
+		other.ToolVersions[k] = v
+	}
+	other.ToolVersions["git"] = "git version 2.39.5"
+	diffs := DiffEnvFingerprints(fp, other)
+	if len(diffs) != 1 || diffs[0].Field != "tool_versions.git" || diffs[0].B != "git version 2.39.5" || diffs[0].Note == "" {
+		t.Fatalf("diffs = %+v", diffs)
+	}
+	other.ToolVersions = nil
+	if diffs := DiffEnvFingerprints(fp, other); len(diffs) != 0 {
+		t.Fatalf("a fingerprint without versions must not diff: %+v", diffs)
+	}
+}
+
+func TestRelevantEnvNamesKeepsNamesOnly(t *testing.T) {
+	names := relevantEnvNames([]string{"ATTRACTOR_LOG_LEVEL=debug", "SECRET_TOKEN=abc", "PATH=/bin", "GOFLAGS=-mod=mod", "PATH=/usr/bin"})
+	if strings.Join(names, ",") != "ATTRACTOR_LOG_LEVEL,GOFLAGS,PATH" {
+		t.Fatalf("unexpected names: %v", names)
+	}
+}
+
+func TestRunManifestRecordsEnvironmentAndCompareEnv(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTOR_FINGERPRINT_PROBE", "probe-secret-value")
+	workdir, runsdir, pipeline := setupRun(t, `digraph G { start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }`)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "r1")
+	b, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		Environment EnvFingerprint `json:"environment"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Environment.GOOS == "" || m.Environment.CPUCount == 0 || m.Environment.FSCaseSensitive == nil {
+		t.Fatalf("incomplete fingerprint: %+v", m.Environment)
+	}
+	if !strings.Contains(string(b), "ATTRACTOR_FINGERPRINT_PROBE") || strings.Contains(string(b), "probe-secret-value") {
+		t.Fatal("env var names must be recorded without values")
+	}
+
+	other := filepath.Join(runsdir, "r2")
+	mutated := m.Environment
+	mutated.Locale = "tr_TR.UTF-8"
+	if err := os.MkdirAll(other, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSON(filepath.Join(other, "manifest.json"), map[string]any{"environment": mutated}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := CompareRunEnvironments(runDir, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "! locale:") || !strings.Contains(out, "sort order") {
+		t.Fatalf("unexpected compare output:\n%s", out)
+	}
+	if same, _ := CompareRunEnvironments(runDir, runDir); !strings.Contains(same, "no differences") {
+		t.Fatalf("expected no differences:\n%s", same)
+	}
+}
@@ -0,0 +1,228 @@
+package attractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// EscalationModeFail fails a rejected verification command at once, as
+	// before escalations existed. It is the default.
+	EscalationModeFail = "fail"
+	// EscalationModeInteractive waits for an operator to approve or deny it.
+	EscalationModeInteractive = "interactive"
+
+	escalationRequestFile  = "escalation.request.json"
+	escalationResponseFile = "escalation.response.json"
+	approvalsLedgerFile    = "approvals.ledger.jsonl"
+	// operatorEnv names who approves or denies an escalation.
+	operatorEnv = "ATTRACTOR_OPERATOR"
+)
+
+// escalationPollInterval is how often an interactive run looks for a
+// response; tests shorten it.
+var escalationPollInterval = 500 * time.Millisecond
+
+// ParseEscalationMode checks a --escalation-mode value; empty is fail.
+func ParseEscalationMode(s string) (string, error) {
+	switch strings.TrimSpace(s) {
+	case "", EscalationModeFail:
+		return EscalationModeFail, nil
+	case EscalationModeInteractive:
+		return EscalationModeInteractive, nil
+	}
+	return "", fmt.Errorf("invalid escalation mode %q (expected fail or interactive)", s)
+}
+
+// escalationRequest is escalation.request.json: a command the node's
+// allowlist rejected. Status is pending until a response arrives, then
+// approved or denied; in fail mode it is rejected.
+type escalationRequest struct {
+	SchemaVersion int    `json:"schema_version"`
+	ID            string `json:"id"`
+	NodeID        string `json:"node_id"`
+	AttemptID     string `json:"attempt_id,omitempty"`
+	Kind          string `json:"kind"`
+	Command       string `json:"command"`
+	Reason        string `json:"reason"`
+	Mode          string `json:"mode"`
+	Status        string `json:"status"`
+	RequestedAt   string `json:"requested_at"`
+	ResolvedAt    string `json:"resolved_at,omitempty"`
+}
+
+// EscalationResponse is escalation.response.json, written by the operator
+// (see RespondEscalation). ID, when set, must match the pending request.
+type EscalationResponse struct {
+	ID       string `json:"id,omitempty"`
+	Decision string `json:"decision"`
+	Operator string `json:"operator,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// approvalRecord is one line of the run's approvals.ledger.jsonl.
+type approvalRecord struct {
+	SchemaVersion int    `json:"schema_version"`
+	At            string `json:"at"`
+	RunID         string `json:"run_id"`
+	NodeID        string `json:"node_id"`
+	AttemptID     string `json:"attempt_id,omitempty"`
+	EscalationID  string `json:"escalation_id"`
+	Command       string `json:"command"`
+	Reason        string `json:"reason"`
+	Decision      string `json:"decision"`
+	Operator      string `json:"operator"`
+	Note          string `json:"note,omitempty"`
+}
+
+// escalationID is the same for the same command on the same node, so a
+// response written while a run was stopped still answers the request the
+// resumed run makes again.
+func escalationID(nodeID, command string) string {
+	h := sha256.Sum256([]byte(nodeID + "\x00" + command))
+	return "esc-" + hex.EncodeToString(h[:6])
+}
+
+// escalate records that node's allowlist rejected command and, in
+// interactive mode, waits for an operator's decision. It returns the
+// request's final status: rejected in fail mode, else approved or denied.
+// A run stopped while waiting returns ErrRunStopped, and the resumed run
+// asks again.
+func (e *Engine) escalate(node *Node, nodeDir, command, reason string) (string, error) {
+	req := escalationRequest{SchemaVersion: 1, ID: escalationID(node.ID, command), NodeID: node.ID, AttemptID: e.attempt.ID, Kind: "verification_command", Command: command, Reason: reason, Mode: e.escalationMode, Status: "pending", RequestedAt: time.Now().UTC().Format(time.RFC3339Nano)}
+	if req.Mode == "" {
+		req.Mode = EscalationModeFail
+	}
+	if req.Mode == EscalationModeFail {
+		req.Status = "rejected"
+	}
+	path := filepath.Join(nodeDir, escalationRequestFile)
+	if err := writeJSONAtomic(path, req); err != nil {
+		return "", err
+	}
+	e.recordEvent(map[string]any{"schema_version": 1, "type": "EscalationRequested", "node_id": node.ID, "escalation_id": req.ID, "command": command, "reason": reason, "mode": req.Mode, "request_path": path, "at": req.RequestedAt})
+	if req.Mode != EscalationModeInteractive {
+		return req.Status, nil
+	}
+	e.Logger.Warn("waiting for escalation response", "node", node.ID, "escalation_id", req.ID, "command", command, "response_path", filepath.Join(nodeDir, escalationResponseFile))
+	resp, err := e.awaitEscalationResponse(node, nodeDir, req.ID)
+	if err != nil {
+		return "", err
+	}
+	if resp.Operator == "" {
+		resp.Operator = os.Getenv(operatorEnv)
+	}
+	req.Status, req.ResolvedAt = "denied", time.Now().UTC().Format(time.RFC3339Nano)
+	if resp.Decision == "approve" {
+		req.Status = "approved"
+	}
+	if err := writeJSONAtomic(path, req); err != nil {
+		return "", err
+	}
+	rec := approvalRecord{SchemaVersion: 1, At: req.ResolvedAt, RunID: e.RunID, NodeID: node.ID, AttemptID: req.AttemptID, EscalationID: req.ID, Command: command, Reason: reason, Decision: req.Status, Operator: resp.Operator, Note: resp.Note}
+	if err := appendApprovalRecord(e.RunDir, rec); err != nil {
+		return "", err
+	}
+	e.recordEvent(map[string]any{"schema_version": 1, "type": "EscalationResolved", "node_id": node.ID, "escalation_id": req.ID, "decision": req.Status, "operator": resp.Operator, "at": req.ResolvedAt})
+	e.Logger.Info("escalation resolved", "node", node.ID, "escalation_id", req.ID, "decision", req.Status, "operator", resp.Operator)
+	return req.Status, nil
+}
+
+// awaitEscalationResponse polls for the node's response to request id and
+// consumes it, so an approval is used once.
+func (e *Engine) awaitEscalationResponse(node *Node, nodeDir, id string) (EscalationResponse, error) {
+	path := filepath.Join(nodeDir, escalationResponseFile)
+	warned := ""
+	for {
+		resp, err := readEscalationResponse(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			if warned != err.Error() {
+				warned = err.Error()
+				e.Logger.Warn("ignoring invalid escalation response", "node", node.ID, "path", path, "error", err)
+			}
+		case resp.ID != "" && resp.ID != id:
+			if warned != resp.ID {
+				warned = resp.ID
+				e.Logger.Warn("ignoring escalation response for another request", "node", node.ID, "escalation_id", id, "response_id", resp.ID)
+			}
+		default:
+			if err := os.Remove(path); err != nil {
+				return EscalationResponse{}, err
+			}
+			return resp, nil
+		}
+		select {
+		case <-e.stop:
+			return EscalationResponse{}, fmt.Errorf("%w: escalation %s for node %s has no response", ErrRunStopped, id, node.ID)
+		case <-time.After(escalationPollInterval):
+		}
+	}
+}
+
+// appendApprovalRecord adds rec to runDir's approvals ledger.
+func appendApprovalRecord(runDir string, rec approvalRecord) error {
+	f, err := os.OpenFile(filepath.Join(runDir, approvalsLedgerFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+func readEscalationResponse(path string) (EscalationResponse, error) {
+	var resp EscalationResponse
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return resp, err
+	}
+	if err := json.Unmarshal(b, &resp); err != nil {
+		return resp, err
+	}
+	if resp.Decision != "approve" && resp.Decision != "deny" {
+		return resp, fmt.Errorf("decision must be approve or deny, got %q", resp.Decision)
+	}
+	return resp, nil
+}
+
+// RespondEscalation answers nodeID's pending escalation in runDir
+// (`factory escalation approve|deny`). The operator defaults to
+// $ATTRACTOR_OPERATOR, then $USER.
+func RespondEscalation(runDir, nodeID string, resp EscalationResponse) error {
+	if resp.Decision != "approve" && resp.Decision != "deny" {
+		return fmt.Errorf("decision must be approve or deny, got %q", resp.Decision)
+	}
+	nodeDir := nodeArtifactDir(runDir, nodeID)
+	b, err := os.ReadFile(filepath.Join(nodeDir, escalationRequestFile))
+	if err != nil {
+		return fmt.Errorf("no escalation for node %s: %w", nodeID, err)
+	}
+	var req escalationRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return fmt.Errorf("invalid escalation request for node %s: %w", nodeID, err)
+	}
+	if req.Status != "pending" {
+		return fmt.Errorf("escalation %s for node %s is %s, not pending", req.ID, nodeID, req.Status)
+	}
+	resp.ID = req.ID
+	if resp.Operator == "" {
+		resp.Operator = os.Getenv(operatorEnv)
+	}
+	if resp.Operator == "" {
+		resp.Operator = os.Getenv("USER")
+	}
+	return writeJSONAtomic(filepath.Join(nodeDir, escalationResponseFile), resp)
+}
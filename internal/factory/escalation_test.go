@@ -0,0 +1,143 @@
+package attractor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// escalationDOT plans one allowed command and one outside verify's
+// allowlist.
+const escalationDOT = `digraph G {
+	start [shape=Mdiamond];
+	generate [shape=box, "test.verification_plan_json"="{\"files\":[],\"commands\":[\"echo ok\",\"touch escalated.txt\"]}"];
+	verify [shape=parallelogram, type=verification, "verification.allowed_commands"="echo"];
+	exit [shape=Msquare];
+	start -> generate -> verify -> exit;
+	}`
+
+// waitForEscalation waits until verify's escalation request is pending.
+func waitForEscalation(t *testing.T, runDir string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		path := filepath.Join(runDir, "verify", escalationRequestFile)
+		if _, err := os.Stat(path); err == nil && readStatusJSON(t, path)["status"] == "pending" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("no pending escalation")
+}
+
+func TestEscalationFailModeRecordsRequest(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, escalationDOT)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "esc1"})
+	runDir := filepath.Join(runsdir, "esc1")
+	if st := readStatusJSON(t, filepath.Join(runDir, "verify", "status.json")); st["failure_code"] != string(FailureVerificationNotAllowed) {
+		t.Fatalf("status = %v", st)
+	}
+	req := readStatusJSON(t, filepath.Join(runDir, "verify", escalationRequestFile))
+	if req["status"] != "rejected" || req["mode"] != EscalationModeFail || req["command"] != "touch escalated.txt" || req["attempt_id"] == nil {
+		t.Fatalf("request = %v", req)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, approvalsLedgerFile)); !os.IsNotExist(err) {
+		t.Fatalf("ledger written in fail mode: %v", err)
+	}
+	if err := RespondEscalation(runDir, "verify", EscalationResponse{Decision: "approve"}); err == nil {
+		t.Fatal("answered an escalation that is not pending")
+	}
+}
+
+func TestEscalationInteractiveDecisions(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv(operatorEnv, "alice")
+	defer func(d time.Duration) { escalationPollInterval = d }(escalationPollInterval)
+	escalationPollInterval = 10 * time.Millisecond
+	for _, tc := range []struct {
+		decision, wantStatus, wantCode string
+	}{
+		{"approve", "approved", ""},
+		{"deny", "denied", string(FailureApprovalRejected)},
+	} {
+		t.Run(tc.decision, func(t *testing.T) {
+			workdir, runsdir, pipeline := setupRun(t, escalationDOT)
+			runDir := filepath.Join(runsdir, "esc2")
+			done := make(chan error, 1)
+			go func() {
+				done <- RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "esc2", EscalationMode: EscalationModeInteractive})
+			}()
+			waitForEscalation(t, runDir)
+			if err := RespondEscalation(runDir, "verify", EscalationResponse{Decision: tc.decision, Note: "checked"}); err != nil {
+				t.Fatal(err)
+			}
+			<-done
+			st := readStatusJSON(t, filepath.Join(runDir, "verify", "status.json"))
+			if tc.wantCode == "" && st["outcome"] != "success" || tc.wantCode != "" && st["failure_code"] != tc.wantCode {
+				t.Fatalf("status = %v", st)
+			}
+			if _, err := os.Stat(filepath.Join(runDir, "workspace", "escalated.txt")); (err == nil) != (tc.decision == "approve") {
+				t.Fatalf("escalated command ran = %v", err == nil)
+			}
+			ledger := readJSONLRecords(t, filepath.Join(runDir, approvalsLedgerFile))
+			if len(ledger) != 1 || ledger[0]["decision"] != tc.wantStatus || ledger[0]["operator"] != "alice" || ledger[0]["note"] != "checked" || ledger[0]["command"] != "touch escalated.txt" || ledger[0]["attempt_id"] == nil {
+				t.Fatalf("ledger = %v", ledger)
+			}
+			if _, err := os.Stat(filepath.Join(runDir, "verify", escalationResponseFile)); !os.IsNotExist(err) {
+				t.Fatalf("response not consumed: %v", err)
+			}
+			types := map[string]bool{}
+			for _, ev := range readJSONLRecords(t, filepath.Join(runDir, eventsFile)) {
+				types[ev["type"].(string)] = true
+			}
+			if !types["EscalationRequested"] || !types["EscalationResolved"] {
+				t.Fatalf("events = %v", types)
+			}
+		})
+	}
+}
+
+func TestEscalationStopAndResume(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	defer func(d time.Duration) { escalationPollInterval = d }(escalationPollInterval)
+	escalationPollInterval = 10 * time.Millisecond
+	workdir, runsdir, pipeline := setupRun(t, escalationDOT)
+	runDir := filepath.Join(runsdir, "esc3")
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "esc3", EscalationMode: EscalationModeInteractive, Stop: stop})
+	}()
+	waitForEscalation(t, runDir)
+	close(stop)
+	if err := <-done; !errors.Is(err, ErrRunStopped) {
+		t.Fatalf("err = %v", err)
+	}
+	// The answer given while the run is stopped is used by the resume.
+	if err := RespondEscalation(runDir, "verify", EscalationResponse{Decision: "approve", Operator: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Runsdir: runsdir, RunID: "esc3", Resume: true, EscalationMode: EscalationModeInteractive}); err != nil {
+		t.Fatal(err)
+	}
+	if st := readStatusJSON(t, filepath.Join(runDir, "verify", "status.json")); st["outcome"] != "success" {
+		t.Fatalf("status = %v", st)
+	}
+	if ledger := readJSONLRecords(t, filepath.Join(runDir, approvalsLedgerFile)); len(ledger) != 1 || ledger[0]["operator"] != "bob" {
+		t.Fatalf("ledger = %v", ledger)
+	}
+}
+
+func TestParseEscalationMode(t *testing.T) {
+	for in, want := range map[string]string{"": "fail", "fail": "fail", "interactive": "interactive"} {
+		if got, err := ParseEscalationMode(in); err != nil || got != want {
+			t.Fatalf("ParseEscalationMode(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseEscalationMode("ask"); err == nil {
+		t.Fatal("accepted an unknown mode")
+	}
+}
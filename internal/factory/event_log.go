@@ -0,0 +1,137 @@
+package attractor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+const eventsFile = "events.jsonl"
+
+// errCorruptEvent marks an events.jsonl line that is not JSON or whose crc
+// does not match the rest of the line.
+var errCorruptEvent = errors.New("corrupt event line")
+
+var (
+	eventCRCTable = crc32.MakeTable(crc32.Castagnoli)
+	// eventCRCRe matches the crc member encodeEventLine appends last.
+	eventCRCRe = regexp.MustCompile(`,?"crc":"([0-9a-f]{8})"}$`)
+	// eventLogMu serializes appends within the process; lockEventLog covers
+	// other processes, such as hooks, appending to the same file.
+	eventLogMu sync.Mutex
+)
+
+// encodeEventLine marshals ev and appends a "crc" member holding the
+// CRC-32C of the document as marshaled without it. Any crc already in ev
+// is replaced.
+func encodeEventLine(ev map[string]any) ([]byte, error) {
+	if _, ok := ev["crc"]; ok {
+		ev = cloneContext(ev)
+		delete(ev, "crc")
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	sum := fmt.Sprintf(`"crc":"%08x"}`, crc32.Checksum(b, eventCRCTable))
+	if len(b) > 2 {
+		sum = "," + sum
+	}
+	return append(append(b[:len(b)-1], sum...), '\n'), nil
+}
+
+// decodeEventLine parses one events.jsonl line and checks its crc. Lines
+// without a crc, written before events carried one, are accepted as is.
+func decodeEventLine(line []byte) (map[string]any, error) {
+	line = bytes.TrimSpace(line)
+	ev := map[string]any{}
+	if err := json.Unmarshal(line, &ev); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptEvent, err)
+	}
+	if _, ok := ev["crc"]; !ok {
+		return ev, nil
+	}
+	m := eventCRCRe.FindSubmatchIndex(line)
+	if m == nil {
+		return nil, fmt.Errorf("%w: crc is not the last member", errCorruptEvent)
+	}
+	body := append(append([]byte{}, line[:m[0]]...), '}')
+	if want := fmt.Sprintf("%08x", crc32.Checksum(body, eventCRCTable)); want != string(line[m[2]:m[3]]) {
+		return nil, fmt.Errorf("%w: crc %s does not match %s", errCorruptEvent, line[m[2]:m[3]], want)
+	}
+	delete(ev, "crc")
+	return ev, nil
+}
+
+// jsonlLineValid reports whether a JSONL line parses and, when it carries
+// an event crc, whether the crc matches.
+func jsonlLineValid(line []byte) bool {
+	if !json.Valid(line) {
+		return false
+	}
+	if !bytes.Contains(line, []byte(`"crc":"`)) {
+		return true
+	}
+	_, err := decodeEventLine(line)
+	return err == nil
+}
+
+// appendEvent writes ev to the run's events.jsonl as one checksummed line.
+// The write is a single O_APPEND write under an exclusive file lock, so
+// concurrent writers never interleave partial lines.
+func appendEvent(runDir string, ev map[string]any) error {
+	line, err := encodeEventLine(ev)
+	if err != nil {
+		return err
+	}
+	eventLogMu.Lock()
+	defer eventLogMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(runDir, eventsFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	unlock, err := lockEventLog(f)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	_, err = f.Write(line)
+	return err
+}
+
+// readEvents returns the run's events in order, skipping blank lines and
+// counting lines that fail decodeEventLine. A run without events.jsonl has
+// no events.
+func readEvents(runDir string) ([]map[string]any, int, error) {
+	f, err := os.Open(filepath.Join(runDir, eventsFile))
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	events, corrupt := []map[string]any{}, 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		ev, err := decodeEventLine(sc.Bytes())
+		if err != nil {
+			corrupt++
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, corrupt, sc.Err()
+}
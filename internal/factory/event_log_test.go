@@ -0,0 +1,137 @@
+package attractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEventLineCRC(t *testing.T) {
+	for _, ev := range []map[string]any{{}, {"type": "StageStarted", "node_id": "a", "crc": "stale"}} {
+		line, err := encodeEventLine(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeEventLine(line)
+		if err != nil {
+			t.Fatalf("decode %s: %v", line, err)
+		}
+		if _, ok := got["crc"]; ok || got["node_id"] != ev["node_id"] {
+			t.Fatalf("decoded %s = %v", line, got)
+		}
+	}
+	line, _ := encodeEventLine(map[string]any{"type": "StageStarted", "node_id": "a"})
+	tampered := bytes.Replace(line, []byte(`"node_id":"a"`), []byte(`"node_id":"b"`), 1)
+	if _, err := decodeEventLine(tampered); !errors.Is(err, errCorruptEvent) {
+		t.Fatalf("tampered line err = %v", err)
+	}
+	if ev, err := decodeEventLine([]byte(`{"type":"StageStarted"}`)); err != nil || ev["type"] != "StageStarted" {
+		t.Fatalf("line without crc = %v, %v", ev, err)
+	}
+}
+
+// TestEventLogRecoversFromTruncation cuts events.jsonl at every byte offset,
+// as a crash mid-write can, and checks that readers keep every complete
+// event and the doctor repairs the rest.
+func TestEventLogRecoversFromTruncation(t *testing.T) {
+	src := t.TempDir()
+	ends := []int{}
+	for i := 0; i < 5; i++ {
+		if err := appendEvent(src, map[string]any{"type": "StageCompleted", "node_id": fmt.Sprintf("n%d", i), "notes": strings.Repeat("x", i*7)}); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filepath.Join(src, eventsFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ends = append(ends, int(info.Size()))
+	}
+	full, err := os.ReadFile(filepath.Join(src, eventsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runDir := t.TempDir()
+	writeFile(t, filepath.Join(runDir, "manifest.json"), "{}")
+	for cut := 0; cut <= len(full); cut++ {
+		writeFile(t, filepath.Join(runDir, eventsFile), string(full[:cut]))
+		want := 0
+		for _, end := range ends {
+			// A line missing only its newline still decodes.
+			if end-1 <= cut {
+				want++
+			}
+		}
+		events, corrupt, err := readEvents(runDir)
+		if err != nil || len(events) != want || corrupt > 1 {
+			t.Fatalf("cut %d: %d events, %d corrupt, %v; want %d events", cut, len(events), corrupt, err, want)
+		}
+		rep, err := DiagnoseRun(runDir)
+		if err != nil {
+			t.Fatalf("cut %d: %v", cut, err)
+		}
+		if err := RepairRun(&rep); err != nil {
+			t.Fatalf("cut %d: %v", cut, err)
+		}
+		// The doctor also drops a last line that lacks its newline.
+		events, corrupt, err = readEvents(runDir)
+		if err != nil || corrupt != 0 || len(events) < want-1 {
+			t.Fatalf("cut %d after repair: %d events, %d corrupt, %v", cut, len(events), corrupt, err)
+		}
+	}
+}
+
+func TestAppendEventConcurrentWritersDoNotInterleave(t *testing.T) {
+	runDir := t.TempDir()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_ = appendEvent(runDir, map[string]any{"type": "HookOutput", "writer": w, "payload": strings.Repeat("y", 8192)})
+			}
+		}(w)
+	}
+	wg.Wait()
+	events, corrupt, err := readEvents(runDir)
+	if err != nil || corrupt != 0 || len(events) != 400 {
+		t.Fatalf("%d events, %d corrupt, %v", len(events), corrupt, err)
+	}
+}
+
+func TestDoctorStripsCorruptEventLines(t *testing.T) {
+	runDir := t.TempDir()
+	writeFile(t, filepath.Join(runDir, "manifest.json"), "{}")
+	for _, id := range []string{"a", "b", "c"} {
+		if err := appendEvent(runDir, map[string]any{"type": "StageCompleted", "node_id": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(runDir, eventsFile)
+	b, _ := os.ReadFile(path)
+	writeFile(t, path, strings.Replace(string(b), `"node_id":"b"`, `"node_id":"B"`, 1))
+	if events, corrupt, _ := readEvents(runDir); len(events) != 2 || corrupt != 1 {
+		t.Fatalf("%d events, %d corrupt", len(events), corrupt)
+	}
+	rep, err := DiagnoseRun(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.CorruptLines) != 1 || rep.CorruptLines[0].File != eventsFile || fmt.Sprint(rep.CorruptLines[0].Lines) != "[2]" || rep.LastEvent != "StageCompleted" {
+		t.Fatalf("report = %+v", rep)
+	}
+	if err := RepairRun(&rep); err != nil {
+		t.Fatal(err)
+	}
+	if events, corrupt, _ := readEvents(runDir); len(events) != 2 || corrupt != 0 || events[1]["node_id"] != "c" {
+		t.Fatalf("after repair: %v, %d corrupt", events, corrupt)
+	}
+	if strings.Join(rep.Repairs, "\n") != "stripped 1 corrupt line(s) from events.jsonl" {
+		t.Fatalf("repairs = %v", rep.Repairs)
+	}
+}
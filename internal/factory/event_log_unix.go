@@ -0,0 +1,16 @@
+//go:build unix
+
+package attractor
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockEventLog takes an exclusive advisory lock on f until unlock is called.
+func lockEventLog(f *os.File) (func(), error) {
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	return func() { _ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN) }, nil
+}
@@ -0,0 +1,167 @@
+package attractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// analysisSuccessors lists each node's successors: its edges plus the
+// implicit manager loop edges manager -> loop.body_entry and
+// loop.body_exit -> manager. Edges to missing nodes are left out.
+func analysisSuccessors(g *Graph) map[string][]string {
+	succ := map[string][]string{}
+	add := func(from, to string) {
+		if _, ok := g.Nodes[from]; !ok {
+			return
+		}
+		if _, ok := g.Nodes[to]; ok {
+			succ[from] = append(succ[from], to)
+		}
+	}
+	for _, e := range g.Edges {
+		add(e.From, e.To)
+	}
+	for _, id := range sortedKeys(g.Nodes) {
+		n := g.Nodes[id]
+		if !isManagerLoopNode(n) {
+			continue
+		}
+		if entry := strings.TrimSpace(n.StringAttr("loop.body_entry", "")); entry != "" {
+			add(id, entry)
+		}
+		if exit := strings.TrimSpace(n.StringAttr("loop.body_exit", "")); exit != "" {
+			add(exit, id)
+		}
+	}
+	return succ
+}
+
+// validateExitReachability warns about nodes reachable from start that can
+// never reach an exit, and about cycles with no edge leaving them. Both
+// passes are linear in nodes plus edges.
+func validateExitReachability(g *Graph, start string) []Diagnostic {
+	if _, ok := g.Nodes[start]; !ok {
+		return nil
+	}
+	succ := analysisSuccessors(g)
+	pred := map[string][]string{}
+	for from, tos := range succ {
+		for _, to := range tos {
+			pred[to] = append(pred[to], from)
+		}
+	}
+	reachesExit := map[string]bool{}
+	queue := []string{}
+	for id := range g.Nodes {
+		if isExit(g, id) {
+			reachesExit[id] = true
+			queue = append(queue, id)
+		}
+	}
+	if len(queue) == 0 {
+		return nil
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, p := range pred[id] {
+			if !reachesExit[p] {
+				reachesExit[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	d := []Diagnostic{}
+	comps := stronglyConnectedFrom(start, succ)
+	for _, comp := range comps {
+		for _, id := range comp {
+			if !reachesExit[id] {
+				d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s cannot reach any exit node", id)})
+			}
+		}
+	}
+	compOf := map[string]int{}
+	for i, comp := range comps {
+		for _, id := range comp {
+			compOf[id] = i
+		}
+	}
+	for i, comp := range comps {
+		cyclic, leaves := len(comp) > 1, false
+		for _, id := range comp {
+			for _, to := range succ[id] {
+				if to == id {
+					cyclic = true
+				}
+				if compOf[to] != i {
+					leaves = true
+				}
+			}
+		}
+		if cyclic && !leaves {
+			sorted := append([]string(nil), comp...)
+			sort.Strings(sorted)
+			d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("cycle %s has no edge leaving it under any outcome", strings.Join(sorted, ","))})
+		}
+	}
+	return d
+}
+
+// stronglyConnectedFrom returns the strongly connected components reachable
+// from start (Tarjan's algorithm, iterative so deep graphs cannot overflow
+// the stack).
+func stronglyConnectedFrom(start string, succ map[string][]string) [][]string {
+	type frame struct {
+		id   string
+		next int
+	}
+	index, low := map[string]int{}, map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+	comps := [][]string{}
+	visit := func(id string) {
+		index[id], low[id] = len(index), len(index)
+		stack = append(stack, id)
+		onStack[id] = true
+	}
+	visit(start)
+	work := []frame{{id: start}}
+	for len(work) > 0 {
+		top := len(work) - 1
+		id := work[top].id
+		if work[top].next < len(succ[id]) {
+			to := succ[id][work[top].next]
+			work[top].next++
+			if _, seen := index[to]; !seen {
+				visit(to)
+				work = append(work, frame{id: to})
+			} else if onStack[to] && index[to] < low[id] {
+				low[id] = index[to]
+			}
+			continue
+		}
+		work = work[:top]
+		if top > 0 {
+			if parent := work[top-1].id; low[id] < low[parent] {
+				low[parent] = low[id]
+			}
+		}
+		if low[id] != index[id] {
+			continue
+		}
+		comp := []string{}
+		for {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[n] = false
+			comp = append(comp, n)
+			if n == id {
+				break
+			}
+		}
+		comps = append(comps, comp)
+	}
+	return comps
+}
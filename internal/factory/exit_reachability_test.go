@@ -0,0 +1,110 @@
+package attractor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateWarnsWhenNoExitIsReachable(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	test [shape=parallelogram, tool_command="go test ./..."];
+	fix [shape=box];
+	exit [shape=Msquare];
+	start -> test;
+	test -> exit [condition="outcome=success"];
+	test -> fix [condition="outcome=fail"];
+	fix -> fix [condition="outcome=fail"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags := ValidateGraph(g)
+	if HasErrors(diags) {
+		t.Fatalf("unexpected errors: %v", diags)
+	}
+	msgs := diagnosticMessages(diags)
+	for _, want := range []string{"node fix cannot reach any exit node", "cycle fix has no edge leaving it under any outcome"} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in %s", want, msgs)
+		}
+	}
+	if strings.Contains(msgs, "node test cannot reach") {
+		t.Fatalf("test reaches exit on success: %s", msgs)
+	}
+	if !HasErrors(StrictDiagnostics(diags)) {
+		t.Fatal("strict validation should turn the warnings into errors")
+	}
+}
+
+func TestValidateClosedCycleNamesEveryNode(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	gate [shape=box];
+	a [shape=box];
+	b [shape=box];
+	exit [shape=Msquare];
+	start -> gate;
+	gate -> exit [condition="outcome=success"];
+	gate -> a [condition="outcome=fail"];
+	a -> b;
+	b -> a;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	if !strings.Contains(msgs, "cycle a,b has no edge leaving it") || strings.Contains(msgs, "cycle gate") {
+		t.Fatalf("diagnostics = %s", msgs)
+	}
+}
+
+func TestValidateExitReachabilityAcceptsLoops(t *testing.T) {
+	for name, dot := range map[string]string{
+		"fix loop": `digraph G { start [shape=Mdiamond]; test [shape=parallelogram, tool_command="true"]; fix [shape=box]; exit [shape=Msquare]; start -> test; test -> exit [condition="outcome=success"]; test -> fix [condition="outcome=fail"]; fix -> test; }`,
+		"manager loop": `digraph G {
+		start [shape=Mdiamond];
+		manager [shape=house, type="stack.manager_loop", "loop.body_entry"="plan", "loop.body_exit"="review", "loop.done_when"="context.done=true"];
+		plan [shape=box];
+		review [shape=box];
+		exit [shape=Msquare];
+		start -> manager;
+		plan -> review;
+		manager -> exit;
+		}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			g, err := ParseDOT(dot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msgs := diagnosticMessages(ValidateGraph(g)); strings.Contains(msgs, "exit node") || strings.Contains(msgs, "cycle") {
+				t.Fatalf("unexpected diagnostics: %s", msgs)
+			}
+		})
+	}
+}
+
+func TestValidateExitReachabilityLargeGraph(t *testing.T) {
+	const n = 50000
+	g := NewGraph()
+	g.Nodes["start"] = &Node{ID: "start", Attrs: map[string]Value{"shape": "Mdiamond"}}
+	g.Nodes["exit"] = &Node{ID: "exit", Attrs: map[string]Value{"shape": "Msquare"}}
+	g.Edges = append(g.Edges, &Edge{From: "start", To: "n0", Attrs: map[string]Value{}})
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("n%d", i)
+		g.Nodes[id] = &Node{ID: id, Attrs: map[string]Value{"shape": "box"}}
+		g.Edges = append(g.Edges, &Edge{From: id, To: fmt.Sprintf("n%d", (i+1)%n), Attrs: map[string]Value{}})
+	}
+	g.Edges = append(g.Edges, &Edge{From: fmt.Sprintf("n%d", n-1), To: "exit", Attrs: map[string]Value{"condition": "outcome=success"}})
+	if d := validateExitReachability(g, "start"); len(d) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", d)
+	}
+	// Without the exit edge, start and every ring node are stranded.
+	g.Edges = g.Edges[:len(g.Edges)-1]
+	d := validateExitReachability(g, "start")
+	if len(d) != n+2 || !strings.Contains(d[len(d)-1].Message, "has no edge leaving it") {
+		t.Fatalf("expected %d diagnostics, got %d", n+2, len(d))
+	}
+}
@@ -0,0 +1,97 @@
+package attractor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseExpectedOutputs reads expected_outputs, the workspace paths a codergen
+// or tool node must leave behind. Entries use the allowed_write_paths
+// syntax: a file path, or a directory ending in "/" that must hold at least
+// one file.
+func parseExpectedOutputs(n *Node) ([]string, error) {
+	raw := strings.TrimSpace(n.StringAttr("expected_outputs", ""))
+	if raw == "" {
+		return nil, nil
+	}
+	out := []string{}
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			return nil, fmt.Errorf("expected_outputs contains empty entry")
+		}
+		if strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("expected_outputs contains absolute path: %s", p)
+		}
+		if strings.Contains(p, "..") {
+			return nil, fmt.Errorf("expected_outputs contains parent segment: %s", p)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// missingExpectedOutputs returns the entries with no matching file in the
+// post-node workspace snapshot.
+func missingExpectedOutputs(entries []string, after map[string]fileState) []string {
+	missing := []string{}
+	for _, entry := range entries {
+		found := false
+		if strings.HasSuffix(entry, "/") {
+			for p := range after {
+				if strings.HasPrefix(p, entry) {
+					found = true
+					break
+				}
+			}
+		} else {
+			_, found = after[entry]
+		}
+		if !found {
+			missing = append(missing, entry)
+		}
+	}
+	return missing
+}
+
+// validateExpectedOutputs rejects malformed entries and nodes that are not
+// codergen or tool nodes, and warns about entries the node's
+// allowed_write_paths would not let it create.
+func validateExpectedOutputs(n *Node) []Diagnostic {
+	if _, ok := n.Attrs["expected_outputs"]; !ok {
+		return nil
+	}
+	if !isCodergenNode(n) && handlerType(n) != "tool" {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets expected_outputs but is not a codergen or tool node", n.ID)}}
+	}
+	entries, err := parseExpectedOutputs(n)
+	if err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s: %v", n.ID, err)}}
+	}
+	allowed, err := ParseAllowedWritePaths(n)
+	if err != nil || len(allowed) == 0 {
+		return nil
+	}
+	d := []Diagnostic{}
+	for _, entry := range entries {
+		if pathAllowed(strings.TrimSuffix(entry, "/"), allowed) || allowsWriteUnder(entry, allowed) {
+			continue
+		}
+		d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s expected_outputs entry %s is outside allowed_write_paths; the node cannot create it without a guardrail violation", n.ID, entry)})
+	}
+	return d
+}
+
+// allowsWriteUnder reports whether a directory entry contains an allowed path,
+// so the node can legally put a file in it.
+func allowsWriteUnder(entry string, allowed []string) bool {
+	if !strings.HasSuffix(entry, "/") {
+		return false
+	}
+	for _, a := range allowed {
+		if strings.HasPrefix(a, entry) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package attractor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpectedOutputsFailStageWhenMissing(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	implement [shape=parallelogram, tool_command="mkdir -p agent && touch agent/main.go", expected_outputs="agent/main.go,agent/go.mod"];
+	dirs [shape=parallelogram, tool_command="true", expected_outputs="agent/"];
+	exit [shape=Msquare];
+	start -> implement;
+	implement -> dirs [condition="outcome=fail"];
+	implement -> exit [condition="outcome=success"];
+	dirs -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "eo1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "eo1")
+	st := readStatusJSON(t, filepath.Join(runDir, "implement", "status.json"))
+	if st["outcome"] != "fail" || st["failure_reason"] != "expected_outputs_missing: agent/go.mod" || st["failure_code"] != string(FailureExpectedOutputsMissing) {
+		t.Fatalf("status = %v", st)
+	}
+	evs := eventsOfType(t, runDir, "ExpectedOutputsMissing")
+	if len(evs) != 1 || evs[0]["node_id"] != "implement" {
+		t.Fatalf("ExpectedOutputsMissing events = %v", evs)
+	}
+	if st := readStatusJSON(t, filepath.Join(runDir, "dirs", "status.json")); st["outcome"] != "success" {
+		t.Fatalf("directory entry with files should be satisfied: %v", st)
+	}
+}
+
+func TestExpectedOutputsReportedWithGuardrailViolation(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	implement [shape=parallelogram, tool_command="touch stray.txt", allowed_write_paths="agent/", expected_outputs="agent/main.go"];
+	exit [shape=Msquare];
+	start -> implement -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "eo2"})
+	st := readStatusJSON(t, filepath.Join(runsdir, "eo2", "implement", "status.json"))
+	reason, _ := st["failure_reason"].(string)
+	if st["failure_code"] != string(FailureGuardrailWriteViolation) || !strings.Contains(reason, "stray.txt") || !strings.Contains(reason, "expected_outputs_missing: agent/main.go") {
+		t.Fatalf("status = %v", st)
+	}
+}
+
+func TestValidateExpectedOutputs(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, allowed_write_paths="agent/main.go", expected_outputs="agent/main.go,agent/,docs/README.md"];
+	b [shape=box, expected_outputs="/etc/passwd"];
+	exit [shape=Msquare, expected_outputs="x"];
+	start -> a -> b -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{
+		"node a expected_outputs entry docs/README.md is outside allowed_write_paths",
+		"node b: expected_outputs contains absolute path: /etc/passwd",
+		"node exit sets expected_outputs but is not a codergen or tool node",
+	} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+	if strings.Contains(msgs, "entry agent/") {
+		t.Fatalf("covered entries should not warn:\n%s", msgs)
+	}
+}
@@ -0,0 +1,138 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExplainRoute explains the routing decision recorded for fromNode in the run
+// at runDir. The graph is loaded from the run's embedded pipeline copy and the
+// decision is recomputed with decideRoute, the same code path the engine uses.
+func ExplainRoute(runDir, fromNode string) (string, error) {
+	if err := checkRunLayout(runDir); err != nil {
+		return "", err
+	}
+	g, err := loadRunGraph(runDir)
+	if err != nil {
+		return "", err
+	}
+	if g.Nodes[fromNode] == nil {
+		return "", fmt.Errorf("node not found in run pipeline: %s", fromNode)
+	}
+	recorded, found, err := lastRouteRecord(runDir, fromNode)
+	if err != nil {
+		return "", err
+	}
+	status, statusErr := readStatus(filepath.Join(nodeArtifactDir(runDir, fromNode), "status.json"))
+	outcome := ""
+	switch {
+	case found:
+		outcome, _ = recorded["outcome"].(string)
+	case statusErr == nil:
+		outcome = status.Outcome
+	default:
+		return "", fmt.Errorf("no routing record or status for node %s", fromNode)
+	}
+
+	decision := decideRoute(g, fromNode, outcome, recordedVisits(recorded))
+	var b strings.Builder
+	fmt.Fprintf(&b, "route explanation for %s (run %s)\n", fromNode, filepath.Base(runDir))
+	if statusErr == nil {
+		fmt.Fprintf(&b, "status: outcome=%s", status.Outcome)
+		if strings.TrimSpace(status.FailureReason) != "" {
+			fmt.Fprintf(&b, " failure_reason=%s", status.FailureReason)
+		}
+		if status.FailureCode != "" {
+			fmt.Fprintf(&b, " failure_code=%s", status.FailureCode)
+		}
+		b.WriteString("\n")
+		if status.PreferredNextLabel != "" || len(status.SuggestedNextIDs) > 0 {
+			fmt.Fprintf(&b, "agent suggestions (not used by v0 routing): preferred_next_label=%q suggested_next_ids=%v\n", status.PreferredNextLabel, status.SuggestedNextIDs)
+		}
+	}
+	for i, step := range decision.Steps {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+	}
+	if found {
+		recordedNext, _ := recorded["next_node"].(string)
+		fmt.Fprintf(&b, "recorded next_node: %s\n", displayNode(recordedNext))
+		if recordedNext != decision.Selected {
+			fmt.Fprintf(&b, "WARNING: recorded decision differs from recomputed decision (%s); the pipeline copy may have been edited\n", displayNode(decision.Selected))
+		}
+	} else {
+		b.WriteString("no RouteEvaluated record found (node may be an exit or the run stopped before routing)\n")
+	}
+	return b.String(), nil
+}
+
+// recordedVisits returns the visit counts a RouteEvaluated record says its
+// conditions read, so visits() conditions are recomputed with the same input.
+func recordedVisits(rec map[string]any) map[string]int {
+	out := map[string]int{}
+	raw, _ := rec["visits"].(map[string]any)
+	for id, v := range raw {
+		if n, ok := v.(float64); ok {
+			out[id] = int(n)
+		}
+	}
+	return out
+}
+
+func displayNode(id string) string {
+	if id == "" {
+		return "(none)"
+	}
+	return id
+}
+
+func loadRunGraph(runDir string) (*Graph, error) {
+	path := filepath.Join(runDir, "pipeline.dot")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("run pipeline copy unreadable: %w", err)
+	}
+	g, err := ParseDOT(string(b))
+	if err != nil {
+		return nil, err
+	}
+	applyGraphAttrDefaults(g)
+	return g, nil
+}
+
+// lastRouteRecord returns the last RouteEvaluated record for fromNode. It
+// seeks through trace.index.jsonl when the run has one; otherwise, when the
+// index predates the record (a resumed pre-index run), or when the entry is
+// stale, it scans every trace segment.
+func lastRouteRecord(runDir, fromNode string) (map[string]any, bool, error) {
+	index, err := readTraceIndex(runDir)
+	if err != nil {
+		return nil, false, err
+	}
+	if index != nil {
+		for i := len(index) - 1; i >= 0; i-- {
+			if index[i].Type == "RouteEvaluated" && index[i].NodeID == fromNode {
+				rec, err := readTraceRecordAt(runDir, index[i])
+				if errors.Is(err, errStaleTraceIndex) {
+					break
+				}
+				if err != nil {
+					return nil, false, err
+				}
+				return rec, true, nil
+			}
+		}
+	}
+	var last map[string]any
+	err = scanTraceRecords(runDir, func(rec map[string]any) {
+		if rec["type"] == "RouteEvaluated" && rec["from_node"] == fromNode {
+			last = rec
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return last, last != nil, nil
+}
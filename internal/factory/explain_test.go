@@ -0,0 +1,97 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecideRouteFallsBackToUnconditionalEdges(t *testing.T) {
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=box]; fix [shape=box]; done [shape=box]; exit [shape=Msquare];
+	start -> a; a -> done [condition="outcome=success"]; a -> fix; a -> exit [weight=2]; fix -> exit; done -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := decideRoute(g, "a", "fail", nil)
+	if d.Tier != "unconditional" || d.Selected != "exit" {
+		t.Fatalf("expected weighted unconditional fallback, got %+v", d)
+	}
+	if len(d.Ordered) != 2 || d.Ordered[1].To != "fix" {
+		t.Fatalf("unexpected candidate order: %+v", d.Ordered)
+	}
+	d = decideRoute(g, "a", "success", nil)
+	if d.Tier != "conditional" || d.Selected != "done" {
+		t.Fatalf("expected conditional match to win over heavier unconditional, got %+v", d)
+	}
+	d = decideRoute(g, "exit", "success", nil)
+	if d.Selected != "" || d.Tier != "none" {
+		t.Fatalf("expected no route, got %+v", d)
+	}
+}
+
+func TestExplainRouteMatchesEngineDecision(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, "test.outcome"="fail", "test.suggested_next_ids"="exit_ok"];
+	fix [shape=box];
+	exit_ok [shape=Msquare];
+	exit_config_fail [shape=Msquare];
+	start -> a;
+	a -> exit_ok [condition="outcome=success", weight=10];
+	a -> fix [weight=1];
+	a -> exit_config_fail [weight=1];
+	fix -> exit_ok;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ex1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ex1")
+	if _, err := os.Stat(filepath.Join(runDir, "pipeline.dot")); err != nil {
+		t.Fatal("expected embedded pipeline copy")
+	}
+	out, err := ExplainRoute(runDir, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken := "exit_config_fail"
+	if _, err := os.Stat(filepath.Join(runDir, taken, "status.json")); err != nil {
+		t.Fatalf("expected engine to take %s", taken)
+	}
+	for _, want := range []string{
+		"outcome=fail",
+		"edge a -> exit_ok condition=outcome=success weight=10: no match",
+		"falling back to unconditional edges",
+		"ordered by highest weight, then target id: exit_config_fail(weight=1), fix(weight=1)",
+		"selected " + taken,
+		"recorded next_node: " + taken,
+		"agent suggestions (not used by v0 routing)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in explanation:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "WARNING") {
+		t.Fatalf("explanation should agree with engine:\n%s", out)
+	}
+}
+
+func TestExplainRouteFlagsEditedPipelineCopy(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; b [shape=box]; exit [shape=Msquare]; start -> a; a -> exit [weight=5]; a -> b; b -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ex2"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ex2")
+	writeFile(t, filepath.Join(runDir, "pipeline.dot"), `digraph G { start [shape=Mdiamond]; a [shape=box]; b [shape=box]; exit [shape=Msquare]; start -> a; a -> exit; a -> b [weight=9]; b -> exit; }`)
+	out, err := ExplainRoute(runDir, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "WARNING: recorded decision differs") {
+		t.Fatalf("expected divergence warning:\n%s", out)
+	}
+}
@@ -0,0 +1,120 @@
+package attractor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// FailureCode is the machine-readable class of a failed outcome. It is set
+// alongside failure_reason, which stays free text for humans.
+type FailureCode string
+
+const (
+	FailureToolExitNonzero               FailureCode = "tool_exit_nonzero"
+	FailureToolCommandRejected           FailureCode = "tool_command_rejected"
+	FailureRequiredToolFailed            FailureCode = "required_tool_failed"
+	FailureRequiredToolNotRun            FailureCode = "required_tool_not_run"
+	FailureContextContractMissingReads   FailureCode = "context_contract_missing_reads"
+	FailureGuardrailWriteViolation       FailureCode = "guardrail_write_violation"
+	FailureRetryExhausted                FailureCode = "retry_exhausted"
+	FailureLoopMaxIterations             FailureCode = "loop_max_iterations"
+	FailureVerificationPlanMissing       FailureCode = "verification_plan_missing"
+	FailureVerificationPlanInvalid       FailureCode = "verification_plan_invalid"
+	FailureVerificationConfigInvalid     FailureCode = "verification_config_invalid"
+	FailureVerificationFileMissing       FailureCode = "verification_file_missing"
+	FailureVerificationNotAllowed        FailureCode = "verification_command_not_allowed"
+	FailureVerificationCommandFailed     FailureCode = "verification_command_failed"
+	FailureVerificationExpectationFailed FailureCode = "verification_expectation_failed"
+	FailureVerificationCoverageFailed    FailureCode = "verification_coverage_failed"
+	FailureDelegateInvalidRequest        FailureCode = "delegate_invalid_request"
+	FailureDelegateFailed                FailureCode = "delegate_failed"
+	FailureDelegateModifiedWorkspace     FailureCode = "delegate_modified_workspace"
+	FailureDelegateMaxRoundsExceeded     FailureCode = "delegate_max_rounds_exceeded"
+	FailureAgentInvalidOutput            FailureCode = "agent_invalid_output"
+	FailureAgentReported                 FailureCode = "agent_reported_failure"
+	FailureTimeout                       FailureCode = "timeout"
+	FailureApprovalRejected              FailureCode = "approval_rejected"
+	FailureExitCriteriaNotMet            FailureCode = "exit_criteria_not_met"
+	FailureExpectedOutputsMissing        FailureCode = "expected_outputs_missing"
+	FailureResourceLimitExceeded         FailureCode = "resource_limit_exceeded"
+	FailureToolContextUpdatesInvalid     FailureCode = "tool_context_updates_invalid"
+	FailureForeachItemsInvalid           FailureCode = "foreach_items_invalid"
+	FailureReadOnlyViolation             FailureCode = "read_only_violation"
+	FailureArtifactMissing               FailureCode = "artifact_missing"
+	FailureReportTemplateError           FailureCode = "report_template_error"
+	FailureHandlerPanic                  FailureCode = "handler_panic"
+	FailureAgentStalled                  FailureCode = "agent_stalled"
+	FailureChangeBudgetExceeded          FailureCode = "change_budget_exceeded"
+	FailureUnknown                       FailureCode = "unknown"
+)
+
+// failureCodeTable maps failure_reason text, as written by this engine, to
+// codes. Rows are tried in order; ClassifyFailure uses it for runs recorded
+// before failure_code existed.
+var failureCodeTable = []struct {
+	Code    FailureCode
+	Pattern *regexp.Regexp
+}{
+	{FailureToolExitNonzero, regexp.MustCompile(`^tool_exit_code_-?\d+$`)},
+	{FailureToolCommandRejected, regexp.MustCompile(`^tool_command rejected by guardrail`)},
+	{FailureRequiredToolFailed, regexp.MustCompile(`^required tool node not successful`)},
+	{FailureRequiredToolNotRun, regexp.MustCompile(`^required tool node never executed`)},
+	{FailureContextContractMissingReads, regexp.MustCompile(`^context contract: missing declared reads`)},
+	{FailureGuardrailWriteViolation, regexp.MustCompile(`^guardrail_violation`)},
+	{FailureRetryExhausted, regexp.MustCompile(`^retry_exhausted$`)},
+	{FailureLoopMaxIterations, regexp.MustCompile(`^loop_max_iterations_exceeded`)},
+	{FailureVerificationPlanMissing, regexp.MustCompile(`^verification plan missing`)},
+	{FailureVerificationConfigInvalid, regexp.MustCompile(`^(verification\.allowed_commands|verification\.workdir|invalid verification\.allowed_commands)`)},
+	{FailureVerificationPlanInvalid, regexp.MustCompile(`^(invalid verification|verification plan must|verification command (cannot be empty|rejected|missing executable))`)},
+	{FailureVerificationFileMissing, regexp.MustCompile(`^required file missing`)},
+	{FailureVerificationNotAllowed, regexp.MustCompile(`^verification command not allowed`)},
+	{FailureVerificationCommandFailed, regexp.MustCompile(`^verification command failed`)},
+	{FailureVerificationExpectationFailed, regexp.MustCompile(`^verification expectation not met`)},
+	{FailureVerificationCoverageFailed, regexp.MustCompile(`^verification coverage`)},
+	{FailureDelegateInvalidRequest, regexp.MustCompile(`^delegate_(invalid_request|not_enabled)`)},
+	{FailureDelegateFailed, regexp.MustCompile(`^delegate_failed`)},
+	{FailureDelegateModifiedWorkspace, regexp.MustCompile(`^delegate_modified_workspace`)},
+	{FailureDelegateMaxRoundsExceeded, regexp.MustCompile(`^delegate_max_rounds_exceeded`)},
+	{FailureAgentInvalidOutput, regexp.MustCompile(`^context_updates mismatch|output is not valid JSON|output violates schema|output missing outcome|^codex output missing`)},
+	{FailureTimeout, regexp.MustCompile(`timeout after \d+s|timed out`)},
+	{FailureApprovalRejected, regexp.MustCompile(`^approval_rejected`)},
+	{FailureExitCriteriaNotMet, regexp.MustCompile(`^exit criteria not met`)},
+	{FailureExpectedOutputsMissing, regexp.MustCompile(`^expected_outputs_missing`)},
+	{FailureResourceLimitExceeded, regexp.MustCompile(`^resource_limit_exceeded`)},
+	{FailureChangeBudgetExceeded, regexp.MustCompile(`^change_budget_exceeded`)},
+	{FailureToolContextUpdatesInvalid, regexp.MustCompile(`^tool_context_updates_invalid`)},
+	{FailureForeachItemsInvalid, regexp.MustCompile(`^foreach_items_invalid`)},
+	{FailureReadOnlyViolation, regexp.MustCompile(`^read_only_violation`)},
+	{FailureArtifactMissing, regexp.MustCompile(`^artifact_missing`)},
+	{FailureReportTemplateError, regexp.MustCompile(`^report_template_error`)},
+	{FailureHandlerPanic, regexp.MustCompile(`^handler_panic`)},
+	{FailureAgentStalled, regexp.MustCompile(`^agent_stalled`)},
+}
+
+// ClassifyFailure derives a FailureCode from failure_reason text. Reasons
+// the engine does not recognize are unknown.
+func ClassifyFailure(reason string) FailureCode {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ""
+	}
+	for _, row := range failureCodeTable {
+		if row.Pattern.MatchString(reason) {
+			return row.Code
+		}
+	}
+	return FailureUnknown
+}
+
+// agentFailureCode classifies a failed agent response: reasons the engine
+// wrote (delegation, schema checks) keep their code, anything else is the
+// agent's own judgement.
+func agentFailureCode(outcome, reason string) FailureCode {
+	if outcome != "fail" {
+		return ""
+	}
+	if code := ClassifyFailure(reason); code != FailureUnknown && code != "" {
+		return code
+	}
+	return FailureAgentReported
+}
@@ -0,0 +1,100 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyFailureMapsEngineReasons(t *testing.T) {
+	cases := map[string]FailureCode{
+		"":                 "",
+		"tool_exit_code_2": FailureToolExitNonzero,
+		"tool_command rejected by guardrail: contains ~":     FailureToolCommandRejected,
+		"guardrail_violation: wrote disallowed files: a.txt": FailureGuardrailWriteViolation,
+		"retry_exhausted":                                                 FailureRetryExhausted,
+		"loop_max_iterations_exceeded: 3":                                 FailureLoopMaxIterations,
+		"verification plan missing in context key: verification.plan":     FailureVerificationPlanMissing,
+		"invalid verification plan: unexpected EOF":                       FailureVerificationPlanInvalid,
+		"invalid verification.allowed_commands entry \"x\": empty":        FailureVerificationConfigInvalid,
+		"verification.workdir must be relative":                           FailureVerificationConfigInvalid,
+		"required file missing: go.mod":                                   FailureVerificationFileMissing,
+		"verification command not allowed: rm -rf .":                      FailureVerificationNotAllowed,
+		"verification command failed: go test ./... (exit=1)":             FailureVerificationCommandFailed,
+		"delegate_not_enabled: set delegate.max_rounds on node a":         FailureDelegateInvalidRequest,
+		"delegate_max_rounds_exceeded: 2":                                 FailureDelegateMaxRoundsExceeded,
+		"context_updates mismatch: coverage: expected number, got string": FailureAgentInvalidOutput,
+		"codex exec timeout after 30s":                                    FailureTimeout,
+		"agent_stalled: no codex output or CPU progress for 15m0s":        FailureAgentStalled,
+		"the agent gave up":                                               FailureUnknown,
+	}
+	for reason, want := range cases {
+		if got := ClassifyFailure(reason); got != want {
+			t.Fatalf("ClassifyFailure(%q) = %q, want %q", reason, got, want)
+		}
+	}
+	if got := agentFailureCode("fail", "the agent gave up"); got != FailureAgentReported {
+		t.Fatalf("agentFailureCode = %q", got)
+	}
+	if got := agentFailureCode("success", ""); got != "" {
+		t.Fatalf("agentFailureCode(success) = %q", got)
+	}
+}
+
+func TestFailureCodePropagatesToStatusEventsAndContext(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="exit 2"];
+	recover [shape=parallelogram, tool_command="true"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit [condition="outcome=success"];
+	t -> recover [condition="outcome=fail"];
+	recover -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "fc1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "fc1")
+	st := readStatusJSON(t, filepath.Join(runDir, "t", "status.json"))
+	if st["failure_reason"] != "tool_exit_code_2" || st["failure_code"] != string(FailureToolExitNonzero) {
+		t.Fatalf("status = %v", st)
+	}
+	if ok := readStatusJSON(t, filepath.Join(runDir, "recover", "status.json")); ok["failure_code"] != nil {
+		t.Fatalf("successful status carries failure_code: %v", ok)
+	}
+	failed := eventsOfType(t, runDir, "StageFailed")
+	if len(failed) != 1 || failed[0]["failure_code"] != string(FailureToolExitNonzero) {
+		t.Fatalf("StageFailed events = %v", failed)
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		t.Fatal(err)
+	}
+	if cp.Context["last_failure.code"] != string(FailureToolExitNonzero) {
+		t.Fatalf("last_failure.code = %v", cp.Context["last_failure.code"])
+	}
+}
+
+func TestFailureCodeForAgentReportedFailure(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, "test.outcome"="fail"];
+	exit [shape=Msquare];
+	start -> a;
+	a -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "fc2"})
+	st := readStatusJSON(t, filepath.Join(runsdir, "fc2", "a", "status.json"))
+	if st["outcome"] != "fail" || st["failure_code"] != string(FailureAgentReported) {
+		t.Fatalf("status = %v", st)
+	}
+}
@@ -0,0 +1,237 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultFailureSummaryMaxBytes = 2200
+	failureSummarySectionLines    = 40
+	failureSummarySectionBytes    = 800
+	failureSummaryFile            = "failure.summary.md"
+)
+
+// failureSummarySection is the tail of one failure artifact. Sections are
+// assembled in priority order: verification stderr, tool stderr, codex
+// stderr, then tool stdout.
+type failureSummarySection struct {
+	Name  string
+	Lines []string
+	Total int
+}
+
+// failureSummaryMaxBytes resolves failure_summary_max_bytes from the failing
+// node, then the graph.
+func failureSummaryMaxBytes(node *Node, g *Graph) int {
+	if raw, ok := node.Attrs["failure_summary_max_bytes"]; ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(fmt.Sprintf("%v", raw))); err == nil && n > 0 {
+			return n
+		}
+	}
+	if g != nil {
+		if n := graphIntAttr(g, "failure_summary_max_bytes", defaultFailureSummaryMaxBytes); n > 0 {
+			return n
+		}
+	}
+	return defaultFailureSummaryMaxBytes
+}
+
+func validateFailureSummaryBudget(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	check := func(owner string, attrs map[string]Value) {
+		raw, ok := attrs["failure_summary_max_bytes"]
+		if !ok {
+			return
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(fmt.Sprintf("%v", raw))); err != nil || n <= 0 {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("%s has invalid failure_summary_max_bytes: %v (expected a positive integer)", owner, raw)})
+		}
+	}
+	check("graph", g.Attrs)
+	for _, id := range sortedKeys(g.Nodes) {
+		check("node "+id, g.Nodes[id].Attrs)
+	}
+	return d
+}
+
+// buildFailureSummary assembles the failure feedback a fix prompt is given:
+// key=value header lines, then one fenced section per artifact tail. Each
+// section keeps its last lines within a per-section cap. Sections that do not
+// fit maxBytes are dropped lowest priority first; the last remaining section
+// loses leading lines before it is dropped too.
+func buildFailureSummary(node *Node, nodeDir string, out Outcome, maxBytes int) string {
+	if maxBytes <= 0 {
+		maxBytes = defaultFailureSummaryMaxBytes
+	}
+	header := []string{
+		fmt.Sprintf("failed_node=%s", node.ID),
+		fmt.Sprintf("failed_node_type=%s", node.Type()),
+	}
+	if strings.TrimSpace(out.FailureReason) != "" {
+		header = append(header, fmt.Sprintf("failure_reason=%s", out.FailureReason))
+	}
+	if code, ok := readTailSnippet(filepath.Join(nodeDir, "tool.exitcode.txt"), 64); ok {
+		header = append(header, fmt.Sprintf("tool_exit_code=%s", strings.TrimSpace(code)))
+	}
+	sections := []failureSummarySection{}
+	if s, ok := verificationFailureSection(nodeDir); ok {
+		sections = append(sections, s)
+	}
+	for _, src := range []struct{ name, file string }{
+		{"tool_stderr", "tool.stderr.txt"},
+		{"codex_stderr", "codex.stderr.log"},
+		{"tool_stdout", "tool.stdout.txt"},
+	} {
+		if s, ok := fileFailureSection(src.name, filepath.Join(nodeDir, src.file)); ok {
+			sections = append(sections, s)
+		}
+	}
+	return assembleFailureSummary(header, sections, maxBytes)
+}
+
+func assembleFailureSummary(header []string, sections []failureSummarySection, maxBytes int) string {
+	included := append([]failureSummarySection{}, sections...)
+	omitted := []string{}
+	render := func() string {
+		head := header
+		if len(omitted) > 0 {
+			head = append(append([]string{}, header...), "omitted_sections="+strings.Join(omitted, ","))
+		}
+		parts := []string{strings.Join(head, "\n")}
+		for _, s := range included {
+			parts = append(parts, s.render())
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	summary := render()
+	for len(summary) > maxBytes && len(included) > 1 {
+		omitted = append([]string{included[len(included)-1].Name}, omitted...)
+		included = included[:len(included)-1]
+		summary = render()
+	}
+	for len(summary) > maxBytes && len(included) == 1 && len(included[0].Lines) > 1 {
+		included[0].Lines = included[0].Lines[1:]
+		summary = render()
+	}
+	if len(summary) > maxBytes && len(included) == 1 {
+		omitted = append([]string{included[0].Name}, omitted...)
+		included = nil
+		summary = render()
+	}
+	return summary
+}
+
+// render fences the section with a backtick run longer than any in its text.
+func (s failureSummarySection) render() string {
+	body := strings.Join(s.Lines, "\n")
+	fence := "```"
+	for strings.Contains(body, fence) {
+		fence += "`"
+	}
+	title := "### " + s.Name
+	if s.Total > len(s.Lines) {
+		title += fmt.Sprintf(" (last %d of %d lines)", len(s.Lines), s.Total)
+	}
+	return title + "\n" + fence + "\n" + body + "\n" + fence
+}
+
+// tailSection keeps the last lines of text within the per-section line and
+// byte caps. A single line longer than the byte cap keeps its last bytes.
+func tailSection(name, text string) (failureSummarySection, bool) {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n \t")
+	text = strings.TrimLeft(text, "\n")
+	if strings.TrimSpace(text) == "" {
+		return failureSummarySection{}, false
+	}
+	lines := strings.Split(text, "\n")
+	s := failureSummarySection{Name: name, Total: len(lines)}
+	if len(lines) > failureSummarySectionLines {
+		lines = lines[len(lines)-failureSummarySectionLines:]
+	}
+	size := len(strings.Join(lines, "\n"))
+	for len(lines) > 1 && size > failureSummarySectionBytes {
+		size -= len(lines[0]) + 1
+		lines = lines[1:]
+	}
+	if len(lines) == 1 && len(lines[0]) > failureSummarySectionBytes {
+		lines[0] = lines[0][len(lines[0])-failureSummarySectionBytes:]
+	}
+	s.Lines = lines
+	return s, true
+}
+
+func fileFailureSection(name, path string) (failureSummarySection, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return failureSummarySection{}, false
+	}
+	return tailSection(name, string(b))
+}
+
+// verificationFailureSection collects stderr of the failing verification
+// commands, falling back to stdout for commands that wrote no stderr.
+func verificationFailureSection(nodeDir string) (failureSummarySection, bool) {
+	b, err := os.ReadFile(filepath.Join(nodeDir, "verification.results.json"))
+	if err != nil {
+		return failureSummarySection{}, false
+	}
+	var res verificationResults
+	if err := json.Unmarshal(b, &res); err != nil {
+		return failureSummarySection{}, false
+	}
+	var text strings.Builder
+	for _, c := range res.Commands {
+		if c.ExitCode == 0 && len(unmetExpectations(c.Expectations)) == 0 {
+			continue
+		}
+		output := c.Stderr
+		if strings.TrimSpace(output) == "" {
+			output = c.Stdout
+		}
+		fmt.Fprintf(&text, "$ %s (exit %d)\n%s\n", c.Command, c.ExitCode, strings.TrimRight(output, "\n"))
+	}
+	return tailSection("verification_stderr", text.String())
+}
+
+// writeFailureSummary records the summary given to the fix agent next to the
+// failing node's other artifacts.
+func writeFailureSummary(nodeDir, summary string) error {
+	return os.WriteFile(filepath.Join(nodeDir, failureSummaryFile), []byte(summary+"\n"), 0o644)
+}
+
+// readNodeFailureFeedback rebuilds the failure summary of nodeID's latest
+// status in runDir, for prompt.failure_source_node. It fails when the node
+// has no status or its latest one is not a failure.
+func readNodeFailureFeedback(g *Graph, runDir, nodeID string) (reason, summary string, err error) {
+	node := g.Nodes[nodeID]
+	if node == nil {
+		return "", "", fmt.Errorf("unknown node %s", nodeID)
+	}
+	nodeDir := nodeArtifactDir(runDir, nodeID)
+	status, ok := failureArtifacts(nodeDir)["status"]
+	if !ok {
+		return "", "", fmt.Errorf("node %s has no status.json", nodeID)
+	}
+	b, err := os.ReadFile(status)
+	if err != nil {
+		return "", "", err
+	}
+	var out Outcome
+	if err := json.Unmarshal(b, &out); err != nil {
+		return "", "", fmt.Errorf("node %s status.json: %w", nodeID, err)
+	}
+	if out.Outcome != "fail" {
+		return "", "", fmt.Errorf("node %s last finished with outcome %s, not fail", nodeID, out.Outcome)
+	}
+	// A node that has started again since has moved that attempt's
+	// artifacts aside.
+	if dir := attemptArchiveFor(nodeDir, out.AttemptID); dir != "" {
+		nodeDir = dir
+	}
+	return out.FailureReason, buildFailureSummary(node, nodeDir, out, failureSummaryMaxBytes(node, g)), nil
+}
@@ -0,0 +1,119 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFailureSummaryKeepsLastLinesPerSection(t *testing.T) {
+	nodeDir := t.TempDir()
+	lines := []string{}
+	for i := 1; i <= 200; i++ {
+		lines = append(lines, "stderr line "+strconv.Itoa(i))
+	}
+	writeFile(t, filepath.Join(nodeDir, "tool.stderr.txt"), strings.Join(lines, "\n")+"\n")
+	writeFile(t, filepath.Join(nodeDir, "tool.stdout.txt"), "```\nstdout tail\n")
+	node := &Node{ID: "check", Attrs: map[string]Value{"shape": "parallelogram"}}
+	got := buildFailureSummary(node, nodeDir, Outcome{FailureReason: "tool_exit_code_1"}, 4000)
+	for _, want := range []string{
+		"failed_node=check\n",
+		"failure_reason=tool_exit_code_1\n",
+		"### tool_stderr (last 40 of 200 lines)\n```\nstderr line 161\n",
+		"stderr line 200\n```",
+		"### tool_stdout\n````\n```\nstdout tail\n````",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("summary missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "stderr line 160\n") {
+		t.Fatalf("section not capped to its last lines:\n%s", got)
+	}
+}
+
+func TestFailureSummaryDropsLowPrioritySectionsToFitBudget(t *testing.T) {
+	nodeDir := t.TempDir()
+	writeJSON(filepath.Join(nodeDir, "verification.results.json"), verificationResults{Commands: []verificationCommandResult{
+		{Command: "go vet ./...", ExitCode: 0, Stderr: "ignored passing output"},
+		{Command: "go test ./...", ExitCode: 1, Stderr: "--- FAIL: TestParse\nparse_test.go:12: want 2, got 3\n"},
+	}})
+	writeFile(t, filepath.Join(nodeDir, "tool.stderr.txt"), strings.Repeat("tool noise\n", 5))
+	writeFile(t, filepath.Join(nodeDir, "codex.stderr.log"), strings.Repeat("codex noise\n", 30))
+	node := &Node{ID: "verify", Attrs: map[string]Value{"type": "verification"}}
+	got := buildFailureSummary(node, nodeDir, Outcome{FailureReason: "verification command failed"}, 500)
+	if len(got) > 500 {
+		t.Fatalf("summary is %d bytes, budget 500:\n%s", len(got), got)
+	}
+	for _, want := range []string{"### verification_stderr\n", "$ go test ./... (exit 1)", "parse_test.go:12: want 2, got 3", "omitted_sections=codex_stderr"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("summary missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "codex noise") || strings.Contains(got, "ignored passing output") {
+		t.Fatalf("summary kept low-priority output:\n%s", got)
+	}
+	if v, tl := strings.Index(got, "### verification_stderr"), strings.Index(got, "### tool_stderr"); tl < 0 || v > tl {
+		t.Fatalf("sections out of priority order:\n%s", got)
+	}
+
+	tight := buildFailureSummary(node, nodeDir, Outcome{FailureReason: "verification command failed"}, 260)
+	if len(tight) > 260 || !strings.Contains(tight, "parse_test.go:12") || !strings.Contains(tight, "omitted_sections=tool_stderr,codex_stderr") {
+		t.Fatalf("tight summary (%d bytes):\n%s", len(tight), tight)
+	}
+}
+
+func TestFailureSummaryWrittenToNodeDir(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	graph [failure_summary_max_bytes=300];
+	start [shape=Mdiamond];
+	validate [shape=parallelogram, type=tool, tool_command="sh -c 'i=0; while [ $i -lt 100 ]; do echo noise $i; i=$((i+1)); done; echo FAIL_DETAIL 1>&2; exit 1'"];
+	fix [shape=box, prompt="Fix based on feedback"];
+	exit [shape=Msquare];
+	start -> validate;
+	validate -> fix [condition="outcome=fail"];
+	fix -> exit [condition="outcome=success"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "fs1"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(runsdir, "fs1", "validate", failureSummaryFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := readCheckpoint(filepath.Join(runsdir, "fs1", "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, _ := cp.Context["last_failure.summary"].(string)
+	if strings.TrimSpace(string(b)) != summary || len(summary) > 300 || !strings.Contains(summary, "FAIL_DETAIL") {
+		t.Fatalf("failure.summary.md = %q, context summary = %q", b, summary)
+	}
+	artifacts, _ := cp.Context["last_failure.artifacts"].(map[string]any)
+	if artifacts["failure_summary"] == nil {
+		t.Fatalf("artifacts = %v", artifacts)
+	}
+}
+
+func TestValidateFailureSummaryBudget(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	graph [failure_summary_max_bytes=0];
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="true", failure_summary_max_bytes="lots"];
+	exit [shape=Msquare];
+	start -> a -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{"graph has invalid failure_summary_max_bytes: 0", "node a has invalid failure_summary_max_bytes: lots"} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// commandSeparatorRe splits a shell command line into the commands whose
+	// first words are checked.
+	commandSeparatorRe = regexp.MustCompile(`&&|\|\||[;|\n]`)
+	envAssignmentRe    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+	// scriptInterpreters run the script named by their first non-flag
+	// argument, which then does not need to be executable.
+	scriptInterpreters = map[string]bool{"sh": true, "bash": true, "zsh": true, "python": true, "python3": true, "node": true, "perl": true, "ruby": true}
+)
+
+// ValidateGraphWithWorkdir runs ValidateGraph and then checks the files and
+// directories the pipeline names against workdir: scripts started by
+// tool_command and verification.allowed_commands, verification.workdir, and
+// codex.workdir. ValidateGraph itself never touches the filesystem.
+func ValidateGraphWithWorkdir(g *Graph, workdir string) []Diagnostic {
+	d := ValidateGraph(g)
+	if g == nil {
+		return d
+	}
+	return append(d, validateFileRefs(g, workdir)...)
+}
+
+// checkFilesEnabled reports whether a run checks file references (graph attr
+// check_files=true or RunConfig.CheckFiles).
+func checkFilesEnabled(g *Graph, cfg RunConfig) bool {
+	if cfg.CheckFiles {
+		return true
+	}
+	v, ok := g.Attrs["check_files"]
+	return ok && strings.EqualFold(strings.TrimSpace(fmt.Sprintf("%v", v)), "true")
+}
+
+func validateFileRefs(g *Graph, workdir string) []Diagnostic {
+	d := []Diagnostic{}
+	for _, id := range sortedKeys(g.Nodes) {
+		n := g.Nodes[id]
+		attr := func(key string) string {
+			v, ok := resolveAttr(n, g, key)
+			if !ok {
+				return ""
+			}
+			return strings.TrimSpace(fmt.Sprintf("%v", v))
+		}
+		for _, key := range []string{"verification.workdir", "codex.workdir"} {
+			if p := attr(key); p != "" && !strings.Contains(p, "$") {
+				if info, err := os.Stat(filepath.Join(workdir, filepath.FromSlash(p))); err != nil || !info.IsDir() {
+					d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s %s references missing directory: %s", id, key, p)})
+				}
+			}
+		}
+		if cmd := attr("tool_command"); cmd != "" && handlerType(n) == "tool" {
+			d = append(d, checkCommandScripts(id, "tool_command", workdir, "", cmd)...)
+		}
+		if handlerType(n) == "verification" {
+			for _, entry := range splitCSV(attr("verification.allowed_commands")) {
+				d = append(d, checkCommandScripts(id, "verification.allowed_commands", workdir, attr("verification.workdir"), entry)...)
+			}
+		}
+	}
+	return d
+}
+
+// checkCommandScripts reports scripts that each command in line would start
+// but that are missing from workdir (ERROR), or that are started directly
+// but not executable (WARN). Only relative paths with an extension are
+// checked, so commands on PATH such as go or make are left alone.
+func checkCommandScripts(nodeID, attr, workdir, dir, line string) []Diagnostic {
+	d := []Diagnostic{}
+	seen := map[string]bool{}
+	for _, command := range commandSeparatorRe.Split(line, -1) {
+		script, direct := commandScript(command)
+		if script == "" || seen[script] {
+			continue
+		}
+		seen[script] = true
+		rel := path.Join(filepath.ToSlash(dir), script)
+		info, err := os.Stat(filepath.Join(workdir, filepath.FromSlash(rel)))
+		switch {
+		case err != nil || info.IsDir():
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s %s references missing file: %s", nodeID, attr, rel)})
+		case direct && info.Mode().Perm()&0o111 == 0:
+			d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s %s runs %s, which is not executable", nodeID, attr, rel)})
+		}
+	}
+	return d
+}
+
+// commandScript returns the script a single command starts, skipping leading
+// VAR=value assignments and looking through a script interpreter. direct is
+// true when the script itself is the command.
+func commandScript(command string) (script string, direct bool) {
+	fields, err := splitCommandTokens(strings.TrimSpace(command))
+	if err != nil {
+		return "", false
+	}
+	for len(fields) > 0 && envAssignmentRe.MatchString(fields[0]) {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return "", false
+	}
+	candidate, direct := fields[0], true
+	if scriptInterpreters[path.Base(candidate)] {
+		candidate, direct = "", false
+		for _, f := range fields[1:] {
+			if f == "-c" || f == "-m" {
+				// Inline code or a module, not a script file.
+				break
+			}
+			if !strings.HasPrefix(f, "-") {
+				candidate = f
+				break
+			}
+		}
+	}
+	if candidate == "" || strings.ContainsAny(candidate, "$<>*?`") || path.IsAbs(candidate) || path.Ext(candidate) == "" {
+		return "", false
+	}
+	return path.Clean(candidate), direct
+}
@@ -0,0 +1,50 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateGraphWithWorkdirChecksFileRefs(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="FOO=1 bash scripts/gone.sh && ./scripts/plain.sh && scripts/ok.sh; python3 -m foo.bar; go test ./..."];
+	v [type=verification, "verification.workdir"="checks", "verification.allowed_commands"="sh run.sh,go test"];
+	c [shape=box, "codex.workdir"="nope"];
+	exit [shape=Msquare];
+	start -> t -> v -> c -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "scripts", "plain.sh"), "echo hi\n")
+	writeExecutable(t, filepath.Join(workdir, "scripts", "ok.sh"), "#!/bin/sh\n")
+	if err := os.MkdirAll(filepath.Join(workdir, "checks"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	g, err := ParseDOT(dot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := diagnosticMessages(ValidateGraph(g)); strings.Contains(msgs, "scripts/") {
+		t.Fatalf("ValidateGraph checked files: %s", msgs)
+	}
+	got := []string{}
+	for _, d := range ValidateGraphWithWorkdir(g, workdir) {
+		got = append(got, d.Level+" "+d.Message)
+	}
+	want := []string{
+		"ERROR node c codex.workdir references missing directory: nope",
+		"ERROR node t tool_command references missing file: scripts/gone.sh",
+		"WARN node t tool_command runs scripts/plain.sh, which is not executable",
+		"ERROR node v verification.allowed_commands references missing file: checks/run.sh",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("diagnostics:\n%s", strings.Join(got, "\n"))
+	}
+
+	err = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1", CheckFiles: true})
+	if err == nil || !strings.Contains(err.Error(), "scripts/gone.sh") {
+		t.Fatalf("run err = %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const foreachResultsFile = "foreach.results.json"
+
+// ForeachProgress is the checkpointed state of an in-flight foreach node.
+// Items are fixed when the node starts, so a resume iterates the same list.
+type ForeachProgress struct {
+	NodeID  string              `json:"node_id"`
+	Items   []string            `json:"items"`
+	Next    int                 `json:"next"`
+	Results []ForeachItemResult `json:"results"`
+}
+
+// ForeachItemResult is one iteration's outcome in foreach.results.json.
+type ForeachItemResult struct {
+	Index         int         `json:"index"`
+	Item          string      `json:"item"`
+	Outcome       string      `json:"outcome"`
+	FailureReason string      `json:"failure_reason,omitempty"`
+	FailureCode   FailureCode `json:"failure_code,omitempty"`
+}
+
+func foreachContextKey(n *Node) string {
+	return strings.TrimSpace(n.StringAttr("foreach_context_key", ""))
+}
+
+func validateForeach(n *Node) []Diagnostic {
+	if _, ok := n.Attrs["foreach_context_key"]; !ok {
+		return nil
+	}
+	if typ := handlerType(n); (typ != "codergen" && typ != "tool") || isManagerLoopNode(n) {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets foreach_context_key but is not a codergen or tool node", n.ID)}}
+	}
+	if foreachContextKey(n) == "" {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s has an empty foreach_context_key", n.ID)}}
+	}
+	if !strings.Contains(n.StringAttr("prompt", "")+n.StringAttr("tool_command", ""), "${item}") {
+		return []Diagnostic{{Level: "WARN", Message: fmt.Sprintf("node %s sets foreach_context_key but its prompt and tool_command do not use ${item}", n.ID)}}
+	}
+	return nil
+}
+
+// foreachItems reads the worklist at key: a JSON array, or a string holding
+// one. Non-string items are passed on as JSON.
+func foreachItems(ctx Context, key string) ([]string, error) {
+	raw, ok := ctx.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("context key %s is not set", key)
+	}
+	if s, isString := raw.(string); isString {
+		var decoded []any
+		if err := json.Unmarshal([]byte(s), &decoded); err != nil {
+			return nil, fmt.Errorf("context key %s is not a list", key)
+		}
+		raw = decoded
+	}
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("context key %s is not a list", key)
+	}
+	items := make([]string, 0, len(list))
+	for _, v := range list {
+		if s, isString := v.(string); isString {
+			items = append(items, s)
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("context key %s: %w", key, err)
+		}
+		items = append(items, string(b))
+	}
+	return items, nil
+}
+
+// foreachItemNode is node as run for one item: ${item} and ${item_index}
+// replaced in prompt and tool_command, and foreach_context_key dropped.
+func foreachItemNode(node *Node, index int, item string) *Node {
+	attrs := make(map[string]Value, len(node.Attrs))
+	for k, v := range node.Attrs {
+		attrs[k] = v
+	}
+	delete(attrs, "foreach_context_key")
+	for _, k := range []string{"prompt", "tool_command"} {
+		if s, ok := attrs[k].(string); ok {
+			s = strings.ReplaceAll(s, "${item_index}", fmt.Sprintf("%d", index))
+			attrs[k] = strings.ReplaceAll(s, "${item}", item)
+		}
+	}
+	return &Node{ID: node.ID, Attrs: attrs}
+}
+
+// executeForeach runs node once per item of its foreach_context_key list,
+// each with its own snapshot, diff, guardrails, and retries, and artifacts in
+// nodeDir/item-<i>/. Progress is checkpointed after every item. Every item
+// runs; the node fails when any item failed, naming the first.
+func (e *Engine) executeForeach(node *Node, nodeDir string) (Outcome, error) {
+	key := foreachContextKey(node)
+	if e.foreach == nil || e.foreach.NodeID != node.ID {
+		items, err := foreachItems(e.Context, key)
+		if err != nil {
+			return Outcome{SchemaVersion: 1, Outcome: "fail", FailureReason: "foreach_items_invalid: " + err.Error(), FailureCode: FailureForeachItemsInvalid, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}, nil
+		}
+		e.foreach = &ForeachProgress{NodeID: node.ID, Items: items, Results: []ForeachItemResult{}}
+	}
+	progress := e.foreach
+	updates := map[string]any{}
+	for i := progress.Next; i < len(progress.Items); i++ {
+		item := progress.Items[i]
+		itemNode := foreachItemNode(node, i, item)
+		itemDir := filepath.Join(nodeDir, fmt.Sprintf("item-%d", i))
+		if err := os.MkdirAll(itemDir, 0o755); err != nil {
+			return Outcome{}, err
+		}
+		e.recordEvent(map[string]any{"schema_version": 1, "type": "ForeachItemStarted", "node_id": node.ID, "index": i, "item": item, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+		e.Logger.Info("foreach item started", "node", node.ID, "index", i, "items", len(progress.Items))
+		prompt, err := e.preparePrompt(itemNode)
+		if err != nil {
+			return Outcome{}, err
+		}
+		outer := e.prompt
+		e.prompt = prompt
+		out, err := e.executeNode(itemNode, itemDir)
+		e.prompt = outer
+		if err != nil {
+			return Outcome{}, err
+		}
+		if out.Outcome == "fail" && out.FailureCode == "" {
+			out.FailureCode = ClassifyFailure(out.FailureReason)
+		}
+		if err := writeJSON(filepath.Join(itemDir, "status.json"), out); err != nil {
+			return Outcome{}, err
+		}
+		for k, v := range out.ContextUpdates {
+			updates[k] = v
+			if err := e.Context.Set(k, v); err != nil {
+				e.Logger.Warn("ignored context update", "node", node.ID, "error", err)
+			}
+		}
+		result := ForeachItemResult{Index: i, Item: item, Outcome: out.Outcome, FailureReason: out.FailureReason, FailureCode: out.FailureCode}
+		progress.Results = append(progress.Results, result)
+		progress.Next = i + 1
+		e.recordEvent(map[string]any{"schema_version": 1, "type": "ForeachItemCompleted", "node_id": node.ID, "index": i, "item": item, "outcome": out.Outcome, "failure_reason": out.FailureReason, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+		if err := writeJSON(filepath.Join(nodeDir, foreachResultsFile), progress.Results); err != nil {
+			return Outcome{}, err
+		}
+		if err := e.writeCheckpoint(e.lastCompleted); err != nil {
+			return Outcome{}, err
+		}
+	}
+	e.foreach = nil
+	return foreachOutcome(progress, updates), nil
+}
+
+// foreachOutcome aggregates item outcomes: any fail fails the node, else any
+// partial_success makes it partial, else it succeeds.
+func foreachOutcome(p *ForeachProgress, updates map[string]any) Outcome {
+	out := Outcome{SchemaVersion: 1, Outcome: "success", SuggestedNextIDs: []string{}, ContextUpdates: updates}
+	failed := []string{}
+	for _, r := range p.Results {
+		switch r.Outcome {
+		case "fail":
+			if len(failed) == 0 {
+				out.FailureReason = fmt.Sprintf("foreach item %d (%s) failed: %s", r.Index, r.Item, r.FailureReason)
+				out.FailureCode = r.FailureCode
+			}
+			failed = append(failed, fmt.Sprintf("%d", r.Index))
+		case "partial_success":
+			if out.Outcome == "success" {
+				out.Outcome = "partial_success"
+			}
+		}
+	}
+	if len(failed) > 0 {
+		out.Outcome = "fail"
+		out.Notes = fmt.Sprintf("foreach: %d of %d items failed (%s)", len(failed), len(p.Results), strings.Join(failed, ","))
+	} else {
+		out.Notes = fmt.Sprintf("foreach: %d items", len(p.Results))
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const foreachDOT = `digraph G {
+	start [shape=Mdiamond];
+	plan [shape=box, "test.context_updates_json"="{\"plan.components\":[\"api\",\"web\",\"db\"]}"];
+	build [shape=parallelogram, foreach_context_key="plan.components", allowed_write_paths="ran.txt", tool_command="echo ${item_index}:${item} >> ran.txt; test ${item} != web"];
+	exit [shape=Msquare];
+	start -> plan -> build;
+	build -> exit [condition="outcome=success"];
+	build -> exit [condition="outcome=fail"];
+	}`
+
+func TestForeachRunsNodeOncePerItem(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, foreachDOT)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "fe1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "fe1")
+	b, err := os.ReadFile(filepath.Join(runDir, "workspace", "ran.txt"))
+	if err != nil || string(b) != "0:api\n1:web\n2:db\n" {
+		t.Fatalf("ran.txt = %q (%v)", b, err)
+	}
+	st := readStatusJSON(t, filepath.Join(runDir, "build", "status.json"))
+	if st["outcome"] != "fail" || st["failure_reason"] != "foreach item 1 (web) failed: tool_exit_code_1" || st["failure_code"] != string(FailureToolExitNonzero) {
+		t.Fatalf("status = %v", st)
+	}
+	for i, want := range []string{"success", "fail", "success"} {
+		itemDir := filepath.Join(runDir, "build", "item-"+string(rune('0'+i)))
+		if got := readStatusJSON(t, filepath.Join(itemDir, "status.json"))["outcome"]; got != want {
+			t.Fatalf("item %d outcome = %v, want %s", i, got, want)
+		}
+		for _, name := range []string{"workspace.diff.json", "tool.exitcode.txt"} {
+			if _, err := os.Stat(filepath.Join(itemDir, name)); err != nil {
+				t.Fatalf("item %d: %v", i, err)
+			}
+		}
+	}
+	if evs := eventsOfType(t, runDir, "ForeachItemCompleted"); len(evs) != 3 || evs[1]["item"] != "web" || evs[1]["outcome"] != "fail" {
+		t.Fatalf("ForeachItemCompleted events = %v", evs)
+	}
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil || cp.Foreach != nil {
+		t.Fatalf("checkpoint still carries foreach progress: %+v (%v)", cp.Foreach, err)
+	}
+}
+
+func TestForeachResumesMidList(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, foreachDOT)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "fe2"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "fe2")
+	// Rewind the checkpoint to just after item 1, as a crash there leaves it.
+	cpPath := filepath.Join(runDir, "checkpoint.json")
+	cp, err := readCheckpoint(cpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp.LastCompletedNode = "plan"
+	cp.CompletedNodes = []string{"plan", "start"}
+	cp.Foreach = &ForeachProgress{NodeID: "build", Items: []string{"api", "web", "db"}, Next: 2, Results: []ForeachItemResult{
+		{Index: 0, Item: "api", Outcome: "success"},
+		{Index: 1, Item: "web", Outcome: "fail", FailureReason: "tool_exit_code_1", FailureCode: FailureToolExitNonzero},
+	}}
+	if err := writeJSON(cpPath, cp); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSONAtomic(filepath.Join(runDir, runStateFile), RunState{State: RunStateFailed}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "fe2", Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, "workspace", "ran.txt"))
+	if err != nil || string(b) != "0:api\n1:web\n2:db\n2:db\n" {
+		t.Fatalf("ran.txt after resume = %q (%v)", b, err)
+	}
+	st := readStatusJSON(t, filepath.Join(runDir, "build", "status.json"))
+	if st["outcome"] != "fail" || !strings.HasPrefix(st["failure_reason"].(string), "foreach item 1 (web) failed") {
+		t.Fatalf("status after resume = %v", st)
+	}
+}
+
+func TestForeachMissingListFailsNode(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := strings.Replace(foreachDOT, `"test.context_updates_json"="{\"plan.components\":[\"api\",\"web\",\"db\"]}"`, `"test.context_updates_json"="{\"plan.components\":\"api\"}"`, 1)
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "fe3"}); err != nil {
+		t.Fatal(err)
+	}
+	st := readStatusJSON(t, filepath.Join(runsdir, "fe3", "build", "status.json"))
+	if st["failure_code"] != string(FailureForeachItemsInvalid) || st["failure_reason"] != "foreach_items_invalid: context key plan.components is not a list" {
+		t.Fatalf("status = %v", st)
+	}
+}
+
+func TestForeachItemsInterpolateIntoPrompt(t *testing.T) {
+	ctx := Context{"list": `["a", {"n": 1}]`}
+	items, err := foreachItems(ctx, "list")
+	if err != nil || strings.Join(items, "|") != `a|{"n":1}` {
+		t.Fatalf("items = %v (%v)", items, err)
+	}
+	n := foreachItemNode(&Node{ID: "b", Attrs: map[string]Value{"prompt": "build ${item} (#${item_index})", "foreach_context_key": "list"}}, 1, items[1])
+	if got := n.StringAttr("prompt", ""); got != `build {"n":1} (#1)` || n.Attrs["foreach_context_key"] != nil {
+		t.Fatalf("item node = %v", n.Attrs)
+	}
+}
+
+func TestValidateForeach(t *testing.T) {
+	cases := map[string]string{
+		`t [type=verification, foreach_context_key="list"]`:             "is not a codergen or tool node",
+		`t [shape=box, foreach_context_key=""]`:                         "empty foreach_context_key",
+		`t [shape=box, foreach_context_key="list", prompt="build all"]`: "do not use ${item}",
+	}
+	for node, want := range cases {
+		g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; ` + node + `; exit [shape=Msquare]; start -> t -> exit; }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, want) {
+			t.Fatalf("%s: diagnostics %q missing %q", node, msgs, want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package attractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxPathComponentBytes = 255
+	maxPathBytes          = 4096
+	// artifactPathReserve leaves room for files written inside a node dir.
+	artifactPathReserve  = 256
+	defaultMinFreeInodes = 1024
+	shortenedNameHashHex = 12
+)
+
+type filesystemStats struct {
+	FreeBytes   uint64
+	TotalInodes uint64
+	FreeInodes  uint64
+}
+
+// statFilesystem is swapped in tests to inject filesystem stats.
+var statFilesystem = platformStatFilesystem
+
+func minFreeInodes(g *Graph) uint64 {
+	if raw, ok := g.Attrs["min_free_inodes"]; ok {
+		if n, err := strconv.ParseUint(strings.TrimSpace(fmt.Sprintf("%v", raw)), 10, 64); err == nil {
+			return n
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("ATTRACTOR_MIN_FREE_INODES")); raw != "" {
+		if n, err := strconv.ParseUint(raw, 10, 64); err == nil {
+			return n
+		}
+	}
+	return defaultMinFreeInodes
+}
+
+// checkFreeInodes fails when the filesystem holding path has fewer than min
+// free inodes. Filesystems that do not report inode counts are skipped.
+func checkFreeInodes(path string, min uint64) error {
+	if min == 0 {
+		return nil
+	}
+	st, ok, err := statFilesystem(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat filesystem for %s: %w", path, err)
+	}
+	if !ok || st.TotalInodes == 0 {
+		return nil
+	}
+	if st.FreeInodes < min {
+		return fmt.Errorf("insufficient free inodes on %s: %d available, %d required (min_free_inodes)", path, st.FreeInodes, min)
+	}
+	return nil
+}
+
+// nodeArtifactDir returns the per-node artifact directory for id under runDir.
+func nodeArtifactDir(runDir, id string) string {
+	return filepath.Join(runDir, nodeArtifactDirName(runDir, id))
+}
+
+// nodeArtifactDirName returns the sanitized id unless it would exceed the
+// filename limit or push artifact paths past the path limit, in which case it
+// is shortened to a deterministic prefix plus hash suffix.
+func nodeArtifactDirName(runDir, id string) string {
+	budget := maxPathComponentBytes
+	if remaining := maxPathBytes - artifactPathReserve - len(runDir) - 1; remaining < budget {
+		budget = remaining
+	}
+	return shortenName(sanitizeNodeDirName(id), budget)
+}
+
+// sanitizeNodeDirName maps a node ID to a portable directory name: characters
+// outside [A-Za-z0-9._-] become '_', and "." / ".." are escaped. Distinct IDs
+// can sanitize identically; validateNodeDirNames rejects such graphs.
+func sanitizeNodeDirName(id string) string {
+	var b strings.Builder
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := b.String()
+	if name == "." || name == ".." {
+		name = strings.Repeat("_", len(name))
+	}
+	return name
+}
+
+// reservedRunEntries are run-directory entries a node artifact dir must not
+// shadow. Names come from the constants their writers use, so a new
+// run-level file is reserved by adding its constant here.
+var reservedRunEntries = map[string]bool{
+	"workspace":         true,
+	"manifest.json":     true,
+	"pipeline.dot":      true,
+	"checkpoint.json":   true,
+	runEnvironmentFile:  true,
+	eventsFile:          true,
+	traceFile:           true,
+	traceIndexFile:      true,
+	runLogFile:          true,
+	runStateFile:        true,
+	runLockFile:         true,
+	runResultFile:       true,
+	artifactsIndexFile:  true,
+	runChangelogFile:    true,
+	approvalsLedgerFile: true,
+	junitReportFile:     true,
+	sarifReportFile:     true,
+	blobStoreDir:        true,
+	hermeticHomeDir:     true,
+	deliverablesDirName: true,
+}
+
+// isReservedRunEntry reports whether a node dir named name would clash with
+// a run-level entry: a reserved name or the .tmp file of an atomic write to
+// one, a rotated trace segment, or a git source scratch clone.
+func isReservedRunEntry(name string) bool {
+	if reservedRunEntries[strings.TrimSuffix(name, ".tmp")] || strings.HasPrefix(name, gitSourceDirPrefix) {
+		return true
+	}
+	seg, ok := strings.CutPrefix(name, "trace.")
+	if !ok {
+		return false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(seg, ".jsonl"))
+	return err == nil && traceSegmentName(n) == name
+}
+
+// validateNodeDirNames reports node IDs whose artifact directories would
+// collide with each other or with run-level artifacts.
+func validateNodeDirNames(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	seen := map[string]string{}
+	for _, id := range ids {
+		name := sanitizeNodeDirName(id)
+		if isReservedRunEntry(name) {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node id %q collides with run artifact %s", id, name)})
+			continue
+		}
+		if other, ok := seen[name]; ok {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node ids %q and %q map to the same artifact directory %q", other, id, name)})
+			continue
+		}
+		seen[name] = id
+	}
+	return d
+}
+
+// shortenName cuts name to at most budget bytes, keeping a prefix that ends
+// on a rune boundary and adding a hash of the full name.
+func shortenName(name string, budget int) string {
+	if len(name) <= budget {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(sum[:])[:shortenedNameHashHex]
+	keep := budget - len(suffix) - 1
+	for keep > 0 && !utf8.RuneStart(name[keep]) {
+		keep--
+	}
+	if keep <= 0 {
+		return suffix
+	}
+	return name[:keep] + "-" + suffix
+}
+
+// shortenedNodeArtifactDirs reports node IDs whose artifact directory name
+// differs from the ID.
+func shortenedNodeArtifactDirs(g *Graph, runDir string) map[string]string {
+	out := map[string]string{}
+	for id := range g.Nodes {
+		if name := nodeArtifactDirName(runDir, id); name != id {
+			out[id] = name
+		}
+	}
+	return out
+}
+
+// relocationTarget returns where a hidden workspace path is moved under base,
+// collapsing it to a hash name when the nested path would exceed the limit.
+func relocationTarget(base, rel string) string {
+	dst := filepath.Join(base, filepath.FromSlash(rel))
+	if len(dst) <= maxPathBytes-1 {
+		return dst
+	}
+	sum := sha256.Sum256([]byte(rel))
+	return filepath.Join(base, "h-"+hex.EncodeToString(sum[:])[:shortenedNameHashHex])
+}
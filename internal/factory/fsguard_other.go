@@ -0,0 +1,7 @@
+//go:build !unix
+
+package attractor
+
+func platformStatFilesystem(string) (filesystemStats, bool, error) {
+	return filesystemStats{}, false, nil
+}
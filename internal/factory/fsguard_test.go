@@ -0,0 +1,194 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func withFilesystemStats(t *testing.T, st filesystemStats) {
+	t.Helper()
+	orig := statFilesystem
+	statFilesystem = func(string) (filesystemStats, bool, error) { return st, true, nil }
+	t.Cleanup(func() { statFilesystem = orig })
+}
+
+func TestCheckFreeInodes(t *testing.T) {
+	withFilesystemStats(t, filesystemStats{FreeBytes: 1 << 30, TotalInodes: 1000, FreeInodes: 10})
+	if err := checkFreeInodes("/runs", 100); err == nil || !strings.Contains(err.Error(), "insufficient free inodes") {
+		t.Fatalf("expected inode error, got %v", err)
+	}
+	if err := checkFreeInodes("/runs", 5); err != nil {
+		t.Fatal(err)
+	}
+	withFilesystemStats(t, filesystemStats{FreeBytes: 1 << 30})
+	if err := checkFreeInodes("/runs", 100); err != nil {
+		t.Fatalf("filesystems without inode counts should be skipped: %v", err)
+	}
+}
+
+func TestRunFailsPreflightOnInodeExhaustion(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	withFilesystemStats(t, filesystemStats{FreeBytes: 1 << 30, TotalInodes: 1000, FreeInodes: 3})
+	dot := `digraph G { graph [min_free_inodes=50]; start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ino"})
+	if err == nil || !strings.Contains(err.Error(), "min_free_inodes") {
+		t.Fatalf("expected inode preflight failure, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(runsdir, "ino", "workspace")); err == nil {
+		t.Fatal("workspace should not be copied when preflight fails")
+	}
+}
+
+func TestNodeArtifactDirNameShortensLongIDs(t *testing.T) {
+	id := strings.Repeat("n", 300)
+	name := nodeArtifactDirName("/runs/r1", id)
+	if len(name) > maxPathComponentBytes {
+		t.Fatalf("name too long: %d", len(name))
+	}
+	if name != nodeArtifactDirName("/runs/r1", id) {
+		t.Fatal("shortening must be deterministic")
+	}
+	if other := nodeArtifactDirName("/runs/r1", strings.Repeat("n", 299)+"m"); other == name {
+		t.Fatal("distinct ids must map to distinct names")
+	}
+	if got := nodeArtifactDirName("/runs/r1", "implement"); got != "implement" {
+		t.Fatalf("short ids must be unchanged: %s", got)
+	}
+	deep := "/" + strings.Repeat("d/", 1900)
+	if got := nodeArtifactDir(deep, "implement_feature_node"); len(got)+artifactPathReserve > maxPathBytes {
+		t.Fatalf("artifact dir exceeds path budget: %d", len(got))
+	}
+}
+
+func TestShortenNameKeepsRuneBoundary(t *testing.T) {
+	name := strings.Repeat("é", 200)
+	for budget := 40; budget < 50; budget++ {
+		got := shortenName(name, budget)
+		if len(got) > budget || !utf8.ValidString(got) {
+			t.Fatalf("shortenName(budget=%d) = %q", budget, got)
+		}
+	}
+}
+
+func TestRelocationTargetCollapsesLongPaths(t *testing.T) {
+	base := "/runs/r1/node/.hidden"
+	if got := relocationTarget(base, "scripts/scenarios"); got != filepath.Join(base, "scripts/scenarios") {
+		t.Fatalf("short path should be preserved: %s", got)
+	}
+	rel := strings.Repeat("segment/", 600)
+	got := relocationTarget(base, rel)
+	if len(got) >= maxPathBytes || !strings.HasPrefix(got, base) {
+		t.Fatalf("unexpected relocation target: %d", len(got))
+	}
+}
+
+func TestRunWithLongNodeIDRecordsShortenedDir(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	id := "n" + strings.Repeat("x", 299)
+	dot := `digraph G { start [shape=Mdiamond]; ` + id + ` [shape=box]; exit [shape=Msquare]; start -> ` + id + `; ` + id + ` -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "long"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "long")
+	b, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	dirs, _ := m["node_artifact_dirs"].(map[string]any)
+	name, _ := dirs[id].(string)
+	if name == "" {
+		t.Fatalf("manifest missing shortened dir mapping: %v", m)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, name, "status.json")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSanitizeNodeDirName(t *testing.T) {
+	cases := map[string]string{"plain": "plain", "build & test": "build___test", "a/b": "a_b", "..": "__", "fix-lint.v2": "fix-lint.v2"}
+	for in, want := range cases {
+		if got := sanitizeNodeDirName(in); got != want {
+			t.Fatalf("sanitizeNodeDirName(%q)=%q want %q", in, got, want)
+		}
+	}
+}
+
+func TestValidateRejectsNodeDirCollisions(t *testing.T) {
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; "a b" [shape=box]; a_b [shape=box]; workspace [shape=box]; exit [shape=Msquare]; start -> "a b" -> a_b -> workspace -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []string{}
+	for _, d := range ValidateGraph(g) {
+		msgs = append(msgs, d.Message)
+	}
+	joined := strings.Join(msgs, "\n")
+	if !strings.Contains(joined, `node ids "a b" and "a_b" map to the same artifact directory "a_b"`) || !strings.Contains(joined, `node id "workspace" collides with run artifact`) {
+		t.Fatalf("expected collision diagnostics, got:\n%s", joined)
+	}
+}
+
+func TestQuotedNodeIDRunUsesSanitizedArtifactDir(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, `digraph G { start [shape=Mdiamond]; "build & test" [shape=box]; exit [shape=Msquare]; start -> "build & test" -> exit; }`)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if st := readStatusJSON(t, filepath.Join(runsdir, "r1", "build___test", "status.json")); st["outcome"] != "success" {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	manifest, err := os.ReadFile(filepath.Join(runsdir, "r1", "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		NodeArtifactDirs map[string]string `json:"node_artifact_dirs"`
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.NodeArtifactDirs["build & test"] != "build___test" {
+		t.Fatalf("manifest missing node_artifact_dirs mapping:\n%s", manifest)
+	}
+}
+
+func TestValidateRejectsRunLevelNamesAsNodeIDs(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; build [shape=parallelogram, tool_command="echo ok > out.txt"]; exit [shape=Msquare, deliverable_paths="out.txt"]; start -> build -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1", ReportFormats: []string{"junit", "sarif"}}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(filepath.Join(runsdir, "r1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Entries this run does not create, plus everything it did.
+	names := []string{runLockFile, runStateFile + ".tmp", runChangelogFile, approvalsLedgerFile, blobStoreDir, hermeticHomeDir, traceSegmentName(2), gitSourceDirPrefix + "123"}
+	for _, e := range entries {
+		if name := e.Name(); name != "start" && name != "build" && name != "exit" {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		d := validateNodeDirNames(&Graph{Nodes: map[string]*Node{name: {ID: name}}})
+		if len(d) != 1 || !strings.Contains(d[0].Message, "collides with run artifact") {
+			t.Errorf("node id %q: %+v", name, d)
+		}
+	}
+	for _, name := range []string{"trace.x.jsonl", "trace.01.jsonl", "build.tmp", "run"} {
+		if d := validateNodeDirNames(&Graph{Nodes: map[string]*Node{name: {ID: name}}}); len(d) != 0 {
+			t.Errorf("node id %q rejected: %+v", name, d)
+		}
+	}
+}
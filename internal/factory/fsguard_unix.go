@@ -0,0 +1,17 @@
+//go:build unix
+
+package attractor
+
+import "syscall"
+
+func platformStatFilesystem(path string) (filesystemStats, bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return filesystemStats{}, false, err
+	}
+	return filesystemStats{
+		FreeBytes:   uint64(st.Bavail) * uint64(st.Bsize),
+		TotalInodes: uint64(st.Files),
+		FreeInodes:  uint64(st.Ffree),
+	}, true, nil
+}
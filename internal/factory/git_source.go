@@ -0,0 +1,169 @@
+package attractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// gitSourceDirPrefix names the scratch repositories cloneGitSource creates
+// in the run dir.
+const gitSourceDirPrefix = ".git-source-"
+
+// GitSource is a git repository a fresh run checks out into its workspace
+// instead of copying a workdir (--git-url, --git-ref).
+type GitSource struct {
+	URL string
+	// Ref is a branch, tag, or full commit SHA; empty means the remote's
+	// HEAD.
+	Ref string
+}
+
+// gitSourceRecord is manifest.json git_source.
+type gitSourceRecord struct {
+	URL    string `json:"url"`
+	Ref    string `json:"ref"`
+	Commit string `json:"commit,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (s GitSource) ref() string {
+	if r := strings.TrimSpace(s.Ref); r != "" {
+		return r
+	}
+	return "HEAD"
+}
+
+// redactedGitURL replaces a URL's user info with "redacted", so a token
+// given inline, as a password or as the user name, never reaches the
+// manifest or logs.
+func redactedGitURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = url.User("redacted")
+	return u.String()
+}
+
+// cloneGitSource fetches src's ref at depth 1 into a scratch repository in
+// runDir and checks it out into workspace, which ends up without a .git
+// directory, like a copied workdir. It returns the commit checked out.
+// Credentials come from git's own helpers and environment; prompting is
+// turned off so a missing credential fails instead of hanging.
+func cloneGitSource(src GitSource, runDir, workspace string) (string, error) {
+	gitDir, err := os.MkdirTemp(runDir, gitSourceDirPrefix)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(gitDir)
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", append([]string{"--git-dir", gitDir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", errors.New(msg)
+			}
+			return "", err
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	if _, err := git("init", "--quiet", "--bare"); err != nil {
+		return "", fmt.Errorf("git init: %w", err)
+	}
+	if _, err := git("fetch", "--quiet", "--depth", "1", "--no-tags", src.URL, src.ref()); err != nil {
+		msg := err.Error()
+		if u, perr := url.Parse(src.URL); perr == nil && u.User != nil {
+			// git may echo the URL, user info included, in its error.
+			msg = strings.ReplaceAll(msg, u.User.String()+"@", "redacted@")
+		}
+		return "", fmt.Errorf("git fetch %s %s: %s", redactedGitURL(src.URL), src.ref(), msg)
+	}
+	commit, err := git("rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse: %w", err)
+	}
+	if err := os.MkdirAll(workspace, 0o755); err != nil {
+		return "", err
+	}
+	if _, err := git("--work-tree", workspace, "-c", "core.bare=false", "checkout", "--quiet", "--detach", commit); err != nil {
+		return "", fmt.Errorf("git checkout %s: %w", commit, err)
+	}
+	return commit, nil
+}
+
+// checkoutGitSource clones cfg.GitSource into workspace for a fresh run. A
+// failed clone removes the workspace and leaves only manifest.json, with
+// the error under git_source, in runDir.
+func checkoutGitSource(g *Graph, cfg RunConfig, runDir, workspace string) (gitSourceRecord, error) {
+	rec := gitSourceRecord{URL: redactedGitURL(cfg.GitSource.URL), Ref: cfg.GitSource.ref()}
+	commit, err := cloneGitSource(*cfg.GitSource, runDir, workspace)
+	if err != nil {
+		_ = os.RemoveAll(workspace)
+		rec.Error = err.Error()
+		if werr := writeManifest(g, cfg, runDir, workspace, map[string]any{"git_source": rec, "entry_node": cfg.EntryNode}); werr != nil {
+			return rec, errors.Join(err, werr)
+		}
+		return rec, err
+	}
+	rec.Commit = commit
+	return rec, nil
+}
+
+// validateGitSource checks a RunConfig's source: exactly one of Workdir and
+// GitSource on a fresh run.
+func validateGitSource(cfg RunConfig) error {
+	if cfg.GitSource == nil {
+		return nil
+	}
+	if u := strings.TrimSpace(cfg.GitSource.URL); u == "" || strings.HasPrefix(u, "-") {
+		return fmt.Errorf("invalid git URL %q", cfg.GitSource.URL)
+	}
+	if strings.HasPrefix(cfg.GitSource.ref(), "-") {
+		return fmt.Errorf("invalid git ref %q", cfg.GitSource.Ref)
+	}
+	if cfg.Workdir != "" && !cfg.Resume {
+		return fmt.Errorf("a run takes either a workdir or a git source, not both")
+	}
+	return nil
+}
+
+// gitSourceFromManifest is the git source recorded for runDir, if any.
+func gitSourceFromManifest(runDir string) *gitSourceRecord {
+	m, err := readRerunManifest(runDir)
+	if err != nil {
+		return nil
+	}
+	return m.GitSource
+}
+
+// checkGitSourceFiles is --check-files for a git source, which can only
+// run once the clone exists.
+func checkGitSourceFiles(g *Graph, cfg RunConfig, workspace string, logger *slog.Logger) error {
+	diags := validateFileRefs(g, workspace)
+	if cfg.StrictValidation {
+		diags = StrictDiagnostics(diags)
+	}
+	msgs := []string{}
+	for _, d := range diags {
+		switch d.Level {
+		case "ERROR":
+			msgs = append(msgs, d.Message)
+		case "WARN":
+			logger.Warn("pipeline validation warning", "message", d.Message)
+		}
+	}
+	if len(msgs) > 0 {
+		logger.Error("pipeline validation failed", "errors", strings.Join(msgs, "; "))
+		return fmt.Errorf("validation failed: %s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
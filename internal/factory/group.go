@@ -0,0 +1,213 @@
+package attractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// groupEdgeKeyword starts a group_edge pseudo-statement.
+const groupEdgeKeyword = "group_edge"
+
+// groupEdgeExpandsToAttr is written by fmt on each group_edge statement to
+// list the nodes it expanded to. The parser ignores it on input.
+const groupEdgeExpandsToAttr = "expands_to"
+
+// GroupEdge is a `group_edge <group> -> <node> [attrs]` statement: after
+// parsing, it becomes an edge with attrs from every node with
+// group=<group> to <node>, except members that already have a conditional
+// edge for the statement's outcome. Expanded lists the members that got one.
+type GroupEdge struct {
+	Group    string
+	To       string
+	Attrs    map[string]Value
+	Expanded []string
+}
+
+// GroupEdgeExpansion records the edges one group_edge statement added; it
+// is written to manifest.json under group_edges.
+type GroupEdgeExpansion struct {
+	Group     string   `json:"group"`
+	To        string   `json:"to"`
+	Condition string   `json:"condition,omitempty"`
+	From      []string `json:"from"`
+}
+
+// hasGroupEdgeKeyword reports whether stmt is a group_edge statement rather
+// than an edge from a node named group_edge.
+func hasGroupEdgeKeyword(stmt string) bool {
+	if !strings.HasPrefix(stmt, groupEdgeKeyword) {
+		return false
+	}
+	rest := stmt[len(groupEdgeKeyword):]
+	trimmed := strings.TrimLeft(rest, " \t\r\n")
+	return len(trimmed) < len(rest) && trimmed != "" && !strings.HasPrefix(trimmed, "->") && !strings.HasPrefix(trimmed, "[")
+}
+
+func parseGroupEdgeStmt(g *Graph, stmt string, defaults map[string]Value) error {
+	lhs := strings.TrimSpace(stmt[len(groupEdgeKeyword):])
+	attrs := map[string]Value{}
+	if i := indexOutsideQuotes(lhs, "["); i >= 0 {
+		j := strings.LastIndex(lhs, "]")
+		if j <= i {
+			return fmt.Errorf("invalid group_edge attrs: %s", stmt)
+		}
+		parsed, err := parseAttrs(lhs[i+1 : j])
+		if err != nil {
+			return err
+		}
+		attrs = parsed
+		lhs = strings.TrimSpace(lhs[:i])
+	}
+	i := indexOutsideQuotes(lhs, "->")
+	if i < 0 || indexOutsideQuotes(lhs[i+2:], "->") >= 0 {
+		return fmt.Errorf("group_edge must be `group_edge <group> -> <node>`: %s", strings.TrimSpace(stmt))
+	}
+	group, ok := parseNodeID(lhs[:i])
+	if !ok {
+		return fmt.Errorf("invalid group_edge group: %s", strings.TrimSpace(lhs[:i]))
+	}
+	to, ok := parseNodeID(stripEdgePort(lhs[i+2:]))
+	if !ok {
+		return fmt.Errorf("invalid group_edge target: %s", strings.TrimSpace(lhs[i+2:]))
+	}
+	if _, ok := attrs["id"]; ok {
+		return fmt.Errorf("group_edge %s -> %s: id would repeat on every member's edge", group, to)
+	}
+	delete(attrs, groupEdgeExpandsToAttr)
+	eAttrs := map[string]Value{}
+	for k, v := range defaults {
+		eAttrs[k] = v
+	}
+	for k, v := range attrs {
+		eAttrs[k] = v
+	}
+	g.GroupEdges = append(g.GroupEdges, &GroupEdge{Group: group, To: to, Attrs: eAttrs})
+	return nil
+}
+
+// GroupMembers lists the IDs of the nodes with group=<group>, sorted.
+func GroupMembers(g *Graph, group string) []string {
+	members := []string{}
+	for _, id := range sortedKeys(g.Nodes) {
+		if strings.TrimSpace(g.Nodes[id].StringAttr("group", "")) == group {
+			members = append(members, id)
+		}
+	}
+	return members
+}
+
+// expandGroupEdges adds each group_edge statement's edges, in statement
+// order and then member ID order. A member is skipped when it is the
+// target or already has an edge for the statement's outcome: a conditional
+// edge naming that outcome, or, for an unconditional statement, an
+// unconditional edge. Earlier statements' edges count, so the first
+// statement for an outcome wins.
+func expandGroupEdges(g *Graph) error {
+	for _, ge := range g.GroupEdges {
+		members := GroupMembers(g, ge.Group)
+		if len(members) == 0 {
+			return fmt.Errorf("group_edge %s -> %s: no node has group=%q", ge.Group, ge.To, ge.Group)
+		}
+		if g.Nodes[ge.To] == nil {
+			return fmt.Errorf("group_edge %s -> %s: target node %s does not exist", ge.Group, ge.To, ge.To)
+		}
+		raw := strings.TrimSpace((&Edge{Attrs: ge.Attrs}).StringAttr("condition", ""))
+		outcome := ""
+		if raw != "" {
+			c, err := parseCondition(raw)
+			if err != nil {
+				return fmt.Errorf("group_edge %s -> %s: %w", ge.Group, ge.To, err)
+			}
+			outcome = c.Outcome
+		}
+		ge.Expanded = nil
+		for _, id := range members {
+			if id == ge.To || hasEdgeForOutcome(g, id, raw, outcome) {
+				continue
+			}
+			attrs := make(map[string]Value, len(ge.Attrs)+1)
+			for k, v := range ge.Attrs {
+				attrs[k] = v
+			}
+			attrs[groupEdgeKeyword] = ge.Group
+			g.Edges = append(g.Edges, &Edge{From: id, To: ge.To, Attrs: attrs})
+			ge.Expanded = append(ge.Expanded, id)
+		}
+	}
+	return nil
+}
+
+// hasEdgeForOutcome reports whether from already routes the outcome a
+// group_edge with condition raw covers.
+func hasEdgeForOutcome(g *Graph, from, raw, outcome string) bool {
+	for _, e := range g.Edges {
+		if e.From != from {
+			continue
+		}
+		cond := strings.TrimSpace(e.StringAttr("condition", ""))
+		if raw == "" {
+			if cond == "" {
+				return true
+			}
+			continue
+		}
+		if c, err := parseCondition(cond); err == nil && c.Outcome != "" && c.Outcome == outcome {
+			return true
+		}
+	}
+	return false
+}
+
+// groupEdgeExpansions rebuilds the expansion record from the expanded
+// edges' group_edge attribute, so it survives a ToDOT round trip.
+func groupEdgeExpansions(g *Graph) []GroupEdgeExpansion {
+	out := []GroupEdgeExpansion{}
+	index := map[[3]string]int{}
+	for _, e := range g.Edges {
+		group := e.StringAttr(groupEdgeKeyword, "")
+		if group == "" {
+			continue
+		}
+		cond := strings.TrimSpace(e.StringAttr("condition", ""))
+		key := [3]string{group, e.To, cond}
+		i, ok := index[key]
+		if !ok {
+			i = len(out)
+			index[key] = i
+			out = append(out, GroupEdgeExpansion{Group: group, To: e.To, Condition: cond})
+		}
+		out[i].From = append(out[i].From, e.From)
+	}
+	return out
+}
+
+// lintGroupRequiredAttrs checks the graph's group.<name>.required_attrs
+// lists: every member of the group must set each attribute, directly or by
+// inheritance.
+func lintGroupRequiredAttrs(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	keys := []string{}
+	for k := range g.Attrs {
+		if strings.HasPrefix(k, "group.") && strings.HasSuffix(k, ".required_attrs") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		group := strings.TrimSuffix(strings.TrimPrefix(k, "group."), ".required_attrs")
+		members := GroupMembers(g, group)
+		if len(members) == 0 {
+			d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("graph %s: no node has group=%q", k, group)})
+			continue
+		}
+		for _, attr := range splitCSV(fmt.Sprintf("%v", g.Attrs[k])) {
+			for _, id := range members {
+				if v, ok := resolveAttr(g.Nodes[id], g, attr); !ok || strings.TrimSpace(fmt.Sprintf("%v", v)) == "" {
+					d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: members of group %s must set %s", id, group, attr)})
+				}
+			}
+		}
+	}
+	return d
+}
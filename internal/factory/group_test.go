@@ -0,0 +1,159 @@
+package attractor
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const groupDOT = `digraph G {
+	start [shape=Mdiamond];
+	lint [shape=parallelogram, tool_command="true", group="verify"];
+	test [shape=parallelogram, tool_command="true", group="verify"];
+	vet [shape=parallelogram, tool_command="true", group="verify"];
+	fix [shape=parallelogram, tool_command="true"];
+	triage [shape=parallelogram, tool_command="true"];
+	exit [shape=Msquare];
+	start -> lint -> test -> vet -> exit;
+	test -> triage [condition="outcome=fail"];
+	fix -> exit;
+	triage -> exit;
+	group_edge verify -> fix [condition="outcome=fail", weight=2];
+	group_edge verify -> triage [condition="outcome=fail"];
+	}`
+
+func TestGroupEdgeExpansion(t *testing.T) {
+	g, err := ParseDOT(groupDOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, e := range g.Edges {
+		if e.StringAttr(groupEdgeKeyword, "") == "verify" {
+			got = append(got, e.ID+" "+e.StringAttr("condition", "")+" "+e.StringAttr("weight", ""))
+		}
+	}
+	// test already routes fail, and the second statement finds every member
+	// covered by the first.
+	if want := "lint-fix-0 outcome=fail 2,vet-fix-0 outcome=fail 2"; strings.Join(got, ",") != want {
+		t.Fatalf("expanded edges = %q, want %q", got, want)
+	}
+	if d := decideRoute(g, "vet", "fail", nil); d.Selected != "fix" {
+		t.Fatalf("vet fail routes to %q", d.Selected)
+	}
+	if len(g.GroupEdges) != 2 || strings.Join(g.GroupEdges[0].Expanded, ",") != "lint,vet" || len(g.GroupEdges[1].Expanded) != 0 {
+		t.Fatalf("group edges = %+v", g.GroupEdges)
+	}
+	if want := []GroupEdgeExpansion{{Group: "verify", To: "fix", Condition: "outcome=fail", From: []string{"lint", "vet"}}}; !reflect.DeepEqual(groupEdgeExpansions(g), want) {
+		t.Fatalf("expansions = %+v", groupEdgeExpansions(g))
+	}
+
+	// ToDOT keeps the statements, which expand to nothing on a reparse.
+	again, err := ParseDOT(g.ToDOT())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Edges) != len(g.Edges) {
+		t.Fatalf("round trip has %d edges, want %d", len(again.Edges), len(g.Edges))
+	}
+}
+
+func TestGroupEdgeUnconditional(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, group="steps"];
+	b [shape=box, group="steps"];
+	exit [shape=Msquare, group="steps"];
+	start -> a;
+	a -> b;
+	group_edge steps -> exit;
+	group_edge -> a;
+	group_edge [shape=box];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edges := []string{}
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+"->"+e.To)
+	}
+	// a already has an unconditional edge and exit is the target; the last
+	// two statements are an edge and a node named group_edge.
+	if want := "start->a,a->b,group_edge->a,b->exit"; strings.Join(edges, ",") != want {
+		t.Fatalf("edges = %s, want %s", strings.Join(edges, ","), want)
+	}
+}
+
+func TestGroupEdgeErrors(t *testing.T) {
+	for stmt, want := range map[string]string{
+		`group_edge missing -> b`:                   `no node has group="missing"`,
+		`group_edge g -> nowhere`:                   "target node nowhere does not exist",
+		`group_edge g -> b [id="x"]`:                "id would repeat",
+		`group_edge g -> b -> c`:                    "group_edge must be",
+		`group_edge g -> b [condition="outcome=="]`: "group_edge g -> b:",
+	} {
+		_, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=box, group="g"]; b [shape=box]; exit [shape=Msquare]; start -> a -> b -> exit; ` + stmt + `; }`)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", stmt, err, want)
+		}
+	}
+}
+
+func TestFormatDOTShowsGroupEdgeExpansion(t *testing.T) {
+	out, err := FormatDOT(strings.ReplaceAll(groupDOT, "\t", "  "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"  group_edge verify -> fix [condition=\"outcome=fail\", expands_to=\"lint,vet\", weight=2];\n",
+		"  group_edge verify -> triage [condition=\"outcome=fail\"];\n}\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("fmt output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "lint -> fix") {
+		t.Fatalf("fmt wrote expanded edges:\n%s", out)
+	}
+	again, err := FormatDOT(out)
+	if err != nil || again != out {
+		t.Fatalf("fmt is not idempotent (%v):\n%s", err, again)
+	}
+}
+
+func TestGroupRequiredAttrsRule(t *testing.T) {
+	g, err := ParseDOT(strings.Replace(groupDOT, "digraph G {", `digraph G { graph ["group.verify.required_attrs"="verification.allowed_commands", "group.docs.required_attrs"="prompt"]; lint [shape=parallelogram, "verification.allowed_commands"="golangci-lint"];`, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{
+		"node test: members of group verify must set verification.allowed_commands",
+		"node vet: members of group verify must set verification.allowed_commands",
+		`graph group.docs.required_attrs: no node has group="docs"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("diagnostics lack %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "node lint: members") {
+		t.Fatalf("lint sets the attr:\n%s", got)
+	}
+}
+
+func TestManifestRecordsGroupEdges(t *testing.T) {
+	workdir, runsdir, pipeline := setupRun(t, groupDOT)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "g1"}); err != nil {
+		t.Fatal(err)
+	}
+	m := readStatusJSON(t, filepath.Join(runsdir, "g1", "manifest.json"))
+	edges, _ := m["group_edges"].([]any)
+	if len(edges) != 1 {
+		t.Fatalf("group_edges = %v", m["group_edges"])
+	}
+	x := edges[0].(map[string]any)
+	if x["group"] != "verify" || x["to"] != "fix" || x["condition"] != "outcome=fail" || len(x["from"].([]any)) != 2 {
+		t.Fatalf("group_edges = %v", x)
+	}
+}
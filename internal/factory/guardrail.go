@@ -0,0 +1,185 @@
+package attractor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	guardrailHeadLines            = 50
+	defaultGuardrailRevertMaxSize = 1 << 20
+)
+
+// ErrGuardrailViolation is returned (wrapped) by RunPipeline when
+// RunConfig.FailFastOnGuardrail is set and a node writes outside its
+// allowed_write_paths.
+var ErrGuardrailViolation = errors.New("guardrail violation")
+
+type guardrailViolationFile struct {
+	Path        string   `json:"path"`
+	Change      string   `json:"change"`
+	Size        int64    `json:"size"`
+	Hash        string   `json:"hash,omitempty"`
+	ModTime     string   `json:"mtime,omitempty"`
+	Head        []string `json:"head,omitempty"`
+	Reverted    bool     `json:"reverted"`
+	RevertError string   `json:"revert_error,omitempty"`
+}
+
+type guardrailViolationReport struct {
+	SchemaVersion     int                      `json:"schema_version"`
+	NodeID            string                   `json:"node_id"`
+	Mode              string                   `json:"mode"`
+	HandlerStartedAt  string                   `json:"handler_started_at"`
+	HandlerFinishedAt string                   `json:"handler_finished_at"`
+	Files             []guardrailViolationFile `json:"files"`
+}
+
+func guardrailMode(node *Node) string {
+	mode := strings.ToLower(strings.TrimSpace(node.StringAttr("guardrail_mode", "fail")))
+	if mode == "" {
+		return "fail"
+	}
+	return mode
+}
+
+func validateGuardrailMode(n *Node) error {
+	switch guardrailMode(n) {
+	case "fail", "revert":
+		return nil
+	default:
+		return fmt.Errorf("unsupported guardrail_mode on node %s: %s", n.ID, n.StringAttr("guardrail_mode", ""))
+	}
+}
+
+// guardrailRetainLimit returns the largest file size whose original content is
+// kept in the pre-node snapshot, or -1 when the node does not need originals.
+func guardrailRetainLimit(node *Node) int64 {
+	if guardrailMode(node) != "revert" {
+		return -1
+	}
+	limit := node.IntAttr("guardrail.revert_max_bytes", defaultGuardrailRevertMaxSize)
+	if limit < 0 {
+		return -1
+	}
+	return int64(limit)
+}
+
+func buildGuardrailViolationReport(node *Node, workspace string, diff workspaceDiff, violations []string, before, after map[string]fileState, started, finished time.Time) guardrailViolationReport {
+	change := map[string]string{}
+	for _, p := range diff.Created {
+		change[p] = "created"
+	}
+	for _, p := range diff.Modified {
+		change[p] = "modified"
+	}
+	for _, p := range diff.Deleted {
+		change[p] = "deleted"
+	}
+	detailed := node.BoolAttr("guardrail.detailed_diffs", false)
+	report := guardrailViolationReport{
+		SchemaVersion:     1,
+		NodeID:            node.ID,
+		Mode:              guardrailMode(node),
+		HandlerStartedAt:  started.Format(time.RFC3339Nano),
+		HandlerFinishedAt: finished.Format(time.RFC3339Nano),
+		Files:             make([]guardrailViolationFile, 0, len(violations)),
+	}
+	for _, p := range violations {
+		f := guardrailViolationFile{Path: p, Change: change[p]}
+		if st, ok := after[p]; ok {
+			f.Size = st.Size
+			f.Hash = st.Hash
+			f.ModTime = st.ModTime.UTC().Format(time.RFC3339Nano)
+			if detailed && st.Symlink == "" {
+				f.Head = readHeadLines(filepath.Join(workspace, filepath.FromSlash(p)), guardrailHeadLines)
+			}
+		} else if st, ok := before[p]; ok {
+			f.Size = st.Size
+			f.Hash = st.Hash
+		}
+		report.Files = append(report.Files, f)
+	}
+	return report
+}
+
+// revertGuardrailViolations restores offending paths to their pre-node state.
+// Created files are removed; modified and deleted files are rewritten from the
+// retained snapshot content when it was small enough to keep.
+func revertGuardrailViolations(workspace string, report *guardrailViolationReport, before map[string]fileState) {
+	for i := range report.Files {
+		f := &report.Files[i]
+		target := filepath.Join(workspace, filepath.FromSlash(f.Path))
+		if f.Change == "created" {
+			if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+				f.RevertError = err.Error()
+				continue
+			}
+			f.Reverted = true
+			continue
+		}
+		orig, ok := before[f.Path]
+		if !ok || !orig.Retained {
+			f.RevertError = "original content not retained (exceeds guardrail.revert_max_bytes)"
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			f.RevertError = err.Error()
+			continue
+		}
+		if orig.Symlink != "" {
+			_ = os.Remove(target)
+			if err := os.Symlink(orig.Symlink, target); err != nil {
+				f.RevertError = err.Error()
+				continue
+			}
+			f.Reverted = true
+			continue
+		}
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			_ = os.Remove(target)
+		}
+		mode := orig.Mode
+		if mode == 0 {
+			mode = 0o644
+		}
+		if err := os.WriteFile(target, orig.Content, mode); err != nil {
+			f.RevertError = err.Error()
+			continue
+		}
+		_ = os.Chmod(target, mode)
+		f.Reverted = true
+	}
+}
+
+func (r guardrailViolationReport) eventFiles() []map[string]any {
+	out := make([]map[string]any, 0, len(r.Files))
+	for _, f := range r.Files {
+		m := map[string]any{"path": f.Path, "change": f.Change, "size": f.Size, "hash": f.Hash, "mtime": f.ModTime}
+		if r.Mode == "revert" {
+			m["reverted"] = f.Reverted
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func readHeadLines(path string, max int) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	out := []string{}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for len(out) < max && sc.Scan() {
+		out = append(out, sc.Text())
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package attractor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readViolationReport(t *testing.T, p string) guardrailViolationReport {
+	t.Helper()
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r guardrailViolationReport
+	if err := json.Unmarshal(b, &r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestGuardViolationRecordsForensics(t *testing.T) {
+	dot := `digraph G { start [shape=Mdiamond]; t [shape=parallelogram, tool_command="sh -c 'printf \"l1\\nl2\\n\" > b.txt'", allowed_write_paths="a.txt", "guardrail.detailed_diffs"=true]; exit [shape=Msquare]; start -> t; t -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "b.txt"), "y")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "gv1"}); err != nil {
+		t.Fatal(err)
+	}
+	r := readViolationReport(t, filepath.Join(runsdir, "gv1", "t", "guardrail.violation.json"))
+	if r.Mode != "fail" || r.HandlerStartedAt == "" || r.HandlerFinishedAt == "" {
+		t.Fatalf("unexpected report header: %+v", r)
+	}
+	if len(r.Files) != 1 || r.Files[0].Path != "b.txt" || r.Files[0].Change != "modified" {
+		t.Fatalf("unexpected files: %+v", r.Files)
+	}
+	f := r.Files[0]
+	if f.Hash == "" || f.Size != 6 || f.ModTime == "" {
+		t.Fatalf("missing file forensics: %+v", f)
+	}
+	if strings.Join(f.Head, ",") != "l1,l2" {
+		t.Fatalf("unexpected head: %v", f.Head)
+	}
+	for _, ev := range readJSONLRecords(t, filepath.Join(runsdir, "gv1", "events.jsonl")) {
+		if ev["type"] == "GuardrailViolation" {
+			if ev["handler_started_at"] == nil || ev["files"] == nil {
+				t.Fatalf("event missing forensics: %v", ev)
+			}
+			return
+		}
+	}
+	t.Fatal("expected GuardrailViolation event")
+}
+
+func TestGuardRevertModeRestoresWorkspace(t *testing.T) {
+	dot := `digraph G { start [shape=Mdiamond]; t [shape=parallelogram, tool_command="sh -c 'echo changed > b.txt && echo new > c.txt && rm d.txt && echo ok > a.txt'", allowed_write_paths="a.txt", guardrail_mode="revert"]; exit [shape=Msquare]; start -> t; t -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "b.txt"), "orig-b")
+	writeFile(t, filepath.Join(workdir, "d.txt"), "orig-d")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "gv2"}); err != nil {
+		t.Fatal(err)
+	}
+	ws := filepath.Join(runsdir, "gv2", "workspace")
+	if b, _ := os.ReadFile(filepath.Join(ws, "b.txt")); string(b) != "orig-b" {
+		t.Fatalf("b.txt not restored: %q", string(b))
+	}
+	if b, _ := os.ReadFile(filepath.Join(ws, "d.txt")); string(b) != "orig-d" {
+		t.Fatalf("d.txt not restored: %q", string(b))
+	}
+	if _, err := os.Stat(filepath.Join(ws, "c.txt")); !os.IsNotExist(err) {
+		t.Fatal("c.txt should be removed")
+	}
+	if b, _ := os.ReadFile(filepath.Join(ws, "a.txt")); !strings.Contains(string(b), "ok") {
+		t.Fatal("allowed write should be kept")
+	}
+	st, _ := os.ReadFile(filepath.Join(runsdir, "gv2", "t", "status.json"))
+	if !strings.Contains(string(st), "guardrail_violation") {
+		t.Fatalf("revert mode should still fail the stage: %s", string(st))
+	}
+	r := readViolationReport(t, filepath.Join(runsdir, "gv2", "t", "guardrail.violation.json"))
+	for _, f := range r.Files {
+		if !f.Reverted {
+			t.Fatalf("expected all files reverted: %+v", r.Files)
+		}
+	}
+}
+
+func TestGuardRevertSkipsFilesAboveRetainCap(t *testing.T) {
+	dot := `digraph G { start [shape=Mdiamond]; t [shape=parallelogram, tool_command="sh -c 'echo changed > big.txt'", allowed_write_paths="a.txt", guardrail_mode="revert", "guardrail.revert_max_bytes"=4]; exit [shape=Msquare]; start -> t; t -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "big.txt"), "0123456789")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "gv3"}); err != nil {
+		t.Fatal(err)
+	}
+	r := readViolationReport(t, filepath.Join(runsdir, "gv3", "t", "guardrail.violation.json"))
+	if len(r.Files) != 1 || r.Files[0].Reverted || r.Files[0].RevertError == "" {
+		t.Fatalf("expected unreverted file with error: %+v", r.Files)
+	}
+}
+
+func TestValidateGuardrailMode(t *testing.T) {
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=box, guardrail_mode="ignore"]; exit [shape=Msquare]; start -> a; a -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !HasErrors(ValidateGraph(g)) {
+		t.Fatal("expected unsupported guardrail_mode error")
+	}
+}
+
+func TestFailFastOnGuardrailStopsBeforeFixNode(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="echo x > b.txt", allowed_write_paths="a.txt"];
+	fix [shape=parallelogram, tool_command="echo fixed > a.txt", allowed_write_paths="a.txt"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit [condition="outcome=success"];
+	t -> fix [condition="outcome=fail"];
+	fix -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ff0"}); err != nil {
+		t.Fatalf("default run should route to fix: %v", err)
+	}
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ff1", FailFastOnGuardrail: true})
+	if !errors.Is(err, ErrGuardrailViolation) || err.Error() != "guardrail violation: node t wrote disallowed files: b.txt" {
+		t.Fatalf("expected guardrail error, got %v", err)
+	}
+	runDir := filepath.Join(runsdir, "ff1")
+	if _, err := os.Stat(filepath.Join(runDir, "fix")); !os.IsNotExist(err) {
+		t.Fatal("fix node ran despite fail-fast")
+	}
+	st := readStatusJSON(t, filepath.Join(runDir, "t", "status.json"))
+	if st["failure_code"] != string(FailureGuardrailWriteViolation) {
+		t.Fatalf("status = %v", st)
+	}
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil || cp.LastCompletedNode != "t" {
+		t.Fatalf("checkpoint = %+v (%v)", cp, err)
+	}
+	if evs := eventsOfType(t, runDir, "PipelineAborted"); len(evs) != 1 || evs[0]["reason"] != "guardrail_violation" {
+		t.Fatalf("PipelineAborted events = %v", evs)
+	}
+	b, _ := os.ReadFile(filepath.Join(runDir, runResultFile))
+	if !strings.Contains(string(b), `"status": "aborted"`) {
+		t.Fatalf("run result = %s", b)
+	}
+}
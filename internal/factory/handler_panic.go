@@ -0,0 +1,49 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// ErrHandlerPanic wraps a panic recovered from a node handler. The run ends
+// through the normal failure path instead of crashing the process.
+var ErrHandlerPanic = errors.New("handler_panic")
+
+// panicFile holds the recovered value and stack trace in the node dir.
+const panicFile = "panic.txt"
+
+// executeHandler runs h, turning a panic into an ErrHandlerPanic error after
+// writing panic.txt and recording StagePanicked.
+func (e *Engine) executeHandler(h Handler, node *Node, nodeDir string) (out Outcome, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		path := filepath.Join(nodeDir, panicFile)
+		if werr := os.WriteFile(path, []byte(fmt.Sprintf("panic: %v\n\n%s", r, debug.Stack())), 0o644); werr != nil {
+			e.Logger.Warn("failed to write panic trace", "node", node.ID, "error", werr)
+		}
+		e.recordEvent(map[string]any{"schema_version": 1, "type": "StagePanicked", "node_id": node.ID, "panic": fmt.Sprint(r), "panic_path": path, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+		e.Logger.Error("stage handler panicked", "node", node.ID, "panic", fmt.Sprint(r), "panic_path", path)
+		out, err = Outcome{}, fmt.Errorf("%w: node %s: %v", ErrHandlerPanic, node.ID, r)
+	}()
+	return h.Execute(node, e.Context, e.Graph, nodeDir, e.Workspace)
+}
+
+// recordHandlerPanic writes the panicked node's failed status and a
+// checkpoint that still ends at the last completed node, so a resume runs
+// the node again.
+func (e *Engine) recordHandlerPanic(node *Node, nodeDir string, err error) {
+	out := Outcome{SchemaVersion: 1, Outcome: "fail", FailureReason: err.Error(), FailureCode: FailureHandlerPanic, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}
+	if werr := writeJSON(filepath.Join(nodeDir, "status.json"), out); werr != nil {
+		e.Logger.Error("failed to write status after handler panic", "node", node.ID, "error", werr)
+	}
+	if werr := e.writeCheckpoint(e.lastCompleted); werr != nil {
+		e.Logger.Error("failed to checkpoint after handler panic", "node", node.ID, "error", werr)
+	}
+}
@@ -0,0 +1,42 @@
+package attractor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandlerPanicFailsStageCleanly(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box, "test.panic"="boom"]; exit [shape=Msquare]; start -> a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "p1"})
+	if !errors.Is(err, ErrHandlerPanic) || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("err = %v", err)
+	}
+	runDir := filepath.Join(runsdir, "p1")
+	trace, _ := os.ReadFile(filepath.Join(runDir, "a", panicFile))
+	if !strings.HasPrefix(string(trace), "panic: boom") || !strings.Contains(string(trace), "goroutine") {
+		t.Fatalf("panic.txt = %q", trace)
+	}
+	status := readStatusJSON(t, filepath.Join(runDir, "a", "status.json"))
+	if status["outcome"] != "fail" || status["failure_code"] != "handler_panic" {
+		t.Fatalf("status = %v", status)
+	}
+	if len(eventsOfType(t, runDir, "StagePanicked")) != 1 || len(eventsOfType(t, runDir, "PipelineFailed")) != 1 {
+		t.Fatal("missing StagePanicked or PipelineFailed event")
+	}
+	failed := eventsOfType(t, runDir, "StageFailed")
+	if len(failed) != 1 || failed[0]["failure_code"] != "handler_panic" {
+		t.Fatalf("StageFailed = %v", failed)
+	}
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil || cp.LastCompletedNode != "start" {
+		t.Fatalf("checkpoint = %+v (%v)", cp, err)
+	}
+	if res := readStatusJSON(t, filepath.Join(runDir, runResultFile)); res["status"] != "failed" {
+		t.Fatalf("run result = %v", res)
+	}
+}
@@ -0,0 +1,157 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// hermeticSystemPath is PATH for hermetic host commands, ahead of which
+	// tool_path_prepend goes.
+	hermeticSystemPath = "/usr/local/bin:/usr/bin:/bin:/usr/local/sbin:/usr/sbin:/sbin"
+	// hermeticHomeDir is the run-dir entry hermetic commands get as HOME.
+	hermeticHomeDir = "hermetic_home"
+	hermeticLocale  = "C.UTF-8"
+	toolEnvFile     = "tool.env.json"
+)
+
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// hermeticEnvEnabled reports graph [hermetic_env=true]: tool and
+// verification commands start from a minimal environment instead of the
+// factory's own.
+func hermeticEnvEnabled(g *Graph) bool {
+	if g == nil {
+		return false
+	}
+	b, _ := strconv.ParseBool(strings.TrimSpace(fmt.Sprintf("%v", g.Attrs["hermetic_env"])))
+	return b
+}
+
+// parseToolEnv reads tool_env="NAME=value,NAME2=value": variables set on
+// every command the node runs. Values cannot contain commas.
+func parseToolEnv(n *Node) ([]string, error) {
+	out := []string{}
+	for _, entry := range splitCSV(n.StringAttr("tool_env", "")) {
+		entry = strings.TrimSpace(entry)
+		name, _, ok := strings.Cut(entry, "=")
+		if !ok || !envNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid tool_env entry %q (expected NAME=value)", entry)
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// toolEnvPassthrough lists tool_env_passthrough="GOPATH,GOCACHE": factory
+// variables a hermetic command keeps.
+func toolEnvPassthrough(n *Node) []string {
+	out := []string{}
+	for _, name := range splitCSV(n.StringAttr("tool_env_passthrough", "")) {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// commandEnv is the environment a tool or verification node's commands
+// run with, ending with nodeEnv. When hermetic is true it is the whole
+// environment; otherwise it is added to the factory's. Hermetic mode only
+// applies to host commands: containers never see the factory's environment.
+func commandEnv(g *Graph, n *Node, runner toolRunner, workspace string, nodeEnv []string) (env []string, hermetic bool, err error) {
+	hermetic = hermeticEnvEnabled(g) && runner.Name != "docker"
+	if hermetic {
+		path := hermeticSystemPath
+		if dir := toolPathPrepend(n); dir != "" {
+			abs, err := filepath.Abs(filepath.Join(workspace, filepath.FromSlash(dir)))
+			if err != nil {
+				return nil, false, err
+			}
+			path = abs + string(os.PathListSeparator) + path
+		}
+		home, err := filepath.Abs(filepath.Join(filepath.Dir(workspace), hermeticHomeDir))
+		if err != nil {
+			return nil, false, err
+		}
+		if err := os.MkdirAll(home, 0o755); err != nil {
+			return nil, false, err
+		}
+		env = []string{"PATH=" + path, "HOME=" + home, "LANG=" + hermeticLocale, "LC_ALL=" + hermeticLocale}
+		for _, name := range toolEnvPassthrough(n) {
+			if v, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+v)
+			}
+		}
+	} else if env, err = toolPathEnv(n, workspace); err != nil {
+		return nil, false, err
+	}
+	extra, err := parseToolEnv(n)
+	if err != nil {
+		return nil, false, err
+	}
+	return append(append(env, extra...), nodeEnv...), hermetic, nil
+}
+
+// toolEnvRecord is tool.env.json: the environment a node's commands got,
+// with secret-looking values redacted.
+type toolEnvRecord struct {
+	Hermetic bool `json:"hermetic"`
+	// Env is the whole environment when Hermetic, else only what the
+	// factory added to its own.
+	Env map[string]string `json:"env"`
+}
+
+func writeToolEnv(nodeDir string, env []string, hermetic bool) error {
+	rec := toolEnvRecord{Hermetic: hermetic, Env: map[string]string{}}
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		if isSecretEnvName(name) {
+			value = "[redacted]"
+		}
+		rec.Env[name] = value
+	}
+	return writeJSON(filepath.Join(nodeDir, toolEnvFile), rec)
+}
+
+// validateToolEnv checks tool_env and tool_env_passthrough, and warns when a
+// hermetic run would pass through a variable the factory does not have.
+func validateToolEnv(g *Graph, n *Node) []Diagnostic {
+	_, env := n.Attrs["tool_env"]
+	_, passthrough := n.Attrs["tool_env_passthrough"]
+	if !env && !passthrough {
+		return nil
+	}
+	if typ := handlerType(n); typ != "tool" && typ != "verification" {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets tool_env or tool_env_passthrough but is not a tool or verification node", n.ID)}}
+	}
+	d := []Diagnostic{}
+	if _, err := parseToolEnv(n); err != nil {
+		d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: %v", n.ID, err)})
+	}
+	for _, name := range toolEnvPassthrough(n) {
+		if !envNameRe.MatchString(name) {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: invalid tool_env_passthrough name %q", n.ID, name)})
+			continue
+		}
+		if _, ok := os.LookupEnv(name); !ok && hermeticEnvEnabled(g) {
+			d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s tool_env_passthrough names %s, which is not set in the factory's environment", n.ID, name)})
+		}
+	}
+	return d
+}
+
+func validateHermeticEnv(g *Graph) []Diagnostic {
+	raw, ok := g.Attrs["hermetic_env"]
+	if !ok {
+		return nil
+	}
+	if _, err := strconv.ParseBool(strings.TrimSpace(fmt.Sprintf("%v", raw))); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("graph has invalid hermetic_env %v (expected true or false)", raw)}}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHermeticEnvStripsInheritedEnvironment(t *testing.T) {
+	t.Setenv("LEAK_ME", "leaked")
+	t.Setenv("PASS_ME", "kept")
+	for _, hermetic := range []bool{true, false} {
+		dot := `digraph G {
+	graph [hermetic_env=` + strconv.FormatBool(hermetic) + `];
+	start [shape=Mdiamond];
+	dump [shape=parallelogram, tool_command="env > env.txt", tool_env="MODE=ci,API_TOKEN=s3cret", tool_env_passthrough="PASS_ME"];
+	exit [shape=Msquare];
+	start -> dump -> exit;
+	}`
+		workdir, runsdir, pipeline := setupRun(t, dot)
+		if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "he1"}); err != nil {
+			t.Fatal(err)
+		}
+		runDir := filepath.Join(runsdir, "he1")
+		b, err := os.ReadFile(filepath.Join(runDir, "workspace", "env.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := "\n" + string(b)
+		home, _ := filepath.Abs(filepath.Join(runDir, hermeticHomeDir))
+		for _, want := range []string{"\nMODE=ci\n", "\nAPI_TOKEN=s3cret\n", "\nPASS_ME=kept\n"} {
+			if !strings.Contains(env, want) {
+				t.Fatalf("hermetic=%t: env lacks %q:\n%s", hermetic, want, env)
+			}
+		}
+		if got := strings.Contains(env, "\nLEAK_ME=leaked\n"); got == hermetic {
+			t.Fatalf("hermetic=%t: LEAK_ME inherited = %t", hermetic, got)
+		}
+		if got := strings.Contains(env, "\nHOME="+home+"\n") && strings.Contains(env, "\nLC_ALL="+hermeticLocale+"\n"); got != hermetic {
+			t.Fatalf("hermetic=%t: pinned HOME/LC_ALL = %t:\n%s", hermetic, got, env)
+		}
+		var rec toolEnvRecord
+		raw, err := os.ReadFile(filepath.Join(runDir, "dump", toolEnvFile))
+		if err != nil || json.Unmarshal(raw, &rec) != nil {
+			t.Fatalf("tool.env.json = %s (%v)", raw, err)
+		}
+		if rec.Hermetic != hermetic || rec.Env["API_TOKEN"] != "[redacted]" || rec.Env["MODE"] != "ci" {
+			t.Fatalf("tool.env.json = %+v", rec)
+		}
+		if _, ok := rec.Env["PASS_ME"]; ok != hermetic {
+			t.Fatalf("hermetic=%t: recorded PASS_ME = %t", hermetic, ok)
+		}
+	}
+}
+
+func TestValidateToolEnv(t *testing.T) {
+	os.Unsetenv("HERMETIC_TEST_UNSET")
+	g, err := ParseDOT(`digraph G {
+	graph [hermetic_env=true];
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="true", tool_env="OK=1,bad entry", tool_env_passthrough="HOME,HERMETIC_TEST_UNSET,1BAD"];
+	b [shape=box, tool_env="X=1"];
+	exit [shape=Msquare];
+	start -> a -> b -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{
+		`node a: invalid tool_env entry "bad entry" (expected NAME=value)`,
+		`node a: invalid tool_env_passthrough name "1BAD"`,
+		"node a tool_env_passthrough names HERMETIC_TEST_UNSET, which is not set in the factory's environment",
+		"node b sets tool_env or tool_env_passthrough but is not a tool or verification node",
+	} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("diagnostics lack %q:\n%s", want, msgs)
+		}
+	}
+	if strings.Contains(msgs, "names HOME") {
+		t.Fatalf("set passthrough var warned:\n%s", msgs)
+	}
+	g.Attrs["hermetic_env"] = "false"
+	if msgs := diagnosticMessages(ValidateGraph(g)); strings.Contains(msgs, "HERMETIC_TEST_UNSET") {
+		t.Fatalf("non-hermetic graph warned about passthrough:\n%s", msgs)
+	}
+}
@@ -0,0 +1,142 @@
+package attractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// inheritableAttrPrefixes name the attribute families a graph-level value
+// provides as the default for nodes that do not set them. Resolution order is
+// node attr > graph attr > env var > built-in default.
+var inheritableAttrPrefixes = []string{"codex.", "verification.", "agent."}
+
+// nonInheritableAttrs are per-node by nature even though they share a prefix.
+var nonInheritableAttrs = map[string]bool{"agent.replay_response": true}
+
+func isInheritableAttr(key string) bool {
+	if nonInheritableAttrs[key] {
+		return false
+	}
+	for _, p := range inheritableAttrPrefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAttr returns the node's own value for key, else the graph-level
+// default when key is inheritable.
+func resolveAttr(node *Node, g *Graph, key string) (Value, bool) {
+	if node != nil {
+		if v, ok := node.Attrs[key]; ok {
+			return v, true
+		}
+	}
+	if g != nil && isInheritableAttr(key) {
+		if v, ok := g.Attrs[key]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// applyGraphAttrDefaults copies inheritable graph attributes onto every node
+// that does not set them, so handlers and agent resolution read one place.
+// It runs after validation so graph-level errors are reported once.
+func applyGraphAttrDefaults(g *Graph) {
+	keys := inheritedGraphAttrKeys(g)
+	for _, n := range g.Nodes {
+		for _, k := range keys {
+			if v, ok := resolveAttr(n, g, k); ok {
+				n.Attrs[k] = v
+			}
+		}
+	}
+}
+
+func inheritedGraphAttrKeys(g *Graph) []string {
+	keys := []string{}
+	for k := range g.Attrs {
+		if isInheritableAttr(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateGraphAttrDefaults applies the node-level rules to graph-level
+// defaults.
+func validateGraphAttrDefaults(g *Graph) []Diagnostic {
+	if len(inheritedGraphAttrKeys(g)) == 0 {
+		return nil
+	}
+	probe := &Node{ID: "graph", Attrs: map[string]Value{}}
+	for _, k := range inheritedGraphAttrKeys(g) {
+		probe.Attrs[k] = g.Attrs[k]
+	}
+	d := []Diagnostic{}
+	for _, err := range inheritableAttrErrors(probe) {
+		d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("graph attribute default: %v", err)})
+	}
+	return d
+}
+
+// inheritableAttrErrors checks codex.*, verification.*, and agent.* values
+// that can be validated without a workspace.
+func inheritableAttrErrors(n *Node) []error {
+	errs := []error{}
+	if _, err := parseCommandAllowlist(splitCSV(n.StringAttr("verification.allowed_commands", ""))); err != nil {
+		errs = append(errs, err)
+	}
+	if p := strings.TrimSpace(n.StringAttr("verification.workdir", "")); p != "" {
+		if err := checkRelativeAttrPath("verification.workdir", p, false); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if v := strings.TrimSpace(n.StringAttr("verification.always_rerun", "")); v != "" && v != "true" && v != "false" {
+		errs = append(errs, fmt.Errorf("invalid verification.always_rerun %q (expected true or false)", v))
+	}
+	if _, err := parseInputGlobs(n, "verification.cache_inputs"); err != nil {
+		errs = append(errs, err)
+	}
+	if p := strings.TrimSpace(n.StringAttr("codex.workdir", "")); p != "" {
+		if err := checkRelativeAttrPath("codex.workdir", p, true); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, p := range splitCSV(n.StringAttr("codex.add_dirs", "")) {
+		if err := checkRelativeAttrPath("codex.add_dirs", p, true); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := validateRelativePaths(splitCSV(n.StringAttr("codex.block_read_paths", ""))); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := nodeContextUpdateKeys(n); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// checkRelativeAttrPath mirrors resolveDir/resolveVerificationWorkdir: no ~
+// and no parent segments; absolute paths only where the runtime accepts them.
+func checkRelativeAttrPath(key, p string, allowAbs bool) error {
+	if strings.HasPrefix(p, "/") {
+		if allowAbs {
+			return nil
+		}
+		return fmt.Errorf("%s must be relative: %s", key, p)
+	}
+	if strings.Contains(p, "~") {
+		return fmt.Errorf("%s %q contains unsupported ~", key, p)
+	}
+	for _, seg := range strings.Split(strings.ReplaceAll(p, "\\", "/"), "/") {
+		if seg == ".." {
+			return fmt.Errorf("%s %q contains parent segment", key, p)
+		}
+	}
+	return nil
+}
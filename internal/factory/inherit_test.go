@@ -0,0 +1,108 @@
+package attractor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGraphAttrDefaultsPrecedence(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	graph ["codex.model"="graph-model", "codex.timeout_seconds"=30, "codex.disable_mcp"=true, "codex.sandbox"="read-only"];
+	own [shape=box, "codex.model"="node-model", "codex.disable_mcp"=false];
+	inherits [shape=box];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyGraphAttrDefaults(g)
+	t.Setenv("ATTRACTOR_CODEX_MODEL", "env-model")
+	t.Setenv("ATTRACTOR_CODEX_DISABLE_MCP", "true")
+	t.Setenv("ATTRACTOR_CODEX_PROFILE", "env-profile")
+	workspace := t.TempDir()
+
+	own, err := codexOptionsFromNodeAndEnv(g.Nodes["own"], workspace, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if own.Model != "node-model" {
+		t.Fatalf("node attr should win, got %q", own.Model)
+	}
+	if own.DisableMCP {
+		t.Fatal("explicit node false should override graph default and env")
+	}
+
+	inherited, err := codexOptionsFromNodeAndEnv(g.Nodes["inherits"], workspace, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inherited.Model != "graph-model" || inherited.TimeoutSeconds != 30 || inherited.SandboxMode != "read-only" {
+		t.Fatalf("graph default should beat env, got model=%q timeout=%d sandbox=%q", inherited.Model, inherited.TimeoutSeconds, inherited.SandboxMode)
+	}
+	if inherited.Profile != "env-profile" {
+		t.Fatalf("env should apply when neither node nor graph sets it, got %q", inherited.Profile)
+	}
+	if inherited.HeartbeatSeconds != 15 {
+		t.Fatalf("built-in default should apply last, got %d", inherited.HeartbeatSeconds)
+	}
+}
+
+func TestGraphAttrDefaultsSkipNonInheritableKeys(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	graph ["agent.replay_response"="x.md", goal="ship", "codex.model"="m"];
+	a [shape=box];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applyGraphAttrDefaults(g)
+	a := g.Nodes["a"]
+	if _, ok := a.Attrs["agent.replay_response"]; ok {
+		t.Fatal("agent.replay_response must stay per-node")
+	}
+	if _, ok := a.Attrs["goal"]; ok {
+		t.Fatal("non-prefixed graph attrs must not be inherited")
+	}
+	if a.StringAttr("codex.model", "") != "m" {
+		t.Fatal("codex.model should be inherited")
+	}
+}
+
+func TestGraphLevelVerificationAllowlistApplies(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	graph ["verification.allowed_commands"="test -f"];
+	start [shape=Mdiamond];
+	plan [shape=box, "test.verification_plan_json"="{\"files\":[\"a.txt\"],\"commands\":[\"test -f a.txt\"]}"];
+	verify [shape=parallelogram, type=verification];
+	exit [shape=Msquare];
+	start -> plan;
+	plan -> verify;
+	verify -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "a.txt"), "x")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "inh1"}); err != nil {
+		t.Fatal(err)
+	}
+	st := readStatusJSON(t, filepath.Join(runsdir, "inh1", "verify", "status.json"))
+	if st["outcome"] != "success" {
+		t.Fatalf("verification should use the graph-level allowlist, got %v (%v)", st["outcome"], st["failure_reason"])
+	}
+}
+
+func TestValidateGraphChecksGraphLevelDefaults(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	graph ["codex.workdir"="../outside", "verification.allowed_commands"="test -f <bogus>"];
+	start [shape=Mdiamond];
+	exit [shape=Msquare];
+	start -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	if !strings.Contains(msgs, "graph attribute default: codex.workdir") || !strings.Contains(msgs, "graph attribute default: invalid verification.allowed_commands") {
+		t.Fatalf("expected graph-level validation errors, got:\n%s", msgs)
+	}
+}
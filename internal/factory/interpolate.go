@@ -0,0 +1,220 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// attrRef is one ${graph.<attr>}, ${param.<name>}, or
+// ${artifact.<node>.<name>} reference in a node attribute value.
+type attrRef struct {
+	Namespace string
+	Name      string
+}
+
+// interpolateAttr replaces ${graph.<attr>}, ${param.<name>}, and
+// ${artifact.<node>.<name>} references using lookup and turns the $${
+// escape into a literal ${. Other ${...} text is left alone so shell and
+// verification placeholders keep working.
+func interpolateAttr(s string, lookup func(attrRef) (string, bool)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "$${") {
+			b.WriteString("${")
+			i += 3
+			continue
+		}
+		ns := ""
+		for _, prefix := range []string{"graph", "param", "artifact"} {
+			if strings.HasPrefix(s[i:], "${"+prefix+".") {
+				ns = prefix
+			}
+		}
+		if ns == "" {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		start := i + len("${"+ns+".")
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${%s. reference", ns)
+		}
+		ref := attrRef{Namespace: ns, Name: s[start : start+end]}
+		if ref.Name == "" {
+			return "", fmt.Errorf("empty ${%s.} reference", ns)
+		}
+		if lookup != nil {
+			v, ok := lookup(ref)
+			if !ok {
+				return "", fmt.Errorf("unknown %s reference: %s", ns, ref.Name)
+			}
+			b.WriteString(v)
+		}
+		i = start + end + 1
+	}
+	return b.String(), nil
+}
+
+// attrRefs lists the interpolation references in s.
+func attrRefs(s string) ([]attrRef, error) {
+	refs := []attrRef{}
+	_, err := interpolateAttr(s, func(r attrRef) (string, bool) {
+		refs = append(refs, r)
+		return "", true
+	})
+	return refs, err
+}
+
+// pipelineParams merges graph-level `param.<name>` defaults with run-time
+// params, which win.
+func pipelineParams(g *Graph, params map[string]string) map[string]string {
+	out := map[string]string{}
+	for k, v := range g.Attrs {
+		if name, ok := strings.CutPrefix(k, "param."); ok && name != "" {
+			out[name] = fmt.Sprintf("%v", v)
+		}
+	}
+	for k, v := range params {
+		out[k] = v
+	}
+	return out
+}
+
+// validateInterpolation checks that every ${graph.<attr>} reference names a
+// graph attribute, that every ${artifact.<node>.<name>} names an artifact an
+// ancestor produces, and that references are well formed. ${param.<name>} is
+// checked against the run's params by checkPipelineParams.
+func validateInterpolation(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	for _, id := range sortedKeys(g.Nodes) {
+		n := g.Nodes[id]
+		var ancestors map[string]bool
+		for _, k := range sortedKeys(n.Attrs) {
+			s, ok := n.Attrs[k].(string)
+			if !ok {
+				continue
+			}
+			refs, err := attrRefs(s)
+			if err != nil {
+				d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s attr %s: %v", id, k, err)})
+				continue
+			}
+			for _, r := range refs {
+				if _, ok := g.Attrs[r.Name]; r.Namespace == "graph" && !ok {
+					d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s attr %s references unknown graph attr: %s", id, k, r.Name)})
+				}
+				if r.Namespace == "artifact" {
+					if ancestors == nil {
+						ancestors = graphAncestors(g, id)
+					}
+					if problem := artifactRefProblem(g, r.Name, ancestors); problem != "" {
+						d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s attr %s %s", id, k, problem)})
+					}
+				}
+			}
+		}
+	}
+	return d
+}
+
+// checkPipelineParams fails when a node references a param that has neither a
+// run-time value nor a graph-level default.
+func checkPipelineParams(g *Graph, params map[string]string) error {
+	missing := map[string]bool{}
+	for _, n := range g.Nodes {
+		for _, v := range n.Attrs {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			refs, _ := attrRefs(s)
+			for _, r := range refs {
+				if _, ok := params[r.Name]; r.Namespace == "param" && !ok {
+					missing[r.Name] = true
+				}
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("missing pipeline params: %s (pass --param <name>=<value> or set graph attr param.<name>)", strings.Join(sortedKeys(missing), ","))
+}
+
+// resolveNode returns a copy of node with graph, param, and artifact
+// references in its string attributes resolved. The copy is what handlers,
+// guardrail checks, and traces see. Artifact references that cannot be
+// resolved yet are left empty and reported as an *artifactMissingError
+// alongside the copy.
+func (e *Engine) resolveNode(node *Node) (*Node, error) {
+	var missing []string
+	lookup := func(r attrRef) (string, bool) {
+		if r.Namespace == "artifact" {
+			path, problem := e.lookupArtifact(r.Name)
+			if problem != "" {
+				missing = append(missing, problem)
+			}
+			return path, true
+		}
+		if r.Namespace == "param" {
+			v, ok := e.params[r.Name]
+			return v, ok
+		}
+		v, ok := e.Graph.Attrs[r.Name]
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("%v", v), true
+	}
+	attrs := make(map[string]Value, len(node.Attrs))
+	for k, v := range node.Attrs {
+		if s, ok := v.(string); ok {
+			resolved, err := interpolateAttr(s, lookup)
+			if err != nil {
+				return nil, fmt.Errorf("node %s attr %s: %w", node.ID, k, err)
+			}
+			v = resolved
+		}
+		attrs[k] = v
+	}
+	resolved := &Node{ID: node.ID, Attrs: attrs}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return resolved, &artifactMissingError{Reasons: uniqueNonEmpty(missing)}
+	}
+	return resolved, nil
+}
+
+// ParseParamFlag parses a --param value of the form name=value.
+func ParseParamFlag(raw string) (string, string, error) {
+	name, value, ok := strings.Cut(raw, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || !idRe.MatchString(name) {
+		return "", "", fmt.Errorf("invalid --param %q: expected name=value", raw)
+	}
+	return name, value, nil
+}
+
+// readManifestParams returns the params recorded for a run, so a resume
+// resolves references the same way the original run did.
+func readManifestParams(runDir string) (map[string]string, error) {
+	var m struct {
+		Params map[string]string `json:"params"`
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest in %s: %w", runDir, err)
+	}
+	return m.Params, nil
+}
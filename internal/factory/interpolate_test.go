@@ -0,0 +1,124 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateAttr(t *testing.T) {
+	lookup := func(r attrRef) (string, bool) {
+		v, ok := map[string]string{"graph.goal": "ship it", "param.env": "staging"}[r.Namespace+"."+r.Name]
+		return v, ok
+	}
+	cases := map[string]string{
+		"run.sh --goal '${graph.goal}' --env ${param.env}": "run.sh --goal 'ship it' --env staging",
+		"echo $${graph.goal} costs $$5":                    "echo ${graph.goal} costs $$5",
+		"cd ${PWD} && echo ${HOME}":                        "cd ${PWD} && echo ${HOME}",
+	}
+	for in, want := range cases {
+		got, err := interpolateAttr(in, lookup)
+		if err != nil || got != want {
+			t.Fatalf("interpolateAttr(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for in, want := range map[string]string{
+		"${graph.goal":    "unterminated ${graph. reference",
+		"${param.}":       "empty ${param.} reference",
+		"${param.region}": "unknown param reference: region",
+	} {
+		if _, err := interpolateAttr(in, lookup); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("interpolateAttr(%q) err = %v, want %q", in, err, want)
+		}
+	}
+}
+
+func TestValidateInterpolationReferences(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	graph [goal="x"];
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="echo ${graph.goal} ${graph.target} ${param.anything}"];
+	b [shape=parallelogram, tool_command="echo ${graph.goal"];
+	exit [shape=Msquare];
+	start -> a -> b -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{"node a attr tool_command references unknown graph attr: target", "node b attr tool_command: unterminated ${graph. reference"} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+	if strings.Contains(msgs, "unknown graph attr: goal") || strings.Contains(msgs, "param") {
+		t.Fatalf("graph.goal reported as unknown:\n%s", msgs)
+	}
+}
+
+func TestToolCommandAndTracesUseResolvedAttrs(t *testing.T) {
+	dot := `digraph G {
+	graph [goal="build the cli", out_dir="out", "param.env"="dev"];
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="mkdir -p ${graph.out_dir} && echo '${graph.goal} ${param.env} $${literal}' > ${graph.out_dir}/goal.txt"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ip1", Params: map[string]string{"env": "prod"}}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ip1")
+	b, err := os.ReadFile(filepath.Join(runDir, "workspace", "out", "goal.txt"))
+	if err != nil || string(b) != "build the cli prod ${literal}\n" {
+		t.Fatalf("goal.txt = %q (%v)", b, err)
+	}
+	for _, rec := range readJSONLRecords(t, filepath.Join(runDir, "trace.jsonl")) {
+		if rec["type"] == "NodeInputCaptured" && rec["node_id"] == "t" {
+			cmd := rec["node_attrs"].(map[string]any)["tool_command"].(string)
+			if strings.Contains(cmd, "${graph.") || !strings.Contains(cmd, "prod") {
+				t.Fatalf("traced tool_command not resolved: %q", cmd)
+			}
+		}
+	}
+	if p, err := readManifestParams(runDir); err != nil || p["env"] != "prod" {
+		t.Fatalf("manifest params = %v (%v)", p, err)
+	}
+}
+
+func TestResolvedToolCommandIsGuardrailChecked(t *testing.T) {
+	dot := `digraph G {
+	graph [target="../secret"];
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="cat ${graph.target}"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ip2"})
+	st := readStatusJSON(t, filepath.Join(runsdir, "ip2", "t", "status.json"))
+	if st["failure_code"] != string(FailureToolCommandRejected) {
+		t.Fatalf("status = %v", st)
+	}
+}
+
+func TestMissingParamFailsBeforeRun(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="echo ${param.region}"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ip3"})
+	if err == nil || !strings.Contains(err.Error(), "missing pipeline params: region") {
+		t.Fatalf("err = %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(runsdir, "ip3", "t")); !os.IsNotExist(statErr) {
+		t.Fatalf("node ran despite missing param (%v)", statErr)
+	}
+}
@@ -0,0 +1,182 @@
+package attractor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ValidationRule is one check ValidateGraph runs. Default rules run unless
+// the graph lists them in lint_disable; opt-in rules run only when it lists
+// them in lint_enable. Diagnostics a rule returns without a Rule get its ID.
+type ValidationRule struct {
+	ID          string
+	Description string
+	Default     bool
+	Check       func(*Graph) []Diagnostic
+}
+
+// coreRuleID is the built-in structural and attribute checks. The engine
+// depends on them, so lint_disable cannot turn them off.
+const coreRuleID = "core"
+
+const defaultLintPromptMaxBytes = 8 << 10
+
+var (
+	snakeCaseRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+	validationRulesMu sync.RWMutex
+	registeredRules   = map[string]ValidationRule{}
+)
+
+func builtinValidationRules() []ValidationRule {
+	return []ValidationRule{
+		{ID: coreRuleID, Description: "graph structure, reachability, and node attribute checks", Default: true, Check: validateCore},
+		{ID: "codergen_write_paths", Description: "every codergen node sets allowed_write_paths", Check: lintCodergenWritePaths},
+		{ID: "tool_fail_edge", Description: "every tool node has an outgoing outcome=fail edge", Check: lintToolFailEdge},
+		{ID: "prompt_max_bytes", Description: "prompts are at most lint.prompt_max_bytes (default 8KB)", Check: lintPromptMaxBytes},
+		{ID: "snake_case_ids", Description: "node ids are snake_case", Check: lintSnakeCaseIDs},
+		{ID: "group_required_attrs", Description: "members of each group set the graph's group.<name>.required_attrs", Default: true, Check: lintGroupRequiredAttrs},
+		{ID: "route_coverage", Description: "every executable node has an edge that takes outcome=fail", Check: lintRouteCoverage},
+	}
+}
+
+// RegisterValidationRule adds a rule to every later ValidateGraph call. IDs
+// are snake_case and must not repeat a built-in or registered rule.
+func RegisterValidationRule(r ValidationRule) error {
+	if !snakeCaseRe.MatchString(r.ID) {
+		return fmt.Errorf("invalid validation rule id %q (expected snake_case)", r.ID)
+	}
+	if r.Check == nil {
+		return fmt.Errorf("validation rule %s has no Check", r.ID)
+	}
+	validationRulesMu.Lock()
+	defer validationRulesMu.Unlock()
+	for _, b := range builtinValidationRules() {
+		if b.ID == r.ID {
+			return fmt.Errorf("validation rule %s is already registered", r.ID)
+		}
+	}
+	if _, ok := registeredRules[r.ID]; ok {
+		return fmt.Errorf("validation rule %s is already registered", r.ID)
+	}
+	registeredRules[r.ID] = r
+	return nil
+}
+
+// ValidationRules lists the built-in and registered rules by ID.
+func ValidationRules() []ValidationRule {
+	rules := builtinValidationRules()
+	validationRulesMu.RLock()
+	for _, r := range registeredRules {
+		rules = append(rules, r)
+	}
+	validationRulesMu.RUnlock()
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// runValidationRules runs the rules selected by the graph's lint_disable
+// and lint_enable and tags each diagnostic with its rule.
+func runValidationRules(g *Graph) []Diagnostic {
+	rules := ValidationRules()
+	known := map[string]bool{}
+	for _, r := range rules {
+		known[r.ID] = true
+	}
+	d := []Diagnostic{}
+	selected := map[string]map[string]bool{}
+	for _, key := range []string{"lint_disable", "lint_enable"} {
+		selected[key] = map[string]bool{}
+		raw, ok := g.Attrs[key]
+		if !ok {
+			continue
+		}
+		for _, id := range splitCSV(fmt.Sprintf("%v", raw)) {
+			id = strings.TrimSpace(id)
+			switch {
+			case key == "lint_disable" && id == coreRuleID:
+				d = append(d, Diagnostic{Level: "ERROR", Rule: coreRuleID, Message: "graph lint_disable cannot disable rule core"})
+			case !known[id]:
+				d = append(d, Diagnostic{Level: "WARN", Rule: coreRuleID, Message: fmt.Sprintf("graph %s names unknown rule %s", key, id)})
+			}
+			selected[key][id] = true
+		}
+	}
+	for _, r := range rules {
+		run := r.Default && !selected["lint_disable"][r.ID]
+		if !r.Default {
+			run = selected["lint_enable"][r.ID]
+		}
+		if r.ID != coreRuleID && !run {
+			continue
+		}
+		for _, diag := range r.Check(g) {
+			if diag.Rule == "" {
+				diag.Rule = r.ID
+			}
+			d = append(d, diag)
+		}
+	}
+	return d
+}
+
+func lintCodergenWritePaths(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	for _, id := range sortedKeys(g.Nodes) {
+		n := g.Nodes[id]
+		if handlerType(n) != "codergen" {
+			continue
+		}
+		if v, ok := resolveAttr(n, g, "allowed_write_paths"); !ok || strings.TrimSpace(fmt.Sprintf("%v", v)) == "" {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: codergen nodes must set allowed_write_paths", id)})
+		}
+	}
+	return d
+}
+
+func lintToolFailEdge(g *Graph) []Diagnostic {
+	handled := map[string]bool{}
+	for _, e := range g.Edges {
+		if c, err := parseCondition(strings.TrimSpace(e.StringAttr("condition", ""))); err == nil && c.Outcome == "fail" {
+			handled[e.From] = true
+		}
+	}
+	d := []Diagnostic{}
+	for _, id := range sortedKeys(g.Nodes) {
+		if handlerType(g.Nodes[id]) == "tool" && !handled[id] {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: tool nodes must have an outcome=fail edge", id)})
+		}
+	}
+	return d
+}
+
+func lintPromptMaxBytes(g *Graph) []Diagnostic {
+	limit := uint64(defaultLintPromptMaxBytes)
+	if raw, ok := g.Attrs["lint.prompt_max_bytes"]; ok {
+		b, err := parseByteSize(strings.TrimSpace(fmt.Sprintf("%v", raw)))
+		if err != nil || b == 0 {
+			return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("graph has invalid lint.prompt_max_bytes %v (expected a positive size such as 8KB)", raw)}}
+		}
+		limit = b
+	}
+	d := []Diagnostic{}
+	for _, id := range sortedKeys(g.Nodes) {
+		if n := len(g.Nodes[id].StringAttr("prompt", "")); uint64(n) > limit {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: prompt is %d bytes, over the %d byte limit", id, n, limit)})
+		}
+	}
+	return d
+}
+
+func lintSnakeCaseIDs(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	for _, id := range sortedKeys(g.Nodes) {
+		if !snakeCaseRe.MatchString(id) {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node id %s is not snake_case", id)})
+		}
+	}
+	return d
+}
@@ -0,0 +1,79 @@
+package attractor
+
+import (
+	"strings"
+	"testing"
+)
+
+func lintDiagnostics(t *testing.T, dot string) []string {
+	t.Helper()
+	g, err := ParseDOT(dot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := []string{}
+	for _, d := range ValidateGraph(g) {
+		out = append(out, d.Level+" ["+d.Rule+"] "+d.Message)
+	}
+	return out
+}
+
+func TestOptInLintRules(t *testing.T) {
+	dot := `digraph G {
+	graph [lint_enable="codergen_write_paths,tool_fail_edge,prompt_max_bytes,snake_case_ids", "lint.prompt_max_bytes"=16];
+	start [shape=Mdiamond];
+	Plan [shape=box, prompt="a prompt longer than sixteen bytes"];
+	fix [shape=box, prompt="fix", allowed_write_paths="src/"];
+	test [shape=parallelogram, tool_command="true"];
+	lint [shape=parallelogram, tool_command="true"];
+	exit [shape=Msquare];
+	start -> Plan -> test;
+	test -> lint [condition="outcome=success"];
+	test -> fix [condition="outcome=fail"];
+	fix -> test;
+	lint -> exit;
+	}`
+	want := []string{
+		"ERROR [codergen_write_paths] node Plan: codergen nodes must set allowed_write_paths",
+		"ERROR [prompt_max_bytes] node Plan: prompt is 34 bytes, over the 16 byte limit",
+		"ERROR [snake_case_ids] node id Plan is not snake_case",
+		"ERROR [tool_fail_edge] node lint: tool nodes must have an outcome=fail edge",
+	}
+	if got := lintDiagnostics(t, dot); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("diagnostics:\n%s", strings.Join(got, "\n"))
+	}
+	// The same graph without lint_enable only runs the default rules.
+	if got := lintDiagnostics(t, strings.Replace(dot, `lint_enable=`, `lint_enable_off=`, 1)); len(got) != 0 {
+		t.Fatalf("default diagnostics:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestRegisterValidationRuleAndLintDisable(t *testing.T) {
+	rule := ValidationRule{ID: "house_rule_test", Default: true, Check: func(g *Graph) []Diagnostic {
+		return []Diagnostic{{Level: "WARN", Message: "house rule ran"}}
+	}}
+	if err := RegisterValidationRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		validationRulesMu.Lock()
+		delete(registeredRules, rule.ID)
+		validationRulesMu.Unlock()
+	})
+	for _, bad := range []ValidationRule{rule, {ID: "core", Check: rule.Check}, {ID: "HouseRule", Check: rule.Check}, {ID: "no_check"}} {
+		if err := RegisterValidationRule(bad); err == nil {
+			t.Fatalf("RegisterValidationRule(%s) succeeded", bad.ID)
+		}
+	}
+	base := `digraph G { %s start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }`
+	if got := lintDiagnostics(t, strings.Replace(base, "%s", "", 1)); strings.Join(got, "\n") != "WARN [house_rule_test] house rule ran" {
+		t.Fatalf("diagnostics: %v", got)
+	}
+	if got := lintDiagnostics(t, strings.Replace(base, "%s", `graph [lint_disable="house_rule_test"];`, 1)); len(got) != 0 {
+		t.Fatalf("disabled diagnostics: %v", got)
+	}
+	want := "ERROR [core] graph lint_disable cannot disable rule core\nWARN [core] graph lint_disable names unknown rule nope"
+	if got := lintDiagnostics(t, strings.Replace(base, "%s", `graph [lint_disable="core,nope,house_rule_test"];`, 1)); strings.Join(got, "\n") != want {
+		t.Fatalf("diagnostics:\n%s", strings.Join(got, "\n"))
+	}
+}
@@ -1,19 +1,37 @@
 package attractor
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
+// runLogFile is the default RunConfig.LogFile, relative to the run dir.
+const runLogFile = "run.log"
+
 func newFactoryLogger() *slog.Logger {
-	level := parseLogLevel(os.Getenv("FACTORY_LOG_LEVEL"))
+	return slog.New(stderrLogHandler())
+}
+
+// stderrLogHandler renders records on stderr as text, or as JSON with
+// FACTORY_LOG_FORMAT=json, at FACTORY_LOG_LEVEL.
+func stderrLogHandler() slog.Handler {
 	format := strings.ToLower(strings.TrimSpace(os.Getenv("FACTORY_LOG_FORMAT")))
-	opts := &slog.HandlerOptions{Level: level}
+	opts := factoryLogOptions()
 	if format == "json" {
-		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+		return slog.NewJSONHandler(os.Stderr, opts)
 	}
-	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+	return slog.NewTextHandler(os.Stderr, opts)
+}
+
+func factoryLogOptions() *slog.HandlerOptions {
+	return &slog.HandlerOptions{Level: parseLogLevel(os.Getenv("FACTORY_LOG_LEVEL"))}
 }
 
 func parseLogLevel(raw string) slog.Level {
@@ -28,3 +46,152 @@ func parseLogLevel(raw string) slog.Level {
 		return slog.LevelInfo
 	}
 }
+
+// fanoutHandler sends each record to every handler that accepts its level.
+// With no handlers it discards everything (RunConfig.Quiet before the run
+// log is open).
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, child := range h {
+		if child.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, child := range h {
+		if child.Enabled(ctx, r.Level) {
+			errs = append(errs, child.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanoutHandler, len(h))
+	for i, child := range h {
+		out[i] = child.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	out := make(fanoutHandler, len(h))
+	for i, child := range h {
+		out[i] = child.WithGroup(name)
+	}
+	return out
+}
+
+// newConsoleLogger is the logger RunPipeline uses until the run log is open:
+// stderr, or nothing when quiet.
+func newConsoleLogger(quiet bool) *slog.Logger {
+	if quiet {
+		return slog.New(fanoutHandler{})
+	}
+	return newFactoryLogger()
+}
+
+// runLog is the buffered JSON log file a run writes next to its artifacts.
+// Records at ERROR are flushed immediately; the rest when the buffer fills or
+// the run ends.
+type runLog struct {
+	mu   sync.Mutex
+	f    *os.File
+	w    *bufio.Writer
+	path string
+}
+
+// openRunLog appends to path (runDir/run.log when empty), so a resume keeps
+// the earlier attempts' records.
+func openRunLog(runDir, path string) (*runLog, error) {
+	if path == "" {
+		path = filepath.Join(runDir, runLogFile)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(abs, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &runLog{f: f, w: bufio.NewWriter(f), path: abs}, nil
+}
+
+// Write buffers p. Records logged after close, e.g. through slog.Default
+// once RunPipeline returned, are dropped.
+func (l *runLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return len(p), nil
+	}
+	return l.w.Write(p)
+}
+
+func (l *runLog) flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	return l.w.Flush()
+}
+
+// close flushes and closes the file. It is safe to call more than once.
+func (l *runLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := errors.Join(l.w.Flush(), l.f.Close())
+	l.f = nil
+	return err
+}
+
+// handler renders records as JSON into the file at the factory log level.
+func (l *runLog) handler() slog.Handler {
+	return flushOnErrorHandler{Handler: slog.NewJSONHandler(io.Writer(l), factoryLogOptions()), log: l}
+}
+
+// runLogger combines the console handler (unless quiet) with the run log.
+func (l *runLog) runLogger(quiet bool) *slog.Logger {
+	if quiet {
+		return slog.New(fanoutHandler{l.handler()})
+	}
+	return slog.New(fanoutHandler{stderrLogHandler(), l.handler()})
+}
+
+// flushOnErrorHandler flushes the run log after ERROR records, so the reason
+// a run died is on disk even if the process is killed before close.
+type flushOnErrorHandler struct {
+	slog.Handler
+	log *runLog
+}
+
+func (h flushOnErrorHandler) Handle(ctx context.Context, r slog.Record) error {
+	if err := h.Handler.Handle(ctx, r); err != nil {
+		return err
+	}
+	if r.Level >= slog.LevelError {
+		return h.log.flush()
+	}
+	return nil
+}
+
+func (h flushOnErrorHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return flushOnErrorHandler{Handler: h.Handler.WithAttrs(attrs), log: h.log}
+}
+
+func (h flushOnErrorHandler) WithGroup(name string) slog.Handler {
+	return flushOnErrorHandler{Handler: h.Handler.WithGroup(name), log: h.log}
+}
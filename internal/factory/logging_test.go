@@ -0,0 +1,75 @@
+package attractor
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunLogRecordsEveryStageInRunDir(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a; a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "log1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "log1")
+	recs := readJSONLRecords(t, filepath.Join(runDir, runLogFile))
+	started := 0
+	for _, rec := range recs {
+		if rec["msg"] == "stage started" {
+			started++
+		}
+	}
+	if started != 3 {
+		t.Fatalf("run.log has %d stage started records, want 3: %v", started, recs)
+	}
+	var manifest map[string]any
+	b, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest["log_file"] != filepath.Join(runDir, runLogFile) {
+		t.Fatalf("manifest log_file = %v", manifest["log_file"])
+	}
+}
+
+func TestQuietRunLogsOnlyToLogFileAndFlushesOnError(t *testing.T) {
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=parallelogram, tool_command="exit 1"]; exit [shape=Msquare]; start -> a; a -> exit [condition="outcome=success"]; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	logFile := filepath.Join(t.TempDir(), "logs", "factory.log")
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	runErr := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "log2", LogFile: logFile, Quiet: true})
+	os.Stderr = stderr
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if runErr == nil || !strings.Contains(runErr.Error(), "no route from node a") {
+		t.Fatalf("expected routing error, got %v", runErr)
+	}
+	if len(out) != 0 {
+		t.Fatalf("quiet run wrote to stderr: %s", out)
+	}
+	if _, err := os.Stat(filepath.Join(runsdir, "log2", runLogFile)); !os.IsNotExist(err) {
+		t.Fatalf("default run.log written despite --log-file: %v", err)
+	}
+	failed := false
+	for _, rec := range readJSONLRecords(t, logFile) {
+		if rec["msg"] == "stage failed" && rec["node"] == "a" {
+			failed = true
+		}
+	}
+	if !failed {
+		t.Fatal("log file is missing the stage failure")
+	}
+}
@@ -0,0 +1,234 @@
+package attractor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultLogsPollInterval = 500 * time.Millisecond
+
+// logStreams are the per-node artifact files tailed while a stage runs.
+var logStreams = []string{"tool.stdout.txt", "tool.stderr.txt", "codex.stdout.log", "codex.stderr.log"}
+
+// LogsOptions configures RunLogs.
+type LogsOptions struct {
+	// Node restricts output to one node's events and streams.
+	Node string
+	// Since drops events before this time and streams of stages that
+	// finished before it.
+	Since time.Time
+	// Follow keeps polling until the pipeline finishes or ctx is cancelled.
+	Follow       bool
+	PollInterval time.Duration
+}
+
+// ParseLogsSince accepts a duration relative to now ("10m") or an RFC3339
+// timestamp.
+func ParseLogsSince(raw string, now time.Time) (time.Time, error) {
+	return ParseTimeFlag("--since", raw, now)
+}
+
+// ParseTimeFlag parses a time flag given as a duration before now ("10m") or
+// an RFC3339 timestamp; name is used in the error.
+func ParseTimeFlag(name, raw string, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(raw); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q: expected a duration (10m) or RFC3339 time", name, raw)
+	}
+	return t, nil
+}
+
+// fileFollower reads a file incrementally by offset. It polls instead of
+// using filesystem notifications so it also works on NFS, and treats a
+// missing file as empty.
+type fileFollower struct {
+	path    string
+	offset  int64
+	partial []byte
+}
+
+// next returns complete lines appended since the last call. With flush, a
+// trailing partial line is returned too.
+func (f *fileFollower) next(flush bool) ([]string, error) {
+	fh, err := os.Open(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fh.Close()
+	if info, err := fh.Stat(); err == nil && info.Size() < f.offset {
+		f.offset = 0
+		f.partial = nil
+	}
+	if _, err := fh.Seek(f.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(fh)
+	if err != nil {
+		return nil, err
+	}
+	f.offset += int64(len(b))
+	buf := append(f.partial, b...)
+	f.partial = nil
+	lines := []string{}
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, strings.TrimRight(string(buf[:i]), "\r"))
+		buf = buf[i+1:]
+	}
+	if len(buf) > 0 {
+		if flush {
+			lines = append(lines, string(buf))
+		} else {
+			f.partial = append([]byte(nil), buf...)
+		}
+	}
+	return lines, nil
+}
+
+type nodeStreams struct {
+	followers []*fileFollower
+}
+
+// RunLogs writes events.jsonl stage transitions and the artifact streams of
+// running nodes to w, each line prefixed with "[<node> <stream>]".
+func RunLogs(ctx context.Context, runDir string, opts LogsOptions, w io.Writer) error {
+	if _, err := os.Stat(runDir); err != nil {
+		return err
+	}
+	if err := checkRunLayout(runDir); err != nil {
+		return err
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultLogsPollInterval
+	}
+	events := &fileFollower{path: filepath.Join(runDir, eventsFile)}
+	active := map[string]*nodeStreams{}
+	for {
+		lines, err := events.next(false)
+		if err != nil {
+			return err
+		}
+		done := false
+		for _, line := range lines {
+			ev, err := decodeEventLine([]byte(line))
+			if err != nil {
+				continue
+			}
+			typ, _ := ev["type"].(string)
+			nodeID, _ := ev["node_id"].(string)
+			at, _ := time.Parse(time.RFC3339Nano, fmt.Sprintf("%v", ev["at"]))
+			if opts.Node == "" || nodeID == opts.Node {
+				if opts.Since.IsZero() || !at.Before(opts.Since) {
+					if err := writeLogLine(w, nodeID, "events", formatLogEvent(typ, ev)); err != nil {
+						return err
+					}
+				}
+			}
+			switch typ {
+			case "StageStarted":
+				if nodeID != "" && (opts.Node == "" || nodeID == opts.Node) {
+					active[nodeID] = newNodeStreams(runDir, nodeID)
+				}
+			case "StageCompleted", "StageFailed":
+				s := active[nodeID]
+				if s == nil {
+					continue
+				}
+				delete(active, nodeID)
+				if !opts.Since.IsZero() && at.Before(opts.Since) {
+					continue
+				}
+				if err := s.drain(w, nodeID, true); err != nil {
+					return err
+				}
+			case "PipelineCompleted", "PipelineFailed", "PipelineAborted", "PipelineStopped":
+				done = true
+			}
+		}
+		for _, id := range sortedStreamIDs(active) {
+			if err := active[id].drain(w, id, !opts.Follow); err != nil {
+				return err
+			}
+		}
+		if !opts.Follow || done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func newNodeStreams(runDir, nodeID string) *nodeStreams {
+	dir := nodeArtifactDir(runDir, nodeID)
+	s := &nodeStreams{}
+	for _, name := range logStreams {
+		s.followers = append(s.followers, &fileFollower{path: filepath.Join(dir, name)})
+	}
+	return s
+}
+
+func (s *nodeStreams) drain(w io.Writer, nodeID string, flush bool) error {
+	for _, f := range s.followers {
+		lines, err := f.next(flush)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if err := writeLogLine(w, nodeID, filepath.Base(f.path), line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sortedStreamIDs(active map[string]*nodeStreams) []string {
+	ids := make([]string, 0, len(active))
+	for id := range active {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func writeLogLine(w io.Writer, nodeID, stream, text string) error {
+	if nodeID == "" {
+		nodeID = "run"
+	}
+	_, err := fmt.Fprintf(w, "[%s %s] %s\n", nodeID, stream, text)
+	return err
+}
+
+func formatLogEvent(typ string, ev map[string]any) string {
+	parts := []string{typ}
+	for _, k := range []string{"outcome", "failure_reason", "error", "retry_count", "iteration"} {
+		if v, ok := ev[k]; ok && fmt.Sprintf("%v", v) != "" {
+			parts = append(parts, fmt.Sprintf("%s=%v", k, v))
+		}
+	}
+	return strings.Join(parts, " ")
+}
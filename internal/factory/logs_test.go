@@ -0,0 +1,176 @@
+package attractor
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func appendLine(t *testing.T, path, line string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(line); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunLogsPostHocMultiplexesStreams(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="true", "test.tool_stdout"="hello\nworld\n", "test.tool_stderr"="oops"];
+	u [shape=parallelogram, tool_command="true", "test.tool_stdout"="other\n"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> u;
+	u -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "lg1", FakeTools: true}); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := RunLogs(context.Background(), filepath.Join(runsdir, "lg1"), LogsOptions{}, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{"[run events] PipelineStarted", "[t events] StageStarted", "[t tool.stdout.txt] hello", "[t tool.stdout.txt] world", "[t tool.stderr.txt] oops", "[u tool.stdout.txt] other", "[t events] StageCompleted outcome=success", "[run events] PipelineCompleted"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "[t tool.stdout.txt] hello") > strings.Index(got, "[u events] StageStarted") {
+		t.Fatalf("expected t output before u started:\n%s", got)
+	}
+
+	out.Reset()
+	if err := RunLogs(context.Background(), filepath.Join(runsdir, "lg1"), LogsOptions{Node: "u"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); strings.Contains(got, "[t ") || strings.Contains(got, "[run ") || !strings.Contains(got, "[u tool.stdout.txt] other") {
+		t.Fatalf("unexpected --node output:\n%s", got)
+	}
+
+	out.Reset()
+	if err := RunLogs(context.Background(), filepath.Join(runsdir, "lg1"), LogsOptions{Since: time.Now().Add(time.Hour)}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing after --since in the future, got:\n%s", out.String())
+	}
+}
+
+func TestRunLogsFollowsGrowingFiles(t *testing.T) {
+	runDir := t.TempDir()
+	eventsPath := filepath.Join(runDir, "events.jsonl")
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() {
+		done <- RunLogs(context.Background(), runDir, LogsOptions{Follow: true, PollInterval: 5 * time.Millisecond}, out)
+	}()
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(out.String(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %q in:\n%s", want, out.String())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	now := func() string { return time.Now().UTC().Format(time.RFC3339Nano) }
+	// events.jsonl and the node's stream files do not exist yet.
+	time.Sleep(20 * time.Millisecond)
+	appendLine(t, eventsPath, `{"type":"StageStarted","node_id":"a","at":"`+now()+`"}`+"\n")
+	waitFor("[a events] StageStarted")
+	if err := os.MkdirAll(filepath.Join(runDir, "a"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	appendLine(t, filepath.Join(runDir, "a", "tool.stdout.txt"), "first\n")
+	waitFor("[a tool.stdout.txt] first")
+	appendLine(t, filepath.Join(runDir, "a", "tool.stdout.txt"), "second (no newline yet)")
+	time.Sleep(20 * time.Millisecond)
+	if strings.Contains(out.String(), "second") {
+		t.Fatal("partial line should wait for a newline while the stage runs")
+	}
+	appendLine(t, eventsPath, `{"type":"StageCompleted","node_id":"a","outcome":"success","at":"`+now()+`"}`+"\n")
+	appendLine(t, eventsPath, `{"type":"PipelineCompleted","at":"`+now()+`"}`+"\n")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("follow did not stop after PipelineCompleted")
+	}
+	if !strings.Contains(out.String(), "[a tool.stdout.txt] second (no newline yet)") {
+		t.Fatalf("expected partial line flushed when the stage finished:\n%s", out.String())
+	}
+}
+
+func TestParseLogsSince(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got, err := ParseLogsSince("10m", now); err != nil || !got.Equal(now.Add(-10*time.Minute)) {
+		t.Fatalf("duration: %v %v", got, err)
+	}
+	if got, err := ParseLogsSince("2026-01-02T03:00:00Z", now); err != nil || got.Minute() != 0 {
+		t.Fatalf("timestamp: %v %v", got, err)
+	}
+	if _, err := ParseLogsSince("yesterday", now); err == nil {
+		t.Fatal("expected invalid --since error")
+	}
+}
+
+func TestRunLogsFollowEndsOnAbortedRun(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="echo x > b.txt", allowed_write_paths="a.txt"];
+	exit [shape=Msquare];
+	start -> t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ab1", FailFastOnGuardrail: true}); err == nil {
+		t.Fatal("expected the guardrail to abort the run")
+	}
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() {
+		done <- RunLogs(context.Background(), filepath.Join(runsdir, "ab1"), LogsOptions{Follow: true, PollInterval: 5 * time.Millisecond}, out)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("follow did not stop after PipelineAborted")
+	}
+	if !strings.Contains(out.String(), "[run events] PipelineAborted") {
+		t.Fatalf("missing abort event:\n%s", out.String())
+	}
+}
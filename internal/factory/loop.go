@@ -0,0 +1,156 @@
+package attractor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultLoopMaxIterations = 3
+
+// LoopProgress is the checkpointed state of an in-flight manager loop.
+type LoopProgress struct {
+	ManagerID       string `json:"manager_id"`
+	Iteration       int    `json:"iteration"`
+	LastBodyNode    string `json:"last_body_node,omitempty"`
+	LastBodyOutcome string `json:"last_body_outcome,omitempty"`
+}
+
+func isManagerLoopNode(node *Node) bool {
+	return node.Type() == "stack.manager_loop" || (node.Type() == "" && node.Shape() == "house")
+}
+
+func loopIterationKey(managerID string) string {
+	return "loop." + managerID + ".iteration"
+}
+
+// parseLoopDoneWhen parses `context.<key>=<value>` into its key and value.
+func parseLoopDoneWhen(raw string) (string, string, error) {
+	raw = strings.TrimSpace(raw)
+	key, value, ok := strings.Cut(raw, "=")
+	key = strings.TrimSpace(key)
+	if !ok || !strings.HasPrefix(key, "context.") || strings.TrimPrefix(key, "context.") == "" {
+		return "", "", fmt.Errorf("invalid loop.done_when %q: expected context.<key>=<value>", raw)
+	}
+	return strings.TrimPrefix(key, "context."), strings.TrimSpace(value), nil
+}
+
+func loopDone(ctx Context, key, value string) bool {
+	v, ok := ctx.Get(key)
+	if !ok {
+		return false
+	}
+	return fmt.Sprintf("%v", v) == value
+}
+
+func validateManagerLoop(g *Graph, n *Node) []Diagnostic {
+	if !isManagerLoopNode(n) {
+		return nil
+	}
+	d := []Diagnostic{}
+	for _, attr := range []string{"loop.body_entry", "loop.body_exit"} {
+		id := strings.TrimSpace(n.StringAttr(attr, ""))
+		if id == "" {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("manager loop %s missing %s", n.ID, attr)})
+			continue
+		}
+		if _, ok := g.Nodes[id]; !ok {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("manager loop %s %s references missing node: %s", n.ID, attr, id)})
+		}
+	}
+	if _, _, err := parseLoopDoneWhen(n.StringAttr("loop.done_when", "")); err != nil {
+		d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("manager loop %s: %v", n.ID, err)})
+	}
+	if n.IntAttr("loop.max_iterations", defaultLoopMaxIterations) <= 0 {
+		d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("manager loop %s loop.max_iterations must be positive", n.ID)})
+	}
+	return d
+}
+
+// executeManagerLoop repeats the body subsequence from loop.body_entry through
+// loop.body_exit until loop.done_when holds or loop.max_iterations is reached.
+// Body stages write artifacts under nodeDir/iter-<n>/<node-id>.
+func (e *Engine) executeManagerLoop(node *Node, nodeDir string) (Outcome, error) {
+	entry := strings.TrimSpace(node.StringAttr("loop.body_entry", ""))
+	exit := strings.TrimSpace(node.StringAttr("loop.body_exit", ""))
+	doneKey, doneValue, err := parseLoopDoneWhen(node.StringAttr("loop.done_when", ""))
+	if err != nil {
+		return Outcome{}, err
+	}
+	maxIter := node.IntAttr("loop.max_iterations", defaultLoopMaxIterations)
+
+	startIter := 1
+	startNode := entry
+	if e.loop != nil && e.loop.ManagerID == node.ID && e.loop.Iteration > 0 {
+		startIter = e.loop.Iteration
+		if e.loop.LastBodyNode == exit {
+			if loopDone(e.Context, doneKey, doneValue) {
+				return e.finishManagerLoop(node, startIter, true), nil
+			}
+			startIter++
+		} else if e.loop.LastBodyNode != "" {
+			startNode = e.routeFrom(e.loop.LastBodyNode, e.loop.LastBodyOutcome)
+			if startNode == "" {
+				return Outcome{}, fmt.Errorf("resume failed: no route from %s inside loop %s", e.loop.LastBodyNode, node.ID)
+			}
+		}
+	}
+
+	for iter := startIter; iter <= maxIter; iter++ {
+		e.loop = &LoopProgress{ManagerID: node.ID, Iteration: iter}
+		e.Context[loopIterationKey(node.ID)] = iter
+		_ = appendEvent(e.RunDir, e.stampAttempt(map[string]any{"schema_version": 1, "type": "LoopIterationStarted", "node_id": node.ID, "iteration": iter, "at": time.Now().UTC().Format(time.RFC3339Nano)}))
+		e.Logger.Info("loop iteration started", "node", node.ID, "iteration", iter, "max_iterations", maxIter)
+		iterDir := filepath.Join(nodeDir, fmt.Sprintf("iter-%d", iter))
+		current := startNode
+		startNode = entry
+		for {
+			bodyNode := e.Graph.Nodes[current]
+			if bodyNode == nil {
+				return Outcome{}, fmt.Errorf("missing node: %s", current)
+			}
+			if bodyNode.ID == node.ID {
+				return Outcome{}, fmt.Errorf("loop body of %s routes back to its manager", node.ID)
+			}
+			out, err := e.runStage(bodyNode, nodeArtifactDir(iterDir, bodyNode.ID))
+			if err != nil {
+				return Outcome{}, err
+			}
+			if bodyNode.ID == exit {
+				break
+			}
+			next := e.routeFrom(bodyNode.ID, out.Outcome)
+			if next == "" {
+				return Outcome{}, fmt.Errorf("no route from node %s for outcome %s inside loop %s", bodyNode.ID, out.Outcome, node.ID)
+			}
+			current = next
+		}
+		if loopDone(e.Context, doneKey, doneValue) {
+			return e.finishManagerLoop(node, iter, true), nil
+		}
+	}
+	return e.finishManagerLoop(node, maxIter, false), nil
+}
+
+func (e *Engine) finishManagerLoop(node *Node, iterations int, done bool) Outcome {
+	e.loop = nil
+	out := Outcome{
+		SchemaVersion:    1,
+		Outcome:          "success",
+		SuggestedNextIDs: []string{},
+		ContextUpdates:   map[string]any{"loop." + node.ID + ".iterations": iterations},
+	}
+	_ = appendEvent(e.RunDir, e.stampAttempt(map[string]any{"schema_version": 1, "type": "LoopCompleted", "node_id": node.ID, "iterations": iterations, "done": done, "at": time.Now().UTC().Format(time.RFC3339Nano)}))
+	if done {
+		return out
+	}
+	if node.BoolAttr("allow_partial", false) {
+		out.Outcome = "partial_success"
+		return out
+	}
+	out.Outcome = "fail"
+	out.FailureReason = fmt.Sprintf("loop_max_iterations_exceeded: %d", iterations)
+	out.FailureCode = FailureLoopMaxIterations
+	return out
+}
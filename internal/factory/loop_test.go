@@ -0,0 +1,151 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func managerLoopDOT(managerAttrs, reviewUpdates string) string {
+	return `digraph G {
+	start [shape=Mdiamond];
+	manager [shape=house, type="stack.manager_loop", "loop.body_entry"="plan", "loop.body_exit"="review", "loop.done_when"="context.acceptance_passed=true"` + managerAttrs + `];
+	plan [shape=box];
+	implement [shape=box];
+	review [shape=box, "test.context_updates_json"="` + reviewUpdates + `"];
+	exit_ok [shape=Msquare];
+	exit_fail [shape=Msquare];
+	start -> manager;
+	plan -> implement;
+	implement -> review;
+	manager -> exit_ok [condition="outcome=success"];
+	manager -> exit_ok [condition="outcome=partial_success"];
+	manager -> exit_fail [condition="outcome=fail"];
+	}`
+}
+
+func countEvents(t *testing.T, p, typ, nodeID string) int {
+	t.Helper()
+	n := 0
+	for _, ev := range readJSONLRecords(t, p) {
+		if ev["type"] == typ && (nodeID == "" || ev["node_id"] == nodeID) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestManagerLoopStopsWhenDoneConditionHolds(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, managerLoopDOT("", `{\"acceptance_passed\":true}`))
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ml1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ml1")
+	for _, id := range []string{"plan", "implement", "review"} {
+		if _, err := os.Stat(filepath.Join(runDir, "manager", "iter-1", id, "status.json")); err != nil {
+			t.Fatalf("missing iteration artifact for %s: %v", id, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "manager", "iter-2")); err == nil {
+		t.Fatal("loop should stop after first iteration")
+	}
+	st := readStatusJSON(t, filepath.Join(runDir, "manager", "status.json"))
+	if st["outcome"] != "success" {
+		t.Fatalf("expected manager success, got %v", st)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "exit_ok", "status.json")); err != nil {
+		t.Fatal("expected exit_ok reached")
+	}
+}
+
+func TestManagerLoopExhaustionFailsOrPartial(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, managerLoopDOT(`, "loop.max_iterations"=2`, `{\"acceptance_passed\":false}`))
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ml2"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ml2")
+	st := readStatusJSON(t, filepath.Join(runDir, "manager", "status.json"))
+	if st["outcome"] != "fail" || !strings.Contains(st["failure_reason"].(string), "loop_max_iterations_exceeded") {
+		t.Fatalf("expected exhaustion failure, got %v", st)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "manager", "iter-2", "review", "status.json")); err != nil {
+		t.Fatal(err)
+	}
+	if got := countEvents(t, filepath.Join(runDir, "events.jsonl"), "LoopIterationStarted", "manager"); got != 2 {
+		t.Fatalf("expected 2 iterations, got %d", got)
+	}
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Loop != nil {
+		t.Fatalf("loop progress should be cleared after completion: %+v", cp.Loop)
+	}
+	if v, _ := cp.Context[loopIterationKey("manager")].(float64); v != 2 {
+		t.Fatalf("expected iteration count in context, got %v", cp.Context[loopIterationKey("manager")])
+	}
+
+	workdir, runsdir, pipeline = setupRun(t, managerLoopDOT(`, "loop.max_iterations"=1, allow_partial=true`, `{\"acceptance_passed\":false}`))
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ml3"}); err != nil {
+		t.Fatal(err)
+	}
+	st = readStatusJSON(t, filepath.Join(runsdir, "ml3", "manager", "status.json"))
+	if st["outcome"] != "partial_success" {
+		t.Fatalf("expected partial_success, got %v", st)
+	}
+}
+
+func TestManagerLoopResumesMidIteration(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "implement")
+	workdir, runsdir, pipeline := setupRun(t, managerLoopDOT(`, "loop.max_iterations"=2`, `{\"acceptance_passed\":false}`))
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ml4"})
+	if err == nil || !strings.Contains(err.Error(), "test_stop") {
+		t.Fatalf("expected test stop, got %v", err)
+	}
+	runDir := filepath.Join(runsdir, "ml4")
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Loop == nil || cp.Loop.ManagerID != "manager" || cp.Loop.Iteration != 1 || cp.Loop.LastBodyNode != "implement" {
+		t.Fatalf("unexpected loop progress: %+v", cp.Loop)
+	}
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ml4", Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	events := filepath.Join(runDir, "events.jsonl")
+	if got := countEvents(t, events, "StageStarted", "implement"); got != 2 {
+		t.Fatalf("implement should run once per iteration, got %d", got)
+	}
+	if got := countEvents(t, events, "StageStarted", "plan"); got != 2 {
+		t.Fatalf("plan should not rerun in resumed iteration, got %d", got)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "manager", "iter-1", "review", "status.json")); err != nil {
+		t.Fatal("expected resumed iteration to continue at review")
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "exit_fail", "status.json")); err != nil {
+		t.Fatal("expected exhausted loop to route to exit_fail")
+	}
+}
+
+func TestValidateManagerLoopAttrs(t *testing.T) {
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; m [shape=house, "loop.body_entry"="missing", "loop.done_when"="acceptance=true"]; exit [shape=Msquare]; start -> m; m -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []string{}
+	for _, d := range ValidateGraph(g) {
+		msgs = append(msgs, d.Message)
+	}
+	joined := strings.Join(msgs, "|")
+	for _, want := range []string{"references missing node: missing", "missing loop.body_exit", "invalid loop.done_when"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected %q in %s", want, joined)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// NodeOutcomeOverride is an operator-supplied outcome applied to a node before
+// a run resumes (--mark-node node=outcome).
+type NodeOutcomeOverride struct {
+	NodeID  string
+	Outcome string
+}
+
+var overridableOutcomes = map[string]bool{"success": true, "partial_success": true, "fail": true, "retry": true}
+
+// ParseMarkNodeFlag parses a --mark-node value of the form node=outcome.
+func ParseMarkNodeFlag(raw string) (NodeOutcomeOverride, error) {
+	id, outcome, ok := strings.Cut(strings.TrimSpace(raw), "=")
+	id = strings.TrimSpace(id)
+	outcome = strings.TrimSpace(outcome)
+	if !ok || id == "" || outcome == "" {
+		return NodeOutcomeOverride{}, fmt.Errorf("invalid --mark-node %q: expected node=outcome", raw)
+	}
+	if !overridableOutcomes[outcome] {
+		return NodeOutcomeOverride{}, fmt.Errorf("invalid --mark-node %q: unsupported outcome %s", raw, outcome)
+	}
+	return NodeOutcomeOverride{NodeID: id, Outcome: outcome}, nil
+}
+
+// applyOutcomeOverrides rewrites each marked node's status.json, adds it to the
+// checkpoint's completed nodes, and records a ManualOutcomeOverride event. The
+// last override becomes the node routing resumes from. All overrides are
+// checked before anything is written.
+func applyOutcomeOverrides(g *Graph, runDir string, cp *Checkpoint, overrides []NodeOutcomeOverride, note string, force bool) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	if cp.Loop != nil {
+		return fmt.Errorf("cannot apply --mark-node while manager loop %s is in progress", cp.Loop.ManagerID)
+	}
+	if cp.Foreach != nil {
+		return fmt.Errorf("cannot apply --mark-node while foreach node %s is in progress", cp.Foreach.NodeID)
+	}
+	for _, o := range overrides {
+		if g.Nodes[o.NodeID] == nil {
+			return fmt.Errorf("--mark-node: node not found in graph: %s", o.NodeID)
+		}
+		if _, err := os.Stat(filepath.Join(nodeArtifactDir(runDir, o.NodeID), "status.json")); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if !force {
+				return fmt.Errorf("--mark-node: %s has no status.json (use --force to create a synthetic status)", o.NodeID)
+			}
+		}
+	}
+	completed := map[string]bool{}
+	for _, id := range cp.CompletedNodes {
+		completed[id] = true
+	}
+	for _, o := range overrides {
+		nodeDir := nodeArtifactDir(runDir, o.NodeID)
+		statusPath := filepath.Join(nodeDir, "status.json")
+		status, err := readStatus(statusPath)
+		synthetic := false
+		if errors.Is(err, os.ErrNotExist) {
+			synthetic = true
+			status = Outcome{SchemaVersion: 1, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}
+			if err := os.MkdirAll(nodeDir, 0o755); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		previous := status.Outcome
+		status.Outcome = o.Outcome
+		if o.Outcome == "success" || o.Outcome == "partial_success" {
+			status.FailureReason = ""
+			status.FailureCode = ""
+		}
+		status.Notes = strings.TrimSpace(strings.TrimSpace(status.Notes) + "\nmanual outcome override: " + o.Outcome + manualNoteSuffix(note))
+		if err := writeJSON(statusPath, status); err != nil {
+			return err
+		}
+		if !completed[o.NodeID] {
+			completed[o.NodeID] = true
+			cp.CompletedNodes = append(cp.CompletedNodes, o.NodeID)
+		}
+		cp.LastCompletedNode = o.NodeID
+		if cp.Context == nil {
+			cp.Context = map[string]any{}
+		}
+		cp.Context["outcome"] = o.Outcome
+		_ = appendEvent(runDir, map[string]any{
+			"schema_version":   1,
+			"type":             "ManualOutcomeOverride",
+			"node_id":          o.NodeID,
+			"previous_outcome": previous,
+			"outcome":          o.Outcome,
+			"note":             note,
+			"synthetic":        synthetic,
+			"at":               time.Now().UTC().Format(time.RFC3339Nano),
+		})
+	}
+	return writeJSON(filepath.Join(runDir, "checkpoint.json"), cp)
+}
+
+func manualNoteSuffix(note string) string {
+	if strings.TrimSpace(note) == "" {
+		return ""
+	}
+	return " (" + strings.TrimSpace(note) + ")"
+}
@@ -0,0 +1,103 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const markNodeDOT = `digraph G {
+	start [shape=Mdiamond];
+	verify_plan [shape=box, "test.outcome"="fail"];
+	implement [shape=box];
+	exit [shape=Msquare];
+	start -> verify_plan;
+	verify_plan -> implement [condition="outcome=success"];
+	implement -> exit;
+}`
+
+func TestMarkNodeOverridesOutcomeAndResumes(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, markNodeDOT)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "m1"}); err == nil {
+		t.Fatal("expected failing verify_plan to stop the run")
+	}
+	runDir := filepath.Join(runsdir, "m1")
+	if _, err := os.Stat(filepath.Join(runDir, "implement", "status.json")); err == nil {
+		t.Fatal("implement should not have run")
+	}
+	cfg := RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "m1", Resume: true,
+		MarkNodes: []NodeOutcomeOverride{{NodeID: "verify_plan", Outcome: "success"}}, MarkNote: "reviewed by hand"}
+	if err := RunPipeline(cfg); err != nil {
+		t.Fatal(err)
+	}
+	st := readStatusJSON(t, filepath.Join(runDir, "verify_plan", "status.json"))
+	if st["outcome"] != "success" {
+		t.Fatalf("status outcome = %v", st["outcome"])
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "implement", "status.json")); err != nil {
+		t.Fatalf("implement did not run after override: %v", err)
+	}
+	var override map[string]any
+	for _, ev := range readJSONLRecords(t, filepath.Join(runDir, "events.jsonl")) {
+		if ev["type"] == "ManualOutcomeOverride" {
+			override = ev
+		}
+	}
+	if override == nil {
+		t.Fatal("missing ManualOutcomeOverride event")
+	}
+	if override["node_id"] != "verify_plan" || override["previous_outcome"] != "fail" || override["outcome"] != "success" || override["note"] != "reviewed by hand" {
+		t.Fatalf("unexpected override event: %v", override)
+	}
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(cp.CompletedNodes, ","), "verify_plan") {
+		t.Fatalf("verify_plan missing from completed nodes: %v", cp.CompletedNodes)
+	}
+}
+
+func TestMarkNodeRejectsUnknownAndMissingStatus(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, markNodeDOT)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "m2"}); err == nil {
+		t.Fatal("expected failing verify_plan to stop the run")
+	}
+	resume := func(o NodeOutcomeOverride, force bool) error {
+		return RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "m2", Resume: true,
+			MarkNodes: []NodeOutcomeOverride{o}, MarkForce: force})
+	}
+	if err := resume(NodeOutcomeOverride{NodeID: "nope", Outcome: "success"}, false); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected unknown node error, got %v", err)
+	}
+	if err := resume(NodeOutcomeOverride{NodeID: "implement", Outcome: "success"}, false); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("expected missing status error, got %v", err)
+	}
+	if err := resume(NodeOutcomeOverride{NodeID: "implement", Outcome: "success"}, true); err != nil {
+		t.Fatal(err)
+	}
+	st := readStatusJSON(t, filepath.Join(runsdir, "m2", "implement", "status.json"))
+	if st["outcome"] != "success" {
+		t.Fatalf("synthetic status outcome = %v", st["outcome"])
+	}
+}
+
+func TestParseMarkNodeFlag(t *testing.T) {
+	o, err := ParseMarkNodeFlag("verify_plan=success")
+	if err != nil || o.NodeID != "verify_plan" || o.Outcome != "success" {
+		t.Fatalf("got %+v %v", o, err)
+	}
+	for _, raw := range []string{"verify_plan", "=success", "verify_plan=done"} {
+		if _, err := ParseMarkNodeFlag(raw); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+	workdir, runsdir, pipeline := setupRun(t, markNodeDOT)
+	err = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, MarkNodes: []NodeOutcomeOverride{o}})
+	if err == nil || !strings.Contains(err.Error(), "requires --resume") {
+		t.Fatalf("expected --mark-node without --resume to fail, got %v", err)
+	}
+}
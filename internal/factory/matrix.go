@@ -0,0 +1,256 @@
+package attractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// matrixSpec is a parsed `matrix="<var>=<v1>,<v2>,..."` attribute.
+type matrixSpec struct {
+	Var    string
+	Values []string
+}
+
+func (s matrixSpec) key() string {
+	return s.Var + "=" + strings.Join(s.Values, ",")
+}
+
+// MatrixExpansion records how one matrix node was expanded; it is written to
+// manifest.json under matrix_expansions.
+type MatrixExpansion struct {
+	Variable string   `json:"variable"`
+	Values   []string `json:"values"`
+	Nodes    []string `json:"nodes"`
+}
+
+// matrixSubstitutedAttrs lists the attributes where ${matrix.<var>} is
+// replaced; verification.* attrs are substituted too.
+var matrixSubstitutedAttrs = []string{"prompt", "tool_command", "allowed_write_paths"}
+
+func parseMatrixSpec(raw string) (matrixSpec, error) {
+	name, list, ok := strings.Cut(raw, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || !idRe.MatchString(name) {
+		return matrixSpec{}, fmt.Errorf("invalid matrix %q: expected <var>=<v1>,<v2>,...", raw)
+	}
+	values := splitCSV(list)
+	if len(values) == 0 {
+		return matrixSpec{}, fmt.Errorf("invalid matrix %q: no values", raw)
+	}
+	seen := map[string]bool{}
+	for _, v := range values {
+		if seen[v] {
+			return matrixSpec{}, fmt.Errorf("invalid matrix %q: duplicate value %s", raw, v)
+		}
+		seen[v] = true
+	}
+	return matrixSpec{Var: name, Values: values}, nil
+}
+
+func matrixCopyID(id, value string) string {
+	return id + "_" + value
+}
+
+// expandMatrix replaces every node carrying a matrix attribute with one copy
+// per value. Edges between nodes of the same matrix are copied pairwise (so a
+// verify/fix pair stays paired per value); edges from other nodes fan out to
+// every copy and edges to other nodes fan in from every copy. Copies carry
+// matrix.origin and matrix.<var> so the expansion can be traced.
+func expandMatrix(g *Graph) error {
+	specs := map[string]matrixSpec{}
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := g.Nodes[id]
+		raw, ok := n.Attrs["matrix"]
+		if !ok {
+			continue
+		}
+		spec, err := parseMatrixSpec(fmt.Sprintf("%v", raw))
+		if err != nil {
+			return fmt.Errorf("node %s: %w", id, err)
+		}
+		specs[id] = spec
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	for id, spec := range specs {
+		n := g.Nodes[id]
+		delete(g.Nodes, id)
+		for _, v := range spec.Values {
+			cid := matrixCopyID(id, v)
+			if _, exists := g.Nodes[cid]; exists || specs[cid].Var != "" {
+				return fmt.Errorf("matrix expansion of %s collides with existing node %s", id, cid)
+			}
+			g.Nodes[cid] = &Node{ID: cid, Attrs: matrixCopyAttrs(n, spec, v)}
+		}
+	}
+	edges := make([]*Edge, 0, len(g.Edges))
+	for _, e := range g.Edges {
+		from, fromMatrix := specs[e.From]
+		to, toMatrix := specs[e.To]
+		switch {
+		case fromMatrix && toMatrix:
+			if from.key() != to.key() {
+				return fmt.Errorf("edge %s -> %s joins matrix nodes with different axes", e.From, e.To)
+			}
+			for _, v := range from.Values {
+				edges = append(edges, cloneEdge(e, matrixCopyID(e.From, v), matrixCopyID(e.To, v), v))
+			}
+		case fromMatrix:
+			for _, v := range from.Values {
+				edges = append(edges, cloneEdge(e, matrixCopyID(e.From, v), e.To, v))
+			}
+		case toMatrix:
+			for _, v := range to.Values {
+				edges = append(edges, cloneEdge(e, e.From, matrixCopyID(e.To, v), v))
+			}
+		default:
+			edges = append(edges, e)
+		}
+	}
+	g.Edges = edges
+	for _, n := range g.Nodes {
+		rewriteMatrixRefs(n, specs)
+	}
+	return nil
+}
+
+func matrixCopyAttrs(n *Node, spec matrixSpec, value string) map[string]Value {
+	placeholder := "${matrix." + spec.Var + "}"
+	attrs := map[string]Value{}
+	for k, v := range n.Attrs {
+		if k == "matrix" {
+			continue
+		}
+		if s, ok := v.(string); ok && matrixSubstitutes(k) {
+			v = strings.ReplaceAll(s, placeholder, value)
+		}
+		attrs[k] = v
+	}
+	attrs["matrix.origin"] = n.ID
+	attrs["matrix."+spec.Var] = value
+	return attrs
+}
+
+func matrixSubstitutes(attr string) bool {
+	if strings.HasPrefix(attr, "verification.") {
+		return true
+	}
+	for _, k := range matrixSubstitutedAttrs {
+		if k == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneEdge copies e between matrix copies; an explicit edge id gets the
+// matrix value as a suffix so copies stay distinct.
+func cloneEdge(e *Edge, from, to, value string) *Edge {
+	attrs := make(map[string]Value, len(e.Attrs))
+	for k, v := range e.Attrs {
+		attrs[k] = v
+	}
+	if id := strings.TrimSpace(e.StringAttr("id", "")); id != "" {
+		attrs["id"] = matrixCopyID(id, value)
+	}
+	return &Edge{From: from, To: to, Attrs: attrs}
+}
+
+// matrixRefAttrs lists the node-list attributes that may name an expanded node.
+var matrixRefAttrs = []string{"depends_on", "required_tool_node"}
+
+// rewriteMatrixRefs points depends_on and required_tool_node entries naming an
+// expanded node at its copies: the same-value copy for nodes of that matrix,
+// all copies otherwise.
+func rewriteMatrixRefs(n *Node, specs map[string]matrixSpec) {
+	origin := n.StringAttr("matrix.origin", "")
+	for _, attr := range matrixRefAttrs {
+		refs := uniqueNonEmpty(splitCSV(n.StringAttr(attr, "")))
+		if len(refs) == 0 {
+			continue
+		}
+		out := []string{}
+		changed := false
+		for _, ref := range refs {
+			spec, ok := specs[ref]
+			if !ok {
+				out = append(out, ref)
+				continue
+			}
+			changed = true
+			if own, isCopy := specs[origin]; isCopy && own.key() == spec.key() {
+				out = append(out, matrixCopyID(ref, n.StringAttr("matrix."+spec.Var, "")))
+				continue
+			}
+			for _, v := range spec.Values {
+				out = append(out, matrixCopyID(ref, v))
+			}
+		}
+		if changed {
+			n.Attrs[attr] = strings.Join(out, ",")
+		}
+	}
+}
+
+// matrixExpansions rebuilds the expansion record from the copies' attributes.
+func matrixExpansions(g *Graph) map[string]MatrixExpansion {
+	out := map[string]MatrixExpansion{}
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := g.Nodes[id]
+		origin := n.StringAttr("matrix.origin", "")
+		if origin == "" {
+			continue
+		}
+		x := out[origin]
+		for k, v := range n.Attrs {
+			if strings.HasPrefix(k, "matrix.") && k != "matrix.origin" {
+				x.Variable = strings.TrimPrefix(k, "matrix.")
+				x.Values = append(x.Values, fmt.Sprintf("%v", v))
+			}
+		}
+		x.Nodes = append(x.Nodes, id)
+		out[origin] = x
+	}
+	return out
+}
+
+// validateMatrixFanOut warns when a node routes to several copies of one
+// matrix node under the same condition: the sequential engine follows only
+// one of those edges until a parallel executor exists.
+func validateMatrixFanOut(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	type fanKey struct{ from, origin, condition string }
+	targets := map[fanKey][]string{}
+	keys := []fanKey{}
+	for _, e := range g.Edges {
+		to := g.Nodes[e.To]
+		origin := to.StringAttr("matrix.origin", "")
+		if origin == "" || g.Nodes[e.From].StringAttr("matrix.origin", "") == origin {
+			continue
+		}
+		k := fanKey{e.From, origin, strings.TrimSpace(e.StringAttr("condition", ""))}
+		if _, ok := targets[k]; !ok {
+			keys = append(keys, k)
+		}
+		targets[k] = append(targets[k], e.To)
+	}
+	for _, k := range keys {
+		if len(targets[k]) < 2 {
+			continue
+		}
+		d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s fans out to matrix copies of %s (%s); the sequential engine follows only one of these edges", k.from, k.origin, strings.Join(targets[k], ","))})
+	}
+	return d
+}
@@ -0,0 +1,158 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func edgeList(g *Graph) []string {
+	out := []string{}
+	for _, e := range g.Edges {
+		s := e.From + "->" + e.To
+		if c := e.StringAttr("condition", ""); c != "" {
+			s += "[" + c + "]"
+		}
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestMatrixExpandsNodesAndEdges(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	verify [shape=parallelogram, matrix="target=agent,cli", tool_command="go test ./${matrix.target}/...", "verification.workdir"="${matrix.target}"];
+	fix [shape=box, matrix="target=agent,cli", prompt="Fix ${matrix.target}", allowed_write_paths="${matrix.target}/", label="keep ${matrix.target}"];
+	report [shape=box, depends_on="verify"];
+	exit [shape=Msquare];
+	start -> verify;
+	verify -> fix [condition="outcome=fail"];
+	fix -> verify;
+	verify -> report [condition="outcome=success"];
+	report -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, gone := range []string{"verify", "fix"} {
+		if g.Nodes[gone] != nil {
+			t.Fatalf("template node %s not removed", gone)
+		}
+	}
+	v := g.Nodes["verify_cli"]
+	if v == nil || v.StringAttr("tool_command", "") != "go test ./cli/..." || v.StringAttr("verification.workdir", "") != "cli" {
+		t.Fatalf("verify_cli = %+v", v)
+	}
+	f := g.Nodes["fix_agent"]
+	if f.StringAttr("prompt", "") != "Fix agent" || f.StringAttr("allowed_write_paths", "") != "agent/" || f.StringAttr("label", "") != "keep ${matrix.target}" {
+		t.Fatalf("fix_agent attrs = %v", f.Attrs)
+	}
+	if f.StringAttr("matrix.origin", "") != "fix" || f.StringAttr("matrix.target", "") != "agent" {
+		t.Fatalf("fix_agent trace attrs = %v", f.Attrs)
+	}
+	want := []string{
+		"fix_agent->verify_agent", "fix_cli->verify_cli",
+		"report->exit",
+		"start->verify_agent", "start->verify_cli",
+		"verify_agent->fix_agent[outcome=fail]", "verify_agent->report[outcome=success]",
+		"verify_cli->fix_cli[outcome=fail]", "verify_cli->report[outcome=success]",
+	}
+	if got := edgeList(g); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("edges = %v\nwant   %v", got, want)
+	}
+	if deps := g.Nodes["report"].StringAttr("depends_on", ""); deps != "verify_agent,verify_cli" {
+		t.Fatalf("depends_on = %q", deps)
+	}
+}
+
+func TestMatrixDiagnosticsUseExpandedIDs(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	check [shape=parallelogram, matrix="target=a,b", tool_command="true", guardrail_mode="sometimes"];
+	exit [shape=Msquare];
+	start -> check;
+	check -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{"unsupported guardrail_mode on node check_a", "unsupported guardrail_mode on node check_b", "node start fans out to matrix copies of check (check_a,check_b)"} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+}
+
+func TestMatrixParseErrors(t *testing.T) {
+	cases := map[string]string{
+		`a [matrix="target"];`:                                "expected <var>=<v1>,<v2>",
+		`a [matrix="target=x,x"];`:                            "duplicate value x",
+		`a [matrix="t=x"]; a_x [shape=box];`:                  "collides with existing node a_x",
+		`a [matrix="t=x"]; b [matrix="u=x"]; a -> b;`:         "different axes",
+		`a [matrix="t=x,y"]; b [matrix="t=x"]; b -> a [w=1];`: "different axes",
+	}
+	for body, want := range cases {
+		_, err := ParseDOT("digraph G {\n" + body + "\n}")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: err = %v, want %q", body, err, want)
+		}
+	}
+}
+
+func TestMatrixExpansionRecordedInManifest(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	check [shape=parallelogram, matrix="target=a,b", tool_command="echo ${matrix.target}"];
+	exit [shape=Msquare];
+	start -> check;
+	check -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "mx1"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(runsdir, "mx1", "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		MatrixExpansions map[string]MatrixExpansion `json:"matrix_expansions"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	x := m.MatrixExpansions["check"]
+	if x.Variable != "target" || strings.Join(x.Values, ",") != "a,b" || strings.Join(x.Nodes, ",") != "check_a,check_b" {
+		t.Fatalf("matrix_expansions = %+v", m.MatrixExpansions)
+	}
+	out, err := os.ReadFile(filepath.Join(runsdir, "mx1", "check_a", "tool.stdout.txt"))
+	if err != nil || string(out) != "a\n" {
+		t.Fatalf("check_a stdout = %q (%v)", out, err)
+	}
+}
+
+func TestMatrixSuffixesExplicitEdgeIDs(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	check [shape=parallelogram, matrix="target=a,b", tool_command="true"];
+	exit [shape=Msquare];
+	start -> check [id="fan"];
+	check -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, e := range g.Edges {
+		ids = append(ids, e.ID)
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, " ") != "check_a-exit-0 check_b-exit-0 fan_a fan_b" {
+		t.Fatalf("edge ids = %v", ids)
+	}
+}
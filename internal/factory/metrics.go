@@ -0,0 +1,266 @@
+package attractor
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Engine metric names.
+const (
+	metricRunsStarted         = "factory_runs_started_total"
+	metricRunsCompleted       = "factory_runs_completed_total"
+	metricRunsFailed          = "factory_runs_failed_total"
+	metricStageDuration       = "factory_stage_duration_seconds"
+	metricStageRetries        = "factory_stage_retries_total"
+	metricGuardrailViolations = "factory_guardrail_violations_total"
+	metricStagesInFlight      = "factory_stages_in_flight"
+)
+
+var metricHelp = map[string]string{
+	metricRunsStarted:         "Pipeline runs started.",
+	metricRunsCompleted:       "Pipeline runs that reached an exit node.",
+	metricRunsFailed:          "Pipeline runs that failed.",
+	metricStageDuration:       "Stage duration by node type and outcome.",
+	metricStageRetries:        "Stage retries by node type.",
+	metricGuardrailViolations: "Guardrail violations by node type and mode.",
+	metricStagesInFlight:      "Stages currently executing.",
+}
+
+// defaultDurationBuckets suit stages ranging from quick tools to long agent
+// sessions.
+var defaultDurationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 1800, 3600}
+
+// MetricsRegistry receives engine metrics. It is an interface so library
+// users can bridge to their own metrics client; PrometheusMetrics is the
+// built-in implementation. Implementations must be safe for concurrent use
+// when shared across runs.
+type MetricsRegistry interface {
+	IncCounter(name string, labels map[string]string)
+	ObserveHistogram(name string, labels map[string]string, value float64)
+	AddGauge(name string, labels map[string]string, delta float64)
+}
+
+// runMetrics feeds recorded events into a MetricsRegistry; nil when disabled.
+type runMetrics struct {
+	reg        MetricsRegistry
+	graph      *Graph
+	stageStart map[string]time.Time
+}
+
+func newRunMetrics(cfg RunConfig, g *Graph) *runMetrics {
+	if cfg.Metrics == nil {
+		return nil
+	}
+	return &runMetrics{reg: cfg.Metrics, graph: g, stageStart: map[string]time.Time{}}
+}
+
+func (m *runMetrics) observe(ev map[string]any) {
+	if m == nil {
+		return
+	}
+	typ, _ := ev["type"].(string)
+	raw, _ := ev["at"].(string)
+	at, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		at = time.Now().UTC()
+	}
+	nodeID, _ := ev["node_id"].(string)
+	switch typ {
+	case "PipelineStarted":
+		m.reg.IncCounter(metricRunsStarted, nil)
+	case "PipelineCompleted":
+		m.reg.IncCounter(metricRunsCompleted, nil)
+	case "PipelineFailed", "PipelineAborted":
+		m.reg.IncCounter(metricRunsFailed, nil)
+	case "StageStarted":
+		m.stageStart[nodeID] = at
+		m.reg.AddGauge(metricStagesInFlight, nil, 1)
+	case "StageRetrying":
+		m.reg.IncCounter(metricStageRetries, map[string]string{"node_type": m.nodeType(nodeID)})
+	case "GuardrailViolation":
+		mode, _ := ev["mode"].(string)
+		m.reg.IncCounter(metricGuardrailViolations, map[string]string{"node_type": m.nodeType(nodeID), "mode": mode})
+	case "StageCompleted", "StageFailed":
+		started, ok := m.stageStart[nodeID]
+		if !ok {
+			return
+		}
+		delete(m.stageStart, nodeID)
+		outcome, _ := ev["outcome"].(string)
+		if typ == "StageFailed" {
+			outcome = "fail"
+			if _, errored := ev["error"]; errored {
+				outcome = "error"
+			}
+		}
+		m.reg.AddGauge(metricStagesInFlight, nil, -1)
+		m.reg.ObserveHistogram(metricStageDuration, map[string]string{"node_type": m.nodeType(nodeID), "outcome": outcome}, at.Sub(started).Seconds())
+	}
+}
+
+func (m *runMetrics) nodeType(nodeID string) string {
+	n := m.graph.Nodes[nodeID]
+	if n == nil {
+		return "unknown"
+	}
+	if isManagerLoopNode(n) {
+		return "manager_loop"
+	}
+	return handlerType(n)
+}
+
+// PrometheusMetrics is an in-process MetricsRegistry that serves the
+// Prometheus text exposition format, so scraping needs no client library.
+type PrometheusMetrics struct {
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	gauges     map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		counters:   map[string]map[string]float64{},
+		gauges:     map[string]map[string]float64{},
+		histograms: map[string]map[string]*histogram{},
+	}
+}
+
+func (p *PrometheusMetrics) IncCounter(name string, labels map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	series(p.counters, name)[formatLabels(labels)]++
+}
+
+func (p *PrometheusMetrics) AddGauge(name string, labels map[string]string, delta float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	series(p.gauges, name)[formatLabels(labels)] += delta
+}
+
+func (p *PrometheusMetrics) ObserveHistogram(name string, labels map[string]string, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	byLabels, ok := p.histograms[name]
+	if !ok {
+		byLabels = map[string]*histogram{}
+		p.histograms[name] = byLabels
+	}
+	key := formatLabels(labels)
+	h, ok := byLabels[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(defaultDurationBuckets))}
+		byLabels[key] = h
+	}
+	for i, le := range defaultDurationBuckets {
+		if value <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func series(m map[string]map[string]float64, name string) map[string]float64 {
+	s, ok := m[name]
+	if !ok {
+		s = map[string]float64{}
+		m[name] = s
+	}
+	return s
+}
+
+// ServeHTTP writes all series in the Prometheus text format.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = p.WriteText(w)
+}
+
+// WriteText writes all series in the Prometheus text format, sorted by name
+// and labels.
+func (p *PrometheusMetrics) WriteText(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var b strings.Builder
+	writeSimple := func(kind string, m map[string]map[string]float64) {
+		for _, name := range sortedKeys(m) {
+			writeMetricHeader(&b, name, kind)
+			for _, labels := range sortedKeys(m[name]) {
+				fmt.Fprintf(&b, "%s%s %s\n", name, labels, formatFloat(m[name][labels]))
+			}
+		}
+	}
+	writeSimple("counter", p.counters)
+	writeSimple("gauge", p.gauges)
+	for _, name := range sortedKeys(p.histograms) {
+		writeMetricHeader(&b, name, "histogram")
+		for _, labels := range sortedKeys(p.histograms[name]) {
+			h := p.histograms[name][labels]
+			for i, le := range defaultDurationBuckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatFloat(le)), h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), h.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, labels, h.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMetricHeader(b *strings.Builder, name, kind string) {
+	if help := metricHelp[name]; help != "" {
+		fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	}
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
+
+// formatLabels renders labels as `{a="1",b="2"}` with sorted names; it is also
+// the series key.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels))
+	for _, k := range sortedKeys(labels) {
+		parts = append(parts, k+"="+strconv.Quote(labels[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func withLabel(labels, name, value string) string {
+	l := name + "=" + strconv.Quote(value)
+	if labels == "" {
+		return "{" + l + "}"
+	}
+	return strings.TrimSuffix(labels, "}") + "," + l + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
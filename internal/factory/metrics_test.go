@@ -0,0 +1,125 @@
+package attractor
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memMetrics is a plain MetricsRegistry that keeps counters, gauges, and
+// histogram observation counts keyed by name and labels.
+type memMetrics struct {
+	mu           sync.Mutex
+	counters     map[string]float64
+	gauges       map[string]float64
+	observations map[string]int
+}
+
+func newMemMetrics() *memMetrics {
+	return &memMetrics{counters: map[string]float64{}, gauges: map[string]float64{}, observations: map[string]int{}}
+}
+
+func (m *memMetrics) IncCounter(name string, labels map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name+formatLabels(labels)]++
+}
+
+func (m *memMetrics) ObserveHistogram(name string, labels map[string]string, _ float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations[name+formatLabels(labels)]++
+}
+
+func (m *memMetrics) AddGauge(name string, labels map[string]string, delta float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[name+formatLabels(labels)] += delta
+}
+
+func TestRunMetricsCountRunsRetriesAndStages(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, max_retries=2, "test.outcome_sequence"="retry,success"];
+	t [shape=parallelogram, tool_command="echo hi > out.txt", allowed_write_paths="src/"];
+	exit [shape=Msquare];
+	start -> a;
+	a -> t;
+	t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	reg := newMemMetrics()
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "m1", Metrics: reg}); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]float64{
+		metricRunsStarted:   1,
+		metricRunsCompleted: 1,
+		metricRunsFailed:    0,
+		metricStageRetries + `{node_type="codergen"}`:                1,
+		metricGuardrailViolations + `{mode="fail",node_type="tool"}`: 1,
+	} {
+		if got := reg.counters[key]; got != want {
+			t.Fatalf("%s = %v, want %v (counters %v)", key, got, want, reg.counters)
+		}
+	}
+	for key, want := range map[string]int{
+		metricStageDuration + `{node_type="start",outcome="success"}`:    1,
+		metricStageDuration + `{node_type="codergen",outcome="success"}`: 1,
+		metricStageDuration + `{node_type="tool",outcome="fail"}`:        1,
+		metricStageDuration + `{node_type="exit",outcome="success"}`:     1,
+	} {
+		if got := reg.observations[key]; got != want {
+			t.Fatalf("%s observations = %d, want %d (%v)", key, got, want, reg.observations)
+		}
+	}
+	if g := reg.gauges[metricStagesInFlight]; g != 0 {
+		t.Fatalf("in-flight gauge = %v after run", g)
+	}
+}
+
+func TestRunMetricsCountFailedRun(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="exit 1"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit [condition="outcome=success"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	reg := newMemMetrics()
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "m2", Metrics: reg}); err == nil {
+		t.Fatal("expected failure")
+	}
+	if reg.counters[metricRunsFailed] != 1 || reg.counters[metricRunsCompleted] != 0 {
+		t.Fatalf("counters = %v", reg.counters)
+	}
+}
+
+func TestPrometheusMetricsText(t *testing.T) {
+	p := NewPrometheusMetrics()
+	p.IncCounter(metricRunsStarted, nil)
+	p.IncCounter(metricRunsStarted, nil)
+	p.AddGauge(metricStagesInFlight, nil, 1)
+	p.ObserveHistogram(metricStageDuration, map[string]string{"outcome": "success", "node_type": "tool"}, 2)
+	var b strings.Builder
+	if err := p.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE factory_runs_started_total counter\nfactory_runs_started_total 2\n",
+		"# TYPE factory_stages_in_flight gauge\nfactory_stages_in_flight 1\n",
+		"# TYPE factory_stage_duration_seconds histogram\n",
+		`factory_stage_duration_seconds_bucket{node_type="tool",outcome="success",le="1"} 0` + "\n",
+		`factory_stage_duration_seconds_bucket{node_type="tool",outcome="success",le="5"} 1` + "\n",
+		`factory_stage_duration_seconds_bucket{node_type="tool",outcome="success",le="+Inf"} 1` + "\n",
+		`factory_stage_duration_seconds_sum{node_type="tool",outcome="success"} 2` + "\n",
+		`factory_stage_duration_seconds_count{node_type="tool",outcome="success"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
@@ -13,6 +13,9 @@ type Graph struct {
 	Nodes map[string]*Node
 	Edges []*Edge
 	Attrs map[string]Value
+	// GroupEdges are the group_edge statements, in source order. ParseDOT
+	// has already added their edges to Edges.
+	GroupEdges []*GroupEdge
 }
 
 type Node struct {
@@ -20,7 +23,12 @@ type Node struct {
 	Attrs map[string]Value
 }
 
+// Edge is a directed edge. ID is the explicit `id` attribute when set,
+// otherwise `<from>-<to>-<n>` where n counts earlier edges between the same
+// pair and endpoints containing `-` are quoted; it is assigned once parsing
+// finishes.
 type Edge struct {
+	ID    string
 	From  string
 	To    string
 	Attrs map[string]Value
@@ -29,7 +37,9 @@ type Edge struct {
 type Context map[string]any
 
 type Diagnostic struct {
-	Level   string
+	Level string
+	// Rule is the ID of the validation rule that reported the diagnostic.
+	Rule    string
 	Message string
 }
 
@@ -80,20 +90,28 @@ func (n *Node) IntAttr(k string, def int) int {
 	if !ok {
 		return def
 	}
+	if i, ok := intValue(v); ok {
+		return i
+	}
+	return def
+}
+
+// intValue converts an attribute value to an int the way IntAttr does:
+// numbers are truncated and strings must parse as a base-10 integer.
+func intValue(v Value) (int, bool) {
 	switch t := v.(type) {
 	case int:
-		return t
+		return t, true
 	case int64:
-		return int(t)
+		return int(t), true
 	case float64:
-		return int(t)
+		return int(t), true
 	case string:
-		i, err := strconv.Atoi(strings.TrimSpace(t))
-		if err == nil {
-			return i
+		if i, err := strconv.Atoi(strings.TrimSpace(t)); err == nil {
+			return i, true
 		}
 	}
-	return def
+	return 0, false
 }
 
 func (n *Node) DurationAttr(k string) (time.Duration, bool) {
@@ -165,6 +183,15 @@ func (e *Edge) IntAttr(k string, def int) int {
 	return def
 }
 
+// ref names the edge in diagnostics: its ID, or from -> to for edges built
+// outside the parser.
+func (e *Edge) ref() string {
+	if e.ID != "" {
+		return e.ID
+	}
+	return e.From + " -> " + e.To
+}
+
 func ParseDurationV0(s string) (time.Duration, error) {
 	s = strings.TrimSpace(s)
 	if len(s) < 2 {
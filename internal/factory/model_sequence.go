@@ -0,0 +1,111 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// agentAttemptsFile is the per-node history of codergen attempts: one JSON
+// line per attempt with the backend and model it ran with.
+const agentAttemptsFile = "agent.attempts.jsonl"
+
+// parseModelSequence reads codex.model_sequence="cheap,cheap,expensive".
+// Empty entries are an error, not skipped, so a stray comma does not shift
+// which attempt gets which model.
+func parseModelSequence(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	out := []string{}
+	for i, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return nil, fmt.Errorf("codex.model_sequence entry %d is empty", i+1)
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// modelForAttempt picks the sequence entry for a zero-based retry attempt,
+// staying on the last entry once attempts outrun the list.
+func modelForAttempt(sequence []string, attempt int) string {
+	if attempt >= len(sequence) {
+		return sequence[len(sequence)-1]
+	}
+	if attempt < 0 {
+		attempt = 0
+	}
+	return sequence[attempt]
+}
+
+func validateModelSequence(n *Node) []Diagnostic {
+	if _, err := parseModelSequence(n.StringAttr("codex.model_sequence", "")); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s: %v", n.ID, err)}}
+	}
+	return nil
+}
+
+// agentAttempt is one line of agent.attempts.jsonl.
+type agentAttempt struct {
+	Attempt int    `json:"attempt"`
+	Backend string `json:"backend"`
+	Model   string `json:"model,omitempty"`
+	At      string `json:"at"`
+}
+
+func agentBackendName(a Agent) string {
+	switch a.(type) {
+	case codexAgent:
+		return "codex"
+	case fakeAgent:
+		return "fake"
+	case stubAgent:
+		return "stub"
+	case replayAgent:
+		return "replay"
+	}
+	return fmt.Sprintf("%T", a)
+}
+
+func agentModel(a Agent) string {
+	if c, ok := a.(codexAgent); ok {
+		return c.opts.Model
+	}
+	return ""
+}
+
+// recordAgentAttempt appends the attempt's backend and model to the node's
+// attempt history.
+func recordAgentAttempt(nodeDir string, attempt int, a Agent) error {
+	f, err := os.OpenFile(filepath.Join(nodeDir, agentAttemptsFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b, err := json.Marshal(agentAttempt{Attempt: attempt, Backend: agentBackendName(a), Model: agentModel(a), At: time.Now().UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// lastAgentModel is the model of the latest attempt in nodeDir's history, or
+// "" when there is none.
+func lastAgentModel(nodeDir string) string {
+	b, err := os.ReadFile(filepath.Join(nodeDir, agentAttemptsFile))
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	var last agentAttempt
+	if json.Unmarshal([]byte(lines[len(lines)-1]), &last) != nil {
+		return ""
+	}
+	return last.Model
+}
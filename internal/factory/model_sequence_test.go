@@ -0,0 +1,80 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseModelSequence(t *testing.T) {
+	seq, err := parseModelSequence(" mini , mini,big ")
+	if err != nil || strings.Join(seq, ",") != "mini,mini,big" {
+		t.Fatalf("sequence = %v (%v)", seq, err)
+	}
+	for attempt, want := range []string{"mini", "mini", "big", "big", "big"} {
+		if got := modelForAttempt(seq, attempt); got != want {
+			t.Fatalf("attempt %d model = %s, want %s", attempt, got, want)
+		}
+	}
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=box, "codex.model_sequence"="mini,,big"]; exit [shape=Msquare]; start -> a -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, "node a: codex.model_sequence entry 2 is empty") {
+		t.Fatalf("diagnostics = %s", msgs)
+	}
+}
+
+func TestCodexModelSequenceEscalatesAcrossRetries(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "")
+	t.Setenv("ATTRACTOR_BACKEND", "")
+	t.Setenv("ATTRACTOR_AGENT_BACKEND", "")
+	dir := t.TempDir()
+	codex := filepath.Join(dir, "codex")
+	models := filepath.Join(dir, "models.txt")
+	script := `#!/bin/sh
+if [ "$1" = "--version" ]; then echo "codex 0.0.0"; exit 0; fi
+out=""
+model=""
+while [ $# -gt 0 ]; do
+  if [ "$1" = "-o" ]; then out="$2"; shift; fi
+  if [ "$1" = "-m" ]; then model="$2"; shift; fi
+  shift
+done
+cat >/dev/null
+echo "$model" >> ` + models + `
+echo '{"type":"turn.completed","usage":{"input_tokens":1,"cached_input_tokens":0,"output_tokens":1}}'
+outcome=retry
+if [ "$(wc -l < ` + models + `)" -ge 4 ]; then outcome=success; fi
+printf '{"outcome":"%s","preferred_next_label":"","suggested_next_ids":[],"context_updates":{},"verification_plan":null,"notes":"","failure_reason":""}' "$outcome" > "$out"
+`
+	if err := os.WriteFile(codex, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=box, max_retries=3, "agent.backend"="codex", "codex.path"="` + codex + `", "codex.skip_git_repo_check"=true, "codex.capture_events"=true, "codex.model"="ignored", "codex.model_sequence"="mini,mini,big"];
+	exit [shape=Msquare];
+	start -> build -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ms1"}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(models); string(b) != "mini\nmini\nbig\nbig\n" {
+		t.Fatalf("models passed to codex = %q", b)
+	}
+	runDir := filepath.Join(runsdir, "ms1")
+	got := []string{}
+	for _, rec := range readJSONLRecords(t, filepath.Join(runDir, "build", agentAttemptsFile)) {
+		got = append(got, rec["backend"].(string)+":"+rec["model"].(string))
+	}
+	if strings.Join(got, ",") != "codex:mini,codex:mini,codex:big,codex:big" {
+		t.Fatalf("attempt history = %v", got)
+	}
+	usage, err := TraceQuery(runDir, TraceQueryOptions{Types: []string{"CodexTokenUsage"}, Node: "build"})
+	if err != nil || len(usage) != 4 || usage[0]["model"] != "mini" || usage[3]["model"] != "big" {
+		t.Fatalf("usage records = %v (%v)", usage, err)
+	}
+}
@@ -0,0 +1,111 @@
+package attractor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// nodeEnvNames are the variables every tool and verification command gets.
+var nodeEnvNames = []string{"ATTRACTOR_RUN_ID", "ATTRACTOR_NODE_ID", "ATTRACTOR_NODE_TYPE", "ATTRACTOR_NODE_DIR", "ATTRACTOR_WORKSPACE", "ATTRACTOR_ATTEMPT"}
+
+// exportAttrs lists the attributes named by export_attrs="target,profile".
+func exportAttrs(n *Node) []string {
+	out := []string{}
+	for _, name := range strings.Split(n.StringAttr("export_attrs", ""), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// exportAttrEnvName is ATTRACTOR_ATTR_<NAME>: the attribute name upper-cased
+// with every character other than a letter or digit replaced by _.
+func exportAttrEnvName(attr string) string {
+	b := []byte(strings.ToUpper(attr))
+	for i, c := range b {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			b[i] = '_'
+		}
+	}
+	return "ATTRACTOR_ATTR_" + string(b)
+}
+
+// nodeEnvExportedNames is every variable nodeCommandEnv sets for n, in order;
+// stage events record them without values.
+func nodeEnvExportedNames(n *Node) []string {
+	out := append([]string{}, nodeEnvNames...)
+	for _, attr := range exportAttrs(n) {
+		out = append(out, exportAttrEnvName(attr))
+	}
+	return out
+}
+
+// nodeCommandEnv is the environment the tool and verification handlers add
+// to each command they run. Paths are as the command sees them, so with
+// tool_runner=docker ATTRACTOR_WORKSPACE is the mount point; the node dir is
+// not mounted and stays a host path.
+func nodeCommandEnv(runID string, n *Node, ctx Context, runner toolRunner, nodeDir, workspace string) ([]string, error) {
+	absNodeDir, err := filepath.Abs(nodeDir)
+	if err != nil {
+		return nil, err
+	}
+	absWorkspace, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, err
+	}
+	cmdWorkspace, err := runner.commandDir(absWorkspace, absWorkspace)
+	if err != nil {
+		return nil, err
+	}
+	values := []string{runID, n.ID, handlerType(n), absNodeDir, cmdWorkspace, strconv.Itoa(ctx.GetInt("internal.retry_count."+n.ID, 0))}
+	env := make([]string, 0, len(values))
+	for i, name := range nodeEnvNames {
+		env = append(env, name+"="+values[i])
+	}
+	for _, attr := range exportAttrs(n) {
+		env = append(env, exportAttrEnvName(attr)+"="+n.StringAttr(attr, ""))
+	}
+	return env, nil
+}
+
+// validateExportAttrs checks export_attrs is on a tool or verification node
+// and that the exported values fit on one line.
+func validateExportAttrs(n *Node) []Diagnostic {
+	if _, ok := n.Attrs["export_attrs"]; !ok {
+		return nil
+	}
+	if typ := handlerType(n); typ != "tool" && typ != "verification" {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets export_attrs but is not a tool or verification node", n.ID)}}
+	}
+	d := []Diagnostic{}
+	seen := map[string]string{}
+	for _, attr := range exportAttrs(n) {
+		name := exportAttrEnvName(attr)
+		if prev, ok := seen[name]; ok && prev != attr {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s export_attrs %q and %q both export %s", n.ID, prev, attr, name)})
+			continue
+		}
+		seen[name] = attr
+		if _, ok := n.Attrs[attr]; !ok {
+			d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s export_attrs names %q, which is not set; %s will be empty", n.ID, attr, name)})
+			continue
+		}
+		if strings.ContainsAny(n.StringAttr(attr, ""), "\r\n") {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s export_attrs value of %q contains a newline", n.ID, attr)})
+		}
+	}
+	return d
+}
+
+// withNodeEnv records the names of the variables a tool or verification
+// stage exports to its commands.
+func withNodeEnv(ev map[string]any, node *Node) map[string]any {
+	if typ := handlerType(node); typ != "tool" && typ != "verification" {
+		return ev
+	}
+	ev["exported_env"] = nodeEnvExportedNames(node)
+	return ev
+}
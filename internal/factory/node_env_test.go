@@ -0,0 +1,72 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestToolAndVerificationCommandsGetNodeEnv(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=parallelogram, tool_command="./dump.sh", export_attrs="target, build.profile", target="linux", "build.profile"="release"];
+	generate [shape=box, "test.verification_plan_json"="{\"files\":[],\"commands\":[\"./dump.sh\"]}"];
+	verify [shape=parallelogram, type=verification, export_attrs="target", target="darwin", "verification.allowed_commands"="./dump.sh"];
+	exit [shape=Msquare];
+	start -> build -> generate -> verify -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeExecutable(t, filepath.Join(workdir, "dump.sh"), `printf '%s|%s|%s|%s|%s|%s|%s|%s\n' "$ATTRACTOR_RUN_ID" "$ATTRACTOR_NODE_ID" "$ATTRACTOR_NODE_TYPE" "$ATTRACTOR_NODE_DIR" "$ATTRACTOR_WORKSPACE" "$ATTRACTOR_ATTEMPT" "$ATTRACTOR_ATTR_TARGET" "$ATTRACTOR_ATTR_BUILD_PROFILE" > "env.$ATTRACTOR_NODE_ID.txt"`)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ne1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ne1")
+	workspace, _ := filepath.Abs(filepath.Join(runDir, "workspace"))
+	want := map[string]string{
+		"build":  "ne1|build|tool|" + filepath.Join(filepath.Dir(workspace), "build") + "|" + workspace + "|0|linux|release",
+		"verify": "ne1|verify|verification|" + filepath.Join(filepath.Dir(workspace), "verify") + "|" + workspace + "|0|darwin|",
+	}
+	for node, line := range want {
+		b, err := os.ReadFile(filepath.Join(workspace, "env."+node+".txt"))
+		if err != nil || strings.TrimSpace(string(b)) != line {
+			t.Fatalf("%s env = %q (%v), want %q", node, b, err, line)
+		}
+	}
+	for _, ev := range readJSONLRecords(t, filepath.Join(runDir, "events.jsonl")) {
+		if ev["type"] == "StageStarted" && ev["node_id"] == "build" {
+			names, _ := ev["exported_env"].([]any)
+			if len(names) != 8 || names[6] != "ATTRACTOR_ATTR_TARGET" || names[7] != "ATTRACTOR_ATTR_BUILD_PROFILE" {
+				t.Fatalf("exported_env = %v", ev["exported_env"])
+			}
+			return
+		}
+	}
+	t.Fatal("no StageStarted event for build")
+}
+
+func TestValidateExportAttrs(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="true", export_attrs="note,missing", note="two\nlines"];
+	b [shape=box, export_attrs="note", note="x"];
+	exit [shape=Msquare];
+	start -> a -> b -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, d := range ValidateGraph(g) {
+		if strings.Contains(d.Message, "export_attrs") {
+			got = append(got, d.Level+": "+d.Message)
+		}
+	}
+	joined := strings.Join(got, "\n")
+	for _, want := range []string{"ERROR: node a export_attrs value of \"note\" contains a newline", "WARN: node a export_attrs names \"missing\"", "ERROR: node b sets export_attrs but is not a tool or verification node"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("diagnostics missing %q:\n%s", want, joined)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package attractor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNotifyOn       = "failure,complete"
+	notifyAttempts        = 3
+	defaultNotifyBackoff  = time.Second
+	notifyRequestTimeout  = 10 * time.Second
+	notifyFlushTimeout    = 15 * time.Second
+	notifyRedactedURLText = "[notify_url]"
+)
+
+// notifyTriggers maps notify_on values to the events that fire them. An
+// aborted run (disk space, fail-fast guardrail, retry budget) is a failure.
+var notifyTriggers = map[string][]string{
+	"complete":  {"PipelineCompleted"},
+	"failure":   {"PipelineFailed", "PipelineAborted"},
+	"guardrail": {"GuardrailViolation"},
+}
+
+// NotifyConfig posts run outcomes to a webhook. Empty fields fall back to the
+// graph's notify_url and notify_on attributes.
+type NotifyConfig struct {
+	URL string
+	// On lists triggers: failure, guardrail, complete.
+	On []string
+	// Backoff is the delay before the first retry; it doubles per attempt.
+	Backoff time.Duration
+}
+
+// notificationPayload is the JSON body posted to notify_url.
+type notificationPayload struct {
+	RunID           string  `json:"run_id"`
+	Status          string  `json:"status"`
+	Trigger         string  `json:"trigger"`
+	NodeID          string  `json:"node_id,omitempty"`
+	FailedNode      string  `json:"failed_node,omitempty"`
+	FailureReason   string  `json:"failure_reason,omitempty"`
+	FailureCode     string  `json:"failure_code,omitempty"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	RunDir          string  `json:"run_dir"`
+	At              string  `json:"at"`
+}
+
+// parseNotifyOn splits a comma-separated notify_on list.
+func parseNotifyOn(raw []string) (map[string]bool, error) {
+	on := map[string]bool{}
+	for _, item := range raw {
+		for _, v := range strings.Split(item, ",") {
+			v = strings.ToLower(strings.TrimSpace(v))
+			if v == "" {
+				continue
+			}
+			if _, ok := notifyTriggers[v]; !ok {
+				return nil, fmt.Errorf("invalid notify_on value %q (expected failure, guardrail, or complete)", v)
+			}
+			on[v] = true
+		}
+	}
+	return on, nil
+}
+
+func validateNotifyAttrs(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	if raw, ok := g.Attrs["notify_on"]; ok {
+		if _, err := parseNotifyOn([]string{fmt.Sprintf("%v", raw)}); err != nil {
+			d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
+		}
+	}
+	if raw, ok := g.Attrs["notify_url"]; ok {
+		u := strings.TrimSpace(fmt.Sprintf("%v", raw))
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			d = append(d, Diagnostic{Level: "ERROR", Message: "notify_url must be an http or https URL"})
+		}
+	}
+	return d
+}
+
+// runNotifier posts notifications for recorded events. Deliveries run in the
+// background so a slow or broken webhook never holds up a stage; wait bounds
+// how long the end of RunPipeline lingers for them.
+type runNotifier struct {
+	url     string
+	on      map[string]bool
+	backoff time.Duration
+	runID   string
+	runDir  string
+	logger  *slog.Logger
+	client  *http.Client
+	started time.Time
+	// lastFailedNode, lastFailureReason and lastFailureCode come from the
+	// latest StageFailed.
+	lastFailedNode    string
+	lastFailureReason string
+	lastFailureCode   string
+	wg                sync.WaitGroup
+}
+
+func newRunNotifier(cfg RunConfig, g *Graph, runDir string, logger *slog.Logger) (*runNotifier, error) {
+	url := strings.TrimSpace(cfg.Notify.URL)
+	if url == "" {
+		if raw, ok := g.Attrs["notify_url"]; ok {
+			url = strings.TrimSpace(fmt.Sprintf("%v", raw))
+		}
+	}
+	if url == "" {
+		return nil, nil
+	}
+	raw := cfg.Notify.On
+	if len(raw) == 0 {
+		if v, ok := g.Attrs["notify_on"]; ok {
+			raw = []string{fmt.Sprintf("%v", v)}
+		} else {
+			raw = []string{defaultNotifyOn}
+		}
+	}
+	on, err := parseNotifyOn(raw)
+	if err != nil {
+		return nil, err
+	}
+	backoff := cfg.Notify.Backoff
+	if backoff <= 0 {
+		backoff = defaultNotifyBackoff
+	}
+	return &runNotifier{url: url, on: on, backoff: backoff, runID: cfg.RunID, runDir: runDir, logger: logger,
+		client: &http.Client{Timeout: notifyRequestTimeout}, started: time.Now().UTC()}, nil
+}
+
+// observe sends a notification when ev matches an enabled trigger.
+func (n *runNotifier) observe(ev map[string]any) {
+	if n == nil {
+		return
+	}
+	typ, _ := ev["type"].(string)
+	raw, _ := ev["at"].(string)
+	at, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		at = time.Now().UTC()
+	}
+	switch typ {
+	case "PipelineStarted":
+		n.started = at
+		return
+	case "StageFailed":
+		n.lastFailedNode, _ = ev["node_id"].(string)
+		n.lastFailureReason, _ = ev["failure_reason"].(string)
+		n.lastFailureCode, _ = ev["failure_code"].(string)
+		return
+	}
+	trigger := ""
+	for name, eventTypes := range notifyTriggers {
+		if slices.Contains(eventTypes, typ) && n.on[name] {
+			trigger = name
+		}
+	}
+	if trigger == "" {
+		return
+	}
+	p := notificationPayload{
+		RunID:           n.runID,
+		Trigger:         trigger,
+		DurationSeconds: at.Sub(n.started).Seconds(),
+		RunDir:          n.runDir,
+		At:              at.Format(time.RFC3339Nano),
+	}
+	switch typ {
+	case "PipelineCompleted":
+		p.Status = "completed"
+	case "PipelineFailed", "PipelineAborted":
+		p.Status = "failed"
+		if typ == "PipelineAborted" {
+			p.Status = "aborted"
+		}
+		p.FailedNode = n.lastFailedNode
+		p.FailureReason = n.lastFailureReason
+		p.FailureCode = n.lastFailureCode
+		p.Error, _ = ev["error"].(string)
+	case "GuardrailViolation":
+		p.Status = "guardrail_violation"
+		p.NodeID, _ = ev["node_id"].(string)
+		if paths, ok := ev["paths"].([]string); ok {
+			p.FailureReason = "guardrail_violation: wrote disallowed files: " + strings.Join(paths, ",")
+			p.FailureCode = string(FailureGuardrailWriteViolation)
+		}
+	}
+	p = redactNotificationPayload(p, os.Environ())
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.deliver(p)
+	}()
+}
+
+// deliver posts p, retrying with exponential backoff, and records the result
+// as NotificationSent or NotificationFailed.
+func (n *runNotifier) deliver(p notificationPayload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	delay := n.backoff
+	var lastErr error
+	for attempt := 1; attempt <= notifyAttempts; attempt++ {
+		status, err := n.post(body)
+		if err == nil {
+			_ = appendEvent(n.runDir, map[string]any{"schema_version": 1, "type": "NotificationSent", "trigger": p.Trigger, "attempts": attempt, "status_code": status, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+			return
+		}
+		lastErr = err
+		if attempt < notifyAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	msg := strings.ReplaceAll(lastErr.Error(), n.url, notifyRedactedURLText)
+	n.logger.Warn("notification delivery failed", "trigger", p.Trigger, "attempts", notifyAttempts, "error", msg)
+	_ = appendEvent(n.runDir, map[string]any{"schema_version": 1, "type": "NotificationFailed", "trigger": p.Trigger, "attempts": notifyAttempts, "error": msg, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+}
+
+func (n *runNotifier) post(body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// wait gives in-flight deliveries up to notifyFlushTimeout to finish.
+func (n *runNotifier) wait() {
+	if n == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(notifyFlushTimeout):
+		n.logger.Warn("notification delivery still pending at exit", "timeout", notifyFlushTimeout.String())
+	}
+}
+
+func redactNotificationPayload(p notificationPayload, environ []string) notificationPayload {
+	for _, s := range []*string{&p.FailureReason, &p.Error, &p.FailedNode, &p.NodeID, &p.RunDir} {
+		*s = redactSecretValues(*s, environ)
+	}
+	return p
+}
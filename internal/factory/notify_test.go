@@ -0,0 +1,155 @@
+package attractor
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type notifyRecorder struct {
+	mu       sync.Mutex
+	payloads []notificationPayload
+	failures int
+}
+
+func (r *notifyRecorder) server(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.failures > 0 {
+			r.failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		b, _ := io.ReadAll(req.Body)
+		var p notificationPayload
+		if err := json.Unmarshal(b, &p); err != nil {
+			t.Errorf("bad payload %q: %v", b, err)
+		}
+		r.payloads = append(r.payloads, p)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func eventsOfType(t *testing.T, runDir, typ string) []map[string]any {
+	t.Helper()
+	out := []map[string]any{}
+	for _, ev := range readJSONLRecords(t, filepath.Join(runDir, "events.jsonl")) {
+		if ev["type"] == typ {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func TestNotifyOnPipelineFailure(t *testing.T) {
+	rec := &notifyRecorder{failures: 1}
+	srv := rec.server(t)
+	dot := `digraph G {
+	graph [notify_url="` + srv.URL + `"];
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="exit 3"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit [condition="outcome=success"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "n1", Notify: NotifyConfig{Backoff: time.Millisecond}})
+	if err == nil {
+		t.Fatal("expected pipeline failure")
+	}
+	if len(rec.payloads) != 1 {
+		t.Fatalf("payloads = %+v", rec.payloads)
+	}
+	p := rec.payloads[0]
+	if p.RunID != "n1" || p.Status != "failed" || p.Trigger != "failure" || p.FailedNode != "t" || p.FailureReason != "tool_exit_code_3" {
+		t.Fatalf("payload = %+v", p)
+	}
+	if p.RunDir != filepath.Join(runsdir, "n1") || p.Error == "" {
+		t.Fatalf("payload = %+v", p)
+	}
+	sent := eventsOfType(t, filepath.Join(runsdir, "n1"), "NotificationSent")
+	if len(sent) != 1 || sent[0]["attempts"] != float64(2) || sent[0]["trigger"] != "failure" {
+		t.Fatalf("NotificationSent events = %v", sent)
+	}
+}
+
+func TestNotifyOnSelectsTriggers(t *testing.T) {
+	rec := &notifyRecorder{}
+	srv := rec.server(t)
+	dot := `digraph G {
+	graph [notify_on="guardrail,complete"];
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="echo hi > out.txt", allowed_write_paths="src/"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "n2", Notify: NotifyConfig{URL: srv.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	byStatus := map[string]notificationPayload{}
+	for _, p := range rec.payloads {
+		byStatus[p.Status] = p
+	}
+	if len(rec.payloads) != 2 || byStatus["completed"].Trigger != "complete" {
+		t.Fatalf("payloads = %+v", rec.payloads)
+	}
+	if g := byStatus["guardrail_violation"]; g.NodeID != "t" || !strings.Contains(g.FailureReason, "out.txt") {
+		t.Fatalf("guardrail payload = %+v", g)
+	}
+}
+
+func TestNotifyDeliveryFailureDoesNotFailRun(t *testing.T) {
+	rec := &notifyRecorder{failures: notifyAttempts}
+	srv := rec.server(t)
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	exit [shape=Msquare];
+	start -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "n3", Notify: NotifyConfig{URL: srv.URL, Backoff: time.Millisecond}}); err != nil {
+		t.Fatal(err)
+	}
+	failed := eventsOfType(t, filepath.Join(runsdir, "n3"), "NotificationFailed")
+	if len(failed) != 1 || failed[0]["attempts"] != float64(notifyAttempts) {
+		t.Fatalf("NotificationFailed events = %v", failed)
+	}
+	if msg, _ := failed[0]["error"].(string); strings.Contains(msg, srv.URL) {
+		t.Fatalf("error leaks webhook URL: %q", msg)
+	}
+}
+
+func TestNotifyPayloadRedactsSecrets(t *testing.T) {
+	env := []string{"FACTORY_API_TOKEN=sk-live-123456", "FACTORY_MODE=sk-live-123456-not-secret", "SHORT_KEY=abc"}
+	p := redactNotificationPayload(notificationPayload{FailureReason: "auth failed with sk-live-123456", Error: "abc stays"}, env)
+	if p.FailureReason != "auth failed with [redacted]" || p.Error != "abc stays" {
+		t.Fatalf("payload = %+v", p)
+	}
+}
+
+func TestValidateNotifyAttrs(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	graph [notify_url="slack", notify_on="failure,sometimes"];
+	start [shape=Mdiamond];
+	exit [shape=Msquare];
+	start -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	if !strings.Contains(msgs, `invalid notify_on value "sometimes"`) || !strings.Contains(msgs, "notify_url must be an http or https URL") {
+		t.Fatalf("diagnostics = %s", msgs)
+	}
+}
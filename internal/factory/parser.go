@@ -7,9 +7,27 @@ import (
 	"strings"
 )
 
-var idRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var idRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
 
 func ParseDOT(input string) (*Graph, error) {
+	g, err := parseDOTStatements(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := expandMatrix(g); err != nil {
+		return nil, err
+	}
+	if err := expandGroupEdges(g); err != nil {
+		return nil, err
+	}
+	assignEdgeIDs(g)
+	return g, nil
+}
+
+// parseDOTStatements parses the graph as written: node and edge defaults are
+// folded into the statements that follow them, but matrix nodes and
+// group_edge statements are not expanded and edges get no ids.
+func parseDOTStatements(input string) (*Graph, error) {
 	input = stripComments(input)
 	trimmed := strings.TrimSpace(input)
 	if strings.Count(trimmed, "digraph") != 1 {
@@ -18,7 +36,7 @@ func ParseDOT(input string) (*Graph, error) {
 	if strings.Contains(trimmed, "subgraph") {
 		return nil, fmt.Errorf("subgraphs are unsupported in v0")
 	}
-	if strings.Contains(trimmed, "--") {
+	if indexOutsideQuotes(trimmed, "--") >= 0 {
 		return nil, fmt.Errorf("undirected edges are unsupported")
 	}
 	start := strings.Index(trimmed, "{")
@@ -41,7 +59,7 @@ func ParseDOT(input string) (*Graph, error) {
 			continue
 		}
 		switch {
-		case strings.HasPrefix(stmt, "graph"):
+		case hasStmtKeyword(stmt, "graph"):
 			attrs, err := parseStmtAttrs(stmt[len("graph"):])
 			if err != nil {
 				return nil, err
@@ -49,7 +67,7 @@ func ParseDOT(input string) (*Graph, error) {
 			for k, v := range attrs {
 				g.Attrs[k] = v
 			}
-		case strings.HasPrefix(stmt, "node"):
+		case hasStmtKeyword(stmt, "node"):
 			attrs, err := parseStmtAttrs(stmt[len("node"):])
 			if err != nil {
 				return nil, err
@@ -57,7 +75,7 @@ func ParseDOT(input string) (*Graph, error) {
 			for k, v := range attrs {
 				nodeDefaults[k] = v
 			}
-		case strings.HasPrefix(stmt, "edge"):
+		case hasStmtKeyword(stmt, "edge"):
 			attrs, err := parseStmtAttrs(stmt[len("edge"):])
 			if err != nil {
 				return nil, err
@@ -65,7 +83,11 @@ func ParseDOT(input string) (*Graph, error) {
 			for k, v := range attrs {
 				edgeDefaults[k] = v
 			}
-		case strings.Contains(stmt, "->"):
+		case hasGroupEdgeKeyword(stmt):
+			if err := parseGroupEdgeStmt(g, stmt, edgeDefaults); err != nil {
+				return nil, err
+			}
+		case indexOutsideQuotes(stmt, "->") >= 0:
 			err := parseEdgeStmt(g, stmt, edgeDefaults)
 			if err != nil {
 				return nil, err
@@ -80,6 +102,85 @@ func ParseDOT(input string) (*Graph, error) {
 	return g, nil
 }
 
+// assignEdgeIDs gives every edge its explicit id attribute or a synthetic
+// `<from>-<to>-<n>` id, n counting earlier edges between the same pair.
+// Endpoints containing `-` are quoted (edgeIDPart), so `a -> "b-c"` and
+// `"a-b" -> c` get distinct ids.
+func assignEdgeIDs(g *Graph) {
+	seen := map[[2]string]int{}
+	for _, e := range g.Edges {
+		pair := [2]string{e.From, e.To}
+		n := seen[pair]
+		seen[pair] = n + 1
+		if id := strings.TrimSpace(e.StringAttr("id", "")); id != "" {
+			e.ID = id
+			continue
+		}
+		e.ID = fmt.Sprintf("%s-%s-%d", edgeIDPart(e.From), edgeIDPart(e.To), n)
+	}
+}
+
+// edgeIDPart returns a node ID as it appears in a synthetic edge id: as is,
+// or Go-quoted when it contains the `-` separator or a quote.
+func edgeIDPart(id string) string {
+	if strings.ContainsAny(id, `-"`) {
+		return strconv.Quote(id)
+	}
+	return id
+}
+
+// hasStmtKeyword reports whether stmt is a graph/node/edge default statement
+// rather than a node whose ID merely starts with the keyword.
+func hasStmtKeyword(stmt, kw string) bool {
+	if !strings.HasPrefix(stmt, kw) {
+		return false
+	}
+	rest := strings.TrimLeft(stmt[len(kw):], " \t\r\n")
+	return rest == "" || strings.HasPrefix(rest, "[")
+}
+
+// indexOutsideQuotes returns the index of the first sub outside double-quoted
+// strings, or -1.
+func indexOutsideQuotes(s, sub string) int {
+	inQuote := false
+	escaped := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' && !escaped {
+			inQuote = !inQuote
+		}
+		if !inQuote && strings.HasPrefix(s[i:], sub) {
+			return i
+		}
+		escaped = c == '\\' && !escaped
+	}
+	return -1
+}
+
+// parseNodeID returns the canonical (unquoted) form of a node ID. Quoted IDs
+// may contain any characters; unquoted IDs must match idRe.
+func parseNodeID(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) >= 2 && strings.HasPrefix(raw, "\"") && strings.HasSuffix(raw, "\"") {
+		id, err := strconv.Unquote(raw)
+		if err != nil || strings.TrimSpace(id) == "" {
+			return "", false
+		}
+		return id, true
+	}
+	return raw, idRe.MatchString(raw)
+}
+
+// stripEdgePort drops a Graphviz port or compass point (`a:out`, `a:out:n`,
+// `"a b":s`) from an edge endpoint; ports have no meaning for routing.
+func stripEdgePort(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if i := indexOutsideQuotes(raw, ":"); i > 0 {
+		return raw[:i]
+	}
+	return raw
+}
+
 func stripComments(in string) string {
 	lines := strings.Split(in, "\n")
 	out := make([]string, 0, len(lines))
@@ -134,10 +235,10 @@ func parseStmtAttrs(s string) (map[string]Value, error) {
 }
 
 func parseNodeStmt(g *Graph, stmt string, defaults map[string]Value) error {
-	id := strings.TrimSpace(stmt)
+	rawID := strings.TrimSpace(stmt)
 	attrs := map[string]Value{}
-	if i := strings.Index(stmt, "["); i >= 0 {
-		id = strings.TrimSpace(stmt[:i])
+	if i := indexOutsideQuotes(stmt, "["); i >= 0 {
+		rawID = strings.TrimSpace(stmt[:i])
 		j := strings.LastIndex(stmt, "]")
 		if j <= i {
 			return fmt.Errorf("invalid node attrs: %s", stmt)
@@ -148,8 +249,9 @@ func parseNodeStmt(g *Graph, stmt string, defaults map[string]Value) error {
 		}
 		attrs = parsed
 	}
-	if !idRe.MatchString(id) {
-		return fmt.Errorf("invalid node id: %s", id)
+	id, ok := parseNodeID(rawID)
+	if !ok {
+		return fmt.Errorf("invalid node id: %s", rawID)
 	}
 	n := g.Nodes[id]
 	if n == nil {
@@ -168,7 +270,7 @@ func parseNodeStmt(g *Graph, stmt string, defaults map[string]Value) error {
 func parseEdgeStmt(g *Graph, stmt string, defaults map[string]Value) error {
 	lhs := stmt
 	attrs := map[string]Value{}
-	if i := strings.Index(stmt, "["); i >= 0 {
+	if i := indexOutsideQuotes(stmt, "["); i >= 0 {
 		lhs = strings.TrimSpace(stmt[:i])
 		j := strings.LastIndex(stmt, "]")
 		if j <= i {
@@ -180,14 +282,25 @@ func parseEdgeStmt(g *Graph, stmt string, defaults map[string]Value) error {
 		}
 		attrs = parsed
 	}
-	parts := strings.Split(lhs, "->")
-	ids := make([]string, 0, len(parts))
-	for _, p := range parts {
-		id := strings.TrimSpace(p)
-		if !idRe.MatchString(id) {
-			return fmt.Errorf("invalid edge endpoint: %s", id)
+	ids := []string{}
+	for {
+		i := indexOutsideQuotes(lhs, "->")
+		part := lhs
+		if i >= 0 {
+			part = lhs[:i]
+		}
+		id, ok := parseNodeID(stripEdgePort(part))
+		if !ok {
+			return fmt.Errorf("invalid edge endpoint: %s", strings.TrimSpace(part))
 		}
 		ids = append(ids, id)
+		if i < 0 {
+			break
+		}
+		lhs = lhs[i+2:]
+	}
+	if _, ok := attrs["id"]; ok && len(ids) > 2 {
+		return fmt.Errorf("edge id on chained edge statement %s: split it into one statement per hop", strings.TrimSpace(stmt))
 	}
 	for i := 0; i < len(ids)-1; i++ {
 		eAttrs := map[string]Value{}
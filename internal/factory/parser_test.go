@@ -1,6 +1,9 @@
 package attractor
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestParseMinimal(t *testing.T) {
 	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a; a -> exit; }`
@@ -64,3 +67,92 @@ func TestParseUnknownAttrsPreserved(t *testing.T) {
 		t.Fatalf("unknown edge attr missing")
 	}
 }
+
+func TestParseQuotedAndDashedNodeIDs(t *testing.T) {
+	dot := `digraph G {
+	  start [shape=Mdiamond];
+	  "build & test" [shape=box, label="a -> b"];
+	  fix-lint.v2 [shape=box];
+	  node_a [shape=box];
+	  exit [shape=Msquare];
+	  start -> "build & test" -> fix-lint.v2;
+	  fix-lint.v2 -> node_a -> exit;
+	}`
+	g, err := ParseDOT(dot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"build & test", "fix-lint.v2", "node_a"} {
+		if g.Nodes[id] == nil {
+			t.Fatalf("missing node %q in %v", id, g.Nodes)
+		}
+	}
+	if g.Nodes["build & test"].Label() != "a -> b" {
+		t.Fatalf("quoted node attrs lost: %+v", g.Nodes["build & test"].Attrs)
+	}
+	if len(g.Edges) != 4 || g.Edges[0].To != "build & test" || g.Edges[1].From != "build & test" {
+		t.Fatalf("unexpected edges: %+v", g.Edges)
+	}
+	if d := ValidateGraph(g); len(d) > 0 {
+		t.Fatalf("unexpected diagnostics: %+v", d)
+	}
+}
+
+func TestParseRejectsEmptyQuotedID(t *testing.T) {
+	if _, err := ParseDOT(`digraph G { "" [shape=box]; }`); err == nil {
+		t.Fatal("expected error for empty quoted id")
+	}
+}
+
+func TestParseAssignsEdgeIDs(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond]; a; exit [shape=Msquare];
+	start:out -> a:in:n -> exit [weight=2];
+	a -> exit [id="a_done_on_success", condition="outcome=success"];
+	a:s -> exit:n;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, e := range g.Edges {
+		got = append(got, e.ID)
+	}
+	want := "start-a-0 a-exit-0 a_done_on_success a-exit-2"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("edge ids = %v, want %s", got, want)
+	}
+	if g.Edges[0].From != "start" || g.Edges[1].To != "exit" {
+		t.Fatalf("ports not stripped: %+v %+v", g.Edges[0], g.Edges[1])
+	}
+}
+
+func TestParseEdgeIDsDistinguishDashedEndpoints(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond]; a; "b-c"; "a-b"; c; exit [shape=Msquare];
+	start -> a -> "b-c" -> "a-b" -> c -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, e := range g.Edges {
+		got = append(got, e.ID)
+	}
+	want := `start-a-0 a-"b-c"-0 "b-c"-"a-b"-0 "a-b"-c-0 c-exit-0`
+	if strings.Join(got, " ") != want {
+		t.Fatalf("edge ids = %v, want %s", got, want)
+	}
+	for _, d := range ValidateGraph(g) {
+		if strings.Contains(d.Message, "duplicate edge id") {
+			t.Fatalf("unexpected diagnostic: %s", d.Message)
+		}
+	}
+}
+
+func TestParseRejectsEdgeIDOnChain(t *testing.T) {
+	_, err := ParseDOT(`digraph G { a -> b -> c [id="x"]; }`)
+	if err == nil || !strings.Contains(err.Error(), "edge id on chained edge statement") {
+		t.Fatalf("err = %v", err)
+	}
+}
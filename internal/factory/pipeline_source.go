@@ -0,0 +1,61 @@
+package attractor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadPipelineSource returns the DOT text for a run and where it came from:
+// graph (RunConfig.Graph), inline (RunConfig.PipelineSource), path, or
+// manifest. A resume with no
+// pipeline given, or whose pipeline file no longer exists, runs the copy
+// embedded in the run's manifest.
+func loadPipelineSource(cfg RunConfig) (string, string, error) {
+	if cfg.Graph != nil {
+		return cfg.Graph.ToDOT(), "graph", nil
+	}
+	if cfg.PipelineSource != "" {
+		return cfg.PipelineSource, "inline", nil
+	}
+	path := strings.TrimSpace(cfg.PipelinePath)
+	if path != "" && path != "-" {
+		b, err := os.ReadFile(path)
+		if err == nil {
+			return string(b), "path", nil
+		}
+		if !cfg.Resume || !errors.Is(err, os.ErrNotExist) {
+			return "", "", err
+		}
+	}
+	if !cfg.Resume || cfg.RunID == "" {
+		return "", "", fmt.Errorf("no pipeline given: pass a pipeline path, RunConfig.PipelineSource, or RunConfig.Graph")
+	}
+	source, err := readManifestPipelineSource(filepath.Join(cfg.Runsdir, cfg.RunID))
+	if err != nil {
+		return "", "", err
+	}
+	return source, "manifest", nil
+}
+
+// readManifestPipelineSource returns the pipeline text embedded in a run's
+// manifest.
+func readManifestPipelineSource(runDir string) (string, error) {
+	var m struct {
+		PipelineSource string `json:"pipeline_source"`
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return "", fmt.Errorf("invalid manifest in %s: %w", runDir, err)
+	}
+	if m.PipelineSource == "" {
+		return "", fmt.Errorf("manifest in %s has no embedded pipeline; pass the pipeline path", runDir)
+	}
+	return m.PipelineSource, nil
+}
@@ -0,0 +1,47 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunPipelineFromInlineSourceAndResumeFromManifest(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; b [shape=box]; exit [shape=Msquare]; start -> a; a -> b; b -> exit; }`
+	workdir, runsdir, _ := setupRun(t, dot)
+	err := RunPipeline(RunConfig{PipelineSource: dot, Workdir: workdir, Runsdir: runsdir, RunID: "ps1"})
+	if err == nil || !strings.Contains(err.Error(), "test_stop") {
+		t.Fatalf("expected test stop error, got %v", err)
+	}
+	runDir := filepath.Join(runsdir, "ps1")
+	if source, err := readManifestPipelineSource(runDir); err != nil || source != dot {
+		t.Fatalf("manifest pipeline_source = %q (%v)", source, err)
+	}
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	missing := filepath.Join(t.TempDir(), "deleted.dot")
+	if err := RunPipeline(RunConfig{PipelinePath: missing, Workdir: workdir, Runsdir: runsdir, RunID: "ps1", Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "b", "status.json")); err != nil {
+		t.Fatalf("resume did not run b: %v", err)
+	}
+	if source, err := readManifestPipelineSource(runDir); err != nil || source != dot {
+		t.Fatalf("resumed manifest pipeline_source = %q (%v)", source, err)
+	}
+}
+
+func TestLoadPipelineSourcePrecedence(t *testing.T) {
+	_, _, pipeline := setupRun(t, "digraph FromFile {}")
+	if src, origin, err := loadPipelineSource(RunConfig{PipelinePath: pipeline, PipelineSource: "digraph Inline {}"}); err != nil || origin != "inline" || src != "digraph Inline {}" {
+		t.Fatalf("inline: %q %q %v", src, origin, err)
+	}
+	if src, origin, err := loadPipelineSource(RunConfig{PipelinePath: pipeline}); err != nil || origin != "path" || src != "digraph FromFile {}" {
+		t.Fatalf("path: %q %q %v", src, origin, err)
+	}
+	if _, _, err := loadPipelineSource(RunConfig{PipelinePath: filepath.Join(t.TempDir(), "gone.dot")}); !os.IsNotExist(err) {
+		t.Fatalf("missing file without resume: %v", err)
+	}
+}
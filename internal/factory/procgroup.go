@@ -0,0 +1,101 @@
+package attractor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// processGroupGrace is how long reapProcessGroup waits after SIGTERM
+	// before escalating to SIGKILL.
+	processGroupGrace = 2 * time.Second
+	// processOutputDrain bounds how long output readers may keep running
+	// once the group has been reaped, for descendants that left the group.
+	processOutputDrain  = 2 * time.Second
+	reapedProcessesFile = "processes.reaped.txt"
+)
+
+// runProcessGroup runs cmd as the leader of a new process group and returns
+// its captured output. Once the leader exits, any descendants still in the
+// group are terminated so a backgrounded child can neither outlive the stage
+// nor hold the output pipes open. reaped counts those descendants.
+func runProcessGroup(cmd *exec.Cmd) (stdout, stderr []byte, reaped int, err error) {
+	setProcessGroup(cmd)
+	// Plain *os.File pipes keep exec from starting copy goroutines that Wait
+	// would block on while a descendant still holds the write side.
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		outR.Close()
+		outW.Close()
+		return nil, nil, 0, err
+	}
+	cmd.Stdout = outW
+	cmd.Stderr = errW
+	startErr := cmd.Start()
+	outW.Close()
+	errW.Close()
+	if startErr != nil {
+		outR.Close()
+		errR.Close()
+		return nil, nil, 0, startErr
+	}
+	var outB, errB bytes.Buffer
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); _, _ = io.Copy(&outB, outR) }()
+	go func() { defer wg.Done(); _, _ = io.Copy(&errB, errR) }()
+	waitErr := cmd.Wait()
+	reaped = reapProcessGroup(cmd.Process.Pid, processGroupGrace)
+	drained := make(chan struct{})
+	go func() { wg.Wait(); close(drained) }()
+	select {
+	case <-drained:
+	case <-time.After(processOutputDrain):
+		outR.Close()
+		errR.Close()
+		<-drained
+	}
+	outR.Close()
+	errR.Close()
+	return outB.Bytes(), errB.Bytes(), reaped, waitErr
+}
+
+// recordReapedProcesses adds n to the stage's reaped-process count so the
+// engine can report it on the stage event.
+func recordReapedProcesses(nodeDir string, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	total := readReapedProcesses(nodeDir) + n
+	return os.WriteFile(filepath.Join(nodeDir, reapedProcessesFile), []byte(fmt.Sprintf("%d\n", total)), 0o644)
+}
+
+func readReapedProcesses(nodeDir string) int {
+	b, err := os.ReadFile(filepath.Join(nodeDir, reapedProcessesFile))
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return n
+}
+
+// withReapedProcesses adds reaped_processes to a stage event when the
+// stage's commands left descendants behind.
+func withReapedProcesses(ev map[string]any, nodeDir string) map[string]any {
+	if n := readReapedProcesses(nodeDir); n > 0 {
+		ev["reaped_processes"] = n
+	}
+	return ev
+}
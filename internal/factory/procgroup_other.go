@@ -0,0 +1,20 @@
+//go:build !unix
+
+package attractor
+
+import (
+	"os/exec"
+	"time"
+)
+
+func setProcessGroup(*exec.Cmd) {}
+
+func terminateProcessGroup(*exec.Cmd) error { return nil }
+
+func reapProcessGroup(int, time.Duration) int { return 0 }
+
+func processGroupCPUTime(int) (time.Duration, bool) { return 0, false }
+
+// pidAlive cannot probe processes here; lock liveness then rests on the
+// run heartbeat alone.
+func pidAlive(int) bool { return true }
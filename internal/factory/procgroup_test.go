@@ -0,0 +1,92 @@
+//go:build unix
+
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestToolStageReapsBackgroundedChild(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="sh spawn.sh"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	// The child keeps the inherited stdout open, so the stage would also hang
+	// until it exits if the group were not reaped.
+	writeFile(t, filepath.Join(workdir, "spawn.sh"), "sleep 30 &\necho $! > child.pid\necho spawned\n")
+	started := time.Now()
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "pg1"}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed > 20*time.Second {
+		t.Fatalf("stage waited for the backgrounded child: %s", elapsed)
+	}
+	b, err := os.ReadFile(filepath.Join(runsdir, "pg1", "workspace", "child.pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countProcessGroup(pid) != 0 || processAlive(pid) {
+		t.Fatalf("child %d still running after stage ended", pid)
+	}
+	out, _ := os.ReadFile(filepath.Join(runsdir, "pg1", "t", "tool.stdout.txt"))
+	if strings.TrimSpace(string(out)) != "spawned" {
+		t.Fatalf("tool.stdout.txt = %q", out)
+	}
+	reaped := 0
+	for _, ev := range readJSONLRecords(t, filepath.Join(runsdir, "pg1", "events.jsonl")) {
+		if ev["type"] == "StageCompleted" && ev["node_id"] == "t" {
+			n, _ := ev["reaped_processes"].(float64)
+			reaped = int(n)
+		}
+	}
+	if reaped != 1 {
+		t.Fatalf("reaped_processes = %d, want 1", reaped)
+	}
+}
+
+func TestToolStageWithoutChildrenOmitsReapedCount(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="echo hi"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "pg2"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range readJSONLRecords(t, filepath.Join(runsdir, "pg2", "events.jsonl")) {
+		if _, ok := ev["reaped_processes"]; ok {
+			t.Fatalf("unexpected reaped_processes on %v", ev)
+		}
+	}
+}
+
+// processAlive reports whether pid exists and is not a zombie.
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return true
+	}
+	s := string(b)
+	fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+	return len(fields) == 0 || fields[0] != "Z"
+}
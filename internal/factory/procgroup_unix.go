@@ -0,0 +1,131 @@
+//go:build unix
+
+package attractor
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// terminateProcessGroup is used as exec.Cmd.Cancel so a timeout signals the
+// whole group instead of only the leader.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// reapProcessGroup sends SIGTERM to every live member of pgid, escalates to
+// SIGKILL after grace, and returns how many members it found.
+func reapProcessGroup(pgid int, grace time.Duration) int {
+	n := countProcessGroup(pgid)
+	if n == 0 {
+		return 0
+	}
+	_ = syscall.Kill(-pgid, syscall.SIGTERM)
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		if countProcessGroup(pgid) == 0 {
+			return n
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	_ = syscall.Kill(-pgid, syscall.SIGKILL)
+	return n
+}
+
+// countProcessGroup returns the number of live processes in pgid. Zombies
+// are skipped: they already exited and only wait for a parent to collect
+// them. Without /proc it can only tell whether the group exists at all.
+func countProcessGroup(pgid int) int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		if syscall.Kill(-pgid, 0) == nil {
+			return 1
+		}
+		return 0
+	}
+	n := 0
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		b, err := os.ReadFile("/proc/" + e.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// Fields after the parenthesised command name: state ppid pgrp ...
+		s := string(b)
+		i := strings.LastIndexByte(s, ')')
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(s[i+1:])
+		if len(fields) < 3 || fields[0] == "Z" || fields[0] == "X" {
+			continue
+		}
+		if g, err := strconv.Atoi(fields[2]); err == nil && g == pgid {
+			n++
+		}
+	}
+	return n
+}
+
+// processGroupCPUTime sums the user and system CPU time of pgid's live
+// members from /proc. ok is false where /proc is unavailable.
+func processGroupCPUTime(pgid int) (total time.Duration, ok bool) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, false
+	}
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		b, err := os.ReadFile("/proc/" + e.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		s := string(b)
+		i := strings.LastIndexByte(s, ')')
+		if i < 0 {
+			continue
+		}
+		// state ppid pgrp session tty_nr tpgid flags minflt cminflt majflt
+		// cmajflt utime stime, counted in USER_HZ (100 on Linux).
+		fields := strings.Fields(s[i+1:])
+		if len(fields) < 13 {
+			continue
+		}
+		if g, err := strconv.Atoi(fields[2]); err != nil || g != pgid {
+			continue
+		}
+		utime, err1 := strconv.ParseInt(fields[11], 10, 64)
+		stime, err2 := strconv.ParseInt(fields[12], 10, 64)
+		if err1 == nil && err2 == nil {
+			total += time.Duration(utime+stime) * 10 * time.Millisecond
+		}
+	}
+	return total, true
+}
+
+// pidAlive reports whether pid names a live process on this host.
+func pidAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
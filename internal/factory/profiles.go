@@ -0,0 +1,202 @@
+package attractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProfileFileName is the profile file looked for next to the pipeline.
+const ProfileFileName = "factory.json"
+
+// RunProfile is a named set of run settings. Each key has the name of the
+// `factory run` flag it stands in for, with `_` for `-`; unset keys leave
+// the setting alone. GraphAttrs are defaults for graph attributes the
+// pipeline does not set itself.
+type RunProfile struct {
+	Workdir              *string           `json:"workdir,omitempty"`
+	Runsdir              *string           `json:"runsdir,omitempty"`
+	Entry                *string           `json:"entry,omitempty"`
+	DisableNode          []string          `json:"disable_node,omitempty"`
+	Param                map[string]string `json:"param,omitempty"`
+	AcceptWorkspaceDrift *bool             `json:"accept_workspace_drift,omitempty"`
+	OTel                 *bool             `json:"otel,omitempty"`
+	NotifyURL            *string           `json:"notify_url,omitempty"`
+	NotifyOn             *string           `json:"notify_on,omitempty"`
+	NoCache              *bool             `json:"no_cache,omitempty"`
+	MinFreeBytes         *uint64           `json:"min_free_bytes,omitempty"`
+	ReportFormats        *string           `json:"report_formats,omitempty"`
+	Strict               *bool             `json:"strict,omitempty"`
+	FailFastGuardrail    *bool             `json:"fail_fast_guardrail,omitempty"`
+	LogFile              *string           `json:"log_file,omitempty"`
+	Quiet                *bool             `json:"quiet,omitempty"`
+	CheckFiles           *bool             `json:"check_files,omitempty"`
+	GraphAttrs           map[string]string `json:"graph_attrs,omitempty"`
+}
+
+// Profiles is a loaded profile file.
+type Profiles struct {
+	// Path is the file the profiles came from. Relative workdir, runsdir,
+	// and log_file values are resolved against its directory.
+	Path     string                `json:"-"`
+	Profiles map[string]RunProfile `json:"profiles"`
+}
+
+// AppliedProfile is the profile a run used, recorded in manifest.json as
+// profile. Values holds the settings the profile supplied, keyed like the
+// profile file; settings given explicitly on the command line are left out.
+type AppliedProfile struct {
+	Name   string         `json:"name"`
+	File   string         `json:"file"`
+	Values map[string]any `json:"values"`
+}
+
+// DiscoverProfileFile is the profile file next to pipelinePath. For stdin
+// ("-") or no pipeline it is the one in the current directory.
+func DiscoverProfileFile(pipelinePath string) string {
+	if pipelinePath == "" || pipelinePath == "-" {
+		return ProfileFileName
+	}
+	return filepath.Join(filepath.Dir(pipelinePath), ProfileFileName)
+}
+
+// LoadProfiles reads a profile file. Unknown keys, at any level other than
+// graph_attrs, are errors so typos do not silently do nothing.
+func LoadProfiles(path string) (Profiles, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Profiles{}, err
+	}
+	p := Profiles{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return Profiles{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return Profiles{}, fmt.Errorf("%s: unexpected data after the profiles object", path)
+	}
+	for name, prof := range p.Profiles {
+		if strings.TrimSpace(name) == "" {
+			return Profiles{}, fmt.Errorf("%s: profile name is empty", path)
+		}
+		for k := range prof.Param {
+			if !idRe.MatchString(k) {
+				return Profiles{}, fmt.Errorf("%s: profile %s has invalid param name %q", path, name, k)
+			}
+		}
+		if prof.ReportFormats != nil {
+			if _, err := ParseReportFormats(*prof.ReportFormats); err != nil {
+				return Profiles{}, fmt.Errorf("%s: profile %s: %w", path, name, err)
+			}
+		}
+	}
+	p.Path = path
+	return p, nil
+}
+
+// ApplyProfile fills cfg from the named profile. explicit holds the names
+// of flags given on the command line (as flag.FlagSet.Visit reports them);
+// their values win over the profile's. Params merge per name, with explicit
+// ones winning. The result is recorded on cfg.Profile.
+func ApplyProfile(cfg *RunConfig, profiles Profiles, name string, explicit map[string]bool) error {
+	prof, ok := profiles.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %s not found in %s (have: %s)", name, profiles.Path, strings.Join(sortedKeys(profiles.Profiles), ", "))
+	}
+	dir := filepath.Dir(profiles.Path)
+	applied := AppliedProfile{Name: name, File: profiles.Path, Values: map[string]any{}}
+	str := func(key string, v *string, dst *string, isPath bool) {
+		if v == nil || explicit[strings.ReplaceAll(key, "_", "-")] {
+			return
+		}
+		s := *v
+		if isPath && s != "" && !filepath.IsAbs(s) {
+			s = filepath.Join(dir, s)
+		}
+		*dst = s
+		applied.Values[key] = s
+	}
+	boolean := func(key string, v *bool, dst *bool) {
+		if v == nil || explicit[strings.ReplaceAll(key, "_", "-")] {
+			return
+		}
+		*dst = *v
+		applied.Values[key] = *v
+	}
+	str("workdir", prof.Workdir, &cfg.Workdir, true)
+	str("runsdir", prof.Runsdir, &cfg.Runsdir, true)
+	str("log_file", prof.LogFile, &cfg.LogFile, true)
+	str("entry", prof.Entry, &cfg.EntryNode, false)
+	str("notify_url", prof.NotifyURL, &cfg.Notify.URL, false)
+	if prof.NotifyOn != nil && !explicit["notify-on"] {
+		cfg.Notify.On = []string{*prof.NotifyOn}
+		applied.Values["notify_on"] = *prof.NotifyOn
+	}
+	if prof.ReportFormats != nil && !explicit["report-formats"] {
+		formats, err := ParseReportFormats(*prof.ReportFormats)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		cfg.ReportFormats = formats
+		applied.Values["report_formats"] = *prof.ReportFormats
+	}
+	if prof.MinFreeBytes != nil && !explicit["min-free-bytes"] {
+		cfg.MinFreeBytes = *prof.MinFreeBytes
+		applied.Values["min_free_bytes"] = *prof.MinFreeBytes
+	}
+	if prof.DisableNode != nil && !explicit["disable-node"] {
+		cfg.DisableNodes = append([]string{}, prof.DisableNode...)
+		applied.Values["disable_node"] = prof.DisableNode
+	}
+	boolean("accept_workspace_drift", prof.AcceptWorkspaceDrift, &cfg.AcceptWorkspaceDrift)
+	boolean("otel", prof.OTel, &cfg.EnableOTel)
+	boolean("no_cache", prof.NoCache, &cfg.NoCache)
+	boolean("strict", prof.Strict, &cfg.StrictValidation)
+	boolean("fail_fast_guardrail", prof.FailFastGuardrail, &cfg.FailFastOnGuardrail)
+	boolean("quiet", prof.Quiet, &cfg.Quiet)
+	boolean("check_files", prof.CheckFiles, &cfg.CheckFiles)
+	if len(prof.Param) > 0 {
+		params := map[string]string{}
+		used := map[string]string{}
+		for k, v := range prof.Param {
+			if _, ok := cfg.Params[k]; !ok {
+				params[k] = v
+				used[k] = v
+			}
+		}
+		for k, v := range cfg.Params {
+			params[k] = v
+		}
+		cfg.Params = params
+		if len(used) > 0 {
+			applied.Values["param"] = used
+		}
+	}
+	if len(prof.GraphAttrs) > 0 {
+		cfg.GraphAttrDefaults = map[string]string{}
+		for k, v := range prof.GraphAttrs {
+			cfg.GraphAttrDefaults[k] = v
+		}
+		applied.Values["graph_attrs"] = prof.GraphAttrs
+	}
+	cfg.Profile = &applied
+	return nil
+}
+
+// applyProfileGraphAttrs sets each default the graph does not set itself.
+func applyProfileGraphAttrs(g *Graph, defaults map[string]string) {
+	if len(defaults) > 0 && g.Attrs == nil {
+		g.Attrs = map[string]Value{}
+	}
+	for k, v := range defaults {
+		if _, ok := g.Attrs[k]; !ok {
+			g.Attrs[k] = v
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProfiles(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ProfileFileName)
+	writeFile(t, path, body)
+	return path
+}
+
+func TestLoadProfilesRejectsUnknownKeys(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"profiles": {"ci": {"no_cahce": true}}}`:           `unknown field "no_cahce"`,
+		`{"profile": {}}`:                                    `unknown field "profile"`,
+		`{"profiles": {"ci": {"param": {"bad name": "x"}}}}`: `invalid param name "bad name"`,
+		`{"profiles": {"ci": {"report_formats": "html"}}}`:   "html",
+		`{"profiles": {}} {}`:                                "unexpected data",
+	} {
+		if _, err := LoadProfiles(writeProfiles(t, body)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadProfiles(%s) err = %v, want %q", body, err, want)
+		}
+	}
+}
+
+func TestApplyProfileExplicitFlagsWin(t *testing.T) {
+	path := writeProfiles(t, `{"profiles": {"ci": {
+		"workdir": "src", "runsdir": "/abs/runs", "strict": true, "no_cache": true, "min_free_bytes": 1024,
+		"report_formats": "junit", "param": {"env": "ci", "tier": "1"}, "graph_attrs": {"hermetic_env": "true"}
+	}}}`)
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := RunConfig{Runsdir: "mine", Params: map[string]string{"env": "dev"}}
+	if err := ApplyProfile(&cfg, profiles, "ci", map[string]bool{"runsdir": true, "param": true, "no-cache": true}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Workdir != filepath.Join(filepath.Dir(path), "src") || cfg.Runsdir != "mine" || !cfg.StrictValidation || cfg.NoCache || cfg.MinFreeBytes != 1024 {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	if cfg.Params["env"] != "dev" || cfg.Params["tier"] != "1" || strings.Join(cfg.ReportFormats, ",") != "junit" || cfg.GraphAttrDefaults["hermetic_env"] != "true" {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	b, _ := json.Marshal(cfg.Profile.Values)
+	if want := `{"graph_attrs":{"hermetic_env":"true"},"min_free_bytes":1024,"param":{"tier":"1"},"report_formats":"junit","strict":true,"workdir":"` + cfg.Workdir + `"}`; string(b) != want {
+		t.Fatalf("applied values = %s\nwant %s", b, want)
+	}
+	if err := ApplyProfile(&cfg, profiles, "nope", nil); err == nil || !strings.Contains(err.Error(), "profile nope not found") || !strings.Contains(err.Error(), "have: ci") {
+		t.Fatalf("missing profile err = %v", err)
+	}
+}
+
+func TestRunRecordsProfileInManifest(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="echo $HOME > home.txt"];
+	exit [shape=Msquare];
+	start -> t -> exit;
+	}`)
+	path := writeProfiles(t, `{"profiles": {"hermetic": {"graph_attrs": {"hermetic_env": "true"}}}}`)
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "prof1"}
+	if err := ApplyProfile(&cfg, profiles, "hermetic", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunPipeline(cfg); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "prof1")
+	home, err := os.ReadFile(filepath.Join(runDir, "workspace", "home.txt"))
+	if err != nil || !strings.HasSuffix(strings.TrimSpace(string(home)), hermeticHomeDir) {
+		t.Fatalf("HOME = %q (%v), want the hermetic home", home, err)
+	}
+	m := readStatusJSON(t, filepath.Join(runDir, "manifest.json"))
+	prof, _ := m["profile"].(map[string]any)
+	if prof["name"] != "hermetic" || prof["file"] != path {
+		t.Fatalf("manifest profile = %v", m["profile"])
+	}
+}
@@ -0,0 +1,218 @@
+package attractor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ansiReset     = "\033[0m"
+	ansiRed       = "\033[31m"
+	ansiGreen     = "\033[32m"
+	ansiYellow    = "\033[33m"
+	ansiDim       = "\033[2m"
+	ansiClearLine = "\r\033[K"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// progressRenderer turns recorded events into one console line per stage
+// (--progress). On a terminal it colors the lines and animates a spinner for
+// the running stage; otherwise it writes plain lines only when stages end.
+// Detailed logs stay on slog's stderr output.
+type progressRenderer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	tty     bool
+	running string
+	started time.Time
+	retries map[string]int
+	frame   int
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newProgressRenderer(w io.Writer, tty bool) *progressRenderer {
+	return &progressRenderer{w: w, tty: tty, retries: map[string]int{}}
+}
+
+// newRunProgress returns nil when cfg.Progress is unset.
+func newRunProgress(cfg RunConfig) *progressRenderer {
+	if cfg.Progress == nil {
+		return nil
+	}
+	return newProgressRenderer(cfg.Progress, isTerminal(cfg.Progress))
+}
+
+// isTerminal reports whether w is a character device such as a TTY.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *progressRenderer) observe(ev map[string]any) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	typ, _ := ev["type"].(string)
+	nodeID, _ := ev["node_id"].(string)
+	at := eventTime(ev)
+	switch typ {
+	case "StageStarted":
+		p.running = nodeID
+		p.started = at
+		p.retries[nodeID] = 0
+		if p.tty {
+			p.drawSpinner(time.Now())
+			p.startSpinner()
+		}
+	case "StageRetrying":
+		p.retries[nodeID]++
+		p.line("↻", ansiYellow, nodeID, at, fmt.Sprintf("retry %d", p.retries[nodeID]))
+		p.started = at
+	case "StageCompleted":
+		outcome, _ := ev["outcome"].(string)
+		p.line("✓", ansiGreen, nodeID, at, p.retryNote(nodeID, outcome))
+		p.running = ""
+	case "StageFailed":
+		detail, _ := ev["failure_code"].(string)
+		if _, errored := ev["error"]; errored {
+			detail = "error"
+		}
+		p.line("✗", ansiRed, nodeID, at, p.retryNote(nodeID, detail))
+		p.running = ""
+	case "PipelineCompleted", "PipelineFailed", "PipelineAborted", "PipelineStopped":
+		p.stopSpinner()
+		status, color := "completed", ansiGreen
+		switch typ {
+		case "PipelineFailed":
+			status, color = "failed", ansiRed
+		case "PipelineAborted":
+			status, color = "aborted", ansiRed
+		case "PipelineStopped":
+			status, color = "stopped", ansiYellow
+		}
+		fmt.Fprintln(p.w, p.paint(color, "run "+status))
+	}
+}
+
+// retryNote joins detail (an outcome other than success, or a failure code)
+// with the stage's retry count.
+func (p *progressRenderer) retryNote(nodeID, detail string) string {
+	parts := []string{}
+	if detail != "" && detail != "success" {
+		parts = append(parts, detail)
+	}
+	if n := p.retries[nodeID]; n > 0 {
+		parts = append(parts, fmt.Sprintf("retries %d", n))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// line writes a finished line for nodeID, replacing the spinner on a TTY.
+func (p *progressRenderer) line(symbol, color, nodeID string, at time.Time, note string) {
+	text := p.paint(color, symbol) + " " + nodeID + " " + p.paint(ansiDim, formatStageDuration(at.Sub(p.started)))
+	if note != "" {
+		text += " " + p.paint(ansiDim, "("+note+")")
+	}
+	if p.tty {
+		text = ansiClearLine + text
+	}
+	fmt.Fprintln(p.w, text)
+}
+
+func (p *progressRenderer) paint(color, s string) string {
+	if !p.tty {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+func (p *progressRenderer) drawSpinner(now time.Time) {
+	if p.running == "" {
+		return
+	}
+	frame := spinnerFrames[p.frame%len(spinnerFrames)]
+	p.frame++
+	fmt.Fprint(p.w, ansiClearLine+p.paint(ansiYellow, frame)+" "+p.running+" "+p.paint(ansiDim, formatStageDuration(now.Sub(p.started))))
+}
+
+func (p *progressRenderer) startSpinner() {
+	if p.stop != nil {
+		return
+	}
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				p.mu.Lock()
+				p.drawSpinner(now)
+				p.mu.Unlock()
+			}
+		}
+	}(p.stop, p.done)
+}
+
+// stopSpinner must be called with p.mu held.
+func (p *progressRenderer) stopSpinner() {
+	if p.stop == nil {
+		return
+	}
+	close(p.stop)
+	done := p.done
+	p.stop, p.done = nil, nil
+	p.mu.Unlock()
+	<-done
+	p.mu.Lock()
+	if p.running != "" {
+		fmt.Fprint(p.w, ansiClearLine)
+	}
+}
+
+// close stops the spinner when a run ends without a pipeline event.
+func (p *progressRenderer) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopSpinner()
+}
+
+func eventTime(ev map[string]any) time.Time {
+	raw, _ := ev["at"].(string)
+	at, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return at
+}
+
+// formatStageDuration rounds to tenths of a second above one second and to
+// milliseconds below.
+func formatStageDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
@@ -0,0 +1,80 @@
+package attractor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func progressEvent(typ, nodeID string, at time.Duration, extra map[string]any) map[string]any {
+	ev := map[string]any{"type": typ, "node_id": nodeID, "at": time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Add(at).Format(time.RFC3339Nano)}
+	for k, v := range extra {
+		ev[k] = v
+	}
+	return ev
+}
+
+func TestProgressRendererPlainLines(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgressRenderer(&buf, false)
+	for _, ev := range []map[string]any{
+		progressEvent("PipelineStarted", "", 0, nil),
+		progressEvent("StageStarted", "build", 0, nil),
+		progressEvent("StageCompleted", "build", 1200*time.Millisecond, map[string]any{"outcome": "success"}),
+		progressEvent("StageStarted", "test", 2*time.Second, nil),
+		progressEvent("StageRetrying", "test", 2500*time.Millisecond, nil),
+		progressEvent("StageFailed", "test", 3*time.Second, map[string]any{"failure_code": "tool_exit_nonzero"}),
+		progressEvent("StageStarted", "fix", 3*time.Second, nil),
+		progressEvent("StageCompleted", "fix", 3*time.Second+40*time.Millisecond, map[string]any{"outcome": "partial_success"}),
+		progressEvent("PipelineFailed", "", 4*time.Second, map[string]any{"error": "boom"}),
+	} {
+		p.observe(ev)
+	}
+	want := strings.Join([]string{
+		"✓ build 1.2s",
+		"↻ test 500ms (retry 1)",
+		"✗ test 500ms (tool_exit_nonzero, retries 1)",
+		"✓ fix 40ms (partial_success)",
+		"run failed",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Fatalf("rendered:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestProgressRendererTerminalColors(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgressRenderer(&buf, true)
+	p.observe(progressEvent("StageStarted", "build", 0, nil))
+	p.observe(progressEvent("StageCompleted", "build", time.Second, map[string]any{"outcome": "success"}))
+	p.observe(progressEvent("PipelineCompleted", "", time.Second, nil))
+	p.close()
+	out := buf.String()
+	if !strings.Contains(out, ansiClearLine+ansiGreen+"✓"+ansiReset+" build") || !strings.Contains(out, " build ") {
+		t.Fatalf("missing colored completion line: %q", out)
+	}
+	if !strings.Contains(out, ansiYellow+spinnerFrames[0]+ansiReset+" build") {
+		t.Fatalf("missing spinner frame: %q", out)
+	}
+}
+
+func TestRunPipelineWritesProgress(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="true"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	var buf bytes.Buffer
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "pg1", Progress: &buf}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[1], "✓ t ") || lines[3] != "run completed" || strings.Contains(buf.String(), "\033[") {
+		t.Fatalf("progress output:\n%s", buf.String())
+	}
+}
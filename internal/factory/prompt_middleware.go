@@ -0,0 +1,227 @@
+package attractor
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// PromptMiddleware rewrites a codergen node's prompt before it is written to
+// prompt.md and sent to the agent. Middlewares run in order, each receiving
+// the previous one's output.
+type PromptMiddleware interface {
+	Transform(node *Node, ctx Context, prompt string) (string, error)
+}
+
+// NamedPromptMiddleware adapts fn to a PromptMiddleware that traces as name.
+// Middlewares without a Name method trace as their Go type.
+func NamedPromptMiddleware(name string, fn func(node *Node, ctx Context, prompt string) (string, error)) PromptMiddleware {
+	return namedPromptMiddleware{name: name, fn: fn}
+}
+
+type namedPromptMiddleware struct {
+	name string
+	fn   func(node *Node, ctx Context, prompt string) (string, error)
+}
+
+func (m namedPromptMiddleware) Name() string { return m.name }
+
+func (m namedPromptMiddleware) Transform(node *Node, ctx Context, prompt string) (string, error) {
+	return m.fn(node, ctx, prompt)
+}
+
+func promptMiddlewareName(mw PromptMiddleware) string {
+	if n, ok := mw.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", mw)
+}
+
+// failureFeedbackMiddleware appends failure feedback
+// (prompt.inject_failure_feedback): the last failure summary, or with
+// prompt.failure_source_node that node's latest failure, read from runDir.
+type failureFeedbackMiddleware struct {
+	g          *Graph
+	runDir     string
+	sourceNode string
+	logger     *slog.Logger
+}
+
+func (failureFeedbackMiddleware) Name() string { return "failure_feedback" }
+
+func (m failureFeedbackMiddleware) Transform(node *Node, ctx Context, prompt string) (string, error) {
+	if m.sourceNode == "" {
+		return injectFailureFeedbackPrompt(prompt, ctx), nil
+	}
+	reason, summary, err := readNodeFailureFeedback(m.g, m.runDir, m.sourceNode)
+	if err != nil {
+		m.logger.Warn("failure feedback source unavailable; injecting none", "node", node.ID, "source_node", m.sourceNode, "error", err)
+		return prompt, nil
+	}
+	return appendFailureFeedback(prompt, "node "+m.sourceNode, m.sourceNode, reason, summary), nil
+}
+
+// failureFeedbackTrace is NodeInputCaptured failure_feedback: where the
+// node's failure feedback came from and how many bytes it added.
+type failureFeedbackTrace struct {
+	// Source is last_failure, node (prompt.failure_source_node), or
+	// disabled.
+	Source     string `json:"source"`
+	SourceNode string `json:"source_node,omitempty"`
+	Bytes      int    `json:"bytes"`
+}
+
+func newFailureFeedbackTrace(node *Node, g *Graph, records []promptMiddlewareRecord) failureFeedbackTrace {
+	t := failureFeedbackTrace{Source: "disabled"}
+	if !failureFeedbackEnabled(node, g) {
+		return t
+	}
+	t.Source = "last_failure"
+	if src := failureSourceNode(node); src != "" {
+		t.Source, t.SourceNode = "node", src
+	}
+	for _, r := range records {
+		if r.Name == "failure_feedback" {
+			t.Bytes = r.BytesAdded
+			break
+		}
+	}
+	return t
+}
+
+// failureFeedbackEnabled reads prompt.inject_failure_feedback and its
+// per-node alias prompt.failure_feedback.
+func failureFeedbackEnabled(node *Node, g *Graph) bool {
+	return promptInjectionEnabled(node, g, "prompt.inject_failure_feedback") && node.BoolAttr("prompt.failure_feedback", true)
+}
+
+func failureSourceNode(node *Node) string {
+	return strings.TrimSpace(node.StringAttr("prompt.failure_source_node", ""))
+}
+
+// validateFailureFeedbackAttrs checks prompt.failure_feedback and that
+// prompt.failure_source_node names another node of the graph.
+func validateFailureFeedbackAttrs(g *Graph, n *Node) []Diagnostic {
+	d := []Diagnostic{}
+	if raw, ok := n.Attrs["prompt.failure_feedback"]; ok {
+		if _, err := strconv.ParseBool(strings.TrimSpace(fmt.Sprintf("%v", raw))); err != nil {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: invalid prompt.failure_feedback %q (expected true or false)", n.ID, fmt.Sprintf("%v", raw))})
+		}
+	}
+	if _, ok := n.Attrs["prompt.failure_source_node"]; !ok {
+		return d
+	}
+	switch src := failureSourceNode(n); {
+	case src == "":
+		d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: prompt.failure_source_node is empty", n.ID)})
+	case g.Nodes[src] == nil:
+		d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: prompt.failure_source_node references unknown node: %s", n.ID, src)})
+	case src == n.ID:
+		d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: prompt.failure_source_node cannot be the node itself", n.ID)})
+	case handlerType(n) != "codergen":
+		d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s sets prompt.failure_source_node but is not a codergen node", n.ID)})
+	}
+	return d
+}
+
+// verificationAllowlistMiddleware appends the verification command allowlist
+// (prompt.inject_verification_allowlist).
+type verificationAllowlistMiddleware struct {
+	g *Graph
+}
+
+func (verificationAllowlistMiddleware) Name() string { return "verification_allowlist" }
+
+func (m verificationAllowlistMiddleware) Transform(node *Node, _ Context, prompt string) (string, error) {
+	return injectVerificationAllowlistPrompt(prompt, node, m.g), nil
+}
+
+// builtinPromptMiddlewares returns the built-ins enabled for node. Each is on
+// unless its prompt.inject_* attribute is false on the node or the graph,
+// except the workspace tree, which needs prompt.include_tree=true. files is
+// the latest workspace snapshot, or nil to have the tree take its own.
+// runDir is where prompt.failure_source_node artifacts are read from.
+func builtinPromptMiddlewares(node *Node, g *Graph, workspace, runDir string, files map[string]fileState, logger *slog.Logger) []PromptMiddleware {
+	chain := []PromptMiddleware{}
+	if promptBoolAttr(node, g, "prompt.include_tree", false) {
+		chain = append(chain, workspaceTreeMiddleware{workspace: workspace, files: files})
+	}
+	if failureFeedbackEnabled(node, g) {
+		chain = append(chain, failureFeedbackMiddleware{g: g, runDir: runDir, sourceNode: failureSourceNode(node), logger: logger})
+	}
+	if promptInjectionEnabled(node, g, "prompt.inject_verification_allowlist") {
+		chain = append(chain, verificationAllowlistMiddleware{g: g})
+	}
+	if b, err := parseChangeBudget(node); err == nil && !b.empty() && promptInjectionEnabled(node, g, "prompt.inject_change_budget") {
+		chain = append(chain, changeBudgetMiddleware{})
+	}
+	return chain
+}
+
+func promptInjectionEnabled(node *Node, g *Graph, key string) bool {
+	return promptBoolAttr(node, g, key, true)
+}
+
+// promptBoolAttr reads a boolean prompt attribute from the node, falling back
+// to the graph and then def.
+func promptBoolAttr(node *Node, g *Graph, key string, def bool) bool {
+	if raw, ok := g.Attrs[key]; ok {
+		if b, err := strconv.ParseBool(strings.TrimSpace(fmt.Sprintf("%v", raw))); err == nil {
+			def = b
+		}
+	}
+	return node.BoolAttr(key, def)
+}
+
+// promptMiddlewareRecord is one middleware's entry in the NodeInputCaptured
+// trace: its name and how many bytes it added (negative when it trimmed).
+type promptMiddlewareRecord struct {
+	Name       string `json:"name"`
+	BytesAdded int    `json:"bytes_added"`
+}
+
+// preparedPrompt is a codergen prompt built before NodeInputCaptured, so the
+// trace can record the middlewares that produced it.
+type preparedPrompt struct {
+	text        string
+	middlewares []promptMiddlewareRecord
+	// failureFeedback is set by Engine.preparePrompt.
+	failureFeedback *failureFeedbackTrace
+}
+
+// buildPrompt expands the node's prompt and runs chain over it. Delegation
+// instructions are appended last, so no middleware can trim them away.
+func buildPrompt(node *Node, ctx Context, g *Graph, chain []PromptMiddleware) (preparedPrompt, error) {
+	prompt := node.StringAttr("prompt", node.Label())
+	if goal, ok := g.Attrs["goal"]; ok {
+		prompt = strings.ReplaceAll(prompt, "$goal", fmt.Sprintf("%v", goal))
+	}
+	records := []promptMiddlewareRecord{}
+	for _, mw := range chain {
+		name := promptMiddlewareName(mw)
+		next, err := mw.Transform(node, ctx, prompt)
+		if err != nil {
+			return preparedPrompt{}, fmt.Errorf("prompt middleware %s: %w", name, err)
+		}
+		records = append(records, promptMiddlewareRecord{Name: name, BytesAdded: len(next) - len(prompt)})
+		prompt = next
+	}
+	return preparedPrompt{text: injectDelegatePrompt(prompt, node), middlewares: records}, nil
+}
+
+// preparePrompt builds the prompt for a codergen node with the built-ins and
+// RunConfig.PromptMiddlewares. It returns nil for other nodes.
+func (e *Engine) preparePrompt(node *Node) (*preparedPrompt, error) {
+	if handlerType(node) != "codergen" || isManagerLoopNode(node) {
+		return nil, nil
+	}
+	chain := append(builtinPromptMiddlewares(node, e.Graph, e.Workspace, e.RunDir, e.checkpointSnapshot, e.Logger), e.promptMiddlewares...)
+	p, err := buildPrompt(node, e.Context, e.Graph, chain)
+	if err != nil {
+		return nil, err
+	}
+	fb := newFailureFeedbackTrace(node, e.Graph, p.middlewares)
+	p.failureFeedback = &fb
+	return &p, nil
+}
@@ -0,0 +1,188 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type shoutMiddleware struct{}
+
+func (shoutMiddleware) Transform(_ *Node, _ Context, prompt string) (string, error) {
+	return strings.ToUpper(prompt), nil
+}
+
+func promptMiddlewareTrace(t *testing.T, runDir, nodeID string) []any {
+	t.Helper()
+	recs, err := TraceQuery(runDir, TraceQueryOptions{Types: []string{"NodeInputCaptured"}, Node: nodeID})
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("NodeInputCaptured for %s = %v (%v)", nodeID, recs, err)
+	}
+	mws, _ := recs[0]["prompt_middlewares"].([]any)
+	return mws
+}
+
+func TestPromptMiddlewaresRunInOrderAndAreTraced(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box, prompt="build it"]; exit [shape=Msquare]; start -> a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	standards := NamedPromptMiddleware("coding_standards", func(_ *Node, _ Context, prompt string) (string, error) {
+		return prompt + "\nfollow gofmt", nil
+	})
+	cfg := RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "pm1", PromptMiddlewares: []PromptMiddleware{standards, shoutMiddleware{}}}
+	if err := RunPipeline(cfg); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "pm1")
+	b, err := os.ReadFile(filepath.Join(runDir, "a", "prompt.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(b)); got != "BUILD IT\nFOLLOW GOFMT" {
+		t.Fatalf("prompt.md = %q", got)
+	}
+	want := []string{"failure_feedback:0", "verification_allowlist:0", "coding_standards:13", "attractor.shoutMiddleware:0"}
+	mws := promptMiddlewareTrace(t, runDir, "a")
+	got := []string{}
+	for _, mw := range mws {
+		m, _ := mw.(map[string]any)
+		got = append(got, fmt.Sprintf("%v:%v", m["name"], m["bytes_added"]))
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("prompt_middlewares = %v, want %v", got, want)
+	}
+	if mws := promptMiddlewareTrace(t, runDir, "start"); mws != nil {
+		t.Fatalf("start node traced prompt middlewares: %v", mws)
+	}
+}
+
+func TestPromptInjectionCanBeDisabled(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	graph ["prompt.inject_failure_feedback"=false];
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="false"];
+	fix [shape=box, prompt="fix it"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> fix [condition="outcome=fail"];
+	t -> exit [condition="outcome=success"];
+	fix -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "pm2"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "pm2")
+	b, err := os.ReadFile(filepath.Join(runDir, "fix", "prompt.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "Failure feedback") {
+		t.Fatalf("failure feedback injected although disabled:\n%s", b)
+	}
+	for _, mw := range promptMiddlewareTrace(t, runDir, "fix") {
+		if m, _ := mw.(map[string]any); m["name"] == "failure_feedback" {
+			t.Fatal("disabled middleware traced as run")
+		}
+	}
+}
+
+func TestPromptMiddlewareErrorFailsStage(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	boom := NamedPromptMiddleware("tree", func(*Node, Context, string) (string, error) {
+		return "", errors.New("listing failed")
+	})
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "pm3", PromptMiddlewares: []PromptMiddleware{boom}})
+	if err == nil || !strings.Contains(err.Error(), "prompt middleware tree: listing failed") {
+		t.Fatalf("expected middleware error, got %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(runsdir, "pm3", "a", "prompt.md")); !os.IsNotExist(statErr) {
+		t.Fatal("prompt.md written despite middleware error")
+	}
+}
+
+func TestFailureFeedbackSourceNode(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	verify [shape=parallelogram, tool_command="echo verify broke >&2; exit 1"];
+	fix [shape=parallelogram, tool_command="echo fix broke >&2; exit 1"];
+	escalate [shape=box, prompt="escalate", "prompt.failure_source_node"=verify];
+	missing [shape=box, prompt="missing", "prompt.failure_source_node"=unused];
+	quiet [shape=box, prompt="quiet", "prompt.failure_feedback"=false];
+	unused [shape=parallelogram, tool_command="true"];
+	exit [shape=Msquare];
+	start -> verify;
+	verify -> fix [condition="outcome=fail"];
+	verify -> unused [condition="outcome=success"];
+	fix -> escalate [condition="outcome=fail"];
+	fix -> exit [condition="outcome=success"];
+	escalate -> missing -> quiet -> exit;
+	unused -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "pm4"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "pm4")
+	for _, tc := range []struct {
+		node, source, sourceNode string
+		want, notWant            string
+	}{
+		{"escalate", "node", "verify", "Failure feedback (from node verify):", "fix broke"},
+		{"missing", "node", "unused", "", "Failure feedback"},
+		{"quiet", "disabled", "", "", "Failure feedback"},
+	} {
+		b, err := os.ReadFile(filepath.Join(runDir, tc.node, "prompt.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), tc.want) || strings.Contains(string(b), tc.notWant) {
+			t.Fatalf("%s prompt.md:\n%s", tc.node, b)
+		}
+		if tc.node == "escalate" && !strings.Contains(string(b), "verify broke") {
+			t.Fatalf("escalate prompt.md lacks verify's stderr:\n%s", b)
+		}
+		recs, err := TraceQuery(runDir, TraceQueryOptions{Types: []string{"NodeInputCaptured"}, Node: tc.node})
+		if err != nil || len(recs) != 1 {
+			t.Fatalf("NodeInputCaptured for %s = %v (%v)", tc.node, recs, err)
+		}
+		fb, _ := recs[0]["failure_feedback"].(map[string]any)
+		wantBytes := float64(0)
+		if tc.want != "" {
+			wantBytes = float64(len(b) - len("escalate\n"))
+		}
+		if fb["source"] != tc.source || (fb["source_node"] != nil && fb["source_node"] != tc.sourceNode) || fb["bytes"] != wantBytes {
+			t.Fatalf("%s failure_feedback = %v, want bytes %v", tc.node, fb, wantBytes)
+		}
+	}
+}
+
+func TestValidateFailureFeedbackAttrs(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, "prompt.failure_source_node"=nope, "prompt.failure_feedback"=maybe];
+	b [shape=box, "prompt.failure_source_node"=b];
+	exit [shape=Msquare];
+	start -> a -> b -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{
+		"node a: prompt.failure_source_node references unknown node: nope",
+		`node a: invalid prompt.failure_feedback "maybe" (expected true or false)`,
+		"node b: prompt.failure_source_node cannot be the node itself",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("diagnostics missing %q:\n%s", want, got)
+		}
+	}
+}
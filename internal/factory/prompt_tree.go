@@ -0,0 +1,187 @@
+package attractor
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultPromptTreeDepth    = 3
+	defaultPromptTreeMaxBytes = 4 << 10
+)
+
+// workspaceTreeMiddleware appends a listing of the workspace under the
+// node's allowed_write_paths and prompt.tree_roots (prompt.include_tree).
+// files is the engine's latest workspace snapshot; when nil, the middleware
+// takes its own snapshot of workspace.
+type workspaceTreeMiddleware struct {
+	workspace string
+	files     map[string]fileState
+}
+
+func (workspaceTreeMiddleware) Name() string { return "workspace_tree" }
+
+func (m workspaceTreeMiddleware) Transform(node *Node, _ Context, prompt string) (string, error) {
+	opts, err := parsePromptTreeOptions(node)
+	if err != nil {
+		return "", err
+	}
+	files := m.files
+	if files == nil {
+		if files, err = snapshotWorkspace(m.workspace); err != nil {
+			return "", err
+		}
+	}
+	tree := renderWorkspaceTree(files, opts)
+	if tree == "" {
+		return prompt, nil
+	}
+	return strings.TrimRight(prompt, "\n") + "\n\n" + tree, nil
+}
+
+type promptTreeOptions struct {
+	Roots    []string
+	Depth    int
+	MaxBytes int
+}
+
+func parsePromptTreeOptions(n *Node) (promptTreeOptions, error) {
+	opts := promptTreeOptions{Depth: n.IntAttr("prompt.tree_depth", defaultPromptTreeDepth), MaxBytes: defaultPromptTreeMaxBytes}
+	if opts.Depth <= 0 {
+		return opts, fmt.Errorf("invalid prompt.tree_depth %v (expected a positive integer)", n.Attrs["prompt.tree_depth"])
+	}
+	if raw := strings.TrimSpace(n.StringAttr("prompt.tree_max_bytes", "")); raw != "" {
+		b, err := parseByteSize(raw)
+		if err != nil || b == 0 {
+			return opts, fmt.Errorf("invalid prompt.tree_max_bytes %q (expected a positive size such as 4KB)", raw)
+		}
+		opts.MaxBytes = int(b)
+	}
+	allowed, err := ParseAllowedWritePaths(n)
+	if err != nil {
+		return opts, err
+	}
+	seen := map[string]bool{}
+	for _, r := range append(allowed, splitCSV(n.StringAttr("prompt.tree_roots", ""))...) {
+		raw := strings.TrimSpace(r)
+		r = path.Clean(raw)
+		if raw == "" || r == ".." || strings.HasPrefix(r, "../") || path.IsAbs(r) {
+			return opts, fmt.Errorf("invalid prompt tree root %q (expected a workspace-relative path)", raw)
+		}
+		if !seen[r] {
+			seen[r] = true
+			opts.Roots = append(opts.Roots, r)
+		}
+	}
+	sort.Strings(opts.Roots)
+	return opts, nil
+}
+
+// treeDir is a directory in the rendered listing.
+type treeDir struct {
+	dirs  map[string]*treeDir
+	files map[string]int64
+}
+
+func newTreeDir() *treeDir {
+	return &treeDir{dirs: map[string]*treeDir{}, files: map[string]int64{}}
+}
+
+func (d *treeDir) add(rel string, size int64) {
+	parts := strings.Split(rel, "/")
+	for _, p := range parts[:len(parts)-1] {
+		next := d.dirs[p]
+		if next == nil {
+			next = newTreeDir()
+			d.dirs[p] = next
+		}
+		d = next
+	}
+	d.files[parts[len(parts)-1]] = size
+}
+
+func (d *treeDir) count() int {
+	n := len(d.files)
+	for _, sub := range d.dirs {
+		n += sub.count()
+	}
+	return n
+}
+
+// renderWorkspaceTree lists each root with file sizes, directories past
+// opts.Depth collapsed to a file count. Output stops at opts.MaxBytes with a
+// note saying how many lines were left out. With no roots, or a "." root, it
+// lists the whole workspace. It returns "" when no root has files.
+func renderWorkspaceTree(files map[string]fileState, opts promptTreeOptions) string {
+	roots := opts.Roots
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	lines := []string{}
+	for _, root := range roots {
+		dir := newTreeDir()
+		for p, st := range files {
+			if root == "." {
+				dir.add(p, st.Size)
+			} else if p == root {
+				lines = append(lines, fmt.Sprintf("%s (%d)", p, st.Size))
+			} else if strings.HasPrefix(p, root+"/") {
+				dir.add(strings.TrimPrefix(p, root+"/"), st.Size)
+			}
+		}
+		if dir.count() == 0 {
+			continue
+		}
+		if root != "." {
+			lines = append(lines, root+"/")
+		}
+		indent := "  "
+		if root == "." {
+			indent = ""
+		}
+		lines = appendTreeLines(lines, dir, indent, opts.Depth)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	header := "Workspace tree (file sizes in bytes):"
+	var b strings.Builder
+	b.WriteString(header)
+	for i, line := range lines {
+		if b.Len()+len(line)+1 > opts.MaxBytes {
+			fmt.Fprintf(&b, "\n... truncated at %d bytes; %d more lines not shown", opts.MaxBytes, len(lines)-i)
+			break
+		}
+		b.WriteString("\n" + line)
+	}
+	return b.String()
+}
+
+func appendTreeLines(lines []string, d *treeDir, indent string, depth int) []string {
+	for _, name := range sortedKeys(d.dirs) {
+		sub := d.dirs[name]
+		if depth <= 1 {
+			lines = append(lines, fmt.Sprintf("%s%s/ (%d files, not expanded)", indent, name, sub.count()))
+			continue
+		}
+		lines = append(lines, indent+name+"/")
+		lines = appendTreeLines(lines, sub, indent+"  ", depth-1)
+	}
+	for _, name := range sortedKeys(d.files) {
+		lines = append(lines, fmt.Sprintf("%s%s (%d)", indent, name, d.files[name]))
+	}
+	return lines
+}
+
+// validatePromptTree checks the tree options on nodes that include a tree.
+func validatePromptTree(g *Graph, n *Node) []Diagnostic {
+	if !promptBoolAttr(n, g, "prompt.include_tree", false) || handlerType(n) != "codergen" {
+		return nil
+	}
+	if _, err := parsePromptTreeOptions(n); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s: %v", n.ID, err)}}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderWorkspaceTree(t *testing.T) {
+	files := map[string]fileState{
+		"agent/main.go":           {Size: 120},
+		"agent/internal/a/a.go":   {Size: 10},
+		"agent/internal/a/b.go":   {Size: 20},
+		"agent/internal/z.go":     {Size: 5},
+		"docs/guide.md":           {Size: 7},
+		"other/secret.txt":        {Size: 1},
+		"README.md":               {Size: 3},
+		"agent/testdata/big.json": {Size: 9000},
+	}
+	got := renderWorkspaceTree(files, promptTreeOptions{Roots: []string{"README.md", "agent", "docs"}, Depth: 2, MaxBytes: 4096})
+	want := `Workspace tree (file sizes in bytes):
+README.md (3)
+agent/
+  internal/
+    a/ (2 files, not expanded)
+    z.go (5)
+  testdata/
+    big.json (9000)
+  main.go (120)
+docs/
+  guide.md (7)`
+	if got != want {
+		t.Fatalf("tree =\n%s\nwant\n%s", got, want)
+	}
+	if got := renderWorkspaceTree(files, promptTreeOptions{Roots: []string{"agent"}, Depth: 3, MaxBytes: 80}); !strings.HasSuffix(got, "\n... truncated at 80 bytes; 5 more lines not shown") {
+		t.Fatalf("truncated tree =\n%s", got)
+	}
+	if got := renderWorkspaceTree(files, promptTreeOptions{Roots: []string{"missing"}, Depth: 3, MaxBytes: 80}); got != "" {
+		t.Fatalf("tree for missing root = %q", got)
+	}
+}
+
+func TestPromptTreeInPromptAndTrace(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, prompt="build it", "prompt.include_tree"=true, allowed_write_paths="agent/", "prompt.tree_roots"="docs/"];
+	exit [shape=Msquare];
+	start -> a -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "agent", "main.go"), "package main\n")
+	writeFile(t, filepath.Join(workdir, "docs", "guide.md"), "hi\n")
+	writeFile(t, filepath.Join(workdir, "other", "x.txt"), "x\n")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "pt1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "pt1")
+	b, err := os.ReadFile(filepath.Join(runDir, "a", "prompt.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt := string(b)
+	if !strings.Contains(prompt, "agent/\n  main.go (13)\ndocs/\n  guide.md (3)") || strings.Contains(prompt, "other") {
+		t.Fatalf("prompt.md = %q", prompt)
+	}
+	for _, mw := range promptMiddlewareTrace(t, runDir, "a") {
+		if m, _ := mw.(map[string]any); m["name"] == "workspace_tree" {
+			if m["bytes_added"].(float64) <= 0 {
+				t.Fatalf("workspace_tree record = %v", m)
+			}
+			return
+		}
+	}
+	t.Fatal("workspace_tree not in prompt_middlewares trace")
+}
@@ -0,0 +1,483 @@
+package attractor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueuePollInterval = time.Second
+	defaultQueueHeartbeat    = 5 * time.Second
+	queueStatusFile          = "status.json"
+)
+
+// errRunActive is returned by claim for a job whose run ID is already
+// running in this queue; the job stays queued until that run ends.
+var errRunActive = errors.New("run is already active")
+
+// QueueJob is a job file in a RunQueue directory. Relative paths resolve
+// against the queue directory.
+type QueueJob struct {
+	RunID          string            `json:"run_id,omitempty"`
+	PipelinePath   string            `json:"pipeline_path,omitempty"`
+	PipelineSource string            `json:"pipeline_source,omitempty"`
+	Workdir        string            `json:"workdir"`
+	Params         map[string]string `json:"params,omitempty"`
+	// Resume is set when a stopped job is put back in the queue.
+	Resume bool `json:"resume,omitempty"`
+}
+
+// QueueResult is written next to a finished job file in done/ or failed/.
+type QueueResult struct {
+	Job        string `json:"job"`
+	RunID      string `json:"run_id"`
+	RunDir     string `json:"run_dir"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// QueueActiveRun describes a run in progress in the queue heartbeat.
+type QueueActiveRun struct {
+	Job               string `json:"job"`
+	RunID             string `json:"run_id"`
+	RunDir            string `json:"run_dir"`
+	StartedAt         string `json:"started_at"`
+	LastCompletedNode string `json:"last_completed_node,omitempty"`
+	// Attempts and Retries are the run's totals as of its last checkpoint.
+	Attempts int `json:"attempts"`
+	Retries  int `json:"retries"`
+}
+
+// QueueStatus is the heartbeat a serving RunQueue keeps in
+// <queue-dir>/status.json.
+type QueueStatus struct {
+	PID         int              `json:"pid"`
+	HeartbeatAt string           `json:"heartbeat_at"`
+	Stopping    bool             `json:"stopping"`
+	Pending     int              `json:"pending"`
+	Active      []QueueActiveRun `json:"active"`
+}
+
+// RunQueue executes job files dropped into QueueDir. A job is claimed by
+// moving it to running/, and when its run ends it moves to done/ or failed/
+// with a <job>.result.json summary. Cancelling the context stops each active
+// run after its current stage; those jobs go back to the queue marked for
+// resume.
+type RunQueue struct {
+	QueueDir string
+	Runsdir  string
+	// MaxConcurrent is the number of runs executed at once (default 1).
+	MaxConcurrent int
+	PollInterval  time.Duration
+	Heartbeat     time.Duration
+	// Run executes one job; nil means RunPipeline.
+	Run    func(RunConfig) error
+	Logger *slog.Logger
+
+	mu     sync.Mutex
+	active map[string]QueueActiveRun
+}
+
+// Serve polls the queue until ctx is cancelled, then waits for active runs
+// to stop.
+func (q *RunQueue) Serve(ctx context.Context) error {
+	if err := q.init(); err != nil {
+		return err
+	}
+	poll := q.PollInterval
+	if poll <= 0 {
+		poll = defaultQueuePollInterval
+	}
+	beat := q.Heartbeat
+	if beat <= 0 {
+		beat = defaultQueueHeartbeat
+	}
+	stopBeat := q.startHeartbeat(ctx, beat)
+	defer stopBeat()
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, q.maxConcurrent())
+	for {
+		jobs, err := q.pendingJobs()
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			if ctx.Err() != nil {
+				break
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				continue
+			}
+			claimed, err := q.claim(job)
+			if err != nil {
+				<-slots
+				q.logger().Warn("failed to claim queued job", "job", job, "error", err)
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				q.runJob(ctx, claimed)
+			}()
+		}
+		select {
+		case <-ctx.Done():
+			q.logger().Info("queue stopping; waiting for active runs", "active", len(q.Active()))
+			wg.Wait()
+			return q.writeStatus(true)
+		case <-time.After(poll):
+		}
+	}
+}
+
+// RunPending executes the jobs queued when it is called and returns once
+// they have all finished.
+func (q *RunQueue) RunPending(ctx context.Context) error {
+	if err := q.init(); err != nil {
+		return err
+	}
+	jobs, err := q.pendingJobs()
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, q.maxConcurrent())
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		slots <- struct{}{}
+		claimed, err := q.claim(job)
+		if errors.Is(err, errRunActive) {
+			<-slots
+			q.logger().Warn("queued job left pending", "job", job, "error", err)
+			continue
+		}
+		if err != nil {
+			<-slots
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			q.runJob(ctx, claimed)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// Active lists runs in progress, ordered by job name.
+func (q *RunQueue) Active() []QueueActiveRun {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]QueueActiveRun, 0, len(q.active))
+	for _, name := range sortedKeys(q.active) {
+		a := q.active[name]
+		if cp, err := readCheckpoint(filepath.Join(a.RunDir, "checkpoint.json")); err == nil {
+			a.LastCompletedNode = cp.LastCompletedNode
+			if cp.Totals != nil {
+				a.Attempts, a.Retries = cp.Totals.Attempts, cp.Totals.Retries
+			}
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// ReadQueueStatus reads the heartbeat of the RunQueue serving queueDir.
+func ReadQueueStatus(queueDir string) (QueueStatus, error) {
+	var st QueueStatus
+	b, err := os.ReadFile(filepath.Join(queueDir, queueStatusFile))
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, fmt.Errorf("invalid queue status in %s: %w", queueDir, err)
+	}
+	return st, nil
+}
+
+func (q *RunQueue) init() error {
+	if strings.TrimSpace(q.QueueDir) == "" || strings.TrimSpace(q.Runsdir) == "" {
+		return fmt.Errorf("queue dir and runsdir are required")
+	}
+	for _, dir := range []string{"running", "done", "failed"} {
+		if err := os.MkdirAll(filepath.Join(q.QueueDir, dir), 0o755); err != nil {
+			return err
+		}
+	}
+	q.mu.Lock()
+	if q.active == nil {
+		q.active = map[string]QueueActiveRun{}
+	}
+	q.mu.Unlock()
+	q.recoverStaleJobs()
+	return nil
+}
+
+// recoverStaleJobs takes over jobs left in running/ by a server that died:
+// runs the doctor finds resumable go back to the queue marked for resume,
+// completed runs move to done/, and jobs whose run never started are
+// requeued as they were; the rest move to failed/. Jobs whose run lock is live are left alone, as are
+// recently claimed jobs with no run dir yet.
+func (q *RunQueue) recoverStaleJobs() {
+	entries, err := os.ReadDir(filepath.Join(q.QueueDir, "running"))
+	if err != nil {
+		return
+	}
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		runningPath := filepath.Join(q.QueueDir, "running", name)
+		job, cfg, err := q.loadJob(runningPath, name)
+		if err != nil {
+			continue
+		}
+		runDir := filepath.Join(cfg.Runsdir, cfg.RunID)
+		rep, derr := DiagnoseRun(runDir)
+		switch {
+		case derr != nil:
+			info, err := ent.Info()
+			if err != nil || time.Since(info.ModTime()) < staleRunAfter {
+				continue
+			}
+			if err := os.Rename(runningPath, filepath.Join(q.QueueDir, name)); err == nil {
+				q.logger().Warn("requeued job whose run never started", "job", name, "run_id", cfg.RunID)
+			}
+		case rep.Lock != nil && rep.Lock.Live:
+			continue
+		case rep.State == RunStateCompleted:
+			if err := os.Rename(runningPath, filepath.Join(q.QueueDir, "done", name)); err == nil {
+				_ = writeJSON(filepath.Join(q.QueueDir, "done", strings.TrimSuffix(name, ".json")+".result.json"), QueueResult{Job: name, RunID: cfg.RunID, RunDir: runDir, Status: "completed"})
+			}
+		case !rep.Resumable:
+			if err := os.Rename(runningPath, filepath.Join(q.QueueDir, "failed", name)); err == nil {
+				_ = writeJSON(filepath.Join(q.QueueDir, "failed", strings.TrimSuffix(name, ".json")+".result.json"), QueueResult{Job: name, RunID: cfg.RunID, RunDir: runDir, Status: "failed", Error: strings.Join(rep.Problems, "; ")})
+				q.logger().Warn("stale run cannot be resumed", "job", name, "run_id", cfg.RunID, "problems", strings.Join(rep.Problems, "; "))
+			}
+		default:
+			job.RunID, job.Resume = cfg.RunID, true
+			if err := writeJSON(filepath.Join(q.QueueDir, name), job); err != nil {
+				continue
+			}
+			_ = os.Remove(runningPath)
+			q.logger().Warn("taking over stale run; job requeued for resume", "job", name, "run_id", cfg.RunID, "state", rep.State, "in_flight_node", rep.InFlightNode)
+		}
+	}
+}
+
+func (q *RunQueue) maxConcurrent() int {
+	if q.MaxConcurrent < 1 {
+		return 1
+	}
+	return q.MaxConcurrent
+}
+
+func (q *RunQueue) logger() *slog.Logger {
+	if q.Logger != nil {
+		return q.Logger
+	}
+	return slog.Default()
+}
+
+// pendingJobs lists queued job files in name order.
+func (q *RunQueue) pendingJobs() ([]string, error) {
+	entries, err := os.ReadDir(q.QueueDir)
+	if err != nil {
+		return nil, err
+	}
+	jobs := []string{}
+	for _, ent := range entries {
+		name := ent.Name()
+		if ent.IsDir() || name == queueStatusFile || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		jobs = append(jobs, name)
+	}
+	sort.Strings(jobs)
+	return jobs, nil
+}
+
+// claim moves a job into running/ so no other worker picks it up. A job
+// whose run ID is already active is refused with errRunActive; otherwise the
+// run ID is reserved in the active set until runJob finishes. A job that
+// does not load is still claimed, so runJob fails it.
+func (q *RunQueue) claim(name string) (string, error) {
+	pending := filepath.Join(q.QueueDir, name)
+	_, cfg, lerr := q.loadJob(pending, name)
+	if lerr == nil {
+		q.mu.Lock()
+		for other, a := range q.active {
+			if a.RunID == cfg.RunID {
+				q.mu.Unlock()
+				return "", fmt.Errorf("job %s: %w: run %s (job %s)", name, errRunActive, cfg.RunID, other)
+			}
+		}
+		q.active[name] = QueueActiveRun{Job: name, RunID: cfg.RunID, RunDir: filepath.Join(cfg.Runsdir, cfg.RunID), StartedAt: time.Now().UTC().Format(time.RFC3339Nano)}
+		q.mu.Unlock()
+	}
+	if err := os.Rename(pending, filepath.Join(q.QueueDir, "running", name)); err != nil {
+		q.mu.Lock()
+		delete(q.active, name)
+		q.mu.Unlock()
+		return "", err
+	}
+	return name, nil
+}
+
+func (q *RunQueue) runJob(ctx context.Context, name string) {
+	started := time.Now().UTC()
+	runningPath := filepath.Join(q.QueueDir, "running", name)
+	res := QueueResult{Job: name, StartedAt: started.Format(time.RFC3339Nano)}
+	job, cfg, err := q.loadJob(runningPath, name)
+	if err == nil {
+		res.RunID = cfg.RunID
+		res.RunDir = filepath.Join(cfg.Runsdir, cfg.RunID)
+		q.mu.Lock()
+		q.active[name] = QueueActiveRun{Job: name, RunID: cfg.RunID, RunDir: res.RunDir, StartedAt: res.StartedAt}
+		q.mu.Unlock()
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				close(stop)
+			case <-done:
+			}
+		}()
+		cfg.Stop = stop
+		q.logger().Info("queued run starting", "job", name, "run_id", cfg.RunID)
+		err = q.run(cfg)
+		close(done)
+	}
+	q.mu.Lock()
+	delete(q.active, name)
+	q.mu.Unlock()
+	finished := time.Now().UTC()
+	res.FinishedAt = finished.Format(time.RFC3339Nano)
+	res.DurationMS = finished.Sub(started).Milliseconds()
+	switch {
+	case errors.Is(err, ErrRunStopped):
+		job.RunID, job.Resume = cfg.RunID, true
+		if werr := writeJSON(filepath.Join(q.QueueDir, name), job); werr == nil {
+			_ = os.Remove(runningPath)
+			q.logger().Info("queued run stopped; job requeued for resume", "job", name, "run_id", cfg.RunID)
+			return
+		}
+		res.Status, res.Error = "failed", err.Error()
+	case errors.Is(err, ErrRunCompleted) && cfg.Resume:
+		// The run finished before the job was filed, e.g. the server died
+		// in between; the resume changed nothing.
+		res.Status = "completed"
+	case err != nil:
+		res.Status, res.Error = "failed", err.Error()
+	default:
+		res.Status = "completed"
+	}
+	dest := "done"
+	if res.Status != "completed" {
+		dest = "failed"
+		q.logger().Warn("queued run failed", "job", name, "run_id", res.RunID, "error", res.Error)
+	} else {
+		q.logger().Info("queued run completed", "job", name, "run_id", res.RunID)
+	}
+	if err := os.Rename(runningPath, filepath.Join(q.QueueDir, dest, name)); err != nil {
+		q.logger().Error("failed to move job file", "job", name, "error", err)
+	}
+	_ = writeJSON(filepath.Join(q.QueueDir, dest, strings.TrimSuffix(name, ".json")+".result.json"), res)
+}
+
+func (q *RunQueue) run(cfg RunConfig) error {
+	if q.Run != nil {
+		return q.Run(cfg)
+	}
+	return RunPipeline(cfg)
+}
+
+// loadJob parses a job file into a RunConfig. The run ID defaults to the job
+// file name without .json and must name a single directory under Runsdir.
+func (q *RunQueue) loadJob(path, name string) (QueueJob, RunConfig, error) {
+	var job QueueJob
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return job, RunConfig{}, err
+	}
+	if err := json.Unmarshal(b, &job); err != nil {
+		return job, RunConfig{}, fmt.Errorf("invalid job file %s: %w", name, err)
+	}
+	if job.PipelinePath == "" && job.PipelineSource == "" {
+		return job, RunConfig{}, fmt.Errorf("job %s needs pipeline_path or pipeline_source", name)
+	}
+	if strings.TrimSpace(job.Workdir) == "" {
+		return job, RunConfig{}, fmt.Errorf("job %s needs workdir", name)
+	}
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(q.QueueDir, p)
+	}
+	runID := job.RunID
+	if runID == "" {
+		runID = strings.TrimSuffix(name, ".json")
+	}
+	if runID == "." || strings.Contains(runID, "..") || strings.ContainsAny(runID, `/\`) {
+		return job, RunConfig{}, fmt.Errorf("job %s has invalid run_id %q (no path separators or \"..\")", name, runID)
+	}
+	cfg := RunConfig{
+		PipelinePath:   resolve(job.PipelinePath),
+		PipelineSource: job.PipelineSource,
+		Workdir:        resolve(job.Workdir),
+		Runsdir:        q.Runsdir,
+		RunID:          runID,
+		Resume:         job.Resume,
+		Params:         job.Params,
+	}
+	return job, cfg, nil
+}
+
+func (q *RunQueue) startHeartbeat(ctx context.Context, every time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		_ = q.writeStatus(false)
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				_ = q.writeStatus(ctx.Err() != nil)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (q *RunQueue) writeStatus(stopping bool) error {
+	jobs, err := q.pendingJobs()
+	if err != nil {
+		return err
+	}
+	st := QueueStatus{PID: os.Getpid(), HeartbeatAt: time.Now().UTC().Format(time.RFC3339Nano), Stopping: stopping, Pending: len(jobs), Active: q.Active()}
+	return writeJSON(filepath.Join(q.QueueDir, queueStatusFile), st)
+}
@@ -0,0 +1,202 @@
+package attractor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func writeQueueJob(t *testing.T, queueDir, name string, job QueueJob) {
+	t.Helper()
+	b, err := json.Marshal(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(queueDir, name), string(b))
+}
+
+func readQueueResult(t *testing.T, path string) QueueResult {
+	t.Helper()
+	var res QueueResult
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestRunQueueMovesJobsToDoneAndFailed(t *testing.T) {
+	root := t.TempDir()
+	queueDir, runsdir := filepath.Join(root, "queue"), filepath.Join(root, "runs")
+	writeFile(t, filepath.Join(root, "work", "README.md"), "hi\n")
+	writeQueueJob(t, queueDir, "a-good.json", QueueJob{
+		PipelineSource: `digraph G { start [shape=Mdiamond]; t [shape=parallelogram, tool_command="echo ${param.msg} > out.txt"]; exit [shape=Msquare]; start -> t -> exit; }`,
+		Workdir:        "../work",
+		Params:         map[string]string{"msg": "queued"},
+	})
+	writeQueueJob(t, queueDir, "b-bad.json", QueueJob{PipelineSource: `digraph G { a [shape=box]; }`, Workdir: "../work"})
+	q := &RunQueue{QueueDir: queueDir, Runsdir: runsdir}
+	if err := q.RunPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	good := readQueueResult(t, filepath.Join(queueDir, "done", "a-good.result.json"))
+	if good.Status != "completed" || good.RunID != "a-good" || good.RunDir != filepath.Join(runsdir, "a-good") {
+		t.Fatalf("good result = %+v", good)
+	}
+	if b, err := os.ReadFile(filepath.Join(runsdir, "a-good", "workspace", "out.txt")); err != nil || string(b) != "queued\n" {
+		t.Fatalf("out.txt = %q (%v)", b, err)
+	}
+	bad := readQueueResult(t, filepath.Join(queueDir, "failed", "b-bad.result.json"))
+	if bad.Status != "failed" || bad.Error == "" {
+		t.Fatalf("bad result = %+v", bad)
+	}
+	for _, p := range []string{"done/a-good.json", "failed/b-bad.json"} {
+		if _, err := os.Stat(filepath.Join(queueDir, p)); err != nil {
+			t.Fatalf("job file not moved: %v", err)
+		}
+	}
+}
+
+func TestRunQueueRequeuesStoppedRunForResume(t *testing.T) {
+	root := t.TempDir()
+	queueDir, runsdir := filepath.Join(root, "queue"), filepath.Join(root, "runs")
+	if err := os.MkdirAll(filepath.Join(root, "work"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeQueueJob(t, queueDir, "slow.json", QueueJob{
+		PipelineSource: `digraph G { start [shape=Mdiamond]; a [shape=parallelogram, tool_command="sleep 0.3"]; b [shape=parallelogram, tool_command="echo b > b.txt"]; exit [shape=Msquare]; start -> a -> b -> exit; }`,
+		Workdir:        filepath.Join(root, "work"),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	q := &RunQueue{QueueDir: queueDir, Runsdir: runsdir}
+	if err := q.RunPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var job QueueJob
+	b, err := os.ReadFile(filepath.Join(queueDir, "slow.json"))
+	if err != nil {
+		t.Fatalf("stopped job not requeued: %v", err)
+	}
+	if err := json.Unmarshal(b, &job); err != nil || !job.Resume || job.RunID != "slow" {
+		t.Fatalf("requeued job = %+v (%v)", job, err)
+	}
+	if _, err := os.Stat(filepath.Join(runsdir, "slow", "b", "status.json")); !os.IsNotExist(err) {
+		t.Fatalf("b ran after stop (%v)", err)
+	}
+	if evs := eventsOfType(t, filepath.Join(runsdir, "slow"), "PipelineStopped"); len(evs) != 1 {
+		t.Fatalf("PipelineStopped events = %v", evs)
+	}
+
+	if err := q.RunPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if res := readQueueResult(t, filepath.Join(queueDir, "done", "slow.result.json")); res.Status != "completed" {
+		t.Fatalf("resumed result = %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(runsdir, "slow", "workspace", "b.txt")); err != nil {
+		t.Fatalf("resume did not run b: %v", err)
+	}
+}
+
+func TestRunQueueServeRespectsMaxConcurrentAndWritesHeartbeat(t *testing.T) {
+	queueDir := t.TempDir()
+	for _, name := range []string{"j1.json", "j2.json", "j3.json"} {
+		writeQueueJob(t, queueDir, name, QueueJob{PipelinePath: "p.dot", Workdir: "."})
+	}
+	var running, peak int32
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	release := make(chan struct{})
+	q := &RunQueue{QueueDir: queueDir, Runsdir: t.TempDir(), MaxConcurrent: 2, PollInterval: 10 * time.Millisecond, Heartbeat: 10 * time.Millisecond,
+		Run: func(cfg RunConfig) error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			mu.Lock()
+			seen[cfg.RunID] = true
+			mu.Unlock()
+			<-release
+			return nil
+		}}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- q.Serve(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, err := ReadQueueStatus(queueDir)
+		if err == nil && len(st.Active) == 2 && st.Pending == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("heartbeat never showed 2 active runs: %+v (%v)", st, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(release)
+	for {
+		if _, err := os.Stat(filepath.Join(queueDir, "done", "j3.result.json")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("j3 never finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if peak != 2 || len(seen) != 3 {
+		t.Fatalf("peak = %d, seen = %v", peak, seen)
+	}
+	if st, err := ReadQueueStatus(queueDir); err != nil || !st.Stopping || len(st.Active) != 0 {
+		t.Fatalf("final status = %+v (%v)", st, err)
+	}
+}
+
+func TestRunQueueRejectsRunIDPathsAndActiveRunIDs(t *testing.T) {
+	queueDir := t.TempDir()
+	writeQueueJob(t, queueDir, "a-escape.json", QueueJob{RunID: "../outside", PipelinePath: "p.dot", Workdir: "."})
+	q := &RunQueue{QueueDir: queueDir, Runsdir: t.TempDir(), Run: func(RunConfig) error { return nil }}
+	if err := q.RunPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if res := readQueueResult(t, filepath.Join(queueDir, "failed", "a-escape.result.json")); res.Status != "failed" || !strings.Contains(res.Error, "invalid run_id") {
+		t.Fatalf("escape result = %+v", res)
+	}
+
+	writeQueueJob(t, queueDir, "b-first.json", QueueJob{RunID: "shared", PipelinePath: "p.dot", Workdir: "."})
+	writeQueueJob(t, queueDir, "c-second.json", QueueJob{RunID: "shared", PipelinePath: "p.dot", Workdir: "."})
+	if _, err := q.claim("b-first.json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.claim("c-second.json"); !errors.Is(err, errRunActive) {
+		t.Fatalf("claim of a job sharing an active run ID = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(queueDir, "c-second.json")); err != nil {
+		t.Fatalf("refused job left the queue: %v", err)
+	}
+	q.runJob(context.Background(), "b-first.json")
+	if err := q.RunPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if res := readQueueResult(t, filepath.Join(queueDir, "done", "c-second.result.json")); res.Status != "completed" || res.RunID != "shared" {
+		t.Fatalf("second result = %+v", res)
+	}
+}
@@ -0,0 +1,96 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// readOnlyNode reports whether node is a read_only=true inspection node: the
+// engine skips its workspace snapshots and only compares top-level mtimes.
+func readOnlyNode(n *Node) bool {
+	return n.BoolAttr("read_only", false)
+}
+
+// validateReadOnly rejects read_only on nodes that are not tool nodes and
+// with attributes that need workspace snapshots.
+func validateReadOnly(n *Node) []Diagnostic {
+	if !readOnlyNode(n) {
+		return nil
+	}
+	if handlerType(n) != "tool" {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets read_only=true but is not a tool node", n.ID)}}
+	}
+	var diags []Diagnostic
+	for _, attr := range []string{"allowed_write_paths", "expected_outputs"} {
+		if _, ok := n.Attrs[attr]; ok {
+			diags = append(diags, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s sets read_only=true with %s; read-only nodes do not write", n.ID, attr)})
+		}
+	}
+	if n.BoolAttr("cache", false) {
+		diags = append(diags, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s sets read_only=true with cache=true; the cache key needs a workspace snapshot", n.ID)})
+	}
+	if rollbackEnabled(n) {
+		diags = append(diags, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s sets read_only=true with on_fail=rollback; there is no snapshot to roll back to", n.ID)})
+	}
+	return diags
+}
+
+// topLevelModTimes records the mtime of the workspace root and of each entry
+// directly under it, the cheap stand-in for a snapshot on read-only nodes.
+// .attractor is skipped because the engine itself writes there.
+func topLevelModTimes(workspace string) (map[string]int64, error) {
+	root, err := os.Lstat(workspace)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]int64{".": root.ModTime().UnixNano()}
+	entries, err := os.ReadDir(workspace)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".attractor" {
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(workspace, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out[entry.Name()] = info.ModTime().UnixNano()
+	}
+	return out, nil
+}
+
+// checkReadOnly fails out with read_only_violation when any top-level mtime
+// recorded in before changed, appeared, or disappeared.
+func (e *Engine) checkReadOnly(node *Node, before map[string]int64, out *Outcome) error {
+	after, err := topLevelModTimes(e.Workspace)
+	if err != nil {
+		return err
+	}
+	changed := []string{}
+	for name, mtime := range after {
+		if prev, ok := before[name]; !ok || prev != mtime {
+			changed = append(changed, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	sort.Strings(changed)
+	out.Outcome = "fail"
+	out.FailureReason = "read_only_violation: workspace changed: " + strings.Join(changed, ",")
+	out.FailureCode = FailureReadOnlyViolation
+	e.recordEvent(map[string]any{"schema_version": 1, "type": "ReadOnlyViolation", "node_id": node.ID, "paths": changed, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+	e.Logger.Warn("read-only node changed the workspace", "node", node.ID, "paths", changed)
+	return nil
+}
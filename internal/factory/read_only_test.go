@@ -0,0 +1,57 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyNodeSkipsDiffAndCatchesWrites(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	inspect [shape=parallelogram, read_only=true, tool_command="ls -R"];
+	sneaky [shape=parallelogram, read_only=true, tool_command="echo x > new.txt"];
+	exit [shape=Msquare];
+	start -> inspect -> sneaky;
+	sneaky -> exit [condition="outcome=fail"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "src", "main.go"), "package main\n")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ro1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "ro1")
+	if st := readStatusJSON(t, filepath.Join(runDir, "inspect", "status.json")); st["outcome"] != "success" {
+		t.Fatalf("inspect status = %v", st)
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, "inspect", "workspace.diff.json"))
+	if err != nil || strings.Join(strings.Fields(string(b)), "") != `{"created":[],"modified":[],"deleted":[]}` {
+		t.Fatalf("inspect diff = %s (%v)", b, err)
+	}
+	st := readStatusJSON(t, filepath.Join(runDir, "sneaky", "status.json"))
+	if st["failure_code"] != string(FailureReadOnlyViolation) || !strings.Contains(st["failure_reason"].(string), "read_only_violation: workspace changed: ") || !strings.Contains(st["failure_reason"].(string), "new.txt") {
+		t.Fatalf("sneaky status = %v", st)
+	}
+	if evs := eventsOfType(t, runDir, "ReadOnlyViolation"); len(evs) != 1 || evs[0]["node_id"] != "sneaky" {
+		t.Fatalf("ReadOnlyViolation events = %v", evs)
+	}
+}
+
+func TestValidateReadOnly(t *testing.T) {
+	cases := map[string]string{
+		`t [shape=parallelogram, tool_command="ls", read_only=true, allowed_write_paths="a.txt"]`: "read_only=true with allowed_write_paths",
+		`t [shape=parallelogram, tool_command="ls", read_only=true, cache=true]`:                  "read_only=true with cache=true",
+		`t [shape=parallelogram, tool_command="ls", read_only=true, on_fail="rollback"]`:          "read_only=true with on_fail=rollback",
+		`t [shape=box, read_only=true]`: "is not a tool node",
+	}
+	for node, want := range cases {
+		g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; ` + node + `; exit [shape=Msquare]; start -> t -> exit; }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, want) {
+			t.Fatalf("%s: diagnostics %q missing %q", node, msgs, want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package attractor
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	junitReportFile = "report.junit.xml"
+	sarifReportFile = "report.sarif.json"
+)
+
+// reportFormats are the --report-formats values, in the order reports are
+// written.
+var reportFormats = []string{"junit", "sarif"}
+
+// ParseReportFormats parses a comma-separated --report-formats value.
+func ParseReportFormats(raw string) ([]string, error) {
+	want := map[string]bool{}
+	for _, f := range splitCSV(raw) {
+		f = strings.ToLower(f)
+		known := false
+		for _, k := range reportFormats {
+			known = known || f == k
+		}
+		if !known {
+			return nil, fmt.Errorf("invalid --report-formats %q: unknown format %q (expected %s)", raw, f, strings.Join(reportFormats, ","))
+		}
+		want[f] = true
+	}
+	out := []string{}
+	for _, k := range reportFormats {
+		if want[k] {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+// runSummary is the run as CI reports see it: every stage attempt and every
+// guardrail violation, rebuilt from events.jsonl so attempts made before a
+// resume are included.
+type runSummary struct {
+	RunID      string
+	Status     string
+	Error      string
+	Stages     []stageAttemptSummary
+	Guardrails []guardrailSummary
+	// CorruptEvents counts events.jsonl lines skipped as unreadable.
+	CorruptEvents int
+}
+
+type stageAttemptSummary struct {
+	NodeID        string
+	NodeType      string
+	Attempt       int
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	Finished      bool
+	Outcome       string
+	FailureReason string
+	FailureCode   string
+	// StderrTail is the failing output of the node's last attempt; earlier
+	// attempts' artifacts are overwritten and have none.
+	StderrTail string
+}
+
+func (s stageAttemptSummary) failed() bool {
+	return s.Finished && s.Outcome == "fail"
+}
+
+func (s stageAttemptSummary) seconds() float64 {
+	if !s.Finished || s.StartedAt.IsZero() || s.FinishedAt.Before(s.StartedAt) {
+		return 0
+	}
+	return s.FinishedAt.Sub(s.StartedAt).Seconds()
+}
+
+type guardrailSummary struct {
+	NodeID string
+	Mode   string
+	Files  []guardrailViolationFile
+}
+
+// buildRunSummary reads the run's events and pairs each StageStarted with
+// the StageCompleted or StageFailed that ends it.
+func buildRunSummary(runDir string, g *Graph, res RunResult) (runSummary, error) {
+	s := runSummary{RunID: res.RunID, Status: res.Status, Error: res.Error}
+	if _, err := os.Stat(filepath.Join(runDir, eventsFile)); err != nil {
+		return s, err
+	}
+	events, corrupt, err := readEvents(runDir)
+	if err != nil {
+		return s, err
+	}
+	s.CorruptEvents = corrupt
+	open := map[string]int{}
+	attempts := map[string]int{}
+	for _, ev := range events {
+		id, _ := ev["node_id"].(string)
+		at, _ := time.Parse(time.RFC3339Nano, fmt.Sprint(ev["at"]))
+		switch ev["type"] {
+		case "StageStarted":
+			attempts[id]++
+			typ := ""
+			if n := g.Nodes[id]; n != nil {
+				typ = handlerType(n)
+			}
+			open[id] = len(s.Stages)
+			s.Stages = append(s.Stages, stageAttemptSummary{NodeID: id, NodeType: typ, Attempt: attempts[id], StartedAt: at})
+		case "StageCompleted", "StageFailed":
+			i, ok := open[id]
+			if !ok {
+				continue
+			}
+			delete(open, id)
+			st := &s.Stages[i]
+			st.Finished = true
+			st.FinishedAt = at
+			st.Outcome, _ = ev["outcome"].(string)
+			if ev["type"] == "StageFailed" {
+				st.Outcome = "fail"
+				st.FailureReason, _ = ev["failure_reason"].(string)
+				if st.FailureReason == "" {
+					st.FailureReason, _ = ev["error"].(string)
+				}
+				st.FailureCode, _ = ev["failure_code"].(string)
+			}
+		case "GuardrailViolation":
+			gs := guardrailSummary{NodeID: id}
+			gs.Mode, _ = ev["mode"].(string)
+			files, _ := ev["files"].([]any)
+			for _, raw := range files {
+				m, _ := raw.(map[string]any)
+				p, _ := m["path"].(string)
+				change, _ := m["change"].(string)
+				gs.Files = append(gs.Files, guardrailViolationFile{Path: p, Change: change})
+			}
+			s.Guardrails = append(s.Guardrails, gs)
+		}
+	}
+	last := map[string]int{}
+	for i, st := range s.Stages {
+		last[st.NodeID] = i
+	}
+	for id, i := range last {
+		if s.Stages[i].failed() {
+			s.Stages[i].StderrTail = stderrTail(nodeArtifactDir(runDir, id))
+		}
+	}
+	return s, nil
+}
+
+// stderrTail is the highest-priority failure output section of a node dir,
+// as selected for failure summaries.
+func stderrTail(nodeDir string) string {
+	if s, ok := verificationFailureSection(nodeDir); ok {
+		return strings.Join(s.Lines, "\n")
+	}
+	for _, file := range []string{"tool.stderr.txt", "codex.stderr.log"} {
+		if s, ok := fileFailureSection(file, filepath.Join(nodeDir, file)); ok {
+			return strings.Join(s.Lines, "\n")
+		}
+	}
+	return ""
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// renderJUnit reports each stage attempt as a testcase: classname is the
+// node type, name the node id.
+func renderJUnit(s runSummary) ([]byte, error) {
+	suite := junitTestSuite{Name: s.RunID, Properties: []junitProperty{{Name: "status", Value: s.Status}}}
+	var total float64
+	for _, st := range s.Stages {
+		tc := junitTestCase{ClassName: st.NodeType, Name: st.NodeID, Time: fmt.Sprintf("%.3f", st.seconds())}
+		switch {
+		case !st.Finished:
+			tc.Skipped = &junitSkipped{Message: "stage did not finish"}
+			suite.Skipped++
+		case st.failed():
+			body := st.FailureReason
+			if st.StderrTail != "" {
+				body += "\n\n" + st.StderrTail
+			}
+			tc.Failure = &junitFailure{Message: st.FailureReason, Type: st.FailureCode, Body: body}
+			suite.Failures++
+		}
+		if suite.Timestamp == "" && !st.StartedAt.IsZero() {
+			suite.Timestamp = st.StartedAt.UTC().Format(time.RFC3339)
+		}
+		total += st.seconds()
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = fmt.Sprintf("%.3f", total)
+	doc := junitTestSuites{Name: "attractor", Tests: suite.Tests, Failures: suite.Failures, Skipped: suite.Skipped, Time: suite.Time, Suites: []junitTestSuite{suite}}
+	b, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+const guardrailSARIFRule = "guardrail_violation"
+
+// renderSARIF reports one SARIF 2.1.0 result per guardrail-violating file.
+// Locations are workspace-relative, under the WORKSPACE uriBaseId.
+func renderSARIF(s runSummary) ([]byte, error) {
+	results := []map[string]any{}
+	for _, gs := range s.Guardrails {
+		files := append([]guardrailViolationFile{}, gs.Files...)
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+		for _, f := range files {
+			results = append(results, map[string]any{
+				"ruleId":  guardrailSARIFRule,
+				"level":   "error",
+				"message": map[string]any{"text": fmt.Sprintf("node %s %s %s outside its allowed_write_paths", gs.NodeID, f.Change, f.Path)},
+				"locations": []map[string]any{{
+					"physicalLocation": map[string]any{"artifactLocation": map[string]any{"uri": f.Path, "uriBaseId": "WORKSPACE"}},
+				}},
+				"properties": map[string]any{"node_id": gs.NodeID, "change": f.Change, "guardrail_mode": gs.Mode},
+			})
+		}
+	}
+	doc := map[string]any{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []map[string]any{{
+			"tool": map[string]any{"driver": map[string]any{
+				"name": "attractor",
+				"rules": []map[string]any{{
+					"id":               guardrailSARIFRule,
+					"shortDescription": map[string]any{"text": "A stage changed a file outside its allowed_write_paths."},
+				}},
+			}},
+			"automationDetails": map[string]any{"id": "attractor/" + s.RunID},
+			"results":           results,
+		}},
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// writeRunReports writes the requested CI reports next to run.result.json.
+// Failures are logged; they never change the run's result.
+func (e *Engine) writeRunReports(res RunResult) {
+	if len(e.reportFormats) == 0 {
+		return
+	}
+	s, err := buildRunSummary(e.RunDir, e.Graph, res)
+	if err != nil {
+		e.Logger.Warn("failed to summarize run for reports", "error", err)
+		return
+	}
+	if s.CorruptEvents > 0 {
+		e.Logger.Warn("skipped corrupt events while summarizing run", "lines", s.CorruptEvents)
+	}
+	for _, format := range e.reportFormats {
+		render, file := renderJUnit, junitReportFile
+		if format == "sarif" {
+			render, file = renderSARIF, sarifReportFile
+		}
+		b, err := render(s)
+		if err == nil {
+			err = os.WriteFile(filepath.Join(e.RunDir, file), b, 0o644)
+		}
+		if err != nil {
+			e.Logger.Warn("failed to write run report", "format", format, "error", err)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package attractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// reportArtifactMaxBytes caps a single node artifact a report template reads.
+const reportArtifactMaxBytes = 1 << 20
+
+// reportHandler renders a type=report node's Go template with the run so far
+// and writes the result to report.output in the workspace.
+type reportHandler struct {
+	// run is the engine's read-only view of the run dir; nil outside a run.
+	run *runArtifacts
+}
+
+// runArtifacts is the read access report nodes get to the run dir: the
+// event-derived run summary and named files in node artifact dirs. Paths
+// never leave the run dir.
+type runArtifacts struct {
+	runID  string
+	runDir string
+	graph  *Graph
+}
+
+// nodeFile returns the contents of name in node's artifact dir. name must be
+// a plain file name and the file a regular file under the size cap.
+func (r *runArtifacts) nodeFile(nodeID, name string) ([]byte, error) {
+	if r.graph.Nodes[nodeID] == nil {
+		return nil, fmt.Errorf("unknown node %s", nodeID)
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("artifact name %q must be a file name", name)
+	}
+	path := filepath.Join(nodeArtifactDir(r.runDir, nodeID), name)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, fmt.Errorf("node %s has no artifact %s", nodeID, name)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("node %s artifact %s is not a regular file", nodeID, name)
+	}
+	if info.Size() > reportArtifactMaxBytes {
+		return nil, fmt.Errorf("node %s artifact %s is %d bytes, over the %d byte limit", nodeID, name, info.Size(), reportArtifactMaxBytes)
+	}
+	return os.ReadFile(path)
+}
+
+// reportData is what a report template sees as dot.
+type reportData struct {
+	RunID       string
+	Goal        string
+	GeneratedAt string
+	// Nodes lists every node that has started, in first-start order.
+	Nodes []reportNode
+	// Attempts lists every stage attempt, including the report's own
+	// unfinished one.
+	Attempts []stageAttemptSummary
+	Context  map[string]any
+}
+
+// reportNode is one node's latest attempt plus run-wide totals.
+type reportNode struct {
+	ID              string
+	Type            string
+	Outcome         string
+	FailureReason   string
+	FailureCode     string
+	Attempts        int
+	DurationSeconds float64
+	// Verification is the node's verification.results.json, for
+	// verification nodes that wrote one.
+	Verification *verificationResults
+}
+
+func (r *runArtifacts) reportData(ctx Context) (reportData, error) {
+	summary, err := buildRunSummary(r.runDir, r.graph, RunResult{RunID: r.runID, Status: "running"})
+	if err != nil {
+		return reportData{}, err
+	}
+	data := reportData{RunID: r.runID, GeneratedAt: time.Now().UTC().Format(time.RFC3339), Attempts: summary.Stages, Context: cloneContext(ctx)}
+	if goal, ok := r.graph.Attrs["goal"]; ok {
+		data.Goal = fmt.Sprintf("%v", goal)
+	}
+	index := map[string]int{}
+	for _, st := range summary.Stages {
+		i, ok := index[st.NodeID]
+		if !ok {
+			i = len(data.Nodes)
+			index[st.NodeID] = i
+			data.Nodes = append(data.Nodes, reportNode{ID: st.NodeID, Type: st.NodeType})
+		}
+		n := &data.Nodes[i]
+		n.Attempts++
+		n.DurationSeconds += st.seconds()
+		n.Outcome, n.FailureReason, n.FailureCode = st.Outcome, st.FailureReason, st.FailureCode
+	}
+	for i := range data.Nodes {
+		n := &data.Nodes[i]
+		if n.Type != "verification" {
+			continue
+		}
+		b, err := r.nodeFile(n.ID, "verification.results.json")
+		if err != nil {
+			continue
+		}
+		var res verificationResults
+		if json.Unmarshal(b, &res) == nil {
+			n.Verification = &res
+		}
+	}
+	return data, nil
+}
+
+// reportTemplateFuncs are the functions a report template may call besides
+// the text/template built-ins.
+func (r *runArtifacts) reportTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"artifact": func(nodeID, name string) (string, error) {
+			b, err := r.nodeFile(nodeID, name)
+			return string(b), err
+		},
+		"json": func(v any) (string, error) {
+			b, err := json.MarshalIndent(v, "", "  ")
+			return string(b), err
+		},
+	}
+}
+
+func reportOutputPath(n *Node) string {
+	return strings.TrimSpace(n.StringAttr("report.output", ""))
+}
+
+// validateReport checks a type=report node names one template source and a
+// workspace-relative output, and that other nodes do not set report attrs.
+func validateReport(n *Node) []Diagnostic {
+	if handlerType(n) != "report" {
+		for _, attr := range []string{"report.template", "report.template_file", "report.output"} {
+			if _, ok := n.Attrs[attr]; ok {
+				return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets %s but is not a report node", n.ID, attr)}}
+			}
+		}
+		return nil
+	}
+	var d []Diagnostic
+	inline := strings.TrimSpace(n.StringAttr("report.template", "")) != ""
+	file := strings.TrimSpace(n.StringAttr("report.template_file", ""))
+	if inline == (file != "") {
+		d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("report node %s must set exactly one of report.template and report.template_file", n.ID)})
+	}
+	out := reportOutputPath(n)
+	if out == "" {
+		d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("report node %s must set report.output", n.ID)})
+	}
+	for _, pair := range [][2]string{{"report.output", out}, {"report.template_file", file}} {
+		attr, p := pair[0], pair[1]
+		switch {
+		case strings.HasPrefix(p, "/"):
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("report node %s %s contains absolute path: %s", n.ID, attr, p)})
+		case strings.Contains(p, ".."):
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("report node %s %s contains parent segment: %s", n.ID, attr, p)})
+		}
+	}
+	return d
+}
+
+func reportTemplateFailure(err error) Outcome {
+	return Outcome{SchemaVersion: 1, Outcome: "fail", FailureReason: "report_template_error: " + err.Error(), FailureCode: FailureReportTemplateError, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}
+}
+
+// Execute renders the template and writes it to report.output. Template
+// problems fail the node; writing the file is subject to the node's
+// allowed_write_paths like any other workspace change.
+func (h reportHandler) Execute(node *Node, ctx Context, _ *Graph, _ string, workspace string) (Outcome, error) {
+	if h.run == nil {
+		return Outcome{}, fmt.Errorf("report node %s needs a run", node.ID)
+	}
+	text := node.StringAttr("report.template", "")
+	if file := strings.TrimSpace(node.StringAttr("report.template_file", "")); file != "" {
+		b, err := os.ReadFile(filepath.Join(workspace, filepath.FromSlash(file)))
+		if err != nil {
+			return reportTemplateFailure(err), nil
+		}
+		text = string(b)
+	}
+	tmpl, err := template.New(node.ID).Option("missingkey=error").Funcs(h.run.reportTemplateFuncs()).Parse(text)
+	if err != nil {
+		return reportTemplateFailure(err), nil
+	}
+	data, err := h.run.reportData(ctx)
+	if err != nil {
+		return Outcome{}, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return reportTemplateFailure(err), nil
+	}
+	out := reportOutputPath(node)
+	path := filepath.Join(workspace, filepath.FromSlash(out))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return Outcome{}, err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return Outcome{}, err
+	}
+	return Outcome{SchemaVersion: 1, Outcome: "success", SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{"report." + node.ID + ".output": filepath.ToSlash(filepath.Clean(out))}}, nil
+}
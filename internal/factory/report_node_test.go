@@ -0,0 +1,88 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const reportNodeDOT = `digraph G {
+	graph [goal="ship it"];
+	start [shape=Mdiamond];
+	build [shape=parallelogram, tool_command="echo built"];
+	report [type=report, "report.template_file"="report.tmpl", "report.output"="docs/REPORT.md", allowed_write_paths="docs/**"];
+	exit [shape=Msquare];
+	start -> build -> report;
+	report -> exit [condition="outcome=success"];
+	report -> exit [condition="outcome=fail"];
+	}`
+
+func runReportNode(t *testing.T, dot, tmpl, runID string) (workspace, runDir string) {
+	t.Helper()
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "report.tmpl"), tmpl)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: runID}); err != nil {
+		t.Fatal(err)
+	}
+	runDir = filepath.Join(runsdir, runID)
+	return filepath.Join(runDir, "workspace"), runDir
+}
+
+func TestReportNodeRendersRunSummary(t *testing.T) {
+	tmpl := "# {{.RunID}}: {{.Goal}}\n{{range .Nodes}}- {{.ID}} ({{.Type}}) {{.Outcome}} x{{.Attempts}}\n{{end}}build said: {{artifact \"build\" \"tool.stdout.txt\"}}"
+	workspace, runDir := runReportNode(t, reportNodeDOT, tmpl, "rn1")
+	b, err := os.ReadFile(filepath.Join(workspace, "docs", "REPORT.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# rn1: ship it\n- start (start) success x1\n- build (tool) success x1\n- report (report)  x1\nbuild said: built\n"
+	if string(b) != want {
+		t.Fatalf("report = %q, want %q", b, want)
+	}
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Context["report.report.output"] != "docs/REPORT.md" {
+		t.Fatalf("context = %v", cp.Context)
+	}
+}
+
+func TestReportNodeFailures(t *testing.T) {
+	cases := []struct {
+		name, dot, tmpl, code, reason string
+	}{
+		{"template error", reportNodeDOT, "{{.Missing}}", string(FailureReportTemplateError), "can't evaluate field Missing"},
+		{"artifact outside node dir", reportNodeDOT, `{{artifact "build" "../manifest.json"}}`, string(FailureReportTemplateError), `artifact name "../manifest.json" must be a file name`},
+		{"guardrail", strings.Replace(reportNodeDOT, `"docs/REPORT.md"`, `"out/REPORT.md"`, 1), "ok", string(FailureGuardrailWriteViolation), "out/REPORT.md"},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, runDir := runReportNode(t, c.dot, c.tmpl, "rf"+string(rune('a'+i)))
+			st := readStatusJSON(t, filepath.Join(runDir, "report", "status.json"))
+			if st["failure_code"] != c.code || !strings.Contains(st["failure_reason"].(string), c.reason) {
+				t.Fatalf("status = %v", st)
+			}
+		})
+	}
+}
+
+func TestValidateReportNode(t *testing.T) {
+	cases := map[string]string{
+		`a [type=report, "report.output"="r.md"]`:                                     "report node a must set exactly one of report.template and report.template_file",
+		`a [type=report, "report.template"="x"]`:                                      "report node a must set report.output",
+		`a [type=report, "report.template"="x", "report.output"="/tmp/r.md"]`:         "report node a report.output contains absolute path: /tmp/r.md",
+		`a [type=report, "report.template_file"="../t.tmpl", "report.output"="r.md"]`: "report node a report.template_file contains parent segment: ../t.tmpl",
+		`a [shape=parallelogram, tool_command="true", "report.output"="r.md"]`:        "node a sets report.output but is not a report node",
+	}
+	for node, want := range cases {
+		g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; ` + node + `; exit [shape=Msquare]; start -> a -> exit; }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, want) {
+			t.Fatalf("%s: diagnostics %q missing %q", node, msgs, want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package attractor
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files under testdata")
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("%s mismatch (run with -update to rewrite):\n%s", name, got)
+	}
+}
+
+// writeReportFixture writes a run dir with a retried tool stage, a
+// guardrail violation, and a stage that never finished.
+func writeReportFixture(t *testing.T) (string, *Graph) {
+	t.Helper()
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	test [shape=parallelogram, tool_command="go test ./..."];
+	impl [shape=box, allowed_write_paths="src"];
+	verify [type=verification];
+	exit [shape=Msquare];
+	start -> test -> impl -> verify -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runDir := t.TempDir()
+	writeFile(t, filepath.Join(runDir, "events.jsonl"), strings.Join([]string{
+		`{"type":"PipelineStarted","run_id":"r1","at":"2026-01-01T00:00:00Z"}`,
+		`{"type":"StageStarted","node_id":"test","at":"2026-01-01T00:00:01Z"}`,
+		`{"type":"StageFailed","node_id":"test","failure_reason":"tool exited 1","failure_code":"tool_exit_nonzero","at":"2026-01-01T00:00:03.5Z"}`,
+		`{"type":"StageRetrying","node_id":"test","retry_count":1,"at":"2026-01-01T00:00:03.5Z"}`,
+		`{"type":"StageStarted","node_id":"test","at":"2026-01-01T00:00:04Z"}`,
+		`{"type":"StageFailed","node_id":"test","failure_reason":"tool exited 2","failure_code":"tool_exit_nonzero","at":"2026-01-01T00:00:05Z"}`,
+		`{"type":"StageStarted","node_id":"impl","at":"2026-01-01T00:00:06Z"}`,
+		`{"type":"GuardrailViolation","node_id":"impl","mode":"fail","paths":["go.mod","README.md"],"files":[{"path":"go.mod","change":"modified"},{"path":"README.md","change":"deleted"}],"at":"2026-01-01T00:00:08Z"}`,
+		`{"type":"StageFailed","node_id":"impl","failure_reason":"guardrail_violation: wrote disallowed files: go.mod,README.md","failure_code":"guardrail_write_violation","at":"2026-01-01T00:00:08Z"}`,
+		`{"type":"StageStarted","node_id":"verify","at":"2026-01-01T00:00:09Z"}`,
+		`{"type":"StageCompleted","node_id":"verify","outcome":"success","at":"2026-01-01T00:00:09.25Z"}`,
+		`{"type":"StageStarted","node_id":"exit","at":"2026-01-01T00:00:10Z"}`,
+		``,
+	}, "\n"))
+	writeFile(t, filepath.Join(runDir, "test", "tool.stderr.txt"), "--- FAIL: TestX\n    x_test.go:12: got 1 <want 2>\n")
+	return runDir, g
+}
+
+func TestRunReportsMatchGolden(t *testing.T) {
+	runDir, g := writeReportFixture(t)
+	s, err := buildRunSummary(runDir, g, RunResult{RunID: "r1", Status: "failed", Error: "stage impl failed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	junit, err := renderJUnit(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(junit, new(junitTestSuites)); err != nil {
+		t.Fatalf("junit report is not well-formed: %v", err)
+	}
+	checkGolden(t, "report.junit.golden.xml", junit)
+	sarif, err := renderSARIF(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(sarif) {
+		t.Fatal("sarif report is not valid JSON")
+	}
+	checkGolden(t, "report.sarif.golden.json", sarif)
+}
+
+func TestRunPipelineWritesRequestedReports(t *testing.T) {
+	dot := `digraph G { start [shape=Mdiamond]; t [shape=parallelogram, tool_command="sh -c 'echo changed > b.txt'", allowed_write_paths="a.txt"]; exit [shape=Msquare]; start -> t; t -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "b.txt"), "y")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rep1", ReportFormats: []string{"junit", "sarif"}}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "rep1")
+	var suites junitTestSuites
+	b, err := os.ReadFile(filepath.Join(runDir, junitReportFile))
+	if err != nil || xml.Unmarshal(b, &suites) != nil {
+		t.Fatalf("junit report: %v\n%s", err, b)
+	}
+	var failed *junitTestCase
+	for i, c := range suites.Suites[0].Cases {
+		if c.Name == "t" {
+			failed = &suites.Suites[0].Cases[i]
+		}
+	}
+	if failed == nil || failed.ClassName != "tool" || failed.Failure == nil || !strings.HasPrefix(failed.Failure.Message, "guardrail_violation") {
+		t.Fatalf("junit cases = %+v", suites.Suites[0].Cases)
+	}
+	var sarif struct {
+		Runs []struct {
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	b, err = os.ReadFile(filepath.Join(runDir, sarifReportFile))
+	if err != nil || json.Unmarshal(b, &sarif) != nil {
+		t.Fatalf("sarif report: %v\n%s", err, b)
+	}
+	res := sarif.Runs[0].Results
+	if len(res) != 1 || res[0].RuleID != "guardrail_violation" || res[0].Locations[0].PhysicalLocation.ArtifactLocation.URI != "b.txt" {
+		t.Fatalf("sarif results = %+v", res)
+	}
+
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rep2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(runsdir, "rep2", junitReportFile)); !os.IsNotExist(err) {
+		t.Fatalf("reports written without --report-formats: %v", err)
+	}
+}
+
+func TestParseReportFormats(t *testing.T) {
+	got, err := ParseReportFormats("SARIF, junit,sarif")
+	if err != nil || strings.Join(got, ",") != "junit,sarif" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if _, err := ParseReportFormats("junit,html"); err == nil || !strings.Contains(err.Error(), `unknown format "html"`) {
+		t.Fatalf("expected unknown format error, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// requiredToolNodes returns the node ids listed in required_tool_node, which
+// accepts a comma-separated list.
+func requiredToolNodes(n *Node) []string {
+	return uniqueNonEmpty(splitCSV(n.StringAttr("required_tool_node", "")))
+}
+
+// canSatisfyToolRequirement reports whether a node's outcome is evidence for
+// requires_tool_success: tool and verification nodes only.
+func canSatisfyToolRequirement(n *Node) bool {
+	typ := handlerType(n)
+	return typ == "tool" || typ == "verification"
+}
+
+// validateRequiredToolNodes checks that every required_tool_node entry names
+// a tool or verification node that runs before the requiring node.
+func validateRequiredToolNodes(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := g.Nodes[id]
+		reqs := requiredToolNodes(n)
+		if len(reqs) == 0 {
+			if n.BoolAttr("requires_tool_success", false) {
+				d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s sets requires_tool_success without required_tool_node; the check is skipped", id)})
+			}
+			continue
+		}
+		var ancestors map[string]bool
+		for _, req := range reqs {
+			target := g.Nodes[req]
+			switch {
+			case target == nil:
+				d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s required_tool_node references unknown node: %s", id, req)})
+			case !canSatisfyToolRequirement(target):
+				d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s required_tool_node %s must be a tool or verification node, got %s", id, req, handlerType(target))})
+			default:
+				if ancestors == nil {
+					ancestors = graphAncestors(g, id)
+				}
+				if !ancestors[req] {
+					d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s required_tool_node %s is not an ancestor, so it cannot have run first", id, req)})
+				}
+			}
+		}
+	}
+	return d
+}
+
+// graphAncestors returns the nodes with a path to id, following edges and
+// loop.body_entry links backwards.
+func graphAncestors(g *Graph, id string) map[string]bool {
+	parents := map[string][]string{}
+	for _, e := range g.Edges {
+		parents[e.To] = append(parents[e.To], e.From)
+	}
+	for _, n := range g.Nodes {
+		if isManagerLoopNode(n) {
+			if entry := strings.TrimSpace(n.StringAttr("loop.body_entry", "")); entry != "" {
+				parents[entry] = append(parents[entry], n.ID)
+			}
+		}
+	}
+	seen := map[string]bool{}
+	queue := append([]string{}, parents[id]...)
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if seen[cur] {
+			continue
+		}
+		seen[cur] = true
+		queue = append(queue, parents[cur]...)
+	}
+	return seen
+}
+
+// checkRequiredToolNodes returns the failure reason and code for a node whose
+// required tool nodes have not all succeeded, or "" when they have. Nodes
+// that never executed are reported separately from nodes that failed.
+func checkRequiredToolNodes(runDir string, node *Node) (string, FailureCode) {
+	notRun := []string{}
+	failed := []string{}
+	for _, req := range requiredToolNodes(node) {
+		status, err := readStatus(filepath.Join(nodeArtifactDir(runDir, req), "status.json"))
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			notRun = append(notRun, req)
+		case err != nil:
+			failed = append(failed, fmt.Sprintf("%s (unreadable status: %v)", req, err))
+		case status.Outcome != "success":
+			failed = append(failed, fmt.Sprintf("%s (outcome=%s)", req, status.Outcome))
+		}
+	}
+	parts := []string{}
+	code := FailureCode("")
+	if len(failed) > 0 {
+		parts = append(parts, "required tool node not successful: "+strings.Join(failed, ", "))
+		code = FailureRequiredToolFailed
+	}
+	if len(notRun) > 0 {
+		parts = append(parts, "required tool node never executed: "+strings.Join(notRun, ", "))
+		if code == "" {
+			code = FailureRequiredToolNotRun
+		}
+	}
+	return strings.Join(parts, "; "), code
+}
@@ -0,0 +1,88 @@
+package attractor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateRequiredToolNodes(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	build [shape=parallelogram, tool_command="true"];
+	verify [shape=box, type="verification"];
+	impl [shape=box, requires_tool_success=true, required_tool_node="build,verify"];
+	typo [shape=box, requires_tool_success=true, required_tool_node="biuld"];
+	agent [shape=box, requires_tool_success=true, required_tool_node="impl"];
+	later [shape=box, requires_tool_success=true, required_tool_node="after"];
+	after [shape=parallelogram, tool_command="true"];
+	bare [shape=box, requires_tool_success=true];
+	exit [shape=Msquare];
+	start -> build -> verify -> impl -> typo -> agent -> later -> after -> bare -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{
+		"node typo required_tool_node references unknown node: biuld",
+		"node agent required_tool_node impl must be a tool or verification node, got codergen",
+		"node later required_tool_node after is not an ancestor",
+		"node bare sets requires_tool_success without required_tool_node",
+	} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+	if strings.Contains(msgs, "node impl required_tool_node") {
+		t.Fatalf("transitive ancestors rejected:\n%s", msgs)
+	}
+}
+
+func TestRequiredToolNodeDistinguishesNotRunFromFailed(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	gate [shape=parallelogram, tool_command="true"];
+	lint [shape=parallelogram, tool_command="true"];
+	unit [shape=parallelogram, tool_command="exit 3"];
+	a [shape=box, requires_tool_success=true, required_tool_node="lint,unit"];
+	exit [shape=Msquare];
+	start -> gate;
+	gate -> lint [condition="outcome=fail"];
+	gate -> unit [condition="outcome=success"];
+	lint -> unit;
+	unit -> a;
+	a -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rt1"})
+	st := readStatusJSON(t, filepath.Join(runsdir, "rt1", "a", "status.json"))
+	want := "required tool node not successful: unit (outcome=fail); required tool node never executed: lint"
+	if st["outcome"] != "fail" || st["failure_reason"] != want || st["failure_code"] != string(FailureRequiredToolFailed) {
+		t.Fatalf("status = %v", st)
+	}
+	if got := ClassifyFailure("required tool node never executed: lint"); got != FailureRequiredToolNotRun {
+		t.Fatalf("ClassifyFailure = %q", got)
+	}
+}
+
+func TestRequiredToolNodeFollowsMatrixCopies(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	check [shape=parallelogram, matrix="target=a,b", tool_command="true"];
+	fix [shape=box, matrix="target=a,b", requires_tool_success=true, required_tool_node="check"];
+	report [shape=box, requires_tool_success=true, required_tool_node="check"];
+	exit [shape=Msquare];
+	start -> check -> fix -> report -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Nodes["fix_b"].StringAttr("required_tool_node", ""); got != "check_b" {
+		t.Fatalf("fix_b required_tool_node = %q", got)
+	}
+	if got := g.Nodes["report"].StringAttr("required_tool_node", ""); got != "check_a,check_b" {
+		t.Fatalf("report required_tool_node = %q", got)
+	}
+}
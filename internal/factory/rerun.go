@@ -0,0 +1,135 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var retrySuffixRe = regexp.MustCompile(`-retry-\d+$`)
+
+// rerunManifest is the part of manifest.json that reruns and run listings
+// read.
+type rerunManifest struct {
+	PipelinePath       string                    `json:"pipeline_path"`
+	PipelineSource     string                    `json:"pipeline_source"`
+	OriginalWorkdir    string                    `json:"original_workdir"`
+	WorkspacePath      string                    `json:"workspace_path"`
+	Params             map[string]string         `json:"params"`
+	AdditionalWorkdirs []additionalWorkdirRecord `json:"additional_workdirs"`
+	StartedAt          string                    `json:"started_at"`
+	Goal               any                       `json:"goal"`
+	RetryOf            string                    `json:"retry_of"`
+	RetriedBy          []string                  `json:"retried_by"`
+	EntryNode          string                    `json:"entry_node"`
+	GitSource          *gitSourceRecord          `json:"git_source"`
+}
+
+func readRerunManifest(runDir string) (rerunManifest, error) {
+	var m rerunManifest
+	b, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("invalid manifest in %s: %w", runDir, err)
+	}
+	return m, nil
+}
+
+// RerunConfig returns the RunConfig for a fresh run that retries the run in
+// runDir (`factory rerun`): the same pipeline, workdir, params, and
+// additional workdirs, a derived run id (<id>-retry-<n>), and RetryOf set.
+// The pipeline file is read again when it still exists; otherwise the copy
+// embedded in the manifest runs. With fromFailedWorkspace the new run copies
+// the old run's workspace instead of the original workdir. Completed runs
+// and runs that are still executing are refused.
+func RerunConfig(runDir string, fromFailedWorkspace bool) (RunConfig, error) {
+	if err := checkRunLayout(runDir); err != nil {
+		return RunConfig{}, err
+	}
+	rep, err := DiagnoseRun(runDir)
+	if err != nil {
+		return RunConfig{}, err
+	}
+	if rep.State == RunStateCompleted {
+		return RunConfig{}, fmt.Errorf("%w: %s", ErrRunCompleted, runDir)
+	}
+	if rep.Lock != nil && rep.Lock.Live {
+		return RunConfig{}, fmt.Errorf("%w: pid %d on %s", ErrRunLocked, rep.Lock.PID, rep.Lock.Host)
+	}
+	m, err := readRerunManifest(runDir)
+	if err != nil {
+		return RunConfig{}, err
+	}
+	runsdir, oldID := filepath.Dir(runDir), filepath.Base(runDir)
+	cfg := RunConfig{Runsdir: runsdir, RunID: nextRetryRunID(runsdir, oldID), Workdir: sourceWorkdir(runsdir, m), Params: m.Params, RetryOf: oldID, EntryNode: m.EntryNode}
+	if p := strings.TrimSpace(m.PipelinePath); p != "" && p != "-" {
+		cfg.PipelinePath = p
+	}
+	if _, err := os.Stat(cfg.PipelinePath); cfg.PipelinePath == "" || err != nil {
+		if m.PipelineSource == "" {
+			return RunConfig{}, fmt.Errorf("manifest in %s has no embedded pipeline and %q cannot be read", runDir, cfg.PipelinePath)
+		}
+		cfg.PipelineSource = m.PipelineSource
+	}
+	if fromFailedWorkspace {
+		if _, err := os.Stat(m.WorkspacePath); err != nil {
+			return RunConfig{}, fmt.Errorf("failed run workspace: %w", err)
+		}
+		// The old workspace already holds the additional workdirs under
+		// their mountpoints.
+		cfg.Workdir = m.WorkspacePath
+		return cfg, nil
+	}
+	if m.GitSource != nil {
+		cfg.Workdir = ""
+		cfg.GitSource = &GitSource{URL: m.GitSource.URL, Ref: m.GitSource.Ref}
+	}
+	for _, r := range m.AdditionalWorkdirs {
+		cfg.AdditionalWorkdirs = append(cfg.AdditionalWorkdirs, AdditionalWorkdir{Path: r.Path, Mount: r.Mount})
+	}
+	return cfg, nil
+}
+
+// sourceWorkdir is the workdir the retry chain started from. A run seeded
+// with --from-failed-workspace records the failed run's workspace as its
+// workdir, so those links are followed back to the real one.
+func sourceWorkdir(runsdir string, m rerunManifest) string {
+	seen := map[string]bool{}
+	for m.RetryOf != "" && !seen[m.RetryOf] {
+		seen[m.RetryOf] = true
+		prev, err := readRerunManifest(filepath.Join(runsdir, m.RetryOf))
+		if err != nil || filepath.Clean(prev.WorkspacePath) != filepath.Clean(m.OriginalWorkdir) {
+			break
+		}
+		m = prev
+	}
+	return m.OriginalWorkdir
+}
+
+// nextRetryRunID returns <base>-retry-<n> for the lowest n not already in
+// runsdir, where base is oldID without a -retry-<n> suffix, so retries of a
+// retry keep counting up instead of nesting suffixes.
+func nextRetryRunID(runsdir, oldID string) string {
+	base := retrySuffixRe.ReplaceAllString(oldID, "")
+	for n := 1; ; n++ {
+		id := base + "-retry-" + strconv.Itoa(n)
+		if _, err := os.Lstat(filepath.Join(runsdir, id)); os.IsNotExist(err) {
+			return id
+		}
+	}
+}
+
+// linkRetry appends newID to the retried_by list in the old run's manifest.
+func linkRetry(oldRunDir, newID string) error {
+	m, err := readRerunManifest(oldRunDir)
+	if err != nil {
+		return err
+	}
+	return updateManifest(oldRunDir, "retried_by", append(m.RetriedBy, newID))
+}
@@ -0,0 +1,67 @@
+package attractor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRerunLinksRetryChain(t *testing.T) {
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=parallelogram, tool_command="echo ${param.msg} >> log.txt; test -f ok"]; exit [shape=Msquare]; start -> a; a -> exit [condition="outcome=success"]; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1", Params: map[string]string{"msg": "hi"}})
+
+	cfg, err := RerunConfig(filepath.Join(runsdir, "r1"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RunID != "r1-retry-1" || cfg.RetryOf != "r1" || cfg.Params["msg"] != "hi" || cfg.Workdir != filepath.Join(runsdir, "r1", "workspace") {
+		t.Fatalf("rerun config = %+v", cfg)
+	}
+	_ = RunPipeline(cfg)
+	if b, _ := os.ReadFile(filepath.Join(runsdir, "r1-retry-1", "workspace", "log.txt")); string(b) != "hi\nhi\n" {
+		t.Fatalf("from-failed-workspace log = %q", b)
+	}
+
+	writeFile(t, filepath.Join(workdir, "ok"), "")
+	cfg, err = RerunConfig(filepath.Join(runsdir, "r1-retry-1"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RunID != "r1-retry-2" || cfg.Workdir != workdir {
+		t.Fatalf("rerun config = %+v", cfg)
+	}
+	if err := RunPipeline(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(runsdir, "r1-retry-2", "workspace", "log.txt")); string(b) != "hi\n" {
+		t.Fatalf("fresh workspace log = %q", b)
+	}
+
+	for id, want := range map[string]string{"r1": "<-r1-retry-1", "r1-retry-1": "r1<-r1-retry-2", "r1-retry-2": "r1-retry-1<-"} {
+		m, err := readRerunManifest(filepath.Join(runsdir, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.RetryOf + "<-" + strings.Join(m.RetriedBy, ","); got != want {
+			t.Fatalf("%s links = %s, want %s", id, got, want)
+		}
+	}
+	if _, err := RerunConfig(filepath.Join(runsdir, "r1-retry-2"), false); !errors.Is(err, ErrRunCompleted) {
+		t.Fatalf("rerun of completed run err = %v", err)
+	}
+
+	runs, err := ListRuns(runsdir, ListRunsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range runs {
+		got = append(got, strings.Repeat(">", r.Depth)+r.RunID+":"+r.Status)
+	}
+	if strings.Join(got, ",") != "r1:failed,>r1-retry-1:failed,>>r1-retry-2:completed" {
+		t.Fatalf("listing = %v", got)
+	}
+}
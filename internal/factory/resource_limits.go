@@ -0,0 +1,152 @@
+package attractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const resourceLimitReportFile = "resource.limit.json"
+
+// resourceLimits are the per-command limits set by tool_max_memory and
+// tool_cpu_seconds on tool and verification nodes.
+type resourceLimits struct {
+	MemoryBytes uint64
+	CPUSeconds  int
+}
+
+func (l resourceLimits) empty() bool {
+	return l.MemoryBytes == 0 && l.CPUSeconds == 0
+}
+
+// resourceLimitReport is resource.limit.json in the node dir and the body of
+// the ResourceLimitExceeded event.
+type resourceLimitReport struct {
+	Limit            string `json:"limit"`
+	MemoryBytes      uint64 `json:"tool_max_memory_bytes,omitempty"`
+	CPUSeconds       int    `json:"tool_cpu_seconds,omitempty"`
+	Command          string `json:"command"`
+	ExitCode         int    `json:"exit_code"`
+	StderrIndication string `json:"stderr_indication,omitempty"`
+}
+
+var byteSizeRe = regexp.MustCompile(`^(\d+)\s*([KMGT]I?B?)?$`)
+
+// parseByteSize reads sizes such as "2GB", "512MiB", "64K", or plain bytes.
+// Units are powers of 1024 with or without the "i".
+func parseByteSize(raw string) (uint64, error) {
+	m := byteSizeRe.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(raw)))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 512MB or 2GB)", raw)
+	}
+	n, err := strconv.ParseUint(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", raw, err)
+	}
+	shift := map[byte]uint{'K': 10, 'M': 20, 'G': 30, 'T': 40}
+	if m[2] != "" {
+		s := shift[m[2][0]]
+		if n > math.MaxUint64>>s {
+			return 0, fmt.Errorf("invalid size %q: too large", raw)
+		}
+		n <<= s
+	}
+	return n, nil
+}
+
+func parseResourceLimits(n *Node) (resourceLimits, error) {
+	var l resourceLimits
+	if raw := strings.TrimSpace(n.StringAttr("tool_max_memory", "")); raw != "" {
+		b, err := parseByteSize(raw)
+		if err != nil || b == 0 {
+			return l, fmt.Errorf("invalid tool_max_memory %q (expected a positive size such as 2GB)", raw)
+		}
+		l.MemoryBytes = b
+	}
+	if _, ok := n.Attrs["tool_cpu_seconds"]; ok {
+		s := n.IntAttr("tool_cpu_seconds", 0)
+		if s <= 0 {
+			return l, fmt.Errorf("invalid tool_cpu_seconds %v (expected a positive integer)", n.Attrs["tool_cpu_seconds"])
+		}
+		l.CPUSeconds = s
+	}
+	return l, nil
+}
+
+// validateResourceLimits rejects malformed limits and limits on nodes that
+// run no commands, and warns where limits cannot be enforced.
+func validateResourceLimits(n *Node) []Diagnostic {
+	_, mem := n.Attrs["tool_max_memory"]
+	_, cpu := n.Attrs["tool_cpu_seconds"]
+	if !mem && !cpu {
+		return nil
+	}
+	if typ := handlerType(n); typ != "tool" && typ != "verification" {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets tool_max_memory or tool_cpu_seconds but is not a tool or verification node", n.ID)}}
+	}
+	if _, err := parseResourceLimits(n); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s: %v", n.ID, err)}}
+	}
+	if !resourceLimitsSupported {
+		return []Diagnostic{{Level: "WARN", Message: fmt.Sprintf("node %s: tool_max_memory and tool_cpu_seconds are not supported on this platform and will be ignored", n.ID)}}
+	}
+	return nil
+}
+
+// outOfMemoryRe matches what common runtimes print when an allocation fails
+// under an address-space limit.
+var outOfMemoryRe = regexp.MustCompile(`(?i)out of memory|cannot allocate memory|memory exhausted|MemoryError|bad_alloc|failed to allocate`)
+
+// resourceLimitFailure writes resource.limit.json when a failed command was
+// stopped by one of its limits and returns the outcome for it. ok is false
+// when the failure does not look limit-related.
+func resourceLimitFailure(nodeDir, command string, l resourceLimits, waitErr error, exitCode int, stderr []byte) (Outcome, bool, error) {
+	if l.empty() || !resourceLimitsSupported {
+		return Outcome{}, false, nil
+	}
+	report := resourceLimitReport{MemoryBytes: l.MemoryBytes, CPUSeconds: l.CPUSeconds, Command: command, ExitCode: exitCode}
+	switch {
+	case l.MemoryBytes > 0 && outOfMemoryRe.Match(stderr):
+		report.Limit = "memory"
+		report.StderrIndication = outOfMemoryRe.FindString(string(stderr))
+	case l.CPUSeconds > 0 && killedByCPULimit(waitErr, exitCode):
+		report.Limit = "cpu"
+	case l.MemoryBytes > 0 && killedByMemoryLimit(waitErr, exitCode):
+		report.Limit = "memory"
+	default:
+		return Outcome{}, false, nil
+	}
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return Outcome{}, false, err
+	}
+	if err := os.WriteFile(filepath.Join(nodeDir, resourceLimitReportFile), append(b, '\n'), 0o644); err != nil {
+		return Outcome{}, false, err
+	}
+	return Outcome{SchemaVersion: 1, Outcome: "fail", FailureReason: string(FailureResourceLimitExceeded), FailureCode: FailureResourceLimitExceeded, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}, true, nil
+}
+
+// recordResourceLimitEvent turns the node's resource.limit.json into a
+// ResourceLimitExceeded event.
+func (e *Engine) recordResourceLimitEvent(node *Node, nodeDir string) {
+	b, err := os.ReadFile(filepath.Join(nodeDir, resourceLimitReportFile))
+	if err != nil {
+		return
+	}
+	ev := map[string]any{}
+	if json.Unmarshal(b, &ev) != nil {
+		return
+	}
+	ev["schema_version"] = 1
+	ev["type"] = "ResourceLimitExceeded"
+	ev["node_id"] = node.ID
+	ev["at"] = time.Now().UTC().Format(time.RFC3339Nano)
+	e.recordEvent(ev)
+	e.Logger.Warn("command exceeded its resource limit", "node", node.ID, "limit", ev["limit"])
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+const resourceLimitsSupported = true
+
+// limitCommand makes cmd run under l by starting it through sh, which sets
+// RLIMIT_AS and RLIMIT_CPU with ulimit and then execs the original program,
+// so the limits apply to it and everything it spawns.
+func limitCommand(cmd *exec.Cmd, l resourceLimits) {
+	if l.empty() || cmd.Err != nil {
+		return
+	}
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		return
+	}
+	steps := []string{}
+	if l.MemoryBytes > 0 {
+		kb := (l.MemoryBytes + 1023) / 1024
+		steps = append(steps, fmt.Sprintf("ulimit -v %d || exit 125", kb))
+	}
+	if l.CPUSeconds > 0 {
+		steps = append(steps, fmt.Sprintf("ulimit -t %d || exit 125", l.CPUSeconds))
+	}
+	script := strings.Join(append(steps, `exec "$0" "$@"`), "; ")
+	cmd.Args = append([]string{"sh", "-c", script, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = sh
+}
+
+// killedByCPULimit reports a SIGXCPU or SIGKILL death, either of the command
+// itself or of a child whose shell exited with 128+signal.
+func killedByCPULimit(waitErr error, exitCode int) bool {
+	return diedBySignal(waitErr, exitCode, syscall.SIGXCPU, syscall.SIGKILL)
+}
+
+// killedByMemoryLimit reports deaths typical of failed allocations under
+// RLIMIT_AS: runtimes that abort, crash dereferencing a failed mmap, or are
+// killed.
+func killedByMemoryLimit(waitErr error, exitCode int) bool {
+	return diedBySignal(waitErr, exitCode, syscall.SIGSEGV, syscall.SIGABRT, syscall.SIGKILL)
+}
+
+func diedBySignal(waitErr error, exitCode int, sigs ...syscall.Signal) bool {
+	var ee *exec.ExitError
+	if errors.As(waitErr, &ee) {
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			for _, s := range sigs {
+				if ws.Signal() == s {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	for _, s := range sigs {
+		if exitCode == 128+int(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package attractor
+
+import "os/exec"
+
+const resourceLimitsSupported = false
+
+func limitCommand(*exec.Cmd, resourceLimits) {}
+
+func killedByCPULimit(error, int) bool { return false }
+
+func killedByMemoryLimit(error, int) bool { return false }
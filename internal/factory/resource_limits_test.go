@@ -0,0 +1,124 @@
+package attractor
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// allocateGigabyteAwk doubles a string until it needs about 1 GiB.
+const allocateGigabyteAwk = `BEGIN { s = "aaaaaaaaaaaaaaaa"; for (i = 0; i < 26; i++) s = s s; print length(s) }`
+
+func TestToolMemoryLimitFailsWithResourceLimitExceeded(t *testing.T) {
+	if !resourceLimitsSupported {
+		t.Skip("resource limits are not supported on this platform")
+	}
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	hog [shape=parallelogram, tool_max_memory="48MB", tool_command="awk '` + strings.ReplaceAll(allocateGigabyteAwk, `"`, `\"`) + `'"];
+	exit [shape=Msquare];
+	start -> hog;
+	hog -> exit [condition="outcome=fail"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rl1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "rl1")
+	st := readStatusJSON(t, filepath.Join(runDir, "hog", "status.json"))
+	if st["failure_reason"] != "resource_limit_exceeded" || st["failure_code"] != string(FailureResourceLimitExceeded) {
+		t.Fatalf("status = %v", st)
+	}
+	evs := eventsOfType(t, runDir, "ResourceLimitExceeded")
+	if len(evs) != 1 || evs[0]["node_id"] != "hog" || evs[0]["limit"] != "memory" || evs[0]["tool_max_memory_bytes"] != float64(48<<20) {
+		t.Fatalf("ResourceLimitExceeded events = %v", evs)
+	}
+}
+
+func TestLimitCommandAppliesToExecutedPrograms(t *testing.T) {
+	if !resourceLimitsSupported {
+		t.Skip("resource limits are not supported on this platform")
+	}
+	limits := resourceLimits{MemoryBytes: 48 << 20}
+	cmd := exec.Command("awk", allocateGigabyteAwk)
+	limitCommand(cmd, limits)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		t.Fatal("expected the allocation to fail under the limit")
+	}
+	code := -1
+	if ee, ok := err.(*exec.ExitError); ok {
+		code = ee.ExitCode()
+	}
+	nodeDir := t.TempDir()
+	out, ok, ferr := resourceLimitFailure(nodeDir, "awk", limits, err, code, []byte(stderr.String()))
+	if ferr != nil || !ok || out.FailureCode != FailureResourceLimitExceeded {
+		t.Fatalf("classification = %+v %v %v (stderr %q)", out, ok, ferr, stderr.String())
+	}
+	report := readStatusJSON(t, filepath.Join(nodeDir, "resource.limit.json"))
+	if report["limit"] != "memory" || report["command"] != "awk" {
+		t.Fatalf("report = %v", report)
+	}
+	if _, ok, _ := resourceLimitFailure(t.TempDir(), "false", limits, nil, 1, []byte("assertion failed")); ok {
+		t.Fatal("ordinary failures must not be classified as limit failures")
+	}
+}
+
+func TestParseResourceLimits(t *testing.T) {
+	for raw, want := range map[string]uint64{"2GB": 2 << 30, "512MiB": 512 << 20, "64k": 64 << 10, "1000": 1000} {
+		if got, err := parseByteSize(raw); err != nil || got != want {
+			t.Fatalf("parseByteSize(%q) = %d, %v", raw, got, err)
+		}
+	}
+	if got, err := parseByteSize("16777216T"); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("parseByteSize(16777216T) = %d, %v", got, err)
+	}
+	if got, err := parseByteSize("16777215T"); err != nil || got != 16777215<<40 {
+		t.Fatalf("parseByteSize(16777215T) = %d, %v", got, err)
+	}
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="true", tool_max_memory="lots"];
+	b [shape=parallelogram, tool_command="true", tool_cpu_seconds=0];
+	c [shape=box, tool_cpu_seconds=10];
+	exit [shape=Msquare];
+	start -> a -> b -> c -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{
+		`node a: invalid tool_max_memory "lots"`,
+		"node b: invalid tool_cpu_seconds 0",
+		"node c sets tool_max_memory or tool_cpu_seconds but is not a tool or verification node",
+	} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+}
+
+func TestToolCPULimitFailsWithResourceLimitExceeded(t *testing.T) {
+	if !resourceLimitsSupported {
+		t.Skip("resource limits are not supported on this platform")
+	}
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	spin [shape=parallelogram, tool_cpu_seconds=1, tool_command="while :; do :; done"];
+	exit [shape=Msquare];
+	start -> spin;
+	spin -> exit [condition="outcome=fail"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rl2"}); err != nil {
+		t.Fatal(err)
+	}
+	evs := eventsOfType(t, filepath.Join(runsdir, "rl2"), "ResourceLimitExceeded")
+	if len(evs) != 1 || evs[0]["limit"] != "cpu" || evs[0]["tool_cpu_seconds"] != float64(1) {
+		t.Fatalf("ResourceLimitExceeded events = %v", evs)
+	}
+}
@@ -0,0 +1,63 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrRetryBudgetExhausted is returned by RunPipeline when the run's
+// StageRetrying events exceed the graph's retry_budget_total.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// RunTotals counts work across the whole run. It is kept in checkpoint.json
+// so a resume continues the count, and reported in run.result.json.
+type RunTotals struct {
+	// Attempts counts handler attempts, including retries.
+	Attempts int `json:"attempts"`
+	// Retries counts StageRetrying events.
+	Retries int `json:"retries"`
+	// Visits counts how many times each node was entered.
+	Visits map[string]int `json:"visits"`
+	// NodeAttempts counts handler attempts per node; it numbers attempt ids.
+	NodeAttempts map[string]int `json:"node_attempts,omitempty"`
+}
+
+func newRunTotals() RunTotals {
+	return RunTotals{Visits: map[string]int{}}
+}
+
+// retryBudgetTotal is retry_budget_total from the graph; 0 means unlimited.
+func retryBudgetTotal(g *Graph) int {
+	return graphIntAttr(g, "retry_budget_total", 0)
+}
+
+func validateRetryBudget(g *Graph) []Diagnostic {
+	raw, ok := g.Attrs["retry_budget_total"]
+	if !ok {
+		return nil
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(fmt.Sprintf("%v", raw))); err != nil || n < 0 {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("graph has invalid retry_budget_total: %v (expected a non-negative integer)", raw)}}
+	}
+	return nil
+}
+
+// countVisit records that node was entered and mirrors the count into
+// internal.visits.<node>.
+func (e *Engine) countVisit(node *Node) {
+	e.totals.Visits[node.ID]++
+	e.Context["internal.visits."+node.ID] = e.totals.Visits[node.ID]
+}
+
+// countRetry records a StageRetrying event and fails once the run has
+// retried more often than retry_budget_total allows.
+func (e *Engine) countRetry() error {
+	e.totals.Retries++
+	budget := retryBudgetTotal(e.Graph)
+	if budget > 0 && e.totals.Retries > budget {
+		return fmt.Errorf("%w: %d retries exceed retry_budget_total=%d", ErrRetryBudgetExhausted, e.totals.Retries, budget)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package attractor
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRetryBudgetAbortsRun(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { graph [retry_budget_total=2]; start [shape=Mdiamond]; a [shape=box, max_retries=5, "test.outcome"="retry"]; exit [shape=Msquare]; start -> a; a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rb1"})
+	if !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Fatalf("expected ErrRetryBudgetExhausted, got %v", err)
+	}
+	runDir := filepath.Join(runsdir, "rb1")
+	aborted := eventsOfType(t, runDir, "PipelineAborted")
+	if len(aborted) != 1 || aborted[0]["reason"] != "retry_budget_exhausted" {
+		t.Fatalf("PipelineAborted events = %v", aborted)
+	}
+	if n := len(eventsOfType(t, runDir, "StageRetrying")); n != 3 {
+		t.Fatalf("expected the third retry to exhaust the budget, got %d retries", n)
+	}
+	res := readStatusJSON(t, filepath.Join(runDir, runResultFile))
+	totals, _ := res["totals"].(map[string]any)
+	if res["status"] != "aborted" || totals["retries"] != float64(3) || totals["attempts"] != float64(4) {
+		t.Fatalf("run result = %v", res)
+	}
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil || cp.Totals == nil || cp.Totals.Retries != 3 {
+		t.Fatalf("checkpoint totals = %+v (%v)", cp.Totals, err)
+	}
+}
+
+func TestRunTotalsContinueAcrossResume(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box, max_retries=2, "test.outcome_sequence"="retry,success"]; b [shape=box]; exit [shape=Msquare]; start -> a -> b -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rb2"})
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rb2", Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "rb2")
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil || cp.Totals == nil {
+		t.Fatalf("checkpoint totals missing: %v", err)
+	}
+	got := cp.Totals
+	if got.Retries != 1 || got.Attempts != 5 || got.Visits["a"] != 1 || got.Visits["b"] != 1 || got.Visits["exit"] != 1 {
+		t.Fatalf("totals = %+v", got)
+	}
+	if cp.Context["internal.visits.a"] != float64(1) {
+		t.Fatalf("internal.visits.a = %v", cp.Context["internal.visits.a"])
+	}
+}
+
+func TestValidateRetryBudget(t *testing.T) {
+	g, err := ParseDOT(`digraph G { graph [retry_budget_total=lots]; start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, "invalid retry_budget_total") {
+		t.Fatalf("diagnostics = %v", msgs)
+	}
+}
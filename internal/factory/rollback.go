@@ -0,0 +1,192 @@
+package attractor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const defaultRollbackMaxBytes = 1 << 20
+
+// blobStoreDir is the run-level directory of preserved file contents.
+const blobStoreDir = ".blobs"
+
+// rollbackEnabled reports whether a node sets on_fail="rollback".
+func rollbackEnabled(node *Node) bool {
+	return strings.ToLower(strings.TrimSpace(node.StringAttr("on_fail", ""))) == "rollback"
+}
+
+func validateOnFail(n *Node) error {
+	raw, ok := n.Attrs["on_fail"]
+	if !ok {
+		return nil
+	}
+	if !rollbackEnabled(n) {
+		return fmt.Errorf("unsupported on_fail on node %s: %v", n.ID, raw)
+	}
+	return nil
+}
+
+// rollbackRetainLimit returns the largest file size preserved for rollback,
+// or -1 when the node does not roll back.
+func rollbackRetainLimit(node *Node) int64 {
+	if !rollbackEnabled(node) {
+		return -1
+	}
+	limit := node.IntAttr("rollback.max_bytes", defaultRollbackMaxBytes)
+	if limit < 0 {
+		return -1
+	}
+	return int64(limit)
+}
+
+// snapshotRetainLimit is the retention the pre-attempt snapshot needs for
+// both guardrail revert and rollback.
+func snapshotRetainLimit(node *Node) int64 {
+	return max(guardrailRetainLimit(node), rollbackRetainLimit(node))
+}
+
+// blobStore is a content-addressed store of file contents under
+// runDir/.blobs, keyed by the snapshot's sha256 hash.
+type blobStore struct {
+	dir string
+}
+
+func runBlobStore(runDir string) blobStore {
+	return blobStore{dir: filepath.Join(runDir, blobStoreDir)}
+}
+
+func (b blobStore) path(hash string) string {
+	return filepath.Join(b.dir, hash)
+}
+
+// putSnapshot stores the retained content of every regular file in snap.
+// Blobs already present are left alone.
+func (b blobStore) putSnapshot(snap map[string]fileState) error {
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return err
+	}
+	for _, st := range snap {
+		if !st.Retained || st.Symlink != "" {
+			continue
+		}
+		p := b.path(st.Hash)
+		if _, err := os.Stat(p); err == nil {
+			continue
+		}
+		tmp := p + ".tmp"
+		if err := os.WriteFile(tmp, st.Content, 0o644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workspaceRollback lists what a rollback reverted and the paths it could not.
+type workspaceRollback struct {
+	Removed   []string
+	Restored  []string
+	Recreated []string
+	Errors    map[string]string
+}
+
+// rollbackWorkspace returns the workspace to the pre-node snapshot: created
+// files are deleted, modified files get their content back, and deleted
+// files are recreated from the blob store. Paths matching excludes were never
+// in pre and are left alone.
+func rollbackWorkspace(workspace string, store blobStore, pre map[string]fileState, excludes []string) (workspaceRollback, error) {
+	r := workspaceRollback{Removed: []string{}, Restored: []string{}, Recreated: []string{}, Errors: map[string]string{}}
+	current, _, err := snapshotWorkspaceExcluding(workspace, -1, nil, excludes)
+	if err != nil {
+		return r, err
+	}
+	diff := computeDiff(pre, current)
+	for _, p := range diff.Created {
+		if err := os.Remove(filepath.Join(workspace, filepath.FromSlash(p))); err != nil && !errors.Is(err, os.ErrNotExist) {
+			r.Errors[p] = err.Error()
+			continue
+		}
+		r.Removed = append(r.Removed, p)
+	}
+	for _, p := range diff.Modified {
+		if err := restoreFromBlob(workspace, store, p, pre[p]); err != nil {
+			r.Errors[p] = err.Error()
+			continue
+		}
+		r.Restored = append(r.Restored, p)
+	}
+	for _, p := range diff.Deleted {
+		if err := restoreFromBlob(workspace, store, p, pre[p]); err != nil {
+			r.Errors[p] = err.Error()
+			continue
+		}
+		r.Recreated = append(r.Recreated, p)
+	}
+	return r, nil
+}
+
+func restoreFromBlob(workspace string, store blobStore, rel string, orig fileState) error {
+	target := filepath.Join(workspace, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if orig.Symlink != "" {
+		_ = os.Remove(target)
+		return os.Symlink(orig.Symlink, target)
+	}
+	if !orig.Retained {
+		return fmt.Errorf("original content not retained (exceeds rollback.max_bytes)")
+	}
+	content, err := os.ReadFile(store.path(orig.Hash))
+	if err != nil {
+		return fmt.Errorf("blob missing: %w", err)
+	}
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		_ = os.Remove(target)
+	}
+	mode := orig.Mode
+	if mode == 0 {
+		mode = 0o644
+	}
+	if err := os.WriteFile(target, content, mode); err != nil {
+		return err
+	}
+	return os.Chmod(target, mode)
+}
+
+// rollbackNode reverts the workspace to the pre-node snapshot and records a
+// WorkspaceRolledBack event. trigger is fail, retry, or error.
+func (e *Engine) rollbackNode(node *Node, pre map[string]fileState, attempt int, trigger string) error {
+	excludes, err := snapshotExcludes(e.Graph, node)
+	if err != nil {
+		return err
+	}
+	r, err := rollbackWorkspace(e.Workspace, runBlobStore(e.RunDir), pre, excludes)
+	if err != nil {
+		return err
+	}
+	ev := map[string]any{
+		"schema_version": 1,
+		"type":           "WorkspaceRolledBack",
+		"node_id":        node.ID,
+		"attempt":        attempt + 1,
+		"trigger":        trigger,
+		"removed":        r.Removed,
+		"restored":       r.Restored,
+		"recreated":      r.Recreated,
+		"at":             time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	if len(r.Errors) > 0 {
+		ev["errors"] = r.Errors
+		e.Logger.Warn("workspace rollback incomplete", "node", node.ID, "errors", len(r.Errors))
+	}
+	e.recordEvent(ev)
+	e.Logger.Info("workspace rolled back", "node", node.ID, "trigger", trigger, "removed", len(r.Removed), "restored", len(r.Restored), "recreated", len(r.Recreated))
+	return nil
+}
@@ -0,0 +1,91 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRollbackRestoresWorkspaceOnFailure(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, on_fail="rollback", tool_command="echo broken > keep.txt; rm gone.txt; echo new > src/new.txt; exit 1"];
+	after [shape=parallelogram, tool_command="cat keep.txt gone.txt > seen.txt; test ! -e src/new.txt"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> after [condition="outcome=fail"];
+	t -> exit [condition="outcome=success"];
+	after -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "keep.txt"), "original\n")
+	writeFile(t, filepath.Join(workdir, "gone.txt"), "still here\n")
+	if err := os.MkdirAll(filepath.Join(workdir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rb1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "rb1")
+	seen, err := os.ReadFile(filepath.Join(runDir, "workspace", "seen.txt"))
+	if err != nil || string(seen) != "original\nstill here\n" {
+		t.Fatalf("workspace after rollback = %q (%v)", seen, err)
+	}
+	evs := eventsOfType(t, runDir, "WorkspaceRolledBack")
+	if len(evs) != 1 || evs[0]["trigger"] != "fail" {
+		t.Fatalf("rollback events = %v", evs)
+	}
+	got := func(key string) string {
+		parts := []string{}
+		for _, p := range evs[0][key].([]any) {
+			parts = append(parts, p.(string))
+		}
+		return strings.Join(parts, ",")
+	}
+	if got("removed") != "src/new.txt" || got("restored") != "keep.txt" || got("recreated") != "gone.txt" {
+		t.Fatalf("rollback event = %v", evs[0])
+	}
+	if _, err := os.Stat(filepath.Join(runDir, ".blobs")); err != nil {
+		t.Fatalf("blob store missing: %v", err)
+	}
+}
+
+func TestRollbackBetweenRetries(t *testing.T) {
+	for _, between := range []bool{true, false} {
+		dot := `digraph G {
+		start [shape=Mdiamond];
+		t [shape=parallelogram, on_fail="rollback", max_retries=1, rollback_between_retries=` + map[bool]string{true: "true", false: "false"}[between] + `, "test.tool_outcome"="retry", "test.tool_touch_files"="scratch.txt"];
+		exit [shape=Msquare];
+		start -> t;
+		t -> exit;
+		}`
+		workdir, runsdir, pipeline := setupRun(t, dot)
+		_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rb2", FakeTools: true})
+		runDir := filepath.Join(runsdir, "rb2")
+		triggers := []string{}
+		for _, ev := range eventsOfType(t, runDir, "WorkspaceRolledBack") {
+			triggers = append(triggers, ev["trigger"].(string))
+		}
+		want := "retry,fail"
+		if !between {
+			want = "fail"
+		}
+		if strings.Join(triggers, ",") != want {
+			t.Fatalf("between=%v: triggers = %v, want %s", between, triggers, want)
+		}
+		if _, err := os.Stat(filepath.Join(runDir, "workspace", "scratch.txt")); !os.IsNotExist(err) {
+			t.Fatalf("between=%v: scratch.txt survived rollback (%v)", between, err)
+		}
+	}
+}
+
+func TestValidateOnFail(t *testing.T) {
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=box, on_fail="undo"]; exit [shape=Msquare]; start -> a -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, "unsupported on_fail on node a: undo") {
+		t.Fatalf("diagnostics:\n%s", msgs)
+	}
+}
@@ -0,0 +1,130 @@
+package attractor
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// routeCoverageOutcomes are the outcomes coverage is reported for, in
+// report order. They are the outcomes edge conditions can name.
+var routeCoverageOutcomes = []string{"success", "partial_success", "fail", "retry"}
+
+// NodeRouteCoverage is which outcomes of a node have an outgoing edge that
+// can take them. An outcome is covered when an edge matches it whatever the
+// visit counts, conditional when only edges with visits() clauses match it,
+// and uncovered when no edge does, so the run would stop with "no route".
+type NodeRouteCoverage struct {
+	Node        string   `json:"node"`
+	Handler     string   `json:"handler"`
+	Covered     []string `json:"covered"`
+	Conditional []string `json:"conditional"`
+	Uncovered   []string `json:"uncovered"`
+	// Fallback is an unconditional edge, which covers every outcome no
+	// conditional edge matches.
+	Fallback bool `json:"fallback"`
+	// Executable is false for start, exit, and disabled nodes, whose
+	// outcome is fixed or never routed.
+	Executable bool `json:"executable"`
+}
+
+// RouteCoverage analyzes every non-exit node's outgoing edges with the
+// condition parser routing uses, in node ID order. Conditions that do not
+// parse are skipped; ValidateGraph reports them.
+func RouteCoverage(g *Graph) []NodeRouteCoverage {
+	report := []NodeRouteCoverage{}
+	for _, id := range sortedKeys(g.Nodes) {
+		n := g.Nodes[id]
+		if isExit(g, id) {
+			continue
+		}
+		c := NodeRouteCoverage{Node: id, Handler: handlerType(n), Covered: []string{}, Conditional: []string{}, Uncovered: []string{}}
+		c.Executable = !isStartNode(n) && !n.BoolAttr("disabled", false)
+		definite, maybe := map[string]bool{}, map[string]bool{}
+		for _, e := range g.Edges {
+			if e.From != id {
+				continue
+			}
+			raw := strings.TrimSpace(e.StringAttr("condition", ""))
+			if raw == "" {
+				c.Fallback = true
+				continue
+			}
+			cond, err := parseCondition(raw)
+			if err != nil {
+				continue
+			}
+			for _, o := range routeCoverageOutcomes {
+				if cond.Outcome != "" && cond.Outcome != o {
+					continue
+				}
+				if len(cond.Visits) == 0 {
+					definite[o] = true
+				} else {
+					maybe[o] = true
+				}
+			}
+		}
+		for _, o := range routeCoverageOutcomes {
+			switch {
+			case definite[o] || c.Fallback:
+				c.Covered = append(c.Covered, o)
+			case maybe[o]:
+				c.Conditional = append(c.Conditional, o)
+			default:
+				c.Uncovered = append(c.Uncovered, o)
+			}
+		}
+		report = append(report, c)
+	}
+	return report
+}
+
+// lintRouteCoverage warns about executable nodes whose fail outcome no edge
+// can take. A fail routed only by visits() conditions is not reported,
+// because complementary conditions often cover it.
+func lintRouteCoverage(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	for _, c := range RouteCoverage(g) {
+		if !c.Executable {
+			continue
+		}
+		for _, o := range c.Uncovered {
+			if o == "fail" {
+				d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s: no edge takes outcome=fail, so a failure stops the run with no route", c.Node)})
+			}
+		}
+	}
+	return d
+}
+
+// RouteCoverageDiagnostics is the route_coverage rule's output, for callers
+// that report coverage whether or not the graph enables the rule.
+func RouteCoverageDiagnostics(g *Graph) []Diagnostic {
+	d := lintRouteCoverage(g)
+	for i := range d {
+		d[i].Rule = "route_coverage"
+	}
+	return d
+}
+
+// WriteRouteCoverageTable writes the report with one row per node.
+func WriteRouteCoverageTable(w io.Writer, report []NodeRouteCoverage) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tHANDLER\tCOVERED\tCONDITIONAL\tUNCOVERED\tFALLBACK")
+	list := func(outcomes []string) string {
+		if len(outcomes) == 0 {
+			return "-"
+		}
+		return strings.Join(outcomes, ",")
+	}
+	for _, c := range report {
+		fallback := "no"
+		if c.Fallback {
+			fallback = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Node, c.Handler, list(c.Covered), list(c.Conditional), list(c.Uncovered), fallback)
+	}
+	return tw.Flush()
+}
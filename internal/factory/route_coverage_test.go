@@ -0,0 +1,76 @@
+package attractor
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const routeCoverageDOT = `digraph G {
+	start [shape=Mdiamond];
+	build [shape=parallelogram, tool_command="make"];
+	test [shape=parallelogram, tool_command="make test"];
+	fix [shape=box];
+	publish [shape=parallelogram, tool_command="make publish"];
+	skipped [shape=parallelogram, tool_command="true", disabled=true];
+	exit [shape=Msquare];
+	start -> build;
+	build -> test [condition="outcome=success"];
+	build -> fix [condition="outcome=fail && visits(fix) < 3"];
+	test -> publish [condition="outcome=success"];
+	test -> fix [condition="outcome=fail"];
+	fix -> build;
+	publish -> skipped [condition="outcome=success"];
+	skipped -> exit [condition="outcome=success"];
+	}`
+
+func TestRouteCoverage(t *testing.T) {
+	g, err := ParseDOT(routeCoverageDOT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, c := range RouteCoverage(g) {
+		got[c.Node] = fmt.Sprintf("%v %v %v %t %t", c.Covered, c.Conditional, c.Uncovered, c.Fallback, c.Executable)
+	}
+	want := map[string]string{
+		"start":   "[success partial_success fail retry] [] [] true false",
+		"build":   "[success] [fail] [partial_success retry] false true",
+		"test":    "[success fail] [] [partial_success retry] false true",
+		"fix":     "[success partial_success fail retry] [] [] true true",
+		"publish": "[success] [] [partial_success fail retry] false true",
+		"skipped": "[success] [] [partial_success fail retry] false false",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("coverage = %v", got)
+	}
+	for id, w := range want {
+		if got[id] != w {
+			t.Errorf("%s = %s, want %s", id, got[id], w)
+		}
+	}
+
+	diags := RouteCoverageDiagnostics(g)
+	if len(diags) != 1 || diags[0].Level != "WARN" || diags[0].Rule != "route_coverage" || !strings.HasPrefix(diags[0].Message, "node publish: no edge takes outcome=fail") {
+		t.Fatalf("diagnostics = %+v", diags)
+	}
+
+	var b bytes.Buffer
+	if err := WriteRouteCoverageTable(&b, RouteCoverage(g)); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 7 || strings.Join(strings.Fields(lines[1]), " ") != "build tool success fail partial_success,retry no" {
+		t.Fatalf("table:\n%s", b.String())
+	}
+}
+
+func TestRouteCoverageLintRule(t *testing.T) {
+	g, err := ParseDOT(strings.Replace(routeCoverageDOT, "digraph G {", `digraph G { graph [lint_enable="route_coverage"];`, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := diagnosticMessages(ValidateGraph(g)); !strings.Contains(got, "node publish: no edge takes outcome=fail") {
+		t.Fatalf("diagnostics:\n%s", got)
+	}
+}
@@ -0,0 +1,158 @@
+package attractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RouteCandidate is one outgoing edge considered by a routing decision.
+type RouteCandidate struct {
+	ID        string `json:"id"`
+	To        string `json:"to"`
+	Condition string `json:"condition"`
+	Weight    int    `json:"weight"`
+	Matched   bool   `json:"matched"`
+	// Visits are the visit counts the condition's visits() calls read.
+	Visits map[string]int `json:"visits,omitempty"`
+	edge   *Edge
+}
+
+// RouteDecision is the explainable result of selecting the next node.
+type RouteDecision struct {
+	From     string           `json:"from"`
+	Outcome  string           `json:"outcome"`
+	Edges    []RouteCandidate `json:"edges"`
+	Tier     string           `json:"tier"`
+	Ordered  []RouteCandidate `json:"ordered"`
+	Selected string           `json:"selected"`
+	Steps    []string         `json:"steps"`
+	// Visits are the visit counts read by any candidate's condition.
+	Visits map[string]int `json:"visits"`
+	// SelectedEdge is the traversed edge, carrying edge-level effects.
+	SelectedEdge *Edge `json:"-"`
+}
+
+// decideRoute applies the engine routing precedence: conditional edges whose
+// condition matches the outcome and visit counts, otherwise unconditional
+// edges, ordered by highest weight and then target ID. It is the single
+// source of routing truth for both the engine and `factory explain route`.
+func decideRoute(g *Graph, from, outcome string, visits map[string]int) RouteDecision {
+	d := RouteDecision{From: from, Outcome: outcome, Edges: []RouteCandidate{}, Ordered: []RouteCandidate{}, Tier: "none", Visits: map[string]int{}}
+	var conditionals []RouteCandidate
+	var unconditionals []RouteCandidate
+	for _, edge := range g.Edges {
+		if edge.From != from {
+			continue
+		}
+		c := RouteCandidate{ID: edge.ID, To: edge.To, Condition: strings.TrimSpace(edge.StringAttr("condition", "")), Weight: edge.IntAttr("weight", 0), edge: edge}
+		if c.Condition == "" {
+			c.Matched = true
+			unconditionals = append(unconditionals, c)
+		} else {
+			var read map[string]int
+			c.Matched, read = conditionMatches(c.Condition, outcome, visits)
+			if len(read) > 0 {
+				c.Visits = read
+				for id, n := range read {
+					d.Visits[id] = n
+				}
+			}
+			if c.Matched {
+				conditionals = append(conditionals, c)
+			}
+		}
+		d.Edges = append(d.Edges, c)
+	}
+	d.Steps = append(d.Steps, fmt.Sprintf("node %s finished with outcome=%s; %d outgoing edge(s)", from, outcome, len(d.Edges)))
+	for _, c := range d.Edges {
+		cond := c.Condition
+		if cond == "" {
+			cond = "(unconditional)"
+		}
+		verdict := "no match"
+		if c.Matched {
+			verdict = "match"
+		}
+		if len(c.Visits) > 0 {
+			verdict += " (" + formatVisits(c.Visits) + ")"
+		}
+		d.Steps = append(d.Steps, fmt.Sprintf("edge %s -> %s condition=%s weight=%d: %s", from, c.To, cond, c.Weight, verdict))
+	}
+	pick := conditionals
+	d.Tier = "conditional"
+	if len(pick) == 0 {
+		pick = unconditionals
+		d.Tier = "unconditional"
+		if len(unconditionals) > 0 {
+			d.Steps = append(d.Steps, "no conditional edge matched; falling back to unconditional edges")
+		}
+	} else {
+		d.Steps = append(d.Steps, fmt.Sprintf("%d conditional edge(s) matched; unconditional edges ignored", len(conditionals)))
+	}
+	if len(pick) == 0 {
+		d.Tier = "none"
+		d.Steps = append(d.Steps, "no eligible edges; no route selected")
+		return d
+	}
+	sort.SliceStable(pick, func(i, j int) bool {
+		if pick[i].Weight != pick[j].Weight {
+			return pick[i].Weight > pick[j].Weight
+		}
+		return pick[i].To < pick[j].To
+	})
+	d.Ordered = pick
+	if len(pick) > 1 {
+		order := make([]string, 0, len(pick))
+		for _, c := range pick {
+			order = append(order, fmt.Sprintf("%s(weight=%d)", c.To, c.Weight))
+		}
+		d.Steps = append(d.Steps, "ordered by highest weight, then target id: "+strings.Join(order, ", "))
+	}
+	d.Selected = pick[0].To
+	d.SelectedEdge = pick[0].edge
+	d.Steps = append(d.Steps, fmt.Sprintf("selected %s via edge %s", d.Selected, d.SelectedEdge.ref()))
+	if prefixes := edgeResetPrefixes(d.SelectedEdge); len(prefixes) > 0 {
+		d.Steps = append(d.Steps, "traversing edge resets context keys with prefixes: "+strings.Join(prefixes, ","))
+	}
+	if keys := edgeIncrementKeys(d.SelectedEdge); len(keys) > 0 {
+		d.Steps = append(d.Steps, "traversing edge increments context counters: "+strings.Join(keys, ","))
+	}
+	return d
+}
+
+func edgeResetPrefixes(edge *Edge) []string {
+	return uniqueNonEmpty(splitCSV(edge.StringAttr("reset_context_prefixes", "")))
+}
+
+func edgeIncrementKeys(edge *Edge) []string {
+	return uniqueNonEmpty(splitCSV(edge.StringAttr("increment_context", "")))
+}
+
+// applyEdgeEffects deletes context keys matching the edge's
+// reset_context_prefixes and bumps its increment_context counters. It runs
+// when the edge is traversed, before the target node executes.
+func (e *Engine) applyEdgeEffects(edge *Edge) ([]string, map[string]int) {
+	removed := []string{}
+	if edge == nil {
+		return removed, map[string]int{}
+	}
+	prefixes := edgeResetPrefixes(edge)
+	for k := range e.Context {
+		for _, p := range prefixes {
+			if strings.HasPrefix(k, p) {
+				removed = append(removed, k)
+				delete(e.Context, k)
+				break
+			}
+		}
+	}
+	sort.Strings(removed)
+	incremented := map[string]int{}
+	for _, key := range edgeIncrementKeys(edge) {
+		n := e.Context.GetInt(key, 0) + 1
+		e.Context[key] = n
+		incremented[key] = n
+	}
+	return removed, incremented
+}
@@ -0,0 +1,208 @@
+package attractor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackEdgeResetsContextAndIncrementsCounter(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	plan [shape=box, "test.context_updates_json"="{\"plan.notes\":\"old\",\"verification.plan\":{\"files\":[],\"commands\":[\"true\"]},\"keep\":\"y\"}"];
+	check [shape=parallelogram, tool_command="test -f marker || (touch marker; exit 1)"];
+	exit [shape=Msquare];
+	start -> plan;
+	plan -> check;
+	check -> plan [condition="outcome=fail", reset_context_prefixes="verification.,plan.", increment_context="replan_count"];
+	check -> exit [condition="outcome=success"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "rc1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "rc1")
+	var route map[string]any
+	planInputs := []map[string]any{}
+	for _, rec := range readJSONLRecords(t, filepath.Join(runDir, "trace.jsonl")) {
+		if rec["type"] == "RouteEvaluated" && rec["from_node"] == "check" && rec["next_node"] == "plan" {
+			route = rec
+		}
+		if rec["type"] == "NodeInputCaptured" && rec["node_id"] == "plan" {
+			planInputs = append(planInputs, rec)
+		}
+	}
+	if route == nil {
+		t.Fatal("expected back-edge route record")
+	}
+	removed := []string{}
+	for _, k := range route["reset_context_keys"].([]any) {
+		removed = append(removed, k.(string))
+	}
+	if strings.Join(removed, ",") != "plan.notes,verification.plan" {
+		t.Fatalf("unexpected removed keys: %v", removed)
+	}
+	if len(planInputs) != 2 {
+		t.Fatalf("expected plan to run twice, got %d", len(planInputs))
+	}
+	ctx := planInputs[1]["context_before"].(map[string]any)
+	if _, ok := ctx["verification.plan"]; ok {
+		t.Fatal("verification.plan should be reset before plan re-runs")
+	}
+	if ctx["keep"] != "y" {
+		t.Fatal("keys outside reset prefixes must be preserved")
+	}
+	if ctx["replan_count"] != float64(1) {
+		t.Fatalf("expected replan_count=1, got %v", ctx["replan_count"])
+	}
+}
+
+func TestExplainMentionsEdgeEffects(t *testing.T) {
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a; a -> start [condition="outcome=fail", reset_context_prefixes="plan.", increment_context="replan_count"]; a -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := strings.Join(decideRoute(g, "a", "fail", nil).Steps, "\n")
+	if !strings.Contains(steps, "resets context keys with prefixes: plan.") || !strings.Contains(steps, "increments context counters: replan_count") {
+		t.Fatalf("missing edge effects in steps:\n%s", steps)
+	}
+}
+
+func TestEdgeIDsInDiagnosticsAndRouteTrace(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare];
+	start -> a;
+	a -> exit [id="done"];
+	a -> exit [id="done", condition="outcome=maybe"];
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{"duplicate edge id done (a -> exit and a -> exit)", "edge done has unsupported condition: outcome=maybe"} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare];
+	start -> a;
+	a -> exit [id="a_to_exit_on_success", condition="outcome=success"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "eid1"}); err != nil {
+		t.Fatal(err)
+	}
+	var route map[string]any
+	for _, rec := range readJSONLRecords(t, filepath.Join(runsdir, "eid1", "trace.jsonl")) {
+		if rec["type"] == "RouteEvaluated" && rec["from_node"] == "a" {
+			route = rec
+		}
+	}
+	if route == nil || route["edge_id"] != "a_to_exit_on_success" {
+		t.Fatalf("route = %v", route)
+	}
+	cands := route["candidates"].([]any)
+	if len(cands) != 1 || cands[0].(map[string]any)["edge_id"] != "a_to_exit_on_success" {
+		t.Fatalf("candidates = %v", cands)
+	}
+	d := decideRoute(g, "start", "success", nil)
+	if d.Edges[0].ID != "start-a-0" || !strings.Contains(strings.Join(d.Steps, "\n"), "selected a via edge start-a-0") {
+		t.Fatalf("decision = %+v", d)
+	}
+}
+
+func TestVisitsConditionEscalatesAfterRepeatedFailures(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	fix [shape=parallelogram, tool_command="exit 1"];
+	escalate [shape=parallelogram, tool_command="true"];
+	exit [shape=Msquare];
+	start -> fix;
+	fix -> fix [condition="outcome=fail && visits(fix) < 3"];
+	fix -> escalate [condition="outcome=fail && visits(fix) >= 3"];
+	fix -> exit [condition="outcome=success"];
+	escalate -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "vis1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "vis1")
+	nexts := []string{}
+	var last map[string]any
+	for _, rec := range readJSONLRecords(t, filepath.Join(runDir, "trace.jsonl")) {
+		if rec["type"] == "RouteEvaluated" && rec["from_node"] == "fix" {
+			nexts = append(nexts, rec["next_node"].(string))
+			last = rec
+		}
+	}
+	if strings.Join(nexts, ",") != "fix,fix,escalate" {
+		t.Fatalf("routes from fix = %v", nexts)
+	}
+	if v := last["visits"].(map[string]any); v["fix"] != float64(3) {
+		t.Fatalf("recorded visits = %v", last["visits"])
+	}
+	out, err := ExplainRoute(runDir, "fix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "match (visits(fix)=3)") || strings.Contains(out, "WARNING") {
+		t.Fatalf("explanation:\n%s", out)
+	}
+}
+
+func TestValidateVisitsConditions(t *testing.T) {
+	cases := map[string]string{
+		`outcome=fail && retries(a) > 1`:    "unknown function retries",
+		`outcome=fail && visits(ghost) > 1`: "condition references unknown node: ghost",
+		`outcome=fail && visits(a) ~ 1`:     `unsupported clause "visits(a) ~ 1"`,
+		`outcome=done`:                      `unknown outcome "done"`,
+		`outcome=fail &&`:                   "empty clause",
+	}
+	for cond, want := range cases {
+		g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a; a -> exit [condition="` + cond + `"]; a -> exit; }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, want) {
+			t.Fatalf("%s: diagnostics %q missing %q", cond, msgs, want)
+		}
+	}
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a; a -> a [condition="outcome=fail && visits(a) <= 2"]; a -> exit [condition="visits( a ) >= 3"]; a -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if HasErrors(ValidateGraph(g)) {
+		t.Fatalf("diagnostics = %s", diagnosticMessages(ValidateGraph(g)))
+	}
+}
+
+func TestVisitsConditionAcceptsQuotedNodeIDs(t *testing.T) {
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; "fix loop" [shape=box]; "a&&b" [shape=box]; exit [shape=Msquare]; start -> "fix loop" -> "a&&b" -> exit; "fix loop" -> exit [condition="outcome=fail && visits(\"fix loop\") >= 2 && visits(\"a&&b\") = 0"]; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if HasErrors(ValidateGraph(g)) {
+		t.Fatalf("diagnostics = %s", diagnosticMessages(ValidateGraph(g)))
+	}
+	c, err := parseCondition(`outcome=fail && visits("fix loop") >= 2 && visits("a&&b") = 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Visits) != 2 || c.Visits[0].Node != "fix loop" || c.Visits[1].Node != "a&&b" {
+		t.Fatalf("condition = %+v", c)
+	}
+	if ok, _ := c.matches("fail", map[string]int{"fix loop": 2}); !ok {
+		t.Fatal("condition did not match")
+	}
+	if got := normalizeCondition(`visits( "fix loop" )>=2&&outcome=fail`); got != `outcome=fail && visits("fix loop") >= 2` {
+		t.Fatalf("normalized = %s", got)
+	}
+	if _, err := parseCondition(`visits("") > 1`); err == nil {
+		t.Fatal("expected an empty quoted id to be rejected")
+	}
+}
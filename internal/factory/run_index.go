@@ -0,0 +1,283 @@
+package attractor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// runIndexFile is <runsdir>/index.jsonl, the append-only run index.
+	runIndexFile = "index.jsonl"
+	// runIndexGoalMaxBytes keeps index lines short.
+	runIndexGoalMaxBytes = 200
+)
+
+// runIndexRecord is one line of the run index. RunPipeline appends a
+// started record when a run (or a resume) starts and a finished record when
+// it ends; ListRuns appends scanned records for runs missing from the index.
+// Later lines for a run override the fields they set.
+type runIndexRecord struct {
+	RunID      string `json:"run_id"`
+	Event      string `json:"event"`
+	At         string `json:"at"`
+	Status     string `json:"status,omitempty"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	FinalNode  string `json:"final_node,omitempty"`
+	Goal       string `json:"goal,omitempty"`
+	RetryOf    string `json:"retry_of,omitempty"`
+}
+
+// appendRunIndex writes rec as one line with a single O_APPEND write, so
+// parallel runs sharing a runs dir do not interleave lines. A torn last line
+// left by a crash is terminated first so rec starts on its own line.
+func appendRunIndex(runsdir string, rec runIndexRecord) error {
+	if rec.At == "" {
+		rec.At = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(runsdir, runIndexFile), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	line := append(b, '\n')
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	_, err = f.Write(line)
+	return err
+}
+
+// indexGoal renders a graph goal for the index, cut to runIndexGoalMaxBytes.
+func indexGoal(goal any) string {
+	if goal == nil {
+		return ""
+	}
+	s := strings.Join(strings.Fields(fmt.Sprintf("%v", goal)), " ")
+	if len(s) > runIndexGoalMaxBytes {
+		s = strings.ToValidUTF8(s[:runIndexGoalMaxBytes], "") + "..."
+	}
+	return s
+}
+
+// RunListing is one run in `factory list`.
+type RunListing struct {
+	RunID      string `json:"run_id"`
+	Status     string `json:"status"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	// DurationSeconds runs from the first start to the end, so it includes
+	// the time a stopped run waited to be resumed. It is 0 while running.
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	FinalNode       string  `json:"final_node,omitempty"`
+	Goal            string  `json:"goal,omitempty"`
+	RetryOf         string  `json:"retry_of,omitempty"`
+	// Depth is the number of retries between this run and the first run of
+	// its chain.
+	Depth int `json:"depth"`
+}
+
+// ListRunsOptions filters ListRuns. Zero values match every run.
+type ListRunsOptions struct {
+	Status string
+	// Since keeps runs that started at or after it.
+	Since time.Time
+}
+
+// ListRuns lists the runs in runsdir with retry chains kept together: each
+// first run, oldest first, followed by the runs that retried it. It reads
+// index.jsonl and only opens the run dirs the index does not cover, adding
+// them to the index, and the runs the index still shows as running, whose
+// run.state says whether they crashed.
+func ListRuns(runsdir string, opts ListRunsOptions) ([]RunListing, error) {
+	entries, err := os.ReadDir(runsdir)
+	if err != nil {
+		return nil, err
+	}
+	indexed, err := readRunIndex(runsdir)
+	if err != nil {
+		return nil, err
+	}
+	runs := map[string]RunListing{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		id, runDir := e.Name(), filepath.Join(runsdir, e.Name())
+		r, ok := indexed[id]
+		switch {
+		case !ok:
+			rec, found := scanRunIndexRecord(runDir)
+			if !found {
+				continue
+			}
+			if err := appendRunIndex(runsdir, rec); err != nil {
+				return nil, err
+			}
+			r = foldRunIndex(RunListing{RunID: id}, rec)
+		case r.FinishedAt == "":
+			r.Status = listedRunStatus(runDir)
+		}
+		r.DurationSeconds = runDurationSeconds(r.StartedAt, r.FinishedAt)
+		runs[id] = r
+	}
+	for id, r := range runs {
+		if (opts.Status != "" && r.Status != opts.Status) || (!opts.Since.IsZero() && startedBefore(r.StartedAt, opts.Since)) {
+			delete(runs, id)
+		}
+	}
+	return groupRetryChains(runs), nil
+}
+
+// readRunIndex folds index.jsonl into one listing per run. Lines that do not
+// parse, such as a tail cut short by a crash, are skipped.
+func readRunIndex(runsdir string) (map[string]RunListing, error) {
+	out := map[string]RunListing{}
+	f, err := os.Open(filepath.Join(runsdir, runIndexFile))
+	if os.IsNotExist(err) {
+		return out, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var rec runIndexRecord
+		if json.Unmarshal(sc.Bytes(), &rec) != nil || rec.RunID == "" {
+			continue
+		}
+		r, ok := out[rec.RunID]
+		if !ok {
+			r = RunListing{RunID: rec.RunID}
+		}
+		out[rec.RunID] = foldRunIndex(r, rec)
+	}
+	return out, sc.Err()
+}
+
+// foldRunIndex applies rec to r. The first start time is kept; a new start
+// (a resume) clears the previous end.
+func foldRunIndex(r RunListing, rec runIndexRecord) RunListing {
+	if rec.Status != "" {
+		r.Status = rec.Status
+	}
+	if r.StartedAt == "" {
+		r.StartedAt = rec.StartedAt
+	}
+	if rec.Event == "started" {
+		r.FinishedAt = ""
+	}
+	if rec.FinishedAt != "" {
+		r.FinishedAt = rec.FinishedAt
+	}
+	if rec.FinalNode != "" {
+		r.FinalNode = rec.FinalNode
+	}
+	if rec.Goal != "" {
+		r.Goal = rec.Goal
+	}
+	if rec.RetryOf != "" {
+		r.RetryOf = rec.RetryOf
+	}
+	return r
+}
+
+// scanRunIndexRecord builds an index record from a run dir's manifest,
+// run.result.json, run.state, and checkpoint. found is false for
+// directories that are not runs.
+func scanRunIndexRecord(runDir string) (runIndexRecord, bool) {
+	m, err := readRerunManifest(runDir)
+	if err != nil {
+		return runIndexRecord{}, false
+	}
+	rec := runIndexRecord{RunID: filepath.Base(runDir), Event: "scanned", Status: listedRunStatus(runDir), StartedAt: m.StartedAt, Goal: indexGoal(m.Goal), RetryOf: m.RetryOf}
+	var res RunResult
+	if b, err := os.ReadFile(filepath.Join(runDir, runResultFile)); err == nil && json.Unmarshal(b, &res) == nil {
+		rec.FinishedAt = res.FinishedAt
+	}
+	if cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json")); err == nil {
+		rec.FinalNode = cp.LastCompletedNode
+	}
+	return rec, true
+}
+
+// listedRunStatus is run.result.json's status, else run.state's state.
+func listedRunStatus(runDir string) string {
+	var res RunResult
+	if b, err := os.ReadFile(filepath.Join(runDir, runResultFile)); err == nil && json.Unmarshal(b, &res) == nil && res.Status != "" {
+		return res.Status
+	}
+	if st, err := readRunState(runDir); err == nil {
+		return st.State
+	}
+	return "unknown"
+}
+
+func runDurationSeconds(started, finished string) float64 {
+	s, err1 := time.Parse(time.RFC3339Nano, started)
+	f, err2 := time.Parse(time.RFC3339Nano, finished)
+	if err1 != nil || err2 != nil || f.Before(s) {
+		return 0
+	}
+	return f.Sub(s).Seconds()
+}
+
+func startedBefore(started string, since time.Time) bool {
+	t, err := time.Parse(time.RFC3339Nano, started)
+	return err != nil || t.Before(since)
+}
+
+// groupRetryChains orders runs oldest first with each run's retries right
+// after it, indented by Depth.
+func groupRetryChains(runs map[string]RunListing) []RunListing {
+	children := map[string][]string{}
+	roots := []string{}
+	for id, r := range runs {
+		if _, ok := runs[r.RetryOf]; ok && r.RetryOf != id {
+			children[r.RetryOf] = append(children[r.RetryOf], id)
+		} else {
+			roots = append(roots, id)
+		}
+	}
+	byStart := func(ids []string) {
+		sort.Slice(ids, func(i, j int) bool {
+			a, b := runs[ids[i]], runs[ids[j]]
+			if a.StartedAt != b.StartedAt {
+				return a.StartedAt < b.StartedAt
+			}
+			return a.RunID < b.RunID
+		})
+	}
+	byStart(roots)
+	out := make([]RunListing, 0, len(runs))
+	var walk func(id string, depth int)
+	walk = func(id string, depth int) {
+		r := runs[id]
+		r.Depth = depth
+		out = append(out, r)
+		kids := children[id]
+		byStart(kids)
+		for _, k := range kids {
+			walk(k, depth+1)
+		}
+	}
+	for _, id := range roots {
+		walk(id, 0)
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunIndexListsAndRepairs(t *testing.T) {
+	dot := `digraph G { graph [goal="ship the feature"]; start [shape=Mdiamond]; a [shape=parallelogram, tool_command="test -f ok"]; exit [shape=Msquare]; start -> a; a -> exit [condition="outcome=success"]; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"})
+	writeFile(t, filepath.Join(workdir, "ok"), "")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(runsdir, runIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "\n"); n != 4 {
+		t.Fatalf("index has %d lines, want 4:\n%s", n, b)
+	}
+	runs, err := ListRuns(runsdir, ListRunsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].RunID != "r1" || runs[0].Status != "failed" || runs[1].Status != "completed" || runs[1].FinalNode != "exit" || runs[1].Goal != "ship the feature" || runs[1].FinishedAt == "" {
+		t.Fatalf("listing = %+v", runs)
+	}
+
+	// A torn tail line is skipped, and r1's missing entry is rebuilt from its
+	// run dir and written back to the index.
+	if err := os.WriteFile(filepath.Join(runsdir, runIndexFile), []byte(strings.SplitAfter(string(b), "\n")[2]+`{"run_id":"r2","ev`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runs, err = ListRuns(runsdir, ListRunsOptions{Status: "failed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].RunID != "r1" || runs[0].FinishedAt == "" {
+		t.Fatalf("failed listing = %+v", runs)
+	}
+	if b, _ := os.ReadFile(filepath.Join(runsdir, runIndexFile)); !strings.Contains(string(b), `"event":"scanned"`) {
+		t.Fatalf("index not repaired:\n%s", b)
+	}
+	if runs, _ := ListRuns(runsdir, ListRunsOptions{Since: time.Now().Add(time.Hour)}); len(runs) != 0 {
+		t.Fatalf("since listing = %+v", runs)
+	}
+}
+
+func TestIndexGoalTruncates(t *testing.T) {
+	got := indexGoal(strings.Repeat("ab\n", 100))
+	if len(got) != runIndexGoalMaxBytes+len("...") || strings.Contains(got, "\n") {
+		t.Fatalf("indexGoal = %q", got)
+	}
+}
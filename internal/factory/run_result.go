@@ -0,0 +1,64 @@
+package attractor
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const runResultFile = "run.result.json"
+
+// RunResult is the final state of a run, written to run.result.json when
+// RunPipeline finishes executing stages. Status is completed, failed,
+// failed_at_exit (an exit node's require_context criteria did not hold),
+// stopped, or aborted (low disk space between stages, retry_budget_total
+// exceeded, or a guardrail violation with FailFastOnGuardrail).
+type RunResult struct {
+	RunID         string   `json:"run_id"`
+	Status        string   `json:"status"`
+	ExitNode      string   `json:"exit_node,omitempty"`
+	UnmetCriteria []string `json:"unmet_criteria,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	FinishedAt    string   `json:"finished_at"`
+	// Disk is the run's actual usage and the free space left at the end.
+	Disk *RunDiskUsage `json:"disk,omitempty"`
+	// Totals counts attempts, retries, and node visits across every
+	// invocation of the run.
+	Totals *RunTotals `json:"totals,omitempty"`
+	// Changelog is CHANGELOG.run.md: every stage's notes, in order.
+	Changelog string `json:"changelog,omitempty"`
+}
+
+func (e *Engine) writeRunResult(runErr error) {
+	res := RunResult{RunID: e.RunID, Status: "completed", FinishedAt: time.Now().UTC().Format(time.RFC3339Nano)}
+	switch {
+	case runErr == nil:
+	case errors.Is(runErr, ErrRunStopped):
+		res.Status = "stopped"
+	case errors.Is(runErr, ErrInsufficientDiskSpace), errors.Is(runErr, ErrRetryBudgetExhausted), errors.Is(runErr, ErrGuardrailViolation):
+		res.Status = "aborted"
+	case errors.Is(runErr, ErrExitCriteriaNotMet):
+		res.Status = "failed_at_exit"
+		res.ExitNode = e.Context.GetString("last_failure.node_id", "")
+		detail := strings.TrimPrefix(e.Context.GetString("last_failure.reason", ""), ErrExitCriteriaNotMet.Error()+": ")
+		res.UnmetCriteria = strings.Split(detail, "; ")
+	default:
+		res.Status = "failed"
+	}
+	if runErr != nil {
+		res.Error = runErr.Error()
+	}
+	res.Disk = e.finalDiskUsage()
+	res.Totals = &e.totals
+	res.Changelog = readRunChangelog(e.RunDir)
+	if err := writeJSON(filepath.Join(e.RunDir, runResultFile), res); err != nil {
+		e.Logger.Warn("failed to write run result", "error", err)
+	}
+	_ = e.runState.set(runStateFor(res.Status), "")
+	endRec := runIndexRecord{RunID: e.RunID, Event: "finished", Status: res.Status, FinishedAt: res.FinishedAt, FinalNode: e.lastCompleted}
+	if err := appendRunIndex(filepath.Dir(e.RunDir), endRec); err != nil {
+		e.Logger.Warn("failed to append run index", "error", err)
+	}
+	e.writeRunReports(res)
+}
@@ -0,0 +1,225 @@
+package attractor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	runStateFile = "run.state"
+	runLockFile  = "run.lock"
+	// runStateHeartbeat is how often a live run refreshes heartbeat_at.
+	runStateHeartbeat = 10 * time.Second
+	// staleRunAfter is how old a heartbeat may get before the run's lock is
+	// considered abandoned.
+	staleRunAfter = 6 * runStateHeartbeat
+)
+
+// Run states written to run.state. A running run records
+// "running:<node>" while a stage executes.
+const (
+	RunStateInitializing = "initializing"
+	RunStateRunning      = "running"
+	RunStateCompleted    = "completed"
+	RunStateFailed       = "failed"
+	RunStateCancelled    = "cancelled"
+)
+
+// ErrRunLocked is returned when another live process holds the run's lock.
+var ErrRunLocked = errors.New("run is locked by a live process")
+
+// ErrRunCompleted is returned when resuming a run whose state is completed.
+var ErrRunCompleted = errors.New("run already completed")
+
+// RunState is run.state: the run's current state and the heartbeat of the
+// process executing it.
+type RunState struct {
+	State       string `json:"state"`
+	Node        string `json:"node,omitempty"`
+	PID         int    `json:"pid"`
+	Host        string `json:"host"`
+	UpdatedAt   string `json:"updated_at"`
+	HeartbeatAt string `json:"heartbeat_at"`
+}
+
+// runLock is run.lock, held by the process executing the run.
+type runLock struct {
+	PID        int    `json:"pid"`
+	Host       string `json:"host"`
+	AcquiredAt string `json:"acquired_at"`
+}
+
+func readRunState(runDir string) (RunState, error) {
+	var st RunState
+	b, err := os.ReadFile(filepath.Join(runDir, runStateFile))
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, fmt.Errorf("invalid %s in %s: %w", runStateFile, runDir, err)
+	}
+	return st, nil
+}
+
+func readRunLock(runDir string) (runLock, error) {
+	var l runLock
+	b, err := os.ReadFile(filepath.Join(runDir, runLockFile))
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(b, &l); err != nil {
+		return l, fmt.Errorf("invalid %s in %s: %w", runLockFile, runDir, err)
+	}
+	return l, nil
+}
+
+// writeJSONAtomic writes v through a temp file and rename, so readers never
+// see a half-written file.
+func writeJSONAtomic(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// lockIsLive reports whether lock still belongs to a running process: its
+// heartbeat is fresh and, on this host, its pid is alive.
+func lockIsLive(l runLock, st RunState, now time.Time) bool {
+	beat, err := time.Parse(time.RFC3339Nano, st.HeartbeatAt)
+	if err != nil || st.PID != l.PID || now.Sub(beat) > staleRunAfter {
+		return false
+	}
+	if host, _ := os.Hostname(); l.Host == host && !pidAlive(l.PID) {
+		return false
+	}
+	return true
+}
+
+// runStateTracker keeps run.state current and holds run.lock for the
+// engine. Its methods are no-ops on a nil tracker.
+type runStateTracker struct {
+	runDir string
+	mu     sync.Mutex
+	st     RunState
+	final  bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// startRunState takes the run's lock and records the initializing state. A
+// lock left by a process that is no longer live is taken over.
+func startRunState(runDir string, interval time.Duration) (*runStateTracker, error) {
+	host, _ := os.Hostname()
+	lock := runLock{PID: os.Getpid(), Host: host, AcquiredAt: time.Now().UTC().Format(time.RFC3339Nano)}
+	lockPath := filepath.Join(runDir, runLockFile)
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			err = json.NewEncoder(f).Encode(lock)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		if !os.IsExist(err) || attempt > 0 {
+			return nil, err
+		}
+		held, herr := readRunLock(runDir)
+		st, _ := readRunState(runDir)
+		if herr == nil && lockIsLive(held, st, time.Now().UTC()) {
+			return nil, fmt.Errorf("%w: pid %d on %s", ErrRunLocked, held.PID, held.Host)
+		}
+		if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	t := &runStateTracker{runDir: runDir, st: RunState{PID: lock.PID, Host: host}, stop: make(chan struct{}), done: make(chan struct{})}
+	if err := t.set(RunStateInitializing, ""); err != nil {
+		_ = os.Remove(lockPath)
+		return nil, err
+	}
+	go t.heartbeat(interval)
+	return t, nil
+}
+
+func (t *runStateTracker) heartbeat(interval time.Duration) {
+	defer close(t.done)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-tick.C:
+			t.mu.Lock()
+			if !t.final {
+				t.st.HeartbeatAt = time.Now().UTC().Format(time.RFC3339Nano)
+				_ = writeJSONAtomic(filepath.Join(t.runDir, runStateFile), t.st)
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// set records a transition. Terminal states stop later transitions.
+func (t *runStateTracker) set(state, node string) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.final {
+		return nil
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	t.st.State, t.st.Node, t.st.UpdatedAt, t.st.HeartbeatAt = state, node, now, now
+	if node != "" {
+		t.st.State = state + ":" + node
+	}
+	switch state {
+	case RunStateCompleted, RunStateFailed, RunStateCancelled:
+		t.final = true
+	}
+	return writeJSONAtomic(filepath.Join(t.runDir, runStateFile), t.st)
+}
+
+func (t *runStateTracker) running(node string) {
+	_ = t.set(RunStateRunning, node)
+}
+
+// close stops the heartbeat and releases the lock. A run that ends without
+// a terminal state (an early return) is recorded as failed.
+func (t *runStateTracker) close() {
+	if t == nil {
+		return
+	}
+	_ = t.set(RunStateFailed, "")
+	close(t.stop)
+	<-t.done
+	_ = os.Remove(filepath.Join(t.runDir, runLockFile))
+}
+
+// runStateFor maps RunResult statuses to run.state terminal states.
+func runStateFor(status string) string {
+	switch status {
+	case "completed":
+		return RunStateCompleted
+	case "stopped":
+		return RunStateCancelled
+	default:
+		return RunStateFailed
+	}
+}
@@ -0,0 +1,201 @@
+package attractor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	runEnvironmentFile           = "environment.json"
+	runEnvironmentCommandTimeout = 10 * time.Second
+)
+
+// runEnvironment is written to <runDir>/environment.json at run start. Capture
+// is best-effort: a field that cannot be determined is left empty and the
+// reason is recorded in Errors.
+type runEnvironment struct {
+	SchemaVersion int               `json:"schema_version"`
+	CapturedAt    string            `json:"captured_at"`
+	OS            string            `json:"os"`
+	Arch          string            `json:"arch"`
+	GoVersion     string            `json:"go_version"`
+	Hostname      string            `json:"hostname"`
+	CodexVersions map[string]string `json:"codex_versions,omitempty"`
+	GitCommit     string            `json:"git_commit,omitempty"`
+	Env           map[string]string `json:"env"`
+	Errors        map[string]string `json:"errors,omitempty"`
+}
+
+var secretEnvMarkers = []string{"TOKEN", "SECRET", "KEY", "PASSWORD", "PASSWD", "CREDENTIAL", "AUTH", "COOKIE"}
+
+// runEnvCommand runs a short-lived command for environment capture; swapped in
+// tests.
+var runEnvCommand = func(dir, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), runEnvironmentCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) && len(ee.Stderr) > 0 {
+			return "", errors.New(strings.TrimSpace(string(ee.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func captureRunEnvironment(g *Graph, workdir, workspace string) runEnvironment {
+	env := runEnvironment{
+		SchemaVersion: 1,
+		CapturedAt:    time.Now().UTC().Format(time.RFC3339Nano),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		GoVersion:     runtime.Version(),
+		Env:           redactedFactoryEnv(os.Environ()),
+		Errors:        map[string]string{},
+	}
+	if host, err := os.Hostname(); err != nil {
+		env.Errors["hostname"] = err.Error()
+	} else {
+		env.Hostname = host
+	}
+	if _, err := os.Stat(filepath.Join(workdir, ".git")); workdir != "" && err == nil {
+		if commit, err := runEnvCommand(workdir, "git", "rev-parse", "HEAD"); err != nil {
+			env.Errors["git_commit"] = err.Error()
+		} else {
+			env.GitCommit = commit
+		}
+	}
+	for _, exe := range codexExecutables(g, workspace) {
+		if env.CodexVersions == nil {
+			env.CodexVersions = map[string]string{}
+		}
+		if v, err := runEnvCommand(workspace, exe, "--version"); err != nil {
+			env.Errors["codex_version:"+exe] = err.Error()
+		} else {
+			env.CodexVersions[exe] = v
+		}
+	}
+	if len(env.Errors) == 0 {
+		env.Errors = nil
+	}
+	return env
+}
+
+// codexExecutables lists the distinct codex executables configured nodes would
+// run, skipping replayed nodes and ones that do not resolve to codex.
+func codexExecutables(g *Graph, workspace string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, n := range g.Nodes {
+		if !isCodergenNode(n) || replayResponsePath(n) != "" {
+			continue
+		}
+		agent, err := ResolveAgent(n, workspace)
+		if err != nil {
+			continue
+		}
+		codex, ok := agent.(codexAgent)
+		if !ok || seen[codex.opts.Executable] {
+			continue
+		}
+		seen[codex.opts.Executable] = true
+		out = append(out, codex.opts.Executable)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// redactedFactoryEnv returns ATTRACTOR_*, ATTRACTION_*, and FACTORY_* variables,
+// replacing values of secret-looking names with "[redacted]".
+func redactedFactoryEnv(environ []string) map[string]string {
+	out := map[string]string{}
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, "ATTRACTOR_") && !strings.HasPrefix(name, "ATTRACTION_") && !strings.HasPrefix(name, "FACTORY_") {
+			continue
+		}
+		if isSecretEnvName(name) {
+			value = "[redacted]"
+		}
+		out[name] = value
+	}
+	return out
+}
+
+func isSecretEnvName(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, marker := range secretEnvMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// minRedactedSecretLen keeps short values such as "1" or "true" from being
+// scrubbed out of unrelated text.
+const minRedactedSecretLen = 6
+
+// redactSecretValues replaces the values of secret-looking environment
+// variables wherever they appear in s.
+func redactSecretValues(s string, environ []string) string {
+	if s == "" {
+		return s
+	}
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if len(value) < minRedactedSecretLen || !isSecretEnvName(name) {
+			continue
+		}
+		s = strings.ReplaceAll(s, value, "[redacted]")
+	}
+	return s
+}
+
+func readRunEnvironment(runDir string) (runEnvironment, bool) {
+	b, err := os.ReadFile(filepath.Join(runDir, runEnvironmentFile))
+	if err != nil {
+		return runEnvironment{}, false
+	}
+	var env runEnvironment
+	if err := json.Unmarshal(b, &env); err != nil {
+		return runEnvironment{}, false
+	}
+	return env, true
+}
+
+// diffRunEnvironments reports version-relevant differences between two
+// environment.json captures.
+func diffRunEnvironments(a, b runEnvironment) []EnvDifference {
+	out := []EnvDifference{}
+	add := func(field, va, vb string) {
+		if va != vb {
+			out = append(out, EnvDifference{Field: field, A: va, B: vb, Note: envDifferenceNote(field)})
+		}
+	}
+	add("go_version", a.GoVersion, b.GoVersion)
+	add("codex_version", joinVersions(a.CodexVersions), joinVersions(b.CodexVersions))
+	add("git_commit", a.GitCommit, b.GitCommit)
+	add("hostname", a.Hostname, b.Hostname)
+	return out
+}
+
+func joinVersions(m map[string]string) string {
+	vs := []string{}
+	for _, v := range m {
+		vs = append(vs, v)
+	}
+	sort.Strings(vs)
+	return strings.Join(uniqueNonEmpty(vs), ", ")
+}
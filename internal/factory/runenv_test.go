@@ -0,0 +1,83 @@
+package attractor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactedFactoryEnv(t *testing.T) {
+	env := redactedFactoryEnv([]string{"ATTRACTOR_CODEX_MODEL=o4", "ATTRACTOR_API_TOKEN=abc", "FACTORY_LOG_LEVEL=debug", "HOME=/root", "FACTORY_AUTH_HEADER=x"})
+	if env["ATTRACTOR_CODEX_MODEL"] != "o4" || env["FACTORY_LOG_LEVEL"] != "debug" {
+		t.Fatalf("expected plain values kept: %v", env)
+	}
+	if env["ATTRACTOR_API_TOKEN"] != "[redacted]" || env["FACTORY_AUTH_HEADER"] != "[redacted]" {
+		t.Fatalf("expected secret-looking values redacted: %v", env)
+	}
+	if _, ok := env["HOME"]; ok {
+		t.Fatal("unrelated env vars must not be captured")
+	}
+}
+
+func TestCaptureRunEnvironmentBestEffort(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "")
+	t.Setenv("ATTRACTOR_AGENT_BACKEND", "")
+	orig := runEnvCommand
+	t.Cleanup(func() { runEnvCommand = orig })
+	runEnvCommand = func(dir, name string, args ...string) (string, error) {
+		switch name {
+		case "git":
+			return "0123abcd", nil
+		default:
+			return "", errors.New("codex unavailable")
+		}
+	}
+	workdir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(workdir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; a [shape=box, "agent.backend"="codex", "codex.path"="/opt/codex"]; exit [shape=Msquare]; start -> a -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := captureRunEnvironment(g, workdir, t.TempDir())
+	if env.GitCommit != "0123abcd" || env.GoVersion == "" || env.OS == "" {
+		t.Fatalf("unexpected capture: %+v", env)
+	}
+	if env.Errors["codex_version:/opt/codex"] != "codex unavailable" || len(env.CodexVersions) != 0 {
+		t.Fatalf("expected codex error recorded per field: %+v", env)
+	}
+}
+
+func TestCompareEnvSurfacesVersionDifferences(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, `digraph G { start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }`)
+	for _, id := range []string{"r1", "r2"} {
+		if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(runsdir, "r2", "environment.json")
+	env, ok := readRunEnvironment(filepath.Join(runsdir, "r2"))
+	if !ok {
+		t.Fatal("expected environment.json")
+	}
+	env.CodexVersions = map[string]string{"codex": "codex-cli 9.9.9"}
+	b, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := CompareRunEnvironments(filepath.Join(runsdir, "r1"), filepath.Join(runsdir, "r2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "! codex_version: (none) | codex-cli 9.9.9") {
+		t.Fatalf("expected codex version difference:\n%s", out)
+	}
+}
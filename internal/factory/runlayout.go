@@ -0,0 +1,147 @@
+package attractor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// currentLayoutVersion is the run directory layout this build writes and
+// reads: manifest.json, events.jsonl, trace.jsonl (plus rotated segments and
+// trace.index.jsonl), checkpoint.json, and one artifact directory per node.
+// Bump it when the layout changes and register a migration from the previous
+// version.
+const currentLayoutVersion = 1
+
+// layoutMigration upgrades a run directory in place from one layout version to
+// the next.
+type layoutMigration struct {
+	To    int
+	Apply func(runDir string) error
+}
+
+// layoutMigrations is keyed by source version. v1 -> v1 is a no-op, so
+// migrate-run only stamps layout_version into manifests written before it
+// was recorded.
+var layoutMigrations = map[int]layoutMigration{
+	1: {To: 1, Apply: func(string) error { return nil }},
+}
+
+// readLayoutVersion returns the run's layout_version. Manifests written
+// before the field existed are implicitly version 1.
+func readLayoutVersion(runDir string) (int, error) {
+	b, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		return 0, err
+	}
+	var m struct {
+		LayoutVersion *int `json:"layout_version"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return 0, fmt.Errorf("invalid manifest in %s: %w", runDir, err)
+	}
+	if m.LayoutVersion == nil {
+		return 1, nil
+	}
+	return *m.LayoutVersion, nil
+}
+
+// checkRunLayout refuses run directories this build cannot safely read or
+// extend.
+func checkRunLayout(runDir string) error {
+	v, err := readLayoutVersion(runDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case v > currentLayoutVersion:
+		return fmt.Errorf("run %s uses layout version %d, newer than the supported version %d; upgrade factory to read it", filepath.Base(runDir), v, currentLayoutVersion)
+	case v < currentLayoutVersion:
+		return fmt.Errorf("run %s uses layout version %d, older than the current version %d; run `factory migrate-run %s` first", filepath.Base(runDir), v, currentLayoutVersion, runDir)
+	}
+	return nil
+}
+
+// MigrateRunDir upgrades runDir in place to currentLayoutVersion and returns
+// the versions it moved between.
+func MigrateRunDir(runDir string) (from, to int, err error) {
+	from, err = readLayoutVersion(runDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	if from > currentLayoutVersion {
+		return from, from, fmt.Errorf("run %s uses layout version %d, newer than the supported version %d", filepath.Base(runDir), from, currentLayoutVersion)
+	}
+	steps := []map[string]any{}
+	v := from
+	for {
+		m, ok := layoutMigrations[v]
+		if !ok {
+			if v == currentLayoutVersion {
+				break
+			}
+			return from, v, fmt.Errorf("no layout migration registered from version %d", v)
+		}
+		if m.To < v || m.To > currentLayoutVersion {
+			return from, v, fmt.Errorf("invalid layout migration %d -> %d", v, m.To)
+		}
+		if err := m.Apply(runDir); err != nil {
+			return from, v, fmt.Errorf("layout migration %d -> %d: %w", v, m.To, err)
+		}
+		steps = append(steps, map[string]any{"from": v, "to": m.To, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+		if m.To == v {
+			break
+		}
+		v = m.To
+	}
+	if v != currentLayoutVersion {
+		return from, v, fmt.Errorf("layout migrations stopped at version %d, want %d", v, currentLayoutVersion)
+	}
+	if err := updateManifest(runDir, "layout_version", currentLayoutVersion); err != nil {
+		return from, v, err
+	}
+	if err := appendLayoutMigrations(runDir, steps); err != nil {
+		return from, v, err
+	}
+	return from, v, nil
+}
+
+// priorLayoutMigrations returns the migration history of an existing manifest
+// so a resume does not drop it.
+func priorLayoutMigrations(runDir string) []any {
+	b, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		return nil
+	}
+	var m struct {
+		LayoutMigrations []any `json:"layout_migrations"`
+	}
+	if json.Unmarshal(b, &m) != nil {
+		return nil
+	}
+	return m.LayoutMigrations
+}
+
+func appendLayoutMigrations(runDir string, steps []map[string]any) error {
+	path := filepath.Join(runDir, "manifest.json")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	prior, _ := m["layout_migrations"].([]any)
+	for _, s := range steps {
+		prior = append(prior, s)
+	}
+	m["layout_migrations"] = prior
+	return writeJSON(path, m)
+}
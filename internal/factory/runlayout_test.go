@@ -0,0 +1,122 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifestRecordsLayoutVersion(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a; a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "lv1"}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := readLayoutVersion(filepath.Join(runsdir, "lv1"))
+	if err != nil || v != currentLayoutVersion {
+		t.Fatalf("layout version = %d, %v", v, err)
+	}
+}
+
+func setManifestKey(t *testing.T, runDir, key string, value any) {
+	t.Helper()
+	path := filepath.Join(runDir, "manifest.json")
+	m := map[string]any{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if value == nil {
+		delete(m, key)
+	} else {
+		m[key] = value
+	}
+	if err := writeJSON(path, m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResumeRefusesNewerLayout(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; b [shape=box]; exit [shape=Msquare]; start -> a; a -> b; b -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "lv2"}); err == nil {
+		t.Fatal("expected test stop")
+	}
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	runDir := filepath.Join(runsdir, "lv2")
+	setManifestKey(t, runDir, "layout_version", currentLayoutVersion+1)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "lv2", Resume: true})
+	if err == nil || !strings.Contains(err.Error(), "newer than the supported version") {
+		t.Fatalf("expected newer layout refusal, got %v", err)
+	}
+	if _, err := ExplainRoute(runDir, "a"); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("expected explain to refuse newer layout, got %v", err)
+	}
+	if _, err := ExtractDeliverables(runDir, t.TempDir()); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("expected deliver to refuse newer layout, got %v", err)
+	}
+	if _, _, err := MigrateRunDir(runDir); err == nil {
+		t.Fatal("expected migrate-run to refuse newer layout")
+	}
+}
+
+func TestMigrateRunDirStampsLegacyManifest(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a; a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "lv3"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "lv3")
+	setManifestKey(t, runDir, "layout_version", nil)
+	if err := checkRunLayout(runDir); err != nil {
+		t.Fatalf("legacy manifest should read as v1: %v", err)
+	}
+	from, to, err := MigrateRunDir(runDir)
+	if err != nil || from != 1 || to != currentLayoutVersion {
+		t.Fatalf("migrate = %d -> %d, %v", from, to, err)
+	}
+	b, _ := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["layout_version"] != float64(currentLayoutVersion) {
+		t.Fatalf("layout_version not stamped: %v", m["layout_version"])
+	}
+	if steps, _ := m["layout_migrations"].([]any); len(steps) != 1 {
+		t.Fatalf("expected one recorded migration step, got %v", m["layout_migrations"])
+	}
+}
+
+func TestMigrateRunDirAppliesRegisteredSteps(t *testing.T) {
+	runDir := t.TempDir()
+	writeFile(t, filepath.Join(runDir, "manifest.json"), `{"schema_version": 1, "layout_version": 0}`)
+	applied := []int{}
+	saved := layoutMigrations
+	t.Cleanup(func() { layoutMigrations = saved })
+	layoutMigrations = map[int]layoutMigration{
+		0: {To: 1, Apply: func(string) error { applied = append(applied, 0); return nil }},
+		1: {To: 1, Apply: func(string) error { applied = append(applied, 1); return nil }},
+	}
+	if err := checkRunLayout(runDir); err == nil || !strings.Contains(err.Error(), "migrate-run") {
+		t.Fatalf("expected older layout to point at migrate-run, got %v", err)
+	}
+	from, to, err := MigrateRunDir(runDir)
+	if err != nil || from != 0 || to != 1 || len(applied) != 2 {
+		t.Fatalf("migrate = %d -> %d (%v), applied %v", from, to, err, applied)
+	}
+	delete(layoutMigrations, 0)
+	writeFile(t, filepath.Join(runDir, "manifest.json"), `{"schema_version": 1, "layout_version": 0}`)
+	if _, _, err := MigrateRunDir(runDir); err == nil || !strings.Contains(err.Error(), "no layout migration registered") {
+		t.Fatalf("expected missing migration error, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package attractor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Scheduling attributes. `priority` orders runnable branches once a parallel
+// executor exists; the sequential engine has at most one runnable node, so it
+// is validated and recorded but does not change execution order today.
+// `depends_on` is enforced by both: a node may not start before the listed
+// nodes have finished.
+
+func nodeDependsOn(n *Node) []string {
+	return uniqueNonEmpty(splitCSV(n.StringAttr("depends_on", "")))
+}
+
+func validateScheduling(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
+	ids := make([]string, 0, len(g.Nodes))
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		n := g.Nodes[id]
+		if raw, ok := n.Attrs["priority"]; ok {
+			if _, isInt := intValue(raw); !isInt {
+				d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("priority on node %s must be an integer: %v", id, raw)})
+			}
+		}
+		for _, dep := range nodeDependsOn(n) {
+			if dep == id {
+				d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s depends_on itself", id)})
+			} else if g.Nodes[dep] == nil {
+				d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s depends_on unknown node: %s", id, dep)})
+			}
+		}
+	}
+	if cycle := dependsOnCycle(g, ids); len(cycle) > 0 {
+		d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("depends_on cycle: %s", strings.Join(cycle, " -> "))})
+	}
+	return d
+}
+
+// dependsOnCycle returns one depends_on cycle (first node repeated at the end)
+// or nil.
+func dependsOnCycle(g *Graph, ids []string) []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[string]int{}
+	stack := []string{}
+	var visit func(id string) []string
+	visit = func(id string) []string {
+		state[id] = visiting
+		stack = append(stack, id)
+		for _, dep := range nodeDependsOn(g.Nodes[id]) {
+			if g.Nodes[dep] == nil || dep == id {
+				continue
+			}
+			switch state[dep] {
+			case visiting:
+				for i, s := range stack {
+					if s == dep {
+						return append(append([]string{}, stack[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if c := visit(dep); c != nil {
+					return c
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+		return nil
+	}
+	for _, id := range ids {
+		if state[id] == unvisited {
+			if c := visit(id); c != nil {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// checkDependencies traces the scheduling decision for a node with depends_on
+// and fails when a dependency has not finished.
+func (e *Engine) checkDependencies(node *Node) error {
+	deps := nodeDependsOn(node)
+	if len(deps) == 0 {
+		return nil
+	}
+	waiting := []string{}
+	for _, dep := range deps {
+		if !e.Completed[dep] {
+			waiting = append(waiting, dep)
+		}
+	}
+	_ = e.appendTrace("SchedulerDecision", map[string]any{
+		"node_id":    node.ID,
+		"priority":   node.IntAttr("priority", 0),
+		"depends_on": deps,
+		"waiting_on": waiting,
+		"ready":      len(waiting) == 0,
+	})
+	if len(waiting) > 0 {
+		return fmt.Errorf("node %s cannot start: depends_on not finished: %s", node.ID, strings.Join(waiting, ","))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package attractor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func diagnosticMessages(d []Diagnostic) string {
+	msgs := make([]string, 0, len(d))
+	for _, x := range d {
+		msgs = append(msgs, x.Message)
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func TestValidateDependsOnUnknownAndCycles(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, depends_on="c", priority="10"];
+	b [shape=box, depends_on="a,ghost"];
+	c [shape=box, depends_on="b", priority="high"];
+	exit [shape=Msquare];
+	start -> a -> b -> c -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{"node b depends_on unknown node: ghost", "depends_on cycle: a -> c -> b -> a", "priority on node c must be an integer"} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+	if strings.Contains(msgs, "priority on node a") {
+		t.Fatalf("quoted integer priority rejected:\n%s", msgs)
+	}
+}
+
+func TestDependsOnSatisfiedIsTraced(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, `digraph G {
+	start [shape=Mdiamond];
+	deploy [shape=box];
+	load_test [shape=box, depends_on="deploy", priority=10];
+	exit [shape=Msquare];
+	start -> deploy -> load_test -> exit;
+	}`)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	var decision map[string]any
+	for _, rec := range readJSONLRecords(t, filepath.Join(runsdir, "r1", "trace.jsonl")) {
+		if rec["type"] == "SchedulerDecision" {
+			decision = rec
+		}
+	}
+	if decision == nil || decision["node_id"] != "load_test" || decision["ready"] != true || decision["priority"] != float64(10) {
+		t.Fatalf("unexpected scheduler decision: %+v", decision)
+	}
+}
+
+func TestDependsOnUnfinishedBlocksNode(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	workdir, runsdir, pipeline := setupRun(t, `digraph G {
+	start [shape=Mdiamond];
+	load_test [shape=box, depends_on="deploy"];
+	deploy [shape=box];
+	exit [shape=Msquare];
+	start -> load_test -> deploy -> exit;
+	}`)
+	err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "r1"})
+	if err == nil || !strings.Contains(err.Error(), "depends_on not finished: deploy") {
+		t.Fatalf("expected dependency error, got %v", err)
+	}
+	var waiting []any
+	for _, rec := range readJSONLRecords(t, filepath.Join(runsdir, "r1", "trace.jsonl")) {
+		if rec["type"] == "SchedulerDecision" {
+			waiting, _ = rec["waiting_on"].([]any)
+		}
+	}
+	if len(waiting) != 1 || waiting[0] != "deploy" {
+		t.Fatalf("expected trace to record waiting_on deploy, got %v", waiting)
+	}
+}
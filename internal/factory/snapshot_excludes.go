@@ -0,0 +1,147 @@
+package attractor
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// parseSnapshotExcludes splits a snapshot_excludes value into
+// workspace-relative globs. An entry ending in "/" names a directory and
+// everything under it; `**` matches any number of path segments.
+func parseSnapshotExcludes(raw string) ([]string, error) {
+	globs := uniqueNonEmpty(splitCSV(raw))
+	for _, g := range globs {
+		if strings.HasPrefix(g, "/") || strings.Contains(g, "..") {
+			return nil, fmt.Errorf("snapshot_excludes entry must be a workspace-relative glob: %s", g)
+		}
+		if _, err := path.Match(strings.ReplaceAll(strings.TrimSuffix(g, "/"), "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid snapshot_excludes glob %s: %w", g, err)
+		}
+	}
+	return globs, nil
+}
+
+// snapshotExcludes is the graph's snapshot_excludes followed by the node's.
+// A nil node gives the graph's alone, which is what checkpoint digests use.
+func snapshotExcludes(g *Graph, n *Node) ([]string, error) {
+	out := []string{}
+	if g != nil {
+		if raw, ok := g.Attrs["snapshot_excludes"]; ok {
+			globs, err := parseSnapshotExcludes(fmt.Sprintf("%v", raw))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, globs...)
+		}
+	}
+	if n != nil {
+		globs, err := parseSnapshotExcludes(n.StringAttr("snapshot_excludes", ""))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, globs...)
+	}
+	return out, nil
+}
+
+// snapshotExcluded reports whether the slash-separated workspace path rel is
+// excluded. Directory entries match rel itself when dir is set, and any
+// directory above it.
+func snapshotExcluded(rel string, dir bool, excludes []string) bool {
+	segs := strings.Split(rel, "/")
+	for _, entry := range excludes {
+		if d, ok := strings.CutSuffix(entry, "/"); ok {
+			pat := strings.Split(d, "/")
+			n := len(segs) - 1
+			if dir {
+				n = len(segs)
+			}
+			for i := 1; i <= n; i++ {
+				if matchGlobSegments(pat, segs[:i]) {
+					return true
+				}
+			}
+			continue
+		}
+		if !dir && matchCacheGlob(entry, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// statExcluded records an excluded file by size, mtime, and mode without
+// reading it, which is enough to count writes to it.
+func statExcluded(path string, d fs.DirEntry) (fileState, error) {
+	info, err := d.Info()
+	if err != nil {
+		return fileState{}, err
+	}
+	st := fileState{Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode().Perm()}
+	if d.Type()&fs.ModeSymlink != 0 {
+		if st.Symlink, err = os.Readlink(path); err != nil {
+			return fileState{}, err
+		}
+	}
+	return st, nil
+}
+
+// countExcludedWrites counts excluded files a node created, deleted, or
+// changed. It is diagnostic only, so a change is any difference in size,
+// mtime, mode, or link target.
+func countExcludedWrites(before, after map[string]fileState) int {
+	n := 0
+	for p, a := range after {
+		b, ok := before[p]
+		if !ok || b.Size != a.Size || !b.ModTime.Equal(a.ModTime) || b.Mode != a.Mode || b.Symlink != a.Symlink {
+			n++
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// validateSnapshotExcludes checks a node's snapshot_excludes and warns about
+// allowed_write_paths entries that an exclusion hides completely, since the
+// guardrail can then never see writes there.
+func validateSnapshotExcludes(g *Graph, n *Node) []Diagnostic {
+	if _, err := parseSnapshotExcludes(n.StringAttr("snapshot_excludes", "")); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s: %v", n.ID, err)}}
+	}
+	excludes, err := snapshotExcludes(g, n)
+	if err != nil || len(excludes) == 0 {
+		return nil
+	}
+	allowed, err := ParseAllowedWritePaths(n)
+	if err != nil {
+		return nil
+	}
+	d := []Diagnostic{}
+	for _, entry := range allowed {
+		p := filepath.ToSlash(entry)
+		dir, isDir := strings.CutSuffix(p, "/")
+		if snapshotExcluded(dir, isDir, excludes) {
+			d = append(d, Diagnostic{Level: "WARN", Message: fmt.Sprintf("node %s allowed_write_paths entry %s is hidden by snapshot_excludes; writes there are never checked", n.ID, entry)})
+		}
+	}
+	return d
+}
+
+func validateGraphSnapshotExcludes(g *Graph) []Diagnostic {
+	raw, ok := g.Attrs["snapshot_excludes"]
+	if !ok {
+		return nil
+	}
+	if _, err := parseSnapshotExcludes(fmt.Sprintf("%v", raw)); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("graph: %v", err)}}
+	}
+	return nil
+}
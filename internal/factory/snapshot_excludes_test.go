@@ -0,0 +1,94 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotExcludesKeepBuildCachesOutOfDiffs(t *testing.T) {
+	dot := `digraph G {
+	graph [snapshot_excludes="**/.gocache/"];
+	start [shape=Mdiamond];
+	build [shape=parallelogram, allowed_write_paths="out/", snapshot_excludes="**/*.test", tool_command="mkdir -p pkg/.gocache/x out && echo c > pkg/.gocache/x/obj && echo t > out/pkg.test && echo o > out/bin && rm .gocache/old"];
+	fail [shape=parallelogram, on_fail="rollback", tool_command="echo n > .gocache/new && echo s > scratch.txt && exit 1"];
+	exit [shape=Msquare];
+	start -> build -> fail;
+	fail -> exit [condition="outcome=fail"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, ".gocache", "old"), "cached\n")
+	writeFile(t, filepath.Join(workdir, ".gocache", "keep"), "cached\n")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "se1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "se1")
+	if st := readStatusJSON(t, filepath.Join(runDir, "build", "status.json")); st["outcome"] != "success" {
+		t.Fatalf("build status = %v", st)
+	}
+	b, err := os.ReadFile(filepath.Join(runDir, "build", "workspace.diff.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diff workspaceDiff
+	if err := json.Unmarshal(b, &diff); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(diff.Created, ",") != "out/bin" || len(diff.Modified)+len(diff.Deleted) != 0 || diff.ExcludedWrites != 3 {
+		t.Fatalf("diff = %+v", diff)
+	}
+	// Rollback reverts scratch.txt but leaves the excluded cache alone.
+	ws := filepath.Join(runDir, "workspace")
+	for rel, want := range map[string]bool{"scratch.txt": false, ".gocache/new": true, ".gocache/keep": true, "pkg/.gocache/x/obj": true} {
+		if _, err := os.Stat(filepath.Join(ws, rel)); (err == nil) != want {
+			t.Fatalf("%s exists = %t after rollback", rel, err == nil)
+		}
+	}
+}
+
+func TestSnapshotExcludedMatching(t *testing.T) {
+	excludes := []string{"**/.gocache/", "**/*.test", "node_modules/"}
+	for rel, want := range map[string]bool{
+		".gocache/a":         true,
+		"a/b/.gocache/c/d":   true,
+		"pkg/x.test":         true,
+		"x.test":             true,
+		"node_modules/a/b":   true,
+		"src/node_modules/a": false,
+		"src/.gocache":       false,
+		"src/main.go":        false,
+	} {
+		if got := snapshotExcluded(rel, false, excludes); got != want {
+			t.Errorf("snapshotExcluded(%q) = %t, want %t", rel, got, want)
+		}
+	}
+}
+
+func TestValidateSnapshotExcludes(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	graph [snapshot_excludes="node_modules/"];
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="true", allowed_write_paths="node_modules/lib/,src/,out/app.test", snapshot_excludes="**/*.test"];
+	b [shape=parallelogram, tool_command="true", snapshot_excludes="/abs/"];
+	exit [shape=Msquare];
+	start -> a -> b -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{
+		"node a allowed_write_paths entry node_modules/lib/ is hidden by snapshot_excludes; writes there are never checked",
+		"node a allowed_write_paths entry out/app.test is hidden by snapshot_excludes; writes there are never checked",
+		"node b: snapshot_excludes entry must be a workspace-relative glob: /abs/",
+	} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("diagnostics lack %q:\n%s", want, msgs)
+		}
+	}
+	if strings.Contains(msgs, "entry src/") {
+		t.Fatalf("src/ reported as hidden:\n%s", msgs)
+	}
+}
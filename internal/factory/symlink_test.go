@@ -0,0 +1,127 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyDirRecreatesInTreeSymlinks(t *testing.T) {
+	srcRoot := t.TempDir()
+	dstRoot := t.TempDir()
+	writeFile(t, filepath.Join(srcRoot, "data", "real.txt"), "content")
+	if err := os.Symlink("data/real.txt", filepath.Join(srcRoot, "rel_link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(srcRoot, "data"), filepath.Join(srcRoot, "abs_dir_link")); err != nil {
+		t.Fatal(err)
+	}
+	skipped, err := copyDir(srcRoot, dstRoot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 0 {
+		t.Fatalf("unexpected skipped links: %v", skipped)
+	}
+	target, err := os.Readlink(filepath.Join(dstRoot, "rel_link"))
+	if err != nil || target != "data/real.txt" {
+		t.Fatalf("expected relative symlink, got %q %v", target, err)
+	}
+	target, err = os.Readlink(filepath.Join(dstRoot, "abs_dir_link"))
+	if err != nil || target != "data" {
+		t.Fatalf("expected absolute in-tree link rewritten relative, got %q %v", target, err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dstRoot, "abs_dir_link", "real.txt")); err != nil || string(b) != "content" {
+		t.Fatalf("expected link to resolve inside copy: %q %v", string(b), err)
+	}
+}
+
+func TestCopyDirSkipsSymlinksOutsideWorkdir(t *testing.T) {
+	outside := t.TempDir()
+	writeFile(t, filepath.Join(outside, "secret.txt"), "secret")
+	srcRoot := t.TempDir()
+	dstRoot := t.TempDir()
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(srcRoot, "abs_escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../"+filepath.Base(outside)+"/secret.txt", filepath.Join(srcRoot, "rel_escape")); err != nil {
+		t.Fatal(err)
+	}
+	skipped, err := copyDir(srcRoot, dstRoot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(skipped, ",") != "abs_escape,rel_escape" {
+		t.Fatalf("unexpected skipped links: %v", skipped)
+	}
+	for _, name := range []string{"abs_escape", "rel_escape"} {
+		if _, err := os.Lstat(filepath.Join(dstRoot, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should not be copied", name)
+		}
+	}
+}
+
+func TestSnapshotRepresentsSymlinksByTarget(t *testing.T) {
+	ws := t.TempDir()
+	writeFile(t, filepath.Join(ws, "a.txt"), "a")
+	writeFile(t, filepath.Join(ws, "b.txt"), "a")
+	if err := os.Symlink("a.txt", filepath.Join(ws, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(ws, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dir", filepath.Join(ws, "dir_link")); err != nil {
+		t.Fatal(err)
+	}
+	before, err := snapshotWorkspace(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before["link"].Symlink != "a.txt" || before["dir_link"].Symlink != "dir" {
+		t.Fatalf("expected symlink targets in snapshot: %+v", before)
+	}
+	if err := os.Remove(filepath.Join(ws, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("b.txt", filepath.Join(ws, "link")); err != nil {
+		t.Fatal(err)
+	}
+	after, err := snapshotWorkspace(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := computeDiff(before, after)
+	if strings.Join(d.Modified, ",") != "link" {
+		t.Fatalf("expected retargeted link as modification, got %+v", d)
+	}
+	if v := disallowedDiffPaths(d, []string{"a.txt", "b.txt"}); strings.Join(v, ",") != "link" {
+		t.Fatalf("expected guardrail violation on link, got %v", v)
+	}
+}
+
+func TestRunRecordsSkippedSymlinksInManifest(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := os.Symlink(pipeline, filepath.Join(workdir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "sl"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(runsdir, "sl", "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	skipped, _ := m["skipped_symlinks"].([]any)
+	if len(skipped) != 1 || skipped[0] != "escape" {
+		t.Fatalf("expected skipped symlink note, got %v", m["skipped_symlinks"])
+	}
+}
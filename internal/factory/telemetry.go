@@ -0,0 +1,382 @@
+package attractor
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const telemetryExportTimeout = 10 * time.Second
+
+// TelemetrySpan is a finished span handed to a SpanExporter. IDs are lowercase
+// hex as in the OTLP JSON encoding.
+type TelemetrySpan struct {
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	Name          string
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]any
+	Events        []TelemetrySpanEvent
+	Error         bool
+	StatusMessage string
+}
+
+// TelemetrySpanEvent is a timestamped annotation on a span.
+type TelemetrySpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]any
+}
+
+// SpanExporter receives the spans of one RunPipeline invocation when it ends.
+// Export errors are logged and never change the run result.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []TelemetrySpan) error
+}
+
+// InMemorySpanExporter keeps exported spans for inspection in tests.
+type InMemorySpanExporter struct {
+	mu    sync.Mutex
+	spans []TelemetrySpan
+}
+
+func (x *InMemorySpanExporter) ExportSpans(_ context.Context, spans []TelemetrySpan) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.spans = append(x.spans, spans...)
+	return nil
+}
+
+// Spans returns a copy of everything exported so far.
+func (x *InMemorySpanExporter) Spans() []TelemetrySpan {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return append([]TelemetrySpan(nil), x.spans...)
+}
+
+// runTelemetry turns the events written to events.jsonl into spans: one root
+// span per run and one child span per node attempt. Span times are parsed
+// from the events' "at" fields, so they match events.jsonl exactly.
+type runTelemetry struct {
+	graph    *Graph
+	runID    string
+	resume   bool
+	exporter SpanExporter
+	logger   *slog.Logger
+	traceID  string
+	root     *TelemetrySpan
+	// open holds in-progress node attempt spans; loop body stages nest under
+	// their manager's span.
+	open     []*TelemetrySpan
+	attempts map[string]int
+	finished []TelemetrySpan
+}
+
+func newRunTelemetry(cfg RunConfig, g *Graph, logger *slog.Logger) *runTelemetry {
+	if !cfg.EnableOTel {
+		return nil
+	}
+	exporter := cfg.SpanExporter
+	if exporter == nil {
+		otlp, err := newOTLPExporterFromEnv()
+		if err != nil {
+			logger.Warn("telemetry export disabled", "error", err)
+			return nil
+		}
+		exporter = otlp
+	}
+	return &runTelemetry{graph: g, runID: cfg.RunID, resume: cfg.Resume, exporter: exporter, logger: logger, traceID: randomHexID(16), attempts: map[string]int{}}
+}
+
+// observe folds one event into the span tree.
+func (t *runTelemetry) observe(ev map[string]any) {
+	if t == nil {
+		return
+	}
+	typ, _ := ev["type"].(string)
+	raw, _ := ev["at"].(string)
+	at, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		at = time.Now().UTC()
+	}
+	nodeID, _ := ev["node_id"].(string)
+	switch typ {
+	case "PipelineStarted":
+		t.root = &TelemetrySpan{TraceID: t.traceID, SpanID: randomHexID(8), Name: "pipeline " + t.runID, Start: at,
+			Attributes: map[string]any{"run.id": t.runID, "run.resume": t.resume}}
+	case "StageStarted":
+		t.attempts[nodeID] = 0
+		t.startAttempt(nodeID, at)
+	case "StageRetrying":
+		if span := t.current(nodeID); span != nil {
+			span.Attributes["outcome"] = "retry"
+			t.endAttempt(span, at)
+		}
+		t.startAttempt(nodeID, at)
+	case "GuardrailViolation":
+		if span := t.current(nodeID); span != nil {
+			attrs := map[string]any{}
+			for _, k := range []string{"mode", "paths", "handler_started_at", "handler_finished_at"} {
+				if v, ok := ev[k]; ok {
+					attrs["guardrail."+k] = v
+				}
+			}
+			span.Events = append(span.Events, TelemetrySpanEvent{Name: "guardrail_violation", Time: at, Attributes: attrs})
+		}
+	case "StageCompleted", "StageFailed":
+		span := t.current(nodeID)
+		if span == nil {
+			return
+		}
+		if outcome, ok := ev["outcome"].(string); ok {
+			span.Attributes["outcome"] = outcome
+		}
+		if typ == "StageFailed" {
+			span.Error = true
+			if reason, ok := ev["failure_reason"].(string); ok {
+				span.Attributes["outcome"] = "fail"
+				span.Attributes["failure_reason"] = reason
+				span.StatusMessage = reason
+			}
+			if code, ok := ev["failure_code"].(string); ok && code != "" {
+				span.Attributes["failure_code"] = code
+			}
+			if msg, ok := ev["error"].(string); ok {
+				span.Attributes["error"] = msg
+				span.StatusMessage = msg
+			}
+		}
+		t.endAttempt(span, at)
+	case "PipelineCompleted", "PipelineFailed", "PipelineAborted", "PipelineStopped":
+		if t.root == nil {
+			return
+		}
+		if msg, ok := ev["error"].(string); ok {
+			t.root.Error = true
+			t.root.StatusMessage = msg
+		}
+		t.root.End = at
+	}
+}
+
+func (t *runTelemetry) startAttempt(nodeID string, at time.Time) {
+	t.attempts[nodeID]++
+	parent := ""
+	if len(t.open) > 0 {
+		parent = t.open[len(t.open)-1].SpanID
+	} else if t.root != nil {
+		parent = t.root.SpanID
+	}
+	n := t.graph.Nodes[nodeID]
+	t.open = append(t.open, &TelemetrySpan{TraceID: t.traceID, SpanID: randomHexID(8), ParentSpanID: parent, Name: "node " + nodeID, Start: at,
+		Attributes: map[string]any{
+			"node.id":     nodeID,
+			"node.type":   n.Type(),
+			"node.shape":  n.Shape(),
+			"attempt":     t.attempts[nodeID],
+			"retry_count": t.attempts[nodeID] - 1,
+		}})
+}
+
+func (t *runTelemetry) current(nodeID string) *TelemetrySpan {
+	for i := len(t.open) - 1; i >= 0; i-- {
+		if t.open[i].Attributes["node.id"] == nodeID {
+			return t.open[i]
+		}
+	}
+	return nil
+}
+
+func (t *runTelemetry) endAttempt(span *TelemetrySpan, at time.Time) {
+	span.End = at
+	for i := len(t.open) - 1; i >= 0; i-- {
+		if t.open[i] == span {
+			t.open = append(t.open[:i], t.open[i+1:]...)
+			break
+		}
+	}
+	t.finished = append(t.finished, *span)
+}
+
+// flush closes any spans left open by an aborted run and exports everything.
+func (t *runTelemetry) flush() {
+	if t == nil || t.root == nil {
+		return
+	}
+	now := time.Now().UTC()
+	for len(t.open) > 0 {
+		t.endAttempt(t.open[len(t.open)-1], now)
+	}
+	if t.root.End.IsZero() {
+		t.root.End = now
+	}
+	spans := append([]TelemetrySpan{*t.root}, t.finished...)
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryExportTimeout)
+	defer cancel()
+	if err := t.exporter.ExportSpans(ctx, spans); err != nil {
+		t.logger.Warn("telemetry export failed", "spans", len(spans), "error", err)
+	}
+}
+
+func randomHexID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// Fall back to a time-derived ID; telemetry must never fail a run.
+		s := strconv.FormatInt(time.Now().UnixNano(), 16)
+		return strings.Repeat("0", 2*n-len(s)) + s
+	}
+	return hex.EncodeToString(b)
+}
+
+// otlpExporter posts spans as OTLP/HTTP JSON. It reads the standard
+// OTEL_EXPORTER_OTLP_* variables and needs no SDK dependency.
+type otlpExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+}
+
+func newOTLPExporterFromEnv() (*otlpExporter, error) {
+	if p := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")); p != "" && p != "http/json" {
+		return nil, fmt.Errorf("unsupported OTEL_EXPORTER_OTLP_TRACES_PROTOCOL %q (only http/json)", p)
+	}
+	if p := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")); p != "" && p != "http/json" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL") == "" {
+		return nil, fmt.Errorf("unsupported OTEL_EXPORTER_OTLP_PROTOCOL %q (only http/json)", p)
+	}
+	endpoint := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"))
+	if endpoint == "" {
+		base := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+		if base == "" {
+			base = "http://localhost:4318"
+		}
+		endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+	}
+	headers := map[string]string{}
+	for _, raw := range []string{os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), os.Getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS")} {
+		for _, pair := range splitCSV(raw) {
+			k, v, ok := strings.Cut(pair, "=")
+			if ok && strings.TrimSpace(k) != "" {
+				headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+	}
+	service := strings.TrimSpace(os.Getenv("OTEL_SERVICE_NAME"))
+	if service == "" {
+		service = "dark-factory"
+	}
+	return &otlpExporter{endpoint: endpoint, headers: headers, serviceName: service, client: &http.Client{Timeout: telemetryExportTimeout}}, nil
+}
+
+func (x *otlpExporter) ExportSpans(ctx context.Context, spans []TelemetrySpan) error {
+	body, err := json.Marshal(otlpTracePayload(x.serviceName, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, x.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range x.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := x.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export to %s: %s", x.endpoint, resp.Status)
+	}
+	return nil
+}
+
+func otlpTracePayload(service string, spans []TelemetrySpan) map[string]any {
+	out := make([]map[string]any, 0, len(spans))
+	for _, s := range spans {
+		span := map[string]any{
+			"traceId":           s.TraceID,
+			"spanId":            s.SpanID,
+			"name":              s.Name,
+			"kind":              1,
+			"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.Attributes),
+			"status":            map[string]any{"code": 1},
+		}
+		if s.ParentSpanID != "" {
+			span["parentSpanId"] = s.ParentSpanID
+		}
+		if s.Error {
+			span["status"] = map[string]any{"code": 2, "message": s.StatusMessage}
+		}
+		events := make([]map[string]any, 0, len(s.Events))
+		for _, ev := range s.Events {
+			events = append(events, map[string]any{
+				"name":         ev.Name,
+				"timeUnixNano": strconv.FormatInt(ev.Time.UnixNano(), 10),
+				"attributes":   otlpAttributes(ev.Attributes),
+			})
+		}
+		if len(events) > 0 {
+			span["events"] = events
+		}
+		out = append(out, span)
+	}
+	return map[string]any{"resourceSpans": []any{map[string]any{
+		"resource":   map[string]any{"attributes": otlpAttributes(map[string]any{"service.name": service})},
+		"scopeSpans": []any{map[string]any{"scope": map[string]any{"name": "dark-factory/attractor"}, "spans": out}},
+	}}}
+}
+
+func otlpAttributes(attrs map[string]any) []map[string]any {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]map[string]any, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, map[string]any{"key": k, "value": otlpValue(attrs[k])})
+	}
+	return out
+}
+
+func otlpValue(v any) map[string]any {
+	switch t := v.(type) {
+	case string:
+		return map[string]any{"stringValue": t}
+	case bool:
+		return map[string]any{"boolValue": t}
+	case int:
+		return map[string]any{"intValue": strconv.Itoa(t)}
+	case int64:
+		return map[string]any{"intValue": strconv.FormatInt(t, 10)}
+	case float64:
+		return map[string]any{"doubleValue": t}
+	case []string:
+		values := make([]map[string]any, 0, len(t))
+		for _, s := range t {
+			values = append(values, otlpValue(s))
+		}
+		return map[string]any{"arrayValue": map[string]any{"values": values}}
+	default:
+		return map[string]any{"stringValue": fmt.Sprintf("%v", v)}
+	}
+}
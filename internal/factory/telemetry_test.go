@@ -0,0 +1,142 @@
+package attractor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTelemetrySpansMatchEvents(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, max_retries=1, "test.outcome_sequence"="retry,success"];
+	g [shape=parallelogram, tool_command="sh -c 'echo hi > b.txt'", allowed_write_paths="a.txt"];
+	exit [shape=Msquare];
+	start -> a;
+	a -> g;
+	g -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	exporter := &InMemorySpanExporter{}
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "otel1", EnableOTel: true, SpanExporter: exporter}); err != nil {
+		t.Fatal(err)
+	}
+	spans := exporter.Spans()
+	root := spans[0]
+	if root.ParentSpanID != "" || root.Attributes["run.id"] != "otel1" {
+		t.Fatalf("unexpected root span: %+v", root)
+	}
+	events := readJSONLRecords(t, filepath.Join(runsdir, "otel1", "events.jsonl"))
+	eventTime := func(typ, nodeID string, nth int) time.Time {
+		t.Helper()
+		for _, ev := range events {
+			if ev["type"] == typ && (nodeID == "" || ev["node_id"] == nodeID) {
+				if nth == 0 {
+					at, err := time.Parse(time.RFC3339Nano, ev["at"].(string))
+					if err != nil {
+						t.Fatal(err)
+					}
+					return at
+				}
+				nth--
+			}
+		}
+		t.Fatalf("missing event %s %s", typ, nodeID)
+		return time.Time{}
+	}
+	if !root.Start.Equal(eventTime("PipelineStarted", "", 0)) || !root.End.Equal(eventTime("PipelineCompleted", "", 0)) {
+		t.Fatalf("root span times do not match events: %v..%v", root.Start, root.End)
+	}
+	attempts := map[string][]TelemetrySpan{}
+	for _, s := range spans[1:] {
+		if s.TraceID != root.TraceID || s.ParentSpanID != root.SpanID {
+			t.Fatalf("span %s not parented to root", s.Name)
+		}
+		id := s.Attributes["node.id"].(string)
+		attempts[id] = append(attempts[id], s)
+	}
+	a := attempts["a"]
+	if len(a) != 2 {
+		t.Fatalf("expected two attempt spans for a, got %d", len(a))
+	}
+	if a[0].Attributes["outcome"] != "retry" || a[1].Attributes["outcome"] != "success" || a[1].Attributes["retry_count"] != 1 {
+		t.Fatalf("unexpected attempt attributes: %v / %v", a[0].Attributes, a[1].Attributes)
+	}
+	if !a[0].Start.Equal(eventTime("StageStarted", "a", 0)) || !a[0].End.Equal(eventTime("StageRetrying", "a", 0)) || !a[1].End.Equal(eventTime("StageCompleted", "a", 0)) {
+		t.Fatal("attempt span times do not match events")
+	}
+	g := attempts["g"]
+	if len(g) != 1 || !g[0].Error || g[0].Attributes["failure_reason"] == nil {
+		t.Fatalf("expected failed guardrail span, got %+v", g)
+	}
+	if len(g[0].Events) != 1 || g[0].Events[0].Name != "guardrail_violation" || !g[0].Events[0].Time.Equal(eventTime("GuardrailViolation", "g", 0)) {
+		t.Fatalf("expected guardrail span event, got %+v", g[0].Events)
+	}
+}
+
+type failingSpanExporter struct{}
+
+func (failingSpanExporter) ExportSpans(context.Context, []TelemetrySpan) error {
+	return errors.New("collector unavailable")
+}
+
+func TestTelemetryExportFailureDoesNotAffectRun(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; exit [shape=Msquare]; start -> a; a -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "otel2", EnableOTel: true, SpanExporter: failingSpanExporter{}}); err != nil {
+		t.Fatalf("export failure changed run result: %v", err)
+	}
+}
+
+func TestOTLPExporterPostsJSONFromEnv(t *testing.T) {
+	var got map[string]any
+	var header string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		header = r.Header.Get("x-tenant")
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &got)
+	}))
+	defer srv.Close()
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-tenant=factory")
+	t.Setenv("OTEL_SERVICE_NAME", "factory-test")
+	x, err := newOTLPExporterFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(0, 1700000000000000000)
+	span := TelemetrySpan{TraceID: randomHexID(16), SpanID: randomHexID(8), Name: "node a", Start: start, End: start.Add(time.Second),
+		Attributes: map[string]any{"node.id": "a", "attempt": 1}, Error: true, StatusMessage: "boom"}
+	if err := x.ExportSpans(context.Background(), []TelemetrySpan{span}); err != nil {
+		t.Fatal(err)
+	}
+	if header != "factory" {
+		t.Fatalf("missing configured header, got %q", header)
+	}
+	rs := got["resourceSpans"].([]any)[0].(map[string]any)
+	service := rs["resource"].(map[string]any)["attributes"].([]any)[0].(map[string]any)
+	if service["value"].(map[string]any)["stringValue"] != "factory-test" {
+		t.Fatalf("unexpected resource: %v", rs["resource"])
+	}
+	posted := rs["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)[0].(map[string]any)
+	if posted["startTimeUnixNano"] != "1700000000000000000" || posted["status"].(map[string]any)["code"] != float64(2) {
+		t.Fatalf("unexpected span payload: %v", posted)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	if _, err := newOTLPExporterFromEnv(); err == nil {
+		t.Fatal("expected grpc protocol to be rejected")
+	}
+}
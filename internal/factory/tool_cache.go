@@ -0,0 +1,266 @@
+package attractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// toolCacheFiles are the node artifacts a cache entry records and a hit
+// copies into the node dir.
+var toolCacheFiles = []string{"tool.stdout.txt", "tool.stderr.txt", "tool.exitcode.txt"}
+
+// toolCacheEntry is entry.json in <runsdir>/.cache/<key>/. Files maps each
+// path the node created or modified to its state; contents are stored under
+// files/ by hash.
+type toolCacheEntry struct {
+	Key         string                   `json:"key"`
+	RunID       string                   `json:"run_id"`
+	NodeID      string                   `json:"node_id"`
+	ToolCommand string                   `json:"tool_command"`
+	Inputs      map[string]string        `json:"inputs"`
+	Outcome     Outcome                  `json:"outcome"`
+	Diff        workspaceDiff            `json:"diff"`
+	Files       map[string]toolCacheFile `json:"files"`
+	CreatedAt   string                   `json:"created_at"`
+}
+
+type toolCacheFile struct {
+	Hash    string      `json:"hash,omitempty"`
+	Mode    fs.FileMode `json:"mode,omitempty"`
+	Symlink string      `json:"symlink,omitempty"`
+}
+
+// toolCacheEnabled reports whether node's result may be served from and
+// stored in the cache: cache=true on a tool node, unless the run passed
+// --no-cache.
+func (e *Engine) toolCacheEnabled(node *Node) bool {
+	return e.cacheDir != "" && handlerType(node) == "tool" && node.BoolAttr("cache", false)
+}
+
+// parseCacheInputs splits cache_inputs into workspace-relative globs. `**`
+// matches any number of path segments.
+func parseCacheInputs(node *Node) ([]string, error) {
+	return parseInputGlobs(node, "cache_inputs")
+}
+
+// parseInputGlobs splits the node's attr into workspace-relative globs.
+func parseInputGlobs(node *Node, attr string) ([]string, error) {
+	globs := uniqueNonEmpty(splitCSV(node.StringAttr(attr, "")))
+	for _, g := range globs {
+		if strings.HasPrefix(g, "/") || strings.Contains(g, "..") {
+			return nil, fmt.Errorf("%s entry must be a workspace-relative glob: %s", attr, g)
+		}
+		if _, err := path.Match(strings.ReplaceAll(g, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid %s glob %s: %w", attr, g, err)
+		}
+	}
+	return globs, nil
+}
+
+func validateToolCache(n *Node) error {
+	_, cache := n.Attrs["cache"]
+	_, inputs := n.Attrs["cache_inputs"]
+	if !cache && !inputs {
+		return nil
+	}
+	if handlerType(n) != "tool" {
+		return fmt.Errorf("node %s sets cache or cache_inputs but is not a tool node", n.ID)
+	}
+	if _, err := parseCacheInputs(n); err != nil {
+		return fmt.Errorf("node %s: %w", n.ID, err)
+	}
+	return nil
+}
+
+// matchCacheGlob matches a slash-separated path against a glob whose `**`
+// segments match zero or more segments.
+func matchCacheGlob(pattern, name string) bool {
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pat, name []string) bool {
+	if len(pat) == 0 {
+		return len(name) == 0
+	}
+	if pat[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchGlobSegments(pat[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pat[0], name[0]); !ok {
+		return false
+	}
+	return matchGlobSegments(pat[1:], name[1:])
+}
+
+// toolCacheKey hashes the resolved tool_command, tool_env,
+// tool_success_exit_codes, tool_path_prepend, whether fake tools are on,
+// hermetic_env with the passthrough names, a non-host tool_runner with its
+// image and network, and the hashes of workspace files matched by
+// cache_inputs in the pre-node snapshot.
+// It also returns the matched inputs.
+func (e *Engine) toolCacheKey(node *Node, before map[string]fileState) (string, map[string]string, error) {
+	globs, err := parseCacheInputs(node)
+	if err != nil {
+		return "", nil, err
+	}
+	inputs := map[string]string{}
+	for p, st := range before {
+		for _, g := range globs {
+			if matchCacheGlob(g, p) {
+				inputs[p] = st.Hash
+				break
+			}
+		}
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "tool-cache-v2\x00%s\x00%s\x00%s\x00%s\x00%t\x00", node.StringAttr("tool_command", ""), node.StringAttr("tool_env", ""), node.StringAttr("tool_success_exit_codes", ""), toolPathPrepend(node), e.fakeTools)
+	if hermeticEnvEnabled(e.Graph) {
+		fmt.Fprintf(h, "hermetic\x00%s\x00", strings.Join(toolEnvPassthrough(node), ","))
+	}
+	if r := toolRunnerFor(node); r.Name != "host" {
+		fmt.Fprintf(h, "runner\x00%s\x00%s\x00%t\x00", r.Name, r.Image, r.Network)
+	}
+	for _, p := range sortedKeys(inputs) {
+		fmt.Fprintf(h, "%s\x00%s\x00", p, inputs[p])
+	}
+	return hex.EncodeToString(h.Sum(nil)), inputs, nil
+}
+
+// replayToolCache serves node from the cache when an entry exists for key:
+// the recorded tool artifacts are copied into nodeDir and the recorded file
+// changes are applied to the workspace, so the caller's diff and guardrail
+// checks see them as if the command had run.
+func (e *Engine) replayToolCache(node *Node, nodeDir, key string) (Outcome, bool, error) {
+	dir := filepath.Join(e.cacheDir, key)
+	b, err := os.ReadFile(filepath.Join(dir, "entry.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Outcome{}, false, nil
+	}
+	if err != nil {
+		return Outcome{}, false, err
+	}
+	var entry toolCacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		e.Logger.Warn("ignoring unreadable tool cache entry", "node", node.ID, "key", key, "error", err)
+		return Outcome{}, false, nil
+	}
+	for _, name := range toolCacheFiles {
+		copyIfExists(filepath.Join(dir, name), filepath.Join(nodeDir, name))
+	}
+	for _, p := range entry.Diff.Deleted {
+		if err := os.Remove(filepath.Join(e.Workspace, filepath.FromSlash(p))); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Outcome{}, false, err
+		}
+	}
+	for _, p := range sortedKeys(entry.Files) {
+		f := entry.Files[p]
+		target := filepath.Join(e.Workspace, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return Outcome{}, false, err
+		}
+		_ = os.Remove(target)
+		if f.Symlink != "" {
+			if err := os.Symlink(f.Symlink, target); err != nil {
+				return Outcome{}, false, err
+			}
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, "files", f.Hash))
+		if err != nil {
+			return Outcome{}, false, fmt.Errorf("tool cache entry %s is missing content for %s: %w", key, p, err)
+		}
+		mode := f.Mode
+		if mode == 0 {
+			mode = 0o644
+		}
+		if err := os.WriteFile(target, content, mode); err != nil {
+			return Outcome{}, false, err
+		}
+	}
+	hit := map[string]any{"key": key, "source_run_id": entry.RunID, "source_node_id": entry.NodeID, "created_at": entry.CreatedAt}
+	if err := writeJSON(filepath.Join(nodeDir, "cache.hit.json"), hit); err != nil {
+		return Outcome{}, false, err
+	}
+	e.recordEvent(map[string]any{"schema_version": 1, "type": "CacheHit", "node_id": node.ID, "key": key, "source_run_id": entry.RunID, "at": time.Now().UTC().Format(time.RFC3339Nano)})
+	e.Logger.Info("tool result served from cache", "node", node.ID, "key", key, "source_run_id", entry.RunID)
+	return entry.Outcome, true, nil
+}
+
+// storeToolCache records a successful tool result under key. The entry is
+// assembled in a temporary dir and renamed into place, so concurrent runs
+// never see a partial entry; if another run stored the key first, its entry
+// is kept.
+func (e *Engine) storeToolCache(node *Node, nodeDir, key string, inputs map[string]string, out Outcome, diff workspaceDiff) error {
+	final := filepath.Join(e.cacheDir, key)
+	if _, err := os.Stat(final); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(e.cacheDir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(e.cacheDir, ".tmp-"+key[:12]+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	for _, name := range toolCacheFiles {
+		copyIfExists(filepath.Join(nodeDir, name), filepath.Join(tmp, name))
+	}
+	entry := toolCacheEntry{Key: key, RunID: e.RunID, NodeID: node.ID, ToolCommand: node.StringAttr("tool_command", ""), Inputs: inputs, Outcome: out, Diff: diff, Files: map[string]toolCacheFile{}, CreatedAt: time.Now().UTC().Format(time.RFC3339Nano)}
+	if err := os.MkdirAll(filepath.Join(tmp, "files"), 0o755); err != nil {
+		return err
+	}
+	for _, p := range append(append([]string{}, diff.Created...), diff.Modified...) {
+		src := filepath.Join(e.Workspace, filepath.FromSlash(p))
+		info, err := os.Lstat(src)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(src)
+			if err != nil {
+				return err
+			}
+			entry.Files[p] = toolCacheFile{Symlink: target}
+			continue
+		}
+		content, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+		if err := os.WriteFile(filepath.Join(tmp, "files", hash), content, 0o644); err != nil {
+			return err
+		}
+		entry.Files[p] = toolCacheFile{Hash: hash, Mode: info.Mode().Perm()}
+	}
+	if err := writeJSON(filepath.Join(tmp, "entry.json"), entry); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		if _, statErr := os.Stat(final); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	_ = e.appendTrace("CacheStored", map[string]any{"node_id": node.ID, "key": key, "inputs": len(inputs), "files": len(entry.Files)})
+	e.Logger.Info("tool result cached", "node", node.ID, "key", key)
+	return nil
+}
@@ -0,0 +1,151 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchCacheGlob(t *testing.T) {
+	cases := map[[2]string]bool{
+		{"go.sum", "go.sum"}:               true,
+		{"go.sum", "sub/go.sum"}:           false,
+		{"**/*.go", "main.go"}:             true,
+		{"**/*.go", "cmd/factory/main.go"}: true,
+		{"**/*.go", "main.go.txt"}:         false,
+		{"cmd/**", "cmd/factory/main.go"}:  true,
+		{"cmd/*.go", "cmd/factory/x.go"}:   false,
+	}
+	for c, want := range cases {
+		if got := matchCacheGlob(c[0], c[1]); got != want {
+			t.Fatalf("matchCacheGlob(%q, %q) = %v, want %v", c[0], c[1], got, want)
+		}
+	}
+}
+
+func TestToolCacheReplaysResultAcrossRuns(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "executions")
+	t.Setenv("TOOL_CACHE_COUNTER", counter)
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	vet [shape=parallelogram, cache=true, cache_inputs="go.sum,**/*.go", allowed_write_paths="out/", tool_command="echo run >> $TOOL_CACHE_COUNTER && mkdir -p out && echo built > out/result.txt && echo vet-ok"];
+	exit [shape=Msquare];
+	start -> vet -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "go.sum"), "sum\n")
+	writeFile(t, filepath.Join(workdir, "pkg/a.go"), "package pkg\n")
+	executions := func() int {
+		b, _ := os.ReadFile(counter)
+		return strings.Count(string(b), "run")
+	}
+	run := func(id string, noCache bool) string {
+		t.Helper()
+		if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: id, NoCache: noCache}); err != nil {
+			t.Fatal(err)
+		}
+		return filepath.Join(runsdir, id)
+	}
+
+	run("tc1", false)
+	if executions() != 1 {
+		t.Fatalf("executions = %d after first run", executions())
+	}
+	runDir := run("tc2", false)
+	if executions() != 1 || len(eventsOfType(t, runDir, "CacheHit")) != 1 {
+		t.Fatalf("second run was not served from cache (executions=%d)", executions())
+	}
+	if b, err := os.ReadFile(filepath.Join(runDir, "workspace", "out", "result.txt")); err != nil || string(b) != "built\n" {
+		t.Fatalf("replayed workspace file = %q (%v)", b, err)
+	}
+	if b, err := os.ReadFile(filepath.Join(runDir, "vet", "tool.stdout.txt")); err != nil || string(b) != "vet-ok\n" {
+		t.Fatalf("replayed stdout = %q (%v)", b, err)
+	}
+	diff := readStatusJSON(t, filepath.Join(runDir, "vet", "workspace.diff.json"))
+	if created, _ := diff["created"].([]any); len(created) != 1 || created[0] != "out/result.txt" {
+		t.Fatalf("replayed diff = %v", diff)
+	}
+	if hit := readStatusJSON(t, filepath.Join(runDir, "vet", "cache.hit.json")); hit["source_run_id"] != "tc1" {
+		t.Fatalf("cache.hit.json = %v", hit)
+	}
+
+	writeFile(t, filepath.Join(workdir, "pkg/a.go"), "package pkg\n\nvar X = 1\n")
+	run("tc3", false)
+	if executions() != 2 {
+		t.Fatalf("changed input did not miss the cache (executions=%d)", executions())
+	}
+	runDir = run("tc4", true)
+	if executions() != 3 || len(eventsOfType(t, runDir, "CacheHit")) != 0 {
+		t.Fatalf("--no-cache run was served from cache (executions=%d)", executions())
+	}
+}
+
+func TestToolCacheReplayIsGuardrailChecked(t *testing.T) {
+	cmd := `mkdir -p out && echo built > out/result.txt`
+	first := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=parallelogram, cache=true, allowed_write_paths="out/", tool_command="` + cmd + `"];
+	exit [shape=Msquare];
+	start -> build -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, first)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "tg1"}); err != nil {
+		t.Fatal(err)
+	}
+	second := strings.Replace(first, `allowed_write_paths="out/"`, `allowed_write_paths="other/"`, 1)
+	_ = RunPipeline(RunConfig{PipelineSource: second, Workdir: workdir, Runsdir: runsdir, RunID: "tg2"})
+	runDir := filepath.Join(runsdir, "tg2")
+	if len(eventsOfType(t, runDir, "CacheHit")) != 1 {
+		t.Fatal("expected a cache hit")
+	}
+	st := readStatusJSON(t, filepath.Join(runDir, "build", "status.json"))
+	if st["failure_code"] != string(FailureGuardrailWriteViolation) {
+		t.Fatalf("status = %v", st)
+	}
+}
+
+func TestValidateToolCache(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=box, cache=true];
+	b [shape=parallelogram, tool_command="true", cache=true, cache_inputs="../go.sum"];
+	exit [shape=Msquare];
+	start -> a -> b -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{"node a sets cache or cache_inputs but is not a tool node", "node b: cache_inputs entry must be a workspace-relative glob: ../go.sum"} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+}
+
+func TestToolCacheKeyCoversExitCodesAndPathPrepend(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=parallelogram, cache=true, tool_command="make"];
+	b [shape=parallelogram, cache=true, tool_command="make", tool_success_exit_codes="0,1"];
+	c [shape=parallelogram, cache=true, tool_command="make", tool_path_prepend="bin"];
+	exit [shape=Msquare];
+	start -> a -> b -> c -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Engine{Graph: g}
+	seen := map[string]string{}
+	for _, id := range []string{"a", "b", "c"} {
+		key, _, err := e.toolCacheKey(g.Nodes[id], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prev, ok := seen[key]; ok {
+			t.Fatalf("nodes %s and %s share cache key %s", prev, id, key)
+		}
+		seen[key] = id
+	}
+}
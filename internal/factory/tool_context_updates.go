@@ -0,0 +1,92 @@
+package attractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// toolContextUpdatesPath is where a tool command may leave context updates,
+// relative to the workspace. The engine consumes and deletes it after each
+// tool node.
+const toolContextUpdatesPath = ".attractor/context_updates.json"
+
+const (
+	toolContextUpdatesMaxBytes      = 64 << 10
+	toolContextUpdatesMaxKeys       = 64
+	toolContextUpdateMaxValueBytes  = 4 << 10
+	toolContextUpdatesInvalidPrefix = "tool_context_updates_invalid"
+)
+
+// clearToolContextUpdates removes a file left behind by an earlier node, so
+// a tool only ever contributes the updates it wrote itself.
+func clearToolContextUpdates(workspace string) {
+	_ = os.Remove(filepath.Join(workspace, filepath.FromSlash(toolContextUpdatesPath)))
+}
+
+// readToolContextUpdates consumes the tool's context updates file. It
+// returns nil when the tool wrote none, and an error describing the first
+// problem when the file is not a small, flat JSON object.
+func readToolContextUpdates(workspace string) (map[string]any, error) {
+	path := filepath.Join(workspace, filepath.FromSlash(toolContextUpdatesPath))
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(path)
+	if len(b) > toolContextUpdatesMaxBytes {
+		return nil, fmt.Errorf("%s is %d bytes (limit %d)", toolContextUpdatesPath, len(b), toolContextUpdatesMaxBytes)
+	}
+	var updates map[string]any
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if err := dec.Decode(&updates); err != nil || updates == nil || dec.More() {
+		return nil, fmt.Errorf("%s is not a JSON object", toolContextUpdatesPath)
+	}
+	if len(updates) > toolContextUpdatesMaxKeys {
+		return nil, fmt.Errorf("%s has %d keys (limit %d)", toolContextUpdatesPath, len(updates), toolContextUpdatesMaxKeys)
+	}
+	for _, k := range sortedKeys(updates) {
+		if strings.TrimSpace(k) == "" || k == "current_node" || k == "outcome" || strings.HasPrefix(k, "internal.") {
+			return nil, fmt.Errorf("%s: key %q is reserved", toolContextUpdatesPath, k)
+		}
+		switch v := updates[k].(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("%s: %s must be a string, number, boolean, or null, got %s", toolContextUpdatesPath, k, jsonValueType(v))
+		case string:
+			if len(v) > toolContextUpdateMaxValueBytes {
+				return nil, fmt.Errorf("%s: %s is %d bytes (limit %d)", toolContextUpdatesPath, k, len(v), toolContextUpdateMaxValueBytes)
+			}
+		}
+	}
+	return updates, nil
+}
+
+// mergeToolContextUpdates folds the tool's context updates file into out.
+// A malformed file fails the node; the merged keys are traced.
+func (e *Engine) mergeToolContextUpdates(node *Node, out *Outcome) {
+	updates, err := readToolContextUpdates(e.Workspace)
+	if err != nil {
+		out.Outcome = "fail"
+		out.FailureReason = toolContextUpdatesInvalidPrefix + ": " + err.Error()
+		out.FailureCode = FailureToolContextUpdatesInvalid
+		return
+	}
+	if len(updates) == 0 {
+		return
+	}
+	if out.ContextUpdates == nil {
+		out.ContextUpdates = map[string]any{}
+	}
+	for k, v := range updates {
+		out.ContextUpdates[k] = v
+	}
+	keys := sortedKeys(updates)
+	_ = e.appendTrace("ToolContextUpdatesMerged", map[string]any{"node_id": node.ID, "keys": keys, "context_updates": updates})
+	e.Logger.Info("merged tool context updates", "node", node.ID, "keys", strings.Join(keys, ","))
+}
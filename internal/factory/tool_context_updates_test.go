@@ -0,0 +1,81 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestToolContextUpdatesMergedIntoContext(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	cov [shape=parallelogram, allowed_write_paths="report.txt", tool_command="sh cov.sh"];
+	exit [shape=Msquare, require_context="coverage>=80,version=1.2"];
+	start -> cov -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "cov.sh"), `echo ok > report.txt
+echo '{"coverage": 87.5, "version": "1.2"}' > .attractor/context_updates.json
+`)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "tcu1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "tcu1")
+	if _, err := os.Stat(filepath.Join(runDir, "workspace", ".attractor", "context_updates.json")); !os.IsNotExist(err) {
+		t.Fatalf("context updates file was not consumed: %v", err)
+	}
+	st := readStatusJSON(t, filepath.Join(runDir, "cov", "status.json"))
+	if st["outcome"] != "success" {
+		t.Fatalf("writing under .attractor should not trip allowed_write_paths: %v", st)
+	}
+	updates, _ := st["context_updates"].(map[string]any)
+	if updates["coverage"] != 87.5 || updates["version"] != "1.2" {
+		t.Fatalf("context_updates = %v", st["context_updates"])
+	}
+	recs, err := TraceQuery(runDir, TraceQueryOptions{Types: []string{"ToolContextUpdatesMerged"}})
+	if err != nil || len(recs) != 1 || recs[0]["node_id"] != "cov" {
+		t.Fatalf("trace records = %v (%v)", recs, err)
+	}
+}
+
+func TestMalformedToolContextUpdatesFailNode(t *testing.T) {
+	for name, content := range map[string]string{
+		"not an object": `[1, 2]`,
+		"reserved key":  `{"internal.retry_count.x": 1}`,
+		"nested value":  `{"coverage": {"lines": 80}}`,
+		"oversized":     `{"log": "` + strings.Repeat("x", toolContextUpdateMaxValueBytes+1) + `"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			workspace := t.TempDir()
+			writeFile(t, filepath.Join(workspace, filepath.FromSlash(toolContextUpdatesPath)), content)
+			e := &Engine{Workspace: workspace, RunDir: t.TempDir(), Logger: newFactoryLogger()}
+			out := Outcome{Outcome: "success", ContextUpdates: map[string]any{}}
+			e.mergeToolContextUpdates(&Node{ID: "t"}, &out)
+			if out.Outcome != "fail" || out.FailureCode != FailureToolContextUpdatesInvalid || !strings.HasPrefix(out.FailureReason, "tool_context_updates_invalid: ") {
+				t.Fatalf("outcome = %+v", out)
+			}
+			if _, err := os.Stat(filepath.Join(workspace, filepath.FromSlash(toolContextUpdatesPath))); !os.IsNotExist(err) {
+				t.Fatalf("malformed file was not removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestStaleToolContextUpdatesAreCleared(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="true"];
+	exit [shape=Msquare];
+	start -> t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, ".attractor", "context_updates.json"), `{"stale": true}`)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "tcu2"}); err != nil {
+		t.Fatal(err)
+	}
+	st := readStatusJSON(t, filepath.Join(runsdir, "tcu2", "t", "status.json"))
+	if updates, _ := st["context_updates"].(map[string]any); len(updates) != 0 {
+		t.Fatalf("stale updates were merged: %v", updates)
+	}
+}
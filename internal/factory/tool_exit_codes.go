@@ -0,0 +1,73 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// parseToolSuccessExitCodes reads tool_success_exit_codes, the exit codes a
+// tool node treats as success. Without the attribute only 0 succeeds.
+func parseToolSuccessExitCodes(node *Node) (map[int]bool, error) {
+	raw := node.StringAttr("tool_success_exit_codes", "")
+	codes := map[int]bool{}
+	for _, part := range splitCSV(raw) {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || n > 255 {
+			return nil, fmt.Errorf("invalid tool_success_exit_codes entry %q (expected an exit code 0-255)", part)
+		}
+		codes[n] = true
+	}
+	if len(codes) == 0 {
+		codes[0] = true
+	}
+	return codes, nil
+}
+
+func validateToolExitCodes(n *Node) error {
+	_, success := n.Attrs["tool_success_exit_codes"]
+	if !success {
+		return nil
+	}
+	if handlerType(n) != "tool" {
+		return fmt.Errorf("node %s sets tool_success_exit_codes but is not a tool node", n.ID)
+	}
+	if _, mapped := n.Attrs["tool_exit_code_map"]; mapped {
+		return fmt.Errorf("node %s sets both tool_success_exit_codes and tool_exit_code_map; use one", n.ID)
+	}
+	if _, err := parseToolSuccessExitCodes(n); err != nil {
+		return fmt.Errorf("node %s: %w", n.ID, err)
+	}
+	return nil
+}
+
+// toolExitOutcome maps a tool exit code to an outcome. Codes listed in
+// tool_success_exit_codes succeed with no failure reason; the raw code is
+// still what tool.exitcode.txt records.
+func toolExitOutcome(node *Node, code int) Outcome {
+	out := Outcome{SchemaVersion: 1, Outcome: "success", SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}
+	codes, err := parseToolSuccessExitCodes(node)
+	if err != nil {
+		codes = map[int]bool{0: true}
+	}
+	if !codes[code] {
+		out.Outcome = "fail"
+		out.FailureReason = exitReason(code)
+		out.FailureCode = exitFailureCode(code)
+	}
+	return out
+}
+
+// withToolExitCode adds the recorded tool exit code to a stage event.
+func withToolExitCode(ev map[string]any, nodeDir string) map[string]any {
+	b, err := os.ReadFile(filepath.Join(nodeDir, "tool.exitcode.txt"))
+	if err != nil {
+		return ev
+	}
+	if code, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+		ev["tool_exit_code"] = code
+	}
+	return ev
+}
@@ -0,0 +1,82 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestToolSuccessExitCodes(t *testing.T) {
+	node := &Node{ID: "todos", Attrs: map[string]Value{"shape": "parallelogram", "tool_success_exit_codes": "0,1"}}
+	for _, tc := range []struct {
+		cmd     string
+		outcome string
+		reason  string
+	}{
+		{"exit 1", "success", ""},
+		{"exit 2", "fail", "tool_exit_code_2"},
+	} {
+		node.Attrs["tool_command"] = tc.cmd
+		nodeDir := t.TempDir()
+		out, err := toolHandler{}.Execute(node, Context{}, nil, nodeDir, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.Outcome != tc.outcome || out.FailureReason != tc.reason {
+			t.Fatalf("%s: outcome=%s reason=%q", tc.cmd, out.Outcome, out.FailureReason)
+		}
+		code, err := os.ReadFile(filepath.Join(nodeDir, "tool.exitcode.txt"))
+		if err != nil || strings.TrimSpace(string(code)) != strings.TrimPrefix(tc.cmd, "exit ") {
+			t.Fatalf("%s: tool.exitcode.txt = %q (%v)", tc.cmd, code, err)
+		}
+	}
+}
+
+func TestToolSuccessExitCodeRecordedOnEvent(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	todos [shape=parallelogram, tool_command="exit 1", tool_success_exit_codes="0,1"];
+	exit [shape=Msquare];
+	start -> todos;
+	todos -> exit [condition="outcome=success"];
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "te1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "te1")
+	for _, ev := range eventsOfType(t, runDir, "StageCompleted") {
+		if ev["node_id"] == "todos" {
+			if ev["tool_exit_code"] != float64(1) {
+				t.Fatalf("StageCompleted = %v", ev)
+			}
+			return
+		}
+	}
+	t.Fatal("no StageCompleted event for todos")
+}
+
+func TestValidateToolExitCodes(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="true", tool_success_exit_codes="0,1", tool_exit_code_map="1=success"];
+	b [shape=parallelogram, tool_command="true", tool_success_exit_codes="0,x"];
+	c [shape=box, tool_success_exit_codes="1"];
+	exit [shape=Msquare];
+	start -> a -> b -> c -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{
+		"node a sets both tool_success_exit_codes and tool_exit_code_map",
+		`node b: invalid tool_success_exit_codes entry "x"`,
+		"node c sets tool_success_exit_codes but is not a tool node",
+	} {
+		if !strings.Contains(msgs, want) {
+			t.Fatalf("missing %q in diagnostics:\n%s", want, msgs)
+		}
+	}
+}
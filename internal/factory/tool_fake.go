@@ -0,0 +1,69 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fakeToolHandler scripts tool nodes from test.tool_* attributes instead of
+// spawning sh. It writes the same artifacts as toolHandler so failure
+// summaries and guardrails see realistic output. It is selected with
+// RunConfig.FakeTools or ATTRACTION_FAKE_TOOLS=1.
+type fakeToolHandler struct{}
+
+func fakeToolsFromEnv() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("ATTRACTION_FAKE_TOOLS"))) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+func (fakeToolHandler) Execute(node *Node, _ Context, _ *Graph, nodeDir string, workspace string) (Outcome, error) {
+	outcome := strings.TrimSpace(node.StringAttr("test.tool_outcome", ""))
+	defaultCode := 0
+	if outcome == "fail" {
+		defaultCode = 1
+	}
+	code := node.IntAttr("test.tool_exit_code", defaultCode)
+	if outcome == "" {
+		outcome = toolExitOutcome(node, code).Outcome
+	}
+	for _, rel := range splitCSV(node.StringAttr("test.tool_touch_files", "")) {
+		target, err := fakeToolTouchPath(workspace, rel)
+		if err != nil {
+			return Outcome{}, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return Outcome{}, err
+		}
+		if err := os.WriteFile(target, []byte(fmt.Sprintf("written by fake tool %s\n", node.ID)), 0o644); err != nil {
+			return Outcome{}, err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(nodeDir, "tool.stdout.txt"), []byte(node.StringAttr("test.tool_stdout", "")), 0o644); err != nil {
+		return Outcome{}, err
+	}
+	if err := os.WriteFile(filepath.Join(nodeDir, "tool.stderr.txt"), []byte(node.StringAttr("test.tool_stderr", "")), 0o644); err != nil {
+		return Outcome{}, err
+	}
+	if err := os.WriteFile(filepath.Join(nodeDir, "tool.exitcode.txt"), []byte(fmt.Sprintf("%d\n", code)), 0o644); err != nil {
+		return Outcome{}, err
+	}
+	out := Outcome{SchemaVersion: 1, Outcome: outcome, SuggestedNextIDs: []string{}, ContextUpdates: map[string]any{}}
+	if outcome == "fail" {
+		out.FailureReason = exitReason(code)
+		out.FailureCode = exitFailureCode(code)
+	}
+	return out, nil
+}
+
+func fakeToolTouchPath(workspace, rel string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(rel))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("test.tool_touch_files path escapes workspace: %s", rel)
+	}
+	return filepath.Join(workspace, clean), nil
+}
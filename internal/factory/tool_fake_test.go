@@ -0,0 +1,94 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFakeToolsScriptOutputsWithoutSpawningShell(t *testing.T) {
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="definitely-not-a-binary --flag", "test.tool_stdout"="hello", "test.tool_stderr"="warn"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ft1", FakeTools: true}); err != nil {
+		t.Fatal(err)
+	}
+	nodeDir := filepath.Join(runsdir, "ft1", "t")
+	for name, want := range map[string]string{"tool.stdout.txt": "hello", "tool.stderr.txt": "warn", "tool.exitcode.txt": "0\n"} {
+		b, err := os.ReadFile(filepath.Join(nodeDir, name))
+		if err != nil || string(b) != want {
+			t.Fatalf("%s = %q (%v), want %q", name, b, err, want)
+		}
+	}
+	if st := readStatusJSON(t, filepath.Join(nodeDir, "status.json")); st["outcome"] != "success" {
+		t.Fatalf("outcome = %v", st["outcome"])
+	}
+}
+
+func TestFakeToolsExitCodeMapping(t *testing.T) {
+	cases := []struct {
+		attrs   string
+		outcome string
+		reason  string
+		code    string
+	}{
+		{`"test.tool_exit_code"=3`, "fail", "tool_exit_code_3", "3\n"},
+		{`"test.tool_outcome"="fail"`, "fail", "tool_exit_code_1", "1\n"},
+		{`"test.tool_outcome"="fail", "test.tool_exit_code"=127`, "fail", "tool_exit_code_127", "127\n"},
+		{`"test.tool_outcome"="success", "test.tool_exit_code"=2`, "success", "", "2\n"},
+	}
+	for i, tc := range cases {
+		dot := `digraph G {
+		start [shape=Mdiamond];
+		t [shape=parallelogram, tool_command="true", ` + tc.attrs + `];
+		exit [shape=Msquare];
+		start -> t;
+		t -> exit [condition="outcome=success"];
+		t -> exit [condition="outcome=fail"];
+		}`
+		workdir, runsdir, pipeline := setupRun(t, dot)
+		runID := "ft-map-" + string(rune('a'+i))
+		if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: runID, FakeTools: true}); err != nil {
+			t.Fatal(err)
+		}
+		nodeDir := filepath.Join(runsdir, runID, "t")
+		st := readStatusJSON(t, filepath.Join(nodeDir, "status.json"))
+		reason, _ := st["failure_reason"].(string)
+		if st["outcome"] != tc.outcome || reason != tc.reason {
+			t.Fatalf("%s: got outcome=%v reason=%q", tc.attrs, st["outcome"], reason)
+		}
+		if b, _ := os.ReadFile(filepath.Join(nodeDir, "tool.exitcode.txt")); string(b) != tc.code {
+			t.Fatalf("%s: exit code file = %q", tc.attrs, b)
+		}
+	}
+}
+
+func TestFakeToolsTouchFilesTriggerGuardrail(t *testing.T) {
+	t.Setenv("ATTRACTION_FAKE_TOOLS", "1")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	t [shape=parallelogram, tool_command="true", allowed_write_paths="out/", "test.tool_touch_files"="out/ok.txt,src/main.go"];
+	exit [shape=Msquare];
+	start -> t;
+	t -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ft3"}); err != nil {
+		t.Fatal(err)
+	}
+	st := readStatusJSON(t, filepath.Join(runsdir, "ft3", "t", "status.json"))
+	reason, _ := st["failure_reason"].(string)
+	if st["outcome"] != "fail" || !strings.Contains(reason, "src/main.go") || strings.Contains(reason, "out/ok.txt") {
+		t.Fatalf("expected guardrail failure on src/main.go, got %v %q", st["outcome"], reason)
+	}
+	b, err := os.ReadFile(filepath.Join(runsdir, "ft3", "manifest.json"))
+	if err != nil || !strings.Contains(string(b), `"fake_tools": true`) {
+		t.Fatalf("manifest should record fake_tools: %s", b)
+	}
+}
@@ -0,0 +1,214 @@
+package attractor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const toolMetaFile = "tool.meta.json"
+
+// toolVersionArgs is the short allowlist of executables whose version is
+// probed for tool.meta.json, with the arguments that print it.
+var toolVersionArgs = map[string][]string{
+	"go":      {"version"},
+	"node":    {"--version"},
+	"python":  {"--version"},
+	"python3": {"--version"},
+}
+
+const toolVersionTimeout = 5 * time.Second
+
+// shellBuiltins are command words that never resolve to an executable.
+var shellBuiltins = map[string]bool{"cd": true, "export": true, "set": true, "unset": true, "exit": true, "source": true, ".": true}
+
+// toolMeta is tool.meta.json: which executables a tool or verification node
+// ran, as resolved against the child's PATH.
+type toolMeta struct {
+	PathPrepend string           `json:"path_prepend,omitempty"`
+	Executables []toolExecutable `json:"executables"`
+}
+
+type toolExecutable struct {
+	Name    string `json:"name"`
+	Path    string `json:"path,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func toolPathPrepend(n *Node) string {
+	return strings.TrimSpace(n.StringAttr("tool_path_prepend", ""))
+}
+
+// validateToolPathPrepend checks tool_path_prepend is a workspace-relative
+// directory on a host-run tool or verification node.
+func validateToolPathPrepend(n *Node) []Diagnostic {
+	if _, ok := n.Attrs["tool_path_prepend"]; !ok {
+		return nil
+	}
+	if typ := handlerType(n); typ != "tool" && typ != "verification" {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets tool_path_prepend but is not a tool or verification node", n.ID)}}
+	}
+	dir := toolPathPrepend(n)
+	switch {
+	case dir == "":
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s has an empty tool_path_prepend", n.ID)}}
+	case strings.HasPrefix(dir, "/"):
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s tool_path_prepend contains absolute path: %s", n.ID, dir)}}
+	case strings.Contains(dir, ".."):
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s tool_path_prepend contains parent segment: %s", n.ID, dir)}}
+	case toolRunnerFor(n).Name == "docker":
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets tool_path_prepend with tool_runner=docker; set PATH in the image instead", n.ID)}}
+	}
+	return nil
+}
+
+// toolPathEnv is the PATH entry for a node's child processes: the
+// tool_path_prepend directory, made absolute, ahead of the factory's PATH.
+// It is nil when the node does not set tool_path_prepend.
+func toolPathEnv(n *Node, workspace string) ([]string, error) {
+	dir := toolPathPrepend(n)
+	if dir == "" {
+		return nil, nil
+	}
+	abs, err := filepath.Abs(filepath.Join(workspace, filepath.FromSlash(dir)))
+	if err != nil {
+		return nil, err
+	}
+	return []string{"PATH=" + abs + string(os.PathListSeparator) + os.Getenv("PATH")}, nil
+}
+
+// envValue returns the last value of key in env, or the factory's own value
+// when env does not set it, matching how exec.Cmd resolves duplicates.
+func envValue(env []string, key string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(env[i], "="); ok && k == key {
+			return v
+		}
+	}
+	return os.Getenv(key)
+}
+
+// lookPathIn is exec.LookPath against path instead of the factory's PATH.
+// Names with a slash resolve against dir.
+func lookPathIn(name, path, dir string) (string, error) {
+	if strings.Contains(name, "/") {
+		p := name
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		if isExecutableFile(p) {
+			return filepath.Abs(p)
+		}
+		return "", fmt.Errorf("%s is not an executable file", name)
+	}
+	for _, d := range filepath.SplitList(path) {
+		if d == "" {
+			d = "."
+		}
+		p := filepath.Join(d, name)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		if isExecutableFile(p) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in PATH", name)
+}
+
+func isExecutableFile(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && !info.IsDir() && info.Mode()&0o111 != 0
+}
+
+// toolCommandExecutables returns the first word of each simple command in a
+// tool_command, skipping env assignments and shell builtins. It reads plain
+// words only; anything it cannot tokenize is left out.
+func toolCommandExecutables(command string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	replacer := strings.NewReplacer("&&", "\n", "||", "\n", ";", "\n", "|", "\n")
+	for _, segment := range strings.Split(replacer.Replace(command), "\n") {
+		fields, err := splitCommandTokens(strings.TrimSpace(trimWrappingParens(strings.TrimSpace(segment))))
+		if err != nil {
+			continue
+		}
+		i := 0
+		for i < len(fields) && isEnvAssignmentToken(fields[i]) {
+			i++
+		}
+		if i >= len(fields) {
+			continue
+		}
+		name := fields[i]
+		if shellBuiltins[name] || seen[name] || strings.ContainsAny(name, "$`<>(){}") {
+			continue
+		}
+		seen[name] = true
+		out = append(out, name)
+	}
+	return out
+}
+
+// resolveToolExecutable resolves name against the child's PATH in env and
+// records its path, size, and, for allowlisted tools, its version.
+func resolveToolExecutable(name, dir string, env []string) toolExecutable {
+	exe := toolExecutable{Name: name}
+	p, err := lookPathIn(name, envValue(env, "PATH"), dir)
+	if err != nil {
+		exe.Error = err.Error()
+		return exe
+	}
+	exe.Path = p
+	if info, err := os.Stat(p); err == nil {
+		exe.Size = info.Size()
+	}
+	if args, ok := toolVersionArgs[filepath.Base(name)]; ok {
+		exe.Version = probeToolVersion(p, args, dir, env)
+	}
+	return exe
+}
+
+func probeToolVersion(path string, args []string, dir string, env []string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), toolVersionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(b)), "\n")
+	return strings.TrimSpace(line)
+}
+
+func writeToolMeta(nodeDir string, node *Node, exes []toolExecutable) error {
+	return writeJSON(filepath.Join(nodeDir, toolMetaFile), toolMeta{PathPrepend: toolPathPrepend(node), Executables: exes})
+}
+
+// withToolMeta records the resolved executables from tool.meta.json on a
+// stage event.
+func withToolMeta(ev map[string]any, nodeDir string) map[string]any {
+	b, err := os.ReadFile(filepath.Join(nodeDir, toolMetaFile))
+	if err != nil {
+		return ev
+	}
+	var meta toolMeta
+	if err := json.Unmarshal(b, &meta); err != nil || len(meta.Executables) == 0 {
+		return ev
+	}
+	tools := map[string]string{}
+	for _, exe := range meta.Executables {
+		tools[exe.Name] = exe.Path
+	}
+	ev["tools"] = tools
+	return ev
+}
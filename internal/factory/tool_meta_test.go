@@ -0,0 +1,100 @@
+package attractor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeExecutable writes a shell script stand-in for a toolchain binary.
+func writeExecutable(t *testing.T, path, script string) {
+	t.Helper()
+	writeFile(t, path, "#!/bin/sh\n"+script+"\n")
+	if err := os.Chmod(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readToolMeta(t *testing.T, nodeDir string) toolMeta {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(nodeDir, toolMetaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta toolMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		t.Fatal(err)
+	}
+	return meta
+}
+
+func TestToolPathPrependResolvesVendoredToolchain(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	build [shape=parallelogram, tool_path_prepend=".factory/bin", tool_command="cd . && go build ./... | cat"];
+	generate [shape=box, "test.verification_plan_json"="{\"files\":[],\"commands\":[\"go vet\"]}"];
+	verify [shape=parallelogram, type=verification, tool_path_prepend=".factory/bin", "verification.allowed_commands"="go vet"];
+	exit [shape=Msquare];
+	start -> build -> generate -> verify -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeExecutable(t, filepath.Join(workdir, ".factory", "bin", "go"), `if [ "$1" = version ]; then echo "go version go9.9 vendored"; else echo "vendored go $1"; fi`)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "tm1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "tm1")
+	wantPath, _ := filepath.Abs(filepath.Join(runDir, "workspace", ".factory", "bin", "go"))
+	for _, node := range []string{"build", "verify"} {
+		meta := readToolMeta(t, filepath.Join(runDir, node))
+		var goExe *toolExecutable
+		for i := range meta.Executables {
+			if meta.Executables[i].Name == "go" {
+				goExe = &meta.Executables[i]
+			}
+		}
+		if meta.PathPrepend != ".factory/bin" || goExe == nil || goExe.Path != wantPath || goExe.Version != "go version go9.9 vendored" || goExe.Size == 0 {
+			t.Fatalf("%s meta = %+v", node, meta)
+		}
+	}
+	if b, _ := os.ReadFile(filepath.Join(runDir, "build", "tool.stdout.txt")); string(b) != "vendored go build\n" {
+		t.Fatalf("build stdout = %q", b)
+	}
+	b, _ := os.ReadFile(filepath.Join(runDir, "verify", "verification.results.json"))
+	if !strings.Contains(string(b), "vendored go vet") {
+		t.Fatalf("verification did not run the vendored go: %s", b)
+	}
+	for _, ev := range eventsOfType(t, runDir, "StageCompleted") {
+		if ev["node_id"] == "build" {
+			if tools, _ := ev["tools"].(map[string]any); tools["go"] != wantPath || tools["cat"] == "" {
+				t.Fatalf("StageCompleted tools = %v", ev["tools"])
+			}
+		}
+	}
+}
+
+func TestToolCommandExecutables(t *testing.T) {
+	got := toolCommandExecutables(`cd sub && FOO=1 go test ./... | tee out.txt; (make lint) || "$CC" x`)
+	if strings.Join(got, ",") != "go,tee,make" {
+		t.Fatalf("executables = %v", got)
+	}
+}
+
+func TestValidateToolPathPrepend(t *testing.T) {
+	cases := map[string]string{
+		`t [shape=parallelogram, tool_command="go test", tool_path_prepend="/opt/bin"]`: "contains absolute path",
+		`t [shape=parallelogram, tool_command="go test", tool_path_prepend="../bin"]`:   "contains parent segment",
+		`t [shape=box, tool_path_prepend="bin"]`:                                        "is not a tool or verification node",
+	}
+	for node, want := range cases {
+		g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; ` + node + `; exit [shape=Msquare]; start -> t -> exit; }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, want) {
+			t.Fatalf("%s: diagnostics %q missing %q", node, msgs, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// containerWorkspace is where the docker runner mounts the run workspace.
+const containerWorkspace = "/workspace"
+
+// toolRunner is where a tool or verification node runs its commands:
+// tool_runner="host" (default) runs them directly, "docker" runs each one in
+// a fresh tool_image container with the workspace bind-mounted.
+type toolRunner struct {
+	Name    string
+	Image   string
+	Network bool
+	// Hermetic host commands get only the env passed to command, not the
+	// factory's environment (graph [hermetic_env=true]).
+	Hermetic bool
+}
+
+func toolRunnerFor(n *Node) toolRunner {
+	name := strings.ToLower(strings.TrimSpace(n.StringAttr("tool_runner", "host")))
+	if name == "" {
+		name = "host"
+	}
+	return toolRunner{Name: name, Image: strings.TrimSpace(n.StringAttr("tool_image", "")), Network: n.BoolAttr("tool_network", false)}
+}
+
+// dockerLookPath finds the docker CLI; tests replace it.
+var dockerLookPath = func() (string, error) { return exec.LookPath("docker") }
+
+// validateToolRunner checks tool_runner and its settings. Docker mode needs
+// an image and the docker CLI, so a missing docker fails before the run.
+func validateToolRunner(n *Node) []Diagnostic {
+	_, runner := n.Attrs["tool_runner"]
+	_, image := n.Attrs["tool_image"]
+	_, network := n.Attrs["tool_network"]
+	if !runner && !image && !network {
+		return nil
+	}
+	if typ := handlerType(n); typ != "tool" && typ != "verification" {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets tool_runner, tool_image, or tool_network but is not a tool or verification node", n.ID)}}
+	}
+	r := toolRunnerFor(n)
+	switch r.Name {
+	case "host":
+		if image || network {
+			return []Diagnostic{{Level: "WARN", Message: fmt.Sprintf("node %s sets tool_image or tool_network without tool_runner=docker; they are ignored", n.ID)}}
+		}
+		return nil
+	case "docker":
+	default:
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s has invalid tool_runner %q (expected host or docker)", n.ID, r.Name)}}
+	}
+	if r.Image == "" {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets tool_runner=docker without tool_image", n.ID)}}
+	}
+	if _, err := dockerLookPath(); err != nil {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("node %s sets tool_runner=docker but docker is not available: %v", n.ID, err)}}
+	}
+	return nil
+}
+
+// command builds the command that runs argv in dir with env added. dir must
+// be inside workspace. Host commands get limits through limitCommand; docker
+// maps them onto the container.
+func (r toolRunner) command(workspace, dir string, argv, env []string, limits resourceLimits) (*exec.Cmd, error) {
+	if r.Name != "docker" {
+		cmd := exec.Command(argv[0], argv[1:]...)
+		cmd.Dir = dir
+		if r.Hermetic {
+			cmd.Env = append([]string{}, env...)
+		} else if len(env) > 0 {
+			cmd.Env = append(os.Environ(), env...)
+		}
+		limitCommand(cmd, limits)
+		return cmd, nil
+	}
+	docker, err := dockerLookPath()
+	if err != nil {
+		return nil, fmt.Errorf("tool_runner=docker: %w", err)
+	}
+	args, err := r.dockerArgs(workspace, dir, argv, env, limits)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(docker, args...)
+	cmd.Dir = workspace
+	return cmd, nil
+}
+
+// commandDir is dir as the command sees it: unchanged on the host, under
+// /workspace in a container.
+func (r toolRunner) commandDir(workspace, dir string) (string, error) {
+	if r.Name != "docker" {
+		return dir, nil
+	}
+	abs, err := filepath.Abs(workspace)
+	if err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(abs, absDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("tool_runner=docker: working directory %s is outside the workspace", dir)
+	}
+	return filepath.ToSlash(filepath.Join(containerWorkspace, rel)), nil
+}
+
+func (r toolRunner) dockerArgs(workspace, dir string, argv, env []string, limits resourceLimits) ([]string, error) {
+	abs, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := r.commandDir(workspace, dir)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"run", "--rm", "-v", abs + ":" + containerWorkspace, "-w", wd}
+	if !r.Network {
+		args = append(args, "--network", "none")
+	}
+	// Run as the invoking user so files the command writes can be diffed,
+	// copied, and cleaned up like host-run output.
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	if limits.MemoryBytes > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%d", limits.MemoryBytes))
+	}
+	if limits.CPUSeconds > 0 {
+		args = append(args, "--ulimit", fmt.Sprintf("cpu=%d:%d", limits.CPUSeconds, limits.CPUSeconds))
+	}
+	for _, kv := range env {
+		args = append(args, "-e", kv)
+	}
+	args = append(args, r.Image)
+	return append(args, argv...), nil
+}
+
+// withToolRunner records the runner of tool and verification nodes on a
+// stage event.
+func withToolRunner(ev map[string]any, node *Node) map[string]any {
+	if typ := handlerType(node); typ != "tool" && typ != "verification" {
+		return ev
+	}
+	r := toolRunnerFor(node)
+	ev["runner"] = r.Name
+	if r.Name == "docker" {
+		ev["tool_image"] = r.Image
+	}
+	return ev
+}
@@ -0,0 +1,134 @@
+package attractor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeDocker installs a docker stand-in that logs its arguments and runs the
+// command on the host in the directory -v and -w map to.
+func fakeDocker(t *testing.T) (logPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	logPath = filepath.Join(dir, "docker.log")
+	script := `#!/bin/sh
+echo "$@" >> "` + logPath + `"
+shift
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --rm) shift ;;
+    -v) src="${2%%:*}"; shift 2 ;;
+    -w) wd="$2"; shift 2 ;;
+    -e) export "$2"; shift 2 ;;
+    --network|--user|--memory|--ulimit) shift 2 ;;
+    *) break ;;
+  esac
+done
+shift
+cd "$src${wd#/workspace}" && exec "$@"
+`
+	path := filepath.Join(dir, "docker")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	prev := dockerLookPath
+	dockerLookPath = func() (string, error) { return path, nil }
+	t.Cleanup(func() { dockerLookPath = prev })
+	return logPath
+}
+
+func TestDockerToolRunnerMatchesHostRunner(t *testing.T) {
+	logPath := fakeDocker(t)
+	run := func(runner, id string) string {
+		dot := `digraph G {
+		start [shape=Mdiamond];
+		t [shape=parallelogram, ` + runner + ` tool_command="echo out; echo err >&2; echo built > out.txt; exit 3"];
+		exit [shape=Msquare];
+		start -> t;
+		t -> exit [condition="outcome=fail"];
+		}`
+		workdir, runsdir, pipeline := setupRun(t, dot)
+		if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: id}); err != nil {
+			t.Fatal(err)
+		}
+		return filepath.Join(runsdir, id)
+	}
+	host := run("", "host")
+	docker := run(`tool_runner="docker", tool_image="golang:1.22", tool_max_memory="1GB",`, "docker")
+	for _, name := range []string{"tool.stdout.txt", "tool.stderr.txt", "tool.exitcode.txt", "workspace.diff.json"} {
+		a, errA := os.ReadFile(filepath.Join(host, "t", name))
+		b, errB := os.ReadFile(filepath.Join(docker, "t", name))
+		if errA != nil || errB != nil || string(a) != string(b) {
+			t.Fatalf("%s differs between runners:\nhost:   %s (%v)\ndocker: %s (%v)", name, a, errA, b, errB)
+		}
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"run --rm -v ", ":/workspace -w /workspace ", "--network none", "--memory 1073741824", "golang:1.22 sh -c echo out"} {
+		if !strings.Contains(string(log), want) {
+			t.Fatalf("docker args missing %q:\n%s", want, log)
+		}
+	}
+	for _, c := range []struct{ runDir, runner string }{{host, "host"}, {docker, "docker"}} {
+		for _, typ := range []string{"StageStarted", "StageFailed"} {
+			for _, ev := range eventsOfType(t, c.runDir, typ) {
+				if ev["node_id"] == "t" && ev["runner"] != c.runner {
+					t.Fatalf("%s runner = %v, want %s", typ, ev["runner"], c.runner)
+				}
+			}
+		}
+	}
+	if evs := eventsOfType(t, docker, "StageStarted"); evs[0]["runner"] != nil {
+		t.Fatalf("start node recorded a runner: %v", evs[0])
+	}
+}
+
+func TestDockerVerificationRunsInContainerWorkdir(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	logPath := fakeDocker(t)
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	generate [shape=box, "test.verification_plan_json"="{\"files\":[],\"commands\":[\"DIR=$PWD echo ok\"]}"];
+	verify [shape=parallelogram, type=verification, tool_runner="docker", tool_image="alpine", tool_network=true, "verification.workdir"="sub", "verification.allowed_commands"="echo"];
+	exit [shape=Msquare];
+	start -> generate -> verify -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "sub", "keep.txt"), "x")
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "dv1"}); err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(log), "-w /workspace/sub") || !strings.Contains(string(log), "-e DIR=/workspace/sub alpine echo ok") || strings.Contains(string(log), "--network") {
+		t.Fatalf("docker args = %s", log)
+	}
+}
+
+func TestValidateToolRunner(t *testing.T) {
+	prev := dockerLookPath
+	dockerLookPath = func() (string, error) { return "", errors.New(`exec: "docker": executable file not found in $PATH`) }
+	t.Cleanup(func() { dockerLookPath = prev })
+	cases := map[string]string{
+		`t [shape=parallelogram, tool_command="true", tool_runner="docker", tool_image="alpine"]`: "docker is not available",
+		`t [shape=parallelogram, tool_command="true", tool_runner="docker"]`:                      "without tool_image",
+		`t [shape=parallelogram, tool_command="true", tool_runner="podman"]`:                      `invalid tool_runner "podman"`,
+		`t [shape=box, tool_runner="docker", tool_image="alpine"]`:                                "is not a tool or verification node",
+	}
+	for node, want := range cases {
+		g, err := ParseDOT(`digraph G { start [shape=Mdiamond]; ` + node + `; exit [shape=Msquare]; start -> t -> exit; }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, want) {
+			t.Fatalf("%s: diagnostics %q missing %q", node, msgs, want)
+		}
+	}
+}
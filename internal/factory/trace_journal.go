@@ -0,0 +1,363 @@
+package attractor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	traceFile      = "trace.jsonl"
+	traceIndexFile = "trace.index.jsonl"
+	// defaultTraceRotateBytes is the segment size at which the journal starts
+	// a new trace file; trace.rotate_bytes on the graph overrides it.
+	defaultTraceRotateBytes = 64 << 20
+)
+
+// traceSegmentRe matches rotated segments: trace.1.jsonl, trace.2.jsonl, ...
+var traceSegmentRe = regexp.MustCompile(`^trace\.([0-9]+)\.jsonl$`)
+
+// traceIndexEntry is one line of trace.index.jsonl: where a record starts, so
+// readers can seek to it without scanning every segment.
+type traceIndexEntry struct {
+	Type   string `json:"type"`
+	NodeID string `json:"node_id,omitempty"`
+	At     string `json:"at"`
+	File   string `json:"file"`
+	Offset int64  `json:"offset"`
+}
+
+// traceJournal appends trace records for one run through file handles held
+// open for the run. Segments are never renamed: trace.jsonl is the first,
+// trace.<n>.jsonl follow, and records always go to the highest-numbered one,
+// so index entries stay valid after rotation.
+type traceJournal struct {
+	mu       sync.Mutex
+	runDir   string
+	maxBytes int64
+	seg      int
+	f        *os.File
+	size     int64
+	index    *os.File
+}
+
+var (
+	traceJournalsMu sync.Mutex
+	traceJournals   = map[string]*traceJournal{}
+)
+
+func traceSegmentName(seg int) string {
+	if seg == 0 {
+		return traceFile
+	}
+	return fmt.Sprintf("trace.%d.jsonl", seg)
+}
+
+// traceSegments lists the run's trace files oldest first. A run without a
+// trace yields nil.
+func traceSegments(runDir string) ([]string, error) {
+	entries, err := os.ReadDir(runDir)
+	if err != nil {
+		return nil, err
+	}
+	nums := []int{}
+	base := false
+	for _, ent := range entries {
+		if ent.Name() == traceFile {
+			base = true
+			continue
+		}
+		if m := traceSegmentRe.FindStringSubmatch(ent.Name()); m != nil {
+			if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+				nums = append(nums, n)
+			}
+		}
+	}
+	sort.Ints(nums)
+	out := []string{}
+	if base {
+		out = append(out, filepath.Join(runDir, traceFile))
+	}
+	for _, n := range nums {
+		out = append(out, filepath.Join(runDir, traceSegmentName(n)))
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// openTraceJournal opens the run's newest segment for appending; a resumed
+// run continues where the previous process stopped.
+func openTraceJournal(runDir string, maxBytes int64) (*traceJournal, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultTraceRotateBytes
+	}
+	segs, err := traceSegments(runDir)
+	if err != nil {
+		return nil, err
+	}
+	j := &traceJournal{runDir: runDir, maxBytes: maxBytes}
+	if len(segs) > 0 {
+		if m := traceSegmentRe.FindStringSubmatch(filepath.Base(segs[len(segs)-1])); m != nil {
+			j.seg, _ = strconv.Atoi(m[1])
+		}
+	}
+	if err := j.openSegment(); err != nil {
+		return nil, err
+	}
+	j.index, err = os.OpenFile(filepath.Join(runDir, traceIndexFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		j.f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *traceJournal) openSegment() error {
+	f, err := os.OpenFile(filepath.Join(j.runDir, traceSegmentName(j.seg)), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	j.f, j.size = f, info.Size()
+	return nil
+}
+
+// startTraceJournal opens the journal for runDir and routes appendTrace
+// through it until the returned journal is closed.
+func startTraceJournal(runDir string, maxBytes int64) (*traceJournal, error) {
+	j, err := openTraceJournal(runDir, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	traceJournalsMu.Lock()
+	traceJournals[runDir] = j
+	traceJournalsMu.Unlock()
+	return j, nil
+}
+
+func (j *traceJournal) close() error {
+	traceJournalsMu.Lock()
+	if traceJournals[j.runDir] == j {
+		delete(traceJournals, j.runDir)
+	}
+	traceJournalsMu.Unlock()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.f.Close()
+	if ierr := j.index.Close(); err == nil {
+		err = ierr
+	}
+	return err
+}
+
+// append writes rec to the current segment, starting a new segment first if
+// the record would push a non-empty one past maxBytes, then indexes it.
+func (j *traceJournal) append(rec map[string]any) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.size > 0 && j.size+int64(len(b)) > j.maxBytes {
+		if err := j.f.Close(); err != nil {
+			return err
+		}
+		j.seg++
+		if err := j.openSegment(); err != nil {
+			return err
+		}
+	}
+	offset := j.size
+	n, err := j.f.Write(b)
+	j.size += int64(n)
+	if err != nil {
+		return err
+	}
+	ib, err := json.Marshal(newTraceIndexEntry(rec, traceSegmentName(j.seg), offset))
+	if err != nil {
+		return err
+	}
+	_, err = j.index.Write(append(ib, '\n'))
+	return err
+}
+
+func newTraceIndexEntry(rec map[string]any, file string, offset int64) traceIndexEntry {
+	entry := traceIndexEntry{File: file, Offset: offset}
+	entry.Type, _ = rec["type"].(string)
+	entry.At, _ = rec["at"].(string)
+	entry.NodeID = traceRecordNodeID(rec)
+	return entry
+}
+
+// traceRecordNodeID is the node an index entry is filed under: node_id, or
+// from_node for route records.
+func traceRecordNodeID(rec map[string]any) string {
+	if id, ok := rec["node_id"].(string); ok {
+		return id
+	}
+	id, _ := rec["from_node"].(string)
+	return id
+}
+
+// rebuildTraceIndex rewrites trace.index.jsonl from the trace segments. The
+// doctor calls it after it changed a segment, since stripping a line moves
+// every record after it. Lines that are not JSON are left out.
+func rebuildTraceIndex(runDir string) error {
+	segs, err := traceSegments(runDir)
+	if err != nil {
+		return err
+	}
+	var out []byte
+	for _, p := range segs {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		offset := int64(0)
+		for len(b) > 0 {
+			line := b
+			if i := bytes.IndexByte(b, '\n'); i >= 0 {
+				line = b[:i+1]
+			}
+			rec := map[string]any{}
+			if json.Unmarshal(line, &rec) == nil {
+				ib, err := json.Marshal(newTraceIndexEntry(rec, filepath.Base(p), offset))
+				if err != nil {
+					return err
+				}
+				out = append(append(out, ib...), '\n')
+			}
+			offset += int64(len(line))
+			b = b[len(line):]
+		}
+	}
+	path := filepath.Join(runDir, traceIndexFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// traceRotateBytes is trace.rotate_bytes from the graph, or the default.
+func traceRotateBytes(g *Graph) int64 {
+	return int64(graphIntAttr(g, "trace.rotate_bytes", defaultTraceRotateBytes))
+}
+
+func validateTraceRotation(g *Graph) []Diagnostic {
+	raw, ok := g.Attrs["trace.rotate_bytes"]
+	if !ok {
+		return nil
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(fmt.Sprintf("%v", raw))); err != nil || n <= 0 {
+		return []Diagnostic{{Level: "ERROR", Message: fmt.Sprintf("graph has invalid trace.rotate_bytes: %v (expected a positive integer)", raw)}}
+	}
+	return nil
+}
+
+// readTraceIndex returns the run's index entries, or nil when the run has no
+// index (runs written before the journal).
+func readTraceIndex(runDir string) ([]traceIndexEntry, error) {
+	f, err := os.Open(filepath.Join(runDir, traceIndexFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := []traceIndexEntry{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var entry traceIndexEntry
+		if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+			continue
+		}
+		out = append(out, entry)
+	}
+	return out, sc.Err()
+}
+
+// errStaleTraceIndex marks an index entry that no longer points at its
+// record; callers fall back to scanning the segments.
+var errStaleTraceIndex = errors.New("stale trace index")
+
+// readTraceRecordAt decodes the record an index entry points to. It fails
+// with errStaleTraceIndex when the offset holds no record, or one of another
+// type or node.
+func readTraceRecordAt(runDir string, entry traceIndexEntry) (map[string]any, error) {
+	f, err := os.Open(filepath.Join(runDir, filepath.Base(entry.File)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(entry.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	line, err := bufio.NewReaderSize(f, 64*1024).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	rec := map[string]any{}
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return nil, fmt.Errorf("%w: unreadable record in %s at offset %d: %v", errStaleTraceIndex, entry.File, entry.Offset, err)
+	}
+	if rec["type"] != entry.Type || traceRecordNodeID(rec) != entry.NodeID {
+		return nil, fmt.Errorf("%w: %s at offset %d holds %v, not %s", errStaleTraceIndex, entry.File, entry.Offset, rec["type"], entry.Type)
+	}
+	return rec, nil
+}
+
+// scanTraceRecords calls fn for every record across all segments in order.
+func scanTraceRecords(runDir string, fn func(map[string]any)) error {
+	segs, err := traceSegments(runDir)
+	if err != nil {
+		return err
+	}
+	for _, p := range segs {
+		if err := scanTraceFile(p, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanTraceFile(p string, fn func(map[string]any)) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		rec := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			continue
+		}
+		fn(rec)
+	}
+	return sc.Err()
+}
@@ -0,0 +1,116 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTraceJournalRotatesAndIndexes(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	graph ["trace.rotate_bytes"=400];
+	start [shape=Mdiamond];
+	a [shape=box];
+	b [shape=box];
+	c [shape=box];
+	exit [shape=Msquare];
+	start -> a -> b -> c -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "tj1"}); err != nil {
+		t.Fatal(err)
+	}
+	runDir := filepath.Join(runsdir, "tj1")
+	segs, err := traceSegments(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) < 3 || filepath.Base(segs[0]) != "trace.jsonl" || filepath.Base(segs[1]) != "trace.1.jsonl" {
+		t.Fatalf("expected rotated segments, got %v", segs)
+	}
+	records := []map[string]any{}
+	for _, p := range segs {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs := readJSONLRecords(t, p)
+		if len(recs) > 1 && info.Size() > 400 {
+			t.Fatalf("%s holds %d records in %d bytes, over the rotation threshold", p, len(recs), info.Size())
+		}
+		records = append(records, recs...)
+	}
+	if records[0]["type"] != "SessionInitialized" {
+		t.Fatalf("first record = %v", records[0])
+	}
+
+	index, err := readTraceIndex(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != len(records) {
+		t.Fatalf("index has %d entries for %d records", len(index), len(records))
+	}
+	for i, entry := range index {
+		rec, err := readTraceRecordAt(runDir, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec["type"] != entry.Type || rec["at"] != records[i]["at"] || rec["type"] != records[i]["type"] {
+			t.Fatalf("index entry %d (%+v) points at %v", i, entry, rec)
+		}
+	}
+
+	out, err := ExplainRoute(runDir, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "recorded next_node: c") {
+		t.Fatalf("explain did not find the rotated route record:\n%s", out)
+	}
+	if err := os.Remove(filepath.Join(runDir, "trace.index.jsonl")); err != nil {
+		t.Fatal(err)
+	}
+	if rec, found, err := lastRouteRecord(runDir, "a"); err != nil || !found || rec["next_node"] != "b" {
+		t.Fatalf("scan without index = %v %v %v", rec, found, err)
+	}
+}
+
+func TestTraceJournalResumeAppendsToNewestSegment(t *testing.T) {
+	runDir := t.TempDir()
+	j, err := openTraceJournal(runDir, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := j.append(map[string]any{"type": "Step", "node_id": "n", "pad": strings.Repeat("x", 60)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendTrace(runDir, "After", map[string]any{"node_id": "m"}); err != nil {
+		t.Fatal(err)
+	}
+	index, err := readTraceIndex(runDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := index[len(index)-1]
+	if len(index) != 5 || last.File != "trace.3.jsonl" || last.NodeID != "m" || last.Offset == 0 {
+		t.Fatalf("index = %+v", index)
+	}
+}
+
+func TestValidateTraceRotation(t *testing.T) {
+	g, err := ParseDOT(`digraph G { graph ["trace.rotate_bytes"=0]; start [shape=Mdiamond]; exit [shape=Msquare]; start -> exit; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs := diagnosticMessages(ValidateGraph(g)); !strings.Contains(msgs, "invalid trace.rotate_bytes: 0") {
+		t.Fatalf("diagnostics:\n%s", msgs)
+	}
+}
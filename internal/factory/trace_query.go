@@ -0,0 +1,212 @@
+package attractor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TraceQueryOptions filters and projects trace records.
+type TraceQueryOptions struct {
+	// Node keeps records whose node_id (from_node for RouteEvaluated) is Node.
+	Node string
+	// Types keeps records of any of these types.
+	Types []string
+	// Since and Until bound the record's at time; zero values are open.
+	Since time.Time
+	Until time.Time
+	// Fields projects each record to type, node_id, at, and these keys.
+	Fields []string
+}
+
+// traceTerminalTypes end a followed trace.
+var traceTerminalTypes = map[string]bool{"PipelineCompleted": true, "PipelineFailed": true, "PipelineStopped": true, "PipelineAborted": true}
+
+// TraceQuery returns the run's trace records that match opts, oldest first,
+// reading through every rotated segment. Malformed lines are skipped.
+func TraceQuery(runDir string, opts TraceQueryOptions) ([]map[string]any, error) {
+	out := []map[string]any{}
+	err := scanTraceRecords(runDir, func(rec map[string]any) {
+		if opts.match(rec) {
+			out = append(out, opts.project(rec))
+		}
+	})
+	return out, err
+}
+
+func traceRecordNode(rec map[string]any) string {
+	if id, ok := rec["node_id"].(string); ok {
+		return id
+	}
+	id, _ := rec["from_node"].(string)
+	return id
+}
+
+func (o TraceQueryOptions) match(rec map[string]any) bool {
+	if o.Node != "" && traceRecordNode(rec) != o.Node {
+		return false
+	}
+	if len(o.Types) > 0 {
+		typ, _ := rec["type"].(string)
+		found := false
+		for _, t := range o.Types {
+			if t == typ {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !o.Since.IsZero() || !o.Until.IsZero() {
+		at, err := time.Parse(time.RFC3339Nano, fmt.Sprintf("%v", rec["at"]))
+		if err != nil {
+			return false
+		}
+		if !o.Since.IsZero() && at.Before(o.Since) {
+			return false
+		}
+		if !o.Until.IsZero() && at.After(o.Until) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o TraceQueryOptions) project(rec map[string]any) map[string]any {
+	if len(o.Fields) == 0 {
+		return rec
+	}
+	out := map[string]any{}
+	for _, k := range append([]string{"type", "node_id", "at"}, o.Fields...) {
+		if v, ok := rec[k]; ok {
+			out[k] = v
+		}
+	}
+	if _, ok := out["node_id"]; !ok {
+		if id := traceRecordNode(rec); id != "" {
+			out["node_id"] = id
+		}
+	}
+	return out
+}
+
+// TraceOptions configures RunTrace.
+type TraceOptions struct {
+	Query TraceQueryOptions
+	// JSON writes matching records as NDJSON instead of one formatted line
+	// each.
+	JSON bool
+	// Follow keeps polling, across rotations, until the pipeline finishes or
+	// ctx is cancelled.
+	Follow       bool
+	PollInterval time.Duration
+}
+
+// RunTrace writes the run's matching trace records to w.
+func RunTrace(ctx context.Context, runDir string, opts TraceOptions, w io.Writer) error {
+	if _, err := os.Stat(runDir); err != nil {
+		return err
+	}
+	if err := checkRunLayout(runDir); err != nil {
+		return err
+	}
+	if !opts.Follow {
+		recs, err := TraceQuery(runDir, opts.Query)
+		if err != nil {
+			return err
+		}
+		for _, rec := range recs {
+			if err := writeTraceRecord(w, rec, opts.JSON); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultLogsPollInterval
+	}
+	seg := 0
+	follower := &fileFollower{path: filepath.Join(runDir, traceSegmentName(seg))}
+	for {
+		// A newer segment means the current one is complete.
+		_, statErr := os.Stat(filepath.Join(runDir, traceSegmentName(seg+1)))
+		rotated := statErr == nil
+		lines, err := follower.next(rotated)
+		if err != nil {
+			return err
+		}
+		done := false
+		for _, line := range lines {
+			rec := map[string]any{}
+			if json.Unmarshal([]byte(line), &rec) != nil {
+				continue
+			}
+			if typ, _ := rec["type"].(string); traceTerminalTypes[typ] {
+				done = true
+			}
+			if !opts.Query.match(rec) {
+				continue
+			}
+			if err := writeTraceRecord(w, opts.Query.project(rec), opts.JSON); err != nil {
+				return err
+			}
+		}
+		if rotated {
+			seg++
+			follower = &fileFollower{path: filepath.Join(runDir, traceSegmentName(seg))}
+			continue
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// writeTraceRecord writes rec as one NDJSON line, or as
+// "<at> <type> [<node>] key=value ..." with values JSON-encoded.
+func writeTraceRecord(w io.Writer, rec map[string]any, asJSON bool) error {
+	if asJSON {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	}
+	parts := []string{fmt.Sprintf("%v", rec["at"]), fmt.Sprintf("%v", rec["type"])}
+	if id := traceRecordNode(rec); id != "" {
+		parts = append(parts, "["+id+"]")
+	}
+	keys := []string{}
+	for k := range rec {
+		switch k {
+		case "at", "type", "node_id", "schema_version":
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b, err := json.Marshal(rec[k])
+		if err != nil {
+			b = []byte(fmt.Sprintf("%q", fmt.Sprintf("%v", rec[k])))
+		}
+		parts = append(parts, k+"="+string(b))
+	}
+	_, err := fmt.Fprintln(w, strings.Join(parts, " "))
+	return err
+}
@@ -0,0 +1,119 @@
+package attractor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSyntheticTrace writes interleaved records for nodes a and b across a
+// rotated segment, ending with a malformed and a truncated line.
+func writeSyntheticTrace(t *testing.T, runDir string) {
+	t.Helper()
+	writeFile(t, filepath.Join(runDir, "trace.jsonl"), strings.Join([]string{
+		`{"type":"NodeInputCaptured","node_id":"a","at":"2026-01-01T00:00:01Z","node_shape":"box"}`,
+		`{"type":"NodeInputCaptured","node_id":"b","at":"2026-01-01T00:00:02Z"}`,
+		`{"type":"NodeOutputCaptured","node_id":"a","at":"2026-01-01T00:00:03Z","outcome":"success","context_delta":{"x":1},"context_after":{"x":1}}`,
+		``,
+	}, "\n"))
+	writeFile(t, filepath.Join(runDir, "trace.1.jsonl"), strings.Join([]string{
+		`{"type":"RouteEvaluated","from_node":"a","at":"2026-01-01T00:00:04Z","next_node":"b"}`,
+		`{"type":"NodeOutputCaptured","node_id":"b","at":"2026-01-01T00:00:05Z","outcome":"fail","context_delta":{}}`,
+		`{"type":"NodeOutputCaptured","node_id":"a","at":"2026-01-01T00:00:06Z","outcome":"success","context_delta":{"y":2}}`,
+		`not json`,
+		`{"type":"NodeOutputCaptured","node_id":"a","at":"2026-01-01T00:0`,
+	}, "\n"))
+}
+
+func TestTraceQueryFiltersAcrossSegments(t *testing.T) {
+	runDir := t.TempDir()
+	writeSyntheticTrace(t, runDir)
+
+	recs, err := TraceQuery(runDir, TraceQueryOptions{Node: "a", Types: []string{"NodeOutputCaptured"}, Fields: []string{"context_delta", "outcome"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0]["at"] != "2026-01-01T00:00:03Z" || recs[1]["at"] != "2026-01-01T00:00:06Z" {
+		t.Fatalf("records = %v", recs)
+	}
+	if _, ok := recs[0]["context_after"]; ok || recs[0]["outcome"] != "success" || recs[0]["context_delta"] == nil {
+		t.Fatalf("projection = %v", recs[0])
+	}
+
+	recs, err = TraceQuery(runDir, TraceQueryOptions{Node: "a", Types: []string{"RouteEvaluated"}})
+	if err != nil || len(recs) != 1 || recs[0]["next_node"] != "b" {
+		t.Fatalf("route records matched by from_node = %v (%v)", recs, err)
+	}
+
+	since, _ := time.Parse(time.RFC3339, "2026-01-01T00:00:02Z")
+	until, _ := time.Parse(time.RFC3339, "2026-01-01T00:00:04Z")
+	recs, err = TraceQuery(runDir, TraceQueryOptions{Since: since, Until: until})
+	if err != nil || len(recs) != 3 {
+		t.Fatalf("time range = %v (%v)", recs, err)
+	}
+}
+
+func TestRunTraceOutputFormats(t *testing.T) {
+	runDir := t.TempDir()
+	writeSyntheticTrace(t, runDir)
+	opts := TraceOptions{Query: TraceQueryOptions{Node: "b", Fields: []string{"outcome"}}}
+	var pretty bytes.Buffer
+	if err := RunTrace(context.Background(), runDir, opts, &pretty); err != nil {
+		t.Fatal(err)
+	}
+	want := "2026-01-01T00:00:02Z NodeInputCaptured [b]\n2026-01-01T00:00:05Z NodeOutputCaptured [b] outcome=\"fail\"\n"
+	if pretty.String() != want {
+		t.Fatalf("pretty output:\n%s", pretty.String())
+	}
+	opts.JSON = true
+	var ndjson bytes.Buffer
+	if err := RunTrace(context.Background(), runDir, opts, &ndjson); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(ndjson.String()), "\n")
+	rec := map[string]any{}
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[1]), &rec) != nil || rec["outcome"] != "fail" {
+		t.Fatalf("ndjson output:\n%s", ndjson.String())
+	}
+}
+
+func TestRunTraceFollowsAcrossRotation(t *testing.T) {
+	runDir := t.TempDir()
+	out := &syncBuffer{}
+	done := make(chan error, 1)
+	go func() {
+		done <- RunTrace(context.Background(), runDir, TraceOptions{Query: TraceQueryOptions{Types: []string{"NodeOutputCaptured", "PipelineCompleted"}}, Follow: true, PollInterval: 5 * time.Millisecond}, out)
+	}()
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(out.String(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %q in:\n%s", want, out.String())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	appendLine(t, filepath.Join(runDir, "trace.jsonl"), `{"type":"NodeOutputCaptured","node_id":"a","at":"2026-01-01T00:00:01Z","outcome":"success"}`+"\n")
+	waitFor("[a] outcome=\"success\"")
+	appendLine(t, filepath.Join(runDir, "trace.jsonl"), `{"type":"NodeInputCaptured","node_id":"b","at":"2026-01-01T00:00:02Z"}`+"\n")
+	appendLine(t, filepath.Join(runDir, "trace.1.jsonl"), `{"type":"NodeOutputCaptured","node_id":"b","at":"2026-01-01T00:00:03Z","outcome":"fail"}`+"\n")
+	waitFor("[b] outcome=\"fail\"")
+	appendLine(t, filepath.Join(runDir, "trace.1.jsonl"), `{"type":"PipelineCompleted","at":"2026-01-01T00:00:04Z"}`+"\n")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("follow did not stop after PipelineCompleted")
+	}
+	if strings.Contains(out.String(), "NodeInputCaptured") {
+		t.Fatalf("type filter not applied while following:\n%s", out.String())
+	}
+}
@@ -0,0 +1,155 @@
+package attractor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// unfixableCandidate is one path taken from a failed tool command.
+type unfixableCandidate struct {
+	Path string `json:"path"`
+	// Source is extension (the token has a file extension) or workspace_file
+	// (an extensionless token naming a file in the workspace).
+	Source  string `json:"source"`
+	Allowed bool   `json:"allowed"`
+}
+
+// unfixableAnalysis is written to unfixable.analysis.json in a fix node's
+// directory whenever it follows a failed tool node.
+type unfixableAnalysis struct {
+	FailedNode        string               `json:"failed_node"`
+	ToolCommand       string               `json:"tool_command"`
+	AllowedWritePaths []string             `json:"allowed_write_paths"`
+	Candidates        []unfixableCandidate `json:"candidates"`
+	Blocked           bool                 `json:"blocked"`
+	Reason            string               `json:"reason"`
+}
+
+// unfixableFailureSourceReason stops a codergen fix node before it runs when
+// the tool command that just failed references files the node may not write,
+// since retries could never fix them.
+func (e *Engine) unfixableFailureSourceReason(node *Node, nodeDir string) (string, bool) {
+	if !isCodergenNode(node) {
+		return "", false
+	}
+	failedNodeID := strings.TrimSpace(e.Context.GetString("last_failure.node_id", ""))
+	if failedNodeID == "" {
+		return "", false
+	}
+	failedNode := e.Graph.Nodes[failedNodeID]
+	if failedNode == nil || failedNode.Type() != "tool" {
+		return "", false
+	}
+	cmd := strings.TrimSpace(failedNode.StringAttr("tool_command", ""))
+	if cmd == "" {
+		return "", false
+	}
+	a := unfixableAnalysis{FailedNode: failedNodeID, ToolCommand: cmd, AllowedWritePaths: []string{}, Candidates: []unfixableCandidate{}}
+	defer func() {
+		_ = writeJSON(filepath.Join(nodeDir, "unfixable.analysis.json"), a)
+	}()
+	allowed, err := ParseAllowedWritePaths(node)
+	if err != nil {
+		a.Blocked = true
+		a.Reason = fmt.Sprintf("invalid allowed_write_paths on node %s: %v", node.ID, err)
+		return a.Reason, true
+	}
+	for _, p := range allowed {
+		p = filepath.ToSlash(strings.TrimSpace(p))
+		if p != "" {
+			a.AllowedWritePaths = append(a.AllowedWritePaths, p)
+		}
+	}
+	outside := []string{}
+	for _, c := range extractToolSourcePaths(cmd, e.Workspace) {
+		c.Allowed = len(a.AllowedWritePaths) == 0 || pathAllowed(c.Path, a.AllowedWritePaths)
+		if !c.Allowed {
+			outside = append(outside, c.Path)
+		}
+		a.Candidates = append(a.Candidates, c)
+	}
+	switch {
+	case len(a.Candidates) == 0:
+		a.Reason = "no file paths found in tool_command"
+	case len(a.AllowedWritePaths) == 0:
+		a.Reason = fmt.Sprintf("node %s has no allowed_write_paths", node.ID)
+	case len(outside) == 0:
+		a.Reason = "every referenced path is inside allowed_write_paths"
+	default:
+		sort.Strings(outside)
+		a.Blocked = true
+		a.Reason = fmt.Sprintf("unfixable_failure_source: failed node %s references %s outside allowed_write_paths for %s", failedNodeID, strings.Join(outside, ","), node.ID)
+	}
+	return a.Reason, a.Blocked
+}
+
+var (
+	toolCommandSeparators = regexp.MustCompile(`[\s;|&()<>]+`)
+	redirectTargetRe      = regexp.MustCompile(`\d*>{1,2}&?\s*\S+`)
+	fileExtensionRe       = regexp.MustCompile(`^[^.]+.*\.[A-Za-z][A-Za-z0-9]{0,7}$`)
+)
+
+// extractToolSourcePaths lists workspace-relative file paths a tool command
+// refers to: tokens with a file extension (build.py, tools/build.mk) and
+// extensionless tokens naming an existing workspace file (scripts/check).
+// Flags, env assignments, URLs, redirect targets, and paths outside the
+// workspace are skipped; `--flag=value` contributes its value.
+func extractToolSourcePaths(cmd, workspace string) []unfixableCandidate {
+	seen := map[string]bool{}
+	out := []unfixableCandidate{}
+	for _, tok := range toolCommandSeparators.Split(redirectTargetRe.ReplaceAllString(cmd, " "), -1) {
+		t := strings.Trim(tok, `"'`)
+		if strings.HasPrefix(t, "-") {
+			_, v, ok := strings.Cut(t, "=")
+			if !ok {
+				continue
+			}
+			t = strings.Trim(v, `"'`)
+		} else if strings.Contains(t, "=") {
+			continue
+		}
+		if t == "" || strings.Contains(t, "://") || strings.Contains(t, "...") || strings.ContainsAny(t, "$*?`") {
+			continue
+		}
+		rel, ok := workspaceRelPath(t, workspace)
+		if !ok || seen[rel] {
+			continue
+		}
+		source := ""
+		if fileExtensionRe.MatchString(filepath.Base(rel)) {
+			source = "extension"
+		} else if info, err := os.Stat(filepath.Join(workspace, filepath.FromSlash(rel))); err == nil && info.Mode().IsRegular() {
+			source = "workspace_file"
+		}
+		if source == "" {
+			continue
+		}
+		seen[rel] = true
+		out = append(out, unfixableCandidate{Path: rel, Source: source})
+	}
+	return out
+}
+
+// workspaceRelPath cleans p to a slash path relative to workspace, rejecting
+// paths that leave it.
+func workspaceRelPath(p, workspace string) (string, bool) {
+	if filepath.IsAbs(p) {
+		if workspace == "" {
+			return "", false
+		}
+		rel, err := filepath.Rel(workspace, p)
+		if err != nil {
+			return "", false
+		}
+		p = rel
+	}
+	clean := filepath.ToSlash(filepath.Clean(p))
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	return clean, true
+}
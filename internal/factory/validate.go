@@ -6,22 +6,39 @@ import (
 	"strings"
 )
 
+// ValidateGraph runs the validation rules the graph selects (see
+// ValidationRules) and returns their diagnostics sorted by message.
 func ValidateGraph(g *Graph) []Diagnostic {
-	d := []Diagnostic{}
 	if g == nil {
-		return []Diagnostic{{Level: "ERROR", Message: "graph is nil"}}
+		return []Diagnostic{{Level: "ERROR", Rule: coreRuleID, Message: "graph is nil"}}
 	}
+	d := runValidationRules(g)
+	sort.Slice(d, func(i, j int) bool {
+		return d[i].Message < d[j].Message
+	})
+	return d
+}
+
+// validateCore is the core rule: the checks every pipeline must pass.
+func validateCore(g *Graph) []Diagnostic {
+	d := []Diagnostic{}
 	incoming := map[string]int{}
-	outgoing := map[string]int{}
+	outgoing := map[string][]string{}
+	targets := map[string][]string{}
+	edgeIDs := map[string]*Edge{}
 	for _, e := range g.Edges {
-		outgoing[e.From]++
+		outgoing[e.From] = append(outgoing[e.From], e.ref())
+		targets[e.From] = append(targets[e.From], e.To)
 		incoming[e.To]++
 		if _, ok := g.Nodes[e.To]; !ok {
-			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("edge target missing: %s", e.To)})
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("edge %s target missing: %s", e.ref(), e.To)})
 		}
-		c := strings.TrimSpace(e.StringAttr("condition", ""))
-		if c != "" && c != "outcome=success" && c != "outcome=fail" && c != "outcome=retry" && c != "outcome=partial_success" {
-			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("unsupported condition: %s", c)})
+		d = append(d, validateEdgeCondition(g, e)...)
+		if e.ID != "" {
+			if prev, dup := edgeIDs[e.ID]; dup {
+				d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("duplicate edge id %s (%s -> %s and %s -> %s)", e.ID, prev.From, prev.To, e.From, e.To)})
+			}
+			edgeIDs[e.ID] = e
 		}
 	}
 
@@ -30,7 +47,7 @@ func ValidateGraph(g *Graph) []Diagnostic {
 	for _, n := range g.Nodes {
 		shape := n.Shape()
 		typ := n.Type()
-		if shape == "Mdiamond" || n.ID == "start" {
+		if isStartNode(n) {
 			starts = append(starts, n)
 		}
 		if shape == "Msquare" || n.ID == "exit" || n.ID == "end" {
@@ -42,63 +59,119 @@ func ValidateGraph(g *Graph) []Diagnostic {
 		if _, err := ParseAllowedWritePaths(n); err != nil {
 			d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
 		}
+		if err := validateGuardrailMode(n); err != nil {
+			d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
+		}
+		if err := validateOnFail(n); err != nil {
+			d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
+		}
+		if err := validateToolCache(n); err != nil {
+			d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
+		}
+		if err := validateToolExitCodes(n); err != nil {
+			d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
+		}
+		if err := validateContractMode(n); err != nil {
+			d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
+		}
+		d = append(d, validateManagerLoop(g, n)...)
+		d = append(d, validateExitCriteria(g, n)...)
+		d = append(d, validateExpectedOutputs(n)...)
+		d = append(d, validateResourceLimits(n)...)
+		d = append(d, validateChangeBudget(n)...)
+		d = append(d, validatePromptTree(g, n)...)
+		d = append(d, validateFailureFeedbackAttrs(g, n)...)
+		d = append(d, validateToolRunner(n)...)
+		d = append(d, validateForeach(n)...)
+		d = append(d, validateReadOnly(n)...)
+		d = append(d, validateToolPathPrepend(n)...)
+		d = append(d, validateToolEnv(g, n)...)
+		d = append(d, validateSnapshotExcludes(g, n)...)
+		d = append(d, validateCodexScope(g, n)...)
+		d = append(d, validateExportAttrs(n)...)
+		d = append(d, validateProduces(n)...)
+		d = append(d, validateReport(n)...)
+		d = append(d, validateModelSequence(n)...)
+		if err := validateDelegateAttrs(n); err != nil {
+			d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
+		}
+		for _, err := range inheritableAttrErrors(n) {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("node %s: %v", n.ID, err)})
+		}
+	}
+	d = append(d, validateGraphAttrDefaults(g)...)
+	d = append(d, validateNotifyAttrs(g)...)
+	d = append(d, validateChangelog(g)...)
+	d = append(d, validateMatrixFanOut(g)...)
+	d = append(d, validateNodeDirNames(g)...)
+	d = append(d, validateDeliverables(g)...)
+	d = append(d, validateScheduling(g)...)
+	d = append(d, validateRequiredToolNodes(g)...)
+	d = append(d, validateInterpolation(g)...)
+	d = append(d, validateContextDataflow(g)...)
+	d = append(d, validateFailureSummaryBudget(g)...)
+	d = append(d, validateTraceRotation(g)...)
+	d = append(d, validateRetryBudget(g)...)
+	d = append(d, validateDisabledNodes(g)...)
+	d = append(d, validateHermeticEnv(g)...)
+	d = append(d, validateGraphSnapshotExcludes(g)...)
+	if _, err := copyVerifyMode(g, 0); err != nil {
+		d = append(d, Diagnostic{Level: "ERROR", Message: err.Error()})
 	}
 
-	if len(starts) != 1 {
+	multi := multiEntry(g)
+	switch {
+	case multi && len(starts) == 0:
+		d = append(d, Diagnostic{Level: "ERROR", Message: "must have at least one start node"})
+	case !multi && len(starts) > 1:
+		d = append(d, Diagnostic{Level: "ERROR", Message: "must have exactly one start node (set graph [multi_entry=true] to choose one per run with --entry)"})
+	case !multi && len(starts) != 1:
 		d = append(d, Diagnostic{Level: "ERROR", Message: "must have exactly one start node"})
 	}
 	if len(exits) < 1 {
 		d = append(d, Diagnostic{Level: "ERROR", Message: "must have at least one exit node"})
 	}
-	if len(starts) == 1 {
-		if incoming[starts[0].ID] > 0 {
-			d = append(d, Diagnostic{Level: "ERROR", Message: "start node cannot have incoming edges"})
+	for _, n := range starts {
+		if incoming[n.ID] > 0 {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("start node cannot have incoming edges: %s", n.ID)})
 		}
 	}
 	for _, n := range exits {
-		if outgoing[n.ID] > 0 {
-			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("exit node has outgoing edges: %s", n.ID)})
+		if len(outgoing[n.ID]) > 0 {
+			d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("exit node has outgoing edges: %s (%s)", n.ID, strings.Join(outgoing[n.ID], ","))})
 		}
 	}
 
-	if len(starts) == 1 {
-		seen := map[string]bool{}
-		queue := []string{starts[0].ID}
-		for len(queue) > 0 {
-			id := queue[0]
-			queue = queue[1:]
-			if seen[id] {
-				continue
-			}
-			seen[id] = true
-			for _, e := range g.Edges {
-				if e.From == id {
-					queue = append(queue, e.To)
-				}
-			}
-		}
+	if len(starts) > 0 && (multi || len(starts) == 1) {
+		ids := startNodeIDs(g)
+		seen := reachableNodes(g, ids, nil)
 		for id := range g.Nodes {
 			if !seen[id] {
 				d = append(d, Diagnostic{Level: "ERROR", Message: fmt.Sprintf("unreachable node: %s", id)})
 			}
 		}
+		reported := map[string]bool{}
+		for _, id := range ids {
+			for _, diag := range validateExitReachability(g, id) {
+				if !reported[diag.Message] {
+					reported[diag.Message] = true
+					d = append(d, diag)
+				}
+			}
+		}
 	}
-
-	sort.Slice(d, func(i, j int) bool {
-		return d[i].Message < d[j].Message
-	})
 	return d
 }
 
 func validateUnsupportedHandler(shape, typ string) error {
-	pairs := [][2]string{{"hexagon", "wait.human"}, {"diamond", "conditional"}, {"component", "parallel"}, {"tripleoctagon", "parallel.fan_in"}, {"house", "stack.manager_loop"}}
+	pairs := [][2]string{{"hexagon", "wait.human"}, {"diamond", "conditional"}, {"component", "parallel"}, {"tripleoctagon", "parallel.fan_in"}}
 	for _, p := range pairs {
 		if shape == p[0] || typ == p[1] {
 			return fmt.Errorf("unsupported v1+ handler in v0: shape=%s type=%s", shape, typ)
 		}
 	}
-	supportedShapes := map[string]bool{"Mdiamond": true, "Msquare": true, "box": true, "parallelogram": true, "": true}
-	supportedTypes := map[string]bool{"": true, "start": true, "exit": true, "codergen": true, "tool": true, "verification": true}
+	supportedShapes := map[string]bool{"Mdiamond": true, "Msquare": true, "box": true, "parallelogram": true, "house": true, "": true}
+	supportedTypes := map[string]bool{"": true, "start": true, "exit": true, "codergen": true, "tool": true, "verification": true, "report": true, "stack.manager_loop": true}
 	if !supportedShapes[shape] {
 		return fmt.Errorf("unsupported shape: %s", shape)
 	}
@@ -108,6 +181,18 @@ func validateUnsupportedHandler(shape, typ string) error {
 	return nil
 }
 
+// StrictDiagnostics returns d with warnings promoted to errors (--strict).
+func StrictDiagnostics(d []Diagnostic) []Diagnostic {
+	out := make([]Diagnostic, len(d))
+	for i, diag := range d {
+		if diag.Level == "WARN" {
+			diag.Level = "ERROR"
+		}
+		out[i] = diag
+	}
+	return out
+}
+
 func HasErrors(diags []Diagnostic) bool {
 	for _, d := range diags {
 		if d.Level == "ERROR" {
@@ -3,31 +3,58 @@ package attractor
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
-type verificationHandler struct{}
+type verificationHandler struct {
+	// runID is exported to each command as ATTRACTOR_RUN_ID.
+	runID string
+	// escalate asks about a command outside the allowlist and returns the
+	// request's status: approved lets it run once, denied fails the node
+	// with approval_rejected, and rejected (fail mode) fails it as before.
+	// Nil rejects every such command (Engine.escalate).
+	escalate func(node *Node, nodeDir, command, reason string) (string, error)
+}
 
 type verificationCommandResult struct {
-	Command  string `json:"command"`
-	ExitCode int    `json:"exit_code"`
-	Stdout   string `json:"stdout"`
-	Stderr   string `json:"stderr"`
+	Command      string                          `json:"command"`
+	ExitCode     int                             `json:"exit_code"`
+	DurationMS   int64                           `json:"duration_ms"`
+	Stdout       string                          `json:"stdout"`
+	Stderr       string                          `json:"stderr"`
+	Expectations []verificationExpectationResult `json:"expectations,omitempty"`
+	// Key is the command's content key; a retry of the node skips a command
+	// whose key matches an earlier success.
+	Key string `json:"key,omitempty"`
+	// SkippedCached marks a result carried over from an earlier attempt
+	// instead of run again.
+	SkippedCached bool `json:"skipped_cached,omitempty"`
+}
+
+// verificationExpectationResult records one expectation of a plan command.
+type verificationExpectationResult struct {
+	Name     string `json:"name"`
+	Expected any    `json:"expected"`
+	Passed   bool   `json:"passed"`
 }
 
 type verificationResults struct {
+	// PlanDigest identifies the plan the commands came from; results are
+	// only reused by an attempt with the same plan.
+	PlanDigest   string                      `json:"plan_digest,omitempty"`
 	CheckedFiles []string                    `json:"checked_files"`
 	Commands     []verificationCommandResult `json:"commands"`
+	Coverage     *verificationCoverageResult `json:"coverage,omitempty"`
 }
 
-func (verificationHandler) Execute(node *Node, ctx Context, _ *Graph, nodeDir string, workspace string) (Outcome, error) {
+func (h verificationHandler) Execute(node *Node, ctx Context, g *Graph, nodeDir string, workspace string) (Outcome, error) {
 	key := strings.TrimSpace(node.StringAttr("verification.plan_context_key", "verification.plan"))
-	raw, ok := ctx[key]
+	raw, ok := ctx.Get(key)
 	if !ok {
 		return Outcome{
 			SchemaVersion:    1,
@@ -35,6 +62,7 @@ func (verificationHandler) Execute(node *Node, ctx Context, _ *Graph, nodeDir st
 			SuggestedNextIDs: []string{},
 			ContextUpdates:   map[string]any{},
 			FailureReason:    fmt.Sprintf("verification plan missing in context key: %s", key),
+			FailureCode:      FailureVerificationPlanMissing,
 		}, nil
 	}
 	plan, err := ParseVerificationPlanForWorkspace(raw, workspace)
@@ -45,6 +73,7 @@ func (verificationHandler) Execute(node *Node, ctx Context, _ *Graph, nodeDir st
 			SuggestedNextIDs: []string{},
 			ContextUpdates:   map[string]any{},
 			FailureReason:    err.Error(),
+			FailureCode:      FailureVerificationPlanInvalid,
 		}, nil
 	}
 	planJSON, err := json.MarshalIndent(plan, "", "  ")
@@ -63,6 +92,18 @@ func (verificationHandler) Execute(node *Node, ctx Context, _ *Graph, nodeDir st
 			SuggestedNextIDs: []string{},
 			ContextUpdates:   map[string]any{},
 			FailureReason:    "verification.allowed_commands is required",
+			FailureCode:      FailureVerificationConfigInvalid,
+		}, nil
+	}
+	allowed, err := parseCommandAllowlist(allowedPrefixes)
+	if err != nil {
+		return Outcome{
+			SchemaVersion:    1,
+			Outcome:          "fail",
+			SuggestedNextIDs: []string{},
+			ContextUpdates:   map[string]any{},
+			FailureReason:    err.Error(),
+			FailureCode:      FailureVerificationConfigInvalid,
 		}, nil
 	}
 
@@ -75,11 +116,13 @@ func (verificationHandler) Execute(node *Node, ctx Context, _ *Graph, nodeDir st
 				SuggestedNextIDs: []string{},
 				ContextUpdates:   map[string]any{},
 				FailureReason:    fmt.Sprintf("required file missing: %s", f),
+				FailureCode:      FailureVerificationFileMissing,
 			}, nil
 		}
 	}
 
-	results := verificationResults{CheckedFiles: append([]string{}, plan.Files...), Commands: make([]verificationCommandResult, 0, len(plan.Commands))}
+	planDigest := verificationPlanDigest(planJSON)
+	results := verificationResults{PlanDigest: planDigest, CheckedFiles: append([]string{}, plan.Files...), Commands: make([]verificationCommandResult, 0, len(plan.Commands))}
 	workingDir, err := resolveVerificationWorkdir(workspace, node.StringAttr("verification.workdir", ""))
 	if err != nil {
 		return Outcome{
@@ -88,9 +131,47 @@ func (verificationHandler) Execute(node *Node, ctx Context, _ *Graph, nodeDir st
 			SuggestedNextIDs: []string{},
 			ContextUpdates:   map[string]any{},
 			FailureReason:    err.Error(),
+			FailureCode:      FailureVerificationConfigInvalid,
 		}, nil
 	}
-	for _, command := range plan.Commands {
+	limits, err := parseResourceLimits(node)
+	if err != nil {
+		return Outcome{}, err
+	}
+	runner := toolRunnerFor(node)
+	// $PWD in command env values expands to the directory the command sees.
+	commandDir, err := runner.commandDir(workspace, workingDir)
+	if err != nil {
+		return Outcome{}, err
+	}
+	nodeEnv, err := nodeCommandEnv(h.runID, node, ctx, runner, nodeDir, workspace)
+	if err != nil {
+		return Outcome{}, err
+	}
+	baseEnv, hermetic, err := commandEnv(g, node, runner, workspace, nodeEnv)
+	if err != nil {
+		return Outcome{}, err
+	}
+	runner.Hermetic = hermetic
+	if err := writeToolEnv(nodeDir, baseEnv, hermetic); err != nil {
+		return Outcome{}, err
+	}
+	_ = os.Remove(filepath.Join(nodeDir, toolMetaFile))
+	// Read before this attempt overwrites verification.results.json.
+	reuse, err := newVerificationReuse(g, node, nodeDir, workspace, planDigest, workingDir, runner, hermetic)
+	if err != nil {
+		return Outcome{}, err
+	}
+	defer reuse.writeDecisions(nodeDir)
+	exes := []toolExecutable{}
+	resolved := map[string]bool{}
+	commands := plan.Commands
+	if plan.Coverage != nil {
+		// The coverage command runs last, under the same checks as the rest.
+		commands = append(append([]VerificationCommand{}, commands...), VerificationCommand{Run: plan.Coverage.Command})
+	}
+	for i, planned := range commands {
+		command := planned.Run
 		if err := validateToolCommand(command); err != nil {
 			return Outcome{
 				SchemaVersion:    1,
@@ -98,18 +179,41 @@ func (verificationHandler) Execute(node *Node, ctx Context, _ *Graph, nodeDir st
 				SuggestedNextIDs: []string{},
 				ContextUpdates:   map[string]any{},
 				FailureReason:    err.Error(),
+				FailureCode:      FailureToolCommandRejected,
 			}, nil
 		}
-		if !commandAllowed(command, allowedPrefixes) {
-			return Outcome{
-				SchemaVersion:    1,
-				Outcome:          "fail",
-				SuggestedNextIDs: []string{},
-				ContextUpdates:   map[string]any{},
-				FailureReason:    fmt.Sprintf("verification command not allowed: %s", command),
-			}, nil
+		if ok, closest := matchAllowedCommand(command, allowed); !ok {
+			reason := fmt.Sprintf("verification command not allowed: %s", command)
+			if closest != "" {
+				reason += fmt.Sprintf(" (closest allowlist entry: %s)", closest)
+			}
+			status := "rejected"
+			if h.escalate != nil {
+				var err error
+				if status, err = h.escalate(node, nodeDir, command, reason); err != nil {
+					return Outcome{}, err
+				}
+			}
+			if status != "approved" {
+				code := FailureVerificationNotAllowed
+				if status == "denied" {
+					code, reason = FailureApprovalRejected, "approval_rejected: "+reason
+				}
+				return Outcome{
+					SchemaVersion:    1,
+					Outcome:          "fail",
+					SuggestedNextIDs: []string{},
+					ContextUpdates:   map[string]any{},
+					FailureReason:    reason,
+					FailureCode:      code,
+				}, nil
+			}
 		}
-		parsed, err := parseVerificationCommand(command, workingDir)
+		if prev, ok := reuse.decide(command, plan.Coverage != nil && i == len(commands)-1); ok {
+			results.Commands = append(results.Commands, prev)
+			continue
+		}
+		parsed, err := parseVerificationCommand(command, commandDir)
 		if err != nil {
 			return Outcome{
 				SchemaVersion:    1,
@@ -117,19 +221,36 @@ func (verificationHandler) Execute(node *Node, ctx Context, _ *Graph, nodeDir st
 				SuggestedNextIDs: []string{},
 				ContextUpdates:   map[string]any{},
 				FailureReason:    err.Error(),
+				FailureCode:      FailureVerificationPlanInvalid,
 			}, nil
 		}
-		cmd := exec.Command(parsed.Name, parsed.Args...)
-		cmd.Dir = workingDir
-		cmd.Env = append(os.Environ(), parsed.Env...)
-		stdout, _ := cmd.StdoutPipe()
-		stderr, _ := cmd.StderrPipe()
-		if err := cmd.Start(); err != nil {
+		argv := append([]string{parsed.Name}, parsed.Args...)
+		env := append(append([]string{}, baseEnv...), parsed.Env...)
+		if runner.Name != "docker" {
+			// Run the executable the child's PATH resolves to, which is what
+			// tool.meta.json records.
+			exe := resolveToolExecutable(parsed.Name, workingDir, env)
+			if exe.Path != "" {
+				argv[0] = exe.Path
+			}
+			if !resolved[parsed.Name] {
+				resolved[parsed.Name] = true
+				exes = append(exes, exe)
+				if err := writeToolMeta(nodeDir, node, exes); err != nil {
+					return Outcome{}, err
+				}
+			}
+		}
+		cmd, err := runner.command(workspace, workingDir, argv, env, limits)
+		if err != nil {
+			return Outcome{}, err
+		}
+		started := time.Now()
+		outB, errB, reaped, waitErr := runProcessGroup(cmd)
+		elapsed := time.Since(started)
+		if err := recordReapedProcesses(nodeDir, reaped); err != nil {
 			return Outcome{}, err
 		}
-		outB, _ := io.ReadAll(stdout)
-		errB, _ := io.ReadAll(stderr)
-		waitErr := cmd.Wait()
 		exitCode := 0
 		if waitErr != nil {
 			if ee, ok := waitErr.(*exec.ExitError); ok {
@@ -138,25 +259,57 @@ func (verificationHandler) Execute(node *Node, ctx Context, _ *Graph, nodeDir st
 				return Outcome{}, waitErr
 			}
 		}
-		results.Commands = append(results.Commands, verificationCommandResult{
-			Command:  command,
-			ExitCode: exitCode,
-			Stdout:   string(outB),
-			Stderr:   string(errB),
-		})
+		result := verificationCommandResult{
+			Command:    command,
+			ExitCode:   exitCode,
+			DurationMS: elapsed.Milliseconds(),
+			Stdout:     string(outB),
+			Stderr:     string(errB),
+			Key:        reuse.key(command),
+		}
+		if exitCode == 0 {
+			result.Expectations = evaluateVerificationExpectations(planned, string(outB), elapsed)
+		}
+		results.Commands = append(results.Commands, result)
 		if exitCode != 0 {
 			b, _ := json.MarshalIndent(results, "", "  ")
 			_ = os.WriteFile(filepath.Join(nodeDir, "verification.results.json"), append(b, '\n'), 0o644)
+			if limited, ok, err := resourceLimitFailure(nodeDir, command, limits, waitErr, exitCode, errB); err != nil {
+				return Outcome{}, err
+			} else if ok {
+				return limited, nil
+			}
 			return Outcome{
 				SchemaVersion:    1,
 				Outcome:          "fail",
 				SuggestedNextIDs: []string{},
 				ContextUpdates:   map[string]any{},
 				FailureReason:    fmt.Sprintf("verification command failed: %s (exit=%d)", command, exitCode),
+				FailureCode:      FailureVerificationCommandFailed,
+			}, nil
+		}
+		if unmet := unmetExpectations(result.Expectations); len(unmet) > 0 {
+			b, _ := json.MarshalIndent(results, "", "  ")
+			_ = os.WriteFile(filepath.Join(nodeDir, "verification.results.json"), append(b, '\n'), 0o644)
+			return Outcome{
+				SchemaVersion:    1,
+				Outcome:          "fail",
+				SuggestedNextIDs: []string{},
+				ContextUpdates:   map[string]any{},
+				FailureReason:    fmt.Sprintf("verification expectation not met: %s (%s)", command, strings.Join(unmet, "; ")),
+				FailureCode:      FailureVerificationExpectationFailed,
 			}, nil
 		}
 	}
 
+	updates := map[string]any{}
+	coverageReason := ""
+	if plan.Coverage != nil {
+		results.Coverage, coverageReason = checkVerificationCoverage(*plan.Coverage, workspace)
+		if results.Coverage != nil {
+			updates["verification.coverage_percent"] = results.Coverage.Percent
+		}
+	}
 	b, err := json.MarshalIndent(results, "", "  ")
 	if err != nil {
 		return Outcome{}, err
@@ -164,14 +317,60 @@ func (verificationHandler) Execute(node *Node, ctx Context, _ *Graph, nodeDir st
 	if err := os.WriteFile(filepath.Join(nodeDir, "verification.results.json"), append(b, '\n'), 0o644); err != nil {
 		return Outcome{}, err
 	}
+	if coverageReason != "" {
+		return Outcome{
+			SchemaVersion:    1,
+			Outcome:          "fail",
+			SuggestedNextIDs: []string{},
+			ContextUpdates:   updates,
+			FailureReason:    coverageReason,
+			FailureCode:      FailureVerificationCoverageFailed,
+		}, nil
+	}
 	return Outcome{
 		SchemaVersion:    1,
 		Outcome:          "success",
 		SuggestedNextIDs: []string{},
-		ContextUpdates:   map[string]any{},
+		ContextUpdates:   updates,
 	}, nil
 }
 
+// evaluateVerificationExpectations checks a command's stdout and duration
+// against the expectations it declares.
+func evaluateVerificationExpectations(c VerificationCommand, stdout string, elapsed time.Duration) []verificationExpectationResult {
+	results := []verificationExpectationResult{}
+	if c.ExpectStdoutContains != "" {
+		results = append(results, verificationExpectationResult{Name: "expect_stdout_contains", Expected: c.ExpectStdoutContains, Passed: strings.Contains(stdout, c.ExpectStdoutContains)})
+	}
+	if c.ExpectStdoutNotContains != "" {
+		results = append(results, verificationExpectationResult{Name: "expect_stdout_not_contains", Expected: c.ExpectStdoutNotContains, Passed: !strings.Contains(stdout, c.ExpectStdoutNotContains)})
+	}
+	if c.MinDurationMS > 0 {
+		results = append(results, verificationExpectationResult{Name: "min_duration_ms", Expected: c.MinDurationMS, Passed: elapsed.Milliseconds() >= int64(c.MinDurationMS)})
+	}
+	if len(results) == 0 {
+		return nil
+	}
+	return results
+}
+
+// unmetExpectations describes the failed expectations, e.g.
+// `expect_stdout_not_contains "no test files"`.
+func unmetExpectations(results []verificationExpectationResult) []string {
+	unmet := []string{}
+	for _, r := range results {
+		if r.Passed {
+			continue
+		}
+		if s, ok := r.Expected.(string); ok {
+			unmet = append(unmet, fmt.Sprintf("%s %q", r.Name, s))
+		} else {
+			unmet = append(unmet, fmt.Sprintf("%s %v", r.Name, r.Expected))
+		}
+	}
+	return unmet
+}
+
 func resolveVerificationWorkdir(workspace, configured string) (string, error) {
 	configured = strings.TrimSpace(configured)
 	if configured == "" {
@@ -197,26 +396,6 @@ func resolveVerificationWorkdir(workspace, configured string) (string, error) {
 	return dir, nil
 }
 
-func commandAllowed(command string, allowedPrefixes []string) bool {
-	if hasUnsafeShellSyntax(command) {
-		return false
-	}
-	cmd := normalizeCommandForAllowlist(command)
-	for _, p := range allowedPrefixes {
-		p = strings.TrimSpace(p)
-		if p == "" {
-			continue
-		}
-		if cmd == p {
-			return true
-		}
-		if strings.HasPrefix(cmd, p+" ") {
-			return true
-		}
-	}
-	return false
-}
-
 type parsedVerificationCommand struct {
 	Env  []string
 	Name string
@@ -231,7 +410,10 @@ func parseVerificationCommand(command, workingDir string) (parsedVerificationCom
 	if hasUnsafeShellSyntax(command) {
 		return parsedVerificationCommand{}, fmt.Errorf("verification command rejected: contains unsafe shell syntax")
 	}
-	fields := strings.Fields(command)
+	fields, err := splitCommandTokens(command)
+	if err != nil {
+		return parsedVerificationCommand{}, fmt.Errorf("verification command rejected: %v", err)
+	}
 	if len(fields) == 0 {
 		return parsedVerificationCommand{}, fmt.Errorf("verification command cannot be empty")
 	}
@@ -0,0 +1,188 @@
+package attractor
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// commandMatcher is one parsed verification.allowed_commands entry. Each
+// pattern token is a literal, a glob (`scripts/*.sh`), or a path constraint
+// (`<path-under:agent/>`). A command matches when its leading tokens match
+// every pattern token; further arguments are allowed, as with plain prefixes.
+type commandMatcher struct {
+	entry  string
+	tokens []commandPatternToken
+}
+
+type commandPatternToken struct {
+	literal  string
+	glob     string
+	pathRoot string
+}
+
+const pathUnderPlaceholder = "<path-under:"
+
+func parseCommandAllowlist(entries []string) ([]commandMatcher, error) {
+	out := []commandMatcher{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		m, err := parseCommandMatcher(entry)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func parseCommandMatcher(entry string) (commandMatcher, error) {
+	fields, err := splitCommandTokens(entry)
+	if err != nil {
+		return commandMatcher{}, fmt.Errorf("invalid verification.allowed_commands entry %q: %v", entry, err)
+	}
+	if len(fields) == 0 {
+		return commandMatcher{}, fmt.Errorf("invalid verification.allowed_commands entry %q: empty", entry)
+	}
+	m := commandMatcher{entry: entry}
+	for i, f := range fields {
+		switch {
+		case strings.HasPrefix(f, pathUnderPlaceholder) && strings.HasSuffix(f, ">"):
+			root := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(f, pathUnderPlaceholder), ">"))
+			clean := path.Clean(root)
+			if root == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+				return commandMatcher{}, fmt.Errorf("invalid verification.allowed_commands entry %q: path constraint must be a relative directory", entry)
+			}
+			m.tokens = append(m.tokens, commandPatternToken{pathRoot: clean})
+		case strings.HasPrefix(f, "<"):
+			return commandMatcher{}, fmt.Errorf("invalid verification.allowed_commands entry %q: unknown placeholder %s", entry, f)
+		case strings.ContainsAny(f, "*?["):
+			if i == 0 {
+				return commandMatcher{}, fmt.Errorf("invalid verification.allowed_commands entry %q: executable cannot be a glob", entry)
+			}
+			if _, err := path.Match(f, ""); err != nil {
+				return commandMatcher{}, fmt.Errorf("invalid verification.allowed_commands entry %q: bad glob %s", entry, f)
+			}
+			m.tokens = append(m.tokens, commandPatternToken{glob: f})
+		default:
+			m.tokens = append(m.tokens, commandPatternToken{literal: f})
+		}
+	}
+	return m, nil
+}
+
+func (t commandPatternToken) matches(arg string) bool {
+	switch {
+	case t.pathRoot != "":
+		return pathUnder(arg, t.pathRoot)
+	case t.glob != "":
+		ok, _ := path.Match(t.glob, arg)
+		return ok && !strings.Contains(arg, "..")
+	default:
+		return arg == t.literal
+	}
+}
+
+// pathUnder reports whether arg is a relative path that stays inside root.
+func pathUnder(arg, root string) bool {
+	if arg == "" || path.IsAbs(arg) {
+		return false
+	}
+	clean := path.Clean(arg)
+	if root == "." {
+		return clean != ".." && !strings.HasPrefix(clean, "../")
+	}
+	return strings.HasPrefix(clean, root+"/")
+}
+
+// matchedTokens returns how many leading pattern tokens match cmd.
+func (m commandMatcher) matchedTokens(cmd []string) int {
+	n := 0
+	for n < len(m.tokens) && n < len(cmd) && m.tokens[n].matches(cmd[n]) {
+		n++
+	}
+	return n
+}
+
+// matchAllowedCommand checks command against the parsed allowlist. When it is
+// rejected, closest names the entry sharing the longest matching prefix.
+func matchAllowedCommand(command string, matchers []commandMatcher) (ok bool, closest string) {
+	if hasUnsafeShellSyntax(command) {
+		return false, ""
+	}
+	cmd, err := splitCommandTokens(normalizeCommandForAllowlist(command))
+	if err != nil || len(cmd) == 0 {
+		return false, ""
+	}
+	best := -1
+	for _, m := range matchers {
+		n := m.matchedTokens(cmd)
+		if n == len(m.tokens) {
+			return true, ""
+		}
+		score := n*1000 + commonPrefixLen(cmd[0], m.entry)
+		if score > best {
+			best = score
+			closest = m.entry
+		}
+	}
+	return false, closest
+}
+
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func commandAllowed(command string, allowed []string) bool {
+	matchers, err := parseCommandAllowlist(allowed)
+	if err != nil {
+		return false
+	}
+	ok, _ := matchAllowedCommand(command, matchers)
+	return ok
+}
+
+// splitCommandTokens splits a command on whitespace, honoring single and
+// double quotes the way a shell would for plain words.
+func splitCommandTokens(command string) ([]string, error) {
+	out := []string{}
+	var cur strings.Builder
+	inToken := false
+	var quote rune
+	for _, r := range command {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				continue
+			}
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+		case r == ' ' || r == '\t':
+			if inToken {
+				out = append(out, cur.String())
+				cur.Reset()
+				inToken = false
+			}
+		default:
+			cur.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inToken {
+		out = append(out, cur.String())
+	}
+	return out, nil
+}
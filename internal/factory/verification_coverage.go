@@ -0,0 +1,132 @@
+package attractor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// VerificationCoverage is a plan's optional coverage gate: command writes a
+// Go cover profile at profile (workspace-relative), whose statement coverage
+// must reach min_percent.
+type VerificationCoverage struct {
+	Command    string  `json:"command"`
+	Profile    string  `json:"profile"`
+	MinPercent float64 `json:"min_percent"`
+}
+
+// verificationCoverageResult is the coverage entry in
+// verification.results.json.
+type verificationCoverageResult struct {
+	Profile           string  `json:"profile"`
+	Percent           float64 `json:"percent"`
+	MinPercent        float64 `json:"min_percent"`
+	Statements        int     `json:"statements"`
+	CoveredStatements int     `json:"covered_statements"`
+	Passed            bool    `json:"passed"`
+}
+
+// coverProfileTotals counts statements across a cover profile.
+type coverProfileTotals struct {
+	Statements int
+	Covered    int
+}
+
+// Percent is statement coverage rounded to one decimal, as go test prints it.
+func (t coverProfileTotals) Percent() float64 {
+	if t.Statements == 0 {
+		return 0
+	}
+	return math.Round(float64(t.Covered)*1000/float64(t.Statements)) / 10
+}
+
+// parseCoverProfile reads the text format go test -coverprofile writes: a
+// "mode:" line, then "file:start.col,end.col statements count" per block.
+// A block listed more than once, as with -coverpkg across packages, counts
+// once and is covered if any listing has a nonzero count.
+func parseCoverProfile(r io.Reader) (coverProfileTotals, error) {
+	var totals coverProfileTotals
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	blocks := map[string]int{}
+	covered := map[string]bool{}
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		if line == 1 {
+			if !strings.HasPrefix(text, "mode: ") {
+				return totals, fmt.Errorf("line 1: missing mode line")
+			}
+			continue
+		}
+		// The file name may contain spaces, so split from the right.
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return totals, fmt.Errorf("line %d: expected block, statements, and count", line)
+		}
+		count, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+		if err != nil {
+			return totals, fmt.Errorf("line %d: invalid count %q", line, fields[len(fields)-1])
+		}
+		stmts, err := strconv.Atoi(fields[len(fields)-2])
+		if err != nil || stmts < 0 {
+			return totals, fmt.Errorf("line %d: invalid statement count %q", line, fields[len(fields)-2])
+		}
+		block := strings.Join(fields[:len(fields)-2], " ")
+		if !strings.Contains(block, ":") || !strings.Contains(block, ",") {
+			return totals, fmt.Errorf("line %d: invalid block %q", line, block)
+		}
+		blocks[block] = stmts
+		if count > 0 {
+			covered[block] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return totals, err
+	}
+	if line == 0 {
+		return totals, fmt.Errorf("profile is empty")
+	}
+	for block, stmts := range blocks {
+		totals.Statements += stmts
+		if covered[block] {
+			totals.Covered += stmts
+		}
+	}
+	return totals, nil
+}
+
+// checkVerificationCoverage reads the plan's cover profile after its command
+// ran. It returns the result and, when the gate fails, the failure reason.
+func checkVerificationCoverage(c VerificationCoverage, workspace string) (*verificationCoverageResult, string) {
+	f, err := os.Open(filepath.Join(workspace, filepath.FromSlash(c.Profile)))
+	if err != nil {
+		return nil, fmt.Sprintf("verification coverage profile missing: %s", c.Profile)
+	}
+	defer f.Close()
+	totals, err := parseCoverProfile(f)
+	if err != nil {
+		return nil, fmt.Sprintf("verification coverage profile invalid: %s: %v", c.Profile, err)
+	}
+	res := &verificationCoverageResult{
+		Profile:           c.Profile,
+		Percent:           totals.Percent(),
+		MinPercent:        c.MinPercent,
+		Statements:        totals.Statements,
+		CoveredStatements: totals.Covered,
+	}
+	res.Passed = res.Percent >= c.MinPercent
+	if !res.Passed {
+		return res, fmt.Sprintf("verification coverage below minimum: %.1f%% < %g%% (%s)", res.Percent, c.MinPercent, c.Profile)
+	}
+	return res, ""
+}
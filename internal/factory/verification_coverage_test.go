@@ -0,0 +1,65 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCoverProfileFixture(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "cover.profile.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	totals, err := parseCoverProfile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Repeated blocks count once and are covered if any listing ran.
+	if totals.Statements != 10 || totals.Covered != 6 || totals.Percent() != 60 {
+		t.Fatalf("totals = %+v (%.1f%%)", totals, totals.Percent())
+	}
+	for src, want := range map[string]string{
+		"":                            "profile is empty",
+		"a.go:1.1,2.2 1 1\n":          "line 1: missing mode line",
+		"mode: set\na.go:1.1,2.2 x 1": `line 2: invalid statement count "x"`,
+		"mode: set\na.go 1 1":         `line 2: invalid block "a.go"`,
+	} {
+		if _, err := parseCoverProfile(strings.NewReader(src)); err == nil || err.Error() != want {
+			t.Fatalf("parse(%q) = %v, want %q", src, err, want)
+		}
+	}
+}
+
+func TestVerificationCoverageGate(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	generate [shape=box, "test.verification_plan_json"="{\"files\":[],\"commands\":[\"echo ok\"],\"coverage\":{\"command\":\"cp fixture.out cover.out\",\"profile\":\"cover.out\",\"min_percent\":70}}"];
+	verify [shape=parallelogram, type=verification, "verification.allowed_commands"="echo,cp"];
+	exit [shape=Msquare];
+	start -> generate -> verify -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	b, err := os.ReadFile(filepath.Join("testdata", "cover.profile.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(workdir, "fixture.out"), string(b))
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "cov1"})
+	nodeDir := filepath.Join(runsdir, "cov1", "verify")
+	st := readStatusJSON(t, filepath.Join(nodeDir, "status.json"))
+	if st["failure_reason"] != "verification coverage below minimum: 60.0% < 70% (cover.out)" || st["failure_code"] != string(FailureVerificationCoverageFailed) {
+		t.Fatalf("status = %v", st)
+	}
+	if updates, _ := st["context_updates"].(map[string]any); updates["verification.coverage_percent"] != float64(60) {
+		t.Fatalf("context_updates = %v", st["context_updates"])
+	}
+	results := readStatusJSON(t, filepath.Join(nodeDir, "verification.results.json"))
+	cov, _ := results["coverage"].(map[string]any)
+	if len(results["commands"].([]any)) != 2 || cov["percent"] != float64(60) || cov["passed"] != false || cov["statements"] != float64(10) {
+		t.Fatalf("results = %v", results)
+	}
+}
@@ -1,6 +1,7 @@
 package attractor
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"path/filepath"
@@ -8,8 +9,52 @@ import (
 )
 
 type VerificationPlan struct {
-	Files    []string `json:"files"`
-	Commands []string `json:"commands"`
+	Files    []string              `json:"files"`
+	Commands []VerificationCommand `json:"commands"`
+	// Coverage runs after Commands when set; see VerificationCoverage.
+	Coverage *VerificationCoverage `json:"coverage,omitempty"`
+}
+
+// VerificationCommand is one plan command. In JSON it is either a plain
+// command string, checked by exit code only, or an object with run and
+// optional expectations on its output and duration.
+type VerificationCommand struct {
+	Run                     string `json:"run"`
+	ExpectStdoutContains    string `json:"expect_stdout_contains,omitempty"`
+	ExpectStdoutNotContains string `json:"expect_stdout_not_contains,omitempty"`
+	MinDurationMS           int    `json:"min_duration_ms,omitempty"`
+}
+
+func (c *VerificationCommand) UnmarshalJSON(b []byte) error {
+	var run string
+	if err := json.Unmarshal(b, &run); err == nil {
+		*c = VerificationCommand{Run: run}
+		return nil
+	}
+	type plain VerificationCommand
+	var obj plain
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&obj); err != nil {
+		return fmt.Errorf("verification command must be a string or an object with run: %w", err)
+	}
+	*c = VerificationCommand(obj)
+	return nil
+}
+
+// MarshalJSON writes commands without expectations as plain strings, so plans
+// without them keep their original shape.
+func (c VerificationCommand) MarshalJSON() ([]byte, error) {
+	if !c.HasExpectations() {
+		return json.Marshal(c.Run)
+	}
+	type plain VerificationCommand
+	return json.Marshal(plain(c))
+}
+
+// HasExpectations reports whether the command checks more than its exit code.
+func (c VerificationCommand) HasExpectations() bool {
+	return c.ExpectStdoutContains != "" || c.ExpectStdoutNotContains != "" || c.MinDurationMS > 0
 }
 
 func ParseVerificationPlan(raw any) (VerificationPlan, error) {
@@ -22,6 +67,15 @@ func ParseVerificationPlanForWorkspace(raw any, workspace string) (VerificationP
 
 func parseVerificationPlan(raw any, workspace string) (VerificationPlan, error) {
 	var plan VerificationPlan
+	if encoded, ok := raw.(string); ok {
+		// Agents sometimes return the plan as a JSON-encoded string inside
+		// context_updates instead of an object.
+		var decoded any
+		if err := json.Unmarshal([]byte(encoded), &decoded); err != nil {
+			return plan, fmt.Errorf("invalid verification plan: %w", err)
+		}
+		raw = decoded
+	}
 	b, err := json.Marshal(raw)
 	if err != nil {
 		return plan, fmt.Errorf("invalid verification plan: %w", err)
@@ -37,12 +91,29 @@ func parseVerificationPlan(raw any, workspace string) (VerificationPlan, error)
 		plan.Files[i] = clean
 	}
 	for i, c := range plan.Commands {
-		c = strings.TrimSpace(c)
-		if c == "" {
+		c.Run = strings.TrimSpace(c.Run)
+		if c.Run == "" {
 			return plan, fmt.Errorf("verification command cannot be empty")
 		}
+		if c.MinDurationMS < 0 {
+			return plan, fmt.Errorf("invalid verification command %q: min_duration_ms cannot be negative", c.Run)
+		}
 		plan.Commands[i] = c
 	}
+	if c := plan.Coverage; c != nil {
+		c.Command = strings.TrimSpace(c.Command)
+		if c.Command == "" {
+			return plan, fmt.Errorf("invalid verification coverage: command cannot be empty")
+		}
+		clean, err := normalizeVerificationPath(c.Profile, workspace)
+		if err != nil {
+			return plan, fmt.Errorf("invalid verification coverage profile %q: %w", c.Profile, err)
+		}
+		c.Profile = clean
+		if c.MinPercent < 0 || c.MinPercent > 100 {
+			return plan, fmt.Errorf("invalid verification coverage: min_percent must be between 0 and 100")
+		}
+	}
 	if len(plan.Commands) == 0 {
 		return plan, fmt.Errorf("verification plan must contain at least one command")
 	}
@@ -77,8 +148,30 @@ func normalizeVerificationPath(p string, workspace string) (string, error) {
 }
 
 func VerificationPlanToMap(plan VerificationPlan) map[string]any {
-	return map[string]any{
+	commands := make([]any, 0, len(plan.Commands))
+	for _, c := range plan.Commands {
+		if !c.HasExpectations() {
+			commands = append(commands, c.Run)
+			continue
+		}
+		m := map[string]any{"run": c.Run}
+		if c.ExpectStdoutContains != "" {
+			m["expect_stdout_contains"] = c.ExpectStdoutContains
+		}
+		if c.ExpectStdoutNotContains != "" {
+			m["expect_stdout_not_contains"] = c.ExpectStdoutNotContains
+		}
+		if c.MinDurationMS > 0 {
+			m["min_duration_ms"] = c.MinDurationMS
+		}
+		commands = append(commands, m)
+	}
+	m := map[string]any{
 		"files":    append([]string{}, plan.Files...),
-		"commands": append([]string{}, plan.Commands...),
+		"commands": commands,
+	}
+	if c := plan.Coverage; c != nil {
+		m["coverage"] = map[string]any{"command": c.Command, "profile": c.Profile, "min_percent": c.MinPercent}
 	}
+	return m
 }
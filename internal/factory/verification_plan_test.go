@@ -1,7 +1,10 @@
 package attractor
 
 import (
+	"encoding/json"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -35,3 +38,37 @@ func TestParseVerificationPlanForWorkspace_RejectsAbsolutePathOutsideWorkspace(t
 		t.Fatal("expected error for outside absolute path")
 	}
 }
+
+func TestParseVerificationPlanAcceptsCommandObjects(t *testing.T) {
+	plan, err := ParseVerificationPlan(`{"files":[],"commands":["go vet ./...",{"run":" go test ./... ","expect_stdout_contains":"ok","expect_stdout_not_contains":"no test files","min_duration_ms":100}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []VerificationCommand{
+		{Run: "go vet ./..."},
+		{Run: "go test ./...", ExpectStdoutContains: "ok", ExpectStdoutNotContains: "no test files", MinDurationMS: 100},
+	}
+	if !reflect.DeepEqual(plan.Commands, want) {
+		t.Fatalf("commands = %#v", plan.Commands)
+	}
+	b, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"commands":["go vet ./...",{"run":"go test ./..."`) {
+		t.Fatalf("marshaled plan = %s", b)
+	}
+	round, err := ParseVerificationPlan(VerificationPlanToMap(plan))
+	if err != nil || !reflect.DeepEqual(round.Commands, want) {
+		t.Fatalf("round trip = %#v (%v)", round.Commands, err)
+	}
+	for _, raw := range []string{
+		`{"commands":[{"run":"go test","expect_stdout":"ok"}]}`,
+		`{"commands":[{"expect_stdout_contains":"ok"}]}`,
+		`{"commands":[{"run":"go test","min_duration_ms":-1}]}`,
+	} {
+		if _, err := ParseVerificationPlan(raw); err == nil {
+			t.Fatalf("expected error for %s", raw)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package attractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// verificationDecisionsFile lists, per attempt, whether each verification
+// command ran or was skipped and why. The engine turns it into trace records.
+const verificationDecisionsFile = "verification.decisions.json"
+
+// verificationCacheDecision is one command's entry in
+// verification.decisions.json.
+type verificationCacheDecision struct {
+	Command string `json:"command"`
+	Key     string `json:"key,omitempty"`
+	// Decision is run or skipped_cached.
+	Decision string `json:"decision"`
+	// Reason is key_matched for a skipped command; for one that ran it is
+	// always_rerun, no_previous_results, plan_changed, not_previously_passed,
+	// inputs_changed, or coverage_command.
+	Reason string `json:"reason"`
+}
+
+// verificationReuse decides which commands of a verification attempt can
+// reuse a success from an earlier attempt of the node in the same run. A
+// command is skipped when the plan is unchanged and its key, the command
+// text with the node's command settings and the hashes of its input files,
+// matches one that passed before.
+type verificationReuse struct {
+	alwaysRerun bool
+	// blocked is why nothing can be reused, when set.
+	blocked string
+	// config and inputs are digests of the command settings and input files
+	// shared by every command of the attempt.
+	config, inputs string
+	previous       map[string]verificationCommandResult
+	passed         map[string]bool
+	decisions      []verificationCacheDecision
+}
+
+// verificationPlanDigest identifies a plan, as written to
+// verification.plan.json.
+func verificationPlanDigest(planJSON []byte) string {
+	h := sha256.Sum256(planJSON)
+	return hex.EncodeToString(h[:])
+}
+
+// newVerificationReuse reads the node's previous verification.results.json,
+// from the newest attempt archive once the attempt's files have moved there,
+// and hashes the input files: verification.cache_inputs when set, else the
+// whole workspace outside snapshot_excludes. Inputs are hashed once, before
+// any command runs, so a command that writes an input makes the next
+// attempt run everything again.
+func newVerificationReuse(g *Graph, node *Node, nodeDir, workspace, planDigest, workingDir string, runner toolRunner, hermetic bool) (*verificationReuse, error) {
+	r := &verificationReuse{alwaysRerun: node.BoolAttr("verification.always_rerun", false)}
+	if r.alwaysRerun {
+		return r, nil
+	}
+	globs, err := parseInputGlobs(node, "verification.cache_inputs")
+	if err != nil {
+		return nil, err
+	}
+	excludes, err := snapshotExcludes(g, node)
+	if err != nil {
+		return nil, err
+	}
+	files, _, err := snapshotWorkspaceExcluding(workspace, -1, nil, excludes)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	for _, p := range sortedKeys(files) {
+		matched := len(globs) == 0
+		for _, glob := range globs {
+			matched = matched || matchCacheGlob(glob, p)
+		}
+		if matched {
+			fmt.Fprintf(h, "%s\x00%s\x00", p, files[p].Hash)
+		}
+	}
+	r.inputs = hex.EncodeToString(h.Sum(nil))
+	rel, err := filepath.Rel(workspace, workingDir)
+	if err != nil {
+		return nil, err
+	}
+	h = sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%t\x00%s\x00%s\x00%t\x00", filepath.ToSlash(rel), node.StringAttr("tool_env", ""), hermetic, runner.Name, runner.Image, runner.Network)
+	r.config = hex.EncodeToString(h.Sum(nil))
+
+	var b []byte
+	path, err := previousAttemptFile(nodeDir, "verification.results.json")
+	if err == nil {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		r.blocked = "no_previous_results"
+		return r, nil
+	}
+	var prev verificationResults
+	if json.Unmarshal(b, &prev) != nil {
+		r.blocked = "no_previous_results"
+		return r, nil
+	}
+	if prev.PlanDigest != planDigest {
+		r.blocked = "plan_changed"
+		return r, nil
+	}
+	r.previous = map[string]verificationCommandResult{}
+	r.passed = map[string]bool{}
+	for _, c := range prev.Commands {
+		if c.Key == "" || c.ExitCode != 0 || len(unmetExpectations(c.Expectations)) > 0 {
+			continue
+		}
+		r.previous[c.Key] = c
+		r.passed[c.Command] = true
+	}
+	return r, nil
+}
+
+// key is the content key of command in this attempt, or "" when keys are
+// not kept because the node always reruns.
+func (r *verificationReuse) key(command string) string {
+	if r.alwaysRerun {
+		return ""
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "verification-command-v1\x00%s\x00%s\x00%s\x00", command, r.config, r.inputs)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// decide returns the earlier result to reuse for command, if any, and
+// records the decision.
+func (r *verificationReuse) decide(command string, coverage bool) (verificationCommandResult, bool) {
+	key := r.key(command)
+	d := verificationCacheDecision{Command: command, Key: key, Decision: "run"}
+	prev, ok := r.previous[key]
+	switch {
+	case r.alwaysRerun:
+		d.Reason = "always_rerun"
+	case r.blocked != "":
+		d.Reason = r.blocked
+	case coverage:
+		// The coverage gate reads the profile the command writes, so the
+		// command always runs.
+		d.Reason = "coverage_command"
+	case ok:
+		d.Decision, d.Reason = "skipped_cached", "key_matched"
+	case r.passed[command]:
+		d.Reason = "inputs_changed"
+	default:
+		d.Reason = "not_previously_passed"
+	}
+	r.decisions = append(r.decisions, d)
+	if d.Decision != "skipped_cached" {
+		return verificationCommandResult{}, false
+	}
+	prev.DurationMS = 0
+	prev.SkippedCached = true
+	return prev, true
+}
+
+func (r *verificationReuse) writeDecisions(nodeDir string) error {
+	if len(r.decisions) == 0 {
+		return nil
+	}
+	return writeJSON(filepath.Join(nodeDir, verificationDecisionsFile), r.decisions)
+}
+
+// traceVerificationDecisions adds a VerificationCommandCacheDecision trace
+// record for each command the node's verification attempt considered.
+func (e *Engine) traceVerificationDecisions(node *Node, nodeDir string) {
+	b, err := os.ReadFile(filepath.Join(nodeDir, verificationDecisionsFile))
+	if err != nil {
+		return
+	}
+	var decisions []verificationCacheDecision
+	if json.Unmarshal(b, &decisions) != nil {
+		return
+	}
+	skipped := 0
+	for _, d := range decisions {
+		if d.Decision == "skipped_cached" {
+			skipped++
+		}
+		_ = e.appendTrace("VerificationCommandCacheDecision", map[string]any{"node_id": node.ID, "command": d.Command, "key": d.Key, "decision": d.Decision, "reason": d.Reason})
+	}
+	if skipped > 0 {
+		e.Logger.Info("verification reused earlier command results", "node", node.ID, "skipped", skipped, "commands", len(decisions))
+	}
+}
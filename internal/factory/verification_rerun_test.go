@@ -0,0 +1,138 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// verificationRerunDOT fails verify's second command once, so fix sends the
+// run back through verify.
+const verificationRerunDOT = `digraph G {
+	start [shape=Mdiamond];
+	generate [shape=box, "test.verification_plan_json"="{\"files\":[],\"commands\":[\"bash check.sh a\",\"bash check.sh b\"]}"];
+	verify [shape=parallelogram, type=verification, "verification.allowed_commands"="bash" VERIFY_ATTRS];
+	fix [shape=parallelogram, tool_command="FIX_COMMAND"];
+	exit [shape=Msquare];
+	start -> generate -> verify;
+	verify -> exit [condition="outcome=success"];
+	verify -> fix [condition="outcome=fail"];
+	fix -> verify;
+	}`
+
+func TestVerificationRetrySkipsPassedCommands(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	for _, tc := range []struct {
+		name, verifyAttrs, fix string
+		wantLog                string
+		wantDecisions          string
+	}{
+		{
+			name:          "unchanged",
+			fix:           "true",
+			wantLog:       "a,b,b",
+			wantDecisions: "a:run:no_previous_results,b:run:no_previous_results,a:skipped_cached:key_matched,b:run:not_previously_passed",
+		},
+		{
+			name:          "always_rerun",
+			verifyAttrs:   `, "verification.always_rerun"=true`,
+			fix:           "true",
+			wantLog:       "a,b,a,b",
+			wantDecisions: "a:run:always_rerun,b:run:always_rerun,a:run:always_rerun,b:run:always_rerun",
+		},
+		{
+			name:          "inputs_changed",
+			fix:           "echo fixed > src.txt",
+			wantLog:       "a,b,a,b",
+			wantDecisions: "a:run:no_previous_results,b:run:no_previous_results,a:run:inputs_changed,b:run:not_previously_passed",
+		},
+		{
+			name:          "change_outside_cache_inputs",
+			verifyAttrs:   `, "verification.cache_inputs"="check.sh"`,
+			fix:           "echo fixed > src.txt",
+			wantLog:       "a,b,b",
+			wantDecisions: "a:run:no_previous_results,b:run:no_previous_results,a:skipped_cached:key_matched,b:run:not_previously_passed",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dot := strings.ReplaceAll(strings.ReplaceAll(verificationRerunDOT, " VERIFY_ATTRS", tc.verifyAttrs), "FIX_COMMAND", tc.fix)
+			workdir, runsdir, pipeline := setupRun(t, dot)
+			state := t.TempDir()
+			t.Setenv("RERUN_LOG", filepath.Join(state, "log"))
+			t.Setenv("RERUN_FLAG", filepath.Join(state, "flag"))
+			writeFile(t, filepath.Join(workdir, "check.sh"), `echo "$1" >> "$RERUN_LOG"
+if [ "$1" = b ] && [ ! -f "$RERUN_FLAG" ]; then touch "$RERUN_FLAG"; exit 1; fi
+`)
+			if err := RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "vr1"}); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(filepath.Join(state, "log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(strings.Fields(string(b)), ","); got != tc.wantLog {
+				t.Fatalf("commands run = %s, want %s", got, tc.wantLog)
+			}
+			runDir := filepath.Join(runsdir, "vr1")
+			decisions := []string{}
+			if err := scanTraceRecords(runDir, func(rec map[string]any) {
+				if rec["type"] == "VerificationCommandCacheDecision" && rec["node_id"] == "verify" {
+					decisions = append(decisions, strings.TrimPrefix(rec["command"].(string), "bash check.sh ")+":"+rec["decision"].(string)+":"+rec["reason"].(string))
+					if rec["attempt_id"] == nil {
+						t.Errorf("decision not stamped with an attempt: %v", rec)
+					}
+				}
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(decisions, ","); got != tc.wantDecisions {
+				t.Fatalf("decisions = %s\nwant %s", got, tc.wantDecisions)
+			}
+			results := readStatusJSON(t, filepath.Join(runDir, "verify", "verification.results.json"))
+			commands := results["commands"].([]any)
+			first, second := commands[0].(map[string]any), commands[1].(map[string]any)
+			if (first["skipped_cached"] == true) != (tc.wantLog == "a,b,b") || second["skipped_cached"] != nil || second["exit_code"] != float64(0) {
+				t.Fatalf("results = %v", results)
+			}
+			if (first["key"] == nil) != (tc.name == "always_rerun") || results["plan_digest"] == "" {
+				t.Fatalf("results = %v", results)
+			}
+		})
+	}
+}
+
+func TestVerificationRetryRunsEverythingWhenPlanChanges(t *testing.T) {
+	workspace, nodeDir := t.TempDir(), t.TempDir()
+	writeJSON(filepath.Join(nodeDir, "verification.results.json"), verificationResults{PlanDigest: "old", Commands: []verificationCommandResult{{Command: "echo a", Key: "k"}}})
+	node := &Node{ID: "verify", Attrs: map[string]Value{"type": "verification"}}
+	r, err := newVerificationReuse(&Graph{Attrs: map[string]Value{}}, node, nodeDir, workspace, "new", workspace, toolRunner{Name: "host"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.decide("echo a", false); ok || r.decisions[0].Reason != "plan_changed" {
+		t.Fatalf("decisions = %+v", r.decisions)
+	}
+}
+
+func TestValidateVerificationRerunAttrs(t *testing.T) {
+	g, err := ParseDOT(`digraph G {
+	graph ["verification.cache_inputs"="/abs"];
+	start [shape=Mdiamond];
+	verify [shape=parallelogram, type=verification, "verification.allowed_commands"="echo", "verification.always_rerun"=sometimes];
+	exit [shape=Msquare];
+	start -> verify -> exit;
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := diagnosticMessages(ValidateGraph(g))
+	for _, want := range []string{
+		`node verify: invalid verification.always_rerun "sometimes" (expected true or false)`,
+		"graph attribute default: verification.cache_inputs entry must be a workspace-relative glob: /abs",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("diagnostics missing %q:\n%s", want, got)
+		}
+	}
+}
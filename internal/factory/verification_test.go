@@ -1,6 +1,10 @@
 package attractor
 
-import "testing"
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestCommandAllowedDirectPrefix(t *testing.T) {
 	if !commandAllowed("go test ./...", []string{"go test"}) {
@@ -53,3 +57,111 @@ func TestParseVerificationCommandRejectsUnsafeShellSyntax(t *testing.T) {
 		t.Fatal("expected unsafe shell syntax to be rejected")
 	}
 }
+
+func TestCommandAllowlistArgumentConstraints(t *testing.T) {
+	allowlist := []string{"bash scripts/scenarios/*.sh", "go test", "test -f <path-under:agent/>"}
+	cases := []struct {
+		name    string
+		command string
+		allowed bool
+		closest string
+	}{
+		{"glob first argument", "bash scripts/scenarios/preflight.sh", true, ""},
+		{"glob with script args", "bash scripts/scenarios/preflight.sh --fast", true, ""},
+		{"glob rejects other dir", "bash scripts/other.sh", false, "bash scripts/scenarios/*.sh"},
+		{"glob does not cross directories", "bash scripts/scenarios/nested/x.sh", false, "bash scripts/scenarios/*.sh"},
+		{"glob rejects traversal", "bash scripts/scenarios/..sh", false, "bash scripts/scenarios/*.sh"},
+		{"bare bash rejected", "bash -c whoami", false, "bash scripts/scenarios/*.sh"},
+		{"prefix as today", "go test ./...", true, ""},
+		{"prefix exact", "go test", true, ""},
+		{"prefix requires token boundary", "go testfoo", false, "go test"},
+		{"path under dir", "test -f agent/main.go", true, ""},
+		{"path under nested dir", "test -f agent/cmd/x/main.go", true, ""},
+		{"path outside dir", "test -f other/main.go", false, "test -f <path-under:agent/>"},
+		{"path escapes via dotdot", "test -f agent/../secrets.txt", false, "test -f <path-under:agent/>"},
+		{"absolute path rejected", "test -f /etc/passwd", false, "test -f <path-under:agent/>"},
+		{"dir itself rejected", "test -f agent", false, "test -f <path-under:agent/>"},
+		{"env prefix", `GOCACHE="$PWD/.gocache" go test ./...`, true, ""},
+		{"env prefix with glob", "SCENARIO=fast bash scripts/scenarios/a.sh", true, ""},
+		{"double quoted argument", `bash "scripts/scenarios/a.sh"`, true, ""},
+		{"single quoted path", `test -f 'agent/main.go'`, true, ""},
+		{"quoted argument still constrained", `test -f "agent/../x"`, false, "test -f <path-under:agent/>"},
+		{"unterminated quote", `test -f "agent/main.go`, false, ""},
+		{"unsafe syntax", "go test ./... && rm -rf x", false, ""},
+		{"closest by executable name", "gofmt -l .", false, "go test"},
+	}
+	matchers, err := parseCommandAllowlist(allowlist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, closest := matchAllowedCommand(tc.command, matchers)
+			if ok != tc.allowed {
+				t.Fatalf("matchAllowedCommand(%q) = %v, want %v", tc.command, ok, tc.allowed)
+			}
+			if closest != tc.closest {
+				t.Fatalf("closest entry for %q = %q, want %q", tc.command, closest, tc.closest)
+			}
+		})
+	}
+}
+
+func TestParseCommandAllowlistRejectsBadEntries(t *testing.T) {
+	for _, entry := range []string{
+		"test -f <path-under:/etc>",
+		"test -f <path-under:../x>",
+		"test -f <anything>",
+		"scripts/*.sh",
+		"bash scripts/[.sh",
+		`bash "unterminated`,
+	} {
+		if _, err := parseCommandAllowlist([]string{entry}); err == nil {
+			t.Fatalf("expected %q to be rejected", entry)
+		}
+	}
+}
+
+func TestParseVerificationCommandHonorsQuotes(t *testing.T) {
+	got, err := parseVerificationCommand(`bash "scripts/scenarios/a b.sh" 'x y'`, "/tmp/work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "bash" || len(got.Args) != 2 || got.Args[0] != "scripts/scenarios/a b.sh" || got.Args[1] != "x y" {
+		t.Fatalf("unexpected parse: %#v", got)
+	}
+}
+
+func TestVerificationCommandExpectations(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	generate [
+		shape=box,
+		"test.verification_plan_json"="{\"files\":[],\"commands\":[\"echo ok\",{\"run\":\"echo ok no test files\",\"expect_stdout_contains\":\"ok\",\"expect_stdout_not_contains\":\"no test files\"}]}"
+	];
+	verify [shape=parallelogram, type=verification, "verification.allowed_commands"="echo"];
+	exit [shape=Msquare];
+	start -> generate -> verify -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	_ = RunPipeline(RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "ve1"})
+	nodeDir := filepath.Join(runsdir, "ve1", "verify")
+	st := readStatusJSON(t, filepath.Join(nodeDir, "status.json"))
+	if st["failure_reason"] != `verification expectation not met: echo ok no test files (expect_stdout_not_contains "no test files")` || st["failure_code"] != string(FailureVerificationExpectationFailed) {
+		t.Fatalf("status = %v", st)
+	}
+	results := readStatusJSON(t, filepath.Join(nodeDir, "verification.results.json"))
+	commands := results["commands"].([]any)
+	if len(commands) != 2 || commands[0].(map[string]any)["expectations"] != nil {
+		t.Fatalf("results = %v", results)
+	}
+	got := []string{}
+	for _, e := range commands[1].(map[string]any)["expectations"].([]any) {
+		m := e.(map[string]any)
+		got = append(got, m["name"].(string)+"="+map[bool]string{true: "pass", false: "fail"}[m["passed"].(bool)])
+	}
+	if strings.Join(got, ",") != "expect_stdout_contains=pass,expect_stdout_not_contains=fail" {
+		t.Fatalf("expectations = %v", got)
+	}
+}
@@ -0,0 +1,139 @@
+package attractor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// workspaceFileHashes reduces a snapshot to path -> content hash.
+func workspaceFileHashes(snap map[string]fileState) map[string]string {
+	out := make(map[string]string, len(snap))
+	for p, st := range snap {
+		out[p] = st.Hash
+	}
+	return out
+}
+
+// workspaceDigest hashes the sorted path/hash pairs, so any added, removed,
+// or changed file changes the digest.
+func workspaceDigest(files map[string]string) string {
+	h := sha256.New()
+	for _, p := range sortedKeys(files) {
+		fmt.Fprintf(h, "%s\x00%s\n", p, files[p])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// stampWorkspace records the current workspace digest on cp. The previous
+// checkpoint's snapshot seeds the walk so unchanged files are not rehashed.
+// The graph's snapshot_excludes are left out of the digest.
+func (e *Engine) stampWorkspace(cp *Checkpoint) error {
+	excludes, err := snapshotExcludes(e.Graph, nil)
+	if err != nil {
+		return err
+	}
+	snap, _, err := snapshotWorkspaceExcluding(e.Workspace, -1, e.checkpointSnapshot, excludes)
+	if err != nil {
+		return err
+	}
+	e.checkpointSnapshot = snap
+	cp.WorkspaceFiles = workspaceFileHashes(snap)
+	cp.WorkspaceDigest = workspaceDigest(cp.WorkspaceFiles)
+	return nil
+}
+
+// restampCheckpointWorkspace updates the digest and run totals in an
+// existing checkpoint. It runs when a run stops with an error, so files a
+// node wrote before erroring are not mistaken for manual edits on resume,
+// and the erroring node's attempts still count.
+func (e *Engine) restampCheckpointWorkspace() {
+	path := filepath.Join(e.RunDir, "checkpoint.json")
+	cp, err := readCheckpoint(path)
+	if err != nil {
+		return
+	}
+	if err := e.stampWorkspace(&cp); err != nil {
+		e.Logger.Warn("failed to record workspace digest", "error", err)
+		return
+	}
+	cp.Totals = &e.totals
+	_ = writeJSON(path, cp)
+}
+
+// checkWorkspaceDrift compares the workspace with the digest in cp before a
+// resume. Drift is recorded as a ResumeWorkspaceDrift event and trace, and
+// refused unless accept is set.
+func (e *Engine) checkWorkspaceDrift(cp Checkpoint, accept bool) error {
+	if cp.WorkspaceDigest == "" {
+		return nil
+	}
+	excludes, err := snapshotExcludes(e.Graph, nil)
+	if err != nil {
+		return err
+	}
+	snap, _, err := snapshotWorkspaceExcluding(e.Workspace, -1, nil, excludes)
+	if err != nil {
+		return err
+	}
+	current := workspaceFileHashes(snap)
+	if workspaceDigest(current) == cp.WorkspaceDigest {
+		e.checkpointSnapshot = snap
+		return nil
+	}
+	d := workspaceDiff{Created: []string{}, Modified: []string{}, Deleted: []string{}}
+	for p, h := range current {
+		prev, ok := cp.WorkspaceFiles[p]
+		if !ok {
+			d.Created = append(d.Created, p)
+		} else if prev != h {
+			d.Modified = append(d.Modified, p)
+		}
+	}
+	for p := range cp.WorkspaceFiles {
+		if _, ok := current[p]; !ok {
+			d.Deleted = append(d.Deleted, p)
+		}
+	}
+	sort.Strings(d.Created)
+	sort.Strings(d.Modified)
+	sort.Strings(d.Deleted)
+	fields := map[string]any{
+		"last_completed_node": cp.LastCompletedNode,
+		"created":             d.Created,
+		"modified":            d.Modified,
+		"deleted":             d.Deleted,
+		"accepted":            accept,
+	}
+	ev := map[string]any{"schema_version": 1, "type": "ResumeWorkspaceDrift", "at": time.Now().UTC().Format(time.RFC3339Nano)}
+	for k, v := range fields {
+		ev[k] = v
+	}
+	e.recordEvent(ev)
+	_ = e.appendTrace("ResumeWorkspaceDrift", fields)
+	summary := describeWorkspaceDrift(d)
+	if !accept {
+		e.Logger.Error("workspace changed since checkpoint", "changes", summary)
+		return fmt.Errorf("workspace changed since the last checkpoint: %s (pass --accept-workspace-drift to resume anyway)", summary)
+	}
+	e.Logger.Warn("resuming with workspace drift", "changes", summary)
+	e.checkpointSnapshot = snap
+	return nil
+}
+
+func describeWorkspaceDrift(d workspaceDiff) string {
+	parts := []string{}
+	for _, group := range []struct {
+		label string
+		paths []string
+	}{{"modified", d.Modified}, {"created", d.Created}, {"deleted", d.Deleted}} {
+		if len(group.paths) > 0 {
+			parts = append(parts, group.label+" "+strings.Join(group.paths, ","))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
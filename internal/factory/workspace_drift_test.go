@@ -0,0 +1,83 @@
+package attractor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointRecordsWorkspaceDigest(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	dot := `digraph G {
+	start [shape=Mdiamond];
+	a [shape=parallelogram, tool_command="echo built > out.txt"];
+	b [shape=box];
+	exit [shape=Msquare];
+	start -> a -> b -> exit;
+	}`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	cfg := RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "wd1"}
+	if err := RunPipeline(cfg); err == nil || !strings.Contains(err.Error(), "test_stop") {
+		t.Fatalf("expected test stop, got %v", err)
+	}
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	runDir := filepath.Join(runsdir, "wd1")
+	cp, err := readCheckpoint(filepath.Join(runDir, "checkpoint.json"))
+	if err != nil || cp.WorkspaceDigest == "" || cp.WorkspaceFiles["out.txt"] == "" {
+		t.Fatalf("checkpoint workspace = %q %v (%v)", cp.WorkspaceDigest, cp.WorkspaceFiles, err)
+	}
+
+	cfg.Resume = true
+	if err := RunPipeline(cfg); err != nil {
+		t.Fatalf("resume without drift: %v", err)
+	}
+	if evs := eventsOfType(t, runDir, "ResumeWorkspaceDrift"); len(evs) != 0 {
+		t.Fatalf("unexpected drift events: %v", evs)
+	}
+}
+
+func TestResumeWorkspaceDriftListsChangedPaths(t *testing.T) {
+	t.Setenv("ATTRACTION_BACKEND", "fake")
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "a")
+	dot := `digraph G { start [shape=Mdiamond]; a [shape=box]; b [shape=box]; exit [shape=Msquare]; start -> a -> b -> exit; }`
+	workdir, runsdir, pipeline := setupRun(t, dot)
+	writeFile(t, filepath.Join(workdir, "notes.md"), "draft\n")
+	writeFile(t, filepath.Join(workdir, "old.txt"), "old\n")
+	cfg := RunConfig{PipelinePath: pipeline, Workdir: workdir, Runsdir: runsdir, RunID: "wd2"}
+	_ = RunPipeline(cfg)
+	t.Setenv("ATTRACTION_TEST_STOP_AFTER_NODE", "")
+	runDir := filepath.Join(runsdir, "wd2")
+	workspace := filepath.Join(runDir, "workspace")
+	writeFile(t, filepath.Join(workspace, "notes.md"), "edited by hand\n")
+	writeFile(t, filepath.Join(workspace, "hotfix.go"), "package main\n")
+	if err := os.Remove(filepath.Join(workspace, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Resume = true
+	err := RunPipeline(cfg)
+	if err == nil || !strings.Contains(err.Error(), "modified notes.md; created hotfix.go; deleted old.txt") || !strings.Contains(err.Error(), "--accept-workspace-drift") {
+		t.Fatalf("expected drift refusal, got %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(runDir, "b", "status.json")); !os.IsNotExist(statErr) {
+		t.Fatalf("b ran despite drift (%v)", statErr)
+	}
+	// A refused resume must not absorb the drift into the checkpoint.
+	if err := RunPipeline(cfg); err == nil {
+		t.Fatal("second resume accepted drift without the flag")
+	}
+
+	cfg.AcceptWorkspaceDrift = true
+	if err := RunPipeline(cfg); err != nil {
+		t.Fatalf("accepted resume: %v", err)
+	}
+	evs := eventsOfType(t, runDir, "ResumeWorkspaceDrift")
+	if len(evs) != 3 || evs[0]["accepted"] != false || evs[2]["accepted"] != true || evs[2]["last_completed_node"] != "a" {
+		t.Fatalf("drift events = %v", evs)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "b", "status.json")); err != nil {
+		t.Fatalf("b did not run after accepted drift: %v", err)
+	}
+}